@@ -1,14 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net/url"
 	"os"
 	"os/signal"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,11 +26,20 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 func main() {
 	// Load configuration
 	cfg := config.Load()
+	log.SetOutput(cfg.RedactingWriter(os.Stderr))
+
+	// Background workers stop when the server shuts down
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Provider keys and MinIO credentials come from Vault when configured
+	secrets := adapters.NewSecrets(cfg)
 
 	// Initialize adapters
 	mysqlAdapter, err := adapters.NewMySQLAdapter(cfg)
@@ -31,7 +48,7 @@ func main() {
 	}
 	defer mysqlAdapter.Close()
 
-	minioAdapter, err := adapters.NewMinIOAdapter(cfg)
+	minioAdapter, err := adapters.NewMinIOAdapter(cfg, secrets)
 	if err != nil {
 		log.Fatalf("Failed to connect to MinIO: %v", err)
 	}
@@ -39,20 +56,25 @@ func main() {
 	// Initialize LLM provider (optional)
 	var llm adapters.LLMClient
 	var modelName string
+	var ollamaAdapter *adapters.OllamaAdapter
+	var googleAdapter *adapters.GoogleGeminiAdapter
 	if strings.ToLower(cfg.LLMProvider) == "google" {
-		googleAdapter, err := adapters.NewGoogleGeminiAdapter(cfg)
+		googleAdapter, err = adapters.NewGoogleGeminiAdapter(cfg, secrets)
 		if err != nil {
 			log.Fatalf("Failed to initialize Google Gemini: %v", err)
 		}
-		llm = googleAdapter
+		llm = adapters.NewLimitedLLMClient(googleAdapter, cfg.GoogleMaxConcurrency, cfg.LLMQueueTimeout)
 		modelName = cfg.GoogleModel
 	} else if strings.ToLower(cfg.LLMProvider) == "ollama" {
-		ollamaAdapter, err := adapters.NewOllamaAdapter(cfg)
+		ollamaAdapter, err = adapters.NewOllamaAdapter(cfg)
 		if err != nil {
 			log.Fatalf("Failed to connect to Ollama: %v", err)
 		}
 		defer ollamaAdapter.Close()
-		llm = ollamaAdapter
+		ollamaAdapter.StartModelCheck(bgCtx)
+		ollamaAdapter.StartKeepAlive(bgCtx)
+		// Local models thrash under parallel prompts, so queue them
+		llm = adapters.NewLimitedLLMClient(ollamaAdapter, cfg.OllamaMaxConcurrency, cfg.LLMQueueTimeout)
 		modelName = cfg.OllamaModel
 	} else {
 		// LLM disabled (retrieval-only)
@@ -62,6 +84,18 @@ func main() {
 
 	// Initialize simple RAG service (without vector search for now)
 	ragService := adapters.NewSimpleRAGService(llm, minioAdapter, mysqlAdapter, cfg)
+	if secrets != nil {
+		ragService.Moderation.UseSecrets(secrets)
+	}
+	// A configured embedder that can't be set up leaves vector search off,
+	// reported degraded, rather than ranking with a different embedder
+	embedder, err := adapters.NewEmbedder(cfg, secrets)
+	if err != nil {
+		log.Printf("Warning: vector search disabled, embedder unavailable: %v", err)
+		ragService.VectorHealth.SetupFailed(err)
+	}
+	ragService.Embedder = embedder
+	ragService.StartVectorIndex(bgCtx)
 
 	// Initialize database schema
 	err = ragService.DatabaseSchema.CreateTables()
@@ -69,23 +103,125 @@ func main() {
 		log.Fatalf("Failed to create database tables: %v", err)
 	}
 
+	if err := ragService.Flags.Load(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// Settings changed through /admin/settings take precedence over the
+	// environment
+	if overrides, err := ragService.LoadSettingOverrides(); err != nil {
+		log.Printf("Warning: %v", err)
+	} else if overrides > 0 {
+		reloadConfig(cfg, ragService)
+	}
+
+	// Re-index or fail documents a crash left stuck in processing
+	ragService.StartStaleRecovery(bgCtx)
+
+	// Chunks indexed before the embedder was configured, or under another,
+	// rank lexically only until they are backfilled
+	if missing, err := ragService.MissingEmbeddings(); err != nil {
+		log.Printf("Warning: failed to count chunks without vectors: %v", err)
+	} else if missing > 0 {
+		log.Printf("Warning: %d chunks have no vector from %s and rank lexically only; POST /admin/embeddings/backfill embeds them", missing, ragService.Embedder.Name())
+	}
+
+	// Re-ask saved queries whose documents changed and notify their owners
+	ragService.StartSavedQueries(bgCtx)
+	if ragService.Notifications.Digests != nil {
+		ragService.Notifications.Digests.Start(bgCtx)
+	}
+
+	if !adapters.ValidContextStorage(cfg.ContextStorage) {
+		log.Fatalf("CONTEXT_STORAGE must be %q, %q or %q", adapters.ContextStorageFull, adapters.ContextStorageCompressed, adapters.ContextStorageChunkIDs)
+	}
+
+	// Write questions each chunk answers, for matching alongside its text
+	ragService.StartSyntheticQuestions(bgCtx)
+
+	// Write document retrievals and downloads in batches
+	ragService.StartAccessTracking(bgCtx)
+
+	// Move originals of unused documents out of the hot bucket
+	if cfg.TieringAfter > 0 {
+		if cfg.TieringMode != adapters.TieringModeArchive && cfg.TieringMode != adapters.TieringModeDelete {
+			log.Fatalf("TIERING_MODE must be %q or %q", adapters.TieringModeArchive, adapters.TieringModeDelete)
+		}
+		ragService.StartTiering(bgCtx)
+	}
+
+	// Single sign-on; signed-in users send the issued service token as a
+	// bearer token
+	sso := adapters.NewOIDCProvider(cfg)
+	var authTokens *adapters.AuthTokens
+	if sso != nil {
+		authTokens = adapters.NewAuthTokens(cfg)
+	}
+
 	// Create a new Fiber instance
 	app := fiber.New(fiber.Config{
-		AppName:      "RAG Service API",
-		BodyLimit:    200 * 1024 * 1024, // 200MB limit for file uploads
-		ReadTimeout:  300 * time.Second, // 5 minutes timeout
-		WriteTimeout: 300 * time.Second, // 5 minutes timeout
+		AppName:   "RAG Service API",
+		BodyLimit: 200 * 1024 * 1024, // 200MB limit for file uploads
+		// Handlers are bounded per route by routeDeadlines; these only bound
+		// reading the request body and writing the response
+		ReadTimeout:  cfg.BulkTimeout,
+		WriteTimeout: cfg.BulkTimeout,
+		IdleTimeout:  120 * time.Second,
 	})
 
 	// Middleware
-	app.Use(logger.New())
+	app.Use(versionedPaths())
+	app.Use(requestid.New())
+	app.Use(logger.New(logger.Config{
+		Format: "${time} | ${locals:requestid} | ${status} | ${latency} | ${ip} | ${method} | ${path} | ${error}\n",
+		Output: cfg.RedactingWriter(os.Stdout),
+	}))
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
 		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,Cache-Control,X-Requested-With",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,Cache-Control,X-Requested-With,X-API-Key,X-Admin-Token,X-Widget-Token,X-Request-ID,X-API-Version",
+		ExposeHeaders:    "X-Request-ID,X-API-Version",
 		AllowCredentials: false,
 		MaxAge:           86400, // 24 hours
 	}))
+	app.Use(func(c *fiber.Ctx) error {
+		err := c.Next()
+		adapters.DefaultMetrics.RecordRequest(responseStatus(c, err))
+		return err
+	})
+	app.Use(auditMiddleware(ragService.DatabaseSchema))
+	app.Use(authenticateUser(authTokens))
+	app.Use(authenticateAPIToken(ragService.APITokens))
+	app.Use(attachCollectionAccess(cfg.AdminToken))
+	// Requests keep the settings they start with through a config reload
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(ragService.WithSettings(c.UserContext()))
+		return c.Next()
+	})
+	if cfg.FaultInjection {
+		log.Println("Warning: FAULT_INJECTION is enabled, requests can inject failures with X-Fault-Inject; never enable it in production")
+		app.Use(injectFaults())
+	}
+	slowRequests := adapters.NewSlowRequestLog()
+	app.Use(routeDeadlines(map[string]routeLimits{
+		routeClassAPI:        {Timeout: cfg.APITimeout, SlowThreshold: cfg.APISlowThreshold},
+		routeClassGeneration: {Timeout: cfg.GenerationTimeout, SlowThreshold: cfg.GenerationSlowThreshold},
+		routeClassBulk:       {Timeout: cfg.BulkTimeout, SlowThreshold: cfg.BulkSlowThreshold},
+	}, slowRequests))
+
+	// Anonymous usage stats, strictly opt-in
+	telemetry := adapters.NewTelemetryReporter(cfg, ragService.DatabaseSchema)
+	if cfg.TelemetryEnabled {
+		if cfg.TelemetryEndpoint == "" {
+			log.Println("Warning: TELEMETRY_ENABLED is set but TELEMETRY_ENDPOINT is empty, telemetry stays off")
+		} else {
+			telemetry.Start(bgCtx)
+		}
+	}
+
+	if cfg.AdminToken == "" && sso == nil {
+		log.Println("Warning: ADMIN_TOKEN is not set, admin endpoints are open to anyone who can reach the API")
+	}
 
 	// Serve static files
 	app.Static("/", "./web")
@@ -105,7 +241,7 @@ func main() {
 	})
 
 	app.Get("/health", func(c *fiber.Ctx) error {
-		ctx := context.Background()
+		ctx := c.UserContext()
 
 		// Check MySQL
 		mysqlHealth := "healthy"
@@ -124,13 +260,14 @@ func main() {
 		provider := strings.ToLower(cfg.LLMProvider)
 		if provider == "google" {
 			llmHealth = "healthy"
-			if cfg.GoogleAPIKey == "" {
+			// The key may come from Vault, leaving GOOGLE_API_KEY empty
+			if googleAdapter == nil || !googleAdapter.HasAPIKey(ctx) {
 				llmHealth = "unhealthy"
 			}
 		} else if provider == "ollama" {
 			llmHealth = "unhealthy"
-			if oa, ok := llm.(*adapters.OllamaAdapter); ok {
-				if err := oa.HealthCheck(ctx); err == nil {
+			if ollamaAdapter != nil {
+				if err := ollamaAdapter.HealthCheck(ctx); err == nil {
 					llmHealth = "healthy"
 				}
 			}
@@ -144,20 +281,59 @@ func main() {
 		if llmHealth != "healthy" && llmHealth != "disabled" {
 			overallHealth = "unhealthy"
 		}
+		// Queries still answer, lexically, while vector search is down
+		vector := ragService.VectorStatus()
+		if overallHealth == "healthy" && vector.Status == adapters.VectorSearchDegraded {
+			overallHealth = "degraded"
+		}
 
 		return c.JSON(fiber.Map{
 			"status":  overallHealth,
 			"service": "rag-service",
 			"services": fiber.Map{
-				"mysql": mysqlHealth,
-				"minio": minioHealth,
-				"llm":   llmHealth,
+				"mysql":  mysqlHealth,
+				"minio":  minioHealth,
+				"llm":    llmHealth,
+				"vector": vector,
 			},
 		})
 	})
 
+	// Readiness: 503 until MySQL and MinIO answer and, with Ollama, the
+	// model is pulled, saying what's missing
+	app.Get("/readyz", func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		ready := true
+		checks := fiber.Map{"mysql": "ready", "minio": "ready"}
+
+		if err := mysqlAdapter.HealthCheck(); err != nil {
+			ready = false
+			checks["mysql"] = err.Error()
+		}
+		if err := minioAdapter.HealthCheck(ctx); err != nil {
+			ready = false
+			checks["minio"] = err.Error()
+		}
+		if ollamaAdapter != nil {
+			readiness := ollamaAdapter.Readiness(ctx)
+			if readiness.State != adapters.ModelReady {
+				ready = false
+			}
+			checks["llm"] = readiness
+		}
+
+		status := fiber.StatusOK
+		if !ready {
+			status = fiber.StatusServiceUnavailable
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"ready":  ready,
+			"checks": checks,
+		})
+	})
+
 	// Chat endpoint to test LLM
-	app.Post("/chat", func(c *fiber.Ctx) error {
+	app.Post("/chat", requireQuota(ragService.Quotas, adapters.UsageQueries), func(c *fiber.Ctx) error {
 		var request struct {
 			Message string `json:"message"`
 		}
@@ -174,8 +350,11 @@ func main() {
 			})
 		}
 
-		ctx := context.Background()
+		ctx := c.UserContext()
 		response, err := llm.GenerateText(ctx, request.Message)
+		if errors.Is(err, adapters.ErrLLMSaturated) {
+			return respondLLMSaturated(c)
+		}
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
 				"error":   "Failed to generate response",
@@ -195,7 +374,7 @@ func main() {
 	})
 
 	// PDF upload endpoint
-	app.Post("/upload", func(c *fiber.Ctx) error {
+	app.Post("/upload", requireQuota(ragService.Quotas, adapters.UsageUploadBytes), func(c *fiber.Ctx) error {
 		log.Printf("Upload request received from %s", c.IP())
 
 		form, err := c.MultipartForm()
@@ -214,9 +393,14 @@ func main() {
 			})
 		}
 
+		ctx := c.UserContext()
+		collection := strings.TrimSpace(c.FormValue("collection"))
+		if err := ragService.CheckCollectionAccess(ctx, collection, adapters.PermissionWrite); err != nil {
+			return respondCollectionError(c, err)
+		}
+
 		log.Printf("Processing %d files", len(files))
 		var results []map[string]interface{}
-		ctx := context.Background()
 
 		for i, file := range files {
 			log.Printf("Processing file %d/%d: %s (size: %d bytes)", i+1, len(files), file.Filename, file.Size)
@@ -270,8 +454,10 @@ func main() {
 
 			log.Printf("Successfully read %d bytes from %s", len(pdfData), file.Filename)
 
-			// Process PDF
-			err = ragService.ProcessPDF(ctx, file.Filename, pdfData)
+			// Process PDF, behind the caller's other uploads if they have to
+			// take turns
+			queue := &adapters.QueueWait{}
+			err = ragService.ProcessPDF(adapters.WithQueueWait(ctx, queue), file.Filename, collection, pdfData)
 			if err != nil {
 				log.Printf("Failed to process PDF %s: %v", file.Filename, err)
 				results = append(results, map[string]interface{}{
@@ -283,11 +469,15 @@ func main() {
 			}
 
 			log.Printf("Successfully processed PDF %s", file.Filename)
-			results = append(results, map[string]interface{}{
+			result := map[string]interface{}{
 				"filename": file.Filename,
 				"status":   "success",
 				"message":  "PDF processed successfully",
-			})
+			}
+			if queue.Queued() {
+				result["queue"] = queue
+			}
+			results = append(results, result)
 		}
 
 		log.Printf("Upload processing completed with %d results", len(results))
@@ -297,10 +487,16 @@ func main() {
 		})
 	})
 
-	// RAG query endpoint
-	app.Post("/query", func(c *fiber.Ctx) error {
+	// Ingest a large text source in segments instead of one request: open a
+	// stream with the document's filename (and collection), POST text
+	// segments to /ingest/stream/:id as they arrive (page numbers them,
+	// default the previous segment's), then close it to complete the
+	// document. Chunks are indexed as segments arrive; the document becomes
+	// searchable on close.
+	app.Post("/ingest/stream", func(c *fiber.Ctx) error {
 		var request struct {
-			Question string `json:"question"`
+			Filename   string `json:"filename"`
+			Collection string `json:"collection"`
 		}
 
 		if err := c.BodyParser(&request); err != nil {
@@ -309,50 +505,125 @@ func main() {
 			})
 		}
 
-		if request.Question == "" {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Question is required",
-			})
+		stream, err := ragService.OpenIngestStream(c.UserContext(), request.Filename, request.Collection)
+		if err != nil {
+			return respondIngestStreamError(c, err)
 		}
 
-		ctx := context.Background()
-		response, err := ragService.Query(ctx, request.Question)
+		return c.Status(201).JSON(stream)
+	})
+
+	app.Post("/ingest/stream/:id", requireQuota(ragService.Quotas, adapters.UsageUploadBytes), func(c *fiber.Ctx) error {
+		stream, err := ragService.AppendIngestStream(c.UserContext(), c.Params("id"), c.QueryInt("page", 0), string(c.Body()))
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to process query",
-				"details": err.Error(),
-			})
+			return respondIngestStreamError(c, err)
 		}
 
-		return c.JSON(response)
+		return c.JSON(stream)
 	})
 
-	// Document stats endpoint
-	app.Get("/stats", func(c *fiber.Ctx) error {
-		ctx := context.Background()
-		stats, err := ragService.GetDocumentStats(ctx)
+	app.Post("/ingest/stream/:id/close", func(c *fiber.Ctx) error {
+		stream, err := ragService.CloseIngestStream(c.UserContext(), c.Params("id"))
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to get document stats",
-				"details": err.Error(),
-			})
+			return respondIngestStreamError(c, err)
 		}
 
-		return c.JSON(stats)
+		return c.JSON(stream)
 	})
 
-	// Handle CORS preflight for sessions
-	app.Options("/sessions", func(c *fiber.Ctx) error {
-		return c.SendStatus(200)
+	app.Delete("/ingest/stream/:id", func(c *fiber.Ctx) error {
+		if err := ragService.AbortIngestStream(c.UserContext(), c.Params("id")); err != nil {
+			return respondIngestStreamError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Ingest stream discarded",
+		})
 	})
-	app.Options("/sessions/*", func(c *fiber.Ctx) error {
-		return c.SendStatus(200)
+
+	// Build and feature information for support and debugging
+	app.Get("/version", func(c *fiber.Ctx) error {
+		schemaVersion, err := ragService.DatabaseSchema.GetSchemaVersion()
+		if err != nil {
+			log.Printf("Warning: failed to read schema version: %v", err)
+		}
+
+		provider := strings.ToLower(cfg.LLMProvider)
+		if provider == "" {
+			provider = "ollama"
+		}
+
+		scoringExpression := ragService.ScoringSource(c.UserContext())
+
+		embedderName := ""
+		if ragService.Embedder != nil {
+			embedderName = ragService.Embedder.Name()
+		}
+
+		thumbnailRenderer := "layout"
+		if ragService.Thumbnails.UsesPoppler() {
+			thumbnailRenderer = "pdftoppm"
+		}
+
+		return c.JSON(fiber.Map{
+			"build": adapters.GetBuildInfo(),
+			"schema": fiber.Map{
+				"expected": adapters.SchemaVersion,
+				"applied":  schemaVersion,
+			},
+			"features": fiber.Map{
+				"llm_provider":         provider,
+				"llm_enabled":          llm != nil,
+				"vector_search":        ragService.Embedder != nil,
+				"embedder":             embedderName,
+				"ocr":                  false,
+				"table_extraction":     true,
+				"thumbnails":           true,
+				"thumbnail_renderer":   thumbnailRenderer,
+				"cross_lingual":        cfg.RetrievalCrossLingual,
+				"transliteration":      cfg.TransliterationMatching,
+				"numeric_verification": ragService.Flags.Enabled(adapters.FlagNumericVerification),
+				"telemetry":            cfg.TelemetryEnabled && cfg.TelemetryEndpoint != "",
+				"admin_token":          cfg.AdminToken != "",
+				"hooks":                ragService.Hooks.Points(),
+				"scoring_expression":   scoringExpression,
+				"graphql":              cfg.GraphQLEnabled,
+				"sso":                  sso != nil,
+			},
+			"flags": ragService.Flags.Resolve(nil),
+		})
 	})
 
-	// Chat session management endpoints
-	app.Post("/sessions", func(c *fiber.Ctx) error {
+	// Shows whether telemetry is on and exactly what the next report contains
+	app.Get("/telemetry", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"enabled":  cfg.TelemetryEnabled && cfg.TelemetryEndpoint != "",
+			"endpoint": cfg.TelemetryEndpoint,
+			"interval": cfg.TelemetryInterval.String(),
+			"preview":  telemetry.Report(),
+		})
+	})
+
+	// Prometheus-style metrics: LLM timings, retrieval time and host usage
+	app.Get("/metrics", func(c *fiber.Ctx) error {
+		c.Set("Content-Type", "text/plain; version=0.0.4")
+		adapters.DefaultMetrics.WritePrometheus(c)
+		return nil
+	})
+
+	// RAG query endpoint
+	app.Post("/query", requireQuota(ragService.Quotas, adapters.UsageQueries), func(c *fiber.Ctx) error {
 		var request struct {
-			Title string `json:"title"`
+			Question     string          `json:"question"`
+			Debug        bool            `json:"debug"`
+			CrossLingual bool            `json:"cross_lingual"`
+			TranslateTo  string          `json:"translate_to"`
+			AnswerMode   string          `json:"answer_mode"`
+			Flags        map[string]bool `json:"flags"`
+			DryRun       bool            `json:"dry_run"`
+			MaxLatencyMs int64           `json:"max_latency_ms"`
+			// AnswerLanguage overrides APP_LANGUAGE for this request
+			AnswerLanguage string `json:"answer_language"`
 		}
 
 		if err := c.BodyParser(&request); err != nil {
@@ -361,66 +632,93 @@ func main() {
 			})
 		}
 
-		if request.Title == "" {
-			request.Title = "New Chat"
+		for name := range request.Flags {
+			if !ragService.Flags.Known(name) {
+				return c.Status(400).JSON(fiber.Map{
+					"error": fmt.Sprintf("unknown feature flag %q", name),
+				})
+			}
 		}
 
-		session, err := ragService.DatabaseSchema.CreateChatSession(request.Title)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to create chat session",
-				"details": err.Error(),
+		if request.AnswerMode != adapters.AnswerModeDefault && request.AnswerMode != adapters.AnswerModeBySource {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "answer_mode must be empty or \"by_source\"",
 			})
 		}
 
-		return c.JSON(session)
-	})
+		if request.MaxLatencyMs < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "max_latency_ms must not be negative",
+			})
+		}
 
-	app.Get("/sessions", func(c *fiber.Ctx) error {
-		limit := 50
-		offset := 0
+		if request.AnswerLanguage != "" && !adapters.ValidAnswerLanguage(request.AnswerLanguage) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "answer_language must be empty, \"en\" or \"fa\"",
+			})
+		}
 
-		sessions, err := ragService.DatabaseSchema.GetChatSessions(limit, offset)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to get chat sessions",
-				"details": err.Error(),
+		if request.Question == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Question is required",
 			})
 		}
 
-		return c.JSON(sessions)
-	})
+		opts := adapters.QueryOptions{
+			CrossLingual:   request.CrossLingual,
+			TranslateTo:    request.TranslateTo,
+			AnswerMode:     request.AnswerMode,
+			Flags:          request.Flags,
+			MaxLatency:     time.Duration(request.MaxLatencyMs) * time.Millisecond,
+			AnswerLanguage: request.AnswerLanguage,
+		}
 
-	app.Get("/sessions/:id", func(c *fiber.Ctx) error {
-		sessionID := c.Params("id")
+		// Dry run: retrieval only, with the chunks that would be sent and the
+		// estimated tokens and cost of answering
+		if request.DryRun || c.QueryBool("dry_run") {
+			c.Locals("dry_run", true)
+			estimate, err := ragService.EstimateQuery(c.UserContext(), request.Question, opts)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to estimate query",
+					"details": err.Error(),
+				})
+			}
+			return c.JSON(estimate)
+		}
 
-		session, err := ragService.DatabaseSchema.GetChatSession(sessionID)
-		if err != nil {
-			return c.Status(404).JSON(fiber.Map{
-				"error": "Chat session not found",
-			})
+		ctx := c.UserContext()
+		var trace *adapters.DebugTrace
+		if request.Debug || c.QueryBool("debug") {
+			trace = adapters.NewDebugTrace()
+			ctx = adapters.WithDebugTrace(ctx, trace)
 		}
 
-		// Get messages for this session
-		messages, err := ragService.DatabaseSchema.GetChatMessages(sessionID, 100, 0)
+		response, err := ragService.Query(ctx, request.Question, opts)
+		if errors.Is(err, adapters.ErrLLMSaturated) {
+			return respondLLMSaturated(c)
+		}
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to get chat messages",
+				"error":   "Failed to process query",
 				"details": err.Error(),
 			})
 		}
 
-		return c.JSON(fiber.Map{
-			"session":  session,
-			"messages": messages,
-		})
-	})
+		if trace != nil {
+			trace.Finish()
+			response.Debug = trace
+		}
 
-	app.Put("/sessions/:id", func(c *fiber.Ctx) error {
-		sessionID := c.Params("id")
+		return c.JSON(ragResponse(c, response, ragService.Links))
+	})
 
+	// Retriever endpoint for LangChain, LlamaIndex and similar frameworks:
+	// scored chunks only, no answer generation
+	app.Post("/retrieve", func(c *fiber.Ctx) error {
 		var request struct {
-			Title string `json:"title"`
+			Query string `json:"query"`
+			adapters.RetrieveOptions
 		}
 
 		if err := c.BodyParser(&request); err != nil {
@@ -429,45 +727,214 @@ func main() {
 			})
 		}
 
-		if request.Title == "" {
+		if strings.TrimSpace(request.Query) == "" {
 			return c.Status(400).JSON(fiber.Map{
-				"error": "Title is required",
+				"error": "Query is required",
 			})
 		}
 
-		err := ragService.DatabaseSchema.UpdateChatSession(sessionID, request.Title)
+		degradation := &adapters.Degradation{}
+		ctx := adapters.WithDegradation(c.UserContext(), degradation)
+		results, err := ragService.Retrieve(ctx, request.Query, request.RetrieveOptions)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to update chat session",
+				"error":   "Failed to retrieve chunks",
 				"details": err.Error(),
 			})
 		}
 
-		return c.JSON(fiber.Map{
-			"message": "Chat session updated successfully",
-		})
+		response := fiber.Map{
+			"query":   request.Query,
+			"results": results,
+			"count":   len(results),
+		}
+		if reasons := degradation.Reasons(); reasons != nil {
+			response["degraded"] = reasons
+		}
+		return c.JSON(response)
 	})
 
-	app.Delete("/sessions/:id", func(c *fiber.Ctx) error {
-		sessionID := c.Params("id")
+	// Score distribution of a query across the corpus, without generating
+	// an answer, for tuning score thresholds
+	app.Get("/retrieval/inspect", func(c *fiber.Ctx) error {
+		query := c.Query("q")
+		if strings.TrimSpace(query) == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "q is required",
+			})
+		}
 
-		err := ragService.DatabaseSchema.DeleteChatSession(sessionID)
+		inspection, err := ragService.InspectRetrieval(c.UserContext(), query,
+			c.QueryInt("buckets"), c.QueryInt("top"), c.QueryBool("cross_lingual"))
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to delete chat session",
+				"error":   "Failed to inspect retrieval",
 				"details": err.Error(),
 			})
 		}
 
+		return c.JSON(inspection)
+	})
+
+	// Optional read-only GraphQL API with field-level selection
+	if cfg.GraphQLEnabled {
+		graphql := adapters.NewGraphQL(ragService)
+
+		app.Get("/graphql", func(c *fiber.Ctx) error {
+			return c.JSON(fiber.Map{
+				"types": graphql.Schema(),
+			})
+		})
+
+		app.Post("/graphql", func(c *fiber.Ctx) error {
+			if len(c.Body()) > adapters.MaxGraphQLBodyBytes {
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(adapters.GraphQLResponse{
+					Errors: []adapters.GraphQLError{{Message: fmt.Sprintf("Request body exceeds %d bytes", adapters.MaxGraphQLBodyBytes)}},
+				})
+			}
+
+			var request adapters.GraphQLRequest
+			if err := c.BodyParser(&request); err != nil {
+				return c.Status(400).JSON(adapters.GraphQLResponse{
+					Errors: []adapters.GraphQLError{{Message: "Invalid request body"}},
+				})
+			}
+
+			response, err := graphql.Execute(c.UserContext(), request)
+			if err != nil {
+				return c.Status(400).JSON(adapters.GraphQLResponse{
+					Errors: []adapters.GraphQLError{{Message: err.Error()}},
+				})
+			}
+
+			return c.JSON(response)
+		})
+	}
+
+	// OpenID Connect login: /auth/login sends the user to the provider, whose
+	// callback issues a service token carrying the user's roles
+	if sso != nil {
+		app.Get("/auth/login", func(c *fiber.Ctx) error {
+			loginURL, err := sso.LoginURL(c.UserContext(), c.Query("redirect"))
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error":   "Failed to start login",
+					"details": err.Error(),
+				})
+			}
+
+			return c.Redirect(loginURL, fiber.StatusFound)
+		})
+
+		// ?redirect= on login sends the user back to that page with the token
+		// in the URL fragment; otherwise the token is returned as JSON
+		app.Get("/auth/callback", func(c *fiber.Ctx) error {
+			if providerErr := c.Query("error"); providerErr != "" {
+				return c.Status(401).JSON(fiber.Map{
+					"error":   "Login failed",
+					"details": strings.TrimSpace(providerErr + ": " + c.Query("error_description")),
+				})
+			}
+
+			user, redirect, err := sso.Exchange(c.UserContext(), c.Query("code"), c.Query("state"))
+			if err != nil {
+				return c.Status(401).JSON(fiber.Map{
+					"error":   "Login failed",
+					"details": err.Error(),
+				})
+			}
+
+			token, claims, err := authTokens.Issue(*user)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to issue token",
+					"details": err.Error(),
+				})
+			}
+
+			if redirect != "" {
+				return c.Redirect(redirect+"#token="+token, fiber.StatusFound)
+			}
+
+			return c.JSON(fiber.Map{
+				"token":      token,
+				"token_type": "Bearer",
+				"expires_at": time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339),
+				"user":       claims,
+			})
+		})
+
+		app.Get("/auth/me", func(c *fiber.Ctx) error {
+			user := requestUser(c)
+			if user == nil {
+				return c.Status(401).JSON(fiber.Map{
+					"error": "Not signed in",
+				})
+			}
+
+			return c.JSON(user)
+		})
+	}
+
+	// OpenAI-compatible endpoints so chat frontends such as Open WebUI or
+	// LibreChat can use the RAG pipeline as a model
+	v1 := app.Group("/v1", requireOpenAIKey(cfg.OpenAICompatAPIKey))
+
+	v1.Get("/models", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
-			"message": "Chat session deleted successfully",
+			"object": "list",
+			"data": []fiber.Map{{
+				"id":       cfg.OpenAICompatModel,
+				"object":   "model",
+				"created":  0,
+				"owned_by": "local_pdf_rag",
+			}},
 		})
 	})
 
-	// Document search endpoint - find which sources contain specific topics
-	app.Post("/search-sources", func(c *fiber.Ctx) error {
+	v1.Post("/chat/completions", requireQuota(ragService.Quotas, adapters.UsageQueries), func(c *fiber.Ctx) error {
+		var request adapters.ChatCompletionRequest
+		if err := c.BodyParser(&request); err != nil {
+			return respondOpenAIError(c, 400, "Invalid request body: "+err.Error())
+		}
+
+		question := request.Question()
+		if question == "" {
+			return respondOpenAIError(c, 400, "messages must include a user message")
+		}
+
+		response, err := ragService.Query(c.UserContext(), question, adapters.QueryOptions{})
+		if errors.Is(err, adapters.ErrLLMSaturated) {
+			c.Set("Retry-After", "5")
+			return respondOpenAIError(c, fiber.StatusServiceUnavailable, adapters.ErrLLMSaturated.Error())
+		}
+		if err != nil {
+			return respondOpenAIError(c, 500, "Failed to process query: "+err.Error())
+		}
+
+		completion := adapters.NewChatCompletion(cfg.OpenAICompatModel, question, response)
+		if !request.Stream {
+			return c.JSON(completion)
+		}
+
+		c.Set("Content-Type", "text/event-stream")
+		c.Set("Cache-Control", "no-cache")
+		c.Set("Connection", "keep-alive")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			if err := completion.WriteStream(w); err != nil {
+				log.Printf("Warning: chat completion stream interrupted: %v", err)
+			}
+		})
+		return nil
+	})
+
+	// Translate an answer and its cited snippets, e.g. for answers stored before
+	// the session language was set
+	app.Post("/translate", func(c *fiber.Ctx) error {
 		var request struct {
-			Query string `json:"query"`
+			Answer   string   `json:"answer"`
+			Snippets []string `json:"snippets"`
+			Language string   `json:"language"`
 		}
 
 		if err := c.BodyParser(&request); err != nil {
@@ -476,90 +943,139 @@ func main() {
 			})
 		}
 
-		if request.Query == "" {
+		if request.Answer == "" || request.Language == "" {
 			return c.Status(400).JSON(fiber.Map{
-				"error": "Query is required",
+				"error": "Answer and language are required",
 			})
 		}
 
-		// Get all documents
-		documents, err := ragService.DatabaseSchema.GetAllDocuments()
+		if llm == nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Translation requires an LLM provider",
+			})
+		}
+
+		ctx := c.UserContext()
+		translated, err := ragService.TranslateText(ctx, request.Answer, request.Language)
+		if errors.Is(err, adapters.ErrLLMSaturated) {
+			return respondLLMSaturated(c)
+		}
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to get documents",
+				"error":   "Failed to translate answer",
 				"details": err.Error(),
 			})
 		}
 
-		// Search through all documents for the query
-		var relevantSources []map[string]interface{}
-		queryWords := strings.Fields(strings.ToLower(request.Query))
-
-		for _, doc := range documents {
-			if doc.Status != "completed" {
-				continue
-			}
-
-			// Get chunks from this document
-			chunks, err := ragService.DatabaseSchema.GetChunksByDocument(doc.ID, 100, 0)
+		snippets := make([]fiber.Map, 0, len(request.Snippets))
+		for _, snippet := range request.Snippets {
+			translatedSnippet, err := ragService.TranslateText(ctx, snippet, request.Language)
 			if err != nil {
-				continue
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to translate snippet",
+					"details": err.Error(),
+				})
 			}
+			snippets = append(snippets, fiber.Map{
+				"original":   snippet,
+				"translated": translatedSnippet,
+			})
+		}
 
-			// Check if any chunk contains the query
-			var relevantChunks []string
-			maxScore := 0.0
+		return c.JSON(fiber.Map{
+			"language":        request.Language,
+			"answer":          translated,
+			"original_answer": request.Answer,
+			"snippets":        snippets,
+		})
+	})
 
-			for _, chunk := range chunks {
-				score := ragService.CalculateRelevanceScore(queryWords, strings.ToLower(chunk.ChunkText))
-				if score > 0.1 { // Only include chunks with some relevance
-					relevantChunks = append(relevantChunks, chunk.ChunkText)
-					if score > maxScore {
-						maxScore = score
-					}
-				}
-			}
+	// Query history; corpus_version and snapshot_id identify the document set
+	// each answer was given against, for diffing via /admin/snapshots/:id/diff.
+	// include_context=true adds each answer's retrieval context.
+	app.Get("/queries", func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 20)
+		offset := c.QueryInt("offset", 0)
 
-			// If we found relevant chunks, add this document to results
-			if len(relevantChunks) > 0 {
-				// Get a snippet from the most relevant chunk
-				snippet := ""
-				if len(relevantChunks) > 0 {
-					snippet = relevantChunks[0]
-					if len(snippet) > 200 {
-						snippet = snippet[:200] + "..."
-					}
-				}
+		queries, err := ragService.DatabaseSchema.GetQueries(limit, offset)
+		if err == nil {
+			queries, err = ragService.ReadableQueries(c.UserContext(), queries)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get queries",
+				"details": err.Error(),
+			})
+		}
 
-				relevantSources = append(relevantSources, map[string]interface{}{
-					"document_id":     doc.ID,
-					"filename":        doc.OriginalFilename,
-					"relevance_score": maxScore,
-					"chunk_count":     len(relevantChunks),
-					"snippet":         snippet,
-					"uploaded_at":     doc.CreatedAt,
-				})
+		items := make([]fiber.Map, 0, len(queries))
+		for _, q := range queries {
+			item := fiber.Map{
+				"id":             q.ID,
+				"question":       q.Question,
+				"answer":         q.Answer,
+				"confidence":     q.Confidence,
+				"sources":        q.Sources,
+				"corpus_version": q.CorpusVersion,
+				"rating":         q.Rating,
+				"created_at":     q.CreatedAt,
+			}
+			if q.CorpusVersion != "" {
+				item["snapshot_id"] = adapters.CorpusSnapshotID(q.CorpusVersion)
+			}
+			if c.QueryBool("include_context") {
+				text, err := ragService.QueryContext(&q)
+				if err != nil {
+					return c.Status(500).JSON(fiber.Map{
+						"error":   "Failed to get query context",
+						"details": err.Error(),
+					})
+				}
+				item["context"] = text
 			}
+			items = append(items, item)
 		}
 
-		// Sort by relevance score (highest first)
-		sort.Slice(relevantSources, func(i, j int) bool {
-			return relevantSources[i]["relevance_score"].(float64) > relevantSources[j]["relevance_score"].(float64)
-		})
-
 		return c.JSON(fiber.Map{
-			"query":   request.Query,
-			"sources": relevantSources,
-			"count":   len(relevantSources),
+			"queries": items,
+			"count":   len(items),
 		})
 	})
 
-	// RAG chat endpoint with session support
-	app.Post("/sessions/:id/chat", func(c *fiber.Ctx) error {
-		sessionID := c.Params("id")
+	// Stream the query history as CSV or JSON lines for offline analysis or
+	// fine-tuning datasets; from and to bound created_at
+	app.Get("/queries/export", func(c *fiber.Ctx) error {
+		format := c.Query("format", adapters.QueryExportCSV)
+		contentType := "text/csv; charset=utf-8"
+		switch format {
+		case adapters.QueryExportCSV:
+		case adapters.QueryExportJSONL:
+			contentType = "application/x-ndjson"
+		default:
+			return c.Status(400).JSON(fiber.Map{
+				"error": "format must be csv or jsonl",
+			})
+		}
+		filter := adapters.QueryExportFilter{From: c.Query("from"), To: c.Query("to")}
+		if ok, err := requireAllCollections(c, ragService); !ok {
+			return err
+		}
+
+		c.Set("Content-Type", contentType)
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"queries_%s.%s\"", time.Now().Format("20060102_150405"), format))
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			if err := ragService.DatabaseSchema.ExportQueries(w, format, filter); err != nil {
+				log.Printf("Warning: query export interrupted: %v", err)
+			}
+		})
+		return nil
+	})
 
+	// Rate a stored query's answer: 1 approves it for the fine-tuning
+	// dataset, -1 rejects it, 0 clears the rating
+	app.Put("/queries/:id/rating", func(c *fiber.Ctx) error {
 		var request struct {
-			Message string `json:"message"`
+			Rating int `json:"rating"`
 		}
 
 		if err := c.BodyParser(&request); err != nil {
@@ -567,95 +1083,3516 @@ func main() {
 				"error": "Invalid request body",
 			})
 		}
+		if request.Rating < -1 || request.Rating > 1 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "rating must be 1, -1 or 0",
+			})
+		}
 
-		if request.Message == "" {
+		err := ragService.DatabaseSchema.RateQuery(c.Params("id"), request.Rating)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Query not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to rate query",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"id":     c.Params("id"),
+			"rating": request.Rating,
+		})
+	})
+
+	// Stream the approved (positively rated) queries as a JSONL fine-tuning
+	// dataset of context, question and answer; format is messages (chat
+	// fine-tuning tools) or alpaca
+	app.Get("/queries/dataset", func(c *fiber.Ctx) error {
+		format := c.Query("format", adapters.DatasetFormatMessages)
+		if format != adapters.DatasetFormatMessages && format != adapters.DatasetFormatAlpaca {
 			return c.Status(400).JSON(fiber.Map{
-				"error": "Message is required",
+				"error": "format must be messages or alpaca",
 			})
 		}
+		if ok, err := requireAllCollections(c, ragService); !ok {
+			return err
+		}
 
-		// Store user message
-		err := ragService.DatabaseSchema.AddChatMessage(sessionID, "user", request.Message, "", 0)
+		c.Set("Content-Type", "application/x-ndjson")
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"dataset_%s_%s.jsonl\"", format, time.Now().Format("20060102_150405")))
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			written, err := ragService.DatabaseSchema.ExportFineTuningDataset(w, format)
+			if err != nil {
+				log.Printf("Warning: dataset export interrupted after %d examples: %v", written, err)
+			}
+		})
+		return nil
+	})
+
+	// A stored query, as linked from /search; include_context=true adds the
+	// answer's retrieval context
+	app.Get("/queries/:id", func(c *fiber.Ctx) error {
+		q, err := ragService.DatabaseSchema.GetQuery(c.Params("id"))
+		if err == nil {
+			// Answers drawn from collections the caller can't read look
+			// like they don't exist
+			var readable []adapters.QueryRecord
+			if readable, err = ragService.ReadableQueries(c.UserContext(), []adapters.QueryRecord{*q}); err == nil && len(readable) == 0 {
+				err = sql.ErrNoRows
+			}
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Query not found",
+			})
+		}
 		if err != nil {
-			log.Printf("Warning: failed to store user message: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get query",
+				"details": err.Error(),
+			})
 		}
 
-		// Process RAG query
-		ctx := context.Background()
-		response, err := ragService.Query(ctx, request.Message)
+		item := fiber.Map{
+			"id":             q.ID,
+			"question":       q.Question,
+			"answer":         q.Answer,
+			"confidence":     q.Confidence,
+			"sources":        q.Sources,
+			"corpus_version": q.CorpusVersion,
+			"rating":         q.Rating,
+			"created_at":     q.CreatedAt,
+		}
+		if q.CorpusVersion != "" {
+			item["snapshot_id"] = adapters.CorpusSnapshotID(q.CorpusVersion)
+		}
+		if c.QueryBool("include_context") {
+			text, err := ragService.QueryContext(q)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to get query context",
+					"details": err.Error(),
+				})
+			}
+			item["context"] = text
+		}
+		return c.JSON(item)
+	})
+
+	// The caller's usage and limits for the current month
+	app.Get("/usage", func(c *fiber.Ctx) error {
+		keyID := meteredActor(c)
+		period := adapters.UsagePeriod(time.Now())
+
+		usage, err := ragService.Quotas.Usage(keyID, period)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to process query",
+				"error":   "Failed to get usage",
+				"details": err.Error(),
+			})
+		}
+		limits, err := ragService.Quotas.Limits(keyID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get quota",
 				"details": err.Error(),
 			})
 		}
 
-		// Store assistant response
-		sourcesJSON := `["` + strings.Join(response.Sources, `","`) + `"]`
-		err = ragService.DatabaseSchema.AddChatMessage(sessionID, "assistant", response.Answer, sourcesJSON, response.Confidence)
+		return c.JSON(fiber.Map{
+			"key_id": keyID,
+			"period": period,
+			"usage":  usage,
+			"limits": limits,
+		})
+	})
+
+	// The caller's notifications, newest first; ?unread=true for unread only
+	app.Get("/notifications", func(c *fiber.Ctx) error {
+		recipient := requestActor(c)
+		limit := c.QueryInt("limit", 50)
+		if limit <= 0 || limit > 500 {
+			limit = 50
+		}
+		offset := c.QueryInt("offset", 0)
+		if offset < 0 {
+			offset = 0
+		}
+
+		notifications, err := ragService.DatabaseSchema.GetNotifications(recipient, c.QueryBool("unread"), limit, offset)
 		if err != nil {
-			log.Printf("Warning: failed to store assistant message: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get notifications",
+				"details": err.Error(),
+			})
+		}
+		unread, err := ragService.DatabaseSchema.CountUnreadNotifications(recipient)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to count notifications",
+				"details": err.Error(),
+			})
 		}
 
-		return c.JSON(response)
+		return c.JSON(fiber.Map{
+			"items":  notifications,
+			"count":  len(notifications),
+			"unread": unread,
+		})
 	})
 
-	// Flush all data endpoint
-	app.Delete("/flush", func(c *fiber.Ctx) error {
-		// Clear all chat sessions and messages
-		err := ragService.DatabaseSchema.FlushAllData()
+	app.Post("/notifications/read-all", func(c *fiber.Ctx) error {
+		updated, err := ragService.DatabaseSchema.MarkAllNotificationsRead(requestActor(c))
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to flush data",
+				"error":   "Failed to update notifications",
 				"details": err.Error(),
 			})
 		}
 
-		// Clear all files from MinIO
-		err = ragService.MinIOAdapter.FlushAllFiles(context.Background())
+		return c.JSON(fiber.Map{
+			"updated": updated,
+		})
+	})
+
+	app.Post("/notifications/:id/read", func(c *fiber.Ctx) error {
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid notification id",
+			})
+		}
+
+		err = ragService.DatabaseSchema.MarkNotificationRead(requestActor(c), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Notification not found",
+			})
+		}
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
-				"error":   "Failed to flush files from MinIO",
+				"error":   "Failed to update notification",
 				"details": err.Error(),
 			})
 		}
 
 		return c.JSON(fiber.Map{
-			"message": "All data has been successfully cleared",
+			"message": "Notification marked read",
 		})
 	})
 
-	// File download endpoint
-	app.Get("/files/:documentId/:filename", func(c *fiber.Ctx) error {
-		documentID := c.Params("documentId")
-		filename := c.Params("filename")
+	app.Get("/notifications/settings", func(c *fiber.Ctx) error {
+		settings, err := ragService.Notifications.Settings(requestActor(c))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get notification settings",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"settings":          settings,
+			"email_available":   ragService.Notifications.Mailer != nil,
+			"digest_available":  ragService.Notifications.Digests != nil,
+			"webhook_available": ragService.Notifications.WebhookURL != "",
+		})
+	})
+
+	// Email notifications to {"email": "...", "digest": true}; an empty
+	// address stops them, digest bundles them into periodic digests
+	app.Put("/notifications/settings", func(c *fiber.Ctx) error {
+		var request struct {
+			Email  string `json:"email"`
+			Digest bool   `json:"digest"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		if err := ragService.Notifications.UpdateSettings(requestActor(c), request.Email, request.Digest); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Failed to update notification settings",
+				"details": err.Error(),
+			})
+		}
+
+		settings, err := ragService.Notifications.Settings(requestActor(c))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get notification settings",
+				"details": err.Error(),
+			})
+		}
 
-		objectName := fmt.Sprintf("%s/%s", documentID, filename)
+		return c.JSON(fiber.Map{
+			"settings": settings,
+		})
+	})
+
+	// Saved queries are re-asked every interval_hours once the documents
+	// have changed; the owner is notified when the answer changes
+	app.Post("/saved-queries", func(c *fiber.Ctx) error {
+		var request struct {
+			Question      string `json:"question"`
+			IntervalHours int    `json:"interval_hours"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		saved, err := ragService.CreateSavedQuery(c.UserContext(), request.Question, request.IntervalHours)
+		if errors.Is(err, adapters.ErrInvalidSavedQuery) {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid saved query",
+				"details": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to save query",
+				"details": err.Error(),
+			})
+		}
+
+		return c.Status(201).JSON(saved)
+	})
 
-		// Get file from MinIO
-		fileData, err := ragService.MinIOAdapter.GetObject(context.Background(), "documents", objectName)
+	app.Get("/saved-queries", func(c *fiber.Ctx) error {
+		saved, err := ragService.DatabaseSchema.GetSavedQueries(requestActor(c))
 		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get saved queries",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"items": saved,
+			"count": len(saved),
+		})
+	})
+
+	app.Delete("/saved-queries/:id", func(c *fiber.Ctx) error {
+		err := ragService.DatabaseSchema.DeleteSavedQuery(requestActor(c), c.Params("id"))
+		if errors.Is(err, sql.ErrNoRows) {
 			return c.Status(404).JSON(fiber.Map{
-				"error": "File not found",
+				"error": "Saved query not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to delete saved query",
+				"details": err.Error(),
 			})
 		}
 
-		c.Set("Content-Type", "application/pdf")
-		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-		return c.Send(fileData)
+		return c.JSON(fiber.Map{
+			"message": "Saved query deleted",
+		})
 	})
 
-	// Graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	// Document stats endpoint
+	app.Get("/stats", func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		stats, err := ragService.GetDocumentStats(ctx)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get document stats",
+				"details": err.Error(),
+			})
+		}
 
-	go func() {
-		<-c
-		log.Println("Gracefully shutting down...")
-		app.Shutdown()
-	}()
+		return c.JSON(stats)
+	})
 
-	// Start server
+	// Handle CORS preflight for summaries
+	app.Options("/summarize", func(c *fiber.Ctx) error {
+		return c.SendStatus(200)
+	})
+
+	// Start an executive summary of the whole corpus or selected documents.
+	// Summaries run in the background; poll GET /summaries/:id for progress.
+	app.Post("/summarize", func(c *fiber.Ctx) error {
+		var request struct {
+			DocumentIDs []string `json:"document_ids"`
+		}
+
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&request); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid request body",
+				})
+			}
+		}
+
+		if llm == nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Summarization requires an LLM provider",
+			})
+		}
+
+		// The job outlives the request but keeps the caller's collection
+		// permissions
+		jobCtx := adapters.WithCollectionAccess(bgCtx, adapters.CollectionAccessFromContext(c.UserContext()))
+		summary, err := ragService.StartCorpusSummary(jobCtx, request.DocumentIDs)
+		if errors.Is(err, adapters.ErrCollectionForbidden) {
+			return respondCollectionError(c, err)
+		}
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Failed to start summary",
+				"details": err.Error(),
+			})
+		}
+
+		return c.Status(202).JSON(summary)
+	})
+
+	app.Get("/summaries", func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 20)
+		offset := c.QueryInt("offset", 0)
+
+		summaries, err := ragService.DatabaseSchema.GetSummaries(limit, offset)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get summaries",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"summaries": summaries,
+			"count":     len(summaries),
+		})
+	})
+
+	app.Get("/summaries/:id", func(c *fiber.Ctx) error {
+		summary, err := ragService.DatabaseSchema.GetSummary(c.Params("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Summary not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get summary",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(summary)
+	})
+
+	// Handle CORS preflight for reports
+	app.Options("/reports", func(c *fiber.Ctx) error {
+		return c.SendStatus(200)
+	})
+
+	// Compile a report answering a list of questions (or a template's
+	// questions) with citations. Runs in the background like summaries.
+	app.Post("/reports", func(c *fiber.Ctx) error {
+		var request struct {
+			Title     string   `json:"title"`
+			Questions []string `json:"questions"`
+			Template  string   `json:"template"`
+			PDF       bool     `json:"pdf"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		questions := make([]string, 0, len(request.Questions))
+		if request.Template != "" {
+			templateQuestions, ok := adapters.ReportTemplates[request.Template]
+			if !ok {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Unknown report template",
+				})
+			}
+			questions = append(questions, templateQuestions...)
+		}
+		for _, question := range request.Questions {
+			if question = strings.TrimSpace(question); question != "" {
+				questions = append(questions, question)
+			}
+		}
+
+		if len(questions) == 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Questions or a template are required",
+			})
+		}
+
+		if request.Title == "" {
+			request.Title = "Document Report"
+		}
+
+		// The job outlives the request but keeps the caller's collection
+		// permissions
+		jobCtx := adapters.WithCollectionAccess(bgCtx, adapters.CollectionAccessFromContext(c.UserContext()))
+		report, err := ragService.StartReport(jobCtx, adapters.ReportRequest{
+			Title:     request.Title,
+			Questions: questions,
+			PDF:       request.PDF,
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to start report",
+				"details": err.Error(),
+			})
+		}
+
+		return c.Status(202).JSON(report)
+	})
+
+	app.Get("/reports", func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 20)
+		offset := c.QueryInt("offset", 0)
+
+		reports, err := ragService.DatabaseSchema.GetReports(limit, offset)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get reports",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"reports": reports,
+			"count":   len(reports),
+		})
+	})
+
+	app.Get("/reports/:id", func(c *fiber.Ctx) error {
+		report, err := ragService.DatabaseSchema.GetReport(c.Params("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Report not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get report",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(report)
+	})
+
+	// Download a finished report as Markdown (default) or ?format=pdf
+	app.Get("/reports/:id/download", func(c *fiber.Ctx) error {
+		report, err := ragService.DatabaseSchema.GetReport(c.Params("id"))
+		if err != nil || report.Status != "completed" {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Report not available",
+			})
+		}
+
+		objectName, contentType, extension := report.MarkdownObject, "text/markdown; charset=utf-8", "md"
+		if c.Query("format") == "pdf" {
+			if report.PDFObject == "" {
+				return c.Status(404).JSON(fiber.Map{
+					"error": "Report was not rendered to PDF",
+				})
+			}
+			objectName, contentType, extension = report.PDFObject, "application/pdf", "pdf"
+		}
+
+		data, err := ragService.MinIOAdapter.GetObject(c.UserContext(), "documents", objectName)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "File not found",
+			})
+		}
+
+		c.Set("Content-Type", contentType)
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", report.ID, extension))
+		return c.Send(data)
+	})
+
+	// Handle CORS preflight for sessions
+	app.Options("/sessions", func(c *fiber.Ctx) error {
+		return c.SendStatus(200)
+	})
+	app.Options("/sessions/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(200)
+	})
+
+	// Chat session management endpoints
+	app.Post("/sessions", func(c *fiber.Ctx) error {
+		var request struct {
+			Title    string `json:"title"`
+			Language string `json:"language"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		if request.Title == "" {
+			request.Title = "New Chat"
+		}
+
+		session, err := ragService.DatabaseSchema.CreateChatSession(request.Title, request.Language)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to create chat session",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(session)
+	})
+
+	app.Get("/sessions", func(c *fiber.Ctx) error {
+		limit := 50
+		offset := 0
+
+		sessions, err := ragService.DatabaseSchema.GetChatSessions(limit, offset)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get chat sessions",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(sessions)
+	})
+
+	app.Get("/sessions/:id", func(c *fiber.Ctx) error {
+		sessionID := c.Params("id")
+
+		session, err := ragService.DatabaseSchema.GetChatSession(sessionID)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Chat session not found",
+			})
+		}
+
+		// Get messages for this session
+		messages, err := ragService.DatabaseSchema.GetChatMessages(sessionID, 100, 0)
+		if err == nil {
+			messages, err = ragService.ReadableMessages(c.UserContext(), messages)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get chat messages",
+				"details": err.Error(),
+			})
+		}
+		// The retrieval context of answers is rebuilt only when asked for
+		if c.QueryBool("include_context") {
+			if err := ragService.ExpandMessageContexts(sessionID, messages); err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to get message contexts",
+					"details": err.Error(),
+				})
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"session":       session,
+			"messages":      messages,
+			"download_urls": ragService.Links.MessageDownloadURLs(messages),
+		})
+	})
+
+	app.Put("/sessions/:id", func(c *fiber.Ctx) error {
+		sessionID := c.Params("id")
+
+		var request struct {
+			Title    string  `json:"title"`
+			Language *string `json:"language"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		if request.Title == "" && request.Language == nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Title is required",
+			})
+		}
+
+		if request.Title != "" {
+			err := ragService.DatabaseSchema.UpdateChatSession(sessionID, request.Title)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to update chat session",
+					"details": err.Error(),
+				})
+			}
+		}
+
+		if request.Language != nil {
+			err := ragService.DatabaseSchema.UpdateChatSessionLanguage(sessionID, *request.Language)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to update chat session",
+					"details": err.Error(),
+				})
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Chat session updated successfully",
+		})
+	})
+
+	app.Delete("/sessions/:id", func(c *fiber.Ctx) error {
+		sessionID := c.Params("id")
+
+		err := ragService.DatabaseSchema.DeleteChatSession(sessionID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to delete chat session",
+				"details": err.Error(),
+			})
+		}
+		ragService.SessionAnswers.Forget(sessionID)
+
+		return c.JSON(fiber.Map{
+			"message": "Chat session deleted successfully",
+		})
+	})
+
+	// Create a read-only link to a session; the token is only shown here
+	app.Post("/sessions/:id/shares", func(c *fiber.Ctx) error {
+		var request struct {
+			ExpiresInHours int `json:"expires_in_hours"`
+		}
+
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&request); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid request body",
+				})
+			}
+		}
+		if request.ExpiresInHours < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "expires_in_hours must be positive",
+			})
+		}
+
+		ttl := time.Duration(request.ExpiresInHours) * time.Hour
+		share, token, err := ragService.ShareSession(c.Params("id"), ttl)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Chat session not found",
+			})
+		}
+		if errors.Is(err, adapters.ErrShareTTL) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to share chat session",
+				"details": err.Error(),
+			})
+		}
+
+		return c.Status(201).JSON(fiber.Map{
+			"share": share,
+			"token": token,
+			"url":   "/shared/" + token,
+		})
+	})
+
+	app.Get("/sessions/:id/shares", func(c *fiber.Ctx) error {
+		shares, err := ragService.DatabaseSchema.GetSessionShares(c.Params("id"))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get share links",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"shares": shares,
+			"count":  len(shares),
+		})
+	})
+
+	app.Delete("/sessions/:id/shares/:shareId", func(c *fiber.Ctx) error {
+		err := ragService.DatabaseSchema.RevokeSessionShare(c.Params("id"), c.Params("shareId"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Share link not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to revoke share link",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Share link revoked",
+		})
+	})
+
+	// Read-only view of a shared session; the token is the only credential
+	app.Get("/shared/:token", func(c *fiber.Ctx) error {
+		shared, err := ragService.OpenSharedSession(c.Params("token"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Shared session not found",
+			})
+		}
+		if errors.Is(err, adapters.ErrShareExpired) || errors.Is(err, adapters.ErrShareRevoked) {
+			return c.Status(410).JSON(fiber.Map{
+				"error":   "Share link is no longer valid",
+				"details": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to open shared session",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(shared)
+	})
+
+	// Handle CORS preflight for library management
+	app.Options("/library/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(200)
+	})
+	app.Options("/documents/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(200)
+	})
+
+	// List documents, optionally by status; stale flags processing documents
+	// that recovery will pick up
+	app.Get("/documents", func(c *fiber.Ctx) error {
+		filter := adapters.DocumentFilter{
+			Status: c.Query("status"),
+			SortBy: c.Query("sort", "updated_at"),
+			Order:  c.Query("order", "asc"),
+			Limit:  c.QueryInt("limit", 100),
+			Offset: c.QueryInt("offset", 0),
+			Tag:    c.Query("tag"),
+		}
+		before, err := parseBefore(c.Query("before"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		filter.Before = before
+		if filter.Limit <= 0 || filter.Limit > 500 {
+			filter.Limit = 100
+		}
+		if filter.Offset < 0 {
+			filter.Offset = 0
+		}
+		hidden, err := ragService.HiddenCollections(c.UserContext())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get documents",
+				"details": err.Error(),
+			})
+		}
+		filter.HiddenCollections = hidden
+		filter.OnlyCollections = ragService.OnlyCollections(c.UserContext())
+
+		documents, total, err := ragService.DatabaseSchema.ListDocuments(filter)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get documents",
+				"details": err.Error(),
+			})
+		}
+
+		items := make([]fiber.Map, 0, len(documents))
+		for _, doc := range documents {
+			items = append(items, fiber.Map{
+				"id":          doc.ID,
+				"filename":    doc.OriginalFilename,
+				"status":      doc.Status,
+				"chunk_count": doc.ChunkCount,
+				"created_at":  doc.CreatedAt,
+				"updated_at":  doc.UpdatedAt,
+				"stale":       ragService.IsStale(doc),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"documents":         items,
+			"total":             total,
+			"stale_after":       cfg.StaleProcessingTimeout.String(),
+			"recovery_attempts": cfg.StaleProcessingRetries,
+		})
+	})
+
+	// Bulk metadata update: set or remove keys, tag and move many documents to
+	// a collection in one transaction
+	app.Patch("/documents", func(c *fiber.Ctx) error {
+		var request struct {
+			DocumentIDs []string `json:"document_ids"`
+			adapters.MetadataUpdate
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		updated, err := ragService.BulkUpdateMetadata(c.UserContext(), request.DocumentIDs, &request.MetadataUpdate)
+		if errors.Is(err, adapters.ErrCollectionForbidden) {
+			return respondCollectionError(c, err)
+		}
+		var missing *adapters.MissingDocumentsError
+		if errors.As(err, &missing) {
+			return c.Status(404).JSON(fiber.Map{
+				"error":   "Documents not found, nothing was updated",
+				"missing": missing.IDs,
+			})
+		}
+		if errors.Is(err, adapters.ErrInvalidMetadataUpdate) {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid metadata update",
+				"details": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to update documents",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Documents updated",
+			"updated": updated,
+		})
+	})
+
+	// Document library view: filtered/sorted documents plus storage usage
+	app.Get("/library", func(c *fiber.Ctx) error {
+		filter := adapters.DocumentFilter{
+			Status: c.Query("status"),
+			Search: c.Query("q"),
+			SortBy: c.Query("sort", "created_at"),
+			Order:  c.Query("order", "desc"),
+			Limit:  c.QueryInt("limit", 50),
+			Offset: c.QueryInt("offset", 0),
+		}
+		if filter.Limit <= 0 || filter.Limit > 500 {
+			filter.Limit = 50
+		}
+		if filter.Offset < 0 {
+			filter.Offset = 0
+		}
+		hidden, err := ragService.HiddenCollections(c.UserContext())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get documents",
+				"details": err.Error(),
+			})
+		}
+		filter.HiddenCollections = hidden
+		filter.OnlyCollections = ragService.OnlyCollections(c.UserContext())
+
+		documents, total, err := ragService.DatabaseSchema.ListDocuments(filter)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get documents",
+				"details": err.Error(),
+			})
+		}
+
+		usage, err := ragService.GetStorageUsage(c.UserContext())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get storage usage",
+				"details": err.Error(),
+			})
+		}
+
+		verified := requestVerified(c, cfg.AdminToken)
+		items := make([]fiber.Map, 0, len(documents))
+		for _, doc := range documents {
+			items = append(items, fiber.Map{
+				"id":            doc.ID,
+				"filename":      doc.OriginalFilename,
+				"file_size":     doc.FileSize,
+				"status":        doc.Status,
+				"chunk_count":   doc.ChunkCount,
+				"created_at":    doc.CreatedAt,
+				"updated_at":    doc.UpdatedAt,
+				"thumbnail_url": fmt.Sprintf("/documents/%s/thumbnail", doc.ID),
+				"storage_tier":  doc.StorageTier,
+			})
+			// Listing links for anyone would let a scraper download the
+			// whole library
+			if verified {
+				items[len(items)-1]["download_url"] = ragService.Links.DownloadURL(doc.ID, doc.OriginalFilename)
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"documents": items,
+			"total":     total,
+			"limit":     filter.Limit,
+			"offset":    filter.Offset,
+			"storage":   usage,
+		})
+	})
+
+	// Bulk delete of selected library documents
+	app.Post("/library/delete", func(c *fiber.Ctx) error {
+		var request struct {
+			DocumentIDs []string `json:"document_ids"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		if len(request.DocumentIDs) == 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "document_ids is required",
+			})
+		}
+
+		ctx := c.UserContext()
+		var results []fiber.Map
+		deleted := 0
+		for _, id := range request.DocumentIDs {
+			if err := ragService.DeleteDocument(ctx, id); err != nil {
+				results = append(results, fiber.Map{"document_id": id, "status": "error", "message": err.Error()})
+				continue
+			}
+			deleted++
+			results = append(results, fiber.Map{"document_id": id, "status": "deleted"})
+		}
+
+		return c.JSON(fiber.Map{
+			"deleted": deleted,
+			"results": results,
+		})
+	})
+
+	// Bulk delete by filter: removes the documents matching status, before
+	// (creation date) and tag, with their chunks and files, oldest first and
+	// at most maxBulkDeleteDocuments per call. dry_run=true only counts and
+	// lists them; pass that count as confirm to refuse the delete if the
+	// matches changed since.
+	app.Delete("/documents", func(c *fiber.Ctx) error {
+		filter := adapters.DocumentFilter{
+			Status: c.Query("status"),
+			Tag:    c.Query("tag"),
+			SortBy: "created_at",
+			Order:  "asc",
+			Limit:  maxBulkDeleteDocuments,
+		}
+		before, err := parseBefore(c.Query("before"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		filter.Before = before
+		if filter.Status == "" && filter.Tag == "" && filter.Before.IsZero() {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "At least one of status, before or tag is required",
+			})
+		}
+
+		ctx := c.UserContext()
+		hidden, err := ragService.HiddenCollections(ctx)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to find documents",
+				"details": err.Error(),
+			})
+		}
+		filter.HiddenCollections = hidden
+		filter.OnlyCollections = ragService.OnlyCollections(ctx)
+
+		documents, total, err := ragService.DatabaseSchema.ListDocuments(filter)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to find documents",
+				"details": err.Error(),
+			})
+		}
+
+		if c.QueryBool("dry_run") {
+			items := make([]fiber.Map, 0, len(documents))
+			for _, doc := range documents {
+				items = append(items, fiber.Map{
+					"id":         doc.ID,
+					"filename":   doc.OriginalFilename,
+					"status":     doc.Status,
+					"created_at": doc.CreatedAt,
+				})
+			}
+			return c.JSON(fiber.Map{
+				"dry_run": true,
+				"matched": total,
+				"items":   items,
+				"count":   len(items),
+			})
+		}
+
+		if confirm := c.Query("confirm"); confirm != "" && confirm != strconv.Itoa(total) {
+			return c.Status(409).JSON(fiber.Map{
+				"error":   "Matching documents changed since the dry run",
+				"matched": total,
+			})
+		}
+
+		var results []fiber.Map
+		deleted := 0
+		for _, doc := range documents {
+			if err := ragService.DeleteDocument(ctx, doc.ID); err != nil {
+				results = append(results, fiber.Map{"document_id": doc.ID, "status": "error", "message": err.Error()})
+				continue
+			}
+			deleted++
+			results = append(results, fiber.Map{"document_id": doc.ID, "status": "deleted"})
+		}
+
+		return c.JSON(fiber.Map{
+			"matched":   total,
+			"deleted":   deleted,
+			"remaining": total - deleted,
+			"results":   results,
+		})
+	})
+
+	// A document's extracted text, page by page, or one page with ?page=N;
+	// format=text returns it as plain text
+	app.Get("/documents/:id/text", func(c *fiber.Ctx) error {
+		pages, err := ragService.DocumentText(c.UserContext(), c.Params("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Document not found",
+			})
+		}
+		if errors.Is(err, adapters.ErrCollectionForbidden) {
+			return respondCollectionError(c, err)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get document text",
+				"details": err.Error(),
+			})
+		}
+
+		if page := c.QueryInt("page", 0); page > 0 {
+			var selected []adapters.PageText
+			for _, p := range pages {
+				if p.Page == page {
+					selected = append(selected, p)
+				}
+			}
+			if len(selected) == 0 {
+				return c.Status(404).JSON(fiber.Map{
+					"error": "Page has no text",
+				})
+			}
+			pages = selected
+		}
+
+		if c.Query("format") == "text" {
+			texts := make([]string, 0, len(pages))
+			for _, p := range pages {
+				texts = append(texts, p.Text)
+			}
+			c.Set("Content-Type", "text/plain; charset=utf-8")
+			return c.SendString(strings.Join(texts, "\n\n"))
+		}
+
+		return c.JSON(fiber.Map{
+			"document_id": c.Params("id"),
+			"items":       pages,
+			"count":       len(pages),
+		})
+	})
+
+	// What happened to a document as it was ingested, oldest first, so its
+	// owner can see why it isn't answering questions
+	app.Get("/documents/:id/events", func(c *fiber.Ctx) error {
+		events, err := ragService.DocumentEvents(c.UserContext(), c.Params("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Document not found",
+			})
+		}
+		if errors.Is(err, adapters.ErrCollectionForbidden) {
+			return respondCollectionError(c, err)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get document events",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"document_id": c.Params("id"),
+			"items":       events,
+			"count":       len(events),
+		})
+	})
+
+	// A chunk with its neighbors and page text, to read around a citation
+	// without downloading the PDF; around (default 2, at most 10) is how
+	// many chunks to include on each side
+	app.Get("/chunks/:id/context", func(c *fiber.Ctx) error {
+		chunkID, err := url.PathUnescape(c.Params("id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid chunk id",
+			})
+		}
+
+		neighborhood, err := ragService.ChunkContext(c.UserContext(), chunkID, c.QueryInt("around", 2))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Chunk not found",
+			})
+		}
+		if errors.Is(err, adapters.ErrCollectionForbidden) {
+			return respondCollectionError(c, err)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get chunk context",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(neighborhood)
+	})
+
+	// First-page thumbnail for the library view
+	app.Get("/documents/:id/thumbnail", func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		doc, err := ragService.DatabaseSchema.GetDocument(c.Params("id"))
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Thumbnail not available",
+			})
+		}
+		collection := adapters.DocumentCollection(doc.Metadata)
+		if err := ragService.CheckCollectionAccess(ctx, collection, adapters.PermissionRead); err != nil {
+			return respondCollectionError(c, err)
+		}
+
+		thumbnail, err := ragService.GetThumbnail(ctx, doc.ID)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Thumbnail not available",
+			})
+		}
+
+		c.Set("Content-Type", "image/png")
+		if collection != "" {
+			// Shared caches mustn't serve a collection's thumbnails to others
+			c.Set("Cache-Control", "private, max-age=86400")
+		} else {
+			c.Set("Cache-Control", "public, max-age=86400")
+		}
+		return c.Send(thumbnail)
+	})
+
+	app.Delete("/documents/:id", func(c *fiber.Ctx) error {
+		documentID := c.Params("id")
+
+		err := ragService.DeleteDocument(c.UserContext(), documentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Document not found",
+			})
+		}
+		if errors.Is(err, adapters.ErrCollectionForbidden) {
+			return respondCollectionError(c, err)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to delete document",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Document deleted successfully",
+		})
+	})
+
+	// Collections: team knowledge bases whose documents only members can
+	// see. Documents join one through the upload form's collection field or
+	// PATCH /documents.
+	app.Post("/collections", func(c *fiber.Ctx) error {
+		var request struct {
+			Name         string `json:"name"`
+			Description  string `json:"description"`
+			CitationMode string `json:"citation_mode"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		collection, err := ragService.CreateCollection(c.UserContext(), request.Name, request.Description, request.CitationMode)
+		if errors.Is(err, adapters.ErrCollectionExists) {
+			return c.Status(409).JSON(fiber.Map{
+				"error": "Collection already exists",
+			})
+		}
+		if errors.Is(err, adapters.ErrCollectionInUse) {
+			return c.Status(409).JSON(fiber.Map{
+				"error":   "Documents already use this collection name; ask an admin to register it",
+				"details": err.Error(),
+			})
+		}
+		if errors.Is(err, adapters.ErrCollectionAnonymous) {
+			return c.Status(401).JSON(fiber.Map{
+				"error":   "Sign in or use an issued API token to create collections",
+				"details": err.Error(),
+			})
+		}
+		if err != nil {
+			return respondCollectionError(c, err)
+		}
+
+		return c.Status(201).JSON(collection)
+	})
+
+	app.Get("/collections", func(c *fiber.Ctx) error {
+		collections, err := ragService.ListCollections(c.UserContext())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get collections",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"items":     collections,
+			"count":     len(collections),
+			"member_id": adapters.CollectionAccessFromContext(c.UserContext()).Member(),
+		})
+	})
+
+	// Change a collection's settings; citation_mode (off, reject or
+	// regenerate, "" to follow CITATION_MODE) sets how strictly answers
+	// drawn from its documents must cite them
+	app.Patch("/collections/:name", func(c *fiber.Ctx) error {
+		var request struct {
+			CitationMode *string `json:"citation_mode"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+		if request.CitationMode == nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "citation_mode is required",
+			})
+		}
+
+		collection, err := ragService.SetCollectionCitationMode(c.UserContext(), pathParam(c, "name"), strings.TrimSpace(*request.CitationMode))
+		if err != nil {
+			return respondCollectionError(c, err)
+		}
+
+		return c.JSON(collection)
+	})
+
+	app.Delete("/collections/:name", func(c *fiber.Ctx) error {
+		err := ragService.DeleteCollection(c.UserContext(), pathParam(c, "name"))
+		if errors.Is(err, adapters.ErrCollectionNotEmpty) {
+			return c.Status(409).JSON(fiber.Map{
+				"error":   "Collection still has documents",
+				"details": err.Error(),
+			})
+		}
+		if err != nil {
+			return respondCollectionError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Collection deleted",
+		})
+	})
+
+	app.Get("/collections/:name/members", func(c *fiber.Ctx) error {
+		members, err := ragService.CollectionMembers(c.UserContext(), pathParam(c, "name"))
+		if err != nil {
+			return respondCollectionError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"items": members,
+			"count": len(members),
+		})
+	})
+
+	// Grant or change a member's permission: {"permission": "read"|"write"}.
+	// Member IDs are the member_id GET /collections reports to each caller:
+	// user:<subject> for SSO users, token:<id> for issued API tokens.
+	app.Put("/collections/:name/members/:memberId", func(c *fiber.Ctx) error {
+		var request struct {
+			Permission string `json:"permission"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		err := ragService.SetCollectionMember(c.UserContext(), pathParam(c, "name"), pathParam(c, "memberId"), request.Permission)
+		if err != nil {
+			return respondCollectionError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"message":    "Member updated",
+			"member_id":  pathParam(c, "memberId"),
+			"permission": request.Permission,
+		})
+	})
+
+	app.Delete("/collections/:name/members/:memberId", func(c *fiber.Ctx) error {
+		err := ragService.RemoveCollectionMember(c.UserContext(), pathParam(c, "name"), pathParam(c, "memberId"))
+		if err != nil {
+			return respondCollectionError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Member removed",
+		})
+	})
+
+	// Document search endpoint - find which sources contain specific topics
+	app.Post("/search-sources", func(c *fiber.Ctx) error {
+		var request struct {
+			Query string `json:"query"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		if request.Query == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Query is required",
+			})
+		}
+
+		// Get all documents the caller can read
+		documents, err := ragService.DatabaseSchema.GetAllDocuments()
+		if err == nil {
+			documents, err = ragService.ReadableDocuments(c.UserContext(), documents)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get documents",
+				"details": err.Error(),
+			})
+		}
+
+		// Search through all documents for the query
+		var relevantSources []map[string]interface{}
+		queryWords := strings.Fields(strings.ToLower(request.Query))
+
+		for _, doc := range documents {
+			if doc.Status != "completed" {
+				continue
+			}
+
+			// Get chunks from this document
+			chunks, err := ragService.DatabaseSchema.GetChunksByDocument(doc.ID, 100, 0)
+			if err != nil {
+				continue
+			}
+
+			// Check if any chunk contains the query
+			var relevantChunks []string
+			maxScore := 0.0
+
+			for _, chunk := range chunks {
+				score := ragService.ScoreChunk(c.UserContext(), queryWords, chunk)
+				if score > 0.1 { // Only include chunks with some relevance
+					relevantChunks = append(relevantChunks, chunk.ChunkText)
+					if score > maxScore {
+						maxScore = score
+					}
+				}
+			}
+
+			// If we found relevant chunks, add this document to results
+			if len(relevantChunks) > 0 {
+				// Get a snippet from the most relevant chunk
+				snippet := ""
+				if len(relevantChunks) > 0 {
+					snippet = adapters.TruncateRunes(relevantChunks[0], 200)
+				}
+
+				relevantSources = append(relevantSources, map[string]interface{}{
+					"document_id":     doc.ID,
+					"filename":        doc.OriginalFilename,
+					"download_url":    ragService.Links.DownloadURL(doc.ID, doc.OriginalFilename),
+					"relevance_score": maxScore,
+					"chunk_count":     len(relevantChunks),
+					"snippet":         snippet,
+					"direction":       adapters.TextDirection(snippet),
+					"uploaded_at":     doc.CreatedAt,
+				})
+			}
+		}
+
+		// Sort by relevance score (highest first)
+		sort.Slice(relevantSources, func(i, j int) bool {
+			return relevantSources[i]["relevance_score"].(float64) > relevantSources[j]["relevance_score"].(float64)
+		})
+
+		return c.JSON(fiber.Map{
+			"query":   request.Query,
+			"sources": relevantSources,
+			"count":   len(relevantSources),
+		})
+	})
+
+	// Search chunks, stored answers and chat messages together, to find
+	// where a topic was read or asked about; type (chunk, answer or message,
+	// comma-separated) narrows the results and limit (default 20, at most
+	// 100) caps them. Each result links to where it can be opened.
+	app.Get("/search", func(c *fiber.Ctx) error {
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "q is required",
+			})
+		}
+
+		var types []string
+		for _, t := range strings.Split(c.Query("type"), ",") {
+			switch t = strings.TrimSpace(t); t {
+			case "":
+			case adapters.SearchResultChunk, adapters.SearchResultAnswer, adapters.SearchResultMessage:
+				types = append(types, t)
+			default:
+				return c.Status(400).JSON(fiber.Map{
+					"error": fmt.Sprintf("unknown type %q: use chunk, answer or message", t),
+				})
+			}
+		}
+
+		results, err := ragService.Search(c.UserContext(), query, types, c.QueryInt("limit", 20))
+		if errors.Is(err, adapters.ErrCollectionForbidden) {
+			return respondCollectionError(c, err)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Search failed",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"query":   query,
+			"results": results,
+			"count":   len(results),
+		})
+	})
+
+	// RAG chat endpoint with session support
+	app.Post("/sessions/:id/chat", requireQuota(ragService.Quotas, adapters.UsageQueries), func(c *fiber.Ctx) error {
+		sessionID := c.Params("id")
+
+		var request struct {
+			Message      string `json:"message"`
+			Debug        bool   `json:"debug"`
+			CrossLingual bool   `json:"cross_lingual"`
+			// Translate answers into the session language (or TranslateTo)
+			Translate    bool   `json:"translate"`
+			TranslateTo  string `json:"translate_to"`
+			MaxLatencyMs int64  `json:"max_latency_ms"`
+			// Regenerate answers a repeated question afresh instead of
+			// reusing the session's earlier answer
+			Regenerate bool `json:"regenerate"`
+			// AnswerLanguage overrides APP_LANGUAGE for this message
+			AnswerLanguage string `json:"answer_language"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		if request.Message == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Message is required",
+			})
+		}
+
+		if request.MaxLatencyMs < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "max_latency_ms must not be negative",
+			})
+		}
+
+		if request.AnswerLanguage != "" && !adapters.ValidAnswerLanguage(request.AnswerLanguage) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "answer_language must be empty, \"en\" or \"fa\"",
+			})
+		}
+
+		// Process RAG query
+		ctx := c.UserContext()
+		var trace *adapters.DebugTrace
+		if request.Debug || c.QueryBool("debug") {
+			trace = adapters.NewDebugTrace()
+			ctx = adapters.WithDebugTrace(ctx, trace)
+		}
+		// A regenerated answer must be generated afresh
+		if request.Regenerate {
+			ctx = adapters.WithoutGenerationCache(ctx)
+		}
+
+		translateTo := request.TranslateTo
+		if translateTo == "" && request.Translate {
+			if session, err := ragService.DatabaseSchema.GetChatSession(sessionID); err == nil {
+				translateTo = session.Language
+			}
+		}
+
+		opts := adapters.QueryOptions{
+			CrossLingual:   request.CrossLingual,
+			TranslateTo:    translateTo,
+			MaxLatency:     time.Duration(request.MaxLatencyMs) * time.Millisecond,
+			AnswerLanguage: request.AnswerLanguage,
+		}
+
+		// Repeated questions reuse the session's earlier answer, looked up
+		// before this question joins the history; debug runs never do
+		var response *adapters.SimpleRAGResponse
+		lookupStart := time.Now()
+		if trace == nil && !request.Regenerate {
+			response = ragService.CachedAnswer(sessionID, request.Message, opts)
+			if response == nil {
+				response = ragService.EarlierAnswer(sessionID, request.Message, opts)
+			}
+		}
+		if response != nil {
+			// Reused answers took no retrieval or generation this time
+			timings := &adapters.Timings{}
+			timings.Finish(lookupStart)
+			response.Timings = timings
+		}
+
+		// Store user message
+		if _, err := ragService.DatabaseSchema.AddChatMessage(sessionID, "user", request.Message, nil, 0, "", adapters.StoredContext{}); err != nil {
+			log.Printf("Warning: failed to store user message: %v", err)
+		}
+
+		fresh := response == nil
+		if fresh {
+			var err error
+			response, err = ragService.Query(ctx, request.Message, opts)
+			if errors.Is(err, adapters.ErrLLMSaturated) {
+				return respondLLMSaturated(c)
+			}
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to process query",
+					"details": err.Error(),
+				})
+			}
+		}
+
+		// Store assistant response
+		messageID, err := ragService.DatabaseSchema.AddChatMessage(sessionID, "assistant", response.Answer, response.Sources, response.Confidence, response.CorpusVersion, ragService.StoreContext(response))
+		if err != nil {
+			log.Printf("Warning: failed to store assistant message: %v", err)
+		}
+		response.MessageID = messageID
+		if fresh {
+			ragService.SessionAnswers.Store(sessionID, request.Message, opts, response)
+		}
+
+		if trace != nil {
+			trace.Finish()
+			response.Debug = trace
+		}
+
+		return c.JSON(ragResponse(c, response, ragService.Links))
+	})
+
+	// Stateless chat: the caller sends the conversation so far with each
+	// message and keeps it themselves; no session or message rows are
+	// written
+	app.Post("/chat/rag", requireQuota(ragService.Quotas, adapters.UsageQueries), func(c *fiber.Ctx) error {
+		var request struct {
+			Message      string                           `json:"message"`
+			History      []adapters.ChatCompletionMessage `json:"history"`
+			Debug        bool                             `json:"debug"`
+			CrossLingual bool                             `json:"cross_lingual"`
+			TranslateTo  string                           `json:"translate_to"`
+			MaxLatencyMs int64                            `json:"max_latency_ms"`
+			// AnswerLanguage overrides APP_LANGUAGE for this message
+			AnswerLanguage string `json:"answer_language"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		if strings.TrimSpace(request.Message) == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Message is required",
+			})
+		}
+
+		if request.MaxLatencyMs < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "max_latency_ms must not be negative",
+			})
+		}
+
+		if request.AnswerLanguage != "" && !adapters.ValidAnswerLanguage(request.AnswerLanguage) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "answer_language must be empty, \"en\" or \"fa\"",
+			})
+		}
+
+		ctx := c.UserContext()
+		var trace *adapters.DebugTrace
+		if request.Debug || c.QueryBool("debug") {
+			trace = adapters.NewDebugTrace()
+			ctx = adapters.WithDebugTrace(ctx, trace)
+		}
+
+		opts := adapters.QueryOptions{
+			CrossLingual:   request.CrossLingual,
+			TranslateTo:    request.TranslateTo,
+			MaxLatency:     time.Duration(request.MaxLatencyMs) * time.Millisecond,
+			AnswerLanguage: request.AnswerLanguage,
+		}
+
+		response, err := ragService.ChatRAG(ctx, request.History, strings.TrimSpace(request.Message), opts)
+		if errors.Is(err, adapters.ErrInvalidChatHistory) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, adapters.ErrLLMSaturated) {
+			return respondLLMSaturated(c)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to process query",
+				"details": err.Error(),
+			})
+		}
+
+		if trace != nil {
+			trace.Finish()
+			response.Debug = trace
+		}
+
+		return c.JSON(ragResponse(c, response, ragService.Links))
+	})
+
+	// Flush all data endpoint
+	app.Delete("/flush", func(c *fiber.Ctx) error {
+		// Clear all chat sessions and messages
+		err := ragService.DatabaseSchema.FlushAllData()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to flush data",
+				"details": err.Error(),
+			})
+		}
+
+		ragService.SessionAnswers.Clear()
+
+		// Clear all files from MinIO
+		err = ragService.MinIOAdapter.FlushAllFiles(c.UserContext())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to flush files from MinIO",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "All data has been successfully cleared",
+		})
+	})
+
+	// Admin endpoints
+	admin := app.Group("/admin", requireAdmin(cfg.AdminToken, sso != nil))
+
+	auditFilter := func(c *fiber.Ctx, defaultLimit int) adapters.AuditFilter {
+		return adapters.AuditFilter{
+			Actor:  c.Query("actor"),
+			Action: c.Query("action"),
+			Search: c.Query("q"),
+			From:   c.Query("from"),
+			To:     c.Query("to"),
+			Limit:  c.QueryInt("limit", defaultLimit),
+			Offset: c.QueryInt("offset", 0),
+		}
+	}
+
+	// Search the audit log by actor, action, text and time range
+	admin.Get("/audit", func(c *fiber.Ctx) error {
+		entries, total, err := ragService.DatabaseSchema.SearchAuditLog(auditFilter(c, 100))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to search audit log",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"entries": entries,
+			"count":   len(entries),
+			"total":   total,
+		})
+	})
+
+	// Export matching audit entries as CSV
+	admin.Get("/audit/export", func(c *fiber.Ctx) error {
+		entries, _, err := ragService.DatabaseSchema.SearchAuditLog(auditFilter(c, 100000))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to export audit log",
+				"details": err.Error(),
+			})
+		}
+
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"audit_%s.csv\"", time.Now().Format("20060102_150405")))
+		return adapters.WriteAuditCSV(c, entries)
+	})
+
+	// Recompute chunk and word counts; ?repair=true fixes drift and records
+	// each fix in the audit log
+	admin.Post("/consistency", func(c *fiber.Ctx) error {
+		report, err := ragService.CheckConsistency(c.QueryBool("repair"))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to check consistency",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(report)
+	})
+
+	// Corpus health: documents with few chunks (fewer than ?low_chunks,
+	// default 3), likely needing OCR, never cited in an answer, and
+	// uploaded more than once
+	admin.Get("/corpus-report", func(c *fiber.Ctx) error {
+		report, err := ragService.CorpusReport(c.QueryInt("low_chunks", 0))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to build corpus report",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(report)
+	})
+
+	// Completed documents no answer has drawn on, optionally with those
+	// unused for unused_days, and the storage they hold
+	admin.Get("/cold-documents", func(c *fiber.Ctx) error {
+		report, err := ragService.ColdDocuments(c.QueryInt("unused_days", 0))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to build cold documents report",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(report)
+	})
+
+	// Self-diagnosis: checks migrations, indexes, buckets, the LLM model and
+	// disk space, with a suggested fix for each problem found
+	diagnostics := &adapters.Diagnostics{RAG: ragService, Ollama: ollamaAdapter, Gemini: googleAdapter}
+	admin.Get("/diagnose", func(c *fiber.Ctx) error {
+		return c.JSON(diagnostics.Run(c.UserContext()))
+	})
+
+	// Recent requests slower than their route's threshold, newest first
+	admin.Get("/slow-requests", func(c *fiber.Ctx) error {
+		requests := slowRequests.List()
+		return c.JSON(fiber.Map{
+			"items": requests,
+			"count": len(requests),
+		})
+	})
+
+	// How the shadow retrieval pipeline compares with the live one
+	admin.Get("/shadow", func(c *fiber.Ctx) error {
+		return c.JSON(ragService.Shadow.Status())
+	})
+
+	// Effective settings, with secrets redacted
+	admin.Get("/config", func(c *fiber.Ctx) error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		return c.JSON(cfg.Redacted())
+	})
+
+	// Settings page: provider and model, language, retrieval parameters,
+	// feature flags and storage
+	admin.Get("/settings", func(c *fiber.Ctx) error {
+		settings, err := ragService.Settings(c.UserContext())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to load settings",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(settings)
+	})
+
+	// Change the language, retrieval parameters and feature flags. Changes
+	// are kept in the database, so they survive restarts and reloads.
+	admin.Patch("/settings", func(c *fiber.Ctx) error {
+		var request adapters.SettingsUpdate
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+		}
+
+		if err := ragService.UpdateSettings(request); err != nil {
+			status := 500
+			if errors.Is(err, adapters.ErrInvalidSetting) {
+				status = 400
+			}
+			return c.Status(status).JSON(fiber.Map{
+				"error":   "Failed to update settings",
+				"details": err.Error(),
+			})
+		}
+		if _, _, err := reloadConfig(cfg, ragService); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to read the configuration",
+				"details": err.Error(),
+			})
+		}
+
+		settings, err := ragService.Settings(c.UserContext())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to load settings",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(settings)
+	})
+
+	// Re-read CONFIG_FILE and the environment, applying tunables now and
+	// listing changed settings that need a restart
+	admin.Post("/config/reload", func(c *fiber.Ctx) error {
+		applied, restartRequired, err := reloadConfig(cfg, ragService)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to read the configuration",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"applied":          applied,
+			"restart_required": restartRequired,
+		})
+	})
+
+	// Run a storage tiering pass now instead of waiting for the interval
+	admin.Post("/tiering", func(c *fiber.Ctx) error {
+		result, err := ragService.RunTiering(c.UserContext())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to run storage tiering",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(result)
+	})
+
+	// How many chunks lack a vector from the current embedder, and so rank
+	// lexically only
+	admin.Get("/embeddings", func(c *fiber.Ctx) error {
+		missing, err := ragService.MissingEmbeddings()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to count chunks without vectors",
+				"details": err.Error(),
+			})
+		}
+
+		embedder, dimensions := "", 0
+		if ragService.Embedder != nil {
+			embedder, dimensions = ragService.Embedder.Name(), ragService.Embedder.Dimensions()
+		}
+		return c.JSON(fiber.Map{
+			"embedder":   embedder,
+			"dimensions": dimensions,
+			"missing":    missing,
+		})
+	})
+
+	// Embed up to ?limit (default 1000) chunks lacking a vector from the
+	// current embedder, as after switching embedders; call again while
+	// "remaining" is above 0
+	admin.Post("/embeddings/backfill", func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 1000)
+		if limit <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "limit must be positive",
+			})
+		}
+
+		result, err := ragService.BackfillEmbeddings(c.UserContext(), limit)
+		if errors.Is(err, adapters.ErrNoEmbedder) {
+			return c.Status(409).JSON(fiber.Map{
+				"error":   "No embedder is configured, set EMBEDDER_PROVIDER",
+				"details": ragService.VectorHealth.SetupError(),
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":    "Failed to backfill embeddings",
+				"details":  err.Error(),
+				"progress": result,
+			})
+		}
+
+		return c.JSON(result)
+	})
+
+	// Compress contexts stored in full, by answers from before
+	// CONTEXT_STORAGE or while it was "full"
+	admin.Post("/contexts/compress", func(c *fiber.Ctx) error {
+		compressed, err := ragService.CompressStoredContexts()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to compress stored contexts",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{"compressed": compressed})
+	})
+
+	// Send digests now instead of waiting for DIGEST_INTERVAL
+	admin.Post("/digests", func(c *fiber.Ctx) error {
+		if ragService.Notifications.Digests == nil {
+			return c.Status(409).JSON(fiber.Map{
+				"error": "Digests are not enabled, set DIGEST_INTERVAL and SMTP_HOST",
+			})
+		}
+
+		sent, err := ragService.Notifications.Digests.Send(c.UserContext())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to send digests",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"sent": sent,
+		})
+	})
+
+	// List feature flags with their effective values and sources
+	admin.Get("/flags", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"flags": ragService.Flags.List(),
+		})
+	})
+
+	// Override a feature flag for this deployment
+	admin.Put("/flags/:name", func(c *fiber.Ctx) error {
+		var request struct {
+			Enabled *bool `json:"enabled"`
+		}
+
+		if err := c.BodyParser(&request); err != nil || request.Enabled == nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "enabled is required",
+			})
+		}
+
+		name := c.Params("name")
+		if !ragService.Flags.Known(name) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Feature flag not found",
+			})
+		}
+
+		if err := ragService.Flags.Set(name, *request.Enabled); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to update feature flag",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"flags": ragService.Flags.List(),
+		})
+	})
+
+	// Remove an override so FEATURE_FLAGS or the default applies again
+	admin.Delete("/flags/:name", func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if !ragService.Flags.Known(name) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Feature flag not found",
+			})
+		}
+
+		if err := ragService.Flags.Reset(name); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to reset feature flag",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"flags": ragService.Flags.List(),
+		})
+	})
+
+	// Snapshot the corpus (document list and content hashes) for later diffing
+	admin.Post("/snapshots", func(c *fiber.Ctx) error {
+		var request struct {
+			Label string `json:"label"`
+		}
+
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&request); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Invalid request body",
+				})
+			}
+		}
+
+		snapshot, err := ragService.CreateSnapshot(request.Label)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to create snapshot",
+				"details": err.Error(),
+			})
+		}
+
+		return c.Status(201).JSON(snapshot)
+	})
+
+	admin.Get("/snapshots", func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 20)
+		offset := c.QueryInt("offset", 0)
+
+		snapshots, err := ragService.DatabaseSchema.GetSnapshots(limit, offset)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get snapshots",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"snapshots": snapshots,
+			"count":     len(snapshots),
+		})
+	})
+
+	admin.Get("/snapshots/:id", func(c *fiber.Ctx) error {
+		snapshot, err := ragService.GetSnapshot(c.Params("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Snapshot not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get snapshot",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(snapshot)
+	})
+
+	// Diff a snapshot against the current corpus, or another snapshot with ?against=
+	admin.Get("/snapshots/:id/diff", func(c *fiber.Ctx) error {
+		diff, err := ragService.DiffSnapshot(c.Params("id"), c.Query("against"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Snapshot not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to diff snapshot",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(diff)
+	})
+
+	// Export usage per API key as JSON or ?format=csv, for one ?period=YYYY-MM
+	// (default: all) and optionally one ?key=
+	admin.Get("/usage", func(c *fiber.Ctx) error {
+		records, err := ragService.DatabaseSchema.ListUsage(c.Query("period"), c.Query("key"))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to export usage",
+				"details": err.Error(),
+			})
+		}
+
+		if c.Query("format") == "csv" {
+			c.Set("Content-Type", "text/csv; charset=utf-8")
+			c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"usage_%s.csv\"", time.Now().Format("20060102_150405")))
+			return adapters.WriteUsageCSV(c, records)
+		}
+
+		return c.JSON(fiber.Map{
+			"usage": records,
+			"count": len(records),
+		})
+	})
+
+	// List per-key quota overrides and the default quota
+	admin.Get("/quotas", func(c *fiber.Ctx) error {
+		quotas, err := ragService.DatabaseSchema.GetQuotas()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get quotas",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"default": ragService.Quotas.Default(),
+			"quotas":  quotas,
+			"count":   len(quotas),
+		})
+	})
+
+	// Set a key's monthly quota; keyId is the key's actor id as shown in the
+	// audit log and usage export
+	admin.Put("/quotas/:keyId", func(c *fiber.Ctx) error {
+		var quota adapters.Quota
+		if err := c.BodyParser(&quota); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+		if quota.Queries < 0 || quota.Tokens < 0 || quota.UploadBytes < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Quotas must not be negative",
+			})
+		}
+
+		keyID := c.Params("keyId")
+		if err := ragService.DatabaseSchema.SetQuota(keyID, quota); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to update quota",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"key_id": keyID,
+			"quota":  quota,
+		})
+	})
+
+	// Remove a key's override so the default quota applies again
+	admin.Delete("/quotas/:keyId", func(c *fiber.Ctx) error {
+		err := ragService.DatabaseSchema.DeleteQuota(c.Params("keyId"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Quota not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to delete quota",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "Quota removed",
+		})
+	})
+
+	// List moderation incidents, optionally only one ?stage=question|answer
+	admin.Get("/moderation/incidents", func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 50)
+		offset := c.QueryInt("offset", 0)
+
+		incidents, err := ragService.DatabaseSchema.GetModerationIncidents(c.Query("stage"), limit, offset)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get moderation incidents",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"incidents": incidents,
+			"count":     len(incidents),
+		})
+	})
+
+	// List embedded chat widgets
+	admin.Get("/widgets", func(c *fiber.Ctx) error {
+		widgets, err := ragService.DatabaseSchema.GetWidgets()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get widgets",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"widgets": widgets,
+			"count":   len(widgets),
+		})
+	})
+
+	// Create a widget; the response carries its token, which is not shown again
+	admin.Post("/widgets", func(c *fiber.Ctx) error {
+		var request struct {
+			Name           string   `json:"name"`
+			AllowedOrigins []string `json:"allowed_origins"`
+			RateLimit      int      `json:"rate_limit"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		widget, token, err := ragService.Widgets.Create(request.Name, request.AllowedOrigins, request.RateLimit)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Failed to create widget",
+				"details": err.Error(),
+			})
+		}
+
+		return c.Status(201).JSON(fiber.Map{
+			"widget": widget,
+			"token":  token,
+		})
+	})
+
+	admin.Delete("/widgets/:id", func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		err := ragService.DatabaseSchema.DeleteWidget(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Widget not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to delete widget",
+				"details": err.Error(),
+			})
+		}
+		ragService.Widgets.Forget(id)
+
+		return c.JSON(fiber.Map{
+			"message": "Widget deleted",
+		})
+	})
+
+	admin.Get("/api-tokens", func(c *fiber.Ctx) error {
+		tokens, err := ragService.DatabaseSchema.GetAPITokens()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to get API tokens",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"tokens": tokens,
+			"count":  len(tokens),
+		})
+	})
+
+	// Create an API token limited to scopes (upload, query, read, delete)
+	// and optionally collections; the response carries its secret, which is
+	// not shown again
+	admin.Post("/api-tokens", func(c *fiber.Ctx) error {
+		var request struct {
+			Name        string   `json:"name"`
+			Scopes      []string `json:"scopes"`
+			Collections []string `json:"collections"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		token, secret, err := ragService.APITokens.Create(request.Name, request.Scopes, request.Collections)
+		if errors.Is(err, adapters.ErrInvalidAPIToken) {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Failed to create API token",
+				"details": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to create API token",
+				"details": err.Error(),
+			})
+		}
+
+		return c.Status(201).JSON(fiber.Map{
+			"api_token": token,
+			"token":     secret,
+		})
+	})
+
+	admin.Delete("/api-tokens/:id", func(c *fiber.Ctx) error {
+		err := ragService.DatabaseSchema.DeleteAPIToken(c.Params("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "API token not found",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to revoke API token",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": "API token revoked",
+		})
+	})
+
+	// Embedded widget API: questions and citations only, authenticated with
+	// a widget token from an allowed origin
+	widget := app.Group("/widget", requireWidget(ragService.Widgets))
+
+	widget.Post("/query", requireQuota(ragService.Quotas, adapters.UsageQueries), func(c *fiber.Ctx) error {
+		var request struct {
+			Question string `json:"question"`
+		}
+
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		if strings.TrimSpace(request.Question) == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Question is required",
+			})
+		}
+
+		response, err := ragService.Query(c.UserContext(), request.Question, adapters.QueryOptions{})
+		if errors.Is(err, adapters.ErrLLMSaturated) {
+			return respondLLMSaturated(c)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to process query",
+			})
+		}
+
+		var sources interface{} = response.Sources
+		if apiVersion(c) >= 1 {
+			sources = response.Structured(ragService.Links).Sources
+		}
+		return c.JSON(fiber.Map{
+			"answer":     response.Answer,
+			"sources":    sources,
+			"confidence": response.Confidence,
+		})
+	})
+
+	// Issue a signed, expiring download link to a signed-in user, a scoped
+	// API token or an admin; ?redirect=true sends the client straight to it.
+	// Anyone else gets links only with the answers citing a document. Each
+	// link is recorded in the audit log.
+	linkSigner := ragService.Links
+	app.Get("/files/:documentId/:filename/link", func(c *fiber.Ctx) error {
+		if !requestVerified(c, cfg.AdminToken) {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Sign in or an API token is required to request download links",
+			})
+		}
+		documentID := pathParam(c, "documentId")
+		filename := pathParam(c, "filename")
+
+		doc, err := ragService.DatabaseSchema.GetDocument(documentID)
+		if err != nil || doc.OriginalFilename != filename {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "File not found",
+			})
+		}
+		if err := ragService.CheckCollectionAccess(c.UserContext(), adapters.DocumentCollection(doc.Metadata), adapters.PermissionRead); err != nil {
+			return respondCollectionError(c, err)
+		}
+
+		expires, signature := linkSigner.Sign(documentID + "/" + filename)
+		link := fmt.Sprintf("/files/%s/%s?expires=%d&sig=%s", url.PathEscape(documentID), url.PathEscape(filename), expires.Unix(), signature)
+
+		if c.QueryBool("redirect") {
+			return c.Redirect(link, fiber.StatusFound)
+		}
+		return c.JSON(fiber.Map{
+			"url":        link,
+			"expires_at": expires.UTC().Format(time.RFC3339),
+		})
+	})
+
+	// File download endpoint; requires a signed link, as cited sources carry
+	// or /files/:documentId/:filename/link issues
+	app.Get("/files/:documentId/:filename", func(c *fiber.Ctx) error {
+		documentID := pathParam(c, "documentId")
+		filename := pathParam(c, "filename")
+
+		err := linkSigner.Verify(documentID+"/"+filename, c.Query("expires"), c.Query("sig"))
+		if err != nil {
+			return c.Status(403).JSON(fiber.Map{
+				"error":   "A valid download link is required",
+				"details": err.Error(),
+			})
+		}
+
+		doc, err := ragService.DatabaseSchema.GetDocument(documentID)
+		if err != nil || doc.OriginalFilename != filename {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "File not found",
+			})
+		}
+		if err := ragService.CheckCollectionAccess(c.UserContext(), adapters.DocumentCollection(doc.Metadata), adapters.PermissionRead); err != nil {
+			return respondCollectionError(c, err)
+		}
+
+		// Get file from MinIO, restoring it from the archive tier if needed
+		fileData, err := ragService.GetOriginal(c.UserContext(), documentID, filename)
+		if errors.Is(err, adapters.ErrOriginalDeleted) {
+			return c.Status(410).JSON(fiber.Map{
+				"error":   "Original file is no longer stored",
+				"details": err.Error(),
+			})
+		}
+		if errors.Is(err, adapters.ErrIntegrity) {
+			log.Printf("Warning: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "File failed integrity check",
+				"details": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "File not found",
+			})
+		}
+
+		c.Set("Content-Type", "application/pdf")
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+		return c.Send(fileData)
+	})
+
+	// Reload tunables on SIGHUP, like POST /admin/config/reload
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(cfg, ragService)
+		}
+	}()
+
+	// Graceful shutdown
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-c
+		log.Println("Gracefully shutting down...")
+		stopBackground()
+		ragService.SaveVectorIndex()
+		ragService.Access.Flush()
+		app.Shutdown()
+	}()
+
+	// Start server
 	log.Printf("Starting server on port %s...", cfg.Port)
 	log.Fatal(app.Listen(":" + cfg.Port))
 }
+
+// respondLLMSaturated tells the client the LLM queue is full and to retry later
+func respondLLMSaturated(c *fiber.Ctx) error {
+	c.Set("Retry-After", "5")
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"error":   "LLM is busy, please retry shortly",
+		"details": adapters.ErrLLMSaturated.Error(),
+	})
+}
+
+// reloadMu keeps concurrent reloads from interleaving
+var reloadMu sync.Mutex
+
+// reloadConfig applies the reloadable settings from a fresh read of the
+// configuration to cfg and the service, and logs what changed
+func reloadConfig(cfg *config.Config, ragService *adapters.SimpleRAGService) (applied, restartRequired []string, err error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, err := config.Read()
+	if err != nil {
+		log.Printf("Warning: config reload failed: %v", err)
+		return nil, nil, err
+	}
+
+	applied, restartRequired = cfg.Apply(next)
+	ragService.Reconfigure()
+
+	log.Printf("✅ Reloaded config, applied: %v", applied)
+	if len(restartRequired) > 0 {
+		log.Printf("Warning: changed settings need a restart: %v", restartRequired)
+	}
+	if applied == nil {
+		applied = []string{}
+	}
+	if restartRequired == nil {
+		restartRequired = []string{}
+	}
+	return applied, restartRequired, nil
+}
+
+// apiV1Prefix serves every route under /api/v1 as well, with the v1
+// response shapes: structured sources and error codes. Unversioned paths
+// keep the legacy shapes the bundled web UI and existing clients expect.
+const apiV1Prefix = "/api/v1"
+
+// versionedPaths strips apiV1Prefix so versioned requests reach the same
+// handlers, and adds error codes to their error responses. It must be the
+// first middleware: Fiber picks the routing tree from the path, and only
+// middleware registered before any route has the same position in every
+// tree.
+func versionedPaths() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		path := c.Path()
+		if path == apiV1Prefix || strings.HasPrefix(path, apiV1Prefix+"/") {
+			c.Locals("api_version", 1)
+			c.Path("/" + strings.TrimPrefix(strings.TrimPrefix(path, apiV1Prefix), "/"))
+		}
+
+		err := c.Next()
+		if version := apiVersion(c); version >= 1 {
+			c.Set("X-API-Version", strconv.Itoa(version))
+			if err == nil {
+				addErrorCode(c)
+			}
+		}
+		return err
+	}
+}
+
+// apiVersion is the response format for a request: the version in its
+// path, else the one asked for in X-API-Version, else 0 for the legacy
+// shapes
+func apiVersion(c *fiber.Ctx) int {
+	if version, ok := c.Locals("api_version").(int); ok {
+		return version
+	}
+	version, err := strconv.Atoi(c.Get("X-API-Version"))
+	if err != nil || version < 1 {
+		return 0
+	}
+	return 1
+}
+
+// ragResponse serializes a RAG response in the client's API version, with
+// v1 sources' download links signed by links
+func ragResponse(c *fiber.Ctx, response *adapters.SimpleRAGResponse, links *adapters.LinkSigner) interface{} {
+	if apiVersion(c) >= 1 {
+		return response.Structured(links)
+	}
+	return response
+}
+
+// errorCodes are the machine-readable codes v1 error responses carry next
+// to the human-readable error
+var errorCodes = map[int]string{
+	fiber.StatusBadRequest:            "invalid_request",
+	fiber.StatusUnauthorized:          "unauthorized",
+	fiber.StatusForbidden:             "forbidden",
+	fiber.StatusNotFound:              "not_found",
+	fiber.StatusConflict:              "conflict",
+	fiber.StatusGone:                  "gone",
+	fiber.StatusRequestEntityTooLarge: "payload_too_large",
+	fiber.StatusTooManyRequests:       "rate_limited",
+	fiber.StatusServiceUnavailable:    "unavailable",
+	fiber.StatusGatewayTimeout:        "timeout",
+}
+
+// addErrorCode adds a "code" to a JSON error response that lacks one.
+// OpenAI-shaped errors, whose "error" is an object, are left alone.
+func addErrorCode(c *fiber.Ctx) {
+	status := c.Response().StatusCode()
+	if status < 400 || !strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return
+	}
+
+	var body map[string]interface{}
+	if json.Unmarshal(c.Response().Body(), &body) != nil {
+		return
+	}
+	if _, ok := body["error"].(string); !ok {
+		return
+	}
+	if _, ok := body["code"]; ok {
+		return
+	}
+
+	code, ok := errorCodes[status]
+	if !ok {
+		code = "invalid_request"
+		if status >= 500 {
+			code = "internal_error"
+		}
+	}
+	body["code"] = code
+	if err := c.JSON(body); err != nil {
+		log.Printf("Warning: failed to add error code: %v", err)
+	}
+}
+
+// respondOpenAIError writes an error in the OpenAI API shape, which the /v1
+// clients expect instead of this API's usual error body
+func respondOpenAIError(c *fiber.Ctx, status int, message string) error {
+	errorType := "invalid_request_error"
+	if status >= 500 {
+		errorType = "server_error"
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": fiber.Map{
+			"message": message,
+			"type":    errorType,
+		},
+	})
+}
+
+// maxBulkDeleteDocuments caps how many documents one DELETE /documents call
+// removes; callers repeat it while documents remain
+const maxBulkDeleteDocuments = 1000
+
+// parseBefore reads a before filter, a date or an RFC 3339 time; empty
+// means no filter
+func parseBefore(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if before, err := time.ParseInLocation("2006-01-02", value, time.UTC); err == nil {
+		return before, nil
+	}
+	before, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid before %q: use a date (2024-01-01) or an RFC 3339 time", value)
+	}
+	return before, nil
+}
+
+// auditActions maps routes to the action recorded in the audit log; other
+// routes are not audited
+var auditActions = map[string]string{
+	"POST /upload":                                "upload",
+	"POST /ingest/stream":                         "ingest_stream_open",
+	"POST /ingest/stream/:id/close":               "upload",
+	"DELETE /ingest/stream/:id":                   "ingest_stream_abort",
+	"DELETE /documents/:id":                       "delete",
+	"DELETE /documents":                           "delete",
+	"PATCH /documents":                            "metadata_update",
+	"POST /library/delete":                        "delete",
+	"DELETE /flush":                               "flush",
+	"POST /query":                                 "query",
+	"POST /v1/chat/completions":                   "query",
+	"POST /chat":                                  "query",
+	"POST /chat/rag":                              "query",
+	"POST /sessions/:id/chat":                     "query",
+	"POST /search-sources":                        "search",
+	"POST /retrieve":                              "search",
+	"GET /search":                                 "search",
+	"POST /summarize":                             "summarize",
+	"POST /reports":                               "report",
+	"DELETE /sessions/:id":                        "delete_session",
+	"POST /sessions/:id/shares":                   "session_share",
+	"DELETE /sessions/:id/shares/:shareId":        "session_share_revoke",
+	"POST /collections":                           "collection_create",
+	"PATCH /collections/:name":                    "collection_update",
+	"DELETE /collections/:name":                   "collection_delete",
+	"PUT /collections/:name/members/:memberId":    "collection_member_update",
+	"DELETE /collections/:name/members/:memberId": "collection_member_remove",
+	"POST /saved-queries":                         "saved_query_create",
+	"DELETE /saved-queries/:id":                   "saved_query_delete",
+	"PUT /notifications/settings":                 "notification_settings",
+	"GET /files/:documentId/:filename":            "download",
+	"GET /files/:documentId/:filename/link":       "download_link",
+	"GET /admin/audit":                            "audit_search",
+	"GET /admin/audit/export":                     "audit_export",
+	"GET /queries/export":                         "query_export",
+	"GET /queries/dataset":                        "dataset_export",
+	"PUT /queries/:id/rating":                     "query_rating",
+	"POST /admin/consistency":                     "consistency_check",
+	"POST /admin/digests":                         "digest_send",
+	"POST /admin/tiering":                         "tiering_run",
+	"POST /admin/contexts/compress":               "contexts_compress",
+	"POST /admin/embeddings/backfill":             "embeddings_backfill",
+	"POST /admin/config/reload":                   "config_reload",
+	"PATCH /admin/settings":                       "settings_update",
+	"PUT /admin/flags/:name":                      "flag_update",
+	"DELETE /admin/flags/:name":                   "flag_reset",
+	"POST /admin/widgets":                         "widget_create",
+	"POST /admin/snapshots":                       "snapshot_create",
+	"GET /admin/snapshots/:id/diff":               "snapshot_diff",
+	"DELETE /admin/widgets/:id":                   "widget_delete",
+	"POST /admin/api-tokens":                      "api_token_create",
+	"DELETE /admin/api-tokens/:id":                "api_token_revoke",
+	"GET /admin/usage":                            "usage_export",
+	"PUT /admin/quotas/:keyId":                    "quota_update",
+	"DELETE /admin/quotas/:keyId":                 "quota_reset",
+	"GET /auth/callback":                          "login",
+	"POST /widget/query":                          "widget_query",
+}
+
+// Route classes, each with its own deadline and slow-request threshold
+const (
+	routeClassAPI        = "api"
+	routeClassGeneration = "generation"
+	routeClassBulk       = "bulk"
+)
+
+// routeClasses maps routes that need more than the API deadline to their
+// class; other routes are routeClassAPI
+var routeClasses = map[string]string{
+	"POST /query":                      routeClassGeneration,
+	"POST /chat":                       routeClassGeneration,
+	"POST /chat/rag":                   routeClassGeneration,
+	"POST /sessions/:id/chat":          routeClassGeneration,
+	"POST /v1/chat/completions":        routeClassGeneration,
+	"POST /widget/query":               routeClassGeneration,
+	"POST /translate":                  routeClassGeneration,
+	"POST /upload":                     routeClassBulk,
+	"POST /ingest/stream/:id":          routeClassBulk,
+	"POST /ingest/stream/:id/close":    routeClassBulk,
+	"POST /library/delete":             routeClassBulk,
+	"DELETE /documents":                routeClassBulk,
+	"DELETE /flush":                    routeClassBulk,
+	"GET /files/:documentId/:filename": routeClassBulk,
+	"GET /admin/audit/export":          routeClassBulk,
+	"GET /queries/export":              routeClassBulk,
+	"GET /queries/dataset":             routeClassBulk,
+	"GET /admin/diagnose":              routeClassBulk,
+	"GET /admin/corpus-report":         routeClassBulk,
+	"GET /admin/cold-documents":        routeClassBulk,
+	"POST /admin/consistency":          routeClassBulk,
+	"POST /admin/tiering":              routeClassBulk,
+	"POST /admin/contexts/compress":    routeClassBulk,
+	"POST /admin/embeddings/backfill":  routeClassBulk,
+	"POST /admin/digests":              routeClassBulk,
+	"POST /admin/snapshots":            routeClassBulk,
+}
+
+// scopeAny marks routes in routeScopes every scoped API token may call
+const scopeAny = "*"
+
+// routeScopes maps the routes scoped API tokens may call to the scope they
+// need; tokens are refused every other route
+var routeScopes = map[string]string{
+	"GET /":                                 scopeAny,
+	"GET /health":                           scopeAny,
+	"GET /readyz":                           scopeAny,
+	"GET /version":                          scopeAny,
+	"POST /upload":                          adapters.ScopeUpload,
+	"POST /ingest/stream":                   adapters.ScopeUpload,
+	"POST /ingest/stream/:id":               adapters.ScopeUpload,
+	"POST /ingest/stream/:id/close":         adapters.ScopeUpload,
+	"DELETE /ingest/stream/:id":             adapters.ScopeUpload,
+	"POST /query":                           adapters.ScopeQuery,
+	"POST /chat/rag":                        adapters.ScopeQuery,
+	"POST /retrieve":                        adapters.ScopeQuery,
+	"POST /search-sources":                  adapters.ScopeQuery,
+	"GET /search":                           adapters.ScopeQuery,
+	"POST /v1/chat/completions":             adapters.ScopeQuery,
+	"GET /documents":                        adapters.ScopeRead,
+	"GET /library":                          adapters.ScopeRead,
+	"GET /documents/:id/text":               adapters.ScopeRead,
+	"GET /documents/:id/events":             adapters.ScopeRead,
+	"GET /documents/:id/thumbnail":          adapters.ScopeRead,
+	"GET /chunks/:id/context":               adapters.ScopeRead,
+	"GET /collections":                      adapters.ScopeRead,
+	"GET /files/:documentId/:filename":      adapters.ScopeRead,
+	"GET /files/:documentId/:filename/link": adapters.ScopeRead,
+	"DELETE /documents/:id":                 adapters.ScopeDelete,
+	"DELETE /documents":                     adapters.ScopeDelete,
+	"POST /library/delete":                  adapters.ScopeDelete,
+}
+
+// routeScope is the scope a request needs from a scoped API token, "" when
+// no scope allows it
+func routeScope(method, path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for route, scope := range routeScopes {
+		routeMethod, pattern, _ := strings.Cut(route, " ")
+		if routeMethod == method && routeMatches(strings.Split(strings.Trim(pattern, "/"), "/"), segments) {
+			return scope
+		}
+	}
+	return ""
+}
+
+// routeLimits is a route class's deadline and slow-request threshold
+type routeLimits struct {
+	Timeout       time.Duration
+	SlowThreshold time.Duration
+}
+
+// routeClass classifies a request by its path, since the matched route is
+// not known until the router runs the handler
+func routeClass(method, path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for route, class := range routeClasses {
+		routeMethod, pattern, _ := strings.Cut(route, " ")
+		if routeMethod == method && routeMatches(strings.Split(strings.Trim(pattern, "/"), "/"), segments) {
+			return class
+		}
+	}
+	return routeClassAPI
+}
+
+// routeMatches compares path segments, with ":param" matching any segment
+func routeMatches(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, part := range pattern {
+		if !strings.HasPrefix(part, ":") && part != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID is the ID the requestid middleware gave the request, or the one
+// the client sent in X-Request-ID
+func requestID(c *fiber.Ctx) string {
+	id, _ := c.Locals("requestid").(string)
+	return id
+}
+
+// routeDeadlines bounds each handler by its route class's timeout through
+// c.UserContext(), answering 504 when a handler fails after its deadline.
+// Requests slower than the class's threshold are logged with their request
+// ID, counted in /metrics and kept for /admin/slow-requests. Database calls
+// don't take a context, so the deadline stops LLM, MinIO and outbound HTTP
+// work but not a running query.
+func routeDeadlines(limits map[string]routeLimits, slow *adapters.SlowRequestLog) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		class := routeClass(c.Method(), c.Path())
+		limit := limits[class]
+
+		ctx := c.UserContext()
+		if limit.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, limit.Timeout)
+			defer cancel()
+			c.SetUserContext(ctx)
+		}
+
+		started := time.Now()
+		err := c.Next()
+		elapsed := time.Since(started)
+
+		timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded) && responseStatus(c, err) >= 500
+		if timedOut {
+			err = respondTimeout(c, limit.Timeout)
+		}
+		if !timedOut && (limit.SlowThreshold <= 0 || elapsed < limit.SlowThreshold) {
+			return err
+		}
+
+		// Fiber reuses the request's buffers, so kept strings are copied
+		request := adapters.SlowRequest{
+			RequestID:   strings.Clone(requestID(c)),
+			Method:      strings.Clone(c.Method()),
+			Route:       c.Route().Path,
+			Path:        strings.Clone(c.Path()),
+			Class:       class,
+			Status:      responseStatus(c, err),
+			DurationMs:  elapsed.Milliseconds(),
+			ThresholdMs: limit.SlowThreshold.Milliseconds(),
+			TimedOut:    timedOut,
+			At:          time.Now().UTC().Format(time.RFC3339),
+		}
+		if strings.HasPrefix(c.Get("Content-Type"), "application/json") {
+			request.Details = adapters.TruncateRunes(string(c.Body()), 500)
+		}
+		if timedOut {
+			log.Printf("Warning: request %s timed out: %s %s after %s (deadline %s)",
+				request.RequestID, request.Method, request.Path, elapsed.Round(time.Millisecond), limit.Timeout)
+		} else {
+			log.Printf("Warning: slow request %s: %s %s took %s (threshold %s, status %d)",
+				request.RequestID, request.Method, request.Path, elapsed.Round(time.Millisecond), limit.SlowThreshold, request.Status)
+		}
+		slow.Record(request)
+		adapters.DefaultMetrics.RecordSlowRequest(class, timedOut)
+
+		return err
+	}
+}
+
+// respondTimeout replaces a failed response with 504 once the request's
+// deadline has passed
+func respondTimeout(c *fiber.Ctx, timeout time.Duration) error {
+	if strings.HasPrefix(c.Path(), "/v1/") {
+		return respondOpenAIError(c, fiber.StatusGatewayTimeout, fmt.Sprintf("Request timed out after %s", timeout))
+	}
+	return c.Status(fiber.StatusGatewayTimeout).JSON(fiber.Map{
+		"error":      "Request timed out",
+		"details":    fmt.Sprintf("the request did not finish within %s", timeout),
+		"request_id": requestID(c),
+	})
+}
+
+// responseStatus is the status a request will finish with, including
+// errors returned by the handler that the error handler hasn't written yet
+func responseStatus(c *fiber.Ctx, err error) int {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	if err != nil {
+		return fiber.StatusInternalServerError
+	}
+	return c.Response().StatusCode()
+}
+
+// requestCredential returns the API key or widget token sent with a
+// request, if any
+func requestCredential(c *fiber.Ctx) string {
+	if key := c.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token := c.Get("X-Widget-Token"); token != "" {
+		return token
+	}
+	if auth := c.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// requestAPIToken returns the scoped API token the request was sent with,
+// if any
+func requestAPIToken(c *fiber.Ctx) *adapters.APITokenRecord {
+	token, _ := c.Locals("api_token").(*adapters.APITokenRecord)
+	return token
+}
+
+// requestUser returns the user signed in through SSO, if any
+func requestUser(c *fiber.Ctx) *adapters.UserClaims {
+	user, _ := c.Locals("user").(*adapters.UserClaims)
+	return user
+}
+
+// requestActor identifies the caller for the audit log and usage quotas:
+// the SSO user if signed in, else the API key or IP
+func requestActor(c *fiber.Ctx) string {
+	if user := requestUser(c); user != nil {
+		return adapters.UserActorID(user.Subject)
+	}
+	if token := requestAPIToken(c); token != nil {
+		return "token:" + token.ID
+	}
+	return adapters.ActorID(requestCredential(c), c.IP())
+}
+
+// requestWidget returns the embed widget whose token requireWidget
+// verified, if any
+func requestWidget(c *fiber.Ctx) *adapters.WidgetRecord {
+	widget, _ := c.Locals("widget").(*adapters.WidgetRecord)
+	return widget
+}
+
+// meteredActor identifies the caller for quotas and tenant limits by
+// verified credentials only: a signed-in user, an issued API token or a
+// widget token. Anyone else is counted by IP, since an unverified key is
+// any string the caller likes and a new one would start a fresh quota.
+func meteredActor(c *fiber.Ctx) string {
+	if user := requestUser(c); user != nil {
+		return adapters.UserActorID(user.Subject)
+	}
+	if token := requestAPIToken(c); token != nil {
+		return "token:" + token.ID
+	}
+	if widget := requestWidget(c); widget != nil {
+		return "widget:" + widget.ID
+	}
+	return adapters.ActorID("", c.IP())
+}
+
+// requestVerified reports whether the caller proved who it is: signed in
+// through SSO, with an issued API token or as an admin. Anything else a
+// request sends, like an arbitrary X-API-Key, is only the caller's claim.
+func requestVerified(c *fiber.Ctx, adminToken string) bool {
+	return requestUser(c) != nil || requestAPIToken(c) != nil || requestIsAdmin(c, adminToken)
+}
+
+// pathParam returns a route parameter with its percent-escapes decoded
+func pathParam(c *fiber.Ctx, key string) string {
+	value := c.Params(key)
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		return unescaped
+	}
+	return value
+}
+
+// requestIsAdmin reports whether the caller signed in with the admin role or
+// sent ADMIN_TOKEN
+func requestIsAdmin(c *fiber.Ctx, token string) bool {
+	if user := requestUser(c); user != nil && user.HasRole(adapters.RoleAdmin) {
+		return true
+	}
+	if token == "" {
+		return false
+	}
+	provided := c.Get("X-Admin-Token")
+	if provided == "" {
+		provided = requestCredential(c)
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// attachCollectionAccess identifies the caller for collection permission
+// checks; handlers must start from c.UserContext() for them to apply
+func attachCollectionAccess(adminToken string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		access := &adapters.CollectionAccess{
+			MemberID: requestActor(c),
+			Tenant:   meteredActor(c),
+			Admin:    requestIsAdmin(c, adminToken),
+		}
+		if token := requestAPIToken(c); token != nil && len(token.Collections) > 0 {
+			access.Collections = token.Collections
+		}
+		c.SetUserContext(adapters.WithCollectionAccess(c.UserContext(), access))
+		return c.Next()
+	}
+}
+
+// injectFaults attaches the faults a request asks for in X-Fault-Inject to
+// its context, arming MySQL faults for as long as the request runs
+func injectFaults() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := c.Get("X-Fault-Inject")
+		if header == "" {
+			return c.Next()
+		}
+		plan, err := adapters.ParseFaultPlan(header)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid X-Fault-Inject header",
+				"details": err.Error(),
+			})
+		}
+		if fault, ok := plan[adapters.FaultMySQL]; ok {
+			disarm := adapters.ArmMySQLFault(fault)
+			defer disarm()
+		}
+		c.SetUserContext(adapters.WithFaults(c.UserContext(), plan))
+		return c.Next()
+	}
+}
+
+// respondIngestStreamError maps ingest stream errors to their status
+func respondIngestStreamError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, adapters.ErrIngestStreamNotFound):
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Ingest stream not found",
+		})
+	case errors.Is(err, adapters.ErrInvalidIngestStream):
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "Invalid ingest stream request",
+			"details": err.Error(),
+		})
+	case errors.Is(err, adapters.ErrNoText):
+		return c.Status(422).JSON(fiber.Map{
+			"error":   "No text was indexed from the stream",
+			"details": err.Error(),
+		})
+	case errors.Is(err, adapters.ErrTenantQueueFull), errors.Is(err, adapters.ErrTenantQueueTimeout):
+		return c.Status(429).JSON(fiber.Map{
+			"error":   "Too many ingestions in progress",
+			"details": err.Error(),
+		})
+	case errors.Is(err, adapters.ErrCollectionForbidden), errors.Is(err, adapters.ErrInvalidCollection):
+		return respondCollectionError(c, err)
+	}
+	return c.Status(500).JSON(fiber.Map{
+		"error":   "Ingest stream failed",
+		"details": err.Error(),
+	})
+}
+
+// respondCollectionError maps collection errors to their status
+// requireAllCollections refuses bulk exports of stored answers to callers
+// that can't read every collection, since the answers draw on any of them.
+// When it reports false the response is written; return its error.
+func requireAllCollections(c *fiber.Ctx, ragService *adapters.SimpleRAGService) (bool, error) {
+	all, err := ragService.ReadsAllCollections(c.UserContext())
+	if err != nil {
+		return false, respondCollectionError(c, err)
+	}
+	if !all {
+		return false, c.Status(403).JSON(fiber.Map{
+			"error": "Exporting stored queries requires access to every collection",
+		})
+	}
+	return true, nil
+}
+
+func respondCollectionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, adapters.ErrInvalidCollection):
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "Invalid collection request",
+			"details": err.Error(),
+		})
+	case errors.Is(err, sql.ErrNoRows):
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Collection or member not found",
+		})
+	case errors.Is(err, adapters.ErrCollectionForbidden):
+		return c.Status(403).JSON(fiber.Map{
+			"error":   "Collection access denied",
+			"details": err.Error(),
+		})
+	}
+	return c.Status(500).JSON(fiber.Map{
+		"error":   "Collection request failed",
+		"details": err.Error(),
+	})
+}
+
+// authenticateUser accepts service tokens issued at SSO login. Other bearer
+// tokens (API keys, the admin token) pass through for the routes that check
+// them; an expired service token is refused so clients know to sign in again.
+func authenticateUser(tokens *adapters.AuthTokens) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		auth := c.Get("Authorization")
+		if tokens == nil || !strings.HasPrefix(auth, "Bearer ") {
+			return c.Next()
+		}
+
+		user, err := tokens.Verify(strings.TrimPrefix(auth, "Bearer "))
+		if errors.Is(err, adapters.ErrTokenExpired) {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Session expired, sign in again",
+			})
+		}
+		if err == nil {
+			c.Locals("user", user)
+		}
+
+		return c.Next()
+	}
+}
+
+// authenticateAPIToken checks scoped API tokens, sent like any API key, and
+// refuses routes outside their scopes (see routeScopes). Other credentials
+// pass through.
+func authenticateAPIToken(tokens *adapters.APITokens) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		credential := requestCredential(c)
+		if !adapters.IsAPIToken(credential) || c.Method() == fiber.MethodOptions {
+			return c.Next()
+		}
+
+		token, err := tokens.Authenticate(credential)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Invalid API token",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to check API token",
+				"details": err.Error(),
+			})
+		}
+
+		scope := routeScope(c.Method(), c.Path())
+		if scope == "" || (scope != scopeAny && !token.HasScope(scope)) {
+			return c.Status(403).JSON(fiber.Map{
+				"error":  "API token is not allowed to call this route",
+				"scopes": token.Scopes,
+			})
+		}
+
+		c.Locals("api_token", token)
+		return c.Next()
+	}
+}
+
+// auditMiddleware records who called an audited route, what they asked for
+// and how it went
+func auditMiddleware(ds *adapters.DatabaseSchema) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		action, ok := auditActions[c.Method()+" "+c.Route().Path]
+		if !ok {
+			return err
+		}
+
+		status := responseStatus(c, err)
+
+		details := ""
+		if action == "upload" {
+			if form, formErr := c.MultipartForm(); formErr == nil {
+				var names []string
+				for _, file := range form.File["files"] {
+					names = append(names, file.Filename)
+				}
+				details = strings.Join(names, ", ")
+			}
+		} else if strings.HasPrefix(c.Get("Content-Type"), "application/json") {
+			details = adapters.TruncateRunes(string(c.Body()), 1000)
+		}
+
+		entry := &adapters.AuditEntry{
+			Actor:      requestActor(c),
+			Action:     action,
+			Resource:   c.OriginalURL(),
+			Details:    details,
+			IP:         c.IP(),
+			StatusCode: status,
+		}
+		if auditErr := ds.InsertAuditEntry(entry); auditErr != nil {
+			log.Printf("Warning: failed to write audit entry: %v", auditErr)
+		}
+
+		return err
+	}
+}
+
+// requireOpenAIKey checks the bearer token OpenAI clients send when
+// OPENAI_COMPAT_API_KEY is set
+func requireOpenAIKey(key string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if key == "" {
+			return c.Next()
+		}
+
+		if subtle.ConstantTimeCompare([]byte(requestCredential(c)), []byte(key)) != 1 {
+			return respondOpenAIError(c, 401, "Invalid API key")
+		}
+
+		return c.Next()
+	}
+}
+
+// requireQuota meters a route against the caller's monthly quota and
+// refuses it with 429 once the quota is used up. LLM tokens are counted
+// through the request context, so metered handlers must start from
+// c.UserContext().
+func requireQuota(quotas *adapters.Quotas, kind string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keyID := meteredActor(c)
+
+		var uploadBytes int64
+		if kind == adapters.UsageUploadBytes {
+			if form, err := c.MultipartForm(); err == nil {
+				for _, file := range form.File["files"] {
+					uploadBytes += file.Size
+				}
+			} else {
+				// Ingest stream segments are sent as the plain body
+				uploadBytes = int64(len(c.Body()))
+			}
+		}
+
+		if err := quotas.Check(keyID, kind, uploadBytes); err != nil {
+			var exceeded *adapters.QuotaExceededError
+			if !errors.As(err, &exceeded) {
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to check quota",
+					"details": err.Error(),
+				})
+			}
+			if strings.HasPrefix(c.Path(), "/v1/") {
+				return respondOpenAIError(c, 429, err.Error())
+			}
+			return c.Status(429).JSON(fiber.Map{
+				"error":   "Monthly quota exceeded",
+				"details": err.Error(),
+				"quota":   exceeded.Kind,
+				"used":    exceeded.Used,
+				"limit":   exceeded.Limit,
+				"period":  exceeded.Period,
+			})
+		}
+
+		meter := &adapters.UsageMeter{}
+		c.SetUserContext(adapters.WithUsageMeter(c.UserContext(), meter))
+
+		err := c.Next()
+
+		// Tokens are spent even when the request fails afterwards
+		usage := adapters.Quota{Tokens: meter.Tokens()}
+		// Dry runs don't generate, so they aren't counted as queries
+		dryRun, _ := c.Locals("dry_run").(bool)
+		if responseStatus(c, err) < 400 && !dryRun {
+			switch kind {
+			case adapters.UsageQueries:
+				usage.Queries = 1
+			case adapters.UsageUploadBytes:
+				usage.UploadBytes = uploadBytes
+			}
+		}
+		if recordErr := quotas.Record(keyID, usage); recordErr != nil {
+			log.Printf("Warning: failed to record usage: %v", recordErr)
+		}
+
+		return err
+	}
+}
+
+// requireAdmin protects admin routes with ADMIN_TOKEN, sent as X-Admin-Token
+// or a bearer token, or an SSO sign-in with the admin role. Without a
+// configured token or SSO the routes stay open.
+func requireAdmin(token string, sso bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token == "" && !sso {
+			return c.Next()
+		}
+
+		if !requestIsAdmin(c, token) {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Admin token or admin sign-in required",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// requireWidget authenticates embedded widget requests by X-Widget-Token and
+// Origin, applies the widget's rate limit and answers CORS for that origin
+// only
+func requireWidget(widgets *adapters.Widgets) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Get("X-Widget-Token")
+		if token == "" {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Widget token required",
+			})
+		}
+
+		origin := c.Get("Origin")
+		widget, err := widgets.Authenticate(token, origin)
+		if errors.Is(err, adapters.ErrWidgetOrigin) {
+			return c.Status(403).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Invalid widget token",
+			})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to authenticate widget",
+			})
+		}
+
+		c.Set("Access-Control-Allow-Origin", origin)
+		c.Vary("Origin")
+
+		// Quotas and tenant limits count the verified widget from here on
+		c.Locals("widget", widget)
+		if access := adapters.CollectionAccessFromContext(c.UserContext()); access != nil {
+			scoped := *access
+			scoped.Tenant = meteredActor(c)
+			c.SetUserContext(adapters.WithCollectionAccess(c.UserContext(), &scoped))
+		}
+
+		if ok, retryAfter := widgets.Allow(widget); !ok {
+			c.Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())+1))
+			return c.Status(429).JSON(fiber.Map{
+				"error": "Widget rate limit exceeded",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,165 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultAccessFlushInterval is how often recorded document accesses are
+// written when ACCESS_FLUSH_INTERVAL isn't positive
+const defaultAccessFlushInterval = time.Minute
+
+// AccessTracker collects the documents retrieved for answers and downloaded,
+// writing them in one batch per flush instead of an update per request. A
+// document's timestamps are therefore as precise as the flush interval.
+type AccessTracker struct {
+	DatabaseSchema *DatabaseSchema
+
+	mu         sync.Mutex
+	retrieved  map[string]bool
+	downloaded map[string]bool
+}
+
+func NewAccessTracker(ds *DatabaseSchema) *AccessTracker {
+	return &AccessTracker{
+		DatabaseSchema: ds,
+		retrieved:      make(map[string]bool),
+		downloaded:     make(map[string]bool),
+	}
+}
+
+// Retrieved records documents whose chunks were retrieved
+func (a *AccessTracker) Retrieved(documentIDs ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, id := range documentIDs {
+		if id != "" {
+			a.retrieved[id] = true
+		}
+	}
+}
+
+// Downloaded records a download of a document's original
+func (a *AccessTracker) Downloaded(documentID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.downloaded[documentID] = true
+}
+
+// Flush writes the accesses recorded since the last flush. Accesses that
+// fail to write are kept for the next one.
+func (a *AccessTracker) Flush() {
+	a.mu.Lock()
+	retrieved, downloaded := a.retrieved, a.downloaded
+	a.retrieved, a.downloaded = make(map[string]bool), make(map[string]bool)
+	a.mu.Unlock()
+	if len(retrieved) == 0 && len(downloaded) == 0 {
+		return
+	}
+
+	if err := a.DatabaseSchema.RecordDocumentAccess(mapKeys(retrieved), mapKeys(downloaded)); err != nil {
+		log.Printf("Warning: failed to record access to %d documents: %v", len(retrieved)+len(downloaded), err)
+		a.mu.Lock()
+		for id := range retrieved {
+			a.retrieved[id] = true
+		}
+		for id := range downloaded {
+			a.downloaded[id] = true
+		}
+		a.mu.Unlock()
+	}
+}
+
+// StartAccessTracking flushes recorded document accesses every
+// ACCESS_FLUSH_INTERVAL until ctx is done
+func (r *SimpleRAGService) StartAccessTracking(ctx context.Context) {
+	interval := r.Config.AccessFlushInterval
+	if interval <= 0 {
+		interval = defaultAccessFlushInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.Access.Flush()
+			}
+		}
+	}()
+}
+
+// retrievedDocuments records the documents of chunks used as context
+func (r *SimpleRAGService) retrievedDocuments(chunks []ScoredChunk) {
+	ids := make([]string, 0, len(chunks))
+	for _, s := range chunks {
+		ids = append(ids, s.Chunk.DocumentID)
+	}
+	r.Access.Retrieved(ids...)
+}
+
+// ColdDocumentsReport lists completed documents no answer has drawn on,
+// with the storage they hold, to inform retention and quota decisions
+type ColdDocumentsReport struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// UnusedDays also lists documents last retrieved more than this many
+	// days ago; zero lists only documents never retrieved
+	UnusedDays int            `json:"unused_days"`
+	Documents  []ColdDocument `json:"documents"`
+	Count      int            `json:"count"`
+	TotalBytes int64          `json:"total_bytes"`
+}
+
+// ColdDocument is a document listed in a ColdDocumentsReport
+type ColdDocument struct {
+	DocumentID       string     `json:"document_id"`
+	Filename         string     `json:"filename"`
+	FileSize         int64      `json:"file_size"`
+	ChunkCount       int        `json:"chunk_count"`
+	StorageTier      string     `json:"storage_tier"`
+	CreatedAt        time.Time  `json:"created_at"`
+	LastRetrievedAt  *time.Time `json:"last_retrieved_at"`
+	LastDownloadedAt *time.Time `json:"last_downloaded_at"`
+}
+
+// ColdDocuments reports completed documents never retrieved for an answer
+// or, with unusedDays, not retrieved for that many days, least recently
+// used first. Retrievals are only known from schema version 28 on, so
+// documents older than that count as never retrieved until they are.
+func (r *SimpleRAGService) ColdDocuments(unusedDays int) (*ColdDocumentsReport, error) {
+	if unusedDays < 0 {
+		unusedDays = 0
+	}
+	r.Access.Flush()
+
+	documents, err := r.DatabaseSchema.GetColdDocuments(time.Duration(unusedDays) * 24 * time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cold documents: %w", err)
+	}
+
+	report := &ColdDocumentsReport{
+		GeneratedAt: time.Now().UTC(),
+		UnusedDays:  unusedDays,
+		Documents:   []ColdDocument{},
+	}
+	for _, doc := range documents {
+		report.Documents = append(report.Documents, doc)
+		report.TotalBytes += doc.FileSize
+	}
+	report.Count = len(report.Documents)
+	return report, nil
+}
+
+func mapKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
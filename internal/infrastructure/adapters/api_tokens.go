@@ -0,0 +1,122 @@
+package adapters
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// API token scopes; a scoped token can only call the routes of its scopes
+const (
+	// ScopeUpload allows uploading PDFs and pushing ingest streams
+	ScopeUpload = "upload"
+	// ScopeQuery allows asking questions and searching
+	ScopeQuery = "query"
+	// ScopeRead allows listing documents and reading their text and files
+	ScopeRead = "read"
+	// ScopeDelete allows deleting documents
+	ScopeDelete = "delete"
+)
+
+// apiTokenPrefix starts every scoped API token, telling them apart from
+// other credentials sent the same way
+const apiTokenPrefix = "rtk_"
+
+var ErrInvalidAPIToken = errors.New("invalid API token request")
+
+// validScopes are the scopes a token can be given
+var validScopes = map[string]bool{ScopeUpload: true, ScopeQuery: true, ScopeRead: true, ScopeDelete: true}
+
+// APITokens issues and checks API tokens restricted to scopes and,
+// optionally, collections, for integrations such as a scanner that pushes
+// PDFs but must not read answers or delete anything
+type APITokens struct {
+	DatabaseSchema *DatabaseSchema
+}
+
+func NewAPITokens(ds *DatabaseSchema) *APITokens {
+	return &APITokens{DatabaseSchema: ds}
+}
+
+// IsAPIToken reports whether credential looks like a scoped API token
+func IsAPIToken(credential string) bool {
+	return strings.HasPrefix(credential, apiTokenPrefix)
+}
+
+// Create registers a token and returns it with its secret. The secret is
+// only stored hashed, so this is the one chance to see it.
+func (t *APITokens) Create(name string, scopes, collections []string) (*APITokenRecord, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalidAPIToken)
+	}
+
+	token := &APITokenRecord{
+		ID:          fmt.Sprintf("token_%d", time.Now().UnixNano()),
+		Name:        strings.TrimSpace(name),
+		Scopes:      []string{},
+		Collections: []string{},
+	}
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !validScopes[scope] {
+			return nil, "", fmt.Errorf("%w: unknown scope %q; use upload, query, read or delete", ErrInvalidAPIToken, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			token.Scopes = append(token.Scopes, scope)
+		}
+	}
+	if len(token.Scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIToken)
+	}
+	for _, collection := range collections {
+		collection = strings.TrimSpace(collection)
+		if collection == "" {
+			continue
+		}
+		if strings.Contains(collection, ",") {
+			return nil, "", fmt.Errorf("%w: collection %q can't be named by a token", ErrInvalidAPIToken, collection)
+		}
+		if _, err := t.DatabaseSchema.GetCollection(collection); err != nil {
+			return nil, "", fmt.Errorf("%w: unknown collection %q", ErrInvalidAPIToken, collection)
+		}
+		token.Collections = append(token.Collections, collection)
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+	value := apiTokenPrefix + hex.EncodeToString(secret)
+
+	if err := t.DatabaseSchema.InsertAPIToken(token, hashAPIToken(value)); err != nil {
+		return nil, "", fmt.Errorf("failed to create API token: %w", err)
+	}
+	return token, value, nil
+}
+
+// Authenticate returns the token a secret belongs to; unknown and revoked
+// tokens report sql.ErrNoRows
+func (t *APITokens) Authenticate(value string) (*APITokenRecord, error) {
+	return t.DatabaseSchema.GetAPITokenByHash(hashAPIToken(value))
+}
+
+// HasScope reports whether the token was given scope
+func (t *APITokenRecord) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
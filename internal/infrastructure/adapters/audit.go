@@ -0,0 +1,55 @@
+package adapters
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"strconv"
+)
+
+// ActorID identifies who made a request for the audit log. API keys are
+// stored as a short hash so the log never contains credentials; anonymous
+// callers are identified by IP.
+func ActorID(credential, ip string) string {
+	if credential == "" {
+		return "ip:" + ip
+	}
+	sum := sha256.Sum256([]byte(credential))
+	return "key:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// UserActorID identifies a user signed in through SSO. Long subjects are
+// hashed so the id fits the usage table's key column.
+func UserActorID(subject string) string {
+	if len(subject) <= 59 {
+		return "user:" + subject
+	}
+	sum := sha256.Sum256([]byte(subject))
+	return "user:" + hex.EncodeToString(sum[:])[:32]
+}
+
+// WriteAuditCSV writes audit entries as CSV with a header row
+func WriteAuditCSV(w io.Writer, entries []AuditEntry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"id", "created_at", "actor", "action", "resource", "status_code", "ip", "details"}); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		record := []string{
+			strconv.FormatInt(entry.ID, 10),
+			formatTimestamp(entry.CreatedAt),
+			entry.Actor,
+			entry.Action,
+			entry.Resource,
+			strconv.Itoa(entry.StatusCode),
+			entry.IP,
+			entry.Details,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
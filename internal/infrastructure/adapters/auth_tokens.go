@@ -0,0 +1,122 @@
+package adapters
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// Roles a signed-in user can hold
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// authTokenIssuer is the iss claim of service tokens
+const authTokenIssuer = "rag-service"
+
+var (
+	ErrTokenInvalid = errors.New("token is invalid")
+	ErrTokenExpired = errors.New("token has expired")
+)
+
+// UserClaims are the claims of a service token issued after SSO login
+type UserClaims struct {
+	Subject   string   `json:"sub"`
+	Email     string   `json:"email,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Roles     []string `json:"roles"`
+	Issuer    string   `json:"iss"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// HasRole reports whether the user holds role
+func (c *UserClaims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthTokens issues and verifies the service's HS256 JWTs
+type AuthTokens struct {
+	TTL time.Duration
+	key []byte
+}
+
+// NewAuthTokens uses AUTH_JWT_SECRET, or a random key when it is unset, in
+// which case users have to sign in again after a restart
+func NewAuthTokens(cfg *config.Config) *AuthTokens {
+	key := []byte(cfg.AuthJWTSecret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("Failed to generate JWT signing key: %v", err)
+		}
+		log.Println("Warning: AUTH_JWT_SECRET is not set, sign-ins are invalidated on restart")
+	}
+
+	ttl := cfg.AuthJWTTTL
+	if ttl <= 0 {
+		ttl = 8 * time.Hour
+	}
+	return &AuthTokens{TTL: ttl, key: key}
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Issue signs a token for the user, setting its issuer and lifetime
+func (t *AuthTokens) Issue(claims UserClaims) (string, *UserClaims, error) {
+	now := time.Now()
+	claims.Issuer = authTokenIssuer
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(t.TTL).Unix()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + t.signature(signingInput), &claims, nil
+}
+
+// Verify checks a token's signature and expiry and returns its claims
+func (t *AuthTokens) Verify(token string) (*UserClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrTokenInvalid
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(t.signature(parts[0]+"."+parts[1]))) {
+		return nil, ErrTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	var claims UserClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Issuer != authTokenIssuer {
+		return nil, ErrTokenInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+func (t *AuthTokens) signature(signingInput string) string {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,102 @@
+package adapters
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+)
+
+// blobPrefix holds originals named by content hash, so identical uploads
+// share one object
+const blobPrefix = "blobs/"
+
+// ErrIntegrity means a stored original no longer matches its content hash
+var ErrIntegrity = errors.New("stored file failed integrity check")
+
+// ContentHash returns the hex SHA-256 of data
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// blobObjectName is the content-addressed object name for a hash
+func blobObjectName(hash string) string {
+	return blobPrefix + hash + ".pdf"
+}
+
+// blobLockStripes is how many locks objects are spread over by lockBlob
+const blobLockStripes = 64
+
+// lockBlob locks an original against concurrent decisions to reuse, move or
+// remove it, which each read which documents use it first. An upload holds
+// it from storeBlob until its document row references the object, and a
+// delete from removing its row until releaseBlob is done. The returned
+// function unlocks.
+func (r *SimpleRAGService) lockBlob(objectName string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(objectName))
+	mu := &r.blobLocks[h.Sum32()%blobLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// storeBlob stores pdfData as objectName, its content-addressed name,
+// unless an identical file is already stored, and brings a shared object
+// that tiering moved out back to the hot bucket. The caller holds
+// lockBlob(objectName).
+func (r *SimpleRAGService) storeBlob(ctx context.Context, objectName string, pdfData []byte) error {
+	tier, err := r.DatabaseSchema.GetObjectTier(objectName)
+	if err != nil {
+		return fmt.Errorf("failed to look up stored object: %w", err)
+	}
+
+	if tier == StorageTierHot {
+		log.Printf("Reusing stored object %s", objectName)
+		return nil
+	}
+
+	if err := r.MinIOAdapter.PutObject(ctx, "documents", objectName, pdfData, "application/pdf"); err != nil {
+		return err
+	}
+
+	if tier != "" {
+		// Documents sharing this object had it archived or deleted
+		if tier == StorageTierArchive {
+			if err := r.MinIOAdapter.RemoveObject(ctx, r.Config.TieringBucket, objectName); err != nil {
+				log.Printf("Warning: failed to remove archived copy of %s: %v", objectName, err)
+			}
+		}
+		if err := r.DatabaseSchema.SetStorageTier(objectName, StorageTierHot); err != nil {
+			log.Printf("Warning: failed to record storage tier for %s: %v", objectName, err)
+		}
+	}
+
+	return nil
+}
+
+// releaseBlob removes a content-addressed original once no document
+// references it. The caller holds lockBlob(objectName).
+func (r *SimpleRAGService) releaseBlob(ctx context.Context, objectName, tier string) error {
+	if !strings.HasPrefix(objectName, blobPrefix) {
+		return nil
+	}
+
+	remaining, err := r.DatabaseSchema.GetObjectTier(objectName)
+	if err != nil {
+		return fmt.Errorf("failed to look up stored object: %w", err)
+	}
+	if remaining != "" {
+		return nil
+	}
+
+	bucket := "documents"
+	if tier == StorageTierArchive {
+		bucket = r.Config.TieringBucket
+	}
+	return r.MinIOAdapter.RemoveObject(ctx, bucket, objectName)
+}
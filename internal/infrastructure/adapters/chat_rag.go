@@ -0,0 +1,121 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrInvalidChatHistory wraps errors in the history of a stateless chat
+var ErrInvalidChatHistory = errors.New("invalid chat history")
+
+const (
+	// chatHistoryTurns is how many of the latest history turns are read to
+	// understand a follow-up question
+	chatHistoryTurns = 10
+	// chatTurnRunes caps each turn quoted to the LLM
+	chatTurnRunes = 1000
+)
+
+// ChatRAG answers message as the next turn of a conversation the caller
+// keeps: history holds the earlier user and assistant turns, oldest first,
+// and system turns are ignored. Nothing about the conversation is stored.
+// A follow-up ("and in 2020?") is rewritten into a question that stands on
+// its own before retrieval, so the answer's StandaloneQuestion says what
+// was actually asked.
+func (r *SimpleRAGService) ChatRAG(ctx context.Context, history []ChatCompletionMessage, message string, opts QueryOptions) (*SimpleRAGResponse, error) {
+	var turns []ChatCompletionMessage
+	for i, turn := range history {
+		switch turn.Role {
+		case "user", "assistant":
+			if strings.TrimSpace(turn.Content) != "" {
+				turns = append(turns, turn)
+			}
+		case "system":
+		default:
+			return nil, fmt.Errorf("%w: turn %d has role %q; use user, assistant or system", ErrInvalidChatHistory, i, turn.Role)
+		}
+	}
+	if len(turns) > chatHistoryTurns {
+		turns = turns[len(turns)-chatHistoryTurns:]
+	}
+
+	// The rewrite quotes this conversation, so it isn't worth caching
+	question := r.standaloneQuestion(WithoutGenerationCache(ctx), turns, message)
+	response, err := r.Query(ctx, question, opts)
+	if err != nil {
+		return nil, err
+	}
+	if question != message {
+		response.StandaloneQuestion = question
+	}
+	return response, nil
+}
+
+// standaloneQuestion rewrites message so it can be answered without the
+// conversation before it. Without an LLM, or if the rewrite fails, the
+// previous user turn is prepended so retrieval still sees what a follow-up
+// refers to.
+func (r *SimpleRAGService) standaloneQuestion(ctx context.Context, turns []ChatCompletionMessage, message string) string {
+	if len(turns) == 0 {
+		return message
+	}
+	if r.canGenerate() {
+		start := time.Now()
+		questionLanguage, _ := DetectLanguage(message)
+		rewritten, err := r.LLM.GenerateText(ctx, standaloneQuestionPrompt(r.responseLanguage(ctx, questionLanguage), turns, message))
+		DebugTraceFromContext(ctx).AddStage("standalone_question", time.Since(start))
+		rewritten = strings.Trim(strings.TrimSpace(rewritten), `"«»`)
+		if err == nil && rewritten != "" {
+			return rewritten
+		}
+		if err != nil {
+			log.Printf("Warning: failed to rewrite follow-up question, using the previous turn: %v", err)
+		}
+	}
+
+	for i := len(turns) - 1; i >= 0; i-- {
+		if turns[i].Role == "user" {
+			return TruncateRunes(turns[i].Content, chatTurnRunes) + "\n" + message
+		}
+	}
+	return message
+}
+
+// standaloneQuestionPrompt asks for message rewritten to stand on its own
+func standaloneQuestionPrompt(lang string, turns []ChatCompletionMessage, message string) string {
+	var b strings.Builder
+	for _, turn := range turns {
+		role := "User"
+		if turn.Role == "assistant" {
+			role = "Assistant"
+		}
+		if lang == "fa" {
+			role = "کاربر"
+			if turn.Role == "assistant" {
+				role = "دستیار"
+			}
+		}
+		fmt.Fprintf(&b, "%s: %s\n", role, TruncateRunes(strings.TrimSpace(turn.Content), chatTurnRunes))
+	}
+
+	if lang == "fa" {
+		return fmt.Sprintf(`با توجه به گفتگوی زیر، پرسش بعدی کاربر را طوری بازنویسی کن که بدون گفتگو هم قابل فهم باشد. اگر از قبل مستقل است، آن را بدون تغییر برگردان. فقط پرسش بازنویسی‌شده را بنویس.
+
+گفتگو:
+%s
+پرسش بعدی: %s
+
+پرسش مستقل:`, b.String(), message)
+	}
+	return fmt.Sprintf(`Given the conversation below, rewrite the user's follow-up question so it can be understood without the conversation. If it already stands on its own, return it unchanged. Reply with the rewritten question only.
+
+CONVERSATION:
+%s
+FOLLOW-UP QUESTION: %s
+
+STANDALONE QUESTION:`, b.String(), message)
+}
@@ -0,0 +1,80 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// maxChunkNeighbors caps how many chunks are returned on each side of a
+// chunk
+const maxChunkNeighbors = 10
+
+// ChunkNeighborhood is a chunk with the chunks before and after it in its
+// document and the full text of its page, for reading around a citation
+type ChunkNeighborhood struct {
+	DocumentID string        `json:"document_id"`
+	Filename   string        `json:"filename"`
+	Chunk      ChunkRecord   `json:"chunk"`
+	Before     []ChunkRecord `json:"before"`
+	After      []ChunkRecord `json:"after"`
+	// PageText is empty when the page text can't be read, e.g. because the
+	// original was deleted by tiering
+	PageText string `json:"page_text,omitempty"`
+}
+
+// ChunkContext returns up to around chunks on each side of a chunk, and its
+// page text; the caller needs read access to the document's collection
+func (r *SimpleRAGService) ChunkContext(ctx context.Context, chunkID string, around int) (*ChunkNeighborhood, error) {
+	if around < 0 {
+		around = 0
+	}
+	if around > maxChunkNeighbors {
+		around = maxChunkNeighbors
+	}
+
+	chunk, err := r.DatabaseSchema.GetChunk(chunkID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := r.DatabaseSchema.GetDocument(chunk.DocumentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.CheckCollectionAccess(ctx, DocumentCollection(doc.Metadata), PermissionRead); err != nil {
+		return nil, err
+	}
+
+	neighbors, err := r.DatabaseSchema.GetChunkRange(doc.ID, chunk.ChunkIndex-around, chunk.ChunkIndex+around)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get neighboring chunks: %w", err)
+	}
+	neighborhood := &ChunkNeighborhood{
+		DocumentID: doc.ID,
+		Filename:   doc.OriginalFilename,
+		Chunk:      *chunk,
+		Before:     []ChunkRecord{},
+		After:      []ChunkRecord{},
+	}
+	for _, neighbor := range neighbors {
+		switch {
+		case neighbor.ChunkIndex < chunk.ChunkIndex:
+			neighborhood.Before = append(neighborhood.Before, neighbor)
+		case neighbor.ChunkIndex > chunk.ChunkIndex:
+			neighborhood.After = append(neighborhood.After, neighbor)
+		}
+	}
+
+	pages, err := r.DocumentText(ctx, doc.ID)
+	if err != nil {
+		log.Printf("Warning: failed to get page text of %s: %v", doc.ID, err)
+		return neighborhood, nil
+	}
+	for _, page := range pages {
+		if page.Page == chunk.PageNumber {
+			neighborhood.PageText = page.Text
+			break
+		}
+	}
+	return neighborhood, nil
+}
@@ -0,0 +1,64 @@
+package adapters
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxTokenRunes is the longest run without spaces kept as a word;
+	// longer ones are base64, hex dumps or text whose spaces the PDF lost,
+	// none of which a question matches
+	maxTokenRunes = 200
+	// binaryTokenRunes is the length from which a word that is mostly
+	// symbols is taken for binary noise
+	binaryTokenRunes = 12
+	// maxChunkRunes caps any stored chunk, whatever built it, so one
+	// malformed table row or hook output can't fill a prompt by itself
+	maxChunkRunes = 4000
+)
+
+// sanitizeWords drops the words of space-separated text that look like
+// binary noise or are too long to be words, see maxTokenRunes
+func sanitizeWords(text string) string {
+	words := strings.Fields(text)
+	kept := words[:0]
+	for _, word := range words {
+		if utf8.RuneCountInString(word) > maxTokenRunes || binaryLooking(word) {
+			continue
+		}
+		kept = append(kept, word)
+	}
+	return strings.Join(kept, " ")
+}
+
+// binaryLooking reports whether a long word is mostly neither letters nor
+// digits, like the runs of symbols a PDF with a broken font map decodes to
+func binaryLooking(word string) bool {
+	total, textual := 0, 0
+	for _, r := range word {
+		total++
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+			textual++
+		}
+	}
+	return total >= binaryTokenRunes && textual*2 < total
+}
+
+// sanitizeChunkText makes chunk text safe to store and quote: invalid UTF-8
+// and control characters other than newlines and tabs are dropped, and the
+// text is capped at maxChunkRunes. It reports whether the text was cut.
+func sanitizeChunkText(text string) (string, bool) {
+	text = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || (unicode.IsControl(r) && r != '\n' && r != '\t') {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(text, ""))
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxChunkRunes {
+		return capRunes(text, maxChunkRunes), true
+	}
+	return text, false
+}
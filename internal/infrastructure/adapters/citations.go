@@ -0,0 +1,251 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Citation modes, set by CITATION_MODE or per collection
+const (
+	CitationModeOff        = "off"
+	CitationModeReject     = "reject"
+	CitationModeRegenerate = "regenerate"
+)
+
+// citationModeRank orders the modes from least to most strict
+var citationModeRank = map[string]int{
+	CitationModeOff:        0,
+	CitationModeRegenerate: 1,
+	CitationModeReject:     2,
+}
+
+// claimMinWords is how many words a sentence needs to count as a claim
+// that must be cited; shorter ones ("Yes.") are let through
+const claimMinWords = 3
+
+var (
+	// citationMarkerPattern matches inline citations like [2] or [1, 3]
+	citationMarkerPattern = regexp.MustCompile(`\[(\d+(?:\s*[,،]\s*\d+)*)\]`)
+	// sentenceEndPattern matches the end of a sentence within a line
+	sentenceEndPattern = regexp.MustCompile(`[.!?؟]+\s+`)
+	// bulletPattern matches list bullets and numbering at line start
+	bulletPattern = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)])\s+`)
+)
+
+// ValidCitationMode reports whether mode is a known citation mode
+func ValidCitationMode(mode string) bool {
+	_, ok := citationModeRank[mode]
+	return ok
+}
+
+// CitationCheck reports how a strict-citation answer cites its context
+type CitationCheck struct {
+	Mode     string `json:"mode"`
+	Verified bool   `json:"verified"`
+	// Cited are the context chunks the answer cites, by marker
+	Cited []CitedChunk `json:"cited"`
+	// Uncited are the answer's claims without a valid citation
+	Uncited []string `json:"uncited,omitempty"`
+	// Regenerated means the first answer lacked citations and was asked
+	// for again
+	Regenerated bool `json:"regenerated,omitempty"`
+}
+
+// CitedChunk is the context chunk an inline [n] citation refers to
+type CitedChunk struct {
+	Marker     int    `json:"marker"`
+	ChunkID    string `json:"chunk_id"`
+	DocumentID string `json:"document_id"`
+	Page       int    `json:"page"`
+	// Offset is where the chunk starts in the page's text, when known
+	Offset *int `json:"offset,omitempty"`
+}
+
+// citationMode is the strictest mode among the context's documents: a
+// document's collection mode if it sets one, CITATION_MODE otherwise
+func (r *SimpleRAGService) citationMode(chunks []ScoredChunk, documents []DocumentRecord) string {
+	mode := CitationModeOff
+	if r.Config != nil && ValidCitationMode(r.Config.CitationMode) {
+		mode = r.Config.CitationMode
+	}
+
+	collections := make(map[string]string, len(documents))
+	for _, doc := range documents {
+		if collection := DocumentCollection(doc.Metadata); collection != "" {
+			collections[doc.ID] = collection
+		}
+	}
+	if len(collections) == 0 {
+		return mode
+	}
+	overrides, err := r.DatabaseSchema.GetCollectionCitationModes()
+	if err != nil || len(overrides) == 0 {
+		return mode
+	}
+
+	strictest := ""
+	for _, scored := range chunks {
+		documentMode := mode
+		if override, ok := overrides[collections[scored.Chunk.DocumentID]]; ok && ValidCitationMode(override) {
+			documentMode = override
+		}
+		if strictest == "" || citationModeRank[documentMode] > citationModeRank[strictest] {
+			strictest = documentMode
+		}
+	}
+	if strictest == "" {
+		return mode
+	}
+	return strictest
+}
+
+// buildCitedContext numbers the chunks [1], [2], ... for inline citation,
+// keeping whole chunks within the context cap. It returns the context and
+// how many chunks it holds.
+func buildCitedContext(chunks []ScoredChunk) (string, int) {
+	var b strings.Builder
+	n := 0
+	for _, scored := range chunks {
+		part := fmt.Sprintf("[%d] %s", n+1, scored.Chunk.ChunkText)
+		if n > 0 && utf8.RuneCountInString(b.String())+utf8.RuneCountInString(part)+2 > maxContextRunes {
+			break
+		}
+		if n > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(part)
+		n++
+	}
+	return capRunes(b.String(), maxContextRunes), n
+}
+
+// citedAnswerPrompt asks for an answer citing the numbered context after
+// every claim; uncited lists the claims a previous attempt left uncited
+func citedAnswerPrompt(lang, context, question string, uncited []string) string {
+	retry := ""
+	if len(uncited) > 0 {
+		if lang == "fa" {
+			retry = "\nپاسخ قبلی برای این جمله‌ها منبع نیاورده بود؛ برایشان منبع بیاور یا حذفشان کن:\n- " + strings.Join(uncited, "\n- ") + "\n"
+		} else {
+			retry = "\nA previous answer left these sentences without a citation; cite them or leave them out:\n- " + strings.Join(uncited, "\n- ") + "\n"
+		}
+	}
+
+	if lang == "fa" {
+		return fmt.Sprintf(`فقط با استفاده از اطلاعات «متن زمینه» زیر پاسخ بده. پاسخ باید دقیق، واضح و به زبان فارسی باشد. بخش‌های متن شماره‌گذاری شده‌اند؛ پس از هر جمله‌ی پاسخ، شماره‌ی بخشی را که آن را پشتیبانی می‌کند در کروشه بیاور، مثلاً [1] یا [2, 3]. جمله‌ای را که در متن پشتیبانی ندارد ننویس. اگر پاسخ در متن نبود، فقط بگو: «اطلاعات کافی در متن موجود نیست».
+%s
+متن زمینه:
+%s
+
+پرسش: %s
+
+پاسخ:`, retry, context, question)
+	}
+	return fmt.Sprintf(`Answer this question using ONLY the information provided in the context below. Give a direct, specific answer. The context passages are numbered: end every sentence of your answer with the number of the passage that supports it in brackets, e.g. [1] or [2, 3]. Leave out anything the context does not support.
+%s
+CONTEXT:
+%s
+
+QUESTION: %s
+
+ANSWER:`, retry, context, question)
+}
+
+// answerWithCitations generates an answer citing the numbered context and
+// checks its citations. In regenerate mode an answer with uncited claims is
+// asked for once more.
+func (r *SimpleRAGService) answerWithCitations(ctx context.Context, mode, lang, context, question string, chunks []ScoredChunk) (string, *CitationCheck, error) {
+	answer, err := r.LLM.GenerateText(ctx, citedAnswerPrompt(lang, context, question, nil))
+	if err != nil {
+		return "", nil, err
+	}
+	check := checkCitations(mode, answer, chunks)
+	if check.Verified || mode != CitationModeRegenerate || lacksInformation(answer) {
+		return answer, check, nil
+	}
+
+	retried, err := r.LLM.GenerateText(ctx, citedAnswerPrompt(lang, context, question, check.Uncited))
+	if err != nil {
+		return "", nil, err
+	}
+	check = checkCitations(mode, retried, chunks)
+	check.Regenerated = true
+	return retried, check, nil
+}
+
+// checkCitations finds the answer's claims and the context chunks they
+// cite; a claim needs at least one marker naming a chunk in the context
+func checkCitations(mode, answer string, chunks []ScoredChunk) *CitationCheck {
+	check := &CitationCheck{Mode: mode, Cited: []CitedChunk{}}
+	seen := make(map[int]bool)
+	for _, claim := range answerClaims(answer) {
+		cited := false
+		for _, marker := range citationMarkers(claim) {
+			if marker < 1 || marker > len(chunks) {
+				continue
+			}
+			cited = true
+			if !seen[marker] {
+				seen[marker] = true
+				chunk := chunks[marker-1].Chunk
+				check.Cited = append(check.Cited, CitedChunk{Marker: marker, ChunkID: chunk.ID, DocumentID: chunk.DocumentID, Page: chunk.PageNumber, Offset: chunkOffset(chunk)})
+			}
+		}
+		text := strings.TrimSpace(citationMarkerPattern.ReplaceAllString(claim, ""))
+		if !cited && len(strings.Fields(text)) >= claimMinWords && !strings.HasSuffix(text, ":") {
+			check.Uncited = append(check.Uncited, text)
+		}
+	}
+	check.Verified = len(check.Uncited) == 0 && len(check.Cited) > 0
+	return check
+}
+
+// answerClaims splits an answer into sentences. A citation written after a
+// sentence's full stop ("... year. [2]") stays with that sentence.
+func answerClaims(answer string) []string {
+	var claims []string
+	for _, line := range strings.Split(NormalizeDigits(answer), "\n") {
+		line = bulletPattern.ReplaceAllString(strings.TrimSpace(line), "")
+		if line == "" {
+			continue
+		}
+		start := 0
+		var pieces []string
+		for _, end := range sentenceEndPattern.FindAllStringIndex(line, -1) {
+			pieces = append(pieces, line[start:end[1]])
+			start = end[1]
+		}
+		pieces = append(pieces, line[start:])
+
+		for i, piece := range pieces {
+			piece = strings.TrimSpace(piece)
+			if piece == "" {
+				continue
+			}
+			rest := strings.Trim(citationMarkerPattern.ReplaceAllString(piece, ""), " .!?؟")
+			if rest == "" && i > 0 && len(claims) > 0 {
+				claims[len(claims)-1] += " " + piece
+				continue
+			}
+			claims = append(claims, piece)
+		}
+	}
+	return claims
+}
+
+// citationMarkers returns the chunk numbers cited in text
+func citationMarkers(text string) []int {
+	var markers []int
+	for _, match := range citationMarkerPattern.FindAllStringSubmatch(text, -1) {
+		for _, part := range strings.FieldsFunc(match[1], func(r rune) bool { return r == ',' || r == '،' || r == ' ' }) {
+			if n, err := strconv.Atoi(part); err == nil {
+				markers = append(markers, n)
+			}
+		}
+	}
+	return markers
+}
@@ -0,0 +1,469 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Collection permissions; write includes read and managing members
+const (
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+)
+
+var (
+	ErrCollectionForbidden = errors.New("no access to this collection")
+	ErrCollectionExists    = errors.New("collection already exists")
+	ErrCollectionNotEmpty  = errors.New("collection still has documents")
+	ErrInvalidCollection   = errors.New("invalid collection request")
+	ErrCollectionInUse     = errors.New("documents already use this collection name")
+	ErrCollectionAnonymous = errors.New("collections need a signed-in user or an issued API token")
+)
+
+// CollectionAccess identifies the caller for collection permission checks.
+// Requests carry one in their context; work without one (background jobs)
+// is not restricted.
+type CollectionAccess struct {
+	MemberID string
+	// Tenant is the verified identity per-tenant limits are keyed on: a
+	// signed-in user, an issued API or widget token, else the caller's IP
+	Tenant string
+	// Admin callers can read and write every collection
+	Admin bool
+	// Collections, when set, limits the caller to these collections, as
+	// for an API token restricted to them; it can read and write them
+	// without being a member
+	Collections []string
+}
+
+// Member is the caller's collection member ID: a signed-in user or an
+// issued API token. Unverified keys and bare IPs can't hold memberships,
+// so it is "" for them.
+func (a *CollectionAccess) Member() string {
+	if a == nil || !ValidMemberID(a.MemberID) {
+		return ""
+	}
+	return a.MemberID
+}
+
+// ValidMemberID reports whether id names an SSO user or an issued API
+// token, the only identities collections grant access to
+func ValidMemberID(id string) bool {
+	return (strings.HasPrefix(id, "user:") || strings.HasPrefix(id, "token:")) && strings.IndexByte(id, ':') < len(id)-1
+}
+
+type collectionAccessKey struct{}
+
+// WithCollectionAccess attaches the caller's identity to the context
+func WithCollectionAccess(ctx context.Context, access *CollectionAccess) context.Context {
+	return context.WithValue(ctx, collectionAccessKey{}, access)
+}
+
+// CollectionAccessFromContext returns the caller attached to ctx, or nil
+func CollectionAccessFromContext(ctx context.Context) *CollectionAccess {
+	access, _ := ctx.Value(collectionAccessKey{}).(*CollectionAccess)
+	return access
+}
+
+// DocumentCollection is the collection a document belongs to, from its
+// metadata; empty when it belongs to none
+func DocumentCollection(metadataJSON string) string {
+	var metadata struct {
+		Collection string `json:"collection"`
+	}
+	if json.Unmarshal([]byte(metadataJSON), &metadata) != nil {
+		return ""
+	}
+	return metadata.Collection
+}
+
+// collectionGuard answers permission questions for one caller. Documents
+// outside any registered collection stay open to everyone, so instances
+// that don't use collections behave as before.
+type collectionGuard struct {
+	unrestricted bool
+	registered   map[string]bool
+	granted      map[string]string
+	// only, when set, are the only collections the caller can use
+	only map[string]bool
+}
+
+// collectionGuard loads the caller's memberships from ctx
+func (r *SimpleRAGService) collectionGuard(ctx context.Context) (*collectionGuard, error) {
+	access := CollectionAccessFromContext(ctx)
+	if access == nil || access.Admin {
+		return &collectionGuard{unrestricted: true}, nil
+	}
+
+	names, err := r.DatabaseSchema.GetCollectionNames()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load collections: %w", err)
+	}
+	granted := map[string]string{}
+	if member := access.Member(); member != "" {
+		granted, err = r.DatabaseSchema.GetMemberPermissions(member)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load collection permissions: %w", err)
+		}
+	}
+
+	guard := &collectionGuard{registered: make(map[string]bool, len(names)), granted: granted}
+	for _, name := range names {
+		guard.registered[name] = true
+	}
+	if access.Collections != nil {
+		guard.only = make(map[string]bool, len(access.Collections))
+		for _, name := range access.Collections {
+			guard.only[name] = true
+		}
+	}
+	return guard, nil
+}
+
+// Permission is the caller's permission on a collection, "" for none
+func (g *collectionGuard) Permission(collection string) string {
+	if g.only != nil {
+		if g.only[collection] {
+			return PermissionWrite
+		}
+		return ""
+	}
+	if g.unrestricted || collection == "" || !g.registered[collection] {
+		return PermissionWrite
+	}
+	return g.granted[collection]
+}
+
+// Allows reports whether the caller has at least the needed permission
+func (g *collectionGuard) Allows(collection, need string) bool {
+	switch g.Permission(collection) {
+	case PermissionWrite:
+		return true
+	case PermissionRead:
+		return need == PermissionRead
+	}
+	return false
+}
+
+// readable keeps the documents the caller may read
+func (g *collectionGuard) readable(documents []DocumentRecord) []DocumentRecord {
+	if g.unrestricted {
+		return documents
+	}
+	var allowed []DocumentRecord
+	for _, doc := range documents {
+		if g.Allows(DocumentCollection(doc.Metadata), PermissionRead) {
+			allowed = append(allowed, doc)
+		}
+	}
+	return allowed
+}
+
+// readsAll reports whether the caller can read every collection
+func (g *collectionGuard) readsAll() bool {
+	if g.unrestricted {
+		return true
+	}
+	if g.only != nil {
+		return false
+	}
+	for name := range g.registered {
+		if !g.Allows(name, PermissionRead) {
+			return false
+		}
+	}
+	return true
+}
+
+// citedReadable reports whether the caller may read every document a stored
+// answer cites. An answer with a context but no citations, or citing a
+// deleted document, can't be attributed and counts as unreadable.
+// collections caches the documents' collections by ID.
+func (r *SimpleRAGService) citedReadable(g *collectionGuard, sourcesJSON string, hasContext bool, collections map[string]*string) bool {
+	var sources []string
+	if sourcesJSON != "" && json.Unmarshal([]byte(sourcesJSON), &sources) != nil {
+		return false
+	}
+	if len(sources) == 0 {
+		return !hasContext
+	}
+	for _, source := range sources {
+		id := ParseSource(source).DocumentID
+		collection, ok := collections[id]
+		if !ok {
+			if doc, err := r.DatabaseSchema.GetDocument(id); err == nil {
+				name := DocumentCollection(doc.Metadata)
+				collection = &name
+			}
+			collections[id] = collection
+		}
+		if collection == nil || !g.Allows(*collection, PermissionRead) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadsAllCollections reports whether the caller in ctx can read every
+// collection, as bulk exports of stored answers require
+func (r *SimpleRAGService) ReadsAllCollections(ctx context.Context) (bool, error) {
+	guard, err := r.collectionGuard(ctx)
+	if err != nil {
+		return false, err
+	}
+	return guard.readsAll(), nil
+}
+
+// ReadableQueries keeps the stored queries whose answers draw only on
+// documents the caller in ctx may read
+func (r *SimpleRAGService) ReadableQueries(ctx context.Context, queries []QueryRecord) ([]QueryRecord, error) {
+	guard, err := r.collectionGuard(ctx)
+	if err != nil || guard.readsAll() {
+		return queries, err
+	}
+	collections := make(map[string]*string)
+	allowed := []QueryRecord{}
+	for _, q := range queries {
+		if r.citedReadable(guard, q.Sources, q.Context != "", collections) {
+			allowed = append(allowed, q)
+		}
+	}
+	return allowed, nil
+}
+
+// ReadableMessages keeps the chat messages the caller in ctx may read,
+// dropping answers that cite documents it can't
+func (r *SimpleRAGService) ReadableMessages(ctx context.Context, messages []ChatMessage) ([]ChatMessage, error) {
+	guard, err := r.collectionGuard(ctx)
+	if err != nil || guard.readsAll() {
+		return messages, err
+	}
+	collections := make(map[string]*string)
+	allowed := []ChatMessage{}
+	for _, m := range messages {
+		if m.Role != "assistant" || r.citedReadable(guard, m.Sources, false, collections) {
+			allowed = append(allowed, m)
+		}
+	}
+	return allowed, nil
+}
+
+// ReadableDocuments keeps the documents the caller in ctx may read
+func (r *SimpleRAGService) ReadableDocuments(ctx context.Context, documents []DocumentRecord) ([]DocumentRecord, error) {
+	guard, err := r.collectionGuard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return guard.readable(documents), nil
+}
+
+// CheckCollectionAccess returns ErrCollectionForbidden unless the caller in
+// ctx has the needed permission on collection
+func (r *SimpleRAGService) CheckCollectionAccess(ctx context.Context, collection, need string) error {
+	guard, err := r.collectionGuard(ctx)
+	if err != nil {
+		return err
+	}
+	if !guard.Allows(collection, need) {
+		return fmt.Errorf("%w %q", ErrCollectionForbidden, collection)
+	}
+	return nil
+}
+
+// CreateCollection registers a collection, making its documents visible to
+// members only. The creator becomes a member with write access, so it must
+// be a signed-in user or an issued API token. Only admins can register a
+// name documents already use, since that hides them from their uploaders.
+func (r *SimpleRAGService) CreateCollection(ctx context.Context, name, description, citationMode string) (*CollectionRecord, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidCollection)
+	}
+	if citationMode != "" && !ValidCitationMode(citationMode) {
+		return nil, fmt.Errorf("%w: citation_mode must be off, reject or regenerate", ErrInvalidCollection)
+	}
+	access := CollectionAccessFromContext(ctx)
+	admin := access == nil || access.Admin
+	if !admin && access.Member() == "" {
+		return nil, ErrCollectionAnonymous
+	}
+	if _, err := r.DatabaseSchema.GetCollection(name); err == nil {
+		return nil, ErrCollectionExists
+	}
+	if !admin {
+		count, err := r.DatabaseSchema.CountCollectionDocuments(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count collection documents: %w", err)
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("%w: %d documents", ErrCollectionInUse, count)
+		}
+	}
+
+	collection := &CollectionRecord{Name: name, Description: strings.TrimSpace(description), CitationMode: citationMode}
+	collection.CreatedBy = access.Member()
+	if err := r.DatabaseSchema.InsertCollection(collection); err != nil {
+		return nil, fmt.Errorf("failed to create collection: %w", err)
+	}
+	if collection.CreatedBy != "" {
+		if err := r.DatabaseSchema.SetCollectionMember(name, collection.CreatedBy, PermissionWrite); err != nil {
+			return nil, fmt.Errorf("failed to add collection owner: %w", err)
+		}
+	}
+	return r.DatabaseSchema.GetCollection(name)
+}
+
+// ListCollections returns the collections the caller can read, each with
+// the caller's permission
+func (r *SimpleRAGService) ListCollections(ctx context.Context) ([]CollectionRecord, error) {
+	guard, err := r.collectionGuard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	collections, err := r.DatabaseSchema.GetCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []CollectionRecord{}
+	for _, collection := range collections {
+		if permission := guard.Permission(collection.Name); permission != "" {
+			collection.Permission = permission
+			visible = append(visible, collection)
+		}
+	}
+	return visible, nil
+}
+
+// HiddenCollections lists the registered collections the caller can't read,
+// for filtering document listings
+func (r *SimpleRAGService) HiddenCollections(ctx context.Context) ([]string, error) {
+	guard, err := r.collectionGuard(ctx)
+	if err != nil || guard.unrestricted {
+		return nil, err
+	}
+	var hidden []string
+	for name := range guard.registered {
+		if !guard.Allows(name, PermissionRead) {
+			hidden = append(hidden, name)
+		}
+	}
+	return hidden, nil
+}
+
+// OnlyCollections lists the collections the caller in ctx is limited to,
+// or nil when it isn't, for filtering document listings
+func (r *SimpleRAGService) OnlyCollections(ctx context.Context) []string {
+	if access := CollectionAccessFromContext(ctx); access != nil && !access.Admin {
+		return access.Collections
+	}
+	return nil
+}
+
+// recentReadableDocuments returns the newest documents the caller in ctx may
+// read. The visibility filter runs in SQL, so limit counts readable
+// documents only.
+func (r *SimpleRAGService) recentReadableDocuments(ctx context.Context, limit int) ([]DocumentRecord, error) {
+	hidden, err := r.HiddenCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	documents, _, err := r.DatabaseSchema.ListDocuments(DocumentFilter{
+		Limit:             limit,
+		HiddenCollections: hidden,
+		OnlyCollections:   r.OnlyCollections(ctx),
+	})
+	return documents, err
+}
+
+// SetCollectionCitationMode overrides CITATION_MODE for a collection's
+// documents, or with "" stops overriding it; the caller needs write access
+func (r *SimpleRAGService) SetCollectionCitationMode(ctx context.Context, collection, mode string) (*CollectionRecord, error) {
+	if mode != "" && !ValidCitationMode(mode) {
+		return nil, fmt.Errorf("%w: citation_mode must be off, reject or regenerate", ErrInvalidCollection)
+	}
+	if _, err := r.DatabaseSchema.GetCollection(collection); err != nil {
+		return nil, err
+	}
+	if err := r.CheckCollectionAccess(ctx, collection, PermissionWrite); err != nil {
+		return nil, err
+	}
+	if err := r.DatabaseSchema.SetCollectionCitationMode(collection, mode); err != nil {
+		return nil, err
+	}
+	return r.DatabaseSchema.GetCollection(collection)
+}
+
+// CollectionMembers lists a collection's members; the caller needs read
+// access. Memberships recorded for unverified keys or IPs before those
+// stopped counting are left out.
+func (r *SimpleRAGService) CollectionMembers(ctx context.Context, collection string) ([]CollectionMember, error) {
+	if _, err := r.DatabaseSchema.GetCollection(collection); err != nil {
+		return nil, err
+	}
+	if err := r.CheckCollectionAccess(ctx, collection, PermissionRead); err != nil {
+		return nil, err
+	}
+	members, err := r.DatabaseSchema.GetCollectionMembers(collection)
+	if err != nil {
+		return nil, err
+	}
+	verified := []CollectionMember{}
+	for _, member := range members {
+		if ValidMemberID(member.MemberID) {
+			verified = append(verified, member)
+		}
+	}
+	return verified, nil
+}
+
+// SetCollectionMember grants a member read or write access; the caller
+// needs write access
+func (r *SimpleRAGService) SetCollectionMember(ctx context.Context, collection, memberID, permission string) error {
+	if permission != PermissionRead && permission != PermissionWrite {
+		return fmt.Errorf("%w: permission must be %q or %q", ErrInvalidCollection, PermissionRead, PermissionWrite)
+	}
+	if !ValidMemberID(memberID) {
+		return fmt.Errorf("%w: member id must be a signed-in user (user:...) or an API token (token:...)", ErrInvalidCollection)
+	}
+	if _, err := r.DatabaseSchema.GetCollection(collection); err != nil {
+		return err
+	}
+	if err := r.CheckCollectionAccess(ctx, collection, PermissionWrite); err != nil {
+		return err
+	}
+	return r.DatabaseSchema.SetCollectionMember(collection, memberID, permission)
+}
+
+// RemoveCollectionMember revokes a member's access; the caller needs write
+// access
+func (r *SimpleRAGService) RemoveCollectionMember(ctx context.Context, collection, memberID string) error {
+	if err := r.CheckCollectionAccess(ctx, collection, PermissionWrite); err != nil {
+		return err
+	}
+	return r.DatabaseSchema.RemoveCollectionMember(collection, memberID)
+}
+
+// DeleteCollection unregisters an empty collection; the caller needs write
+// access
+func (r *SimpleRAGService) DeleteCollection(ctx context.Context, name string) error {
+	if _, err := r.DatabaseSchema.GetCollection(name); err != nil {
+		return err
+	}
+	if err := r.CheckCollectionAccess(ctx, name, PermissionWrite); err != nil {
+		return err
+	}
+
+	// Unregistering would make the remaining documents visible to everyone
+	count, err := r.DatabaseSchema.CountCollectionDocuments(name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: move or delete its %d documents first", ErrCollectionNotEmpty, count)
+	}
+	return r.DatabaseSchema.DeleteCollection(name)
+}
@@ -0,0 +1,24 @@
+package adapters
+
+import "testing"
+
+func TestCollectionAccessMember(t *testing.T) {
+	tests := []struct {
+		access *CollectionAccess
+		want   string
+	}{
+		{nil, ""},
+		{&CollectionAccess{MemberID: "user:alice"}, "user:alice"},
+		{&CollectionAccess{MemberID: "token:42"}, "token:42"},
+		{&CollectionAccess{MemberID: "key:0123456789ab"}, ""},
+		{&CollectionAccess{MemberID: "ip:203.0.113.7"}, ""},
+		{&CollectionAccess{MemberID: "user:"}, ""},
+		{&CollectionAccess{MemberID: "token:"}, ""},
+		{&CollectionAccess{MemberID: ""}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.access.Member(); got != tt.want {
+			t.Errorf("Member(%+v) = %q, want %q", tt.access, got, tt.want)
+		}
+	}
+}
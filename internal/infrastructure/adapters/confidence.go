@@ -0,0 +1,122 @@
+package adapters
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Confidence signals, weighted by CONFIDENCE_WEIGHTS
+const (
+	// SignalRetrieval is the best context chunk's score, capped at 1
+	SignalRetrieval = "retrieval"
+	// SignalCoverage is the share of the question's terms the context holds
+	SignalCoverage = "coverage"
+	// SignalOverlap is the share of the answer's words found in the context
+	SignalOverlap = "overlap"
+	// SignalGrounded is the share of the answer's claims mostly made of
+	// context words
+	SignalGrounded = "grounded"
+)
+
+// groundedClaimCoverage is the share of a claim's words the context must
+// hold for the claim to count as grounded
+const groundedClaimCoverage = 0.6
+
+// ConfidenceSignal is one weighted input to an answer's confidence
+type ConfidenceSignal struct {
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+	Weight float64 `json:"weight"`
+}
+
+// ConfidenceBreakdown shows how an answer's confidence was computed: the
+// weighted mean of its signals, times any numeric mismatch penalty
+type ConfidenceBreakdown struct {
+	Signals        []ConfidenceSignal `json:"signals"`
+	NumericPenalty float64            `json:"numeric_penalty,omitempty"`
+	Confidence     float64            `json:"confidence"`
+}
+
+// ParseConfidenceWeights reads CONFIDENCE_WEIGHTS
+// ("retrieval=0.5,coverage=0.2,overlap=0.15,grounded=0.15") into weights
+// by signal. Invalid entries are skipped with a warning.
+func ParseConfidenceWeights(spec string) map[string]float64 {
+	known := map[string]bool{SignalRetrieval: true, SignalCoverage: true, SignalOverlap: true, SignalGrounded: true}
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		signal, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !known[strings.TrimSpace(signal)] || err != nil || weight < 0 {
+			log.Printf("Warning: ignoring confidence weight %q from CONFIDENCE_WEIGHTS", pair)
+			continue
+		}
+		weights[strings.TrimSpace(signal)] = weight
+	}
+	return weights
+}
+
+// scoreConfidence combines the confidence signals for an answer drawn from
+// context. Without an answer (retrieval-only mode) the answer signals don't
+// apply and the others share their weight. With no usable weights the best
+// score alone is the confidence.
+func (r *SimpleRAGService) scoreConfidence(ctx context.Context, questionWords []string, bestScore float64, context, answer string) *ConfidenceBreakdown {
+	values := map[string]float64{
+		SignalRetrieval: bestScore,
+		SignalCoverage:  r.relevanceFeatures(questionWords, context).coverage(),
+	}
+	if values[SignalRetrieval] > 1.0 {
+		values[SignalRetrieval] = 1.0
+	}
+	if answer != "" {
+		values[SignalOverlap] = r.textOverlap(answer, context)
+		values[SignalGrounded] = r.groundedClaims(answer, context)
+	}
+
+	weights := r.settingsFor(ctx).confidenceWeights
+	breakdown := &ConfidenceBreakdown{Signals: []ConfidenceSignal{}}
+	total, weighted := 0.0, 0.0
+	for _, name := range []string{SignalRetrieval, SignalCoverage, SignalOverlap, SignalGrounded} {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		weight := weights[name]
+		breakdown.Signals = append(breakdown.Signals, ConfidenceSignal{Name: name, Value: value, Weight: weight})
+		total += weight
+		weighted += weight * value
+	}
+	if total > 0 {
+		breakdown.Confidence = weighted / total
+	} else {
+		breakdown.Confidence = values[SignalRetrieval]
+	}
+	return breakdown
+}
+
+// textOverlap is the share of text's words, citation markers aside, the
+// context holds
+func (r *SimpleRAGService) textOverlap(text, context string) float64 {
+	words := strings.Fields(strings.ToLower(citationMarkerPattern.ReplaceAllString(text, " ")))
+	return r.relevanceFeatures(words, context).coverage()
+}
+
+// groundedClaims is the share of the answer's claims whose words the
+// context mostly holds; an answer without claims counts as grounded
+func (r *SimpleRAGService) groundedClaims(answer, context string) float64 {
+	claims := answerClaims(answer)
+	if len(claims) == 0 {
+		return 1
+	}
+	grounded := 0
+	for _, claim := range claims {
+		if r.textOverlap(claim, context) >= groundedClaimCoverage {
+			grounded++
+		}
+	}
+	return float64(grounded) / float64(len(claims))
+}
@@ -0,0 +1,60 @@
+package adapters
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// What happens to an answer in a confidence band
+const (
+	BandAnswer  = "answer"
+	BandWarn    = "warn"
+	BandAbstain = "abstain"
+)
+
+// ConfidenceBand is a named confidence range, from MinConfidence up to the
+// next band's minimum, and what happens to answers in it
+type ConfidenceBand struct {
+	Name          string  `json:"name"`
+	MinConfidence float64 `json:"min_confidence"`
+	Behavior      string  `json:"behavior"`
+}
+
+// ParseConfidenceBands reads CONFIDENCE_BANDS
+// ("high=0.7:answer,medium=0.4:warn,low=0:abstain") into bands, highest
+// first. Invalid entries are skipped with a warning.
+func ParseConfidenceBands(spec string) []ConfidenceBand {
+	var bands []ConfidenceBand
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rest, _ := strings.Cut(entry, "=")
+		value, behavior, _ := strings.Cut(rest, ":")
+		name, behavior = strings.TrimSpace(name), strings.ToLower(strings.TrimSpace(behavior))
+		min, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if name == "" || err != nil || min < 0 || min > 1 || (behavior != BandAnswer && behavior != BandWarn && behavior != BandAbstain) {
+			log.Printf("Warning: ignoring confidence band %q from CONFIDENCE_BANDS", entry)
+			continue
+		}
+		bands = append(bands, ConfidenceBand{Name: name, MinConfidence: min, Behavior: behavior})
+	}
+	sort.SliceStable(bands, func(i, j int) bool {
+		return bands[i].MinConfidence > bands[j].MinConfidence
+	})
+	return bands
+}
+
+// confidenceBand returns the highest band whose minimum confidence reaches,
+// or nil when it is below every band
+func confidenceBand(bands []ConfidenceBand, confidence float64) *ConfidenceBand {
+	for i := range bands {
+		if confidence >= bands[i].MinConfidence {
+			return &bands[i]
+		}
+	}
+	return nil
+}
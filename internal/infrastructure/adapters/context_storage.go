@@ -0,0 +1,181 @@
+package adapters
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// Formats an answer's retrieval context is stored in, set by
+// CONTEXT_STORAGE
+const (
+	// ContextStorageFull stores the context text as is
+	ContextStorageFull = "full"
+	// ContextStorageCompressed stores the text gzipped and base64 encoded
+	ContextStorageCompressed = "compressed"
+	// ContextStorageChunkIDs stores only the IDs of the context's chunks;
+	// the text is rebuilt from them when asked for, leaving out chunks a
+	// later re-index replaced
+	ContextStorageChunkIDs = "chunk_ids"
+)
+
+// contextCompressBatch is how many stored contexts CompressStoredContexts
+// rewrites per query
+const contextCompressBatch = 500
+
+// StoredContext is an answer's retrieval context as stored with it; an
+// empty Format means ContextStorageFull, as written before formats existed
+type StoredContext struct {
+	Format string
+	Data   string
+}
+
+// ValidContextStorage reports whether format is a CONTEXT_STORAGE value
+func ValidContextStorage(format string) bool {
+	switch format {
+	case ContextStorageFull, ContextStorageCompressed, ContextStorageChunkIDs:
+		return true
+	}
+	return false
+}
+
+// StoreContext encodes a response's context in the CONTEXT_STORAGE format.
+// Contexts not built from chunks, such as reused answers', are compressed
+// instead of stored as chunk IDs.
+func (r *SimpleRAGService) StoreContext(response *SimpleRAGResponse) StoredContext {
+	if response.Context == "" {
+		return StoredContext{}
+	}
+
+	format := r.Config.ContextStorage
+	if format == ContextStorageChunkIDs {
+		if len(response.chunks) > 0 {
+			ids := make([]string, 0, len(response.chunks))
+			for _, s := range response.chunks {
+				ids = append(ids, s.Chunk.ID)
+			}
+			return StoredContext{Format: ContextStorageChunkIDs, Data: strings.Join(ids, ",")}
+		}
+		format = ContextStorageCompressed
+	}
+	if format == ContextStorageCompressed {
+		data, err := compressContext(response.Context)
+		if err == nil {
+			return StoredContext{Format: ContextStorageCompressed, Data: data}
+		}
+		log.Printf("Warning: failed to compress context, storing it in full: %v", err)
+	}
+	return StoredContext{Format: ContextStorageFull, Data: response.Context}
+}
+
+// ExpandContext returns the text of a stored context
+func (ds *DatabaseSchema) ExpandContext(stored StoredContext) (string, error) {
+	switch stored.Format {
+	case "", ContextStorageFull:
+		return stored.Data, nil
+	case ContextStorageCompressed:
+		return decompressContext(stored.Data)
+	case ContextStorageChunkIDs:
+		ids := splitList(stored.Data)
+		chunks, err := ds.GetChunksByIDs(ids)
+		if err != nil {
+			return "", fmt.Errorf("failed to get context chunks: %w", err)
+		}
+		parts := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if chunk, ok := chunks[id]; ok {
+				parts = append(parts, chunk.ChunkText)
+			}
+		}
+		return capRunes(strings.Join(parts, "\n\n"), maxContextRunes), nil
+	}
+	return "", fmt.Errorf("unknown context format %q", stored.Format)
+}
+
+// QueryContext returns the retrieval context a stored query was answered
+// from
+func (r *SimpleRAGService) QueryContext(q *QueryRecord) (string, error) {
+	return r.DatabaseSchema.ExpandContext(StoredContext{Format: q.ContextFormat, Data: q.Context})
+}
+
+// ExpandMessageContexts sets the retrieval context of a session's assistant
+// messages that have one stored
+func (r *SimpleRAGService) ExpandMessageContexts(sessionID string, messages []ChatMessage) error {
+	stored, err := r.DatabaseSchema.GetChatMessageContexts(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get message contexts: %w", err)
+	}
+	for i := range messages {
+		context, ok := stored[messages[i].ID]
+		if !ok {
+			continue
+		}
+		if messages[i].Context, err = r.DatabaseSchema.ExpandContext(context); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompressStoredContexts rewrites the contexts stored in full, by queries
+// and chat messages written before CONTEXT_STORAGE or while it was "full",
+// compressed. It returns how many were rewritten.
+func (r *SimpleRAGService) CompressStoredContexts() (int, error) {
+	compressed := 0
+	for _, table := range []string{"document_queries", "chat_messages"} {
+		for {
+			contexts, err := r.DatabaseSchema.GetFullContexts(table, contextCompressBatch)
+			if err != nil {
+				return compressed, fmt.Errorf("failed to get stored contexts: %w", err)
+			}
+			for id, context := range contexts {
+				data, err := compressContext(context)
+				if err != nil {
+					return compressed, err
+				}
+				stored := StoredContext{Format: ContextStorageCompressed, Data: data}
+				if err := r.DatabaseSchema.SetStoredContext(table, id, stored); err != nil {
+					return compressed, fmt.Errorf("failed to store compressed context: %w", err)
+				}
+				compressed++
+			}
+			if len(contexts) < contextCompressBatch {
+				break
+			}
+		}
+	}
+	return compressed, nil
+}
+
+func compressContext(context string) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(context)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decompressContext(data string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode compressed context: %w", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress context: %w", err)
+	}
+	defer r.Close()
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress context: %w", err)
+	}
+	return string(text), nil
+}
@@ -0,0 +1,164 @@
+package adapters
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// defaultLowChunks is the chunk count below which a document is listed
+	// as having low chunks
+	defaultLowChunks = 3
+	// ocrMinWordsPerKB is the extracted words per KB of PDF below which a
+	// document likely holds scanned pages; text PDFs extract dozens
+	ocrMinWordsPerKB = 1.0
+	// ocrMinFileSize keeps small PDFs, whose size is mostly overhead, out
+	// of the words-per-KB check
+	ocrMinFileSize = 100 * 1024
+	// ocrMaxPageCoverage is the share of pages with text below which a
+	// document likely mixes scanned and text pages
+	ocrMaxPageCoverage = 0.5
+)
+
+// CorpusReport points out documents worth cleaning up: too few chunks,
+// likely scanned pages, never cited and duplicated
+type CorpusReport struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Documents   int       `json:"documents"`
+	// LowChunks are documents with fewer than LowChunkThreshold chunks,
+	// none included
+	LowChunks         []CorpusReportDocument `json:"low_chunks"`
+	LowChunkThreshold int                    `json:"low_chunk_threshold"`
+	// OCRCandidates are documents stored for OCR or whose text looks like
+	// it came from only part of the PDF
+	OCRCandidates []CorpusReportDocument `json:"ocr_candidates"`
+	// NeverCited are completed documents no stored answer or chat message
+	// cites, oldest first
+	NeverCited []CorpusReportDocument `json:"never_cited"`
+	// Duplicates group documents with the same original PDF
+	Duplicates []DuplicateDocuments `json:"duplicates"`
+}
+
+// CorpusReportDocument is a document listed in a CorpusReport, with why
+type CorpusReportDocument struct {
+	DocumentID string    `json:"document_id"`
+	Filename   string    `json:"filename"`
+	Status     string    `json:"status"`
+	ChunkCount int       `json:"chunk_count"`
+	FileSize   int64     `json:"file_size"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DuplicateDocuments are documents uploaded from the same PDF
+type DuplicateDocuments struct {
+	ContentHash string                 `json:"content_hash"`
+	Documents   []CorpusReportDocument `json:"documents"`
+}
+
+// CorpusReport checks every document for the problems a CorpusReport
+// lists. lowChunks sets the low chunk threshold, defaultLowChunks when not
+// positive.
+func (r *SimpleRAGService) CorpusReport(lowChunks int) (*CorpusReport, error) {
+	if lowChunks <= 0 {
+		lowChunks = defaultLowChunks
+	}
+	documents, err := r.DatabaseSchema.GetDocumentHealth()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get documents: %w", err)
+	}
+	sourceLists, err := r.DatabaseSchema.GetAnswerSources()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get answer sources: %w", err)
+	}
+
+	// Older history cites bare filenames, so those count too
+	citedIDs := make(map[string]bool)
+	citedFilenames := make(map[string]bool)
+	for _, list := range sourceLists {
+		var sources []string
+		if json.Unmarshal([]byte(list), &sources) != nil {
+			continue
+		}
+		for _, source := range sources {
+			parsed := ParseSource(source)
+			if parsed.DocumentID != "" {
+				citedIDs[parsed.DocumentID] = true
+			} else {
+				citedFilenames[parsed.Filename] = true
+			}
+		}
+	}
+
+	report := &CorpusReport{
+		GeneratedAt:       time.Now().UTC(),
+		Documents:         len(documents),
+		LowChunks:         []CorpusReportDocument{},
+		LowChunkThreshold: lowChunks,
+		OCRCandidates:     []CorpusReportDocument{},
+		NeverCited:        []CorpusReportDocument{},
+		Duplicates:        []DuplicateDocuments{},
+	}
+	byHash := make(map[string][]CorpusReportDocument)
+	for _, doc := range documents {
+		entry := CorpusReportDocument{
+			DocumentID: doc.ID,
+			Filename:   doc.Filename,
+			Status:     doc.Status,
+			ChunkCount: doc.ChunkCount,
+			FileSize:   doc.FileSize,
+			CreatedAt:  doc.CreatedAt,
+		}
+		if doc.ContentHash != "" {
+			byHash[doc.ContentHash] = append(byHash[doc.ContentHash], entry)
+		}
+		if doc.Status == "processing" {
+			continue
+		}
+
+		if doc.ChunkCount < lowChunks {
+			low := entry
+			low.Reason = fmt.Sprintf("%d chunks", doc.ChunkCount)
+			report.LowChunks = append(report.LowChunks, low)
+		}
+		if reason := ocrReason(doc); reason != "" {
+			candidate := entry
+			candidate.Reason = reason
+			report.OCRCandidates = append(report.OCRCandidates, candidate)
+		}
+		if doc.Status == "completed" && !citedIDs[doc.ID] && !citedFilenames[doc.Filename] {
+			report.NeverCited = append(report.NeverCited, entry)
+		}
+	}
+
+	for hash, group := range byHash {
+		if len(group) > 1 {
+			report.Duplicates = append(report.Duplicates, DuplicateDocuments{ContentHash: hash, Documents: group})
+		}
+	}
+	sort.Slice(report.Duplicates, func(i, j int) bool {
+		return report.Duplicates[i].Documents[0].CreatedAt.Before(report.Duplicates[j].Documents[0].CreatedAt)
+	})
+	return report, nil
+}
+
+// ocrReason says why a document looks like it needs OCR, or returns ""
+func ocrReason(doc DocumentHealth) string {
+	if doc.Status == DocumentStatusNeedsOCR {
+		return "no text could be extracted"
+	}
+	if doc.Status != "completed" || DocumentSource(doc.Metadata) == DocumentSourceStream {
+		return ""
+	}
+	if doc.FileSize >= ocrMinFileSize {
+		if perKB := float64(doc.Words) / (float64(doc.FileSize) / 1024); perKB < ocrMinWordsPerKB {
+			return fmt.Sprintf("%d words extracted from %d KB", doc.Words, doc.FileSize/1024)
+		}
+	}
+	if doc.LastPage > 1 && float64(doc.Pages)/float64(doc.LastPage) < ocrMaxPageCoverage {
+		return fmt.Sprintf("text on %d of the first %d pages", doc.Pages, doc.LastPage)
+	}
+	return ""
+}
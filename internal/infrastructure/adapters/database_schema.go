@@ -4,9 +4,14 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
+// SchemaVersion is the current table layout; bump it whenever CreateTables
+// or migrate changes a table
+const SchemaVersion = 30
+
 type DatabaseSchema struct {
 	DB *sql.DB
 }
@@ -23,12 +28,21 @@ func (ds *DatabaseSchema) CreateTables() error {
 		filename VARCHAR(255) NOT NULL,
 		original_filename VARCHAR(255) NOT NULL,
 		file_size BIGINT NOT NULL,
+		content_hash CHAR(64),
 		upload_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		status ENUM('processing', 'completed', 'failed') DEFAULT 'processing',
+		status ENUM('processing', 'completed', 'failed', 'needs_ocr') DEFAULT 'processing',
 		chunk_count INT DEFAULT 0,
+		chunk_version INT NOT NULL DEFAULT 0,
+		chunk_version_seq INT NOT NULL DEFAULT 0,
+		recovery_attempts INT DEFAULT 0,
+		storage_tier VARCHAR(16) DEFAULT 'hot',
+		last_accessed_at TIMESTAMP NULL,
+		last_retrieved_at TIMESTAMP NULL,
+		last_downloaded_at TIMESTAMP NULL,
 		metadata JSON,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		INDEX idx_documents_filename (filename)
 	)`
 
 	// Create document_chunks table
@@ -39,9 +53,40 @@ func (ds *DatabaseSchema) CreateTables() error {
 		chunk_text TEXT NOT NULL,
 		page_number INT NOT NULL,
 		chunk_index INT NOT NULL,
+		version INT NOT NULL DEFAULT 0,
 		word_count INT NOT NULL,
+		language VARCHAR(16),
+		script VARCHAR(16),
+		chunk_type VARCHAR(16) DEFAULT 'text',
+		quantity_terms TEXT,
+		synthetic_questions TEXT,
 		metadata JSON,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE KEY uq_chunks_document_version (document_id, version, chunk_index),
+		FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE
+	)`
+
+	// Create chunk_embeddings table holding each chunk's vector, tagged
+	// with the embedder that made it
+	createChunkEmbeddingsTable := `
+	CREATE TABLE IF NOT EXISTS chunk_embeddings (
+		chunk_id VARCHAR(255) PRIMARY KEY,
+		model VARCHAR(128) NOT NULL,
+		vector BLOB NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (chunk_id) REFERENCES document_chunks(id) ON DELETE CASCADE
+	)`
+
+	// Create document_events table of what happened to each document, in
+	// words its owner can read
+	createDocumentEventsTable := `
+	CREATE TABLE IF NOT EXISTS document_events (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		document_id VARCHAR(255) NOT NULL,
+		kind VARCHAR(32) NOT NULL,
+		message TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_document_events_document (document_id, id),
 		FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE
 	)`
 
@@ -54,6 +99,9 @@ func (ds *DatabaseSchema) CreateTables() error {
 		confidence FLOAT NOT NULL,
 		sources JSON,
 		context TEXT,
+		context_format VARCHAR(16),
+		corpus_version VARCHAR(64),
+		rating TINYINT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	)`
 
@@ -62,6 +110,7 @@ func (ds *DatabaseSchema) CreateTables() error {
 	CREATE TABLE IF NOT EXISTS chat_sessions (
 		id VARCHAR(255) PRIMARY KEY,
 		title VARCHAR(255) NOT NULL,
+		language VARCHAR(16),
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 	)`
@@ -74,17 +123,260 @@ func (ds *DatabaseSchema) CreateTables() error {
 		role ENUM('user', 'assistant') NOT NULL,
 		content TEXT NOT NULL,
 		sources JSON,
+		context TEXT,
+		context_format VARCHAR(16),
 		confidence FLOAT,
+		corpus_version VARCHAR(64),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES chat_sessions(id) ON DELETE CASCADE
+	)`
+
+	// Create corpus_summaries table for map-reduce summarization jobs
+	createSummariesTable := `
+	CREATE TABLE IF NOT EXISTS corpus_summaries (
+		id VARCHAR(255) PRIMARY KEY,
+		status ENUM('running', 'completed', 'failed') DEFAULT 'running',
+		document_ids JSON,
+		completed_steps INT DEFAULT 0,
+		total_steps INT DEFAULT 0,
+		summary MEDIUMTEXT,
+		error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`
+
+	// Create reports table for compiled question/answer reports
+	createReportsTable := `
+	CREATE TABLE IF NOT EXISTS reports (
+		id VARCHAR(255) PRIMARY KEY,
+		title VARCHAR(255) NOT NULL,
+		status ENUM('running', 'completed', 'failed') DEFAULT 'running',
+		questions JSON,
+		completed_steps INT DEFAULT 0,
+		total_steps INT DEFAULT 0,
+		markdown_object VARCHAR(512),
+		pdf_object VARCHAR(512),
+		error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`
+
+	// Create audit_log table; it is kept across flushes on purpose
+	createAuditLogTable := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		actor VARCHAR(128) NOT NULL,
+		action VARCHAR(64) NOT NULL,
+		resource VARCHAR(512),
+		details TEXT,
+		ip VARCHAR(64),
+		status_code INT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_audit_created (created_at),
+		INDEX idx_audit_actor (actor),
+		INDEX idx_audit_action (action)
+	)`
+
+	// Create feature_flags table holding admin overrides
+	createFeatureFlagsTable := `
+	CREATE TABLE IF NOT EXISTS feature_flags (
+		name VARCHAR(64) PRIMARY KEY,
+		enabled BOOLEAN NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`
+
+	// Create setting_overrides table of settings changed through
+	// /admin/settings, by environment variable name
+	createSettingOverridesTable := `
+	CREATE TABLE IF NOT EXISTS setting_overrides (
+		name VARCHAR(64) PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`
+
+	// Create widgets table for embedded chat widgets; tokens are stored hashed
+	createWidgetsTable := `
+	CREATE TABLE IF NOT EXISTS widgets (
+		id VARCHAR(255) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		token_hash CHAR(64) NOT NULL UNIQUE,
+		allowed_origins TEXT NOT NULL,
+		rate_limit INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	// Create api_tokens table of tokens limited to scopes and collections
+	createAPITokensTable := `
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id VARCHAR(255) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		token_hash CHAR(64) NOT NULL UNIQUE,
+		scopes VARCHAR(255) NOT NULL,
+		collections TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	// Create corpus_snapshots table; like the audit log it survives flushes
+	createCorpusSnapshotsTable := `
+	CREATE TABLE IF NOT EXISTS corpus_snapshots (
+		id VARCHAR(255) PRIMARY KEY,
+		label VARCHAR(255),
+		document_count INT NOT NULL,
+		documents JSON NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_snapshots_created (created_at)
+	)`
+
+	// Create moderation_incidents table; like the audit log it survives flushes
+	createModerationIncidentsTable := `
+	CREATE TABLE IF NOT EXISTS moderation_incidents (
+		id VARCHAR(255) PRIMARY KEY,
+		stage VARCHAR(16) NOT NULL,
+		action VARCHAR(16) NOT NULL,
+		provider VARCHAR(32) NOT NULL,
+		categories TEXT NOT NULL,
+		content TEXT NOT NULL,
+		question TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_moderation_created (created_at)
+	)`
+
+	// Create api_usage table with monthly usage per API key; survives flushes
+	// so usage can still be charged back
+	createAPIUsageTable := `
+	CREATE TABLE IF NOT EXISTS api_usage (
+		key_id VARCHAR(64) NOT NULL,
+		period CHAR(7) NOT NULL,
+		queries BIGINT NOT NULL DEFAULT 0,
+		tokens BIGINT NOT NULL DEFAULT 0,
+		upload_bytes BIGINT NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (key_id, period),
+		INDEX idx_usage_period (period)
+	)`
+
+	// Create api_quotas table with per-key overrides of the default quota
+	createAPIQuotasTable := `
+	CREATE TABLE IF NOT EXISTS api_quotas (
+		key_id VARCHAR(64) PRIMARY KEY,
+		queries BIGINT NOT NULL DEFAULT 0,
+		tokens BIGINT NOT NULL DEFAULT 0,
+		upload_bytes BIGINT NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`
+
+	// Create session_shares table for read-only session links; tokens are
+	// stored hashed
+	createSessionSharesTable := `
+	CREATE TABLE IF NOT EXISTS session_shares (
+		id VARCHAR(255) PRIMARY KEY,
+		session_id VARCHAR(255) NOT NULL,
+		token_hash CHAR(64) NOT NULL UNIQUE,
+		expires_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (session_id) REFERENCES chat_sessions(id) ON DELETE CASCADE
 	)`
 
+	// Create collections table; documents in a registered collection are
+	// only visible to its members
+	createCollectionsTable := `
+	CREATE TABLE IF NOT EXISTS collections (
+		name VARCHAR(255) PRIMARY KEY,
+		description TEXT,
+		created_by VARCHAR(64),
+		citation_mode VARCHAR(16),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	// Create collection_members table granting read or write access to a
+	// collection, keyed by ActorID
+	createCollectionMembersTable := `
+	CREATE TABLE IF NOT EXISTS collection_members (
+		collection VARCHAR(255) NOT NULL,
+		member_id VARCHAR(64) NOT NULL,
+		permission ENUM('read', 'write') NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (collection, member_id),
+		INDEX idx_collection_members_member (member_id),
+		FOREIGN KEY (collection) REFERENCES collections(name) ON DELETE CASCADE
+	)`
+
+	// Create notifications table of per-user events, keyed by ActorID
+	createNotificationsTable := `
+	CREATE TABLE IF NOT EXISTS notifications (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		recipient VARCHAR(64) NOT NULL,
+		kind VARCHAR(32) NOT NULL,
+		title VARCHAR(255) NOT NULL,
+		message TEXT,
+		resource VARCHAR(255),
+		read_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_notifications_recipient (recipient, read_at)
+	)`
+
+	// Create notification_settings table with each recipient's delivery
+	// preferences
+	createNotificationSettingsTable := `
+	CREATE TABLE IF NOT EXISTS notification_settings (
+		recipient VARCHAR(64) PRIMARY KEY,
+		email VARCHAR(255),
+		digest BOOLEAN DEFAULT FALSE,
+		digest_sent_at TIMESTAMP NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`
+
+	// Create saved_queries table of questions re-asked on a schedule
+	createSavedQueriesTable := `
+	CREATE TABLE IF NOT EXISTS saved_queries (
+		id VARCHAR(255) PRIMARY KEY,
+		owner VARCHAR(64) NOT NULL,
+		question TEXT NOT NULL,
+		interval_hours INT NOT NULL,
+		last_answer TEXT,
+		last_corpus_version VARCHAR(64),
+		last_run_at TIMESTAMP NULL,
+		next_run_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_saved_queries_owner (owner),
+		INDEX idx_saved_queries_next_run (next_run_at)
+	)`
+
+	// Create schema_info table recording the applied SchemaVersion
+	createSchemaInfoTable := `
+	CREATE TABLE IF NOT EXISTS schema_info (
+		id TINYINT PRIMARY KEY,
+		version INT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`
+
 	tables := []string{
 		createDocumentsTable,
 		createChunksTable,
+		createChunkEmbeddingsTable,
+		createDocumentEventsTable,
 		createQueriesTable,
 		createChatSessionsTable,
 		createChatMessagesTable,
+		createSummariesTable,
+		createReportsTable,
+		createAuditLogTable,
+		createFeatureFlagsTable,
+		createSettingOverridesTable,
+		createWidgetsTable,
+		createAPITokensTable,
+		createCorpusSnapshotsTable,
+		createModerationIncidentsTable,
+		createAPIUsageTable,
+		createAPIQuotasTable,
+		createSessionSharesTable,
+		createCollectionsTable,
+		createCollectionMembersTable,
+		createNotificationsTable,
+		createNotificationSettingsTable,
+		createSavedQueriesTable,
+		createSchemaInfoTable,
 	}
 
 	for _, table := range tables {
@@ -93,13 +385,342 @@ func (ds *DatabaseSchema) CreateTables() error {
 		}
 	}
 
+	if err := ds.migrate(); err != nil {
+		return err
+	}
+
+	_, err := ds.DB.Exec(`INSERT INTO schema_info (id, version) VALUES (1, ?) ON DUPLICATE KEY UPDATE version = VALUES(version)`, SchemaVersion)
+	if err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+
 	log.Println("✅ Database tables created successfully")
 	return nil
 }
 
+// migrate brings tables created by older versions up to date
+func (ds *DatabaseSchema) migrate() error {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"document_chunks", "language", "VARCHAR(16) AFTER word_count"},
+		{"document_chunks", "script", "VARCHAR(16) AFTER language"},
+		{"chat_sessions", "language", "VARCHAR(16) AFTER title"},
+		{"document_chunks", "chunk_type", "VARCHAR(16) DEFAULT 'text' AFTER script"},
+		{"document_chunks", "quantity_terms", "TEXT AFTER chunk_type"},
+		{"documents", "recovery_attempts", "INT DEFAULT 0 AFTER chunk_count"},
+		{"documents", "storage_tier", "VARCHAR(16) DEFAULT 'hot' AFTER recovery_attempts"},
+		{"documents", "last_accessed_at", "TIMESTAMP NULL AFTER storage_tier"},
+		{"documents", "content_hash", "CHAR(64) AFTER file_size"},
+		{"document_queries", "corpus_version", "VARCHAR(64) AFTER context"},
+		{"document_queries", "rating", "TINYINT NULL AFTER corpus_version"},
+		{"chat_messages", "corpus_version", "VARCHAR(64) AFTER confidence"},
+		{"notification_settings", "digest", "BOOLEAN DEFAULT FALSE AFTER email"},
+		{"notification_settings", "digest_sent_at", "TIMESTAMP NULL AFTER digest"},
+		{"documents", "chunk_version", "INT NOT NULL DEFAULT 0 AFTER chunk_count"},
+		{"documents", "chunk_version_seq", "INT NOT NULL DEFAULT 0 AFTER chunk_version"},
+		{"document_chunks", "version", "INT NOT NULL DEFAULT 0 AFTER chunk_index"},
+		{"collections", "citation_mode", "VARCHAR(16) AFTER created_by"},
+		{"documents", "last_retrieved_at", "TIMESTAMP NULL AFTER last_accessed_at"},
+		{"documents", "last_downloaded_at", "TIMESTAMP NULL AFTER last_retrieved_at"},
+		{"document_queries", "context_format", "VARCHAR(16) AFTER context"},
+		{"chat_messages", "context", "TEXT AFTER sources"},
+		{"chat_messages", "context_format", "VARCHAR(16) AFTER context"},
+		{"document_chunks", "synthetic_questions", "TEXT AFTER quantity_terms"},
+	}
+
+	for _, c := range columns {
+		if err := ds.ensureColumn(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	if err := ds.ensureEnumValue("documents", "status", DocumentStatusNeedsOCR,
+		"ENUM('processing', 'completed', 'failed', 'needs_ocr') DEFAULT 'processing'"); err != nil {
+		return err
+	}
+
+	if err := ds.ensureChunkVersionKey(); err != nil {
+		return err
+	}
+
+	if err := ds.backfillQuantityTerms(); err != nil {
+		return err
+	}
+	return ds.repairMetadata()
+}
+
+// repairMetadata fixes JSON columns written before they were built with
+// encoding/json: values that aren't valid JSON (possible where the server
+// doesn't validate JSON columns), missing metadata, and the [""] stored for
+// answers without sources. Chunk and document metadata are rebuilt from
+// their rows; source lists are re-split.
+func (ds *DatabaseSchema) repairMetadata() error {
+	repaired := int64(0)
+	statements := []string{
+		`UPDATE document_chunks SET metadata = JSON_OBJECT('page', page_number, 'chunk_index', chunk_index)
+		 WHERE metadata IS NULL OR NOT JSON_VALID(metadata)`,
+		`UPDATE documents SET metadata = JSON_OBJECT('uploaded_at', DATE_FORMAT(upload_date, '%Y-%m-%dT%H:%i:%sZ'))
+		 WHERE metadata IS NULL OR NOT JSON_VALID(metadata)`,
+	}
+	for _, table := range []string{"document_queries", "chat_messages"} {
+		statements = append(statements,
+			`UPDATE `+table+` SET sources = JSON_ARRAY() WHERE sources IS NULL OR (JSON_VALID(sources) AND JSON_LENGTH(sources) = 1 AND JSON_UNQUOTE(JSON_EXTRACT(sources, '$[0]')) = '')`)
+	}
+	for _, statement := range statements {
+		result, err := ds.DB.Exec(statement)
+		if err != nil {
+			return fmt.Errorf("failed to repair metadata: %w", err)
+		}
+		affected, _ := result.RowsAffected()
+		repaired += affected
+	}
+
+	for _, table := range []string{"document_queries", "chat_messages"} {
+		affected, err := ds.repairSources(table)
+		if err != nil {
+			return err
+		}
+		repaired += affected
+	}
+
+	if repaired > 0 {
+		log.Printf("✅ Repaired metadata in %d existing rows", repaired)
+	}
+	return nil
+}
+
+// repairSources re-encodes source lists that were concatenated as
+// ["a","b"] without escaping, so a quote in a source broke them
+func (ds *DatabaseSchema) repairSources(table string) (int64, error) {
+	rows, err := ds.DB.Query(`SELECT id, sources FROM ` + table + ` WHERE NOT JSON_VALID(sources)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s for source repair: %w", table, err)
+	}
+
+	fixed := make(map[string]string)
+	for rows.Next() {
+		var id, raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read %s for source repair: %w", table, err)
+		}
+		fixed[id] = EncodeSources(splitConcatenatedSources(raw))
+	}
+	rows.Close()
+
+	for id, sources := range fixed {
+		if _, err := ds.DB.Exec(`UPDATE `+table+` SET sources = ? WHERE id = ?`, sources, id); err != nil {
+			return 0, fmt.Errorf("failed to repair sources in %s: %w", table, err)
+		}
+	}
+	return int64(len(fixed)), nil
+}
+
+// splitConcatenatedSources recovers the sources from a list built by joining
+// them with ","
+func splitConcatenatedSources(raw string) []string {
+	raw = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(raw), `["`), `"]`)
+	var sources []string
+	for _, source := range strings.Split(raw, `","`) {
+		if source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// backfillQuantityTerms indexes amounts in chunks stored before quantity
+// normalization existed. New chunks store an empty string, not NULL, so
+// this only touches old rows.
+func (ds *DatabaseSchema) backfillQuantityTerms() error {
+	rows, err := ds.DB.Query(`SELECT id, chunk_text FROM document_chunks WHERE quantity_terms IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to read chunks for quantity backfill: %w", err)
+	}
+
+	terms := make(map[string]string)
+	for rows.Next() {
+		var id, text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read chunk for quantity backfill: %w", err)
+		}
+		terms[id] = strings.Join(QuantityTerms(text), " ")
+	}
+	rows.Close()
+
+	for id, t := range terms {
+		if _, err := ds.DB.Exec(`UPDATE document_chunks SET quantity_terms = ? WHERE id = ?`, t, id); err != nil {
+			return fmt.Errorf("failed to backfill quantity terms: %w", err)
+		}
+	}
+	if len(terms) > 0 {
+		log.Printf("✅ Indexed quantities for %d existing chunks", len(terms))
+	}
+	return nil
+}
+
+// ensureColumn adds a column if it doesn't exist yet (MySQL has no ADD COLUMN IF NOT EXISTS)
+func (ds *DatabaseSchema) ensureColumn(table, column, definition string) error {
+	var count int
+	err := ds.DB.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+		table, column,
+	).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect column %s.%s: %w", table, column, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := ds.DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	log.Printf("✅ Added column %s.%s", table, column)
+	return nil
+}
+
+// ensureChunkVersionKey adds the unique (document_id, version, chunk_index)
+// key to chunk tables that predate it. Retried jobs could store a chunk
+// index twice under different ids, so those duplicates are dropped first,
+// keeping the earliest row.
+func (ds *DatabaseSchema) ensureChunkVersionKey() error {
+	var count int
+	err := ds.DB.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = 'document_chunks' AND index_name = 'uq_chunks_document_version'`,
+	).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect document_chunks indexes: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	result, err := ds.DB.Exec(`
+		DELETE later FROM document_chunks later
+		JOIN document_chunks earlier ON earlier.document_id = later.document_id
+			AND earlier.version = later.version AND earlier.chunk_index = later.chunk_index
+			AND (earlier.created_at < later.created_at OR (earlier.created_at = later.created_at AND earlier.id < later.id))`)
+	if err != nil {
+		return fmt.Errorf("failed to remove duplicate chunks: %w", err)
+	}
+	if removed, _ := result.RowsAffected(); removed > 0 {
+		log.Printf("✅ Removed %d duplicate chunks", removed)
+	}
+
+	if _, err := ds.DB.Exec(`ALTER TABLE document_chunks ADD UNIQUE KEY uq_chunks_document_version (document_id, version, chunk_index)`); err != nil {
+		return fmt.Errorf("failed to add uq_chunks_document_version: %w", err)
+	}
+	log.Println("✅ Added key uq_chunks_document_version")
+	return nil
+}
+
+// ensureEnumValue redefines an ENUM column as definition unless it already
+// allows value
+func (ds *DatabaseSchema) ensureEnumValue(table, column, value, definition string) error {
+	var columnType string
+	err := ds.DB.QueryRow(`
+		SELECT column_type FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+		table, column,
+	).Scan(&columnType)
+	if err != nil {
+		return fmt.Errorf("failed to inspect column %s.%s: %w", table, column, err)
+	}
+	if strings.Contains(columnType, "'"+value+"'") {
+		return nil
+	}
+
+	if _, err := ds.DB.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to allow %s in %s.%s: %w", value, table, column, err)
+	}
+	log.Printf("✅ Allowed %s in %s.%s", value, table, column)
+	return nil
+}
+
+// schemaIndexes lists the secondary indexes CreateTables defines, by table;
+// keep it in sync so GET /admin/diagnose can spot missing ones
+var schemaIndexes = map[string][]string{
+	"documents":             {"idx_documents_filename"},
+	"document_chunks":       {"uq_chunks_document_version"},
+	"chunk_embeddings":      nil,
+	"document_events":       {"idx_document_events_document"},
+	"document_queries":      nil,
+	"chat_sessions":         nil,
+	"chat_messages":         nil,
+	"corpus_summaries":      nil,
+	"reports":               nil,
+	"audit_log":             {"idx_audit_created", "idx_audit_actor", "idx_audit_action"},
+	"feature_flags":         nil,
+	"setting_overrides":     nil,
+	"widgets":               nil,
+	"api_tokens":            nil,
+	"corpus_snapshots":      {"idx_snapshots_created"},
+	"moderation_incidents":  {"idx_moderation_created"},
+	"api_usage":             {"idx_usage_period"},
+	"api_quotas":            nil,
+	"session_shares":        nil,
+	"collections":           nil,
+	"collection_members":    {"idx_collection_members_member"},
+	"notifications":         {"idx_notifications_recipient"},
+	"notification_settings": nil,
+	"saved_queries":         {"idx_saved_queries_owner", "idx_saved_queries_next_run"},
+	"schema_info":           nil,
+}
+
+// GetSchemaIndexes maps each table in the database to the names of its
+// indexes
+func (ds *DatabaseSchema) GetSchemaIndexes() (map[string]map[string]bool, error) {
+	tables := make(map[string]map[string]bool)
+
+	rows, err := ds.DB.Query(`SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables[table] = make(map[string]bool)
+	}
+	rows.Close()
+
+	rows, err = ds.DB.Query(`SELECT DISTINCT TABLE_NAME, INDEX_NAME FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, index string
+		if err := rows.Scan(&table, &index); err != nil {
+			return nil, err
+		}
+		if tables[table] != nil {
+			tables[table][index] = true
+		}
+	}
+
+	return tables, rows.Err()
+}
+
+// GetSchemaVersion returns the schema version recorded in the database
+func (ds *DatabaseSchema) GetSchemaVersion() (int, error) {
+	var version int
+	err := ds.DB.QueryRow(`SELECT version FROM schema_info WHERE id = 1`).Scan(&version)
+	return version, err
+}
+
 // GetAllDocuments retrieves all documents from the database
 func (ds *DatabaseSchema) GetAllDocuments() ([]DocumentRecord, error) {
-	query := `SELECT id, original_filename, status, created_at, updated_at FROM documents ORDER BY created_at DESC`
+	query := `SELECT id, original_filename, status, chunk_count, metadata, created_at, updated_at FROM documents ORDER BY created_at DESC`
 
 	rows, err := ds.DB.Query(query)
 	if err != nil {
@@ -110,7 +731,7 @@ func (ds *DatabaseSchema) GetAllDocuments() ([]DocumentRecord, error) {
 	var documents []DocumentRecord
 	for rows.Next() {
 		var doc DocumentRecord
-		err := rows.Scan(&doc.ID, &doc.OriginalFilename, &doc.Status, &doc.CreatedAt, &doc.UpdatedAt)
+		err := rows.Scan(&doc.ID, &doc.OriginalFilename, &doc.Status, &doc.ChunkCount, &doc.Metadata, &doc.CreatedAt, &doc.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -134,6 +755,18 @@ func (ds *DatabaseSchema) FlushAllData() error {
 		return fmt.Errorf("failed to delete chat sessions: %w", err)
 	}
 
+	// Delete all corpus summaries
+	_, err = ds.DB.Exec("DELETE FROM corpus_summaries")
+	if err != nil {
+		return fmt.Errorf("failed to delete corpus summaries: %w", err)
+	}
+
+	// Delete all reports
+	_, err = ds.DB.Exec("DELETE FROM reports")
+	if err != nil {
+		return fmt.Errorf("failed to delete reports: %w", err)
+	}
+
 	// Delete all document chunks
 	_, err = ds.DB.Exec("DELETE FROM document_chunks")
 	if err != nil {
@@ -152,46 +785,168 @@ func (ds *DatabaseSchema) FlushAllData() error {
 
 func (ds *DatabaseSchema) InsertDocument(doc *DocumentRecord) error {
 	query := `
-	INSERT INTO documents (id, filename, original_filename, file_size, status, chunk_count, metadata)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO documents (id, filename, original_filename, file_size, content_hash, status, chunk_count, storage_tier, metadata)
+	VALUES (?, ?, ?, ?, ?, ?, ?, COALESCE(NULLIF(?, ''), 'hot'), ?)
 	ON DUPLICATE KEY UPDATE
 		status = VALUES(status),
 		chunk_count = VALUES(chunk_count),
 		metadata = VALUES(metadata),
 		updated_at = CURRENT_TIMESTAMP`
 
-	_, err := ds.DB.Exec(query, doc.ID, doc.Filename, doc.OriginalFilename, doc.FileSize, doc.Status, doc.ChunkCount, doc.Metadata)
+	_, err := ds.DB.Exec(query, doc.ID, doc.Filename, doc.OriginalFilename, doc.FileSize, doc.ContentHash, doc.Status, doc.ChunkCount, doc.StorageTier, doc.Metadata)
 	return err
 }
 
+// InsertChunk stores a chunk, replacing the one already stored at the same
+// document, version and index, so a retried indexing run rewrites its chunks
+// instead of adding duplicates
 func (ds *DatabaseSchema) InsertChunk(chunk *ChunkRecord) error {
 	query := `
-	INSERT INTO document_chunks (id, document_id, chunk_text, page_number, chunk_index, word_count, metadata)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO document_chunks (id, document_id, chunk_text, page_number, chunk_index, version, word_count, language, script, chunk_type, quantity_terms, metadata)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(NULLIF(?, ''), 'text'), ?, ?)
 	ON DUPLICATE KEY UPDATE
 		chunk_text = VALUES(chunk_text),
+		page_number = VALUES(page_number),
+		word_count = VALUES(word_count),
+		language = VALUES(language),
+		script = VALUES(script),
+		chunk_type = VALUES(chunk_type),
+		quantity_terms = VALUES(quantity_terms),
+		synthetic_questions = NULL,
 		metadata = VALUES(metadata)`
 
-	_, err := ds.DB.Exec(query, chunk.ID, chunk.DocumentID, chunk.ChunkText, chunk.PageNumber, chunk.ChunkIndex, chunk.WordCount, chunk.Metadata)
+	_, err := ds.DB.Exec(query, chunk.ID, chunk.DocumentID, chunk.ChunkText, chunk.PageNumber, chunk.ChunkIndex, chunk.Version, chunk.WordCount, chunk.Language, chunk.Script, chunk.ChunkType, chunk.QuantityTerms, chunk.Metadata)
+	return err
+}
+
+// InsertChunkEmbedding stores a chunk's vector, replacing one made before
+func (ds *DatabaseSchema) InsertChunkEmbedding(chunkID, model string, vector []float32) error {
+	query := `
+	INSERT INTO chunk_embeddings (chunk_id, model, vector) VALUES (?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		model = VALUES(model),
+		vector = VALUES(vector),
+		created_at = CURRENT_TIMESTAMP`
+
+	_, err := ds.DB.Exec(query, chunkID, model, encodeVector(vector))
 	return err
 }
 
+// GetChunkEmbeddings returns the vectors model made for the chunks, by
+// chunk ID; chunks without one are left out
+func (ds *DatabaseSchema) GetChunkEmbeddings(chunkIDs []string, model string) (map[string][]float32, error) {
+	vectors := make(map[string][]float32, len(chunkIDs))
+	// Bound the IN list so a large corpus doesn't exceed placeholder limits
+	const batch = 1000
+	for start := 0; start < len(chunkIDs); start += batch {
+		end := start + batch
+		if end > len(chunkIDs) {
+			end = len(chunkIDs)
+		}
+		ids := chunkIDs[start:end]
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+		args := make([]interface{}, 0, len(ids)+1)
+		args = append(args, model)
+		for _, id := range ids {
+			args = append(args, id)
+		}
+
+		rows, err := ds.DB.Query(`SELECT chunk_id, vector FROM chunk_embeddings WHERE model = ? AND chunk_id IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			var data []byte
+			if err := rows.Scan(&id, &data); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			vectors[id] = decodeVector(data)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return vectors, nil
+}
+
+// GetChunkEmbeddingIDs returns the IDs of the chunks model has vectors for
+func (ds *DatabaseSchema) GetChunkEmbeddingIDs(model string) (map[string]bool, error) {
+	rows, err := ds.DB.Query(`SELECT chunk_id FROM chunk_embeddings WHERE model = ?`, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// GetChunksWithoutEmbedding returns up to limit committed chunks of
+// completed documents that model has no vector of dims dimensions for
+func (ds *DatabaseSchema) GetChunksWithoutEmbedding(model string, dims, limit int) ([]ChunkRecord, error) {
+	query := `SELECT c.id, c.document_id, c.chunk_text
+			  FROM document_chunks c JOIN documents d ON d.id = c.document_id AND c.version = d.chunk_version
+			  LEFT JOIN chunk_embeddings e ON e.chunk_id = c.id AND e.model = ? AND LENGTH(e.vector) = ?
+			  WHERE d.status = 'completed' AND e.chunk_id IS NULL
+			  ORDER BY d.created_at DESC, c.chunk_index ASC LIMIT ?`
+
+	rows, err := ds.DB.Query(query, model, dims*4, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []ChunkRecord
+	for rows.Next() {
+		var chunk ChunkRecord
+		if err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.ChunkText); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+// CountChunksWithoutEmbedding counts the committed chunks of completed
+// documents that model has no vector of dims dimensions for
+func (ds *DatabaseSchema) CountChunksWithoutEmbedding(model string, dims int) (int, error) {
+	query := `SELECT COUNT(*)
+			  FROM document_chunks c JOIN documents d ON d.id = c.document_id AND c.version = d.chunk_version
+			  LEFT JOIN chunk_embeddings e ON e.chunk_id = c.id AND e.model = ? AND LENGTH(e.vector) = ?
+			  WHERE d.status = 'completed' AND e.chunk_id IS NULL`
+
+	var count int
+	err := ds.DB.QueryRow(query, model, dims*4).Scan(&count)
+	return count, err
+}
+
 func (ds *DatabaseSchema) InsertQuery(query *QueryRecord) error {
 	sqlQuery := `
-	INSERT INTO document_queries (id, question, answer, confidence, sources, context)
-	VALUES (?, ?, ?, ?, ?, ?)`
+	INSERT INTO document_queries (id, question, answer, confidence, sources, context, context_format, corpus_version)
+	VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''))`
 
-	_, err := ds.DB.Exec(sqlQuery, query.ID, query.Question, query.Answer, query.Confidence, query.Sources, query.Context)
+	_, err := ds.DB.Exec(sqlQuery, query.ID, query.Question, query.Answer, query.Confidence, query.Sources, query.Context, query.ContextFormat, query.CorpusVersion)
 	return err
 }
 
 func (ds *DatabaseSchema) GetDocument(id string) (*DocumentRecord, error) {
-	query := `SELECT id, filename, original_filename, file_size, status, chunk_count, metadata, created_at, updated_at FROM documents WHERE id = ?`
+	query := `SELECT id, filename, original_filename, file_size, COALESCE(content_hash, ''), status, chunk_count, COALESCE(storage_tier, 'hot'), metadata, created_at, updated_at FROM documents WHERE id = ?`
 
 	var doc DocumentRecord
 	err := ds.DB.QueryRow(query, id).Scan(
-		&doc.ID, &doc.Filename, &doc.OriginalFilename, &doc.FileSize, &doc.Status,
-		&doc.ChunkCount, &doc.Metadata, &doc.CreatedAt, &doc.UpdatedAt,
+		&doc.ID, &doc.Filename, &doc.OriginalFilename, &doc.FileSize, &doc.ContentHash, &doc.Status,
+		&doc.ChunkCount, &doc.StorageTier, &doc.Metadata, &doc.CreatedAt, &doc.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -226,161 +981,2179 @@ func (ds *DatabaseSchema) GetDocuments(limit, offset int) ([]DocumentRecord, err
 	return documents, nil
 }
 
-func (ds *DatabaseSchema) UpdateDocumentStatus(id, status string) error {
-	query := `UPDATE documents SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err := ds.DB.Exec(query, status, id)
-	return err
+// DocumentFilter selects, sorts and pages documents for the library view
+type DocumentFilter struct {
+	Status string
+	Search string
+	SortBy string
+	Order  string
+	Limit  int
+	Offset int
+	// Before keeps documents created before it, unless zero
+	Before time.Time
+	// Tag keeps documents carrying the tag
+	Tag string
+	// HiddenCollections excludes documents in collections the caller can't read
+	HiddenCollections []string
+	// OnlyCollections, when set, keeps documents in these collections only
+	OnlyCollections []string
 }
 
-func (ds *DatabaseSchema) UpdateDocumentChunkCount(id string, count int) error {
-	query := `UPDATE documents SET chunk_count = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err := ds.DB.Exec(query, count, id)
-	return err
+// documentSortColumns whitelists sortable columns (they can't be bound as parameters)
+var documentSortColumns = map[string]string{
+	"created_at":  "created_at",
+	"updated_at":  "updated_at",
+	"filename":    "original_filename",
+	"file_size":   "file_size",
+	"chunk_count": "chunk_count",
+	"status":      "status",
 }
 
-func (ds *DatabaseSchema) GetQueries(limit, offset int) ([]QueryRecord, error) {
-	query := `SELECT id, question, answer, confidence, sources, context, created_at 
-			  FROM document_queries ORDER BY created_at DESC LIMIT ? OFFSET ?`
-
+// ListDocuments returns the documents matching the filter and the total match count
+func (ds *DatabaseSchema) ListDocuments(filter DocumentFilter) ([]DocumentRecord, int, error) {
+	where := "WHERE 1=1"
+	var args []interface{}
+	if filter.Status != "" {
+		where += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+	if filter.Search != "" {
+		where += " AND original_filename LIKE ?"
+		args = append(args, "%"+filter.Search+"%")
+	}
+	if !filter.Before.IsZero() {
+		where += " AND created_at < ?"
+		args = append(args, filter.Before)
+	}
+	if filter.Tag != "" {
+		where += " AND JSON_CONTAINS(COALESCE(JSON_EXTRACT(metadata, '$.tags'), JSON_ARRAY()), JSON_QUOTE(?))"
+		args = append(args, filter.Tag)
+	}
+	if len(filter.HiddenCollections) > 0 {
+		where += " AND COALESCE(JSON_UNQUOTE(JSON_EXTRACT(metadata, '$.collection')), '') NOT IN (?" + strings.Repeat(", ?", len(filter.HiddenCollections)-1) + ")"
+		for _, name := range filter.HiddenCollections {
+			args = append(args, name)
+		}
+	}
+	if len(filter.OnlyCollections) > 0 {
+		where += " AND COALESCE(JSON_UNQUOTE(JSON_EXTRACT(metadata, '$.collection')), '') IN (?" + strings.Repeat(", ?", len(filter.OnlyCollections)-1) + ")"
+		for _, name := range filter.OnlyCollections {
+			args = append(args, name)
+		}
+	}
+
+	var total int
+	if err := ds.DB.QueryRow("SELECT COUNT(*) FROM documents "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	sortColumn, ok := documentSortColumns[filter.SortBy]
+	if !ok {
+		sortColumn = "created_at"
+	}
+	order := "DESC"
+	if strings.ToLower(filter.Order) == "asc" {
+		order = "ASC"
+	}
+
+	query := `SELECT id, filename, original_filename, file_size, status, chunk_count, COALESCE(storage_tier, 'hot'), metadata, created_at, updated_at
+			  FROM documents ` + where + ` ORDER BY ` + sortColumn + ` ` + order + ` LIMIT ? OFFSET ?`
+
+	rows, err := ds.DB.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	documents := []DocumentRecord{}
+	for rows.Next() {
+		var doc DocumentRecord
+		err := rows.Scan(
+			&doc.ID, &doc.Filename, &doc.OriginalFilename, &doc.FileSize, &doc.Status,
+			&doc.ChunkCount, &doc.StorageTier, &doc.Metadata, &doc.CreatedAt, &doc.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		documents = append(documents, doc)
+	}
+
+	return documents, total, nil
+}
+
+// GetStorageUsage summarizes document counts and sizes by status
+func (ds *DatabaseSchema) GetStorageUsage() (*StorageUsage, error) {
+	rows, err := ds.DB.Query(`SELECT status, COUNT(*), COALESCE(SUM(file_size), 0), COALESCE(SUM(chunk_count), 0) FROM documents GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := &StorageUsage{ByStatus: map[string]int{}}
+	for rows.Next() {
+		var status string
+		var count, chunks int
+		var bytes int64
+		if err := rows.Scan(&status, &count, &bytes, &chunks); err != nil {
+			return nil, err
+		}
+		usage.ByStatus[status] = count
+		usage.Documents += count
+		usage.DocumentBytes += bytes
+		usage.Chunks += chunks
+	}
+
+	return usage, nil
+}
+
+// DeleteDocument removes a document; its chunks are removed by the foreign key cascade
+func (ds *DatabaseSchema) DeleteDocument(id string) error {
+	_, err := ds.DB.Exec(`DELETE FROM documents WHERE id = ?`, id)
+	return err
+}
+
+// InsertDocumentEvent records an event of a document
+func (ds *DatabaseSchema) InsertDocumentEvent(documentID, kind, message string) error {
+	_, err := ds.DB.Exec(`INSERT INTO document_events (document_id, kind, message) VALUES (?, ?, ?)`, documentID, kind, message)
+	return err
+}
+
+// GetDocumentEvents lists a document's events, oldest first
+func (ds *DatabaseSchema) GetDocumentEvents(documentID string) ([]DocumentEvent, error) {
+	rows, err := ds.DB.Query(`SELECT id, document_id, kind, message, created_at FROM document_events WHERE document_id = ? ORDER BY id`, documentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []DocumentEvent{}
+	for rows.Next() {
+		var e DocumentEvent
+		if err := rows.Scan(&e.ID, &e.DocumentID, &e.Kind, &e.Message, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (ds *DatabaseSchema) UpdateDocumentStatus(id, status string) error {
+	query := `UPDATE documents SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := ds.DB.Exec(query, status, id)
+	return err
+}
+
+// dbNow is the current time as timestamp columns hold it: UTC, to the
+// second
+func dbNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// formatTimestamp writes a timestamp as the API serializes them, ISO 8601
+// in UTC, for CSV and text output
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// StaleDocument is a document left in processing, e.g. by a crash mid-ingest
+type StaleDocument struct {
+	DocumentRecord
+	RecoveryAttempts int `json:"recovery_attempts"`
+}
+
+// GetStaleDocuments returns documents still processing that haven't been
+// updated for longer than olderThan
+func (ds *DatabaseSchema) GetStaleDocuments(olderThan time.Duration) ([]StaleDocument, error) {
+	query := `SELECT id, filename, original_filename, file_size, status, chunk_count, COALESCE(recovery_attempts, 0), created_at, updated_at
+			  FROM documents WHERE status = 'processing' AND updated_at < NOW() - INTERVAL ? SECOND ORDER BY updated_at`
+
+	rows, err := ds.DB.Query(query, int(olderThan.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var documents []StaleDocument
+	for rows.Next() {
+		var doc StaleDocument
+		err := rows.Scan(
+			&doc.ID, &doc.Filename, &doc.OriginalFilename, &doc.FileSize, &doc.Status,
+			&doc.ChunkCount, &doc.RecoveryAttempts, &doc.CreatedAt, &doc.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+
+	return documents, nil
+}
+
+// StartDocumentRecovery records a recovery attempt and deletes the partial
+// chunks the interrupted run left behind; the committed ones stay readable
+// until the new run replaces them
+func (ds *DatabaseSchema) StartDocumentRecovery(id string) error {
+	query := `DELETE FROM document_chunks WHERE document_id = ?
+			  AND version <> (SELECT chunk_version FROM documents WHERE id = ?)`
+	if _, err := ds.DB.Exec(query, id, id); err != nil {
+		return fmt.Errorf("failed to delete partial chunks: %w", err)
+	}
+	query = `UPDATE documents SET recovery_attempts = COALESCE(recovery_attempts, 0) + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := ds.DB.Exec(query, id); err != nil {
+		return fmt.Errorf("failed to record recovery attempt: %w", err)
+	}
+	return nil
+}
+
+// GetTieringCandidates returns completed documents whose originals are still
+// in the hot tier and haven't been created or downloaded for olderThan, by
+// them or by any document sharing the same object
+func (ds *DatabaseSchema) GetTieringCandidates(olderThan time.Duration) ([]DocumentRecord, error) {
+	query := `SELECT id, filename, original_filename, file_size, status, chunk_count, metadata, created_at, updated_at
+			  FROM documents
+			  WHERE status = 'completed' AND COALESCE(storage_tier, 'hot') = 'hot'
+			  AND COALESCE(last_accessed_at, created_at) < NOW() - INTERVAL ? SECOND
+			  AND NOT EXISTS (
+				  SELECT 1 FROM documents o WHERE o.filename = documents.filename AND o.id <> documents.id
+				  AND COALESCE(o.last_accessed_at, o.created_at) >= NOW() - INTERVAL ? SECOND
+			  )`
+
+	seconds := int(olderThan.Seconds())
+	rows, err := ds.DB.Query(query, seconds, seconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var documents []DocumentRecord
+	for rows.Next() {
+		var doc DocumentRecord
+		err := rows.Scan(
+			&doc.ID, &doc.Filename, &doc.OriginalFilename, &doc.FileSize, &doc.Status,
+			&doc.ChunkCount, &doc.Metadata, &doc.CreatedAt, &doc.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+
+	return documents, nil
+}
+
+// SetStorageTier records where an original PDF object lives, for every
+// document sharing it
+func (ds *DatabaseSchema) SetStorageTier(objectName, tier string) error {
+	_, err := ds.DB.Exec(`UPDATE documents SET storage_tier = ?, updated_at = updated_at WHERE filename = ?`, tier, objectName)
+	return err
+}
+
+// GetObjectTier returns the storage tier of an original PDF object, or ""
+// when no document references it
+func (ds *DatabaseSchema) GetObjectTier(objectName string) (string, error) {
+	var tier string
+	err := ds.DB.QueryRow(`SELECT COALESCE(storage_tier, 'hot') FROM documents WHERE filename = ? LIMIT 1`, objectName).Scan(&tier)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return tier, err
+}
+
+// RecordDocumentAccess stamps the documents retrieved for answers and those
+// downloaded with the current time, without changing updated_at. Downloads
+// also count as access for tiering.
+func (ds *DatabaseSchema) RecordDocumentAccess(retrieved, downloaded []string) error {
+	updates := []struct {
+		ids []string
+		set string
+	}{
+		{retrieved, "last_retrieved_at = CURRENT_TIMESTAMP"},
+		{downloaded, "last_downloaded_at = CURRENT_TIMESTAMP, last_accessed_at = CURRENT_TIMESTAMP"},
+	}
+	// Bound the IN list so a busy interval doesn't exceed placeholder limits
+	const batch = 1000
+	for _, update := range updates {
+		for start := 0; start < len(update.ids); start += batch {
+			end := start + batch
+			if end > len(update.ids) {
+				end = len(update.ids)
+			}
+			ids := update.ids[start:end]
+			placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+			args := make([]interface{}, 0, len(ids))
+			for _, id := range ids {
+				args = append(args, id)
+			}
+
+			query := `UPDATE documents SET ` + update.set + `, updated_at = updated_at WHERE id IN (` + placeholders + `)`
+			if _, err := ds.DB.Exec(query, args...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetColdDocuments returns completed documents never retrieved or, when
+// unusedFor is positive, last retrieved longer ago than that, least
+// recently used first
+func (ds *DatabaseSchema) GetColdDocuments(unusedFor time.Duration) ([]ColdDocument, error) {
+	query := `SELECT id, original_filename, file_size, chunk_count, COALESCE(storage_tier, 'hot'), created_at,
+			  last_retrieved_at, last_downloaded_at
+			  FROM documents
+			  WHERE status = 'completed'
+			  AND (last_retrieved_at IS NULL OR (? > 0 AND last_retrieved_at < NOW() - INTERVAL ? SECOND))
+			  ORDER BY last_retrieved_at IS NOT NULL, COALESCE(last_retrieved_at, created_at) ASC`
+
+	seconds := int(unusedFor.Seconds())
+	rows, err := ds.DB.Query(query, seconds, seconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var documents []ColdDocument
+	for rows.Next() {
+		var doc ColdDocument
+		err := rows.Scan(&doc.DocumentID, &doc.Filename, &doc.FileSize, &doc.ChunkCount, &doc.StorageTier, &doc.CreatedAt,
+			&doc.LastRetrievedAt, &doc.LastDownloadedAt)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
+}
+
+// NextChunkVersion allocates the version an indexing run stores a
+// document's chunks under. Versions are never reused, so a retried run can't
+// mix its chunks with those of the run it replaces.
+func (ds *DatabaseSchema) NextChunkVersion(id string) (int, error) {
+	result, err := ds.DB.Exec(`UPDATE documents SET chunk_version_seq = LAST_INSERT_ID(GREATEST(chunk_version_seq, chunk_version) + 1) WHERE id = ?`, id)
+	if err != nil {
+		return 0, err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return 0, sql.ErrNoRows
+	}
+	version, err := result.LastInsertId()
+	return int(version), err
+}
+
+// CommitChunkVersion makes a finished run's chunks the ones reads see, in
+// one transaction with the document's chunk count and status, and deletes
+// the versions it replaces. It returns false, deleting the run's chunks
+// instead, when a later run has committed already.
+func (ds *DatabaseSchema) CommitChunkVersion(id string, version, count int, status string) (bool, error) {
+	tx, err := ds.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE documents SET chunk_version = ?, chunk_count = ?, status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND chunk_version < ?`, version, count, status, id, version)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if affected == 0 {
+		_, err = tx.Exec(`DELETE FROM document_chunks WHERE document_id = ? AND version = ?`, id, version)
+	} else {
+		_, err = tx.Exec(`DELETE FROM document_chunks WHERE document_id = ? AND version < ?`, id, version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, tx.Commit()
+}
+
+// DeleteChunkVersion removes the chunks a failed run stored
+func (ds *DatabaseSchema) DeleteChunkVersion(id string, version int) error {
+	_, err := ds.DB.Exec(`DELETE FROM document_chunks WHERE document_id = ? AND version = ?`, id, version)
+	return err
+}
+
+// UpdateDocumentSize records the size of a document whose text arrived in
+// parts
+func (ds *DatabaseSchema) UpdateDocumentSize(id string, size int64) error {
+	_, err := ds.DB.Exec(`UPDATE documents SET file_size = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, size, id)
+	return err
+}
+
+func (ds *DatabaseSchema) UpdateDocumentChunkCount(id string, count int) error {
+	query := `UPDATE documents SET chunk_count = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := ds.DB.Exec(query, count, id)
+	return err
+}
+
+// UpdateDocumentsMetadata rewrites the metadata of the given documents with
+// apply inside one transaction. It fails with *MissingDocumentsError, changing
+// nothing, if any document does not exist.
+func (ds *DatabaseSchema) UpdateDocumentsMetadata(ids []string, apply func(metadata string) (string, error)) error {
+	tx, err := ds.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := tx.Query(`SELECT id, COALESCE(metadata, '{}') FROM documents WHERE id IN (`+placeholders+`) FOR UPDATE`, args...)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]string, len(ids))
+	for rows.Next() {
+		var id, metadata string
+		if err := rows.Scan(&id, &metadata); err != nil {
+			rows.Close()
+			return err
+		}
+		current[id] = metadata
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if _, ok := current[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingDocumentsError{IDs: missing}
+	}
+
+	for _, id := range ids {
+		metadata, err := apply(current[id])
+		if err != nil {
+			return fmt.Errorf("document %s: %w", id, err)
+		}
+		if _, err := tx.Exec(`UPDATE documents SET metadata = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, metadata, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ds *DatabaseSchema) GetQueries(limit, offset int) ([]QueryRecord, error) {
+	query := `SELECT id, question, answer, confidence, sources, context, COALESCE(context_format, ''), COALESCE(corpus_version, ''), COALESCE(rating, 0), created_at
+			  FROM document_queries ORDER BY created_at DESC LIMIT ? OFFSET ?`
+
+	rows, err := ds.DB.Query(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queries []QueryRecord
+	for rows.Next() {
+		var q QueryRecord
+		err := rows.Scan(
+			&q.ID, &q.Question, &q.Answer, &q.Confidence, &q.Sources, &q.Context, &q.ContextFormat, &q.CorpusVersion, &q.Rating, &q.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+
+	return queries, nil
+}
+
+// RateQuery records a stored query's rating: 1 approves the answer, -1
+// rejects it and 0 clears the rating. It returns sql.ErrNoRows for unknown
+// queries.
+func (ds *DatabaseSchema) RateQuery(id string, rating int) error {
+	result, err := ds.DB.Exec(`UPDATE document_queries SET rating = NULLIF(?, 0) WHERE id = ?`, rating, id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		var exists int
+		return ds.DB.QueryRow(`SELECT 1 FROM document_queries WHERE id = ?`, id).Scan(&exists)
+	}
+	return nil
+}
+
+// Chat session management methods
+func (ds *DatabaseSchema) CreateChatSession(title, language string) (*ChatSession, error) {
+	sessionID := fmt.Sprintf("session_%d", time.Now().UnixNano())
+
+	session := &ChatSession{
+		ID:        sessionID,
+		Title:     title,
+		Language:  language,
+		CreatedAt: dbNow(),
+		UpdatedAt: dbNow(),
+	}
+
+	query := `INSERT INTO chat_sessions (id, title, language) VALUES (?, ?, NULLIF(?, ''))`
+	_, err := ds.DB.Exec(query, session.ID, session.Title, session.Language)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetQuery returns a stored query by id
+func (ds *DatabaseSchema) GetQuery(id string) (*QueryRecord, error) {
+	query := `SELECT id, question, answer, confidence, sources, context, COALESCE(context_format, ''), COALESCE(corpus_version, ''), COALESCE(rating, 0), created_at
+			  FROM document_queries WHERE id = ?`
+
+	var q QueryRecord
+	err := ds.DB.QueryRow(query, id).Scan(&q.ID, &q.Question, &q.Answer, &q.Confidence, &q.Sources, &q.Context, &q.ContextFormat, &q.CorpusVersion, &q.Rating, &q.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// SearchQueries returns the latest stored queries whose question or answer
+// contains any of the terms, newest first
+func (ds *DatabaseSchema) SearchQueries(terms []string, limit int) ([]QueryRecord, error) {
+	conditions, args := likeAny(terms, "question", "answer")
+	query := `SELECT id, question, answer, confidence, sources, context, COALESCE(context_format, ''), COALESCE(corpus_version, ''), COALESCE(rating, 0), created_at
+			  FROM document_queries WHERE ` + conditions + ` ORDER BY created_at DESC LIMIT ?`
+
+	rows, err := ds.DB.Query(query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queries []QueryRecord
+	for rows.Next() {
+		var q QueryRecord
+		if err := rows.Scan(&q.ID, &q.Question, &q.Answer, &q.Confidence, &q.Sources, &q.Context, &q.ContextFormat, &q.CorpusVersion, &q.Rating, &q.CreatedAt); err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	return queries, rows.Err()
+}
+
+// SearchChatMessages returns the latest chat messages containing any of the
+// terms, newest first
+func (ds *DatabaseSchema) SearchChatMessages(terms []string, limit int) ([]ChatMessage, error) {
+	conditions, args := likeAny(terms, "content")
+	query := `SELECT id, session_id, role, content, sources, confidence, COALESCE(corpus_version, ''), created_at
+			  FROM chat_messages WHERE ` + conditions + ` ORDER BY created_at DESC LIMIT ?`
+
+	rows, err := ds.DB.Query(query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ChatMessage
+	for rows.Next() {
+		var msg ChatMessage
+		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.Sources, &msg.Confidence, &msg.CorpusVersion, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// likeAny builds a condition matching rows where any of the columns
+// contains any of the terms; with no terms it matches nothing
+func likeAny(terms []string, columns ...string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	for _, term := range terms {
+		for _, column := range columns {
+			conditions = append(conditions, column+" LIKE ?")
+			args = append(args, "%"+term+"%")
+		}
+	}
+	if len(conditions) == 0 {
+		return "1=0", nil
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+func (ds *DatabaseSchema) GetChatSessions(limit, offset int) ([]ChatSession, error) {
+	query := `SELECT id, title, COALESCE(language, ''), created_at, updated_at FROM chat_sessions ORDER BY updated_at DESC LIMIT ? OFFSET ?`
+
+	rows, err := ds.DB.Query(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []ChatSession
+	for rows.Next() {
+		var session ChatSession
+		err := rows.Scan(&session.ID, &session.Title, &session.Language, &session.CreatedAt, &session.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (ds *DatabaseSchema) GetChatSession(sessionID string) (*ChatSession, error) {
+	query := `SELECT id, title, COALESCE(language, ''), created_at, updated_at FROM chat_sessions WHERE id = ?`
+
+	var session ChatSession
+	err := ds.DB.QueryRow(query, sessionID).Scan(&session.ID, &session.Title, &session.Language, &session.CreatedAt, &session.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (ds *DatabaseSchema) UpdateChatSession(sessionID, title string) error {
+	query := `UPDATE chat_sessions SET title = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := ds.DB.Exec(query, title, sessionID)
+	return err
+}
+
+func (ds *DatabaseSchema) UpdateChatSessionLanguage(sessionID, language string) error {
+	query := `UPDATE chat_sessions SET language = NULLIF(?, ''), updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := ds.DB.Exec(query, language, sessionID)
+	return err
+}
+
+func (ds *DatabaseSchema) DeleteChatSession(sessionID string) error {
+	query := `DELETE FROM chat_sessions WHERE id = ?`
+	_, err := ds.DB.Exec(query, sessionID)
+	return err
+}
+
+// AddChatMessage stores a message; corpusVersion is the corpus an assistant
+// answer was given against, empty for user messages
+// AddChatMessage stores a message in a session and returns its id
+func (ds *DatabaseSchema) AddChatMessage(sessionID, role, content string, sources []string, confidence float64, corpusVersion string, context StoredContext) (string, error) {
+	messageID := fmt.Sprintf("msg_%d", time.Now().UnixNano())
+
+	query := `INSERT INTO chat_messages (id, session_id, role, content, sources, context, context_format, confidence, corpus_version)
+			  VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''))`
+	if _, err := ds.DB.Exec(query, messageID, sessionID, role, content, EncodeSources(sources), context.Data, context.Format, confidence, corpusVersion); err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
+
+// GetChatMessageContexts returns the stored retrieval contexts of a
+// session's messages, by message id
+func (ds *DatabaseSchema) GetChatMessageContexts(sessionID string) (map[string]StoredContext, error) {
+	rows, err := ds.DB.Query(`SELECT id, context, COALESCE(context_format, '') FROM chat_messages
+		WHERE session_id = ? AND context IS NOT NULL`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contexts := make(map[string]StoredContext)
+	for rows.Next() {
+		var id string
+		var context StoredContext
+		if err := rows.Scan(&id, &context.Data, &context.Format); err != nil {
+			return nil, err
+		}
+		contexts[id] = context
+	}
+	return contexts, rows.Err()
+}
+
+// GetFullContexts returns up to limit non-empty contexts stored in full in
+// table, document_queries or chat_messages, by row id
+func (ds *DatabaseSchema) GetFullContexts(table string, limit int) (map[string]string, error) {
+	if table != "document_queries" && table != "chat_messages" {
+		return nil, fmt.Errorf("table %s doesn't store contexts", table)
+	}
+	rows, err := ds.DB.Query(`SELECT id, context FROM `+table+`
+		WHERE COALESCE(context_format, 'full') = 'full' AND COALESCE(context, '') <> '' LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contexts := make(map[string]string)
+	for rows.Next() {
+		var id, context string
+		if err := rows.Scan(&id, &context); err != nil {
+			return nil, err
+		}
+		contexts[id] = context
+	}
+	return contexts, rows.Err()
+}
+
+// SetStoredContext replaces the context stored by a row of table,
+// document_queries or chat_messages
+func (ds *DatabaseSchema) SetStoredContext(table, id string, context StoredContext) error {
+	if table != "document_queries" && table != "chat_messages" {
+		return fmt.Errorf("table %s doesn't store contexts", table)
+	}
+	_, err := ds.DB.Exec(`UPDATE `+table+` SET context = ?, context_format = NULLIF(?, '') WHERE id = ?`, context.Data, context.Format, id)
+	return err
+}
+
+// RecentChatMessages returns a session's latest limit messages, newest
+// first. Message ids order messages stored within the same second.
+func (ds *DatabaseSchema) RecentChatMessages(sessionID string, limit int) ([]ChatMessage, error) {
+	query := `SELECT id, session_id, role, content, sources, confidence, COALESCE(corpus_version, ''), created_at
+			  FROM chat_messages WHERE session_id = ? ORDER BY created_at DESC, id DESC LIMIT ?`
+
+	rows, err := ds.DB.Query(query, sessionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ChatMessage
+	for rows.Next() {
+		var msg ChatMessage
+		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.Sources, &msg.Confidence, &msg.CorpusVersion, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func (ds *DatabaseSchema) GetChatMessages(sessionID string, limit, offset int) ([]ChatMessage, error) {
+	query := `SELECT id, session_id, role, content, sources, confidence, COALESCE(corpus_version, ''), created_at
+			  FROM chat_messages WHERE session_id = ? ORDER BY created_at ASC LIMIT ? OFFSET ?`
+
+	rows, err := ds.DB.Query(query, sessionID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ChatMessage
+	for rows.Next() {
+		var msg ChatMessage
+		err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.Sources, &msg.Confidence, &msg.CorpusVersion, &msg.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func (ds *DatabaseSchema) GetChunksByDocument(documentID string, limit, offset int) ([]ChunkRecord, error) {
+	query := `SELECT id, document_id, chunk_text, page_number, chunk_index, word_count,
+			  COALESCE(language, ''), COALESCE(script, ''), COALESCE(chunk_type, 'text'),
+			  COALESCE(quantity_terms, ''), COALESCE(synthetic_questions, ''), metadata, created_at
+			  FROM document_chunks WHERE document_id = ? AND version = (SELECT chunk_version FROM documents WHERE documents.id = document_chunks.document_id)
+			  ORDER BY chunk_index ASC LIMIT ? OFFSET ?`
+
+	rows, err := ds.DB.Query(query, documentID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []ChunkRecord
+	for rows.Next() {
+		var chunk ChunkRecord
+		err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.ChunkText, &chunk.PageNumber, &chunk.ChunkIndex, &chunk.WordCount, &chunk.Language, &chunk.Script, &chunk.ChunkType, &chunk.QuantityTerms, &chunk.SyntheticQuestions, &chunk.Metadata, &chunk.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// GetChunk returns a chunk by id
+func (ds *DatabaseSchema) GetChunk(id string) (*ChunkRecord, error) {
+	query := `SELECT id, document_id, chunk_text, page_number, chunk_index, word_count,
+			  COALESCE(language, ''), COALESCE(script, ''), COALESCE(chunk_type, 'text'),
+			  COALESCE(quantity_terms, ''), COALESCE(synthetic_questions, ''), metadata, created_at
+			  FROM document_chunks WHERE id = ? AND version = (SELECT chunk_version FROM documents WHERE documents.id = document_chunks.document_id)`
+
+	var chunk ChunkRecord
+	err := ds.DB.QueryRow(query, id).Scan(&chunk.ID, &chunk.DocumentID, &chunk.ChunkText, &chunk.PageNumber, &chunk.ChunkIndex, &chunk.WordCount, &chunk.Language, &chunk.Script, &chunk.ChunkType, &chunk.QuantityTerms, &chunk.SyntheticQuestions, &chunk.Metadata, &chunk.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &chunk, nil
+}
+
+// GetChunksWithoutQuestions returns up to limit committed text chunks of
+// completed documents that have no synthetic questions generated yet
+func (ds *DatabaseSchema) GetChunksWithoutQuestions(limit int) ([]ChunkRecord, error) {
+	query := `SELECT c.id, c.document_id, c.chunk_text, c.page_number, c.chunk_index, COALESCE(c.language, '')
+			  FROM document_chunks c JOIN documents d ON d.id = c.document_id AND c.version = d.chunk_version
+			  WHERE d.status = 'completed' AND c.synthetic_questions IS NULL AND COALESCE(c.chunk_type, 'text') = 'text'
+			  ORDER BY d.created_at DESC, c.chunk_index ASC LIMIT ?`
+
+	rows, err := ds.DB.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []ChunkRecord
+	for rows.Next() {
+		var chunk ChunkRecord
+		if err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.ChunkText, &chunk.PageNumber, &chunk.ChunkIndex, &chunk.Language); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+// SetChunkQuestions stores a chunk's synthetic questions, one per line
+func (ds *DatabaseSchema) SetChunkQuestions(chunkID string, questions []string) error {
+	_, err := ds.DB.Exec(`UPDATE document_chunks SET synthetic_questions = ? WHERE id = ?`, strings.Join(questions, "\n"), chunkID)
+	return err
+}
+
+// GetChunksByIDs returns the chunks with the given ids, by id, whatever
+// their version; ids of deleted chunks are left out
+func (ds *DatabaseSchema) GetChunksByIDs(ids []string) (map[string]ChunkRecord, error) {
+	chunks := make(map[string]ChunkRecord, len(ids))
+	if len(ids) == 0 {
+		return chunks, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	query := `SELECT id, document_id, chunk_text, page_number, chunk_index, word_count,
+			  COALESCE(language, ''), COALESCE(script, ''), COALESCE(chunk_type, 'text'),
+			  COALESCE(quantity_terms, ''), COALESCE(synthetic_questions, ''), metadata, created_at
+			  FROM document_chunks WHERE id IN (` + placeholders + `)`
+
+	rows, err := ds.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chunk ChunkRecord
+		err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.ChunkText, &chunk.PageNumber, &chunk.ChunkIndex, &chunk.WordCount,
+			&chunk.Language, &chunk.Script, &chunk.ChunkType, &chunk.QuantityTerms, &chunk.SyntheticQuestions, &chunk.Metadata, &chunk.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		chunks[chunk.ID] = chunk
+	}
+	return chunks, rows.Err()
+}
+
+// GetChunkRange returns a document's chunks with indexes from first to last
+func (ds *DatabaseSchema) GetChunkRange(documentID string, first, last int) ([]ChunkRecord, error) {
+	query := `SELECT id, document_id, chunk_text, page_number, chunk_index, word_count,
+			  COALESCE(language, ''), COALESCE(script, ''), COALESCE(chunk_type, 'text'),
+			  COALESCE(quantity_terms, ''), COALESCE(synthetic_questions, ''), metadata, created_at
+			  FROM document_chunks WHERE document_id = ? AND chunk_index BETWEEN ? AND ?
+			  AND version = (SELECT chunk_version FROM documents WHERE documents.id = document_chunks.document_id)
+			  ORDER BY chunk_index ASC`
+
+	rows, err := ds.DB.Query(query, documentID, first, last)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []ChunkRecord
+	for rows.Next() {
+		var chunk ChunkRecord
+		err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.ChunkText, &chunk.PageNumber, &chunk.ChunkIndex, &chunk.WordCount, &chunk.Language, &chunk.Script, &chunk.ChunkType, &chunk.QuantityTerms, &chunk.SyntheticQuestions, &chunk.Metadata, &chunk.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, rows.Err()
+}
+
+// GetCorpusLanguages counts chunks per detected language, most common first
+func (ds *DatabaseSchema) GetCorpusLanguages() ([]LanguageCount, error) {
+	query := `SELECT language, COUNT(*) FROM document_chunks
+			  WHERE language IS NOT NULL AND language <> ''
+			  AND version = (SELECT chunk_version FROM documents WHERE documents.id = document_chunks.document_id)
+			  GROUP BY language ORDER BY COUNT(*) DESC`
+
+	rows, err := ds.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var languages []LanguageCount
+	for rows.Next() {
+		var l LanguageCount
+		if err := rows.Scan(&l.Language, &l.Chunks); err != nil {
+			return nil, err
+		}
+		languages = append(languages, l)
+	}
+
+	return languages, nil
+}
+
+// Corpus summary methods
+func (ds *DatabaseSchema) InsertSummary(summary *SummaryRecord) error {
+	query := `INSERT INTO corpus_summaries (id, status, document_ids, total_steps) VALUES (?, ?, ?, ?)`
+	_, err := ds.DB.Exec(query, summary.ID, summary.Status, summary.DocumentIDs, summary.TotalSteps)
+	return err
+}
+
+func (ds *DatabaseSchema) UpdateSummaryProgress(id string, completed, total int) error {
+	query := `UPDATE corpus_summaries SET completed_steps = ?, total_steps = ? WHERE id = ?`
+	_, err := ds.DB.Exec(query, completed, total, id)
+	return err
+}
+
+func (ds *DatabaseSchema) CompleteSummary(id, summary string) error {
+	query := `UPDATE corpus_summaries SET status = 'completed', completed_steps = total_steps, summary = ? WHERE id = ?`
+	_, err := ds.DB.Exec(query, summary, id)
+	return err
+}
+
+func (ds *DatabaseSchema) FailSummary(id, message string) error {
+	query := `UPDATE corpus_summaries SET status = 'failed', error = ? WHERE id = ?`
+	_, err := ds.DB.Exec(query, message, id)
+	return err
+}
+
+func (ds *DatabaseSchema) GetSummary(id string) (*SummaryRecord, error) {
+	query := `SELECT id, status, COALESCE(document_ids, 'null'), completed_steps, total_steps,
+			  COALESCE(summary, ''), COALESCE(error, ''), created_at, updated_at
+			  FROM corpus_summaries WHERE id = ?`
+
+	var summary SummaryRecord
+	err := ds.DB.QueryRow(query, id).Scan(
+		&summary.ID, &summary.Status, &summary.DocumentIDs, &summary.CompletedSteps, &summary.TotalSteps,
+		&summary.Summary, &summary.Error, &summary.CreatedAt, &summary.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &summary, nil
+}
+
+// GetSummaries lists summaries newest first, without the summary text
+func (ds *DatabaseSchema) GetSummaries(limit, offset int) ([]SummaryRecord, error) {
+	query := `SELECT id, status, COALESCE(document_ids, 'null'), completed_steps, total_steps,
+			  COALESCE(error, ''), created_at, updated_at
+			  FROM corpus_summaries ORDER BY created_at DESC LIMIT ? OFFSET ?`
+
+	rows, err := ds.DB.Query(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []SummaryRecord
+	for rows.Next() {
+		var summary SummaryRecord
+		err := rows.Scan(
+			&summary.ID, &summary.Status, &summary.DocumentIDs, &summary.CompletedSteps, &summary.TotalSteps,
+			&summary.Error, &summary.CreatedAt, &summary.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// Report methods
+func (ds *DatabaseSchema) InsertReport(report *ReportRecord) error {
+	query := `INSERT INTO reports (id, title, status, questions, total_steps) VALUES (?, ?, ?, ?, ?)`
+	_, err := ds.DB.Exec(query, report.ID, report.Title, report.Status, report.Questions, report.TotalSteps)
+	return err
+}
+
+func (ds *DatabaseSchema) UpdateReportProgress(id string, completed int) error {
+	query := `UPDATE reports SET completed_steps = ? WHERE id = ?`
+	_, err := ds.DB.Exec(query, completed, id)
+	return err
+}
+
+func (ds *DatabaseSchema) CompleteReport(id, markdownObject, pdfObject string) error {
+	query := `UPDATE reports SET status = 'completed', completed_steps = total_steps,
+			  markdown_object = ?, pdf_object = NULLIF(?, '') WHERE id = ?`
+	_, err := ds.DB.Exec(query, markdownObject, pdfObject, id)
+	return err
+}
+
+func (ds *DatabaseSchema) FailReport(id, message string) error {
+	query := `UPDATE reports SET status = 'failed', error = ? WHERE id = ?`
+	_, err := ds.DB.Exec(query, message, id)
+	return err
+}
+
+const reportColumns = `id, title, status, COALESCE(questions, '[]'), completed_steps, total_steps,
+	COALESCE(markdown_object, ''), COALESCE(pdf_object, ''), COALESCE(error, ''), created_at, updated_at`
+
+func scanReport(scanner interface{ Scan(...interface{}) error }) (*ReportRecord, error) {
+	var report ReportRecord
+	err := scanner.Scan(
+		&report.ID, &report.Title, &report.Status, &report.Questions, &report.CompletedSteps, &report.TotalSteps,
+		&report.MarkdownObject, &report.PDFObject, &report.Error, &report.CreatedAt, &report.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (ds *DatabaseSchema) GetReport(id string) (*ReportRecord, error) {
+	return scanReport(ds.DB.QueryRow(`SELECT `+reportColumns+` FROM reports WHERE id = ?`, id))
+}
+
+func (ds *DatabaseSchema) GetReports(limit, offset int) ([]ReportRecord, error) {
+	rows, err := ds.DB.Query(`SELECT `+reportColumns+` FROM reports ORDER BY created_at DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []ReportRecord
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+
+	return reports, nil
+}
+
+// Audit log methods
+func (ds *DatabaseSchema) InsertAuditEntry(entry *AuditEntry) error {
+	query := `INSERT INTO audit_log (actor, action, resource, details, ip, status_code) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := ds.DB.Exec(query, entry.Actor, entry.Action, entry.Resource, entry.Details, entry.IP, entry.StatusCode)
+	return err
+}
+
+// AuditFilter narrows an audit log search; zero values match everything
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Search string
+	From   string
+	To     string
+	Limit  int
+	Offset int
+}
+
+// SearchAuditLog returns matching entries newest first plus the total match count
+func (ds *DatabaseSchema) SearchAuditLog(filter AuditFilter) ([]AuditEntry, int, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, "(resource LIKE ? OR details LIKE ?)")
+		args = append(args, "%"+filter.Search+"%", "%"+filter.Search+"%")
+	}
+	if filter.From != "" {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, filter.To)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := ds.DB.QueryRow("SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, actor, action, COALESCE(resource, ''), COALESCE(details, ''), COALESCE(ip, ''),
+			  COALESCE(status_code, 0), created_at FROM audit_log` + where + ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	rows, err := ds.DB.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		err := rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entry.Resource, &entry.Details, &entry.IP, &entry.StatusCode, &entry.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, total, nil
+}
+
+// ChunkCountDrift is a document whose stored chunk_count disagrees with
+// its rows in document_chunks
+type ChunkCountDrift struct {
+	DocumentID string `json:"document_id"`
+	Filename   string `json:"filename"`
+	Status     string `json:"status"`
+	Stored     int    `json:"stored"`
+	Actual     int    `json:"actual"`
+}
+
+// GetChunkCountDrift compares chunk_count with the chunks actually stored.
+// Documents still processing are skipped since their count isn't final.
+func (ds *DatabaseSchema) GetChunkCountDrift() ([]ChunkCountDrift, int, error) {
+	query := `SELECT d.id, d.original_filename, d.status, d.chunk_count, COUNT(c.id)
+			  FROM documents d LEFT JOIN document_chunks c ON c.document_id = d.id AND c.version = d.chunk_version
+			  WHERE d.status <> 'processing'
+			  GROUP BY d.id, d.original_filename, d.status, d.chunk_count`
+
+	rows, err := ds.DB.Query(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var drift []ChunkCountDrift
+	checked := 0
+	for rows.Next() {
+		var d ChunkCountDrift
+		if err := rows.Scan(&d.DocumentID, &d.Filename, &d.Status, &d.Stored, &d.Actual); err != nil {
+			return nil, 0, err
+		}
+		checked++
+		if d.Stored != d.Actual {
+			drift = append(drift, d)
+		}
+	}
+
+	return drift, checked, nil
+}
+
+// DocumentHealth is a document with totals over its committed chunks
+type DocumentHealth struct {
+	ID          string
+	Filename    string
+	Status      string
+	FileSize    int64
+	ContentHash string
+	ChunkCount  int
+	Metadata    string
+	CreatedAt   time.Time
+	// Words sums the chunks' word counts; Pages counts the pages with a
+	// chunk and LastPage is the highest of them
+	Words    int
+	Pages    int
+	LastPage int
+}
+
+// GetDocumentHealth lists every document with its chunk totals, oldest
+// first
+func (ds *DatabaseSchema) GetDocumentHealth() ([]DocumentHealth, error) {
+	query := `SELECT d.id, d.original_filename, d.status, d.file_size, COALESCE(d.content_hash, ''), d.chunk_count,
+			  COALESCE(d.metadata, '{}'), d.created_at,
+			  COALESCE(SUM(c.word_count), 0), COUNT(DISTINCT c.page_number), COALESCE(MAX(c.page_number), 0)
+			  FROM documents d LEFT JOIN document_chunks c ON c.document_id = d.id AND c.version = d.chunk_version
+			  GROUP BY d.id, d.original_filename, d.status, d.file_size, d.content_hash, d.chunk_count, d.metadata, d.created_at
+			  ORDER BY d.created_at ASC`
+
+	rows, err := ds.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var documents []DocumentHealth
+	for rows.Next() {
+		var d DocumentHealth
+		err := rows.Scan(&d.ID, &d.Filename, &d.Status, &d.FileSize, &d.ContentHash, &d.ChunkCount,
+			&d.Metadata, &d.CreatedAt, &d.Words, &d.Pages, &d.LastPage)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, d)
+	}
+	return documents, rows.Err()
+}
+
+// GetAnswerSources returns the JSON source list of every stored answer and
+// assistant chat message
+func (ds *DatabaseSchema) GetAnswerSources() ([]string, error) {
+	rows, err := ds.DB.Query(`SELECT sources FROM document_queries WHERE sources IS NOT NULL
+		UNION ALL SELECT sources FROM chat_messages WHERE sources IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []string
+	for rows.Next() {
+		var sources string
+		if err := rows.Scan(&sources); err != nil {
+			return nil, err
+		}
+		lists = append(lists, sources)
+	}
+	return lists, rows.Err()
+}
+
+// WordCountDrift is a chunk whose stored word_count disagrees with its text
+type WordCountDrift struct {
+	ChunkID    string `json:"chunk_id"`
+	DocumentID string `json:"document_id"`
+	Stored     int    `json:"stored"`
+	Actual     int    `json:"actual"`
+}
+
+// GetWordCountDrift recounts the words of every chunk
+func (ds *DatabaseSchema) GetWordCountDrift() ([]WordCountDrift, int, error) {
+	rows, err := ds.DB.Query(`SELECT id, document_id, chunk_text, COALESCE(word_count, 0) FROM document_chunks
+		WHERE version = (SELECT chunk_version FROM documents WHERE documents.id = document_chunks.document_id)`)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var drift []WordCountDrift
+	checked := 0
+	for rows.Next() {
+		var d WordCountDrift
+		var text string
+		if err := rows.Scan(&d.ChunkID, &d.DocumentID, &text, &d.Stored); err != nil {
+			return nil, 0, err
+		}
+		checked++
+		d.Actual = len(strings.Fields(text))
+		if d.Stored != d.Actual {
+			drift = append(drift, d)
+		}
+	}
+
+	return drift, checked, nil
+}
+
+func (ds *DatabaseSchema) UpdateChunkWordCount(id string, count int) error {
+	_, err := ds.DB.Exec(`UPDATE document_chunks SET word_count = ? WHERE id = ?`, count, id)
+	return err
+}
+
+// GetFeatureFlags returns the admin feature flag overrides
+func (ds *DatabaseSchema) GetFeatureFlags() (map[string]bool, error) {
+	rows, err := ds.DB.Query(`SELECT name, enabled FROM feature_flags`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		var enabled bool
+		if err := rows.Scan(&name, &enabled); err != nil {
+			return nil, err
+		}
+		flags[name] = enabled
+	}
+
+	return flags, nil
+}
+
+// SetFeatureFlag stores an admin override for a feature flag
+func (ds *DatabaseSchema) SetFeatureFlag(name string, enabled bool) error {
+	query := `INSERT INTO feature_flags (name, enabled) VALUES (?, ?) ON DUPLICATE KEY UPDATE enabled = VALUES(enabled)`
+	_, err := ds.DB.Exec(query, name, enabled)
+	return err
+}
+
+// DeleteFeatureFlag removes an admin override for a feature flag
+func (ds *DatabaseSchema) DeleteFeatureFlag(name string) error {
+	_, err := ds.DB.Exec(`DELETE FROM feature_flags WHERE name = ?`, name)
+	return err
+}
+
+// GetSettingOverrides returns the settings changed through /admin/settings
+func (ds *DatabaseSchema) GetSettingOverrides() (map[string]string, error) {
+	rows, err := ds.DB.Query(`SELECT name, value FROM setting_overrides`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		overrides[name] = value
+	}
+
+	return overrides, rows.Err()
+}
+
+// SetSettingOverride stores a setting changed through /admin/settings
+func (ds *DatabaseSchema) SetSettingOverride(name, value string) error {
+	query := `INSERT INTO setting_overrides (name, value) VALUES (?, ?) ON DUPLICATE KEY UPDATE value = VALUES(value)`
+	_, err := ds.DB.Exec(query, name, value)
+	return err
+}
+
+// DeleteSettingOverride removes a setting override, so CONFIG_FILE or the
+// environment applies again
+func (ds *DatabaseSchema) DeleteSettingOverride(name string) error {
+	_, err := ds.DB.Exec(`DELETE FROM setting_overrides WHERE name = ?`, name)
+	return err
+}
+
+func (ds *DatabaseSchema) InsertWidget(widget *WidgetRecord, tokenHash string) error {
+	query := `INSERT INTO widgets (id, name, token_hash, allowed_origins, rate_limit) VALUES (?, ?, ?, ?, ?)`
+	_, err := ds.DB.Exec(query, widget.ID, widget.Name, tokenHash, strings.Join(widget.AllowedOrigins, ","), widget.RateLimit)
+	return err
+}
+
+const widgetColumns = `id, name, allowed_origins, rate_limit, created_at`
+
+func scanWidget(scanner interface{ Scan(...interface{}) error }) (*WidgetRecord, error) {
+	var widget WidgetRecord
+	var origins string
+	if err := scanner.Scan(&widget.ID, &widget.Name, &origins, &widget.RateLimit, &widget.CreatedAt); err != nil {
+		return nil, err
+	}
+	widget.AllowedOrigins = strings.Split(origins, ",")
+	return &widget, nil
+}
+
+// GetWidgetByTokenHash finds the widget a token belongs to
+func (ds *DatabaseSchema) GetWidgetByTokenHash(tokenHash string) (*WidgetRecord, error) {
+	query := `SELECT ` + widgetColumns + ` FROM widgets WHERE token_hash = ?`
+	return scanWidget(ds.DB.QueryRow(query, tokenHash))
+}
+
+// GetWidgets lists all widgets, oldest first
+func (ds *DatabaseSchema) GetWidgets() ([]WidgetRecord, error) {
+	rows, err := ds.DB.Query(`SELECT ` + widgetColumns + ` FROM widgets ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	widgets := []WidgetRecord{}
+	for rows.Next() {
+		widget, err := scanWidget(rows)
+		if err != nil {
+			return nil, err
+		}
+		widgets = append(widgets, *widget)
+	}
+
+	return widgets, nil
+}
+
+// DeleteWidget removes a widget; it reports sql.ErrNoRows for unknown ids
+func (ds *DatabaseSchema) DeleteWidget(id string) error {
+	result, err := ds.DB.Exec(`DELETE FROM widgets WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (ds *DatabaseSchema) InsertAPIToken(token *APITokenRecord, tokenHash string) error {
+	query := `INSERT INTO api_tokens (id, name, token_hash, scopes, collections) VALUES (?, ?, ?, ?, ?)`
+	_, err := ds.DB.Exec(query, token.ID, token.Name, tokenHash, strings.Join(token.Scopes, ","), strings.Join(token.Collections, ","))
+	return err
+}
+
+const apiTokenColumns = `id, name, scopes, collections, created_at`
+
+func scanAPIToken(scanner interface{ Scan(...interface{}) error }) (*APITokenRecord, error) {
+	var token APITokenRecord
+	var scopes, collections string
+	if err := scanner.Scan(&token.ID, &token.Name, &scopes, &collections, &token.CreatedAt); err != nil {
+		return nil, err
+	}
+	token.Scopes = splitList(scopes)
+	token.Collections = splitList(collections)
+	return &token, nil
+}
+
+// splitList splits a comma-joined column, empty for an empty one
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// GetAPITokenByHash finds the API token a secret belongs to
+func (ds *DatabaseSchema) GetAPITokenByHash(tokenHash string) (*APITokenRecord, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash = ?`
+	return scanAPIToken(ds.DB.QueryRow(query, tokenHash))
+}
+
+// GetAPITokens lists all API tokens, oldest first
+func (ds *DatabaseSchema) GetAPITokens() ([]APITokenRecord, error) {
+	rows, err := ds.DB.Query(`SELECT ` + apiTokenColumns + ` FROM api_tokens ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APITokenRecord{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// DeleteAPIToken revokes an API token; it reports sql.ErrNoRows for
+// unknown ids
+func (ds *DatabaseSchema) DeleteAPIToken(id string) error {
+	result, err := ds.DB.Exec(`DELETE FROM api_tokens WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetDocumentFingerprints lists every document with the fields a corpus
+// snapshot records
+func (ds *DatabaseSchema) GetDocumentFingerprints() ([]SnapshotDocument, error) {
+	query := `SELECT id, original_filename, COALESCE(content_hash, ''), file_size, status, chunk_count, updated_at
+			  FROM documents ORDER BY id`
+
+	rows, err := ds.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []SnapshotDocument{}
+	for rows.Next() {
+		var doc SnapshotDocument
+		err := rows.Scan(&doc.ID, &doc.Filename, &doc.ContentHash, &doc.FileSize, &doc.Status, &doc.ChunkCount, &doc.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+
+	return documents, nil
+}
+
+// InsertSnapshot stores a snapshot; an existing snapshot with the same id is
+// kept, which makes pinning a corpus version idempotent
+func (ds *DatabaseSchema) InsertSnapshot(snapshot *SnapshotRecord) error {
+	query := `INSERT IGNORE INTO corpus_snapshots (id, label, document_count, documents) VALUES (?, NULLIF(?, ''), ?, ?)`
+	_, err := ds.DB.Exec(query, snapshot.ID, snapshot.Label, snapshot.DocumentCount, snapshot.Documents)
+	return err
+}
+
+// GetSnapshot returns a snapshot including its document list
+func (ds *DatabaseSchema) GetSnapshot(id string) (*SnapshotRecord, error) {
+	query := `SELECT id, COALESCE(label, ''), document_count, documents, created_at FROM corpus_snapshots WHERE id = ?`
+
+	var snapshot SnapshotRecord
+	err := ds.DB.QueryRow(query, id).Scan(&snapshot.ID, &snapshot.Label, &snapshot.DocumentCount, &snapshot.Documents, &snapshot.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// GetSnapshots lists snapshots newest first, without their document lists
+func (ds *DatabaseSchema) GetSnapshots(limit, offset int) ([]SnapshotRecord, error) {
+	query := `SELECT id, COALESCE(label, ''), document_count, created_at FROM corpus_snapshots
+			  ORDER BY created_at DESC LIMIT ? OFFSET ?`
+
 	rows, err := ds.DB.Query(query, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var queries []QueryRecord
+	snapshots := []SnapshotRecord{}
+	for rows.Next() {
+		var snapshot SnapshotRecord
+		if err := rows.Scan(&snapshot.ID, &snapshot.Label, &snapshot.DocumentCount, &snapshot.CreatedAt); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+func (ds *DatabaseSchema) InsertModerationIncident(incident *ModerationIncident) error {
+	query := `INSERT INTO moderation_incidents (id, stage, action, provider, categories, content, question)
+			  VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''))`
+	_, err := ds.DB.Exec(query, incident.ID, incident.Stage, incident.Action, incident.Provider,
+		strings.Join(incident.Categories, ","), incident.Content, incident.Question)
+	return err
+}
+
+// GetModerationIncidents lists incidents newest first, optionally only those
+// of one stage
+func (ds *DatabaseSchema) GetModerationIncidents(stage string, limit, offset int) ([]ModerationIncident, error) {
+	query := `SELECT id, stage, action, provider, categories, content, COALESCE(question, ''), created_at
+			  FROM moderation_incidents
+			  WHERE (? = '' OR stage = ?)
+			  ORDER BY created_at DESC LIMIT ? OFFSET ?`
+
+	rows, err := ds.DB.Query(query, stage, stage, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []ModerationIncident{}
+	for rows.Next() {
+		var incident ModerationIncident
+		var categories string
+		err := rows.Scan(&incident.ID, &incident.Stage, &incident.Action, &incident.Provider,
+			&categories, &incident.Content, &incident.Question, &incident.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		incident.Categories = strings.Split(categories, ",")
+		incidents = append(incidents, incident)
+	}
+
+	return incidents, nil
+}
+
+// AddUsage adds to a key's usage for a period
+func (ds *DatabaseSchema) AddUsage(keyID, period string, usage Quota) error {
+	query := `INSERT INTO api_usage (key_id, period, queries, tokens, upload_bytes) VALUES (?, ?, ?, ?, ?)
+			  ON DUPLICATE KEY UPDATE queries = queries + VALUES(queries), tokens = tokens + VALUES(tokens),
+			  upload_bytes = upload_bytes + VALUES(upload_bytes)`
+	_, err := ds.DB.Exec(query, keyID, period, usage.Queries, usage.Tokens, usage.UploadBytes)
+	return err
+}
+
+const usageColumns = `key_id, period, queries, tokens, upload_bytes, updated_at`
+
+func scanUsage(scanner interface{ Scan(...interface{}) error }) (*UsageRecord, error) {
+	var usage UsageRecord
+	err := scanner.Scan(&usage.KeyID, &usage.Period, &usage.Queries, &usage.Tokens, &usage.UploadBytes, &usage.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// GetUsage returns a key's usage for a period
+func (ds *DatabaseSchema) GetUsage(keyID, period string) (*UsageRecord, error) {
+	query := `SELECT ` + usageColumns + ` FROM api_usage WHERE key_id = ? AND period = ?`
+	return scanUsage(ds.DB.QueryRow(query, keyID, period))
+}
+
+// ListUsage returns usage for a period, or every period when empty,
+// optionally for one key
+func (ds *DatabaseSchema) ListUsage(period, keyID string) ([]UsageRecord, error) {
+	query := `SELECT ` + usageColumns + ` FROM api_usage
+			  WHERE (? = '' OR period = ?) AND (? = '' OR key_id = ?)
+			  ORDER BY period DESC, key_id`
+
+	rows, err := ds.DB.Query(query, period, period, keyID, keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []UsageRecord{}
+	for rows.Next() {
+		usage, err := scanUsage(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *usage)
+	}
+
+	return records, nil
+}
+
+// SetQuota stores a key's quota override
+func (ds *DatabaseSchema) SetQuota(keyID string, quota Quota) error {
+	query := `INSERT INTO api_quotas (key_id, queries, tokens, upload_bytes) VALUES (?, ?, ?, ?)
+			  ON DUPLICATE KEY UPDATE queries = VALUES(queries), tokens = VALUES(tokens), upload_bytes = VALUES(upload_bytes)`
+	_, err := ds.DB.Exec(query, keyID, quota.Queries, quota.Tokens, quota.UploadBytes)
+	return err
+}
+
+const quotaColumns = `key_id, queries, tokens, upload_bytes, updated_at`
+
+func scanQuota(scanner interface{ Scan(...interface{}) error }) (*QuotaRecord, error) {
+	var quota QuotaRecord
+	err := scanner.Scan(&quota.KeyID, &quota.Queries, &quota.Tokens, &quota.UploadBytes, &quota.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// GetQuota returns a key's quota override
+func (ds *DatabaseSchema) GetQuota(keyID string) (*QuotaRecord, error) {
+	return scanQuota(ds.DB.QueryRow(`SELECT `+quotaColumns+` FROM api_quotas WHERE key_id = ?`, keyID))
+}
+
+// GetQuotas lists all quota overrides
+func (ds *DatabaseSchema) GetQuotas() ([]QuotaRecord, error) {
+	rows, err := ds.DB.Query(`SELECT ` + quotaColumns + ` FROM api_quotas ORDER BY key_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quotas := []QuotaRecord{}
+	for rows.Next() {
+		quota, err := scanQuota(rows)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, *quota)
+	}
+
+	return quotas, nil
+}
+
+// DeleteQuota removes a key's override; it reports sql.ErrNoRows for keys
+// without one
+func (ds *DatabaseSchema) DeleteQuota(keyID string) error {
+	result, err := ds.DB.Exec(`DELETE FROM api_quotas WHERE key_id = ?`, keyID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// InsertSessionShare stores a share link that expires ttl from now
+func (ds *DatabaseSchema) InsertSessionShare(share *SessionShareRecord, tokenHash string, ttl time.Duration) error {
+	query := `INSERT INTO session_shares (id, session_id, token_hash, expires_at)
+			  VALUES (?, ?, ?, DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? SECOND))`
+	_, err := ds.DB.Exec(query, share.ID, share.SessionID, tokenHash, int64(ttl.Seconds()))
+	return err
+}
+
+const sessionShareColumns = `id, session_id, expires_at, revoked_at, created_at, expires_at <= CURRENT_TIMESTAMP`
+
+func scanSessionShare(scanner interface{ Scan(...interface{}) error }) (*SessionShareRecord, error) {
+	var share SessionShareRecord
+	err := scanner.Scan(&share.ID, &share.SessionID, &share.ExpiresAt, &share.RevokedAt, &share.CreatedAt, &share.Expired)
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// GetSessionShareByTokenHash finds the share link a token belongs to
+func (ds *DatabaseSchema) GetSessionShareByTokenHash(tokenHash string) (*SessionShareRecord, error) {
+	query := `SELECT ` + sessionShareColumns + ` FROM session_shares WHERE token_hash = ?`
+	return scanSessionShare(ds.DB.QueryRow(query, tokenHash))
+}
+
+// GetSessionShares lists a session's share links, newest first
+func (ds *DatabaseSchema) GetSessionShares(sessionID string) ([]SessionShareRecord, error) {
+	query := `SELECT ` + sessionShareColumns + ` FROM session_shares WHERE session_id = ? ORDER BY created_at DESC`
+
+	rows, err := ds.DB.Query(query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []SessionShareRecord{}
 	for rows.Next() {
-		var q QueryRecord
-		err := rows.Scan(
-			&q.ID, &q.Question, &q.Answer, &q.Confidence, &q.Sources, &q.Context, &q.CreatedAt,
-		)
+		share, err := scanSessionShare(rows)
 		if err != nil {
 			return nil, err
 		}
-		queries = append(queries, q)
+		shares = append(shares, *share)
 	}
 
-	return queries, nil
+	return shares, nil
 }
 
-// Chat session management methods
-func (ds *DatabaseSchema) CreateChatSession(title string) (*ChatSession, error) {
-	sessionID := fmt.Sprintf("session_%d", time.Now().UnixNano())
-
-	session := &ChatSession{
-		ID:        sessionID,
-		Title:     title,
-		CreatedAt: time.Now().Format(time.RFC3339),
-		UpdatedAt: time.Now().Format(time.RFC3339),
+// RevokeSessionShare revokes a session's share link; it reports
+// sql.ErrNoRows for unknown or already revoked links
+func (ds *DatabaseSchema) RevokeSessionShare(sessionID, shareID string) error {
+	query := `UPDATE session_shares SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND session_id = ? AND revoked_at IS NULL`
+	result, err := ds.DB.Exec(query, shareID, sessionID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
 	}
+	return nil
+}
+
+// InsertCollection registers a collection
+func (ds *DatabaseSchema) InsertCollection(collection *CollectionRecord) error {
+	_, err := ds.DB.Exec(`INSERT INTO collections (name, description, created_by, citation_mode) VALUES (?, ?, ?, NULLIF(?, ''))`,
+		collection.Name, collection.Description, collection.CreatedBy, collection.CitationMode)
+	return err
+}
+
+// SetCollectionCitationMode changes a collection's citation mode; "" makes
+// it follow CITATION_MODE again
+func (ds *DatabaseSchema) SetCollectionCitationMode(name, mode string) error {
+	_, err := ds.DB.Exec(`UPDATE collections SET citation_mode = NULLIF(?, '') WHERE name = ?`, mode, name)
+	return err
+}
 
-	query := `INSERT INTO chat_sessions (id, title) VALUES (?, ?)`
-	_, err := ds.DB.Exec(query, session.ID, session.Title)
+// GetCollectionCitationModes maps the collections that set a citation mode
+// to it
+func (ds *DatabaseSchema) GetCollectionCitationModes() (map[string]string, error) {
+	rows, err := ds.DB.Query(`SELECT name, citation_mode FROM collections WHERE citation_mode IS NOT NULL AND citation_mode <> ''`)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return session, nil
+	modes := make(map[string]string)
+	for rows.Next() {
+		var name, mode string
+		if err := rows.Scan(&name, &mode); err != nil {
+			return nil, err
+		}
+		modes[name] = mode
+	}
+	return modes, rows.Err()
 }
 
-func (ds *DatabaseSchema) GetChatSessions(limit, offset int) ([]ChatSession, error) {
-	query := `SELECT id, title, created_at, updated_at FROM chat_sessions ORDER BY updated_at DESC LIMIT ? OFFSET ?`
+const collectionColumns = `c.name, COALESCE(c.description, ''), COALESCE(c.created_by, ''), COALESCE(c.citation_mode, ''), c.created_at,
+	(SELECT COUNT(*) FROM collection_members m WHERE m.collection = c.name)`
 
-	rows, err := ds.DB.Query(query, limit, offset)
+func scanCollection(scanner interface{ Scan(...interface{}) error }) (*CollectionRecord, error) {
+	var collection CollectionRecord
+	err := scanner.Scan(&collection.Name, &collection.Description, &collection.CreatedBy, &collection.CitationMode, &collection.CreatedAt, &collection.Members)
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// GetCollection retrieves a registered collection by name
+func (ds *DatabaseSchema) GetCollection(name string) (*CollectionRecord, error) {
+	return scanCollection(ds.DB.QueryRow(`SELECT `+collectionColumns+` FROM collections c WHERE c.name = ?`, name))
+}
+
+// GetCollections lists registered collections by name
+func (ds *DatabaseSchema) GetCollections() ([]CollectionRecord, error) {
+	rows, err := ds.DB.Query(`SELECT ` + collectionColumns + ` FROM collections c ORDER BY c.name`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var sessions []ChatSession
+	collections := []CollectionRecord{}
 	for rows.Next() {
-		var session ChatSession
-		err := rows.Scan(&session.ID, &session.Title, &session.CreatedAt, &session.UpdatedAt)
+		collection, err := scanCollection(rows)
 		if err != nil {
 			return nil, err
 		}
-		sessions = append(sessions, session)
+		collections = append(collections, *collection)
 	}
 
-	return sessions, nil
+	return collections, nil
 }
 
-func (ds *DatabaseSchema) GetChatSession(sessionID string) (*ChatSession, error) {
-	query := `SELECT id, title, created_at, updated_at FROM chat_sessions WHERE id = ?`
-
-	var session ChatSession
-	err := ds.DB.QueryRow(query, sessionID).Scan(&session.ID, &session.Title, &session.CreatedAt, &session.UpdatedAt)
+// GetCollectionNames lists the names of registered collections
+func (ds *DatabaseSchema) GetCollectionNames() ([]string, error) {
+	rows, err := ds.DB.Query(`SELECT name FROM collections`)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &session, nil
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
 }
 
-func (ds *DatabaseSchema) UpdateChatSession(sessionID, title string) error {
-	query := `UPDATE chat_sessions SET title = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err := ds.DB.Exec(query, title, sessionID)
+// CountCollectionDocuments counts the documents whose metadata places them
+// in a collection
+func (ds *DatabaseSchema) CountCollectionDocuments(name string) (int, error) {
+	var count int
+	err := ds.DB.QueryRow(`SELECT COUNT(*) FROM documents WHERE JSON_UNQUOTE(JSON_EXTRACT(metadata, '$.collection')) = ?`, name).Scan(&count)
+	return count, err
+}
+
+// DeleteCollection unregisters a collection along with its memberships
+func (ds *DatabaseSchema) DeleteCollection(name string) error {
+	result, err := ds.DB.Exec(`DELETE FROM collections WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetCollectionMember grants or changes a member's permission
+func (ds *DatabaseSchema) SetCollectionMember(collection, memberID, permission string) error {
+	query := `INSERT INTO collection_members (collection, member_id, permission) VALUES (?, ?, ?)
+			  ON DUPLICATE KEY UPDATE permission = VALUES(permission)`
+	_, err := ds.DB.Exec(query, collection, memberID, permission)
 	return err
 }
 
-func (ds *DatabaseSchema) DeleteChatSession(sessionID string) error {
-	query := `DELETE FROM chat_sessions WHERE id = ?`
-	_, err := ds.DB.Exec(query, sessionID)
+// RemoveCollectionMember revokes a member's access
+func (ds *DatabaseSchema) RemoveCollectionMember(collection, memberID string) error {
+	result, err := ds.DB.Exec(`DELETE FROM collection_members WHERE collection = ? AND member_id = ?`, collection, memberID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetCollectionMembers lists a collection's members
+func (ds *DatabaseSchema) GetCollectionMembers(collection string) ([]CollectionMember, error) {
+	query := `SELECT collection, member_id, permission, created_at FROM collection_members WHERE collection = ? ORDER BY created_at`
+
+	rows, err := ds.DB.Query(query, collection)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []CollectionMember{}
+	for rows.Next() {
+		var member CollectionMember
+		if err := rows.Scan(&member.Collection, &member.MemberID, &member.Permission, &member.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// GetMemberPermissions maps each collection a member belongs to to their
+// permission on it
+func (ds *DatabaseSchema) GetMemberPermissions(memberID string) (map[string]string, error) {
+	rows, err := ds.DB.Query(`SELECT collection, permission FROM collection_members WHERE member_id = ?`, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := make(map[string]string)
+	for rows.Next() {
+		var collection, permission string
+		if err := rows.Scan(&collection, &permission); err != nil {
+			return nil, err
+		}
+		permissions[collection] = permission
+	}
+
+	return permissions, nil
+}
+
+// InsertNotification stores a notification and sets its ID
+func (ds *DatabaseSchema) InsertNotification(notification *NotificationRecord) error {
+	query := `INSERT INTO notifications (recipient, kind, title, message, resource) VALUES (?, ?, ?, ?, ?)`
+	result, err := ds.DB.Exec(query, notification.Recipient, notification.Kind, notification.Title, notification.Message, notification.Resource)
+	if err != nil {
+		return err
+	}
+	notification.ID, err = result.LastInsertId()
 	return err
 }
 
-func (ds *DatabaseSchema) AddChatMessage(sessionID, role, content, sources string, confidence float64) error {
-	messageID := fmt.Sprintf("msg_%d", time.Now().UnixNano())
+// GetNotifications lists a recipient's notifications, newest first
+func (ds *DatabaseSchema) GetNotifications(recipient string, unreadOnly bool, limit, offset int) ([]NotificationRecord, error) {
+	query := `SELECT id, recipient, kind, title, COALESCE(message, ''), COALESCE(resource, ''), read_at, created_at
+			  FROM notifications WHERE recipient = ?`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	query += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	rows, err := ds.DB.Query(query, recipient, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []NotificationRecord{}
+	for rows.Next() {
+		var n NotificationRecord
+		if err := rows.Scan(&n.ID, &n.Recipient, &n.Kind, &n.Title, &n.Message, &n.Resource, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.Read = n.ReadAt != nil
+		notifications = append(notifications, n)
+	}
+
+	return notifications, nil
+}
+
+// CountUnreadNotifications counts a recipient's unread notifications
+func (ds *DatabaseSchema) CountUnreadNotifications(recipient string) (int, error) {
+	var count int
+	err := ds.DB.QueryRow(`SELECT COUNT(*) FROM notifications WHERE recipient = ? AND read_at IS NULL`, recipient).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationRead marks one of a recipient's notifications read; it
+// reports sql.ErrNoRows for notifications that aren't theirs
+func (ds *DatabaseSchema) MarkNotificationRead(recipient string, id int64) error {
+	result, err := ds.DB.Exec(`UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP) WHERE id = ? AND recipient = ?`, id, recipient)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of a recipient
+// read and returns how many changed
+func (ds *DatabaseSchema) MarkAllNotificationsRead(recipient string) (int64, error) {
+	result, err := ds.DB.Exec(`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE recipient = ? AND read_at IS NULL`, recipient)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
 
-	query := `INSERT INTO chat_messages (id, session_id, role, content, sources, confidence) VALUES (?, ?, ?, ?, ?, ?)`
-	_, err := ds.DB.Exec(query, messageID, sessionID, role, content, sources, confidence)
+// SetNotificationSettings creates or replaces a recipient's settings
+func (ds *DatabaseSchema) SetNotificationSettings(settings *NotificationSettings) error {
+	query := `INSERT INTO notification_settings (recipient, email, digest) VALUES (?, ?, ?)
+			  ON DUPLICATE KEY UPDATE email = VALUES(email), digest = VALUES(digest)`
+	_, err := ds.DB.Exec(query, settings.Recipient, settings.Email, settings.Digest)
 	return err
 }
 
-func (ds *DatabaseSchema) GetChatMessages(sessionID string, limit, offset int) ([]ChatMessage, error) {
-	query := `SELECT id, session_id, role, content, sources, confidence, created_at 
-			  FROM chat_messages WHERE session_id = ? ORDER BY created_at ASC LIMIT ? OFFSET ?`
+const notificationSettingsColumns = `recipient, COALESCE(email, ''), COALESCE(digest, FALSE), digest_sent_at`
 
-	rows, err := ds.DB.Query(query, sessionID, limit, offset)
+func scanNotificationSettings(scanner interface{ Scan(...interface{}) error }) (*NotificationSettings, error) {
+	var settings NotificationSettings
+	if err := scanner.Scan(&settings.Recipient, &settings.Email, &settings.Digest, &settings.DigestSentAt); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (ds *DatabaseSchema) GetNotificationSettings(recipient string) (*NotificationSettings, error) {
+	query := `SELECT ` + notificationSettingsColumns + ` FROM notification_settings WHERE recipient = ?`
+	return scanNotificationSettings(ds.DB.QueryRow(query, recipient))
+}
+
+// GetDigestRecipients lists recipients who get digests at an email address
+func (ds *DatabaseSchema) GetDigestRecipients() ([]NotificationSettings, error) {
+	query := `SELECT ` + notificationSettingsColumns + ` FROM notification_settings WHERE digest = TRUE AND email <> ''`
+
+	rows, err := ds.DB.Query(query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var messages []ChatMessage
+	var recipients []NotificationSettings
 	for rows.Next() {
-		var msg ChatMessage
-		err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.Sources, &msg.Confidence, &msg.CreatedAt)
+		settings, err := scanNotificationSettings(rows)
 		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, msg)
+		recipients = append(recipients, *settings)
 	}
 
-	return messages, nil
+	return recipients, nil
 }
 
-func (ds *DatabaseSchema) GetChunksByDocument(documentID string, limit, offset int) ([]ChunkRecord, error) {
-	query := `SELECT id, document_id, chunk_text, page_number, chunk_index, word_count, metadata, created_at 
-			  FROM document_chunks WHERE document_id = ? ORDER BY chunk_index ASC LIMIT ? OFFSET ?`
+// digestSince is the start of a recipient's next digest: their last digest,
+// or window ago for their first
+const digestSince = `COALESCE((SELECT digest_sent_at FROM notification_settings WHERE recipient = ?),
+	DATE_SUB(CURRENT_TIMESTAMP, INTERVAL ? SECOND))`
 
-	rows, err := ds.DB.Query(query, documentID, limit, offset)
+// GetDigestNotifications lists a recipient's notifications of the given
+// kinds since their last digest, oldest first
+func (ds *DatabaseSchema) GetDigestNotifications(recipient string, kinds []string, window time.Duration) ([]NotificationRecord, error) {
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	query := `SELECT id, recipient, kind, title, COALESCE(message, ''), COALESCE(resource, ''), read_at, created_at
+			  FROM notifications WHERE recipient = ? AND kind IN (?` + strings.Repeat(", ?", len(kinds)-1) + `)
+			  AND created_at > ` + digestSince + ` ORDER BY id`
+	args := []interface{}{recipient}
+	for _, kind := range kinds {
+		args = append(args, kind)
+	}
+	args = append(args, recipient, int64(window.Seconds()))
+
+	rows, err := ds.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var chunks []ChunkRecord
+	var notifications []NotificationRecord
 	for rows.Next() {
-		var chunk ChunkRecord
-		err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.ChunkText, &chunk.PageNumber, &chunk.ChunkIndex, &chunk.WordCount, &chunk.Metadata, &chunk.CreatedAt)
+		var n NotificationRecord
+		if err := rows.Scan(&n.ID, &n.Recipient, &n.Kind, &n.Title, &n.Message, &n.Resource, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.Read = n.ReadAt != nil
+		notifications = append(notifications, n)
+	}
+
+	return notifications, nil
+}
+
+// GetDigestSavedQueries lists an owner's saved queries that ran since their
+// last digest
+func (ds *DatabaseSchema) GetDigestSavedQueries(owner string, window time.Duration) ([]SavedQueryRecord, error) {
+	query := `SELECT ` + savedQueryColumns + ` FROM saved_queries WHERE owner = ? AND last_run_at > ` + digestSince + ` ORDER BY created_at`
+	return ds.querySavedQueries(query, owner, owner, int64(window.Seconds()))
+}
+
+// MarkDigestSent records that a recipient's digest went out now
+func (ds *DatabaseSchema) MarkDigestSent(recipient string) error {
+	_, err := ds.DB.Exec(`UPDATE notification_settings SET digest_sent_at = CURRENT_TIMESTAMP WHERE recipient = ?`, recipient)
+	return err
+}
+
+// InsertSavedQuery stores a saved query, due to run right away
+func (ds *DatabaseSchema) InsertSavedQuery(saved *SavedQueryRecord) error {
+	query := `INSERT INTO saved_queries (id, owner, question, interval_hours) VALUES (?, ?, ?, ?)`
+	_, err := ds.DB.Exec(query, saved.ID, saved.Owner, saved.Question, saved.IntervalHours)
+	return err
+}
+
+const savedQueryColumns = `id, owner, question, interval_hours, COALESCE(last_answer, ''), COALESCE(last_corpus_version, ''),
+	last_run_at, next_run_at, created_at`
+
+func scanSavedQuery(scanner interface{ Scan(...interface{}) error }) (*SavedQueryRecord, error) {
+	var saved SavedQueryRecord
+	err := scanner.Scan(&saved.ID, &saved.Owner, &saved.Question, &saved.IntervalHours, &saved.LastAnswer,
+		&saved.LastCorpusVersion, &saved.LastRunAt, &saved.NextRunAt, &saved.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+func (ds *DatabaseSchema) querySavedQueries(query string, args ...interface{}) ([]SavedQueryRecord, error) {
+	rows, err := ds.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	saved := []SavedQueryRecord{}
+	for rows.Next() {
+		record, err := scanSavedQuery(rows)
 		if err != nil {
 			return nil, err
 		}
-		chunks = append(chunks, chunk)
+		saved = append(saved, *record)
 	}
 
-	return chunks, nil
+	return saved, nil
+}
+
+func (ds *DatabaseSchema) GetSavedQuery(id string) (*SavedQueryRecord, error) {
+	return scanSavedQuery(ds.DB.QueryRow(`SELECT `+savedQueryColumns+` FROM saved_queries WHERE id = ?`, id))
+}
+
+// GetSavedQueries lists an owner's saved queries, newest first
+func (ds *DatabaseSchema) GetSavedQueries(owner string) ([]SavedQueryRecord, error) {
+	return ds.querySavedQueries(`SELECT `+savedQueryColumns+` FROM saved_queries WHERE owner = ? ORDER BY created_at DESC`, owner)
+}
+
+// GetDueSavedQueries lists saved queries whose next run has come
+func (ds *DatabaseSchema) GetDueSavedQueries() ([]SavedQueryRecord, error) {
+	return ds.querySavedQueries(`SELECT ` + savedQueryColumns + ` FROM saved_queries WHERE next_run_at <= CURRENT_TIMESTAMP ORDER BY next_run_at`)
+}
+
+// RecordSavedQueryRun stores a run's answer and schedules the next run
+func (ds *DatabaseSchema) RecordSavedQueryRun(id, answer, corpusVersion string) error {
+	query := `UPDATE saved_queries SET last_answer = ?, last_corpus_version = ?, last_run_at = CURRENT_TIMESTAMP,
+			  next_run_at = DATE_ADD(CURRENT_TIMESTAMP, INTERVAL interval_hours HOUR) WHERE id = ?`
+	_, err := ds.DB.Exec(query, answer, corpusVersion, id)
+	return err
+}
+
+// RescheduleSavedQuery schedules the next run without recording one
+func (ds *DatabaseSchema) RescheduleSavedQuery(id string) error {
+	_, err := ds.DB.Exec(`UPDATE saved_queries SET next_run_at = DATE_ADD(CURRENT_TIMESTAMP, INTERVAL interval_hours HOUR) WHERE id = ?`, id)
+	return err
+}
+
+// DeleteSavedQuery removes one of an owner's saved queries
+func (ds *DatabaseSchema) DeleteSavedQuery(owner, id string) error {
+	result, err := ds.DB.Exec(`DELETE FROM saved_queries WHERE id = ? AND owner = ?`, id, owner)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 // Document and Chunk record structures
@@ -391,9 +3164,15 @@ type DocumentRecord struct {
 	FileSize         int64  `json:"file_size"`
 	Status           string `json:"status"`
 	ChunkCount       int    `json:"chunk_count"`
-	Metadata         string `json:"metadata"` // JSON string
-	CreatedAt        string `json:"created_at"`
-	UpdatedAt        string `json:"updated_at"`
+	// ContentHash is the SHA-256 of the original; empty for documents
+	// stored before content-addressed naming
+	ContentHash string `json:"content_hash,omitempty"`
+	// StorageTier is where the original PDF lives; only GetDocument and
+	// ListDocuments fill it in
+	StorageTier string    `json:"storage_tier,omitempty"`
+	Metadata    string    `json:"metadata"` // JSON string
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 type ChunkRecord struct {
@@ -402,9 +3181,23 @@ type ChunkRecord struct {
 	ChunkText  string `json:"chunk_text"`
 	PageNumber int    `json:"page_number"`
 	ChunkIndex int    `json:"chunk_index"`
-	WordCount  int    `json:"word_count"`
-	Metadata   string `json:"metadata"` // JSON string
-	CreatedAt  string `json:"created_at"`
+	// Version is the indexing run that stored the chunk; reads only return
+	// the document's committed version
+	Version   int    `json:"-"`
+	WordCount int    `json:"word_count"`
+	Language  string `json:"language"`
+	Script    string `json:"script"`
+	ChunkType string `json:"chunk_type"`
+	// QuantityTerms holds canonical amounts ("1200000 usd") found in the text
+	QuantityTerms string `json:"quantity_terms,omitempty"`
+	// SyntheticQuestions are questions the text answers, one per line,
+	// generated when DOC2QUERY_QUESTIONS is set
+	SyntheticQuestions string    `json:"synthetic_questions,omitempty"`
+	Metadata           string    `json:"metadata"` // JSON string
+	CreatedAt          time.Time `json:"created_at"`
+	// Similarity is the chunk's vector similarity to the question, set
+	// during retrieval when an embedder is configured
+	Similarity float64 `json:"-"`
 }
 
 type QueryRecord struct {
@@ -413,15 +3206,22 @@ type QueryRecord struct {
 	Answer     string  `json:"answer"`
 	Confidence float64 `json:"confidence"`
 	Sources    string  `json:"sources"` // JSON string
-	Context    string  `json:"context"`
-	CreatedAt  string  `json:"created_at"`
+	// Context is stored in ContextFormat, see ExpandContext
+	Context       string `json:"context"`
+	ContextFormat string `json:"context_format,omitempty"`
+	// CorpusVersion identifies the document set the answer was given against
+	CorpusVersion string `json:"corpus_version,omitempty"`
+	// Rating is 1 for an approved answer, -1 for a rejected one, 0 if unrated
+	Rating    int       `json:"rating"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type ChatSession struct {
-	ID        string `json:"id"`
-	Title     string `json:"title"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Language  string    `json:"language,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type ChatMessage struct {
@@ -431,5 +3231,206 @@ type ChatMessage struct {
 	Content    string  `json:"content"`
 	Sources    string  `json:"sources"` // JSON string
 	Confidence float64 `json:"confidence"`
-	CreatedAt  string  `json:"created_at"`
+	// CorpusVersion identifies the document set an answer was given against
+	CorpusVersion string    `json:"corpus_version,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	// Context is the answer's retrieval context, only set when asked for
+	// through ExpandMessageContexts
+	Context string `json:"context,omitempty"`
+}
+
+type SummaryRecord struct {
+	ID             string    `json:"id"`
+	Status         string    `json:"status"`
+	DocumentIDs    string    `json:"document_ids"` // JSON string, "null" for the whole corpus
+	CompletedSteps int       `json:"completed_steps"`
+	TotalSteps     int       `json:"total_steps"`
+	Summary        string    `json:"summary,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type ReportRecord struct {
+	ID             string    `json:"id"`
+	Title          string    `json:"title"`
+	Status         string    `json:"status"`
+	Questions      string    `json:"questions"` // JSON string
+	CompletedSteps int       `json:"completed_steps"`
+	TotalSteps     int       `json:"total_steps"`
+	MarkdownObject string    `json:"markdown_object,omitempty"`
+	PDFObject      string    `json:"pdf_object,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	Resource   string    `json:"resource"`
+	Details    string    `json:"details"`
+	IP         string    `json:"ip"`
+	StatusCode int       `json:"status_code"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SnapshotRecord is a stored corpus snapshot; Documents is the JSON list of
+// SnapshotDocument and is only loaded by GetSnapshot
+type SnapshotRecord struct {
+	ID            string    `json:"id"`
+	Label         string    `json:"label,omitempty"`
+	DocumentCount int       `json:"document_count"`
+	Documents     string    `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// SnapshotDocument is the state of one document in a corpus snapshot
+type SnapshotDocument struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentHash string    `json:"content_hash,omitempty"`
+	FileSize    int64     `json:"file_size"`
+	Status      string    `json:"status"`
+	ChunkCount  int       `json:"chunk_count"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ModerationIncident records content the moderation filter flagged
+type ModerationIncident struct {
+	ID         string    `json:"id"`
+	Stage      string    `json:"stage"` // "question" or "answer"
+	Action     string    `json:"action"`
+	Provider   string    `json:"provider"`
+	Categories []string  `json:"categories"`
+	Content    string    `json:"content"`
+	Question   string    `json:"question,omitempty"` // for answers, what was asked
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// UsageRecord is a key's usage in one month
+type UsageRecord struct {
+	KeyID       string     `json:"key_id"`
+	Period      string     `json:"period"`
+	Queries     int64      `json:"queries"`
+	Tokens      int64      `json:"tokens"`
+	UploadBytes int64      `json:"upload_bytes"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// QuotaRecord is an admin-set quota for one key
+type QuotaRecord struct {
+	KeyID string `json:"key_id"`
+	Quota
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SessionShareRecord is a read-only link to a chat session
+type SessionShareRecord struct {
+	ID        string     `json:"id"`
+	SessionID string     `json:"session_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Expired   bool       `json:"expired"`
+}
+
+// CollectionRecord is a registered collection. Permission is the caller's,
+// filled in when listing.
+type CollectionRecord struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	CreatedBy   string `json:"created_by,omitempty"`
+	// CitationMode overrides CITATION_MODE for the collection's documents
+	CitationMode string    `json:"citation_mode,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	Members      int       `json:"members"`
+	Permission   string    `json:"permission,omitempty"`
+}
+
+// CollectionMember grants a member read or write access to a collection
+type CollectionMember struct {
+	Collection string    `json:"collection"`
+	MemberID   string    `json:"member_id"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DocumentEvent is something that happened to a document, such as its
+// upload, extraction or failure
+type DocumentEvent struct {
+	ID         int64     `json:"id"`
+	DocumentID string    `json:"document_id"`
+	Kind       string    `json:"kind"`
+	Message    string    `json:"message"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NotificationRecord is an event for one recipient
+type NotificationRecord struct {
+	ID        int64      `json:"id"`
+	Recipient string     `json:"recipient"`
+	Kind      string     `json:"kind"`
+	Title     string     `json:"title"`
+	Message   string     `json:"message,omitempty"`
+	Resource  string     `json:"resource,omitempty"` // document or saved query id
+	Read      bool       `json:"read"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NotificationSettings says how a recipient's notifications are delivered
+// besides GET /notifications
+type NotificationSettings struct {
+	Recipient string `json:"recipient"`
+	Email     string `json:"email"`
+	// Digest bundles emails into a periodic digest instead of one per event
+	Digest       bool       `json:"digest"`
+	DigestSentAt *time.Time `json:"digest_sent_at,omitempty"`
+}
+
+// SavedQueryRecord is a question re-asked on a schedule
+type SavedQueryRecord struct {
+	ID                string     `json:"id"`
+	Owner             string     `json:"owner"`
+	Question          string     `json:"question"`
+	IntervalHours     int        `json:"interval_hours"`
+	LastAnswer        string     `json:"last_answer,omitempty"`
+	LastCorpusVersion string     `json:"last_corpus_version,omitempty"`
+	LastRunAt         *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt         time.Time  `json:"next_run_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+type WidgetRecord struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	AllowedOrigins []string  `json:"allowed_origins"`
+	RateLimit      int       `json:"rate_limit"` // requests per minute
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// APITokenRecord is an API token limited to Scopes and, when Collections is
+// not empty, to those collections
+type APITokenRecord struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Scopes      []string  `json:"scopes"`
+	Collections []string  `json:"collections"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type StorageUsage struct {
+	Documents     int            `json:"documents"`
+	DocumentBytes int64          `json:"document_bytes"`
+	Chunks        int            `json:"chunks"`
+	ByStatus      map[string]int `json:"by_status"`
+	ObjectCount   int            `json:"object_count"`
+	ObjectBytes   int64          `json:"object_bytes"`
+}
+
+type LanguageCount struct {
+	Language string `json:"language"`
+	Chunks   int    `json:"chunks"`
 }
@@ -0,0 +1,75 @@
+package adapters
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	tehran := time.FixedZone("IRST", 3*3600+1800)
+	tests := []struct {
+		name string
+		in   time.Time
+		want string
+	}{
+		{"UTC", time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC), "2024-03-01T12:30:45Z"},
+		{"other zone", time.Date(2024, 3, 1, 16, 0, 45, 0, tehran), "2024-03-01T12:30:45Z"},
+		{"across midnight", time.Date(2024, 3, 2, 2, 0, 0, 0, tehran), "2024-03-01T22:30:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatTimestamp(tt.in); got != tt.want {
+				t.Errorf("formatTimestamp(%v) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDBNowIsUTCSeconds(t *testing.T) {
+	now := dbNow()
+	if now.Location() != time.UTC {
+		t.Errorf("dbNow() location = %v, want UTC", now.Location())
+	}
+	if now.Nanosecond() != 0 {
+		t.Errorf("dbNow() = %v, want whole seconds", now)
+	}
+}
+
+// Records are read with loc=UTC, so their timestamps must serialize as
+// ISO 8601 in UTC
+func TestRecordTimestampsSerializeAsISO8601UTC(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+	const want = "2024-03-01T12:30:45Z"
+
+	tests := []struct {
+		name   string
+		record interface{}
+		fields []string
+	}{
+		{"DocumentRecord", DocumentRecord{ID: "doc_1", CreatedAt: at, UpdatedAt: at}, []string{"created_at", "updated_at"}},
+		{"QueryRecord", QueryRecord{ID: "q_1", CreatedAt: at}, []string{"created_at"}},
+		{"ChatMessage", ChatMessage{ID: "m_1", CreatedAt: at}, []string{"created_at"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.record)
+			if err != nil {
+				t.Fatalf("json.Marshal: %v", err)
+			}
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("json.Unmarshal: %v", err)
+			}
+			for _, field := range tt.fields {
+				got, _ := decoded[field].(string)
+				if got != want {
+					t.Errorf("%s = %q, want %q", field, got, want)
+				}
+				if _, err := time.Parse(time.RFC3339, got); err != nil {
+					t.Errorf("%s = %q is not ISO 8601: %v", field, got, err)
+				}
+			}
+		})
+	}
+}
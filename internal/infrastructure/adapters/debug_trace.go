@@ -0,0 +1,104 @@
+package adapters
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DebugTrace records where time went while answering a single request.
+// It travels through the context so adapters can attach provider timings.
+type DebugTrace struct {
+	mu          sync.Mutex
+	Stages      []TraceStage      `json:"stages"`
+	Generations []GenerationStats `json:"generations"`
+	Host        *HostMetrics      `json:"host,omitempty"`
+	Flags       map[string]bool   `json:"flags,omitempty"`
+	// Confidence shows the signals the answer's confidence was built from
+	Confidence *ConfidenceBreakdown `json:"confidence,omitempty"`
+}
+
+type TraceStage struct {
+	Name       string  `json:"name"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type debugTraceKey struct{}
+
+func NewDebugTrace() *DebugTrace {
+	return &DebugTrace{
+		Stages:      []TraceStage{},
+		Generations: []GenerationStats{},
+	}
+}
+
+// WithDebugTrace attaches a trace to the context
+func WithDebugTrace(ctx context.Context, trace *DebugTrace) context.Context {
+	return context.WithValue(ctx, debugTraceKey{}, trace)
+}
+
+// DebugTraceFromContext returns the trace attached to ctx, or nil
+func DebugTraceFromContext(ctx context.Context) *DebugTrace {
+	trace, _ := ctx.Value(debugTraceKey{}).(*DebugTrace)
+	return trace
+}
+
+// AddStage records how long a pipeline stage took. Safe on a nil trace.
+func (t *DebugTrace) AddStage(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Stages = append(t.Stages, TraceStage{Name: name, DurationMs: float64(d.Microseconds()) / 1000})
+}
+
+// AddGeneration records provider timings for an LLM call. Safe on a nil trace.
+func (t *DebugTrace) AddGeneration(stats GenerationStats) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Generations = append(t.Generations, stats)
+}
+
+// SetFlags records the feature flags the request ran with. Safe on a nil trace.
+func (t *DebugTrace) SetFlags(flags map[string]bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Flags = flags
+}
+
+// SetConfidence records how the answer's confidence was computed. Safe on a
+// nil trace.
+func (t *DebugTrace) SetConfidence(breakdown *ConfidenceBreakdown) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Confidence = breakdown
+}
+
+// Finish snapshots host metrics once the request is done
+func (t *DebugTrace) Finish() {
+	if t == nil {
+		return
+	}
+	host := ReadHostMetrics()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Host = &host
+}
+
+// recordGeneration reports generation stats to the metrics registry and the
+// request's debug trace and usage meter, if any
+func recordGeneration(ctx context.Context, stats GenerationStats) {
+	DefaultMetrics.RecordGeneration(stats)
+	DebugTraceFromContext(ctx).AddGeneration(stats)
+	UsageMeterFromContext(ctx).AddTokens(stats.PromptEvalCount + stats.EvalCount)
+}
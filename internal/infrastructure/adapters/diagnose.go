@@ -0,0 +1,295 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Diagnostic check results
+const (
+	DiagnosticPass = "pass"
+	DiagnosticWarn = "warn"
+	DiagnosticFail = "fail"
+	DiagnosticSkip = "skip"
+)
+
+// Free disk space below which the disk check warns
+const (
+	minFreeDiskBytes   = 1 << 30
+	minFreeDiskPercent = 5
+)
+
+// DiagnosticCheck is one check's outcome; Fix says what to do about a
+// failure or warning
+type DiagnosticCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+	Fix        string `json:"fix,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// DiagnosticReport is the result of a Diagnose run; Status is the worst
+// check status
+type DiagnosticReport struct {
+	Status string            `json:"status"`
+	Checks []DiagnosticCheck `json:"checks"`
+	RanAt  string            `json:"ran_at"`
+}
+
+// Diagnostics runs setup checks against the service's dependencies. Ollama
+// and Gemini are nil unless that provider is configured.
+type Diagnostics struct {
+	RAG    *SimpleRAGService
+	Ollama *OllamaAdapter
+	Gemini *GoogleGeminiAdapter
+}
+
+// Run performs every check, each with its own timeout
+func (d *Diagnostics) Run(ctx context.Context) *DiagnosticReport {
+	checks := []struct {
+		name string
+		run  func(ctx context.Context) DiagnosticCheck
+	}{
+		{"database", d.checkDatabase},
+		{"migrations", d.checkMigrations},
+		{"indexes", d.checkIndexes},
+		{"object_storage", d.checkBuckets},
+		{"bucket_policy", d.checkBucketPolicy},
+		{"llm_model", d.checkLLM},
+		{"thumbnails", d.checkThumbnails},
+		{"disk_space", d.checkDisk},
+	}
+
+	report := &DiagnosticReport{Status: DiagnosticPass, RanAt: time.Now().UTC().Format(time.RFC3339)}
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		started := time.Now()
+		result := c.run(checkCtx)
+		cancel()
+
+		result.Name = c.name
+		result.DurationMs = time.Since(started).Milliseconds()
+		report.Checks = append(report.Checks, result)
+
+		switch {
+		case result.Status == DiagnosticFail:
+			report.Status = DiagnosticFail
+		case result.Status == DiagnosticWarn && report.Status == DiagnosticPass:
+			report.Status = DiagnosticWarn
+		}
+	}
+	return report
+}
+
+func (d *Diagnostics) checkDatabase(ctx context.Context) DiagnosticCheck {
+	if err := d.RAG.MySQLAdapter.HealthCheck(); err != nil {
+		return DiagnosticCheck{
+			Status:  DiagnosticFail,
+			Message: fmt.Sprintf("MySQL is unreachable: %v", err),
+			Fix:     "Check that MySQL is running and MYSQL_HOST, MYSQL_PORT, MYSQL_USER and MYSQL_PASSWORD are correct",
+		}
+	}
+	return DiagnosticCheck{Status: DiagnosticPass, Message: "MySQL is reachable"}
+}
+
+func (d *Diagnostics) checkMigrations(ctx context.Context) DiagnosticCheck {
+	version, err := d.RAG.DatabaseSchema.GetSchemaVersion()
+	if err != nil {
+		return DiagnosticCheck{
+			Status:  DiagnosticFail,
+			Message: fmt.Sprintf("Schema version is not recorded: %v", err),
+			Fix:     "Restart the service so it creates and migrates its tables; check the startup log for table errors",
+		}
+	}
+	switch {
+	case version < SchemaVersion:
+		return DiagnosticCheck{
+			Status:  DiagnosticFail,
+			Message: fmt.Sprintf("Database is at schema version %d, this build expects %d", version, SchemaVersion),
+			Fix:     "Restart the service to apply migrations; check the startup log for migration errors",
+		}
+	case version > SchemaVersion:
+		return DiagnosticCheck{
+			Status:  DiagnosticWarn,
+			Message: fmt.Sprintf("Database is at schema version %d, newer than this build's %d", version, SchemaVersion),
+			Fix:     "A newer release migrated this database; upgrade this instance to match",
+		}
+	}
+	return DiagnosticCheck{Status: DiagnosticPass, Message: fmt.Sprintf("Schema version %d is applied", version)}
+}
+
+func (d *Diagnostics) checkIndexes(ctx context.Context) DiagnosticCheck {
+	present, err := d.RAG.DatabaseSchema.GetSchemaIndexes()
+	if err != nil {
+		return DiagnosticCheck{Status: DiagnosticFail, Message: fmt.Sprintf("Failed to read the schema: %v", err)}
+	}
+
+	var missingTables, missingIndexes []string
+	for table, indexes := range schemaIndexes {
+		if present[table] == nil {
+			missingTables = append(missingTables, table)
+			continue
+		}
+		for _, index := range indexes {
+			if !present[table][index] {
+				missingIndexes = append(missingIndexes, table+"."+index)
+			}
+		}
+	}
+	sort.Strings(missingTables)
+	sort.Strings(missingIndexes)
+
+	if len(missingTables) > 0 {
+		return DiagnosticCheck{
+			Status:  DiagnosticFail,
+			Message: "Missing tables: " + strings.Join(missingTables, ", "),
+			Fix:     "Restart the service so it creates them; the MySQL user needs CREATE privileges",
+		}
+	}
+	if len(missingIndexes) > 0 {
+		return DiagnosticCheck{
+			Status:  DiagnosticWarn,
+			Message: "Missing indexes: " + strings.Join(missingIndexes, ", "),
+			Fix:     "These tables predate their indexes; add them with CREATE INDEX as defined in CreateTables",
+		}
+	}
+	return DiagnosticCheck{Status: DiagnosticPass, Message: fmt.Sprintf("All %d tables and their indexes are present", len(schemaIndexes))}
+}
+
+func (d *Diagnostics) checkBuckets(ctx context.Context) DiagnosticCheck {
+	buckets := []string{"documents"}
+	if d.RAG.Config.TieringAfter > 0 && d.RAG.Config.TieringMode == TieringModeArchive {
+		buckets = append(buckets, d.RAG.Config.TieringBucket)
+	}
+
+	for _, bucket := range buckets {
+		exists, err := d.RAG.MinIOAdapter.Client.BucketExists(ctx, bucket)
+		if err != nil {
+			return DiagnosticCheck{
+				Status:  DiagnosticFail,
+				Message: fmt.Sprintf("MinIO is unreachable: %v", err),
+				Fix:     "Check that MinIO is running and MINIO_ENDPOINT, MINIO_ACCESS_KEY and MINIO_SECRET_KEY are correct",
+			}
+		}
+		if !exists {
+			return DiagnosticCheck{
+				Status:  DiagnosticFail,
+				Message: fmt.Sprintf("Bucket %q does not exist", bucket),
+				Fix:     "Restart the service to create it, or create it with: mc mb <alias>/" + bucket,
+			}
+		}
+	}
+	return DiagnosticCheck{Status: DiagnosticPass, Message: "Buckets exist: " + strings.Join(buckets, ", ")}
+}
+
+// checkBucketPolicy warns when the documents bucket is readable without
+// credentials, which bypasses signed download links
+func (d *Diagnostics) checkBucketPolicy(ctx context.Context) DiagnosticCheck {
+	policy, err := d.RAG.MinIOAdapter.Client.GetBucketPolicy(ctx, "documents")
+	if err != nil {
+		return DiagnosticCheck{Status: DiagnosticWarn, Message: fmt.Sprintf("Failed to read the bucket policy: %v", err)}
+	}
+	if policy == "" {
+		return DiagnosticCheck{Status: DiagnosticPass, Message: "Documents bucket is private"}
+	}
+
+	var parsed struct {
+		Statement []struct {
+			Effect    string      `json:"Effect"`
+			Principal interface{} `json:"Principal"`
+		} `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(policy), &parsed); err != nil {
+		return DiagnosticCheck{Status: DiagnosticWarn, Message: fmt.Sprintf("Bucket policy is not valid JSON: %v", err)}
+	}
+	for _, statement := range parsed.Statement {
+		principal, _ := json.Marshal(statement.Principal)
+		if statement.Effect == "Allow" && strings.Contains(string(principal), `"*"`) {
+			return DiagnosticCheck{
+				Status:  DiagnosticWarn,
+				Message: "Documents bucket allows anonymous access, bypassing signed download links",
+				Fix:     "Make it private with: mc anonymous set none <alias>/documents",
+			}
+		}
+	}
+	return DiagnosticCheck{Status: DiagnosticPass, Message: "Documents bucket has no anonymous access"}
+}
+
+func (d *Diagnostics) checkLLM(ctx context.Context) DiagnosticCheck {
+	switch {
+	case d.Ollama != nil:
+		return d.checkOllama(ctx)
+	case d.Gemini != nil:
+		if err := d.Gemini.CheckModel(ctx); err != nil {
+			return DiagnosticCheck{
+				Status:  DiagnosticFail,
+				Message: fmt.Sprintf("Gemini check failed: %v", err),
+				Fix:     "Check GOOGLE_API_KEY and GOOGLE_MODEL; keys are managed at https://aistudio.google.com/apikey",
+			}
+		}
+		return DiagnosticCheck{Status: DiagnosticPass, Message: fmt.Sprintf("Gemini accepts the API key and model %q exists", d.Gemini.Config.GoogleModel)}
+	}
+	return DiagnosticCheck{
+		Status:  DiagnosticSkip,
+		Message: "No LLM provider is configured, answers are retrieval-only",
+		Fix:     "Set LLM_PROVIDER to ollama or google for generated answers",
+	}
+}
+
+func (d *Diagnostics) checkOllama(ctx context.Context) DiagnosticCheck {
+	model := d.Ollama.Config.OllamaModel
+	models, err := d.Ollama.ListModels(ctx)
+	if err != nil {
+		return DiagnosticCheck{
+			Status:  DiagnosticFail,
+			Message: fmt.Sprintf("Ollama is unreachable: %v", err),
+			Fix:     "Check that Ollama is running and OLLAMA_HOST and OLLAMA_PORT are correct",
+		}
+	}
+
+	if modelPulled(models, model) {
+		return DiagnosticCheck{Status: DiagnosticPass, Message: fmt.Sprintf("Model %q is available on Ollama", model)}
+	}
+	return DiagnosticCheck{
+		Status:  DiagnosticFail,
+		Message: fmt.Sprintf("Model %q is not pulled; Ollama has: %s", model, strings.Join(models, ", ")),
+		Fix:     "Pull it with: ollama pull " + model,
+	}
+}
+
+func (d *Diagnostics) checkThumbnails(ctx context.Context) DiagnosticCheck {
+	if !d.RAG.Thumbnails.UsesPoppler() {
+		return DiagnosticCheck{
+			Status:  DiagnosticWarn,
+			Message: "pdftoppm is not installed, thumbnails are layout sketches",
+			Fix:     "Install poppler-utils for rendered thumbnails",
+		}
+	}
+	return DiagnosticCheck{Status: DiagnosticPass, Message: "Thumbnails are rendered with pdftoppm"}
+}
+
+// checkDisk looks at the temporary directory, where PDFs are unpacked for
+// thumbnails; MySQL and MinIO disks are reported by those services
+func (d *Diagnostics) checkDisk(ctx context.Context) DiagnosticCheck {
+	dir := os.TempDir()
+	free, total, err := diskSpace(dir)
+	if err != nil {
+		return DiagnosticCheck{Status: DiagnosticSkip, Message: fmt.Sprintf("Disk space of %s is unavailable: %v", dir, err)}
+	}
+
+	message := fmt.Sprintf("%s has %.1f GB free of %.1f GB", dir, float64(free)/(1<<30), float64(total)/(1<<30))
+	if free < minFreeDiskBytes || (total > 0 && free*100/total < minFreeDiskPercent) {
+		return DiagnosticCheck{
+			Status:  DiagnosticWarn,
+			Message: message,
+			Fix:     "Free up space or give the container a larger volume",
+		}
+	}
+	return DiagnosticCheck{Status: DiagnosticPass, Message: message}
+}
@@ -0,0 +1,183 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/template"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// defaultDigestSubject and defaultDigestTemplate are used unless
+// DIGEST_SUBJECT or DIGEST_TEMPLATE_FILE replace them
+const (
+	defaultDigestSubject  = `Your document digest: {{len .Documents}} new documents, {{len .SavedQueries}} saved questions`
+	defaultDigestTemplate = `Hello,
+
+Here is what happened {{if .Since}}since {{.Since}}{{else}}recently{{end}}.
+{{if .SavedQueries}}
+Saved questions
+{{range .SavedQueries}}
+* {{.Question}}
+  {{truncate .LastAnswer 500}}
+{{end}}{{end}}{{if .Documents}}
+Newly processed documents
+{{range .Documents}}
+* {{.Title}}
+{{end}}{{end}}{{if .Failed}}
+Documents that failed to process
+{{range .Failed}}
+* {{.Title}}: {{.Message}}
+{{end}}{{end}}`
+)
+
+// DigestData is what digest templates are rendered with
+type DigestData struct {
+	Recipient    string
+	Email        string
+	Since        string
+	SavedQueries []SavedQueryRecord
+	Documents    []NotificationRecord
+	Failed       []NotificationRecord
+}
+
+// Digests periodically emails recipients who opted in a digest of their
+// saved-query results and processed documents
+type Digests struct {
+	Interval time.Duration
+	mailer   *Mailer
+	subject  *template.Template
+	body     *template.Template
+	ds       *DatabaseSchema
+}
+
+var digestFuncs = template.FuncMap{
+	"truncate": TruncateRunes,
+}
+
+// NewDigests returns nil unless DIGEST_INTERVAL and SMTP are configured.
+// Templates that fail to load or parse fall back to the defaults.
+func NewDigests(cfg *config.Config, ds *DatabaseSchema, mailer *Mailer) *Digests {
+	if cfg.DigestInterval <= 0 {
+		return nil
+	}
+	if mailer == nil {
+		log.Println("Warning: DIGEST_INTERVAL is set but SMTP_HOST is empty, digests stay off")
+		return nil
+	}
+
+	subject := template.Must(template.New("subject").Funcs(digestFuncs).Parse(defaultDigestSubject))
+	if cfg.DigestSubject != "" {
+		if parsed, err := template.New("subject").Funcs(digestFuncs).Parse(cfg.DigestSubject); err != nil {
+			log.Printf("Warning: invalid DIGEST_SUBJECT, using the default: %v", err)
+		} else {
+			subject = parsed
+		}
+	}
+
+	body := template.Must(template.New("body").Funcs(digestFuncs).Parse(defaultDigestTemplate))
+	if cfg.DigestTemplateFile != "" {
+		if data, err := os.ReadFile(cfg.DigestTemplateFile); err != nil {
+			log.Printf("Warning: failed to read DIGEST_TEMPLATE_FILE, using the default: %v", err)
+		} else if parsed, err := template.New("body").Funcs(digestFuncs).Parse(string(data)); err != nil {
+			log.Printf("Warning: invalid DIGEST_TEMPLATE_FILE, using the default: %v", err)
+		} else {
+			body = parsed
+		}
+	}
+
+	return &Digests{Interval: cfg.DigestInterval, mailer: mailer, subject: subject, body: body, ds: ds}
+}
+
+// Send emails every opted-in recipient who has something new and returns
+// how many digests went out
+func (d *Digests) Send(ctx context.Context) (int, error) {
+	recipients, err := d.ds.GetDigestRecipients()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get digest recipients: %w", err)
+	}
+
+	sent := 0
+	for _, settings := range recipients {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		ok, err := d.sendOne(settings)
+		if err != nil {
+			log.Printf("Warning: digest for %s failed: %v", settings.Recipient, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendOne emails one recipient's digest, reporting whether there was
+// anything to send
+func (d *Digests) sendOne(settings NotificationSettings) (bool, error) {
+	data := DigestData{Recipient: settings.Recipient, Email: settings.Email}
+	if settings.DigestSentAt != nil {
+		data.Since = formatTimestamp(*settings.DigestSentAt)
+	}
+
+	var err error
+	if data.SavedQueries, err = d.ds.GetDigestSavedQueries(settings.Recipient, d.Interval); err != nil {
+		return false, err
+	}
+	notifications, err := d.ds.GetDigestNotifications(settings.Recipient,
+		[]string{NotificationDocumentProcessed, NotificationDocumentFailed}, d.Interval)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range notifications {
+		if n.Kind == NotificationDocumentFailed {
+			data.Failed = append(data.Failed, n)
+		} else {
+			data.Documents = append(data.Documents, n)
+		}
+	}
+
+	if len(data.SavedQueries) == 0 && len(data.Documents) == 0 && len(data.Failed) == 0 {
+		return false, d.ds.MarkDigestSent(settings.Recipient)
+	}
+
+	var subject, body bytes.Buffer
+	if err := d.subject.Execute(&subject, data); err != nil {
+		return false, fmt.Errorf("failed to render digest subject: %w", err)
+	}
+	if err := d.body.Execute(&body, data); err != nil {
+		return false, fmt.Errorf("failed to render digest: %w", err)
+	}
+	if err := d.mailer.Send(settings.Email, subject.String(), body.String()); err != nil {
+		return false, err
+	}
+	return true, d.ds.MarkDigestSent(settings.Recipient)
+}
+
+// Start runs Send every Interval until ctx is cancelled
+func (d *Digests) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if sent, err := d.Send(ctx); err != nil {
+				log.Printf("Warning: digests failed: %v", err)
+			} else if sent > 0 {
+				log.Printf("✅ Sent %d digests", sent)
+			}
+		}
+	}()
+}
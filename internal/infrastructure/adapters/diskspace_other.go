@@ -0,0 +1,9 @@
+//go:build !unix
+
+package adapters
+
+import "errors"
+
+func diskSpace(path string) (free, total uint64, err error) {
+	return 0, 0, errors.New("not supported on this platform")
+}
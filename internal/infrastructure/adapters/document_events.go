@@ -0,0 +1,39 @@
+package adapters
+
+import (
+	"context"
+	"log"
+)
+
+// Document event kinds, recorded as a document is ingested so its owner
+// can see why it does or doesn't answer questions
+const (
+	DocumentEventUploaded    = "uploaded"
+	DocumentEventExtracted   = "extracted"
+	DocumentEventEmbedded    = "embedded"
+	DocumentEventNeedsOCR    = "needs_ocr"
+	DocumentEventFailed      = "failed"
+	DocumentEventReprocessed = "reprocessed"
+	DocumentEventSuperseded  = "superseded"
+)
+
+// recordEvent adds an event to a document's log; a failure only logs a
+// warning, since the log mustn't fail ingestion
+func (r *SimpleRAGService) recordEvent(documentID, kind, message string) {
+	if err := r.DatabaseSchema.InsertDocumentEvent(documentID, kind, message); err != nil {
+		log.Printf("Warning: failed to record %s event of %s: %v", kind, documentID, err)
+	}
+}
+
+// DocumentEvents lists what happened to a document the caller can read,
+// oldest first
+func (r *SimpleRAGService) DocumentEvents(ctx context.Context, documentID string) ([]DocumentEvent, error) {
+	doc, err := r.DatabaseSchema.GetDocument(documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.CheckCollectionAccess(ctx, DocumentCollection(doc.Metadata), PermissionRead); err != nil {
+		return nil, err
+	}
+	return r.DatabaseSchema.GetDocumentEvents(documentID)
+}
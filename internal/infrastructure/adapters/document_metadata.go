@@ -0,0 +1,216 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Document metadata keys managed by MetadataUpdate's dedicated fields
+const (
+	MetadataTags       = "tags"
+	MetadataCollection = "collection"
+)
+
+// DocumentMetadata is the metadata a document is created with; metadata
+// updates may add other keys later
+type DocumentMetadata struct {
+	UploadedAt string `json:"uploaded_at"`
+	Collection string `json:"collection,omitempty"`
+	// Source is how the document arrived when not as an uploaded PDF
+	Source string `json:"source,omitempty"`
+}
+
+// DocumentSourceStream marks documents pushed through an ingest stream
+const DocumentSourceStream = "stream"
+
+// DocumentSource is how a document arrived, from its metadata; empty for
+// an uploaded PDF
+func DocumentSource(metadataJSON string) string {
+	var metadata DocumentMetadata
+	if json.Unmarshal([]byte(metadataJSON), &metadata) != nil {
+		return ""
+	}
+	return metadata.Source
+}
+
+// ChunkMetadata is stored with each chunk
+type ChunkMetadata struct {
+	Page       int                `json:"page"`
+	ChunkIndex int                `json:"chunk_index"`
+	Zones      map[string]float64 `json:"zones,omitempty"`
+	// Offset is where the chunk starts in its page's text, in characters
+	Offset *int `json:"offset,omitempty"`
+}
+
+// encodeJSON marshals a value for a JSON column. It is only used with the
+// metadata and source types here, which can't fail to marshal.
+func encodeJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// EncodeSources is the JSON stored for a list of cited sources; no sources
+// is an empty list
+func EncodeSources(sources []string) string {
+	if sources == nil {
+		sources = []string{}
+	}
+	return encodeJSON(sources)
+}
+
+// maxBulkDocuments caps how many documents one bulk update may touch
+const maxBulkDocuments = 1000
+
+// ErrInvalidMetadataUpdate wraps errors in the update request itself
+var ErrInvalidMetadataUpdate = errors.New("invalid metadata update")
+
+// MissingDocumentsError lists requested documents that do not exist
+type MissingDocumentsError struct {
+	IDs []string
+}
+
+func (e *MissingDocumentsError) Error() string {
+	return fmt.Sprintf("documents not found: %s", strings.Join(e.IDs, ", "))
+}
+
+// MetadataUpdate is a change applied to the metadata of many documents
+type MetadataUpdate struct {
+	// Set adds or replaces metadata keys
+	Set map[string]interface{} `json:"set"`
+	// Remove deletes metadata keys
+	Remove     []string `json:"remove"`
+	AddTags    []string `json:"add_tags"`
+	RemoveTags []string `json:"remove_tags"`
+	// Collection moves the documents to a collection; "" removes them from it
+	Collection *string `json:"collection"`
+}
+
+// Validate rejects empty updates and changes to the managed keys outside
+// their dedicated fields
+func (u *MetadataUpdate) Validate() error {
+	if len(u.Set) == 0 && len(u.Remove) == 0 && len(u.AddTags) == 0 && len(u.RemoveTags) == 0 && u.Collection == nil {
+		return fmt.Errorf("%w: update has no changes", ErrInvalidMetadataUpdate)
+	}
+	for key := range u.Set {
+		if key == MetadataTags || key == MetadataCollection {
+			return fmt.Errorf("%w: use add_tags, remove_tags or collection to change %q", ErrInvalidMetadataUpdate, key)
+		}
+	}
+	for _, key := range u.Remove {
+		if key == MetadataTags || key == MetadataCollection {
+			return fmt.Errorf("%w: use add_tags, remove_tags or collection to change %q", ErrInvalidMetadataUpdate, key)
+		}
+	}
+	return nil
+}
+
+// Apply returns the metadata JSON with the update applied
+func (u *MetadataUpdate) Apply(metadataJSON string) (string, error) {
+	var metadata map[string]interface{}
+	if metadataJSON != "" {
+		if err := json.Unmarshal([]byte(metadataJSON), &metadata); err != nil {
+			return "", fmt.Errorf("stored metadata is not a JSON object: %w", err)
+		}
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+
+	for key, value := range u.Set {
+		metadata[key] = value
+	}
+	for _, key := range u.Remove {
+		delete(metadata, key)
+	}
+
+	if len(u.AddTags) > 0 || len(u.RemoveTags) > 0 {
+		tags := make(map[string]bool)
+		if existing, ok := metadata[MetadataTags].([]interface{}); ok {
+			for _, tag := range existing {
+				if s, ok := tag.(string); ok {
+					tags[s] = true
+				}
+			}
+		}
+		for _, tag := range u.AddTags {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags[tag] = true
+			}
+		}
+		for _, tag := range u.RemoveTags {
+			delete(tags, strings.TrimSpace(tag))
+		}
+
+		sorted := make([]string, 0, len(tags))
+		for tag := range tags {
+			sorted = append(sorted, tag)
+		}
+		sort.Strings(sorted)
+		metadata[MetadataTags] = sorted
+	}
+
+	if u.Collection != nil {
+		if collection := strings.TrimSpace(*u.Collection); collection != "" {
+			metadata[MetadataCollection] = collection
+		} else {
+			delete(metadata, MetadataCollection)
+		}
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// BulkUpdateMetadata applies an update to every listed document in one
+// transaction: either all documents change or none do. The caller needs
+// write access to every collection a document leaves or joins.
+func (r *SimpleRAGService) BulkUpdateMetadata(ctx context.Context, documentIDs []string, update *MetadataUpdate) (int, error) {
+	if err := update.Validate(); err != nil {
+		return 0, err
+	}
+
+	seen := make(map[string]bool, len(documentIDs))
+	var ids []string
+	for _, id := range documentIDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("%w: document_ids is required", ErrInvalidMetadataUpdate)
+	}
+	if len(ids) > maxBulkDocuments {
+		return 0, fmt.Errorf("%w: at most %d documents can be updated at once", ErrInvalidMetadataUpdate, maxBulkDocuments)
+	}
+
+	guard, err := r.collectionGuard(ctx)
+	if err != nil {
+		return 0, err
+	}
+	apply := func(metadata string) (string, error) {
+		if !guard.Allows(DocumentCollection(metadata), PermissionWrite) {
+			return "", fmt.Errorf("%w %q", ErrCollectionForbidden, DocumentCollection(metadata))
+		}
+		updated, err := update.Apply(metadata)
+		if err != nil {
+			return "", err
+		}
+		if !guard.Allows(DocumentCollection(updated), PermissionWrite) {
+			return "", fmt.Errorf("%w %q", ErrCollectionForbidden, DocumentCollection(updated))
+		}
+		return updated, nil
+	}
+
+	if err := r.DatabaseSchema.UpdateDocumentsMetadata(ids, apply); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
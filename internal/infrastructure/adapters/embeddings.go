@@ -0,0 +1,560 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// Embedding providers, selected by EMBEDDER_PROVIDER
+const (
+	EmbedderNone   = "none"
+	EmbedderHash   = "hash"
+	EmbedderOllama = "ollama"
+	EmbedderGoogle = "google"
+)
+
+const (
+	// defaultOllamaEmbeddingModel and defaultGoogleEmbeddingModel apply when
+	// EMBEDDER_MODEL is unset
+	defaultOllamaEmbeddingModel = "nomic-embed-text"
+	defaultGoogleEmbeddingModel = "text-embedding-004"
+	// defaultHashDimensions applies when EMBEDDER_DIMENSIONS is unset
+	defaultHashDimensions = 384
+	// geminiEmbedBatch is the most texts batchEmbedContents takes at once
+	geminiEmbedBatch = 100
+	// defaultVectorWeight applies when VECTOR_WEIGHT is unset
+	defaultVectorWeight = 30
+)
+
+// Embedder turns texts into vectors for semantic retrieval
+type Embedder interface {
+	// Embed returns one vector per text, in order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Name identifies the provider and model; vectors of different
+	// embedders aren't comparable
+	Name() string
+	// Dimensions is the length of the vectors Embed returns
+	Dimensions() int
+}
+
+// ErrIncompatibleVector means a vector's length doesn't match the current
+// embedder's dimensions, as when a model was replaced under the same name.
+// Such vectors are never compared; BackfillEmbeddings re-embeds them.
+var ErrIncompatibleVector = errors.New("vector dimensions don't match the embedder")
+
+// NewEmbedder returns the embedder EMBEDDER_PROVIDER selects, or nil for
+// "none". A provider that can't be set up is an error rather than a
+// silent switch to another embedder, whose vectors would rank differently.
+func NewEmbedder(cfg *config.Config, secrets *Secrets) (Embedder, error) {
+	provider := strings.ToLower(strings.TrimSpace(cfg.EmbedderProvider))
+	var embedder Embedder
+	var err error
+	switch provider {
+	case EmbedderNone, "":
+		return nil, nil
+	case EmbedderHash:
+		embedder = NewHashingEmbedder(cfg.EmbedderDimensions)
+	case EmbedderOllama:
+		embedder, err = NewOllamaEmbedder(cfg)
+	case EmbedderGoogle:
+		embedder, err = NewGeminiEmbedder(cfg, secrets)
+	default:
+		err = fmt.Errorf("unknown EMBEDDER_PROVIDER %q", cfg.EmbedderProvider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("✅ Embeddings by %s", embedder.Name())
+	return embedder, nil
+}
+
+// OllamaEmbedder embeds through Ollama's /api/embed
+type OllamaEmbedder struct {
+	Client  *http.Client
+	BaseURL string
+	Model   string
+	dims    int
+}
+
+// NewOllamaEmbedder checks that Ollama is reachable and has the embedding
+// model
+func NewOllamaEmbedder(cfg *config.Config) (*OllamaEmbedder, error) {
+	port, err := strconv.Atoi(cfg.OllamaPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Ollama port: %w", err)
+	}
+	model := cfg.EmbedderModel
+	if model == "" {
+		model = defaultOllamaEmbeddingModel
+	}
+	e := &OllamaEmbedder{
+		Client:  &http.Client{Timeout: 60 * time.Second},
+		BaseURL: fmt.Sprintf("http://%s:%d", cfg.OllamaHost, port),
+		Model:   model,
+	}
+
+	e.dims, err = probeDimensions(e)
+	if err != nil {
+		return nil, fmt.Errorf("Ollama embedding model %s unavailable: %w", model, err)
+	}
+	return e, nil
+}
+
+// probeDimensions embeds a test text to check the embedder answers and
+// learn its vectors' length
+func probeDimensions(e Embedder) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	vectors, err := e.Embed(ctx, []string{"ping"})
+	if err != nil {
+		return 0, err
+	}
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return 0, errors.New("returned no vector")
+	}
+	return len(vectors[0]), nil
+}
+
+func (e *OllamaEmbedder) Name() string {
+	return EmbedderOllama + ":" + e.Model
+}
+
+func (e *OllamaEmbedder) Dimensions() int {
+	return e.dims
+}
+
+func (e *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	data, err := json.Marshal(map[string]interface{}{"model": e.Model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.BaseURL+"/api/embed", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama returned status %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("Ollama returned %d embeddings for %d texts", len(response.Embeddings), len(texts))
+	}
+	return response.Embeddings, nil
+}
+
+// GeminiEmbedder embeds through Gemini's batchEmbedContents, sharing the
+// Gemini adapter's API key handling
+type GeminiEmbedder struct {
+	Gemini *GoogleGeminiAdapter
+	Model  string
+	dims   int
+}
+
+func NewGeminiEmbedder(cfg *config.Config, secrets *Secrets) (*GeminiEmbedder, error) {
+	gemini, err := NewGoogleGeminiAdapter(cfg, secrets)
+	if err != nil {
+		return nil, err
+	}
+	model := cfg.EmbedderModel
+	if model == "" {
+		model = defaultGoogleEmbeddingModel
+	}
+	e := &GeminiEmbedder{Gemini: gemini, Model: model}
+	e.dims, err = probeDimensions(e)
+	if err != nil {
+		return nil, fmt.Errorf("Gemini embedding model %s unavailable: %w", model, err)
+	}
+	return e, nil
+}
+
+func (e *GeminiEmbedder) Name() string {
+	return EmbedderGoogle + ":" + e.Model
+}
+
+func (e *GeminiEmbedder) Dimensions() int {
+	return e.dims
+}
+
+func (e *GeminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	endpoint := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:batchEmbedContents", e.Model)
+
+	type embedRequest struct {
+		Model   string        `json:"model"`
+		Content geminiContent `json:"content"`
+	}
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += geminiEmbedBatch {
+		end := start + geminiEmbedBatch
+		if end > len(texts) {
+			end = len(texts)
+		}
+		var requests []embedRequest
+		for _, text := range texts[start:end] {
+			requests = append(requests, embedRequest{
+				Model:   "models/" + e.Model,
+				Content: geminiContent{Parts: []geminiContentPart{{Text: text}}},
+			})
+		}
+		data, err := json.Marshal(map[string]interface{}{"requests": requests})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+
+		status, body, err := e.Gemini.send(ctx, http.MethodPost, endpoint, data)
+		if err != nil {
+			return nil, err
+		}
+		if status < 200 || status >= 300 {
+			return nil, fmt.Errorf("gemini returned status %d: %s", status, string(body))
+		}
+		var response struct {
+			Embeddings []struct {
+				Values []float32 `json:"values"`
+			} `json:"embeddings"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		if len(response.Embeddings) != end-start {
+			return nil, fmt.Errorf("gemini returned %d embeddings for %d texts", len(response.Embeddings), end-start)
+		}
+		for _, embedding := range response.Embeddings {
+			vectors = append(vectors, embedding.Values)
+		}
+	}
+	return vectors, nil
+}
+
+// HashingEmbedder is feature hashing, not a model: words and their
+// character trigrams are hashed into a fixed number of dimensions. It
+// matches shared words, inflections and spelling variants, not synonyms or
+// meaning, and needs no model files or network.
+type HashingEmbedder struct {
+	dims int
+}
+
+func NewHashingEmbedder(dimensions int) *HashingEmbedder {
+	if dimensions <= 0 {
+		dimensions = defaultHashDimensions
+	}
+	return &HashingEmbedder{dims: dimensions}
+}
+
+func (e *HashingEmbedder) Name() string {
+	return fmt.Sprintf("%s:trigram-%d", EmbedderHash, e.dims)
+}
+
+func (e *HashingEmbedder) Dimensions() int {
+	return e.dims
+}
+
+func (e *HashingEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *HashingEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dims)
+	add := func(feature string, weight float32) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		// The hash's top bit picks the sign, so colliding features tend
+		// to cancel out instead of piling up
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vector[sum%uint64(e.dims)] += weight
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(NormalizeDigits(text)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		add("w:"+word, 1)
+		runes := []rune("#" + word + "#")
+		for j := 0; j+3 <= len(runes); j++ {
+			add("t:"+string(runes[j:j+3]), 0.5)
+		}
+	}
+	normalizeVector(vector)
+	return vector
+}
+
+// normalizeVector scales v to unit length, leaving a zero vector alone
+func normalizeVector(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+// cosineSimilarity compares two vectors, 0 when their lengths differ
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// encodeVector packs a vector as little-endian float32s for storage
+func encodeVector(v []float32) []byte {
+	data := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(x))
+	}
+	return data
+}
+
+func decodeVector(data []byte) []float32 {
+	v := make([]float32, len(data)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return v
+}
+
+// embedChunk stores a chunk's vector when an embedder is configured,
+// reporting whether it did; a chunk without one is ranked lexically only
+func (r *SimpleRAGService) embedChunk(ctx context.Context, chunkID, text string) bool {
+	if r.Embedder == nil {
+		return false
+	}
+	vectors, err := r.Embedder.Embed(ctx, []string{text})
+	if err != nil {
+		log.Printf("Warning: failed to embed chunk %s: %v", chunkID, err)
+		if ctx.Err() == nil {
+			r.VectorHealth.Failed(err)
+		}
+		return false
+	}
+	r.VectorHealth.Succeeded()
+	if err := r.checkVector(vectors[0]); err != nil {
+		log.Printf("Warning: not storing the vector of chunk %s: %v", chunkID, err)
+		return false
+	}
+	if err := r.DatabaseSchema.InsertChunkEmbedding(chunkID, r.Embedder.Name(), vectors[0]); err != nil {
+		log.Printf("Warning: failed to store embedding of chunk %s: %v", chunkID, err)
+		return false
+	}
+	if r.Vectors != nil {
+		r.Vectors.Put(chunkID, vectors[0])
+	}
+	return true
+}
+
+// attachSimilarity sets each chunk's Similarity to the question from the
+// vectors stored by the current embedder. Without an embedder, or if the
+// question can't be embedded, chunks keep a similarity of 0. Failures, and
+// skipping vector search during an outage, are recorded as a degradation
+// of the request.
+func (r *SimpleRAGService) attachSimilarity(ctx context.Context, question string, chunks []ChunkRecord) {
+	if r.Embedder == nil {
+		if r.VectorHealth.SetupError() != "" {
+			DegradationFromContext(ctx).Add(DegradedVectorSearch)
+		}
+		return
+	}
+	if len(chunks) == 0 {
+		return
+	}
+	if !r.VectorHealth.Available() {
+		DegradationFromContext(ctx).Add(DegradedVectorSearch)
+		return
+	}
+	start := time.Now()
+	defer func() { DebugTraceFromContext(ctx).AddStage("embedding", time.Since(start)) }()
+
+	query, err := r.Embedder.Embed(ctx, []string{question})
+	if err == nil {
+		err = r.checkVector(query[0])
+	}
+	if err != nil {
+		log.Printf("Warning: failed to embed question, ranking lexically: %v", err)
+		r.vectorSearchFailed(ctx, err)
+		return
+	}
+	ids := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		ids[i] = chunk.ID
+	}
+	vectors, err := r.chunkVectors(ids)
+	if err != nil {
+		log.Printf("Warning: failed to load chunk embeddings, ranking lexically: %v", err)
+		r.vectorSearchFailed(ctx, err)
+		return
+	}
+	r.VectorHealth.Succeeded()
+	incompatible := 0
+	for i := range chunks {
+		vector, ok := vectors[chunks[i].ID]
+		if !ok {
+			DegradationFromContext(ctx).Add(DegradedMissingVectors)
+			continue
+		}
+		if r.checkVector(vector) != nil {
+			incompatible++
+			continue
+		}
+		chunks[i].Similarity = math.Max(0, cosineSimilarity(query[0], vector))
+	}
+	if incompatible > 0 {
+		log.Printf("Warning: %d chunk vectors don't have %s's %d dimensions, ranking them lexically until POST /admin/embeddings/backfill re-embeds them",
+			incompatible, r.Embedder.Name(), r.Embedder.Dimensions())
+		DegradationFromContext(ctx).Add(DegradedIncompatibleVectors)
+	}
+}
+
+// checkVector returns ErrIncompatibleVector unless vector has the current
+// embedder's dimensions
+func (r *SimpleRAGService) checkVector(vector []float32) error {
+	if want := r.Embedder.Dimensions(); len(vector) != want {
+		return fmt.Errorf("%w: %d dimensions, %s makes %d", ErrIncompatibleVector, len(vector), r.Embedder.Name(), want)
+	}
+	return nil
+}
+
+// embeddingBackfillBatch is how many chunks BackfillEmbeddings sends the
+// embedder at once
+const embeddingBackfillBatch = 32
+
+// ErrNoEmbedder is returned for vector work when EMBEDDER_PROVIDER is "none"
+// or its embedder couldn't be set up
+var ErrNoEmbedder = errors.New("no embedder is configured")
+
+// EmbeddingBackfill reports a BackfillEmbeddings run
+type EmbeddingBackfill struct {
+	Model      string `json:"model"`
+	Dimensions int    `json:"dimensions"`
+	Embedded   int    `json:"embedded"`
+	// Remaining counts the chunks still without a vector from Model of
+	// Dimensions
+	Remaining int `json:"remaining"`
+}
+
+// BackfillEmbeddings embeds up to limit chunks that have no usable vector
+// from the current embedder: those indexed before it was configured, under
+// another embedder, while it was down, or with vectors of other dimensions
+// than it now makes. Until then they score a similarity of 0.
+func (r *SimpleRAGService) BackfillEmbeddings(ctx context.Context, limit int) (*EmbeddingBackfill, error) {
+	if r.Embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	model, dims := r.Embedder.Name(), r.Embedder.Dimensions()
+	chunks, err := r.DatabaseSchema.GetChunksWithoutEmbedding(model, dims, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks without vectors: %w", err)
+	}
+
+	result := &EmbeddingBackfill{Model: model, Dimensions: dims}
+	for start := 0; start < len(chunks); start += embeddingBackfillBatch {
+		end := start + embeddingBackfillBatch
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+		batch := chunks[start:end]
+		texts := make([]string, len(batch))
+		for i, chunk := range batch {
+			texts[i] = chunk.ChunkText
+		}
+		vectors, err := r.Embedder.Embed(ctx, texts)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.VectorHealth.Failed(err)
+			}
+			return result, fmt.Errorf("failed to embed chunks: %w", err)
+		}
+		r.VectorHealth.Succeeded()
+		for i, chunk := range batch {
+			if err := r.checkVector(vectors[i]); err != nil {
+				return result, fmt.Errorf("failed to embed chunk %s: %w", chunk.ID, err)
+			}
+			if err := r.DatabaseSchema.InsertChunkEmbedding(chunk.ID, model, vectors[i]); err != nil {
+				return result, fmt.Errorf("failed to store embedding of chunk %s: %w", chunk.ID, err)
+			}
+			if r.Vectors != nil {
+				r.Vectors.Put(chunk.ID, vectors[i])
+			}
+			result.Embedded++
+		}
+	}
+
+	result.Remaining, err = r.DatabaseSchema.CountChunksWithoutEmbedding(model, dims)
+	if err != nil {
+		return result, fmt.Errorf("failed to count chunks without vectors: %w", err)
+	}
+	return result, nil
+}
+
+// MissingEmbeddings counts the chunks without a usable vector from the
+// current embedder, 0 without an embedder
+func (r *SimpleRAGService) MissingEmbeddings() (int, error) {
+	if r.Embedder == nil {
+		return 0, nil
+	}
+	return r.DatabaseSchema.CountChunksWithoutEmbedding(r.Embedder.Name(), r.Embedder.Dimensions())
+}
+
+// vectorSearchFailed records a vector search failure, unless the request
+// itself was canceled, and degrades the request to lexical ranking
+func (r *SimpleRAGService) vectorSearchFailed(ctx context.Context, err error) {
+	if ctx.Err() == nil {
+		r.VectorHealth.Failed(err)
+	}
+	DegradationFromContext(ctx).Add(DegradedVectorSearch)
+}
+
+// vectorWeight is how much similarity adds to the built-in score
+func (r *SimpleRAGService) vectorWeight() float64 {
+	if r.Config == nil || r.Config.VectorWeight < 0 {
+		return defaultVectorWeight
+	}
+	return r.Config.VectorWeight
+}
@@ -0,0 +1,19 @@
+package adapters
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckVectorRejectsOtherDimensions(t *testing.T) {
+	r := &SimpleRAGService{Embedder: NewHashingEmbedder(8)}
+
+	if err := r.checkVector(make([]float32, 8)); err != nil {
+		t.Errorf("checkVector rejected a vector of the embedder's dimensions: %v", err)
+	}
+	for _, dims := range []int{0, 4, 16} {
+		if err := r.checkVector(make([]float32, dims)); !errors.Is(err, ErrIncompatibleVector) {
+			t.Errorf("checkVector(%d dimensions) = %v, want ErrIncompatibleVector", dims, err)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Dependencies faults can be injected into
+const (
+	FaultMySQL = "mysql"
+	FaultMinIO = "minio"
+	FaultLLM   = "llm"
+)
+
+// faultDriverName is the MySQL driver that injects faults, used instead of
+// "mysql" when FAULT_INJECTION is on
+const faultDriverName = "mysql+faults"
+
+// ErrInjectedFault is the error an injected failure returns
+var ErrInjectedFault = errors.New("injected fault")
+
+func init() {
+	sql.Register(faultDriverName, &faultDriver{base: &mysql.MySQLDriver{}})
+}
+
+// Fault is what to do to a dependency call: wait Delay, then fail with
+// probability ErrorRate
+type Fault struct {
+	Delay     time.Duration `json:"delay"`
+	ErrorRate float64       `json:"error_rate"`
+}
+
+// FaultPlan holds a request's faults by dependency
+type FaultPlan map[string]Fault
+
+type faultPlanKey struct{}
+
+// ParseFaultPlan reads the X-Fault-Inject header, a comma-separated list
+// of dependency=fault: "delay:<duration>" or "error[:<probability>]", e.g.
+// "llm=delay:2s, mysql=error:0.5". Faults for the same dependency combine.
+func ParseFaultPlan(header string) (FaultPlan, error) {
+	plan := make(FaultPlan)
+	for _, entry := range strings.Split(header, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		target, spec, ok := strings.Cut(entry, "=")
+		target = strings.ToLower(strings.TrimSpace(target))
+		if !ok || (target != FaultMySQL && target != FaultMinIO && target != FaultLLM) {
+			return nil, fmt.Errorf("unknown fault target in %q", entry)
+		}
+
+		fault := plan[target]
+		kind, value, hasValue := strings.Cut(strings.TrimSpace(spec), ":")
+		switch kind {
+		case "delay":
+			delay, err := time.ParseDuration(value)
+			if err != nil || delay < 0 {
+				return nil, fmt.Errorf("invalid delay in %q", entry)
+			}
+			fault.Delay = delay
+		case "error":
+			fault.ErrorRate = 1
+			if hasValue {
+				rate, err := strconv.ParseFloat(value, 64)
+				if err != nil || rate < 0 || rate > 1 {
+					return nil, fmt.Errorf("invalid error probability in %q", entry)
+				}
+				fault.ErrorRate = rate
+			}
+		default:
+			return nil, fmt.Errorf("unknown fault %q", entry)
+		}
+		plan[target] = fault
+	}
+	return plan, nil
+}
+
+// WithFaults attaches a request's fault plan to the context
+func WithFaults(ctx context.Context, plan FaultPlan) context.Context {
+	return context.WithValue(ctx, faultPlanKey{}, plan)
+}
+
+// InjectFault applies the context's fault for target, if any: it waits out
+// the delay (or until ctx is done) and may return ErrInjectedFault
+func InjectFault(ctx context.Context, target string) error {
+	plan, _ := ctx.Value(faultPlanKey{}).(FaultPlan)
+	fault, ok := plan[target]
+	if !ok {
+		return nil
+	}
+	return fault.inject(ctx, target)
+}
+
+func (f Fault) inject(ctx context.Context, target string) error {
+	if f.Delay > 0 {
+		timer := time.NewTimer(f.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if f.ErrorRate > 0 && rand.Float64() < f.ErrorRate {
+		return fmt.Errorf("%w in %s", ErrInjectedFault, target)
+	}
+	return nil
+}
+
+// mysqlFaults are the MySQL faults of the requests in flight. Database
+// calls don't carry the request context, so while a request asking for
+// MySQL faults runs they apply to every query, the worst fault winning.
+var mysqlFaults = &armedFaults{faults: make(map[int]Fault)}
+
+type armedFaults struct {
+	mu     sync.Mutex
+	faults map[int]Fault
+	next   int
+}
+
+// ArmMySQLFault applies fault to MySQL calls until the returned func is
+// called
+func ArmMySQLFault(fault Fault) (disarm func()) {
+	a := mysqlFaults
+	a.mu.Lock()
+	id := a.next
+	a.next++
+	a.faults[id] = fault
+	a.mu.Unlock()
+
+	return func() {
+		a.mu.Lock()
+		delete(a.faults, id)
+		a.mu.Unlock()
+	}
+}
+
+func (a *armedFaults) inject(ctx context.Context) error {
+	a.mu.Lock()
+	var worst Fault
+	for _, fault := range a.faults {
+		if fault.Delay > worst.Delay {
+			worst.Delay = fault.Delay
+		}
+		if fault.ErrorRate > worst.ErrorRate {
+			worst.ErrorRate = fault.ErrorRate
+		}
+	}
+	a.mu.Unlock()
+	return worst.inject(ctx, FaultMySQL)
+}
+
+// faultDriver wraps the MySQL driver so connections inject the armed faults
+type faultDriver struct {
+	base driver.Driver
+}
+
+func (d *faultDriver) Open(dsn string) (driver.Conn, error) {
+	if err := mysqlFaults.inject(context.Background()); err != nil {
+		return nil, err
+	}
+	conn, err := d.base.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &faultConn{Conn: conn}, nil
+}
+
+// faultConn injects faults before each statement, passing everything else
+// to the MySQL connection
+type faultConn struct {
+	driver.Conn
+}
+
+func (c *faultConn) Prepare(query string) (driver.Stmt, error) {
+	if err := mysqlFaults.inject(context.Background()); err != nil {
+		return nil, err
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *faultConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := mysqlFaults.inject(ctx); err != nil {
+		return nil, err
+	}
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *faultConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := mysqlFaults.inject(ctx); err != nil {
+		return nil, err
+	}
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *faultConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := mysqlFaults.inject(ctx); err != nil {
+		return nil, err
+	}
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c *faultConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := mysqlFaults.inject(ctx); err != nil {
+		return nil, err
+	}
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *faultConn) Ping(ctx context.Context) error {
+	if err := mysqlFaults.inject(ctx); err != nil {
+		return err
+	}
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *faultConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *faultConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *faultConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// faultTransport injects the request context's faults for target into
+// outgoing HTTP calls
+type faultTransport struct {
+	base   http.RoundTripper
+	target string
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := InjectFault(req.Context(), t.target); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,203 @@
+package adapters
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// Feature flag names. Experimental subsystems register a flag in
+// NewFeatureFlags and check the flags resolved for the request.
+const (
+	FlagCrossLingualFallback = "cross_lingual_fallback"
+	FlagTablePrompt          = "table_prompt"
+	FlagNumericVerification  = "numeric_verification"
+	FlagBySourceAnswers      = "by_source_answers"
+	FlagQuestionRouting      = "question_routing"
+)
+
+// FeatureFlag describes a known flag and its built-in default
+type FeatureFlag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+}
+
+// FlagState is a flag's effective value and where it came from
+type FlagState struct {
+	FeatureFlag
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source"` // "default", "env" or "admin"
+}
+
+// FeatureFlags resolves flags from built-in defaults, the FEATURE_FLAGS
+// setting ("name=true,other=false") and admin overrides stored
+// in the database, in increasing priority. Requests can override further
+// through QueryOptions.Flags.
+type FeatureFlags struct {
+	DatabaseSchema *DatabaseSchema
+
+	mu    sync.RWMutex
+	known map[string]FeatureFlag
+	env   map[string]bool
+	admin map[string]bool
+}
+
+func NewFeatureFlags(cfg *config.Config, ds *DatabaseSchema) *FeatureFlags {
+	f := &FeatureFlags{
+		DatabaseSchema: ds,
+		admin:          make(map[string]bool),
+	}
+	f.Configure(cfg)
+	return f
+}
+
+// Configure sets the flags' defaults and FEATURE_FLAGS values from cfg,
+// keeping admin overrides
+func (f *FeatureFlags) Configure(cfg *config.Config) {
+	flags := []FeatureFlag{
+		{FlagCrossLingualFallback, "Retry weak retrievals with the question translated into corpus languages", true},
+		{FlagTablePrompt, "Use the exact-cell prompt when the context contains table chunks", true},
+		{FlagNumericVerification, "Check numbers in answers against the retrieved context", cfg.NumericVerification},
+		{FlagBySourceAnswers, "Allow answer_mode=by_source for per-document answer sections", true},
+		{FlagQuestionRouting, "Answer small talk and questions about the service without retrieval", true},
+	}
+
+	known := make(map[string]FeatureFlag, len(flags))
+	for _, flag := range flags {
+		known[flag.Name] = flag
+	}
+
+	env := make(map[string]bool)
+	for _, pair := range strings.Split(cfg.FeatureFlags, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if _, isKnown := known[name]; !isKnown || err != nil {
+			log.Printf("Warning: ignoring feature flag %q from FEATURE_FLAGS", pair)
+			continue
+		}
+		env[name] = enabled
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.known = known
+	f.env = env
+}
+
+// Load reads admin overrides from the database
+func (f *FeatureFlags) Load() error {
+	overrides, err := f.DatabaseSchema.GetFeatureFlags()
+	if err != nil {
+		return fmt.Errorf("failed to load feature flags: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, enabled := range overrides {
+		if _, known := f.known[name]; known {
+			f.admin[name] = enabled
+		}
+	}
+	return nil
+}
+
+// Enabled returns the deployment-wide value of a flag
+func (f *FeatureFlags) Enabled(name string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.state(name).Enabled
+}
+
+// state resolves a flag; callers hold the lock
+func (f *FeatureFlags) state(name string) FlagState {
+	flag := f.known[name]
+	state := FlagState{FeatureFlag: flag, Enabled: flag.Default, Source: "default"}
+	if enabled, ok := f.env[name]; ok {
+		state.Enabled, state.Source = enabled, "env"
+	}
+	if enabled, ok := f.admin[name]; ok {
+		state.Enabled, state.Source = enabled, "admin"
+	}
+	return state
+}
+
+// List returns every known flag, sorted by name
+func (f *FeatureFlags) List() []FlagState {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	states := make([]FlagState, 0, len(f.known))
+	for name := range f.known {
+		states = append(states, f.state(name))
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// Set stores an admin override for a flag
+func (f *FeatureFlags) Set(name string, enabled bool) error {
+	if !f.Known(name) {
+		return fmt.Errorf("unknown feature flag %q", name)
+	}
+	if err := f.DatabaseSchema.SetFeatureFlag(name, enabled); err != nil {
+		return fmt.Errorf("failed to store feature flag: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.admin[name] = enabled
+	return nil
+}
+
+// Reset removes an admin override so env or the default applies again
+func (f *FeatureFlags) Reset(name string) error {
+	if !f.Known(name) {
+		return fmt.Errorf("unknown feature flag %q", name)
+	}
+	if err := f.DatabaseSchema.DeleteFeatureFlag(name); err != nil {
+		return fmt.Errorf("failed to reset feature flag: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.admin, name)
+	return nil
+}
+
+// Known reports whether name is a registered flag
+func (f *FeatureFlags) Known(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok := f.known[name]
+	return ok
+}
+
+// Resolve returns the effective value of every flag for one request
+func (f *FeatureFlags) Resolve(overrides map[string]bool) map[string]bool {
+	resolved := make(map[string]bool)
+	if f == nil {
+		return resolved
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for name := range f.known {
+		resolved[name] = f.state(name).Enabled
+		if enabled, ok := overrides[name]; ok {
+			resolved[name] = enabled
+		}
+	}
+	return resolved
+}
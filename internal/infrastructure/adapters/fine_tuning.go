@@ -0,0 +1,90 @@
+package adapters
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Fine-tuning dataset formats: chat messages as used by OpenAI, Axolotl and
+// most chat fine-tuning tools, or Alpaca instruction records
+const (
+	DatasetFormatMessages = "messages"
+	DatasetFormatAlpaca   = "alpaca"
+)
+
+// datasetInstruction is every example's system prompt, or Alpaca instruction
+const datasetInstruction = "Answer the question using only the provided context. If the context does not contain the answer, say so."
+
+type datasetMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type datasetMessagesRecord struct {
+	Messages []datasetMessage `json:"messages"`
+}
+
+type datasetAlpacaRecord struct {
+	Instruction string `json:"instruction"`
+	Input       string `json:"input"`
+	Output      string `json:"output"`
+}
+
+// datasetPrompt is the user turn of an example: the retrieved context and
+// the question
+func datasetPrompt(context, question string) string {
+	return "Context:\n" + strings.TrimSpace(context) + "\n\nQuestion: " + strings.TrimSpace(question)
+}
+
+// ExportFineTuningDataset writes a JSON line per approved query (rating 1)
+// with its retrieved context, question and answer, oldest first. Queries
+// stored without context, such as refusals, are skipped as they teach
+// nothing about the corpus.
+func (ds *DatabaseSchema) ExportFineTuningDataset(w io.Writer, format string) (int, error) {
+	if format != DatasetFormatMessages && format != DatasetFormatAlpaca {
+		return 0, fmt.Errorf("unknown dataset format %q", format)
+	}
+
+	rows, err := ds.DB.Query(`SELECT question, answer, COALESCE(context, ''), COALESCE(context_format, '') FROM document_queries
+		WHERE rating > 0 AND COALESCE(context, '') <> '' ORDER BY created_at ASC`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	encoder := json.NewEncoder(w)
+	written := 0
+	for rows.Next() {
+		var question, answer string
+		var stored StoredContext
+		if err := rows.Scan(&question, &answer, &stored.Data, &stored.Format); err != nil {
+			return written, err
+		}
+		context, err := ds.ExpandContext(stored)
+		if err != nil {
+			return written, err
+		}
+
+		var record interface{}
+		if format == DatasetFormatMessages {
+			record = datasetMessagesRecord{Messages: []datasetMessage{
+				{Role: "system", Content: datasetInstruction},
+				{Role: "user", Content: datasetPrompt(context, question)},
+				{Role: "assistant", Content: strings.TrimSpace(answer)},
+			}}
+		} else {
+			record = datasetAlpacaRecord{
+				Instruction: datasetInstruction,
+				Input:       datasetPrompt(context, question),
+				Output:      strings.TrimSpace(answer),
+			}
+		}
+		if err := encoder.Encode(record); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, rows.Err()
+}
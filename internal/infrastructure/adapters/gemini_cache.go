@@ -0,0 +1,108 @@
+package adapters
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type noGenerationCacheKey struct{}
+
+// WithoutGenerationCache marks the prompts generated under ctx as specific
+// to a session, such as a conversation's follow-up or a regenerated
+// answer, so they are neither answered from nor stored in the generation
+// cache
+func WithoutGenerationCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noGenerationCacheKey{}, true)
+}
+
+// generationCacheAllowed reports whether prompts under ctx may use the
+// generation cache
+func generationCacheAllowed(ctx context.Context) bool {
+	skip, _ := ctx.Value(noGenerationCacheKey{}).(bool)
+	return !skip
+}
+
+// GenerationCache keeps LLM generations for a while, keyed by a hash of
+// everything sent to the model, so repeated prompts like translations and
+// session titles don't spend quota again. Only completions the model
+// finished normally are kept, never blocked or truncated ones.
+type GenerationCache struct {
+	TTL     time.Duration
+	MaxSize int
+
+	mu      sync.Mutex
+	entries map[string]cachedGeneration
+}
+
+type cachedGeneration struct {
+	output string
+	stored time.Time
+}
+
+// NewGenerationCache returns a cache of up to maxSize generations kept for
+// ttl, or nil, caching nothing, when either isn't positive
+func NewGenerationCache(ttl time.Duration, maxSize int) *GenerationCache {
+	if ttl <= 0 || maxSize <= 0 {
+		return nil
+	}
+	return &GenerationCache{TTL: ttl, MaxSize: maxSize, entries: make(map[string]cachedGeneration)}
+}
+
+// generationCacheKey hashes the model endpoint and request body, so any
+// generation parameter sent along changes the key
+func generationCacheKey(endpoint string, request []byte) string {
+	h := sha256.New()
+	h.Write([]byte(endpoint))
+	h.Write([]byte{0})
+	h.Write(request)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the generation cached under key, if still fresh; nil-safe
+func (c *GenerationCache) Get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if time.Since(entry.stored) > c.TTL {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.output, true
+}
+
+// Put caches a generation under key. When full, expired generations go
+// first, then the oldest. Nil-safe.
+func (c *GenerationCache) Put(key, output string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.MaxSize {
+		oldest := ""
+		for k, entry := range c.entries {
+			if time.Since(entry.stored) > c.TTL {
+				delete(c.entries, k)
+				continue
+			}
+			if oldest == "" || entry.stored.Before(c.entries[oldest].stored) {
+				oldest = k
+			}
+		}
+		if len(c.entries) >= c.MaxSize {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[key] = cachedGeneration{output: output, stored: time.Now()}
+}
@@ -3,11 +3,9 @@ package adapters
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"time"
 
@@ -22,6 +20,10 @@ type LLMClient interface {
 type GoogleGeminiAdapter struct {
 	Client *http.Client
 	Config *config.Config
+	// Secrets supplies the API key instead of GOOGLE_API_KEY when set
+	Secrets *Secrets
+	// Cache answers repeated prompts for GOOGLE_CACHE_TTL; nil disables it
+	Cache *GenerationCache
 }
 
 type geminiContentPart struct {
@@ -38,53 +40,136 @@ type geminiRequest struct {
 
 type geminiCandidate struct {
 	Content geminiContent `json:"content"`
+	// FinishReason is STOP for a complete answer, SAFETY, MAX_TOKENS and
+	// others when the model stopped early
+	FinishReason string `json:"finishReason,omitempty"`
+}
+
+type geminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
 }
 
 type geminiResponse struct {
-	Candidates []geminiCandidate `json:"candidates"`
-	Error      *struct {
+	Candidates    []geminiCandidate    `json:"candidates"`
+	UsageMetadata *geminiUsageMetadata `json:"usageMetadata,omitempty"`
+	// PromptFeedback has a BlockReason when safety filters refused the
+	// prompt
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback,omitempty"`
+	Error *struct {
 		Message string `json:"message"`
 		Code    int    `json:"code"`
 	} `json:"error,omitempty"`
 }
 
-func NewGoogleGeminiAdapter(cfg *config.Config) (*GoogleGeminiAdapter, error) {
-	transport := &http.Transport{}
-	if cfg.GoogleDNS != "" {
-		dialer := &net.Dialer{Timeout: 30 * time.Second}
-		resolverIP := cfg.GoogleDNS
-		// Custom resolver via DialContext using a fixed DNS server
-		dialContext := func(ctx context.Context, network, address string) (net.Conn, error) {
-			// Force DNS lookups through the specified resolver by overriding the default resolver
-			net.DefaultResolver = &net.Resolver{
-				PreferGo: true,
-				Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
-					return dialer.DialContext(ctx, network, net.JoinHostPort(resolverIP, "53"))
-				},
-			}
-			return dialer.DialContext(ctx, network, address)
+func NewGoogleGeminiAdapter(cfg *config.Config, secrets *Secrets) (*GoogleGeminiAdapter, error) {
+	// GOOGLE_DNS sends the client's host lookups to that DNS server
+	transport := NewProviderTransport(cfg, "google", cfg.GoogleDNS)
+
+	client := &http.Client{Timeout: 120 * time.Second, Transport: transport}
+
+	adapter := &GoogleGeminiAdapter{
+		Client:  client,
+		Config:  cfg,
+		Secrets: secrets,
+		Cache:   NewGenerationCache(cfg.GoogleCacheTTL, cfg.GoogleCacheSize),
+	}
+	if adapter.apiKey(context.Background()) == "" {
+		return nil, fmt.Errorf("missing GOOGLE_API_KEY in configuration")
+	}
+
+	return adapter, nil
+}
+
+func (g *GoogleGeminiAdapter) apiKey(ctx context.Context) string {
+	if g.Secrets == nil {
+		return g.Config.GoogleAPIKey
+	}
+	return g.Secrets.Get(ctx, SecretGoogleAPIKey)
+}
+
+// HasAPIKey reports whether an API key is configured, in Vault or the
+// environment
+func (g *GoogleGeminiAdapter) HasAPIKey(ctx context.Context) bool {
+	return g.apiKey(ctx) != ""
+}
+
+// language is the answer language the request forces, or APP_LANGUAGE
+func (g *GoogleGeminiAdapter) language(ctx context.Context) string {
+	if lang := AnswerLanguageFromContext(ctx); lang != "" {
+		return lang
+	}
+	return g.Config.AppLanguage
+}
+
+// send makes a Gemini API request and reads the reply. A rejected key is
+// fetched again and the request retried once, in case it was rotated.
+func (g *GoogleGeminiAdapter) send(ctx context.Context, method, endpoint string, payload []byte) (int, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-goog-api-key", g.apiKey(ctx))
+		req.Header.Set("User-Agent", "rag-service/1.0")
+		if g.language(ctx) == "fa" {
+			req.Header.Set("Accept-Language", "fa-IR,fa;q=0.9")
+		}
+
+		resp, err := g.Client.Do(req)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read response: %w", err)
 		}
-		transport = &http.Transport{
-			Proxy:           http.ProxyFromEnvironment,
-			DialContext:     dialContext,
-			TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+
+		if g.Secrets != nil && attempt == 0 && geminiKeyRejected(resp.StatusCode, body) {
+			g.Secrets.Invalidate(SecretGoogleAPIKey)
+			continue
 		}
+		return resp.StatusCode, body, nil
 	}
+}
 
-	client := &http.Client{Timeout: 120 * time.Second, Transport: transport}
+// geminiKeyRejected recognizes replies to an invalid or revoked API key;
+// Gemini answers most of those with 400 API_KEY_INVALID
+func geminiKeyRejected(status int, body []byte) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden ||
+		(status == http.StatusBadRequest && bytes.Contains(body, []byte("API_KEY_INVALID")))
+}
 
-	if cfg.GoogleAPIKey == "" {
-		return nil, fmt.Errorf("missing GOOGLE_API_KEY in configuration")
+// CheckModel verifies the API key and that the configured model exists,
+// without spending tokens
+func (g *GoogleGeminiAdapter) CheckModel(ctx context.Context) error {
+	endpoint := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s", g.Config.GoogleModel)
+
+	status, _, err := g.send(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
 	}
 
-	return &GoogleGeminiAdapter{Client: client, Config: cfg}, nil
+	switch {
+	case status == http.StatusOK:
+		return nil
+	case status == http.StatusNotFound:
+		return fmt.Errorf("model %q not found", g.Config.GoogleModel)
+	case status == http.StatusBadRequest || status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return fmt.Errorf("API key was rejected (status %d)", status)
+	}
+	return fmt.Errorf("model check returned status %d", status)
 }
 
 func (g *GoogleGeminiAdapter) GenerateText(ctx context.Context, prompt string) (string, error) {
 	endpoint := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent", g.Config.GoogleModel)
 
-	// Optional Persian system guidance if app language is Persian
-	if g.Config.AppLanguage == "fa" {
+	// Optional Persian system guidance if answers are in Persian
+	if g.language(ctx) == "fa" {
 		prompt = "لطفاً فقط به زبان فارسی، روان و خلاصه پاسخ بده. اگر پاسخ در متن موجود نبود، صریح بگو که اطلاعات کافی در متن موجود نیست.\n\n" + prompt
 	}
 
@@ -99,30 +184,24 @@ func (g *GoogleGeminiAdapter) GenerateText(ctx context.Context, prompt string) (
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(data))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-goog-api-key", g.Config.GoogleAPIKey)
-	req.Header.Set("User-Agent", "rag-service/1.0")
-	if g.Config.AppLanguage == "fa" {
-		req.Header.Set("Accept-Language", "fa-IR,fa;q=0.9")
-	}
-
-	resp, err := g.Client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+	// The key covers the model and the whole request, language guidance
+	// included, so only identical requests share a generation
+	cacheKey := ""
+	if g.Cache != nil && generationCacheAllowed(ctx) {
+		cacheKey = generationCacheKey(endpoint, data)
+		if output, ok := g.Cache.Get(cacheKey); ok {
+			return output, nil
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	started := time.Now()
+	status, body, err := g.send(ctx, http.MethodPost, endpoint, data)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", err
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("gemini returned status %d: %s", resp.StatusCode, string(body))
+	if status < 200 || status >= 300 {
+		return "", fmt.Errorf("gemini returned status %d: %s", status, string(body))
 	}
 
 	var gr geminiResponse
@@ -134,6 +213,23 @@ func (g *GoogleGeminiAdapter) GenerateText(ctx context.Context, prompt string) (
 		return "", fmt.Errorf("gemini error: %s", gr.Error.Message)
 	}
 
+	// Gemini doesn't report load/eval timings, only wall time and token usage
+	elapsed := time.Since(started)
+	stats := GenerationStats{
+		Provider: "google",
+		Model:    g.Config.GoogleModel,
+		TotalMs:  float64(elapsed.Microseconds()) / 1000,
+		EvalMs:   float64(elapsed.Microseconds()) / 1000,
+	}
+	if gr.UsageMetadata != nil {
+		stats.PromptEvalCount = gr.UsageMetadata.PromptTokenCount
+		stats.EvalCount = gr.UsageMetadata.CandidatesTokenCount
+		if elapsed > 0 {
+			stats.TokensPerSec = float64(stats.EvalCount) / elapsed.Seconds()
+		}
+	}
+	recordGeneration(ctx, stats)
+
 	if len(gr.Candidates) == 0 || len(gr.Candidates[0].Content.Parts) == 0 {
 		return "", fmt.Errorf("gemini returned empty response")
 	}
@@ -147,5 +243,10 @@ func (g *GoogleGeminiAdapter) GenerateText(ctx context.Context, prompt string) (
 		}
 	}
 
+	// Answers cut short, by safety filters or otherwise, are asked again
+	finished := gr.Candidates[0].FinishReason == "" || gr.Candidates[0].FinishReason == "STOP"
+	if cacheKey != "" && finished && (gr.PromptFeedback == nil || gr.PromptFeedback.BlockReason == "") {
+		g.Cache.Put(cacheKey, output)
+	}
 	return output, nil
 }
@@ -0,0 +1,441 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxGraphQLLimit caps the limit argument of list fields
+const maxGraphQLLimit = 200
+
+// MaxGraphQLBodyBytes caps a GraphQL request body; real queries are a few
+// kilobytes at most
+const MaxGraphQLBodyBytes = 64 * 1024
+
+// GraphQLRequest is a GraphQL-over-HTTP request body
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// GraphQLError is an error entry in a GraphQL response
+type GraphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// GraphQLResponse carries data and errors; a field whose resolver failed is
+// null in data and reported in errors
+type GraphQLResponse struct {
+	Data   interface{}    `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// gqlResolver resolves an object field from its parent and arguments. Type
+// is the object type of the result, empty for scalars.
+type gqlResolver struct {
+	Type    string
+	Resolve func(ctx context.Context, parent map[string]interface{}, args map[string]interface{}) (interface{}, error)
+}
+
+// gqlType lists an object type's scalar fields (the JSON fields of its
+// record) and its resolved fields
+type gqlType struct {
+	scalars map[string]bool
+	fields  map[string]gqlResolver
+}
+
+// GraphQL serves a read-only GraphQL view of documents, chunks, chat
+// sessions and queries, so clients fetch only the fields they select.
+// It supports queries with aliases, arguments and variables; fragments,
+// directives, introspection and mutations are not supported.
+type GraphQL struct {
+	RAG   *SimpleRAGService
+	types map[string]gqlType
+}
+
+// NewGraphQL builds the schema over the service's data. Resolvers apply the
+// collection permissions of the caller in the request context, as the REST
+// routes do.
+func NewGraphQL(r *SimpleRAGService) *GraphQL {
+	g := &GraphQL{RAG: r}
+	ds := r.DatabaseSchema
+
+	g.types = map[string]gqlType{
+		"Query": {fields: map[string]gqlResolver{
+			"documents": {"Document", func(ctx context.Context, _ map[string]interface{}, args map[string]interface{}) (interface{}, error) {
+				hidden, err := r.HiddenCollections(ctx)
+				if err != nil {
+					return nil, err
+				}
+				documents, _, err := ds.ListDocuments(DocumentFilter{
+					Status:            gqlString(args, "status"),
+					Search:            gqlString(args, "search"),
+					Limit:             gqlLimit(args, 20),
+					Offset:            gqlInt(args, "offset", 0),
+					HiddenCollections: hidden,
+					OnlyCollections:   r.OnlyCollections(ctx),
+				})
+				return documents, err
+			}},
+			"document": {"Document", func(ctx context.Context, _ map[string]interface{}, args map[string]interface{}) (interface{}, error) {
+				return g.readableDocument(ctx, gqlString(args, "id"))
+			}},
+			"chunks": {"Chunk", func(ctx context.Context, _ map[string]interface{}, args map[string]interface{}) (interface{}, error) {
+				documentID := gqlString(args, "documentId")
+				if documentID == "" {
+					return nil, fmt.Errorf("chunks requires a documentId argument")
+				}
+				if doc, err := g.readableDocument(ctx, documentID); doc == nil {
+					return nil, err
+				}
+				return ds.GetChunksByDocument(documentID, gqlLimit(args, 50), gqlInt(args, "offset", 0))
+			}},
+			"sessions": {"Session", func(_ context.Context, _ map[string]interface{}, args map[string]interface{}) (interface{}, error) {
+				return ds.GetChatSessions(gqlLimit(args, 20), gqlInt(args, "offset", 0))
+			}},
+			"session": {"Session", func(_ context.Context, _ map[string]interface{}, args map[string]interface{}) (interface{}, error) {
+				return gqlOptional(ds.GetChatSession(gqlString(args, "id")))
+			}},
+			"queries": {"QueryRecord", func(ctx context.Context, _ map[string]interface{}, args map[string]interface{}) (interface{}, error) {
+				queries, err := ds.GetQueries(gqlLimit(args, 20), gqlInt(args, "offset", 0))
+				if err != nil {
+					return nil, err
+				}
+				return r.ReadableQueries(ctx, queries)
+			}},
+		}},
+		"Document": {scalars: jsonFieldNames(DocumentRecord{}), fields: map[string]gqlResolver{
+			// Documents are only resolved once readable, so their chunks are
+			"chunks": {"Chunk", func(_ context.Context, parent map[string]interface{}, args map[string]interface{}) (interface{}, error) {
+				return ds.GetChunksByDocument(fmt.Sprint(parent["id"]), gqlLimit(args, 50), gqlInt(args, "offset", 0))
+			}},
+		}},
+		"Chunk": {scalars: jsonFieldNames(ChunkRecord{}), fields: map[string]gqlResolver{
+			"document": {"Document", func(ctx context.Context, parent map[string]interface{}, _ map[string]interface{}) (interface{}, error) {
+				return g.readableDocument(ctx, fmt.Sprint(parent["document_id"]))
+			}},
+		}},
+		"Session": {scalars: jsonFieldNames(ChatSession{}), fields: map[string]gqlResolver{
+			"messages": {"Message", func(ctx context.Context, parent map[string]interface{}, args map[string]interface{}) (interface{}, error) {
+				messages, err := ds.GetChatMessages(fmt.Sprint(parent["id"]), gqlLimit(args, 50), gqlInt(args, "offset", 0))
+				if err != nil {
+					return nil, err
+				}
+				return r.ReadableMessages(ctx, messages)
+			}},
+		}},
+		"Message":     {scalars: jsonFieldNames(ChatMessage{})},
+		"QueryRecord": {scalars: jsonFieldNames(QueryRecord{})},
+	}
+
+	return g
+}
+
+// readableDocument loads a document the caller in ctx may read; a missing
+// or unreadable one is null
+func (g *GraphQL) readableDocument(ctx context.Context, id string) (*DocumentRecord, error) {
+	doc, err := g.RAG.DatabaseSchema.GetDocument(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := g.RAG.CheckCollectionAccess(ctx, DocumentCollection(doc.Metadata), PermissionRead); err != nil {
+		if errors.Is(err, ErrCollectionForbidden) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Execute parses and runs a request. Parse errors and unknown fields are
+// returned as an error; resolver failures are reported in the response.
+func (g *GraphQL) Execute(ctx context.Context, request GraphQLRequest) (*GraphQLResponse, error) {
+	operations, err := parseGraphQL(request.Query)
+	if err != nil {
+		return nil, fmt.Errorf("syntax error: %w", err)
+	}
+
+	var op *gqlOperation
+	switch {
+	case request.OperationName != "":
+		for _, candidate := range operations {
+			if candidate.Name == request.OperationName {
+				op = candidate
+			}
+		}
+		if op == nil {
+			return nil, fmt.Errorf("unknown operation %q", request.OperationName)
+		}
+	case len(operations) == 1:
+		op = operations[0]
+	default:
+		return nil, fmt.Errorf("operationName is required when the document has several operations")
+	}
+
+	variables := make(map[string]interface{}, len(op.Defaults)+len(request.Variables))
+	for name, value := range op.Defaults {
+		variables[name] = value
+	}
+	for name, value := range request.Variables {
+		variables[name] = value
+	}
+
+	if err := g.validate("Query", op.Selections); err != nil {
+		return nil, err
+	}
+
+	exec := &gqlExecution{ctx: ctx, graphql: g, variables: variables}
+	data := exec.selectFields("Query", nil, op.Selections, nil)
+	return &GraphQLResponse{Data: data, Errors: exec.errors}, nil
+}
+
+// validate checks every selected field exists on its type before anything
+// is resolved
+func (g *GraphQL) validate(typeName string, selections []*gqlField) error {
+	t := g.types[typeName]
+	for _, field := range selections {
+		if field.Name == "__typename" {
+			continue
+		}
+		if resolver, ok := t.fields[field.Name]; ok {
+			if resolver.Type != "" && len(field.Selections) == 0 {
+				return fmt.Errorf("field %q of type %s must have a selection of subfields", field.Name, resolver.Type)
+			}
+			if err := g.validate(resolver.Type, field.Selections); err != nil {
+				return err
+			}
+			continue
+		}
+		if !t.scalars[field.Name] {
+			return fmt.Errorf("cannot query field %q on type %s", field.Name, typeName)
+		}
+		if len(field.Selections) > 0 {
+			return fmt.Errorf("field %q is a scalar and cannot have a selection", field.Name)
+		}
+	}
+	return nil
+}
+
+type gqlExecution struct {
+	ctx       context.Context
+	graphql   *GraphQL
+	variables map[string]interface{}
+	errors    []GraphQLError
+}
+
+// selectFields builds the ordered response object for parent
+func (e *gqlExecution) selectFields(typeName string, parent map[string]interface{}, selections []*gqlField, path []interface{}) *gqlObject {
+	t := e.graphql.types[typeName]
+	object := &gqlObject{}
+
+	for _, field := range selections {
+		key := field.ResponseKey()
+		fieldPath := append(append([]interface{}{}, path...), key)
+
+		if field.Name == "__typename" {
+			object.set(key, typeName)
+			continue
+		}
+
+		resolver, ok := t.fields[field.Name]
+		if !ok {
+			object.set(key, parent[field.Name])
+			continue
+		}
+
+		value, err := resolver.Resolve(e.ctx, parent, e.resolveArgs(field.Args))
+		if err == nil {
+			value, err = toJSONValue(value)
+		}
+		if err != nil {
+			e.errors = append(e.errors, GraphQLError{Message: err.Error(), Path: fieldPath})
+			object.set(key, nil)
+			continue
+		}
+
+		object.set(key, e.complete(resolver.Type, value, field.Selections, fieldPath))
+	}
+
+	return object
+}
+
+// complete applies the sub-selection to an object or to each item of a list
+func (e *gqlExecution) complete(typeName string, value interface{}, selections []*gqlField, path []interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return e.selectFields(typeName, v, selections, path)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = e.complete(typeName, item, selections, append(append([]interface{}{}, path...), i))
+		}
+		return items
+	}
+	return value
+}
+
+// resolveArgs substitutes variables into argument values
+func (e *gqlExecution) resolveArgs(args map[string]interface{}) map[string]interface{} {
+	resolved := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		resolved[name] = e.resolveValue(value)
+	}
+	return resolved
+}
+
+func (e *gqlExecution) resolveValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case gqlVariable:
+		return e.variables[string(v)]
+	case gqlEnum:
+		return string(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = e.resolveValue(item)
+		}
+		return list
+	case map[string]interface{}:
+		return e.resolveArgs(v)
+	}
+	return value
+}
+
+// gqlObject is a response object that keeps fields in selection order
+type gqlObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *gqlObject) set(key string, value interface{}) {
+	if o.values == nil {
+		o.values = make(map[string]interface{})
+	}
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// toJSONValue converts a record or slice of records to maps and slices
+// keyed by their JSON field names
+func toJSONValue(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var converted interface{}
+	if err := json.Unmarshal(data, &converted); err != nil {
+		return nil, err
+	}
+	return converted, nil
+}
+
+// jsonFieldNames lists the JSON field names of a record struct
+func jsonFieldNames(record interface{}) map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(record)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// gqlOptional turns a missing row into null instead of an error
+func gqlOptional(value interface{}, err error) (interface{}, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func gqlString(args map[string]interface{}, name string) string {
+	if s, ok := args[name].(string); ok {
+		return s
+	}
+	return ""
+}
+
+func gqlInt(args map[string]interface{}, name string, fallback int) int {
+	switch v := args[name].(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return fallback
+}
+
+// gqlLimit reads the limit argument, capped at maxGraphQLLimit
+func gqlLimit(args map[string]interface{}, fallback int) int {
+	limit := gqlInt(args, "limit", fallback)
+	if limit <= 0 {
+		return fallback
+	}
+	if limit > maxGraphQLLimit {
+		return maxGraphQLLimit
+	}
+	return limit
+}
+
+// Schema describes the available types and fields, since introspection is
+// not supported
+func (g *GraphQL) Schema() map[string][]string {
+	schema := make(map[string][]string, len(g.types))
+	for typeName, t := range g.types {
+		var fields []string
+		for name := range t.scalars {
+			fields = append(fields, name)
+		}
+		for name, resolver := range t.fields {
+			fields = append(fields, fmt.Sprintf("%s: %s", name, resolver.Type))
+		}
+		sort.Strings(fields)
+		schema[typeName] = fields
+	}
+	return schema
+}
@@ -0,0 +1,466 @@
+package adapters
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// gqlField is a field selection: alias, arguments and sub-selections
+type gqlField struct {
+	Alias      string
+	Name       string
+	Args       map[string]interface{}
+	Selections []*gqlField
+}
+
+// ResponseKey is the alias if one was given, else the field name
+func (f *gqlField) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// gqlOperation is a query operation with its variable defaults
+type gqlOperation struct {
+	Name       string
+	Defaults   map[string]interface{}
+	Selections []*gqlField
+}
+
+// gqlVariable is a $variable reference in an argument value
+type gqlVariable string
+
+// gqlEnum is a bare enum value such as ASC
+type gqlEnum string
+
+type gqlToken struct {
+	kind  string // "name", "punct", "string", "int", "float"
+	value string
+}
+
+// tokenizeGraphQL splits a GraphQL document into tokens. Commas, whitespace
+// and comments are insignificant.
+func tokenizeGraphQL(source string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r) || r == ',' || r == '\uFEFF':
+			i++
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '.' && i+2 < len(runes) && runes[i+1] == '.' && runes[i+2] == '.':
+			tokens = append(tokens, gqlToken{"punct", "..."})
+			i += 3
+		case strings.ContainsRune("{}()[]:$!=@", r):
+			tokens = append(tokens, gqlToken{"punct", string(r)})
+			i++
+		case r == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\n' {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+					switch runes[j] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					case 'r':
+						sb.WriteRune('\r')
+					case 'u':
+						if j+4 >= len(runes) {
+							return nil, fmt.Errorf("invalid unicode escape")
+						}
+						code, err := strconv.ParseUint(string(runes[j+1:j+5]), 16, 32)
+						if err != nil {
+							return nil, fmt.Errorf("invalid unicode escape")
+						}
+						sb.WriteRune(rune(code))
+						j += 4
+					default:
+						sb.WriteRune(runes[j])
+					}
+					continue
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, gqlToken{"string", sb.String()})
+			i = j + 1
+		case r == '-' || unicode.IsDigit(r):
+			j := i + 1
+			kind := "int"
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || strings.ContainsRune(".eE+-", runes[j])) {
+				if !unicode.IsDigit(runes[j]) {
+					kind = "float"
+				}
+				j++
+			}
+			tokens = append(tokens, gqlToken{kind, string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, gqlToken{"name", string(runes[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+// maxGraphQLDepth caps how deeply selections, list and object values and
+// list types may nest; the parser recurses per level, so unbounded nesting
+// would overflow the stack
+const maxGraphQLDepth = 32
+
+type gqlParser struct {
+	tokens []gqlToken
+	pos    int
+	depth  int
+}
+
+// parseGraphQL parses the query operations of a document. Fragments,
+// directives, mutations and subscriptions are not supported.
+func parseGraphQL(source string) ([]*gqlOperation, error) {
+	tokens, err := tokenizeGraphQL(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{tokens: tokens}
+
+	var operations []*gqlOperation
+	for !p.done() {
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, op)
+	}
+	if len(operations) == 0 {
+		return nil, fmt.Errorf("document contains no operations")
+	}
+	return operations, nil
+}
+
+func (p *gqlParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *gqlParser) peek() gqlToken {
+	if p.done() {
+		return gqlToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *gqlParser) isPunct(value string) bool {
+	tok := p.peek()
+	return tok.kind == "punct" && tok.value == value
+}
+
+func (p *gqlParser) expectPunct(value string) error {
+	tok := p.next()
+	if tok.kind != "punct" || tok.value != value {
+		return p.unexpected(tok, fmt.Sprintf("%q", value))
+	}
+	return nil
+}
+
+func (p *gqlParser) expectName() (string, error) {
+	tok := p.next()
+	if tok.kind != "name" {
+		return "", p.unexpected(tok, "a name")
+	}
+	return tok.value, nil
+}
+
+// enter descends a nesting level, failing past maxGraphQLDepth; each
+// successful call is paired with leave
+func (p *gqlParser) enter() error {
+	if p.depth >= maxGraphQLDepth {
+		return fmt.Errorf("document nests deeper than %d levels", maxGraphQLDepth)
+	}
+	p.depth++
+	return nil
+}
+
+func (p *gqlParser) leave() {
+	p.depth--
+}
+
+func (p *gqlParser) unexpected(tok gqlToken, expected string) error {
+	if tok.kind == "" {
+		return fmt.Errorf("expected %s at end of document", expected)
+	}
+	return fmt.Errorf("expected %s, got %q", expected, tok.value)
+}
+
+func (p *gqlParser) parseOperation() (*gqlOperation, error) {
+	op := &gqlOperation{Defaults: map[string]interface{}{}}
+
+	if p.isPunct("{") {
+		selections, err := p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+		op.Selections = selections
+		return op, nil
+	}
+
+	keyword, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	switch keyword {
+	case "query":
+	case "mutation", "subscription":
+		return nil, fmt.Errorf("%s operations are not supported", keyword)
+	case "fragment":
+		return nil, fmt.Errorf("fragments are not supported")
+	default:
+		return nil, fmt.Errorf("unexpected %q, expected an operation", keyword)
+	}
+
+	if p.peek().kind == "name" {
+		op.Name = p.next().value
+	}
+
+	if p.isPunct("(") {
+		p.next()
+		for !p.isPunct(")") {
+			if err := p.expectPunct("$"); err != nil {
+				return nil, err
+			}
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(":"); err != nil {
+				return nil, err
+			}
+			if err := p.skipType(); err != nil {
+				return nil, err
+			}
+			if p.isPunct("=") {
+				p.next()
+				value, err := p.parseValue(true)
+				if err != nil {
+					return nil, err
+				}
+				op.Defaults[name] = value
+			}
+		}
+		p.next()
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.Selections = selections
+	return op, nil
+}
+
+// skipType consumes a variable type such as [String!]!; values are coerced
+// by the resolvers, so the declared type is not checked
+func (p *gqlParser) skipType() error {
+	if err := p.enter(); err != nil {
+		return err
+	}
+	defer p.leave()
+	if p.isPunct("[") {
+		p.next()
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.expectName(); err != nil {
+		return err
+	}
+	if p.isPunct("!") {
+		p.next()
+	}
+	return nil
+}
+
+func (p *gqlParser) parseSelectionSet() ([]*gqlField, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []*gqlField
+	for !p.isPunct("}") {
+		if p.done() {
+			return nil, fmt.Errorf("expected \"}\" at end of document")
+		}
+		if p.isPunct("...") {
+			return nil, fmt.Errorf("fragments are not supported")
+		}
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, field)
+	}
+	p.next()
+
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("selection set must not be empty")
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) parseField() (*gqlField, error) {
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	field := &gqlField{Name: name, Args: map[string]interface{}{}}
+
+	if p.isPunct(":") {
+		p.next()
+		field.Alias = name
+		if field.Name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.isPunct("(") {
+		p.next()
+		for !p.isPunct(")") {
+			argName, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.parseValue(false)
+			if err != nil {
+				return nil, err
+			}
+			field.Args[argName] = value
+		}
+		p.next()
+	}
+
+	if p.isPunct("@") {
+		return nil, fmt.Errorf("directives are not supported")
+	}
+
+	if p.isPunct("{") {
+		if field.Selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// parseValue parses an argument value; constant values (variable defaults)
+// may not reference variables
+func (p *gqlParser) parseValue(constant bool) (interface{}, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	tok := p.next()
+	switch tok.kind {
+	case "string":
+		return tok.value, nil
+	case "int":
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", tok.value)
+		}
+		return n, nil
+	case "float":
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok.value)
+		}
+		return f, nil
+	case "name":
+		switch tok.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return gqlEnum(tok.value), nil
+	case "punct":
+		switch tok.value {
+		case "$":
+			if constant {
+				return nil, fmt.Errorf("variables are not allowed in default values")
+			}
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			return gqlVariable(name), nil
+		case "[":
+			list := []interface{}{}
+			for !p.isPunct("]") {
+				if p.done() {
+					return nil, fmt.Errorf("expected \"]\" at end of document")
+				}
+				value, err := p.parseValue(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			object := map[string]interface{}{}
+			for !p.isPunct("}") {
+				name, err := p.expectName()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expectPunct(":"); err != nil {
+					return nil, err
+				}
+				value, err := p.parseValue(constant)
+				if err != nil {
+					return nil, err
+				}
+				object[name] = value
+			}
+			p.next()
+			return object, nil
+		}
+	}
+	return nil, p.unexpected(tok, "a value")
+}
@@ -0,0 +1,327 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"plugin"
+	"strings"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// Hook points, in pipeline order
+const (
+	// HookPreChunk sees each page's cleaned text before it is split; hooks
+	// may rewrite Text or clear it to drop the page
+	HookPreChunk = "pre_chunk"
+	// HookPostChunk sees a document's chunks before they are stored; hooks
+	// may edit, drop or add Chunks
+	HookPostChunk = "post_chunk"
+	// HookPreRetrieval sees the question before retrieval; hooks may
+	// rewrite Question
+	HookPreRetrieval = "pre_retrieval"
+	// HookPostAnswer sees the finished answer; hooks may rewrite Answer
+	// and Sources or adjust Confidence
+	HookPostAnswer = "post_answer"
+)
+
+var hookPoints = []string{HookPreChunk, HookPostChunk, HookPreRetrieval, HookPostAnswer}
+
+// HookPayload is sent to a hook as JSON. A hook replies with the fields it
+// changed; fields it leaves out keep their values.
+type HookPayload struct {
+	Point      string      `json:"point"`
+	Document   string      `json:"document,omitempty"`
+	Page       int         `json:"page,omitempty"`
+	Text       string      `json:"text,omitempty"`
+	Chunks     []HookChunk `json:"chunks,omitempty"`
+	Question   string      `json:"question,omitempty"`
+	Answer     string      `json:"answer,omitempty"`
+	Sources    []string    `json:"sources,omitempty"`
+	Confidence float64     `json:"confidence,omitempty"`
+}
+
+type HookChunk struct {
+	ID   string `json:"id"`
+	Page int    `json:"page"`
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Hook is an extension called at a hook point
+type Hook interface {
+	Run(ctx context.Context, payload *HookPayload) error
+}
+
+// HTTPHook POSTs the payload to URL. A 204 leaves the payload unchanged;
+// any other 2xx body is merged into it.
+type HTTPHook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (h *HTTPHook) Run(ctx context.Context, payload *HookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("hook returned status %d", resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	reply, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read hook response: %w", err)
+	}
+	if len(bytes.TrimSpace(reply)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(reply, payload); err != nil {
+		return fmt.Errorf("failed to decode hook response: %w", err)
+	}
+	return nil
+}
+
+// PluginHookFunc is the signature a Go plugin exports as "Hook". It takes
+// and returns a JSON HookPayload, so plugins don't import this package.
+type PluginHookFunc = func(ctx context.Context, payload []byte) ([]byte, error)
+
+// PluginHook calls a Go plugin built with -buildmode=plugin. Plugins need a
+// cgo-enabled build of the service using the same Go version.
+type PluginHook struct {
+	Path string
+	fn   PluginHookFunc
+}
+
+func NewPluginHook(path string) (*PluginHook, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin: %w", err)
+	}
+	symbol, err := p.Lookup("Hook")
+	if err != nil {
+		return nil, fmt.Errorf("plugin has no Hook symbol: %w", err)
+	}
+
+	switch fn := symbol.(type) {
+	case PluginHookFunc:
+		return &PluginHook{Path: path, fn: fn}, nil
+	case *PluginHookFunc:
+		return &PluginHook{Path: path, fn: *fn}, nil
+	}
+	return nil, fmt.Errorf("plugin Hook has type %T, want func(context.Context, []byte) ([]byte, error)", symbol)
+}
+
+func (h *PluginHook) Run(ctx context.Context, payload *HookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	reply, err := h.fn(ctx, body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(reply)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(reply, payload); err != nil {
+		return fmt.Errorf("failed to decode plugin response: %w", err)
+	}
+	return nil
+}
+
+type namedHook struct {
+	target string
+	hook   Hook
+}
+
+// Hooks runs the hooks registered for each point in configuration order
+type Hooks struct {
+	Timeout  time.Duration
+	FailOpen bool
+	hooks    map[string][]namedHook
+}
+
+// NewHooks registers the hooks listed in cfg.Hooks, e.g.
+// "pre_chunk=http://redactor:8080/hook,post_answer=/plugins/filter.so".
+// Entries that can't be loaded are logged and skipped.
+func NewHooks(cfg *config.Config) *Hooks {
+	timeout := cfg.HookTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	h := &Hooks{
+		Timeout:  timeout,
+		FailOpen: cfg.HooksFailOpen,
+		hooks:    make(map[string][]namedHook),
+	}
+
+	client := &http.Client{Timeout: timeout}
+	for _, entry := range strings.Split(cfg.Hooks, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		point, target, ok := strings.Cut(entry, "=")
+		point, target = strings.TrimSpace(point), strings.TrimSpace(target)
+		if !ok || !isHookPoint(point) || target == "" {
+			log.Printf("Warning: ignoring hook %q; expected point=target with point one of %s", entry, strings.Join(hookPoints, ", "))
+			continue
+		}
+
+		var hook Hook
+		switch {
+		case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+			hook = &HTTPHook{URL: target, Client: client}
+		case strings.HasSuffix(target, ".so"):
+			pluginHook, err := NewPluginHook(target)
+			if err != nil {
+				log.Printf("Warning: ignoring hook %s: %v", target, err)
+				continue
+			}
+			hook = pluginHook
+		default:
+			log.Printf("Warning: ignoring hook %q; target must be an http(s) URL or a .so plugin", entry)
+			continue
+		}
+
+		h.hooks[point] = append(h.hooks[point], namedHook{target: target, hook: hook})
+		log.Printf("✅ Registered %s hook: %s", point, target)
+	}
+
+	return h
+}
+
+func isHookPoint(point string) bool {
+	for _, p := range hookPoints {
+		if p == point {
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether any hook is registered for point
+func (h *Hooks) Has(point string) bool {
+	return h != nil && len(h.hooks[point]) > 0
+}
+
+// Points returns the hook points that have hooks registered
+func (h *Hooks) Points() []string {
+	points := []string{}
+	for _, point := range hookPoints {
+		if h.Has(point) {
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+// Run passes payload through every hook registered for payload.Point. A
+// failing hook aborts with an error, or is skipped when FailOpen is set.
+func (h *Hooks) Run(ctx context.Context, payload *HookPayload) error {
+	if !h.Has(payload.Point) {
+		return nil
+	}
+
+	start := time.Now()
+	defer func() {
+		DebugTraceFromContext(ctx).AddStage("hook_"+payload.Point, time.Since(start))
+	}()
+
+	for _, named := range h.hooks[payload.Point] {
+		hookCtx, cancel := context.WithTimeout(ctx, h.Timeout)
+		// Work on a copy so a hook that fails halfway doesn't leave a
+		// partially merged payload behind
+		result := *payload
+		result.Chunks = append([]HookChunk(nil), payload.Chunks...)
+		result.Sources = append([]string(nil), payload.Sources...)
+		err := named.hook.Run(hookCtx, &result)
+		cancel()
+
+		if err != nil {
+			if h.FailOpen {
+				log.Printf("Warning: %s hook %s failed, continuing: %v", payload.Point, named.target, err)
+				continue
+			}
+			return fmt.Errorf("%s hook %s failed: %w", payload.Point, named.target, err)
+		}
+		result.Point = payload.Point
+		*payload = result
+	}
+	return nil
+}
+
+// runPostChunkHooks lets post_chunk hooks edit, drop or add chunks before
+// they are stored. Returned chunks keep their original type and metadata
+// when their ID is unchanged.
+func (r *SimpleRAGService) runPostChunkHooks(ctx context.Context, filename string, chunks []PDFChunk) ([]PDFChunk, error) {
+	if !r.Hooks.Has(HookPostChunk) {
+		return chunks, nil
+	}
+
+	payload := &HookPayload{Point: HookPostChunk, Document: filename}
+	original := make(map[string]PDFChunk, len(chunks))
+	for _, chunk := range chunks {
+		original[chunk.ChunkID] = chunk
+		payload.Chunks = append(payload.Chunks, HookChunk{ID: chunk.ChunkID, Page: chunk.Page, Type: chunk.Type, Text: chunk.Text})
+	}
+
+	if err := r.Hooks.Run(ctx, payload); err != nil {
+		return nil, err
+	}
+
+	var result []PDFChunk
+	seen := make(map[string]bool)
+	for i, hc := range payload.Chunks {
+		if strings.TrimSpace(hc.Text) == "" {
+			continue
+		}
+		if hc.ID == "" || seen[hc.ID] {
+			hc.ID = fmt.Sprintf("%s_hook_c%d", filename, i)
+		}
+		seen[hc.ID] = true
+
+		chunk, ok := original[hc.ID]
+		if !ok {
+			chunk = PDFChunk{
+				Document: filename,
+				Type:     ChunkTypeText,
+				Metadata: map[string]interface{}{"filename": filename, "hook": true},
+			}
+		}
+		chunk.ChunkID = hc.ID
+		chunk.Text = hc.Text
+		chunk.Page = hc.Page
+		if hc.Type == ChunkTypeText || hc.Type == ChunkTypeTable {
+			chunk.Type = hc.Type
+		}
+		result = append(result, chunk)
+	}
+
+	return result, nil
+}
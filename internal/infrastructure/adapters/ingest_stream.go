@@ -0,0 +1,354 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrIngestStreamNotFound is returned for unknown, expired or closed
+// streams, and for streams opened by another caller
+var ErrIngestStreamNotFound = errors.New("ingest stream not found")
+
+// ErrInvalidIngestStream wraps errors in a request to open a stream
+var ErrInvalidIngestStream = errors.New("invalid ingest stream request")
+
+const (
+	// streamChunkRunes and streamOverlapWords size stream chunks as
+	// splitIntoChunks sizes PDF chunks
+	streamChunkRunes   = 1000
+	streamOverlapWords = 20
+	// defaultIngestStreamIdleTimeout applies when INGEST_STREAM_IDLE_TIMEOUT
+	// is unset
+	defaultIngestStreamIdleTimeout = 10 * time.Minute
+)
+
+// IngestStreamStatus reports a stream's progress
+type IngestStreamStatus struct {
+	DocumentID string `json:"document_id"`
+	Filename   string `json:"filename"`
+	Status     string `json:"status"`
+	Segments   int    `json:"segments"`
+	Bytes      int64  `json:"bytes"`
+	// Chunks are the chunks stored so far; text that doesn't fill a chunk
+	// yet is held until more arrives or the stream closes
+	Chunks int `json:"chunks"`
+}
+
+// ingestStream is a text document being pushed in segments. Its chunks are
+// stored under one chunk version as they fill up and committed on close,
+// so queries don't see the document until it is complete.
+type ingestStream struct {
+	mu         sync.Mutex
+	documentID string
+	filename   string
+	owner      string
+	version    int
+	page       int
+	// words are the text not stored yet, after the previous chunk's overlap
+	words     []string
+	fresh     int
+	stored    int
+	embedded  int
+	segments  int
+	bytes     int64
+	text      *pageTextWriter
+	idleTimer *time.Timer
+	done      bool
+}
+
+// OpenIngestStream creates a text document, optionally in a collection the
+// caller can write to, for segments pushed with AppendIngestStream and
+// finished with CloseIngestStream. Streams left idle for
+// INGEST_STREAM_IDLE_TIMEOUT are discarded and their document marked
+// failed.
+func (r *SimpleRAGService) OpenIngestStream(ctx context.Context, filename, collection string) (*IngestStreamStatus, error) {
+	filename = strings.TrimSpace(filename)
+	if filename == "" {
+		return nil, fmt.Errorf("%w: filename is required", ErrInvalidIngestStream)
+	}
+	collection = strings.TrimSpace(collection)
+	if err := r.CheckCollectionAccess(ctx, collection, PermissionWrite); err != nil {
+		return nil, err
+	}
+
+	documentID := fmt.Sprintf("doc_%d", time.Now().UnixNano())
+	metadata := DocumentMetadata{UploadedAt: time.Now().UTC().Format(time.RFC3339), Collection: collection, Source: DocumentSourceStream}
+	docRecord := &DocumentRecord{
+		ID:               documentID,
+		OriginalFilename: filename,
+		Status:           "processing",
+		StorageTier:      StorageTierNone,
+		Metadata:         encodeJSON(metadata),
+	}
+	if err := r.DatabaseSchema.InsertDocument(docRecord); err != nil {
+		return nil, fmt.Errorf("failed to insert document record: %w", err)
+	}
+	r.recordEvent(documentID, DocumentEventUploaded, "Opened a text stream for "+filename)
+	version, err := r.DatabaseSchema.NextChunkVersion(documentID)
+	if err != nil {
+		r.DatabaseSchema.UpdateDocumentStatus(documentID, "failed")
+		r.recordEvent(documentID, DocumentEventFailed, "Processing failed: "+err.Error())
+		return nil, fmt.Errorf("failed to allocate chunk version: %w", err)
+	}
+
+	stream := &ingestStream{
+		documentID: documentID,
+		filename:   filename,
+		version:    version,
+		page:       1,
+		text:       newPageTextWriter(),
+	}
+	if access := CollectionAccessFromContext(ctx); access != nil {
+		stream.owner = access.MemberID
+	}
+	stream.idleTimer = time.AfterFunc(r.ingestStreamIdleTimeout(), func() {
+		r.expireIngestStream(stream)
+	})
+	r.ingesting.Store(documentID, true)
+	r.streams.Store(documentID, stream)
+
+	log.Printf("Opened ingest stream for %s (Document ID: %s)", filename, documentID)
+	return stream.status("processing"), nil
+}
+
+// AppendIngestStream adds a segment of text to a stream, storing the
+// chunks it fills. page numbers the segment's text (0 keeps the previous
+// segment's page); chunks don't span pages.
+func (r *SimpleRAGService) AppendIngestStream(ctx context.Context, documentID string, page int, text string) (*IngestStreamStatus, error) {
+	stream, err := r.ingestStream(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	release, err := r.Ingestions.Acquire(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.done {
+		return nil, ErrIngestStreamNotFound
+	}
+	stream.idleTimer.Reset(r.ingestStreamIdleTimeout())
+
+	if page > 0 && page != stream.page {
+		if err := r.flushIngestStream(ctx, stream, true); err != nil {
+			return nil, err
+		}
+		stream.page = page
+	}
+	text = r.PDFProcessor.cleanText(text)
+	if err := stream.text.Add(stream.page, text); err != nil {
+		return nil, err
+	}
+	stream.segments++
+	stream.bytes += int64(len(text))
+	for _, word := range strings.Fields(text) {
+		stream.words = append(stream.words, word)
+		stream.fresh++
+	}
+	if err := r.flushIngestStream(ctx, stream, false); err != nil {
+		return nil, err
+	}
+	return stream.status("processing"), nil
+}
+
+// CloseIngestStream stores the stream's remaining text and completes its
+// document. A stream without text fails with ErrNoText.
+func (r *SimpleRAGService) CloseIngestStream(ctx context.Context, documentID string) (*IngestStreamStatus, error) {
+	stream, err := r.ingestStream(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	release, err := r.Ingestions.Acquire(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.done {
+		return nil, ErrIngestStreamNotFound
+	}
+
+	err = r.flushIngestStream(ctx, stream, true)
+	if err == nil && stream.stored == 0 {
+		err = ErrNoText
+	}
+	if err != nil {
+		if !stream.done {
+			r.abortIngestStream(stream, "Processing failed: "+err.Error())
+		}
+		return nil, err
+	}
+	r.finishIngestStream(stream)
+
+	r.storePageText(ctx, documentID, stream.text)
+	if err := r.DatabaseSchema.UpdateDocumentSize(documentID, stream.bytes); err != nil {
+		log.Printf("Warning: failed to record size of %s: %v", documentID, err)
+	}
+	if _, err := r.DatabaseSchema.CommitChunkVersion(documentID, stream.version, stream.stored, "completed"); err != nil {
+		r.discardChunks(documentID, stream.version, stream.stored)
+		r.DatabaseSchema.UpdateDocumentStatus(documentID, "failed")
+		r.recordEvent(documentID, DocumentEventFailed, "Processing failed: failed to commit chunks: "+err.Error())
+		return nil, fmt.Errorf("failed to commit chunks: %w", err)
+	}
+	r.recordEvent(documentID, DocumentEventExtracted, fmt.Sprintf("Received %d segments (%d KB) and stored %d chunks", stream.segments, stream.bytes/1024, stream.stored))
+	r.wantSyntheticQuestions()
+	if r.Embedder != nil {
+		r.recordEvent(documentID, DocumentEventEmbedded, fmt.Sprintf("Embedded %d of %d chunks with %s", stream.embedded, stream.stored, r.Embedder.Name()))
+	}
+
+	log.Printf("Successfully processed %d chunks from ingest stream %s (Document ID: %s)", stream.stored, stream.filename, documentID)
+	r.Notifications.Notify(notificationRecipient(ctx), NotificationDocumentProcessed,
+		"Document processed: "+stream.filename, fmt.Sprintf("%s was indexed into %d chunks and can now be queried.", stream.filename, stream.stored), documentID)
+	return stream.status("completed"), nil
+}
+
+// AbortIngestStream discards a stream and marks its document failed
+func (r *SimpleRAGService) AbortIngestStream(ctx context.Context, documentID string) error {
+	stream, err := r.ingestStream(ctx, documentID)
+	if err != nil {
+		return err
+	}
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.done {
+		return ErrIngestStreamNotFound
+	}
+	r.abortIngestStream(stream, "The stream was aborted")
+	return nil
+}
+
+// ingestStream finds an open stream of the caller
+func (r *SimpleRAGService) ingestStream(ctx context.Context, documentID string) (*ingestStream, error) {
+	value, ok := r.streams.Load(documentID)
+	if !ok {
+		return nil, ErrIngestStreamNotFound
+	}
+	stream := value.(*ingestStream)
+	if access := CollectionAccessFromContext(ctx); access != nil && !access.Admin && access.MemberID != stream.owner {
+		return nil, ErrIngestStreamNotFound
+	}
+	return stream, nil
+}
+
+// flushIngestStream stores every full chunk of the held text, or with all
+// set the remainder too. A chunk that can't be stored aborts the stream.
+func (r *SimpleRAGService) flushIngestStream(ctx context.Context, stream *ingestStream, all bool) error {
+	var chunks []PDFChunk
+	for stream.fresh > 0 {
+		end, runes := 0, 0
+		for end < len(stream.words) && runes < streamChunkRunes {
+			runes += utf8.RuneCountInString(stream.words[end]) + 1
+			end++
+		}
+		if runes < streamChunkRunes && !all {
+			break
+		}
+
+		text := strings.Join(stream.words[:end], " ")
+		if utf8.RuneCountInString(text) >= r.settingsFor(ctx).pdf.MinChunkLength {
+			chunks = append(chunks, PDFChunk{
+				Text:     text,
+				Page:     stream.page,
+				Document: stream.filename,
+				Type:     ChunkTypeText,
+			})
+		}
+
+		if end == len(stream.words) && all {
+			stream.words, stream.fresh = nil, 0
+			break
+		}
+		// The next chunk starts with this one's last words, unless this
+		// one is too short to share them
+		next := end - streamOverlapWords
+		if next <= 0 {
+			next = end
+		}
+		stream.words = append([]string(nil), stream.words[next:]...)
+		stream.fresh = len(stream.words) - (end - next)
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	// Post-chunk hooks see each batch of chunks as it is stored, since the
+	// whole document is never held
+	chunks, err := r.runPostChunkHooks(ctx, stream.filename, chunks)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		embedded, err := r.storeChunk(ctx, stream.documentID, stream.version, stream.stored, chunk)
+		if err != nil {
+			// The stream can't be completed without this chunk
+			r.abortIngestStream(stream, "Processing failed: "+err.Error())
+			return err
+		}
+		if embedded {
+			stream.embedded++
+		}
+		stream.stored++
+	}
+	return nil
+}
+
+// expireIngestStream discards a stream nobody pushed to for the idle
+// timeout
+func (r *SimpleRAGService) expireIngestStream(stream *ingestStream) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.done {
+		return
+	}
+	log.Printf("Warning: ingest stream %s (%s) expired after %d segments", stream.documentID, stream.filename, stream.segments)
+	r.abortIngestStream(stream, fmt.Sprintf("The stream expired after %d segments with nothing pushed for %s", stream.segments, r.ingestStreamIdleTimeout()))
+}
+
+// abortIngestStream drops a stream's chunks and fails its document, giving
+// reason in its events; the caller holds stream.mu
+func (r *SimpleRAGService) abortIngestStream(stream *ingestStream, reason string) {
+	r.finishIngestStream(stream)
+	r.discardChunks(stream.documentID, stream.version, stream.stored)
+	if err := r.DatabaseSchema.UpdateDocumentStatus(stream.documentID, "failed"); err != nil {
+		log.Printf("Warning: failed to update document status: %v", err)
+	}
+	r.recordEvent(stream.documentID, DocumentEventFailed, reason)
+}
+
+// finishIngestStream closes a stream to further segments; the caller holds
+// stream.mu
+func (r *SimpleRAGService) finishIngestStream(stream *ingestStream) {
+	stream.done = true
+	stream.idleTimer.Stop()
+	r.streams.Delete(stream.documentID)
+	r.ingesting.Delete(stream.documentID)
+}
+
+func (r *SimpleRAGService) ingestStreamIdleTimeout() time.Duration {
+	if r.Config == nil || r.Config.IngestStreamIdleTimeout <= 0 {
+		return defaultIngestStreamIdleTimeout
+	}
+	return r.Config.IngestStreamIdleTimeout
+}
+
+func (s *ingestStream) status(status string) *IngestStreamStatus {
+	return &IngestStreamStatus{
+		DocumentID: s.documentID,
+		Filename:   s.filename,
+		Status:     status,
+		Segments:   s.segments,
+		Bytes:      s.bytes,
+		Chunks:     s.stored,
+	}
+}
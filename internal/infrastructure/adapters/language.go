@@ -0,0 +1,147 @@
+package adapters
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// Script names stored alongside chunks
+const (
+	ScriptLatin      = "latin"
+	ScriptArabic     = "arabic"
+	ScriptCyrillic   = "cyrillic"
+	ScriptHan        = "han"
+	ScriptHebrew     = "hebrew"
+	ScriptDevanagari = "devanagari"
+	ScriptKana       = "kana"
+	ScriptHangul     = "hangul"
+	ScriptUnknown    = "unknown"
+)
+
+// Letters that only appear in Persian among Arabic-script languages
+const persianOnlyLetters = "پچژگکی"
+
+var latinStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "for", "with", "what"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "que", "pour", "dans"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "ein", "den", "zu"},
+	"es": {"el", "la", "los", "y", "que", "es", "por", "una", "para", "con"},
+}
+
+// DetectScript returns the dominant writing script of text
+func DetectScript(text string) string {
+	counts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			counts[ScriptLatin]++
+		case unicode.Is(unicode.Arabic, r):
+			counts[ScriptArabic]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts[ScriptCyrillic]++
+		case unicode.Is(unicode.Han, r):
+			counts[ScriptHan]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts[ScriptHebrew]++
+		case unicode.Is(unicode.Devanagari, r):
+			counts[ScriptDevanagari]++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			counts[ScriptKana]++
+		case unicode.Is(unicode.Hangul, r):
+			counts[ScriptHangul]++
+		}
+	}
+
+	best, bestCount := ScriptUnknown, 0
+	for script, count := range counts {
+		if count > bestCount || (count == bestCount && script < best) {
+			best, bestCount = script, count
+		}
+	}
+	// Japanese text mixes kanji with kana; any kana means Japanese
+	if counts[ScriptKana] > 0 && best == ScriptHan {
+		best = ScriptKana
+	}
+	return best
+}
+
+// ValidAnswerLanguage reports whether answers can be forced into lang: the
+// answer prompts and refusal messages exist in English and Persian
+func ValidAnswerLanguage(lang string) bool {
+	return lang == "en" || lang == "fa"
+}
+
+type answerLanguageKey struct{}
+
+// WithAnswerLanguage forces the answers generated under ctx into lang,
+// over both the question's language and APP_LANGUAGE
+func WithAnswerLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, answerLanguageKey{}, lang)
+}
+
+// AnswerLanguageFromContext returns the answer language forced on ctx, or ""
+func AnswerLanguageFromContext(ctx context.Context) string {
+	lang, _ := ctx.Value(answerLanguageKey{}).(string)
+	return lang
+}
+
+// DetectLanguage returns a best-effort ISO 639-1 language code and the
+// dominant script. Unknown text yields an empty language.
+func DetectLanguage(text string) (language, script string) {
+	script = DetectScript(text)
+
+	switch script {
+	case ScriptArabic:
+		if strings.ContainsAny(text, persianOnlyLetters) {
+			return "fa", script
+		}
+		return "ar", script
+	case ScriptCyrillic:
+		return "ru", script
+	case ScriptHan:
+		return "zh", script
+	case ScriptKana:
+		return "ja", script
+	case ScriptHangul:
+		return "ko", script
+	case ScriptHebrew:
+		return "he", script
+	case ScriptDevanagari:
+		return "hi", script
+	case ScriptLatin:
+		return detectLatinLanguage(text), script
+	}
+	return "", script
+}
+
+// detectLatinLanguage picks between a few common Latin-script languages by
+// stopword frequency, defaulting to English
+func detectLatinLanguage(text string) string {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		return "en"
+	}
+
+	best, bestHits := "en", 0
+	for _, language := range []string{"en", "fr", "de", "es"} {
+		stopwords := latinStopwords[language]
+		hits := 0
+		for _, word := range words {
+			word = strings.Trim(word, ".,;:!?\"'()")
+			for _, stopword := range stopwords {
+				if word == stopword {
+					hits++
+					break
+				}
+			}
+		}
+		if hits > bestHits {
+			best, bestHits = language, hits
+		}
+	}
+	return best
+}
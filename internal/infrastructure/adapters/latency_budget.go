@@ -0,0 +1,133 @@
+package adapters
+
+import (
+	"context"
+	"time"
+)
+
+// Optional query stages a latency budget may skip
+const (
+	StageCrossLingualFallback = "cross_lingual_fallback"
+	StageNumericVerification  = "numeric_verification"
+	StageTranslation          = "translation"
+)
+
+// unmeasuredGeneration is assumed for an LLM call before any was timed
+const unmeasuredGeneration = 5 * time.Second
+
+// LatencyBudget fits a query into a maximum latency by skipping optional
+// stages and cutting the context when the time left can't cover them. It
+// travels through the context; the response reports what it gave up.
+type LatencyBudget struct {
+	MaxLatencyMs  int64    `json:"max_latency_ms"`
+	ElapsedMs     int64    `json:"elapsed_ms"`
+	Exceeded      bool     `json:"exceeded"`
+	SkippedStages []string `json:"skipped_stages"`
+	// ContextTruncated means the weakest chunks were dropped from the
+	// context, leaving ContextChunks
+	ContextTruncated bool `json:"context_truncated"`
+	ContextChunks    int  `json:"context_chunks,omitempty"`
+
+	started  time.Time
+	deadline time.Time
+}
+
+type latencyBudgetKey struct{}
+
+func NewLatencyBudget(maxLatency time.Duration) *LatencyBudget {
+	now := time.Now()
+	return &LatencyBudget{
+		MaxLatencyMs:  maxLatency.Milliseconds(),
+		SkippedStages: []string{},
+		started:       now,
+		deadline:      now.Add(maxLatency),
+	}
+}
+
+// WithLatencyBudget attaches a budget to the context
+func WithLatencyBudget(ctx context.Context, budget *LatencyBudget) context.Context {
+	return context.WithValue(ctx, latencyBudgetKey{}, budget)
+}
+
+// LatencyBudgetFromContext returns the budget attached to ctx, or nil
+func LatencyBudgetFromContext(ctx context.Context) *LatencyBudget {
+	budget, _ := ctx.Value(latencyBudgetKey{}).(*LatencyBudget)
+	return budget
+}
+
+// Allow reports whether an optional stage expected to take cost fits in the
+// time left, recording it as skipped if not. Without a budget every stage
+// runs.
+func (b *LatencyBudget) Allow(stage string, cost time.Duration) bool {
+	if b == nil {
+		return true
+	}
+	if cost > time.Until(b.deadline) {
+		b.SkippedStages = append(b.SkippedStages, stage)
+		return false
+	}
+	return true
+}
+
+// Finish records how long the query took against the budget
+func (b *LatencyBudget) Finish() {
+	elapsed := time.Since(b.started)
+	b.ElapsedMs = elapsed.Milliseconds()
+	b.Exceeded = b.ElapsedMs > b.MaxLatencyMs
+}
+
+// generationEstimate predicts an LLM call with a prompt of promptTokens
+func generationEstimate(promptTokens int) time.Duration {
+	if estimate, ok := DefaultMetrics.GenerationEstimate(promptTokens); ok {
+		return estimate
+	}
+	return unmeasuredGeneration
+}
+
+// fullContextGeneration predicts answering from a context of the maximum
+// size, the time optional stages before generation have to leave
+func fullContextGeneration() time.Duration {
+	return generationEstimate(maxContextRunes / 4)
+}
+
+// fitContext drops the weakest chunks until the answer is expected to be
+// generated in the time left, always keeping the best chunk
+func (r *SimpleRAGService) fitContext(budget *LatencyBudget, lang, question string, chunks []ScoredChunk, context string) ([]ScoredChunk, string) {
+	for n := len(chunks); n > 0; n-- {
+		text := context
+		if n < len(chunks) {
+			text = buildContext(chunks[:n])
+		}
+		if n > 1 && generationEstimate(EstimateTokens(r.answerPrompt(lang, text, question))) > time.Until(budget.deadline) {
+			continue
+		}
+		if n < len(chunks) {
+			budget.ContextTruncated = true
+			budget.ContextChunks = n
+		}
+		return chunks[:n], text
+	}
+	return chunks, context
+}
+
+// crossLingualEstimate predicts the fallback's question translations
+func (r *SimpleRAGService) crossLingualEstimate(question, questionLanguage string) time.Duration {
+	if r.Config == nil {
+		return 0
+	}
+	perLanguage := generationEstimate(EstimateTokens(questionTranslationPrompt(question, questionLanguage)))
+	return time.Duration(r.Config.CrossLingualMaxLanguages) * perLanguage
+}
+
+// translationEstimate predicts translating the answer and its snippets
+func translationEstimate(response *SimpleRAGResponse, language string) time.Duration {
+	estimate := generationEstimate(EstimateTokens(translationPrompt(response.Answer, language)))
+	for i, scored := range response.chunks {
+		if i >= maxTranslatedSnippets {
+			break
+		}
+		snippet := TruncateRunes(scored.Chunk.ChunkText, 300)
+		estimate += generationEstimate(EstimateTokens(translationPrompt(snippet, language)))
+	}
+	return estimate
+}
@@ -0,0 +1,116 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLLMSaturated is returned when a generation could not get a slot before
+// the queue timeout expired.
+var ErrLLMSaturated = errors.New("LLM provider is saturated, too many concurrent requests")
+
+// LimitedLLMClient bounds the number of concurrent generations sent to a
+// provider. Excess requests wait in line for up to the queue timeout before
+// failing with ErrLLMSaturated. Tenants, when set, first limits each caller's share
+// of the slots.
+type LimitedLLMClient struct {
+	Client  LLMClient
+	Tenants *TenantLimiter
+	slots   chan struct{}
+	waiting int32
+	// maxWait is the queue timeout, see SetMaxWait
+	maxWait atomic.Int64
+}
+
+func NewLimitedLLMClient(client LLMClient, maxConcurrent int, maxWait time.Duration) *LimitedLLMClient {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	l := &LimitedLLMClient{
+		Client: client,
+		slots:  make(chan struct{}, maxConcurrent),
+	}
+	l.SetMaxWait(maxWait)
+	return l
+}
+
+// SetMaxWait changes the queue timeout; generations already waiting keep
+// the one they started with
+func (l *LimitedLLMClient) SetMaxWait(maxWait time.Duration) {
+	l.maxWait.Store(int64(maxWait))
+}
+
+func (l *LimitedLLMClient) GenerateText(ctx context.Context, prompt string) (string, error) {
+	// Waiting behind the caller's own requests holds no provider slot
+	maxWait := time.Duration(l.maxWait.Load())
+	releaseTenant, err := l.Tenants.Acquire(ctx, maxWait)
+	if err != nil {
+		if errors.Is(err, ErrTenantQueueFull) || errors.Is(err, ErrTenantQueueTimeout) {
+			err = fmt.Errorf("%w: %v", ErrLLMSaturated, err)
+		}
+		DefaultMetrics.RecordLLMError(errors.Is(err, ErrLLMSaturated))
+		return "", err
+	}
+	defer releaseTenant()
+
+	if err := l.acquire(ctx, maxWait); err != nil {
+		DefaultMetrics.RecordLLMError(errors.Is(err, ErrLLMSaturated))
+		return "", err
+	}
+	defer l.release()
+
+	// Injected faults hold the slot like a slow or failing provider would
+	if err := InjectFault(ctx, FaultLLM); err != nil {
+		DefaultMetrics.RecordLLMError(false)
+		return "", err
+	}
+	text, err := l.Client.GenerateText(ctx, prompt)
+	if err != nil {
+		DefaultMetrics.RecordLLMError(false)
+	}
+	return text, err
+}
+
+// InFlight reports how many generations currently hold a slot.
+func (l *LimitedLLMClient) InFlight() int {
+	return len(l.slots)
+}
+
+func (l *LimitedLLMClient) acquire(ctx context.Context, maxWait time.Duration) error {
+	// Fast path when a slot is free
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if maxWait <= 0 {
+		return ErrLLMSaturated
+	}
+
+	position := int(atomic.AddInt32(&l.waiting, 1))
+	start := time.Now()
+	defer func() {
+		atomic.AddInt32(&l.waiting, -1)
+		QueueWaitFromContext(ctx).record(position, time.Since(start))
+	}()
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrLLMSaturated
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *LimitedLLMClient) release() {
+	<-l.slots
+}
@@ -0,0 +1,64 @@
+package adapters
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// Mailer sends plain-text email through the SMTP server in the config
+type Mailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+	Host     string
+}
+
+// NewMailer returns nil when SMTP_HOST is not set, so email stays off
+func NewMailer(cfg *config.Config) *Mailer {
+	if cfg.SMTPHost == "" {
+		return nil
+	}
+	from := cfg.SMTPFrom
+	if from == "" {
+		from = cfg.SMTPUsername
+	}
+	return &Mailer{
+		Addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		From:     from,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		Host:     cfg.SMTPHost,
+	}
+}
+
+// Send emails one recipient. SMTP servers that support STARTTLS are used
+// over TLS; credentials are only sent when SMTP_USERNAME is set.
+func (m *Mailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// Header values come from users and documents; keep them on one line
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+	message := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+
+	if err := smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(message)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
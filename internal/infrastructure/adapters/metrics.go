@@ -0,0 +1,392 @@
+package adapters
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GenerationStats describes a single LLM generation as reported by the provider
+type GenerationStats struct {
+	Provider           string  `json:"provider"`
+	Model              string  `json:"model"`
+	TotalMs            float64 `json:"total_ms"`
+	LoadMs             float64 `json:"load_ms"`
+	PromptEvalCount    int     `json:"prompt_eval_count"`
+	PromptEvalMs       float64 `json:"prompt_eval_ms"`
+	PromptTokensPerSec float64 `json:"prompt_tokens_per_sec"`
+	EvalCount          int     `json:"eval_count"`
+	EvalMs             float64 `json:"eval_ms"`
+	TokensPerSec       float64 `json:"tokens_per_sec"`
+}
+
+// HostMetrics is a snapshot of basic process and host resource usage
+type HostMetrics struct {
+	NumCPU         int       `json:"num_cpu"`
+	Goroutines     int       `json:"goroutines"`
+	HeapAllocBytes uint64    `json:"heap_alloc_bytes"`
+	SysBytes       uint64    `json:"sys_bytes"`
+	NumGC          uint32    `json:"num_gc"`
+	LoadAverage    []float64 `json:"load_average,omitempty"`
+}
+
+// ReadHostMetrics collects runtime memory stats and, on Linux, the load average
+func ReadHostMetrics() HostMetrics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return HostMetrics{
+		NumCPU:         runtime.NumCPU(),
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: mem.HeapAlloc,
+		SysBytes:       mem.Sys,
+		NumGC:          mem.NumGC,
+		LoadAverage:    readLoadAverage(),
+	}
+}
+
+func readLoadAverage() []float64 {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return nil
+	}
+
+	loads := make([]float64, 0, 3)
+	for _, field := range fields[:3] {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil
+		}
+		loads = append(loads, value)
+	}
+	return loads
+}
+
+type generationTotals struct {
+	count           int64
+	totalSeconds    float64
+	loadSeconds     float64
+	promptEvalCount int64
+	promptEvalSecs  float64
+	evalCount       int64
+	evalSecs        float64
+	last            GenerationStats
+}
+
+// connectionTotals counts how a provider's HTTP requests got their
+// connections
+type connectionTotals struct {
+	requests      int64
+	reused        int64
+	http2         int64
+	dnsLookups    int64
+	dnsCacheHits  int64
+	tlsHandshakes int64
+	tlsSeconds    float64
+}
+
+// Metrics collects in-process counters and timings exposed on /metrics
+type Metrics struct {
+	mu               sync.Mutex
+	generations      map[string]*generationTotals
+	retrievalCount   int64
+	retrievalSeconds float64
+	requests         map[string]int64
+	slowRequests     map[string]int64
+	timeouts         map[string]int64
+	llmErrors        int64
+	llmSaturated     int64
+	connections      map[string]*connectionTotals
+}
+
+// DefaultMetrics is the process-wide registry used by adapters
+var DefaultMetrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		generations:  make(map[string]*generationTotals),
+		requests:     make(map[string]int64),
+		slowRequests: make(map[string]int64),
+		timeouts:     make(map[string]int64),
+		connections:  make(map[string]*connectionTotals),
+	}
+}
+
+// RecordGeneration accumulates provider-reported generation timings
+func (m *Metrics) RecordGeneration(stats GenerationStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totals, ok := m.generations[stats.Provider]
+	if !ok {
+		totals = &generationTotals{}
+		m.generations[stats.Provider] = totals
+	}
+
+	totals.count++
+	totals.totalSeconds += stats.TotalMs / 1000
+	totals.loadSeconds += stats.LoadMs / 1000
+	totals.promptEvalCount += int64(stats.PromptEvalCount)
+	totals.promptEvalSecs += stats.PromptEvalMs / 1000
+	totals.evalCount += int64(stats.EvalCount)
+	totals.evalSecs += stats.EvalMs / 1000
+	totals.last = stats
+}
+
+// GenerationEstimate predicts how long a generation with promptTokens of
+// prompt takes from the generations recorded so far: their average time,
+// adjusted by the provider's prompt evaluation rate when it reports one.
+// It returns false before any generation was recorded.
+func (m *Metrics) GenerationEstimate(promptTokens int) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count, promptEvalCount int64
+	var totalSeconds, promptEvalSecs float64
+	for _, totals := range m.generations {
+		count += totals.count
+		totalSeconds += totals.totalSeconds
+		promptEvalCount += totals.promptEvalCount
+		promptEvalSecs += totals.promptEvalSecs
+	}
+	if count == 0 {
+		return 0, false
+	}
+
+	seconds := totalSeconds / float64(count)
+	if promptEvalCount > 0 && promptEvalSecs > 0 {
+		averagePrompt := float64(promptEvalCount) / float64(count)
+		perToken := promptEvalSecs / float64(promptEvalCount)
+		// Prompts shorter than average still cost the generation itself
+		seconds = math.Max(seconds+(float64(promptTokens)-averagePrompt)*perToken, seconds/4)
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// RecordRetrieval accumulates time spent scoring chunks for a query
+func (m *Metrics) RecordRetrieval(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.retrievalCount++
+	m.retrievalSeconds += d.Seconds()
+}
+
+// RecordRequest counts a finished HTTP request by status class ("2xx", "5xx", ...)
+func (m *Metrics) RecordRequest(status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[fmt.Sprintf("%dxx", status/100)]++
+}
+
+// RecordSlowRequest counts a request slower than its route class's
+// threshold; timedOut means it ran past the class's deadline
+func (m *Metrics) RecordSlowRequest(class string, timedOut bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.slowRequests[class]++
+	if timedOut {
+		m.timeouts[class]++
+	}
+}
+
+// RecordLLMError counts a failed generation; saturated means it never got a
+// slot in the provider queue
+func (m *Metrics) RecordLLMError(saturated bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if saturated {
+		m.llmSaturated++
+	} else {
+		m.llmErrors++
+	}
+}
+
+// connectionTotalsFor returns a provider's connection counters; m.mu is held
+func (m *Metrics) connectionTotalsFor(provider string) *connectionTotals {
+	totals, ok := m.connections[provider]
+	if !ok {
+		totals = &connectionTotals{}
+		m.connections[provider] = totals
+	}
+	return totals
+}
+
+// RecordConnection counts a provider request by whether it reused a pooled
+// connection and whether it went over HTTP/2
+func (m *Metrics) RecordConnection(provider string, reused, http2 bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totals := m.connectionTotalsFor(provider)
+	totals.requests++
+	if reused {
+		totals.reused++
+	}
+	if http2 {
+		totals.http2++
+	}
+}
+
+// RecordDNSLookup counts a provider host lookup; cached means the DNS cache
+// answered it
+func (m *Metrics) RecordDNSLookup(provider string, cached bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totals := m.connectionTotalsFor(provider)
+	totals.dnsLookups++
+	if cached {
+		totals.dnsCacheHits++
+	}
+}
+
+// RecordTLSHandshake accumulates a provider connection's TLS handshake time
+func (m *Metrics) RecordTLSHandshake(provider string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totals := m.connectionTotalsFor(provider)
+	totals.tlsHandshakes++
+	totals.tlsSeconds += d.Seconds()
+}
+
+// Counters returns request counts by status class and LLM error counts
+func (m *Metrics) Counters() (requests map[string]int64, llmErrors, llmSaturated int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requests = make(map[string]int64, len(m.requests))
+	for class, count := range m.requests {
+		requests[class] = count
+	}
+	return requests, m.llmErrors, m.llmSaturated
+}
+
+// WritePrometheus renders all metrics in the Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	providers := make([]string, 0, len(m.generations))
+	for provider := range m.generations {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	writeHeader := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	series := []struct {
+		name  string
+		kind  string
+		help  string
+		value func(t *generationTotals) float64
+	}{
+		{"rag_llm_generations_total", "counter", "Completed LLM generations.", func(t *generationTotals) float64 { return float64(t.count) }},
+		{"rag_llm_generation_seconds_total", "counter", "Total wall time spent in LLM generations.", func(t *generationTotals) float64 { return t.totalSeconds }},
+		{"rag_llm_load_seconds_total", "counter", "Time the provider spent loading the model.", func(t *generationTotals) float64 { return t.loadSeconds }},
+		{"rag_llm_prompt_eval_tokens_total", "counter", "Prompt tokens evaluated.", func(t *generationTotals) float64 { return float64(t.promptEvalCount) }},
+		{"rag_llm_prompt_eval_seconds_total", "counter", "Time spent evaluating prompts.", func(t *generationTotals) float64 { return t.promptEvalSecs }},
+		{"rag_llm_eval_tokens_total", "counter", "Tokens generated.", func(t *generationTotals) float64 { return float64(t.evalCount) }},
+		{"rag_llm_eval_seconds_total", "counter", "Time spent generating tokens.", func(t *generationTotals) float64 { return t.evalSecs }},
+		{"rag_llm_last_tokens_per_second", "gauge", "Generation rate of the most recent request.", func(t *generationTotals) float64 { return t.last.TokensPerSec }},
+		{"rag_llm_last_load_seconds", "gauge", "Model load time of the most recent request.", func(t *generationTotals) float64 { return t.last.LoadMs / 1000 }},
+	}
+
+	for _, s := range series {
+		writeHeader(s.name, s.kind, s.help)
+		for _, provider := range providers {
+			fmt.Fprintf(w, "%s{provider=%q} %g\n", s.name, provider, s.value(m.generations[provider]))
+		}
+	}
+
+	writeHeader("rag_retrievals_total", "counter", "Completed retrieval passes.")
+	fmt.Fprintf(w, "rag_retrievals_total %d\n", m.retrievalCount)
+	writeHeader("rag_retrieval_seconds_total", "counter", "Time spent scoring chunks.")
+	fmt.Fprintf(w, "rag_retrieval_seconds_total %g\n", m.retrievalSeconds)
+
+	classes := make([]string, 0, len(m.requests))
+	for class := range m.requests {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	writeHeader("rag_http_requests_total", "counter", "Finished HTTP requests by status class.")
+	for _, class := range classes {
+		fmt.Fprintf(w, "rag_http_requests_total{class=%q} %d\n", class, m.requests[class])
+	}
+	routeClasses := make([]string, 0, len(m.slowRequests))
+	for class := range m.slowRequests {
+		routeClasses = append(routeClasses, class)
+	}
+	sort.Strings(routeClasses)
+	writeHeader("rag_http_slow_requests_total", "counter", "HTTP requests slower than their route class's threshold.")
+	for _, class := range routeClasses {
+		fmt.Fprintf(w, "rag_http_slow_requests_total{route_class=%q} %d\n", class, m.slowRequests[class])
+	}
+	writeHeader("rag_http_timeouts_total", "counter", "HTTP requests that ran past their route class's deadline.")
+	for _, class := range routeClasses {
+		fmt.Fprintf(w, "rag_http_timeouts_total{route_class=%q} %d\n", class, m.timeouts[class])
+	}
+	connectionProviders := make([]string, 0, len(m.connections))
+	for provider := range m.connections {
+		connectionProviders = append(connectionProviders, provider)
+	}
+	sort.Strings(connectionProviders)
+	connectionSeries := []struct {
+		name  string
+		kind  string
+		help  string
+		value func(t *connectionTotals) float64
+	}{
+		{"rag_provider_requests_total", "counter", "HTTP requests to LLM providers.", func(t *connectionTotals) float64 { return float64(t.requests) }},
+		{"rag_provider_reused_connections_total", "counter", "Provider requests sent on a pooled keep-alive connection.", func(t *connectionTotals) float64 { return float64(t.reused) }},
+		{"rag_provider_http2_requests_total", "counter", "Provider requests sent over HTTP/2.", func(t *connectionTotals) float64 { return float64(t.http2) }},
+		{"rag_provider_dns_lookups_total", "counter", "Provider host lookups.", func(t *connectionTotals) float64 { return float64(t.dnsLookups) }},
+		{"rag_provider_dns_cache_hits_total", "counter", "Provider host lookups answered from the DNS cache.", func(t *connectionTotals) float64 { return float64(t.dnsCacheHits) }},
+		{"rag_provider_tls_handshakes_total", "counter", "TLS handshakes with LLM providers.", func(t *connectionTotals) float64 { return float64(t.tlsHandshakes) }},
+		{"rag_provider_tls_handshake_seconds_total", "counter", "Time spent in TLS handshakes with LLM providers.", func(t *connectionTotals) float64 { return t.tlsSeconds }},
+	}
+	for _, s := range connectionSeries {
+		writeHeader(s.name, s.kind, s.help)
+		for _, provider := range connectionProviders {
+			fmt.Fprintf(w, "%s{provider=%q} %g\n", s.name, provider, s.value(m.connections[provider]))
+		}
+	}
+
+	writeHeader("rag_llm_errors_total", "counter", "Failed LLM generations.")
+	fmt.Fprintf(w, "rag_llm_errors_total %d\n", m.llmErrors)
+	writeHeader("rag_llm_saturated_total", "counter", "Generations rejected because the LLM queue was full.")
+	fmt.Fprintf(w, "rag_llm_saturated_total %d\n", m.llmSaturated)
+	m.mu.Unlock()
+
+	host := ReadHostMetrics()
+	writeHeader("rag_host_cpus", "gauge", "Logical CPUs available to the process.")
+	fmt.Fprintf(w, "rag_host_cpus %d\n", host.NumCPU)
+	writeHeader("rag_process_goroutines", "gauge", "Running goroutines.")
+	fmt.Fprintf(w, "rag_process_goroutines %d\n", host.Goroutines)
+	writeHeader("rag_process_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.")
+	fmt.Fprintf(w, "rag_process_heap_alloc_bytes %d\n", host.HeapAllocBytes)
+	writeHeader("rag_process_sys_bytes", "gauge", "Bytes of memory obtained from the OS.")
+	fmt.Fprintf(w, "rag_process_sys_bytes %d\n", host.SysBytes)
+	if len(host.LoadAverage) == 3 {
+		writeHeader("rag_host_load_average", "gauge", "Host load average.")
+		for i, window := range []string{"1m", "5m", "15m"} {
+			fmt.Fprintf(w, "rag_host_load_average{window=%q} %g\n", window, host.LoadAverage[i])
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 
 	"rag-service/internal/infrastructure/config"
 
@@ -18,11 +19,30 @@ type MinIOAdapter struct {
 	Config *config.Config
 }
 
-func NewMinIOAdapter(cfg *config.Config) (*MinIOAdapter, error) {
-	client, err := minio.New(cfg.MinIOEndpoint, &minio.Options{
+// NewMinIOAdapter connects with the configured credentials, or with ones
+// from secrets when it isn't nil
+func NewMinIOAdapter(cfg *config.Config, secrets *Secrets) (*MinIOAdapter, error) {
+	options := &minio.Options{
 		Creds:  credentials.NewStaticV4(cfg.MinIOAccessKey, cfg.MinIOSecretKey, ""),
 		Secure: cfg.MinIOUseSSL,
-	})
+	}
+	if secrets != nil || cfg.FaultInjection {
+		var transport http.RoundTripper
+		transport, err := minio.DefaultTransport(cfg.MinIOUseSSL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MinIO transport: %w", err)
+		}
+		if secrets != nil {
+			options.Creds = credentials.New(&minioCredentials{secrets: secrets})
+			transport = &minioAuthTransport{base: transport, secrets: secrets}
+		}
+		if cfg.FaultInjection {
+			transport = &faultTransport{base: transport, target: FaultMinIO}
+		}
+		options.Transport = transport
+	}
+
+	client, err := minio.New(cfg.MinIOEndpoint, options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
 	}
@@ -113,6 +133,98 @@ func (m *MinIOAdapter) FlushAllFiles(ctx context.Context) error {
 		}
 	}
 
+	// Archived originals live in the tiering bucket
+	if m.Config.TieringBucket != "" {
+		exists, err := m.Client.BucketExists(ctx, m.Config.TieringBucket)
+		if err != nil {
+			return fmt.Errorf("failed to check bucket existence: %w", err)
+		}
+		if exists {
+			if err := m.RemovePrefix(ctx, m.Config.TieringBucket, ""); err != nil {
+				return err
+			}
+		}
+	}
+
 	log.Println("✅ All files flushed from MinIO successfully")
 	return nil
 }
+
+// RemovePrefix deletes every object under prefix, e.g. all files of a document
+func (m *MinIOAdapter) RemovePrefix(ctx context.Context, bucketName, prefix string) error {
+	objectCh := m.Client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	for object := range objectCh {
+		if object.Err != nil {
+			return fmt.Errorf("error listing objects: %w", object.Err)
+		}
+
+		err := m.Client.RemoveObject(ctx, bucketName, object.Key, minio.RemoveObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("error removing object %s: %w", object.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// BucketUsage counts objects and bytes stored in a bucket
+func (m *MinIOAdapter) BucketUsage(ctx context.Context, bucketName string) (int, int64, error) {
+	objectCh := m.Client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Recursive: true,
+	})
+
+	count := 0
+	var size int64
+	for object := range objectCh {
+		if object.Err != nil {
+			return 0, 0, fmt.Errorf("error listing objects: %w", object.Err)
+		}
+		count++
+		size += object.Size
+	}
+
+	return count, size, nil
+}
+
+// EnsureBucket creates a bucket if it doesn't exist yet
+func (m *MinIOAdapter) EnsureBucket(ctx context.Context, bucketName string) error {
+	exists, err := m.Client.BucketExists(ctx, bucketName)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket existence: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	if err := m.Client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{}); err != nil {
+		return fmt.Errorf("failed to create bucket: %w", err)
+	}
+	log.Printf("✅ Created MinIO bucket: %s", bucketName)
+	return nil
+}
+
+// MoveObject copies an object to another bucket under the same name, then
+// removes the source
+func (m *MinIOAdapter) MoveObject(ctx context.Context, srcBucket, dstBucket, objectName string) error {
+	_, err := m.Client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: dstBucket, Object: objectName},
+		minio.CopySrcOptions{Bucket: srcBucket, Object: objectName},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+
+	if err := m.Client.RemoveObject(ctx, srcBucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove source object: %w", err)
+	}
+	return nil
+}
+
+// RemoveObject deletes a single object
+func (m *MinIOAdapter) RemoveObject(ctx context.Context, bucketName, objectName string) error {
+	return m.Client.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
+}
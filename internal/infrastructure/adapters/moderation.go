@@ -0,0 +1,297 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// Moderation stages
+const (
+	ModerationQuestion = "question"
+	ModerationAnswer   = "answer"
+)
+
+// Moderation actions: block refuses the request, flag marks the response,
+// log only records the incident
+const (
+	ModerationBlock = "block"
+	ModerationFlag  = "flag"
+	ModerationLog   = "log"
+)
+
+// maxIncidentContent caps how much flagged text an incident keeps
+const maxIncidentContent = 2000
+
+// ModerationResult is the verdict on one piece of text
+type ModerationResult struct {
+	Stage      string   `json:"stage"`
+	Flagged    bool     `json:"flagged"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+// Moderator checks text against a moderation provider
+type Moderator interface {
+	Name() string
+	Moderate(ctx context.Context, text string) (*ModerationResult, error)
+}
+
+// RuleModerator flags text containing listed words or phrases, matched on
+// word boundaries like restricted topics
+type RuleModerator struct {
+	// rules maps a normalized term to its category
+	rules map[string]string
+}
+
+// NewRuleModerator parses comma-separated rules, each "category:term" or a
+// bare term filed under "blocked_term"
+func NewRuleModerator(rules string) *RuleModerator {
+	m := &RuleModerator{rules: make(map[string]string)}
+	for _, rule := range strings.Split(rules, ",") {
+		category, term, ok := strings.Cut(rule, ":")
+		if !ok {
+			category, term = "blocked_term", rule
+		}
+		category = strings.TrimSpace(category)
+		if term = normalizeTopicText(term); term != "" && category != "" {
+			m.rules[term] = category
+		}
+	}
+	return m
+}
+
+func (m *RuleModerator) Name() string {
+	return "rules"
+}
+
+func (m *RuleModerator) Moderate(ctx context.Context, text string) (*ModerationResult, error) {
+	normalized := " " + normalizeTopicText(text) + " "
+	matched := make(map[string]bool)
+	for term, category := range m.rules {
+		if strings.Contains(normalized, " "+term+" ") {
+			matched[category] = true
+		}
+	}
+	return newModerationResult(matched), nil
+}
+
+// OpenAIModerator calls an OpenAI-compatible /moderations endpoint
+type OpenAIModerator struct {
+	URL    string
+	APIKey string
+	Model  string
+	Client *http.Client
+	// Secrets supplies the API key instead of APIKey when set
+	Secrets *Secrets
+}
+
+func (m *OpenAIModerator) Name() string {
+	return "openai"
+}
+
+func (m *OpenAIModerator) Moderate(ctx context.Context, text string) (*ModerationResult, error) {
+	request := map[string]string{"input": text}
+	if m.Model != "" {
+		request["model"] = m.Model
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode moderation request: %w", err)
+	}
+
+	resp, err := m.send(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("moderation API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(reply)))
+	}
+
+	var reply struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("failed to decode moderation response: %w", err)
+	}
+	if len(reply.Results) == 0 {
+		return nil, fmt.Errorf("moderation response has no results")
+	}
+
+	result := reply.Results[0]
+	matched := make(map[string]bool)
+	for category, hit := range result.Categories {
+		if hit {
+			matched[category] = true
+		}
+	}
+	if result.Flagged && len(matched) == 0 {
+		matched["flagged"] = true
+	}
+	return newModerationResult(matched), nil
+}
+
+// send posts a moderation request. A rejected key is fetched again and the
+// request retried once, in case it was rotated.
+func (m *OpenAIModerator) send(ctx context.Context, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		apiKey := m.APIKey
+		if m.Secrets != nil {
+			apiKey = m.Secrets.Get(ctx, SecretOpenAIAPIKey)
+		}
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+
+		resp, err := m.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if m.Secrets != nil && attempt == 0 && resp.StatusCode == http.StatusUnauthorized {
+			resp.Body.Close()
+			m.Secrets.Invalidate(SecretOpenAIAPIKey)
+			continue
+		}
+		return resp, nil
+	}
+}
+
+func newModerationResult(categories map[string]bool) *ModerationResult {
+	result := &ModerationResult{Flagged: len(categories) > 0}
+	for category := range categories {
+		result.Categories = append(result.Categories, category)
+	}
+	sort.Strings(result.Categories)
+	return result
+}
+
+// Moderation runs the configured moderator over questions and answers and
+// records an incident for everything it flags
+type Moderation struct {
+	Action   string
+	FailOpen bool
+	// Stages lists what is moderated: questions, answers or both
+	Stages    map[string]bool
+	moderator Moderator
+	ds        *DatabaseSchema
+}
+
+// NewModeration sets up cfg.ModerationProvider: "rules" uses
+// cfg.ModerationRules, "openai" calls cfg.ModerationAPIURL. Moderation is
+// off when no provider is configured.
+func NewModeration(cfg *config.Config, ds *DatabaseSchema) *Moderation {
+	m := &Moderation{
+		Action:   strings.ToLower(strings.TrimSpace(cfg.ModerationAction)),
+		FailOpen: cfg.ModerationFailOpen,
+		Stages:   make(map[string]bool),
+		ds:       ds,
+	}
+
+	switch m.Action {
+	case ModerationBlock, ModerationFlag, ModerationLog:
+	default:
+		log.Printf("Warning: unknown MODERATION_ACTION %q, using %q", cfg.ModerationAction, ModerationBlock)
+		m.Action = ModerationBlock
+	}
+
+	for _, stage := range strings.Split(cfg.ModerationStages, ",") {
+		switch stage = strings.TrimSpace(stage); stage {
+		case ModerationQuestion, ModerationAnswer:
+			m.Stages[stage] = true
+		case "":
+		default:
+			log.Printf("Warning: ignoring unknown moderation stage %q", stage)
+		}
+	}
+
+	switch provider := strings.ToLower(strings.TrimSpace(cfg.ModerationProvider)); provider {
+	case "":
+	case "rules":
+		m.moderator = NewRuleModerator(cfg.ModerationRules)
+	case "openai":
+		m.moderator = &OpenAIModerator{
+			URL:    cfg.ModerationAPIURL,
+			APIKey: cfg.ModerationAPIKey,
+			Model:  cfg.ModerationModel,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}
+	default:
+		log.Printf("Warning: unknown MODERATION_PROVIDER %q, moderation is off", provider)
+	}
+
+	if m.moderator != nil {
+		log.Printf("✅ Moderation enabled: provider=%s action=%s", m.moderator.Name(), m.Action)
+	}
+	return m
+}
+
+// UseSecrets makes the OpenAI moderator take its API key from secrets
+func (m *Moderation) UseSecrets(secrets *Secrets) {
+	if openai, ok := m.moderator.(*OpenAIModerator); ok {
+		openai.Secrets = secrets
+	}
+}
+
+// Enabled reports whether the given stage is moderated
+func (m *Moderation) Enabled(stage string) bool {
+	return m.moderator != nil && m.Stages[stage]
+}
+
+// Review moderates text at a stage and records an incident when it is
+// flagged. It returns nil when the text passes or the stage isn't moderated.
+// Provider errors are logged and let the text through when FailOpen is set.
+func (m *Moderation) Review(ctx context.Context, stage, text, question string) (*ModerationResult, error) {
+	if !m.Enabled(stage) || strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	result, err := m.moderator.Moderate(ctx, text)
+	if err != nil {
+		if m.FailOpen {
+			log.Printf("Warning: moderation of %s failed, letting it through: %v", stage, err)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("moderation failed: %w", err)
+	}
+	if !result.Flagged {
+		return nil, nil
+	}
+	result.Stage = stage
+
+	incident := &ModerationIncident{
+		ID:         fmt.Sprintf("incident_%d", time.Now().UnixNano()),
+		Stage:      stage,
+		Action:     m.Action,
+		Provider:   m.moderator.Name(),
+		Categories: result.Categories,
+		Content:    TruncateRunes(text, maxIncidentContent),
+	}
+	if stage == ModerationAnswer {
+		incident.Question = question
+	}
+	if err := m.ds.InsertModerationIncident(incident); err != nil {
+		log.Printf("Warning: failed to record moderation incident: %v", err)
+	}
+	log.Printf("Moderation flagged %s (%s), action=%s", stage, strings.Join(result.Categories, ", "), m.Action)
+
+	return result, nil
+}
@@ -15,7 +15,9 @@ type MySQLAdapter struct {
 }
 
 func NewMySQLAdapter(cfg *config.Config) (*MySQLAdapter, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+	// Sessions run in UTC, so TIMESTAMP columns are read and written in UTC
+	// whatever the server's time zone, and scan into UTC time.Time values
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC&time_zone=%%27%%2B00%%3A00%%27",
 		cfg.MySQLUser,
 		cfg.MySQLPassword,
 		cfg.MySQLHost,
@@ -23,7 +25,11 @@ func NewMySQLAdapter(cfg *config.Config) (*MySQLAdapter, error) {
 		cfg.MySQLDatabase,
 	)
 
-	db, err := sql.Open("mysql", dsn)
+	driverName := "mysql"
+	if cfg.FaultInjection {
+		driverName = faultDriverName
+	}
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open MySQL connection: %w", err)
 	}
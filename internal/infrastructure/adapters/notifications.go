@@ -0,0 +1,163 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// Notification kinds
+const (
+	NotificationDocumentProcessed = "document_processed"
+	NotificationDocumentFailed    = "document_failed"
+	NotificationDocumentNeedsOCR  = "document_needs_ocr"
+	NotificationAnswerChanged     = "answer_changed"
+)
+
+// Notifications records per-user events and delivers them by email and to
+// NOTIFICATION_WEBHOOK_URL when configured. Recipients are ActorIDs, the
+// same ids the audit log and usage quotas use.
+type Notifications struct {
+	WebhookURL string
+	Mailer     *Mailer
+	// Digests is nil unless digests are configured
+	Digests *Digests
+	Client  *http.Client
+	ds      *DatabaseSchema
+}
+
+func NewNotifications(cfg *config.Config, ds *DatabaseSchema) *Notifications {
+	mailer := NewMailer(cfg)
+	return &Notifications{
+		WebhookURL: cfg.NotificationWebhookURL,
+		Mailer:     mailer,
+		Digests:    NewDigests(cfg, ds, mailer),
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		ds:         ds,
+	}
+}
+
+// Notify stores a notification for recipient and delivers it in the
+// background; delivery failures are only logged. Events without a known
+// recipient (background work) are dropped.
+func (n *Notifications) Notify(recipient, kind, title, message, resource string) {
+	if recipient == "" {
+		return
+	}
+
+	notification := &NotificationRecord{
+		Recipient: recipient,
+		Kind:      kind,
+		Title:     title,
+		Message:   message,
+		Resource:  resource,
+		CreatedAt: dbNow(),
+	}
+	if err := n.ds.InsertNotification(notification); err != nil {
+		log.Printf("Warning: failed to store notification for %s: %v", recipient, err)
+		return
+	}
+
+	go n.deliver(notification)
+}
+
+func (n *Notifications) deliver(notification *NotificationRecord) {
+	if n.WebhookURL != "" {
+		if err := n.postWebhook(notification); err != nil {
+			log.Printf("Warning: notification webhook failed: %v", err)
+		}
+	}
+
+	if n.Mailer == nil {
+		return
+	}
+	settings, err := n.ds.GetNotificationSettings(notification.Recipient)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && settings.Email == "") {
+		return
+	}
+	if err != nil {
+		log.Printf("Warning: failed to load notification settings for %s: %v", notification.Recipient, err)
+		return
+	}
+	// Digest recipients get this in their next digest instead
+	if settings.Digest && n.Digests != nil {
+		return
+	}
+	if err := n.Mailer.Send(settings.Email, notification.Title, notification.Message); err != nil {
+		log.Printf("Warning: notification email to %s failed: %v", notification.Recipient, err)
+	}
+}
+
+func (n *Notifications) postWebhook(notification *NotificationRecord) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ErrDigestsUnavailable is returned when asking for digests on a deployment
+// that doesn't send them
+var ErrDigestsUnavailable = errors.New("digests are not enabled on this server")
+
+// UpdateSettings sets where a recipient's notifications are emailed ("" stops
+// email delivery) and whether they come as a digest
+func (n *Notifications) UpdateSettings(recipient, email string, digest bool) error {
+	if digest && n.Digests == nil {
+		return ErrDigestsUnavailable
+	}
+	email = strings.TrimSpace(email)
+	if email != "" {
+		address, err := mail.ParseAddress(email)
+		if err != nil {
+			return fmt.Errorf("invalid email address: %w", err)
+		}
+		email = address.Address
+	}
+	return n.ds.SetNotificationSettings(&NotificationSettings{Recipient: recipient, Email: email, Digest: digest})
+}
+
+// Settings returns a recipient's delivery settings; recipients who never
+// set any get empty ones
+func (n *Notifications) Settings(recipient string) (*NotificationSettings, error) {
+	settings, err := n.ds.GetNotificationSettings(recipient)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &NotificationSettings{Recipient: recipient}, nil
+	}
+	return settings, err
+}
+
+// notificationRecipient is who asked for the work in ctx, if anyone
+func notificationRecipient(ctx context.Context) string {
+	if access := CollectionAccessFromContext(ctx); access != nil {
+		return access.MemberID
+	}
+	return ""
+}
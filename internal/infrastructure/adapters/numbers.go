@@ -0,0 +1,109 @@
+package adapters
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// digitFolder maps Persian and Arabic-Indic digits and separators to ASCII
+var digitFolder = strings.NewReplacer(
+	"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4",
+	"۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+	"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4",
+	"٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+	"٬", ",", "٫", ".",
+)
+
+// NormalizeDigits converts Persian/Arabic digits and separators to ASCII
+func NormalizeDigits(s string) string {
+	return digitFolder.Replace(s)
+}
+
+var (
+	// numberPattern matches integers and decimals with optional thousands
+	// separators, e.g. 1,250,000 or 3.75
+	numberPattern = regexp.MustCompile(`\d+(?:[,']\d{3})*(?:\.\d+)?`)
+	// listMarkerPattern matches "1." or "2)" list numbering at line start
+	listMarkerPattern = regexp.MustCompile(`(?m)^\s*\d+[.)]\s`)
+)
+
+// numericQuestionHints mark questions that expect a number as the answer
+var numericQuestionHints = []string{
+	"how many", "how much", "how long", "how old", "how far", "what percentage",
+	"what percent", "what is the number", "what is the total", "what is the amount",
+	"what was the total", "what was the amount", "what is the rate", "what was the rate",
+	"چند", "چقدر", "چه مقدار", "چه تعداد", "تعداد", "درصد", "مبلغ", "میزان",
+}
+
+// NumericCheck reports whether numbers in an answer appear in its context
+type NumericCheck struct {
+	Verified bool     `json:"verified"`
+	Numbers  []string `json:"numbers"`
+	Missing  []string `json:"missing,omitempty"`
+}
+
+// isNumericQuestion reports whether the question asks for a number
+func isNumericQuestion(question string) bool {
+	q := strings.ToLower(question)
+	for _, hint := range numericQuestionHints {
+		if strings.Contains(q, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractNumbers returns the canonical form of every number in text, so
+// "1,000", "۱٬۰۰۰" and "1000" compare equal
+func extractNumbers(text string) []string {
+	var numbers []string
+	for _, match := range numberPattern.FindAllString(NormalizeDigits(text), -1) {
+		numbers = append(numbers, canonicalNumber(match))
+	}
+	return numbers
+}
+
+func canonicalNumber(s string) string {
+	s = strings.NewReplacer(",", "", "'", "").Replace(s)
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// verifyNumbers checks that each number in the answer literally appears in
+// the context. Numbers already in the question and list numbering are
+// ignored. It returns nil when the answer has nothing to verify.
+func verifyNumbers(question, answer, context string) *NumericCheck {
+	answer = listMarkerPattern.ReplaceAllString(NormalizeDigits(answer), "")
+
+	ignored := make(map[string]bool)
+	for _, n := range extractNumbers(question) {
+		ignored[n] = true
+	}
+	available := make(map[string]bool)
+	for _, n := range extractNumbers(context) {
+		available[n] = true
+	}
+
+	check := &NumericCheck{Verified: true, Numbers: []string{}}
+	seen := make(map[string]bool)
+	for _, n := range extractNumbers(answer) {
+		if ignored[n] || seen[n] {
+			continue
+		}
+		seen[n] = true
+		check.Numbers = append(check.Numbers, n)
+		if !available[n] {
+			check.Missing = append(check.Missing, n)
+			check.Verified = false
+		}
+	}
+
+	if len(check.Numbers) == 0 {
+		return nil
+	}
+	return check
+}
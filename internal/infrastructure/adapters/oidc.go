@@ -0,0 +1,503 @@
+package adapters
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// oidcLoginTTL is how long a user has to complete a login at the provider
+const oidcLoginTTL = 10 * time.Minute
+
+// maxPendingLogins caps the logins waiting for a callback, so a flood of
+// login starts can't grow memory without bound; past it the oldest is
+// dropped and its user has to start again
+const maxPendingLogins = 10000
+
+// ErrOIDCState is returned for callbacks without a matching pending login
+var ErrOIDCState = errors.New("login state is unknown or expired")
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcLogin is a login waiting for the provider's callback
+type oidcLogin struct {
+	verifier string
+	nonce    string
+	redirect string
+	expires  time.Time
+}
+
+// OIDCProvider signs users in with an OpenID Connect provider (Keycloak,
+// Auth0, Google, ...) using the authorization code flow with PKCE, and maps
+// the provider's groups to service roles
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim is the ID token claim holding groups; dots reach into
+	// nested objects, e.g. "realm_access.roles" for Keycloak realm roles
+	GroupsClaim string
+	// RoleMapping maps provider groups to service roles
+	RoleMapping map[string]string
+	// DefaultRole is given to every user who signs in; empty gives none
+	DefaultRole string
+
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+
+	pendingMu sync.Mutex
+	pending   map[string]*oidcLogin // by state
+	// pendingOrder lists states in the order their logins started, which
+	// is also the order they expire in
+	pendingOrder []string
+}
+
+// NewOIDCProvider configures SSO from OIDC_* settings; it returns nil when
+// OIDC_ISSUER is unset
+func NewOIDCProvider(cfg *config.Config) *OIDCProvider {
+	if cfg.OIDCIssuer == "" {
+		return nil
+	}
+	if cfg.OIDCClientID == "" || cfg.OIDCRedirectURL == "" {
+		log.Println("Warning: OIDC_ISSUER is set without OIDC_CLIENT_ID and OIDC_REDIRECT_URL, SSO stays off")
+		return nil
+	}
+
+	p := &OIDCProvider{
+		Issuer:       strings.TrimRight(cfg.OIDCIssuer, "/"),
+		ClientID:     cfg.OIDCClientID,
+		ClientSecret: cfg.OIDCClientSecret,
+		RedirectURL:  cfg.OIDCRedirectURL,
+		Scopes:       strings.Fields(cfg.OIDCScopes),
+		GroupsClaim:  cfg.OIDCGroupsClaim,
+		RoleMapping:  make(map[string]string),
+		DefaultRole:  cfg.OIDCDefaultRole,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		pending:      make(map[string]*oidcLogin),
+	}
+
+	// OIDC_ROLE_MAPPING is "group=role,group=role"
+	for _, entry := range strings.Split(cfg.OIDCRoleMapping, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(entry, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || (role != RoleAdmin && role != RoleUser) {
+			log.Printf("Warning: ignoring OIDC role mapping %q; expected group=%s or group=%s", entry, RoleAdmin, RoleUser)
+			continue
+		}
+		p.RoleMapping[group] = role
+	}
+
+	log.Printf("✅ SSO enabled with OIDC issuer %s", p.Issuer)
+	return p
+}
+
+// discover fetches the provider configuration once
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document is incomplete")
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// LoginURL starts a login and returns the provider URL to send the user to.
+// redirect is where the callback sends the user afterwards; only paths on
+// this service are allowed.
+func (p *OIDCProvider) LoginURL(ctx context.Context, redirect string) (string, error) {
+	if redirect != "" && !localRedirect(redirect) {
+		return "", fmt.Errorf("redirect must be a path on this service")
+	}
+
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomURLToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomURLToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomURLToken()
+	if err != nil {
+		return "", err
+	}
+
+	p.addPending(state, &oidcLogin{verifier: verifier, nonce: nonce, redirect: redirect, expires: time.Now().Add(oidcLoginTTL)})
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// localRedirect reports whether redirect is a path on this service.
+// Browsers read a backslash as a slash, so "/\evil.example" would leave the
+// service like "//evil.example"; backslashes and control characters are
+// refused outright, escaped or not.
+func localRedirect(redirect string) bool {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+		return false
+	}
+	parsed, err := url.Parse(redirect)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.User != nil {
+		return false
+	}
+	for _, s := range []string{redirect, parsed.Path} {
+		if strings.HasPrefix(s, "//") || strings.ContainsRune(s, '\\') {
+			return false
+		}
+		for _, r := range s {
+			if unicode.IsControl(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// addPending records a login waiting for its callback, first dropping
+// expired and completed ones, and the oldest past maxPendingLogins
+func (p *OIDCProvider) addPending(state string, login *oidcLogin) {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+
+	now := time.Now()
+	drop := 0
+	for drop < len(p.pendingOrder) {
+		oldest, ok := p.pending[p.pendingOrder[drop]]
+		if ok && now.Before(oldest.expires) && len(p.pendingOrder)-drop < maxPendingLogins {
+			break
+		}
+		delete(p.pending, p.pendingOrder[drop])
+		drop++
+	}
+	p.pendingOrder = append(p.pendingOrder[drop:], state)
+	p.pending[state] = login
+}
+
+// takePending removes and returns the login waiting with state, or nil
+func (p *OIDCProvider) takePending(state string) *oidcLogin {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+
+	login := p.pending[state]
+	delete(p.pending, state)
+	return login
+}
+
+// Exchange completes a login from the provider's callback, returning the
+// signed-in user and where to send them
+func (p *OIDCProvider) Exchange(ctx context.Context, code, state string) (*UserClaims, string, error) {
+	login := p.takePending(state)
+	if login == nil || time.Now().After(login.expires) {
+		return nil, "", ErrOIDCState
+	}
+
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {login.verifier},
+	}
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, TruncateRunes(string(body), 300))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil || tokens.IDToken == "" {
+		return nil, "", fmt.Errorf("token response has no id_token")
+	}
+
+	claims, err := p.verifyIDToken(ctx, discovery, tokens.IDToken, login.nonce)
+	if err != nil {
+		return nil, "", err
+	}
+
+	user := &UserClaims{Roles: p.roles(claims)}
+	user.Subject, _ = claims["sub"].(string)
+	user.Email, _ = claims["email"].(string)
+	user.Name, _ = claims["name"].(string)
+	if user.Subject == "" {
+		return nil, "", fmt.Errorf("ID token has no subject")
+	}
+	return user, login.redirect, nil
+}
+
+// roles maps the groups in the ID token to service roles
+func (p *OIDCProvider) roles(claims map[string]interface{}) []string {
+	set := make(map[string]bool)
+	if p.DefaultRole != "" {
+		set[p.DefaultRole] = true
+	}
+
+	var value interface{} = claims
+	for _, key := range strings.Split(p.GroupsClaim, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			value = nil
+			break
+		}
+		value = object[key]
+	}
+
+	var groups []string
+	switch v := value.(type) {
+	case string:
+		groups = []string{v}
+	case []interface{}:
+		for _, group := range v {
+			if s, ok := group.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+	for _, group := range groups {
+		if role, ok := p.RoleMapping[group]; ok {
+			set[role] = true
+		}
+	}
+
+	roles := make([]string, 0, len(set))
+	for role := range set {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// verifyIDToken checks an RS256 ID token's signature against the provider's
+// keys and its issuer, audience, expiry and nonce
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, discovery *oidcDiscovery, token, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("ID token is malformed")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("ID token header is malformed")
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("ID token algorithm %q is not supported", header.Alg)
+	}
+
+	key, err := p.signingKey(ctx, discovery, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("ID token signature is malformed")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("ID token signature is invalid")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("ID token claims are malformed")
+	}
+
+	issuer, _ := claims["iss"].(string)
+	if issuer != discovery.Issuer && strings.TrimRight(issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("ID token issuer %q is not trusted", issuer)
+	}
+	if !audienceContains(claims["aud"], p.ClientID) {
+		return nil, fmt.Errorf("ID token is not meant for this client")
+	}
+	// Allow a minute of clock skew
+	expires, _ := claims["exp"].(float64)
+	if time.Now().Add(-time.Minute).Unix() >= int64(expires) {
+		return nil, fmt.Errorf("ID token has expired")
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, fmt.Errorf("ID token nonce does not match")
+	}
+
+	return claims, nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// signingKey returns the provider key with kid, refetching the key set at
+// most once a minute when the key is unknown, e.g. after a key rotation
+func (p *OIDCProvider) signingKey(ctx context.Context, discovery *oidcDiscovery, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < time.Minute {
+		return nil, fmt.Errorf("ID token key %q is unknown", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC keys: %w", err)
+	}
+	p.keysFetched = time.Now()
+
+	p.keys = make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("ID token key %q is unknown", kid)
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func randomURLToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,32 @@
+package adapters
+
+import "testing"
+
+func TestLocalRedirect(t *testing.T) {
+	tests := []struct {
+		redirect string
+		want     bool
+	}{
+		{"/", true},
+		{"/library", true},
+		{"/sessions/abc?tab=sources#top", true},
+		{"/docs/a%20b", true},
+		{"//host", false},
+		{"/\\host", false},
+		{"/%5Chost", false},
+		{"/%5chost", false},
+		{"\\\\host", false},
+		{"/%2F/host", false},
+		{"https://host/", false},
+		{"host", false},
+		{"", false},
+		{"/\thost", false},
+		{"/%09/host", false},
+		{"/path\r\nLocation: https://host", false},
+	}
+	for _, tt := range tests {
+		if got := localRedirect(tt.redirect); got != tt.want {
+			t.Errorf("localRedirect(%q) = %v, want %v", tt.redirect, got, tt.want)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"rag-service/internal/infrastructure/config"
@@ -18,12 +19,16 @@ type OllamaAdapter struct {
 	Client  *http.Client
 	Config  *config.Config
 	BaseURL string
+
+	modelMu sync.Mutex
+	model   ModelReadiness
 }
 
 type OllamaRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"`
+	Model     string `json:"model"`
+	Prompt    string `json:"prompt"`
+	Stream    bool   `json:"stream"`
+	KeepAlive string `json:"keep_alive,omitempty"`
 }
 
 type OllamaResponse struct {
@@ -81,10 +86,15 @@ func NewOllamaAdapter(cfg *config.Config) (*OllamaAdapter, error) {
 }
 
 func (o *OllamaAdapter) GenerateText(ctx context.Context, prompt string) (string, error) {
+	if err := o.checkModel(ctx); err != nil {
+		return "", err
+	}
+
 	request := OllamaRequest{
-		Model:  o.Config.OllamaModel,
-		Prompt: prompt,
-		Stream: false,
+		Model:     o.Config.OllamaModel,
+		Prompt:    prompt,
+		Stream:    false,
+		KeepAlive: o.Config.OllamaKeepAlive,
 	}
 
 	jsonData, err := json.Marshal(request)
@@ -115,9 +125,35 @@ func (o *OllamaAdapter) GenerateText(ctx context.Context, prompt string) (string
 		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	recordGeneration(ctx, response.stats())
+
 	return response.Response, nil
 }
 
+// stats converts Ollama's nanosecond timings into GenerationStats
+func (r *OllamaResponse) stats() GenerationStats {
+	toMs := func(ns int64) float64 { return float64(ns) / float64(time.Millisecond) }
+	rate := func(count int, ns int64) float64 {
+		if ns <= 0 {
+			return 0
+		}
+		return float64(count) / (float64(ns) / float64(time.Second))
+	}
+
+	return GenerationStats{
+		Provider:           "ollama",
+		Model:              r.Model,
+		TotalMs:            toMs(r.TotalDuration),
+		LoadMs:             toMs(r.LoadDuration),
+		PromptEvalCount:    r.PromptEvalCount,
+		PromptEvalMs:       toMs(r.PromptEvalDuration),
+		PromptTokensPerSec: rate(r.PromptEvalCount, r.PromptEvalDuration),
+		EvalCount:          r.EvalCount,
+		EvalMs:             toMs(r.EvalDuration),
+		TokensPerSec:       rate(r.EvalCount, r.EvalDuration),
+	}
+}
+
 func (o *OllamaAdapter) HealthCheck(ctx context.Context) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", o.BaseURL+"/api/tags", nil)
 	if err != nil {
@@ -137,6 +173,104 @@ func (o *OllamaAdapter) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
+// ListModels returns the names of the models pulled into Ollama
+func (o *OllamaAdapter) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", o.BaseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing models returned status %d", resp.StatusCode)
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode models: %w", err)
+	}
+
+	names := make([]string, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		names = append(names, model.Name)
+	}
+	return names, nil
+}
+
+// StartKeepAlive periodically pings Ollama with an empty prompt so the
+// configured model stays loaded between requests instead of paying a
+// multi-second cold start on the first query after an idle period.
+func (o *OllamaAdapter) StartKeepAlive(ctx context.Context) {
+	interval := o.Config.OllamaKeepAliveInterval
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		o.warmModel(ctx)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				o.warmModel(ctx)
+			}
+		}
+	}()
+
+	log.Printf("✅ Ollama keep-alive started for %s (every %s, keep_alive=%s)", o.Config.OllamaModel, interval, o.Config.OllamaKeepAlive)
+}
+
+// warmModel loads the model without generating anything; Ollama treats an
+// empty prompt as a load request.
+func (o *OllamaAdapter) warmModel(ctx context.Context) {
+	request := OllamaRequest{
+		Model:     o.Config.OllamaModel,
+		Stream:    false,
+		KeepAlive: o.Config.OllamaKeepAlive,
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		log.Printf("Warning: failed to marshal keep-alive request: %v", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.BaseURL+"/api/generate", bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Printf("Warning: failed to create keep-alive request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Warning: Ollama keep-alive ping failed: %v", err)
+		}
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Warning: Ollama keep-alive returned status %d", resp.StatusCode)
+	}
+}
+
 func (o *OllamaAdapter) Close() error {
 	// HTTP client doesn't need explicit closing
 	return nil
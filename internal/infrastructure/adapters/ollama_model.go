@@ -0,0 +1,207 @@
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// States of the configured Ollama model
+const (
+	ModelChecking    = "checking"
+	ModelReady       = "ready"
+	ModelMissing     = "missing"
+	ModelPulling     = "pulling"
+	ModelUnreachable = "unreachable"
+)
+
+// ErrModelNotPulled is returned for generations while Ollama lacks the
+// configured model
+var ErrModelNotPulled = errors.New("model not pulled")
+
+// ModelReadiness reports whether Ollama can serve the configured model
+type ModelReadiness struct {
+	Model   string `json:"model"`
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+	// Progress is the share of the model downloaded while pulling
+	Progress float64 `json:"progress,omitempty"`
+}
+
+// modelPulled reports whether Ollama's model list has model; untagged
+// models are listed as "name:latest"
+func modelPulled(models []string, model string) bool {
+	for _, name := range models {
+		if name == model || name == model+":latest" {
+			return true
+		}
+	}
+	return false
+}
+
+// StartModelCheck checks in the background that Ollama has the configured
+// model, pulling it when OLLAMA_AUTO_PULL is on
+func (o *OllamaAdapter) StartModelCheck(ctx context.Context) {
+	o.setReadiness(ModelReadiness{Model: o.Config.OllamaModel, State: ModelChecking})
+	go func() {
+		if o.refreshReadiness(ctx).State != ModelMissing {
+			return
+		}
+		if !o.Config.OllamaAutoPull {
+			log.Printf("Warning: Ollama model %q not found, run: ollama pull %s", o.Config.OllamaModel, o.Config.OllamaModel)
+			return
+		}
+		if err := o.PullModel(ctx); err != nil {
+			log.Printf("Warning: failed to pull Ollama model %q: %v", o.Config.OllamaModel, err)
+			o.setReadiness(ModelReadiness{
+				Model:   o.Config.OllamaModel,
+				State:   ModelMissing,
+				Message: fmt.Sprintf("pulling model %q failed: %v", o.Config.OllamaModel, err),
+			})
+			return
+		}
+		o.refreshReadiness(ctx)
+	}()
+}
+
+// Readiness returns the model's state. A missing or unreachable model is
+// checked again, so pulling it by hand is noticed.
+func (o *OllamaAdapter) Readiness(ctx context.Context) ModelReadiness {
+	readiness := o.readiness()
+	if readiness.State == ModelMissing || readiness.State == ModelUnreachable {
+		return o.refreshReadiness(ctx)
+	}
+	return readiness
+}
+
+func (o *OllamaAdapter) readiness() ModelReadiness {
+	o.modelMu.Lock()
+	defer o.modelMu.Unlock()
+	return o.model
+}
+
+func (o *OllamaAdapter) setReadiness(readiness ModelReadiness) {
+	o.modelMu.Lock()
+	defer o.modelMu.Unlock()
+	o.model = readiness
+}
+
+// refreshReadiness lists Ollama's models to see whether the configured one
+// is there. A pull in progress keeps its state.
+func (o *OllamaAdapter) refreshReadiness(ctx context.Context) ModelReadiness {
+	model := o.Config.OllamaModel
+	readiness := ModelReadiness{Model: model, State: ModelReady}
+	models, err := o.ListModels(ctx)
+	switch {
+	case err != nil:
+		readiness.State = ModelUnreachable
+		readiness.Message = fmt.Sprintf("Ollama is unreachable: %v", err)
+	case !modelPulled(models, model):
+		readiness.State = ModelMissing
+		readiness.Message = fmt.Sprintf("model %q not found, run: ollama pull %s", model, model)
+	}
+
+	o.modelMu.Lock()
+	defer o.modelMu.Unlock()
+	if o.model.State == ModelPulling && readiness.State != ModelReady {
+		return o.model
+	}
+	o.model = readiness
+	return readiness
+}
+
+// checkModel fails fast while Ollama is known to lack the model, instead of
+// waiting for Ollama's 404. A missing model is checked again first.
+func (o *OllamaAdapter) checkModel(ctx context.Context) error {
+	readiness := o.readiness()
+	if readiness.State == ModelMissing {
+		readiness = o.refreshReadiness(ctx)
+	}
+	switch readiness.State {
+	case ModelMissing:
+		return fmt.Errorf("%w: %s", ErrModelNotPulled, readiness.Message)
+	case ModelPulling:
+		return fmt.Errorf("%w: model %q is still being pulled (%.0f%%)", ErrModelNotPulled, readiness.Model, readiness.Progress*100)
+	}
+	return nil
+}
+
+// pullProgress is a line of Ollama's streamed /api/pull response
+type pullProgress struct {
+	Status    string `json:"status"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+// PullModel pulls the configured model into Ollama, logging its progress
+// every tenth of each layer downloaded
+func (o *OllamaAdapter) PullModel(ctx context.Context) error {
+	model := o.Config.OllamaModel
+	o.setReadiness(ModelReadiness{Model: model, State: ModelPulling, Message: fmt.Sprintf("pulling model %q", model)})
+	log.Printf("Pulling Ollama model %s...", model)
+
+	body, err := json.Marshal(map[string]interface{}{"model": model, "stream": true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pull request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", o.BaseURL+"/api/pull", bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create pull request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Pulls run far longer than the generation client's timeout allows
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send pull request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Ollama returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	lastStatus, lastTenth := "", int64(-1)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var progress pullProgress
+		if err := json.Unmarshal(scanner.Bytes(), &progress); err != nil {
+			continue
+		}
+		if progress.Error != "" {
+			return errors.New(progress.Error)
+		}
+		if progress.Status == "success" {
+			log.Printf("✅ Pulled Ollama model %s", model)
+			return nil
+		}
+
+		if progress.Status != lastStatus {
+			lastStatus, lastTenth = progress.Status, -1
+			if progress.Total == 0 {
+				log.Printf("Pulling %s: %s", model, progress.Status)
+			}
+		}
+		if progress.Total > 0 {
+			share := float64(progress.Completed) / float64(progress.Total)
+			o.setReadiness(ModelReadiness{Model: model, State: ModelPulling, Message: progress.Status, Progress: share})
+			if tenth := progress.Completed * 10 / progress.Total; tenth > lastTenth {
+				lastTenth = tenth
+				log.Printf("Pulling %s: %s %d%% (%d/%d MB)", model, progress.Status, tenth*10, progress.Completed>>20, progress.Total>>20)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("pull interrupted: %w", err)
+	}
+	return errors.New("pull ended without success")
+}
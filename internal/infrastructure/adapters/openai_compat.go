@@ -0,0 +1,203 @@
+package adapters
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChatCompletionRequest is the subset of the OpenAI chat completions request
+// the compatible endpoint understands; sampling parameters are ignored
+type ChatCompletionRequest struct {
+	Model    string                  `json:"model"`
+	Messages []ChatCompletionMessage `json:"messages"`
+	Stream   bool                    `json:"stream"`
+}
+
+// ChatCompletionMessage is one chat turn. Content may arrive as a string or
+// as an array of parts; only text parts are kept.
+type ChatCompletionMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+func (m *ChatCompletionMessage) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	m.Role = raw.Role
+	m.Content = ""
+
+	if len(raw.Content) == 0 || string(raw.Content) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw.Content, &m.Content); err == nil {
+		return nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw.Content, &parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	m.Content = strings.Join(texts, "\n")
+	return nil
+}
+
+// Question returns the latest user message, which the RAG pipeline answers.
+// Earlier turns and system prompts are not used for retrieval.
+func (r *ChatCompletionRequest) Question() string {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role == "user" {
+			return strings.TrimSpace(r.Messages[i].Content)
+		}
+	}
+	return ""
+}
+
+// ChatCompletion is a non-streaming chat completion response. Sources is an
+// extension OpenAI clients ignore; the same citations are appended to the
+// message content so chat frontends show them.
+type ChatCompletion struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   ChatCompletionUsage    `json:"usage"`
+	Sources []string               `json:"sources"`
+	Timings *Timings               `json:"timings,omitempty"`
+}
+
+type ChatCompletionChoice struct {
+	Index        int                    `json:"index"`
+	Message      *ChatCompletionMessage `json:"message,omitempty"`
+	Delta        *ChatCompletionMessage `json:"delta,omitempty"`
+	FinishReason *string                `json:"finish_reason"`
+}
+
+// ChatCompletionUsage counts words rather than model tokens, since the
+// pipeline makes several LLM calls per answer
+type ChatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// NewChatCompletion wraps a RAG response in the OpenAI response shape
+func NewChatCompletion(model, question string, response *SimpleRAGResponse) *ChatCompletion {
+	content := chatCompletionContent(response)
+	stop := "stop"
+	usage := ChatCompletionUsage{
+		PromptTokens:     len(strings.Fields(question)),
+		CompletionTokens: len(strings.Fields(content)),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	sources := response.Sources
+	if sources == nil {
+		sources = []string{}
+	}
+
+	return &ChatCompletion{
+		ID:      fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano()),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []ChatCompletionChoice{{
+			Message:      &ChatCompletionMessage{Role: "assistant", Content: content},
+			FinishReason: &stop,
+		}},
+		Usage:   usage,
+		Sources: sources,
+		Timings: response.Timings,
+	}
+}
+
+func chatCompletionContent(response *SimpleRAGResponse) string {
+	if len(response.Sources) == 0 {
+		return response.Answer
+	}
+	return response.Answer + "\n\nSources: " + strings.Join(response.Sources, ", ")
+}
+
+// WriteStream sends the completion as server-sent chat.completion.chunk
+// events ending with [DONE]. The LLM clients return whole answers, so the
+// content is streamed in word-sized deltas once it is ready.
+func (c *ChatCompletion) WriteStream(w *bufio.Writer) error {
+	content := ""
+	if len(c.Choices) > 0 && c.Choices[0].Message != nil {
+		content = c.Choices[0].Message.Content
+	}
+
+	send := func(choice ChatCompletionChoice) error {
+		chunk := struct {
+			ID      string                 `json:"id"`
+			Object  string                 `json:"object"`
+			Created int64                  `json:"created"`
+			Model   string                 `json:"model"`
+			Choices []ChatCompletionChoice `json:"choices"`
+		}{c.ID, "chat.completion.chunk", c.Created, c.Model, []ChatCompletionChoice{choice}}
+
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	if err := send(ChatCompletionChoice{Delta: &ChatCompletionMessage{Role: "assistant"}}); err != nil {
+		return err
+	}
+	for _, piece := range splitKeepingSpace(content) {
+		if err := send(ChatCompletionChoice{Delta: &ChatCompletionMessage{Content: piece}}); err != nil {
+			return err
+		}
+	}
+	stop := "stop"
+	if err := send(ChatCompletionChoice{Delta: &ChatCompletionMessage{}, FinishReason: &stop}); err != nil {
+		return err
+	}
+
+	if _, err := w.WriteString("data: [DONE]\n\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// splitKeepingSpace splits text into words, each keeping the whitespace that
+// follows it, so the pieces join back to the original text
+func splitKeepingSpace(text string) []string {
+	var pieces []string
+	start := 0
+	inSpace := false
+	for i, r := range text {
+		isSpace := r == ' ' || r == '\n' || r == '\t' || r == '\r'
+		if inSpace && !isSpace {
+			pieces = append(pieces, text[start:i])
+			start = i
+		}
+		inSpace = isSpace
+	}
+	if start < len(text) {
+		pieces = append(pieces, text[start:])
+	}
+	return pieces
+}
@@ -0,0 +1,88 @@
+package adapters
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PageAnchor is a cited page of a document and roughly where on it the
+// cited text starts, so a viewer can open the PDF right there
+type PageAnchor struct {
+	Page int `json:"page"`
+	// Offset counts the characters of the page's text before the first
+	// cited chunk; chunks indexed before offsets were recorded have none
+	Offset *int `json:"offset,omitempty"`
+	// URL downloads the original PDF opened at the page; signed, like
+	// Source.DownloadURL, when served
+	URL string `json:"url,omitempty"`
+}
+
+// anchorChunks records where each text chunk starts in its page's text.
+// Chunks follow each other through the page, overlapping, so each is
+// looked for from where the previous one started.
+func anchorChunks(chunks []PDFChunk, pageText string) {
+	from := 0
+	for i := range chunks {
+		if chunks[i].Type != ChunkTypeText {
+			continue
+		}
+		index := strings.Index(pageText[from:], chunks[i].Text)
+		if index < 0 {
+			continue
+		}
+		from += index
+		offset := utf8.RuneCountInString(pageText[:from])
+		chunks[i].Offset = &offset
+	}
+}
+
+// chunkOffset reads the page offset stored in the chunk metadata
+func chunkOffset(chunk ChunkRecord) *int {
+	var metadata struct {
+		Offset *int `json:"offset"`
+	}
+	if !strings.Contains(chunk.Metadata, "offset") || json.Unmarshal([]byte(chunk.Metadata), &metadata) != nil {
+		return nil
+	}
+	return metadata.Offset
+}
+
+// pageAnchors lists the pages of a document the context chunks come from,
+// each with the offset of its earliest chunk, in page order
+func pageAnchors(documentID string, contextChunks []ScoredChunk) []PageAnchor {
+	byPage := make(map[int]*PageAnchor)
+	for _, scored := range contextChunks {
+		if scored.Chunk.DocumentID != documentID {
+			continue
+		}
+		anchor, ok := byPage[scored.Chunk.PageNumber]
+		if !ok {
+			anchor = &PageAnchor{Page: scored.Chunk.PageNumber}
+			byPage[scored.Chunk.PageNumber] = anchor
+		}
+		if offset := chunkOffset(scored.Chunk); offset != nil && (anchor.Offset == nil || *offset < *anchor.Offset) {
+			anchor.Offset = offset
+		}
+	}
+
+	anchors := make([]PageAnchor, 0, len(byPage))
+	for _, anchor := range byPage {
+		anchors = append(anchors, *anchor)
+	}
+	sort.Slice(anchors, func(i, j int) bool {
+		return anchors[i].Page < anchors[j].Page
+	})
+	return anchors
+}
+
+// pageURL opens a PDF download at page through the #page= fragment PDF
+// viewers understand
+func pageURL(downloadURL string, page int) string {
+	if downloadURL == "" || page <= 0 {
+		return ""
+	}
+	return downloadURL + "#page=" + strconv.Itoa(page)
+}
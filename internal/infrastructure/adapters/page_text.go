@@ -0,0 +1,123 @@
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// PageText is the text extracted from one page of a document
+type PageText struct {
+	Page int    `json:"page"`
+	Text string `json:"text"`
+}
+
+// pageTextObjectName is where a document's extracted text is kept: one
+// PageText JSON line per page, gzipped
+func pageTextObjectName(documentID string) string {
+	return documentID + "/pages.jsonl.gz"
+}
+
+// pageTextWriter compresses pages as they are extracted, so indexing holds
+// the document's text compressed rather than whole
+type pageTextWriter struct {
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+	encoder *json.Encoder
+}
+
+func newPageTextWriter() *pageTextWriter {
+	w := &pageTextWriter{}
+	w.gz = gzip.NewWriter(&w.buf)
+	w.encoder = json.NewEncoder(w.gz)
+	return w
+}
+
+func (w *pageTextWriter) Add(page int, text string) error {
+	return w.encoder.Encode(PageText{Page: page, Text: text})
+}
+
+// Len is the compressed size so far
+func (w *pageTextWriter) Len() int {
+	return w.buf.Len()
+}
+
+// Bytes finishes the stream and returns it
+func (w *pageTextWriter) Bytes() ([]byte, error) {
+	if err := w.gz.Close(); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// storePageText saves a document's extracted text next to its PDF. Indexing
+// doesn't depend on it, so failures are only logged.
+func (r *SimpleRAGService) storePageText(ctx context.Context, documentID string, w *pageTextWriter) {
+	data, err := w.Bytes()
+	if err == nil {
+		err = r.MinIOAdapter.PutObject(ctx, "documents", pageTextObjectName(documentID), data, "application/gzip")
+	}
+	if err != nil {
+		log.Printf("Warning: failed to store extracted text of %s: %v", documentID, err)
+	}
+}
+
+func decodePageText(data []byte) ([]PageText, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	pages := []PageText{}
+	decoder := json.NewDecoder(bufio.NewReader(gz))
+	for decoder.More() {
+		var page PageText
+		if err := decoder.Decode(&page); err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// DocumentText returns a document's extracted text page by page; the caller
+// needs read access to its collection. Documents indexed before the text
+// was kept are extracted again from their PDF once, and the text stored.
+func (r *SimpleRAGService) DocumentText(ctx context.Context, documentID string) ([]PageText, error) {
+	doc, err := r.DatabaseSchema.GetDocument(documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.CheckCollectionAccess(ctx, DocumentCollection(doc.Metadata), PermissionRead); err != nil {
+		return nil, err
+	}
+
+	if data, err := r.MinIOAdapter.GetObject(ctx, "documents", pageTextObjectName(documentID)); err == nil {
+		pages, err := decodePageText(data)
+		if err == nil {
+			return pages, nil
+		}
+		log.Printf("Warning: stored text of %s is unreadable, extracting it again: %v", documentID, err)
+	}
+
+	pdfData, err := r.GetOriginal(ctx, documentID, doc.OriginalFilename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load PDF: %w", err)
+	}
+	w := newPageTextWriter()
+	pages := []PageText{}
+	_, err = r.settingsFor(ctx).pdf.ExtractPages(ctx, pdfData, doc.OriginalFilename, func(page ExtractedPage) error {
+		pages = append(pages, PageText{Page: page.Number, Text: page.Text})
+		return w.Add(page.Number, page.Text)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract text from PDF: %w", err)
+	}
+	r.storePageText(ctx, documentID, w)
+	return pages, nil
+}
@@ -0,0 +1,252 @@
+package adapters
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Page zones text is classified into by its position and font size
+const (
+	ZoneBody     = "body"
+	ZoneHeading  = "heading"
+	ZoneHeader   = "header"
+	ZoneFooter   = "footer"
+	ZoneMargin   = "margin"
+	ZoneFootnote = "footnote"
+)
+
+const (
+	// headerBand and footerBand are the shares of the page height at the top
+	// and bottom holding running headers and footers
+	headerBand = 0.07
+	footerBand = 0.07
+	// marginBand is the share of the page width at each side where lines
+	// that fit entirely are marginal notes or line numbers
+	marginBand = 0.08
+	// footnoteBand is the bottom share of the page where small print counts
+	// as footnotes
+	footnoteBand = 0.3
+	// footnoteScale and headingScale compare a line's font size to the body's
+	footnoteScale   = 0.85
+	headingScale    = 1.2
+	maxHeadingWords = 15
+	// minZoneRows skips pages with too little text to tell furniture apart
+	minZoneRows = 5
+	// minZoneLineRunes ignores lines too short to match reliably, like page
+	// numbers, which cleanText strips anyway
+	minZoneLineRunes = 4
+)
+
+// zoneLine is a line of a page and the zone it lies in; key is its text
+// without whitespace, as chunks are matched against it
+type zoneLine struct {
+	key  string
+	zone string
+}
+
+// pageZoneLines classifies a page's lines into zones from their glyph
+// positions. It returns nil when the page has no MediaBox or little text.
+func pageZoneLines(page pdf.Page) (lines []zoneLine) {
+	// The PDF library panics on some malformed content streams
+	defer func() {
+		if r := recover(); r != nil {
+			lines = nil
+		}
+	}()
+
+	x0, y0, x1, y1, ok := mediaBox(page)
+	if !ok {
+		return nil
+	}
+	width, height := x1-x0, y1-y0
+
+	rows := groupGlyphRows(page.Content().Text)
+	if len(rows) < minZoneRows {
+		return nil
+	}
+	body := bodyFontSize(rows)
+
+	for _, row := range rows {
+		var text strings.Builder
+		size := 0.0
+		for _, glyph := range row {
+			text.WriteString(glyph.S)
+			size += glyph.FontSize
+		}
+		size /= float64(len(row))
+		left := row[0].X
+		right := row[len(row)-1].X + row[len(row)-1].W
+		y := row[0].Y
+
+		zone := ZoneBody
+		switch {
+		case y >= y1-headerBand*height:
+			zone = ZoneHeader
+		case y <= y0+footerBand*height:
+			zone = ZoneFooter
+		case right <= x0+marginBand*width || left >= x1-marginBand*width:
+			zone = ZoneMargin
+		case y <= y0+footnoteBand*height && body > 0 && size <= footnoteScale*body:
+			zone = ZoneFootnote
+		case body > 0 && size >= headingScale*body && len(strings.Fields(text.String())) <= maxHeadingWords:
+			zone = ZoneHeading
+		}
+		lines = append(lines, zoneLine{key: zoneKey(text.String()), zone: zone})
+	}
+	return lines
+}
+
+// mediaBox reads the page's MediaBox, which pages may inherit
+func mediaBox(page pdf.Page) (x0, y0, x1, y1 float64, ok bool) {
+	value := page.V
+	for depth := 0; depth < 10 && !value.IsNull(); depth++ {
+		box := value.Key("MediaBox")
+		if box.Kind() == pdf.Array && box.Len() == 4 {
+			x0, y0, x1, y1 = box.Index(0).Float64(), box.Index(1).Float64(), box.Index(2).Float64(), box.Index(3).Float64()
+			return x0, y0, x1, y1, x1 > x0 && y1 > y0
+		}
+		value = value.Key("Parent")
+	}
+	return 0, 0, 0, 0, false
+}
+
+// bodyFontSize is the font size most of the page's glyphs are set in
+func bodyFontSize(rows [][]pdf.Text) float64 {
+	var sizes []float64
+	for _, row := range rows {
+		for _, glyph := range row {
+			if strings.TrimSpace(glyph.S) != "" {
+				sizes = append(sizes, glyph.FontSize)
+			}
+		}
+	}
+	if len(sizes) == 0 {
+		return 0
+	}
+	sort.Float64s(sizes)
+	return sizes[len(sizes)/2]
+}
+
+// zoneKey lowercases text and drops whitespace, which glyph rows and
+// extracted text don't agree on
+func zoneKey(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, text)
+}
+
+// zoneShares estimates how much of a chunk's text comes from each zone
+// other than the body, by finding the page's non-body lines in it
+func zoneShares(text string, lines []zoneLine) map[string]float64 {
+	chunk := zoneKey(text)
+	total := utf8.RuneCountInString(chunk)
+	if total == 0 {
+		return nil
+	}
+
+	runes := make(map[string]int)
+	matched := 0
+	for _, line := range lines {
+		if line.zone == ZoneBody || utf8.RuneCountInString(line.key) < minZoneLineRunes {
+			continue
+		}
+		if strings.Contains(chunk, line.key) {
+			n := utf8.RuneCountInString(line.key)
+			runes[line.zone] += n
+			matched += n
+		}
+	}
+	if matched == 0 {
+		return nil
+	}
+
+	// Overlapping lines can match more text than the chunk has
+	scale := 1.0
+	if matched > total {
+		scale = float64(total) / float64(matched)
+	}
+	shares := make(map[string]float64, len(runes))
+	for zone, n := range runes {
+		shares[zone] = math.Round(float64(n)*scale/float64(total)*100) / 100
+	}
+	return shares
+}
+
+// annotateZones records the zone shares of a page's text chunks
+func annotateZones(chunks []PDFChunk, lines []zoneLine) {
+	if len(lines) == 0 {
+		return
+	}
+	for i := range chunks {
+		if chunks[i].Type == ChunkTypeText {
+			chunks[i].Zones = zoneShares(chunks[i].Text, lines)
+		}
+	}
+}
+
+// ParseZoneWeights reads PAGE_ZONE_WEIGHTS ("header=0.3,heading=1.2");
+// zones not listed weigh 1
+func ParseZoneWeights(spec string) map[string]float64 {
+	known := map[string]bool{ZoneBody: true, ZoneHeading: true, ZoneHeader: true, ZoneFooter: true, ZoneMargin: true, ZoneFootnote: true}
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		zone, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !known[strings.TrimSpace(zone)] || err != nil || weight < 0 {
+			log.Printf("Warning: ignoring page zone weight %q from PAGE_ZONE_WEIGHTS", pair)
+			continue
+		}
+		weights[strings.TrimSpace(zone)] = weight
+	}
+	return weights
+}
+
+// chunkZones reads the zone shares stored in the chunk metadata
+func chunkZones(chunk ChunkRecord) map[string]float64 {
+	var metadata struct {
+		Zones map[string]float64 `json:"zones"`
+	}
+	if !strings.Contains(chunk.Metadata, "zones") || json.Unmarshal([]byte(chunk.Metadata), &metadata) != nil {
+		return nil
+	}
+	return metadata.Zones
+}
+
+// zoneWeight averages the zone weights over the chunk's text, body text
+// making up whatever the other zones don't
+func (s *serviceSettings) zoneWeight(chunk ChunkRecord) float64 {
+	zones := chunkZones(chunk)
+	if len(zones) == 0 || len(s.zoneWeights) == 0 {
+		return 1
+	}
+
+	weightOf := func(zone string) float64 {
+		if weight, ok := s.zoneWeights[zone]; ok {
+			return weight
+		}
+		return 1
+	}
+	weight, body := 0.0, 1.0
+	for zone, share := range zones {
+		weight += share * weightOf(zone)
+		body -= share
+	}
+	if body > 0 {
+		weight += body * weightOf(ZoneBody)
+	}
+	return weight
+}
@@ -1,48 +1,90 @@
 package adapters
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/ledongthuc/pdf"
 )
 
-type PDFProcessor struct{}
+// defaultMinChunkLength is the shortest text chunk kept, in characters
+const defaultMinChunkLength = 50
+
+type PDFProcessor struct {
+	// Hooks runs pre_chunk hooks on each page's text, if set
+	Hooks *Hooks
+	// MinChunkLength drops shorter text chunks as noise
+	MinChunkLength int
+}
 
 type PDFChunk struct {
 	Text     string
 	Page     int
 	ChunkID  string
 	Document string
+	Type     string // ChunkTypeText or ChunkTypeTable
 	Metadata map[string]interface{}
+	// Zones is the share of the chunk's text from each page zone other than
+	// the body, from the page layout
+	Zones map[string]float64
+	// Offset is where a text chunk starts in its page's text, in
+	// characters; nil when unknown
+	Offset *int
+}
+
+// ExtractedPage is a page's cleaned text, after pre_chunk hooks, and the
+// chunks split from it
+type ExtractedPage struct {
+	Number int
+	Text   string
+	Chunks []PDFChunk
 }
 
 func NewPDFProcessor() *PDFProcessor {
-	return &PDFProcessor{}
+	return &PDFProcessor{MinChunkLength: defaultMinChunkLength}
+}
+
+func (p *PDFProcessor) ExtractTextFromPDF(ctx context.Context, pdfData []byte, filename string) ([]PDFChunk, error) {
+	var chunks []PDFChunk
+	_, err := p.ExtractPages(ctx, pdfData, filename, func(page ExtractedPage) error {
+		chunks = append(chunks, page.Chunks...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunks, nil
 }
 
-func (p *PDFProcessor) ExtractTextFromPDF(pdfData []byte, filename string) ([]PDFChunk, error) {
+// ExtractPages extracts and chunks a PDF one page at a time, passing each
+// page to emit as soon as it is done, so callers can store it instead of
+// holding the whole document's text. It stops at the first error from emit
+// and returns the number of pages with text.
+func (p *PDFProcessor) ExtractPages(ctx context.Context, pdfData []byte, filename string, emit func(ExtractedPage) error) (int, error) {
 	log.Printf("Processing PDF %s", filename)
 	
-	// Create a reader from the PDF data
-	reader := strings.NewReader(string(pdfData))
-	
-	// Open PDF
-	pdfReader, err := pdf.NewReader(reader, int64(len(pdfData)))
+	// Open PDF, reading the data in place rather than from a copy
+	pdfReader, err := pdf.NewReader(bytes.NewReader(pdfData), int64(len(pdfData)))
 	if err != nil {
-		return nil, fmt.Errorf("failed to open PDF: %w", err)
+		return 0, fmt.Errorf("failed to open PDF: %w", err)
 	}
 	
-	var allText []string
-	var chunks []PDFChunk
+	pages := 0
+	chunkCount := 0
 	chunkID := 0
 	
 	// Extract text from each page
 	for pageNum := 1; pageNum <= pdfReader.NumPage(); pageNum++ {
+		if err := ctx.Err(); err != nil {
+			return pages, err
+		}
 		page := pdfReader.Page(pageNum)
 		if page.V.IsNull() {
 			continue
@@ -60,23 +102,44 @@ func (p *PDFProcessor) ExtractTextFromPDF(pdfData []byte, filename string) ([]PD
 		if cleanedText == "" {
 			continue
 		}
+
+		// Let pre_chunk hooks clean or redact the page; empty text drops it
+		if p.Hooks.Has(HookPreChunk) {
+			payload := &HookPayload{Point: HookPreChunk, Document: filename, Page: pageNum, Text: cleanedText}
+			if err := p.Hooks.Run(ctx, payload); err != nil {
+				return pages, err
+			}
+			cleanedText = strings.TrimSpace(payload.Text)
+			if cleanedText == "" {
+				continue
+			}
+		}
 		
-		allText = append(allText, cleanedText)
+		pages++
 		
 		// Split page content into chunks
 		pageChunks := p.splitIntoChunks(cleanedText, pageNum, filename)
+		annotateZones(pageChunks, pageZoneLines(page))
+		anchorChunks(pageChunks, cleanedText)
+		pageChunks = append(pageChunks, p.tableChunks(page, pageNum, filename)...)
 		for i := range pageChunks {
 			pageChunks[i].ChunkID = fmt.Sprintf("%s_p%d_c%d", filename, pageNum, chunkID)
 			chunkID++
 		}
-		chunks = append(chunks, pageChunks...)
+		if err := emit(ExtractedPage{Number: pageNum, Text: cleanedText, Chunks: pageChunks}); err != nil {
+			return pages, err
+		}
+		chunkCount += len(pageChunks)
 	}
 	
-	log.Printf("Extracted %d chunks from PDF %s (%d pages)", len(chunks), filename, len(allText))
-	return chunks, nil
+	log.Printf("Extracted %d chunks from PDF %s (%d pages)", chunkCount, filename, pages)
+	return pages, nil
 }
 
 func (p *PDFProcessor) cleanText(text string) string {
+	// Drop bytes that aren't UTF-8, which MySQL would reject
+	text = strings.ToValidUTF8(text, "")
+
 	// Remove excessive whitespace
 	text = regexp.MustCompile(`\s+`).ReplaceAllString(text, " ")
 	
@@ -95,7 +158,8 @@ func (p *PDFProcessor) cleanText(text string) string {
 		}
 	}
 
-	return strings.TrimSpace(result.String())
+	// Drop binary-looking runs and megabyte-long "words"
+	return sanitizeWords(result.String())
 }
 
 func (p *PDFProcessor) splitIntoChunks(text string, pageNum int, filename string) []PDFChunk {
@@ -110,21 +174,24 @@ func (p *PDFProcessor) splitIntoChunks(text string, pageNum int, filename string
 	}
 
 	var currentChunk strings.Builder
+	currentRunes := 0 // sizes are in characters, not bytes, so Persian chunks aren't halved
 	chunkID := 1
 
 	for i, word := range words {
 		currentChunk.WriteString(word)
 		currentChunk.WriteString(" ")
+		currentRunes += utf8.RuneCountInString(word) + 1
 
 		// Check if we should create a chunk
-		if currentChunk.Len() >= maxChunkSize || i == len(words)-1 {
+		if currentRunes >= maxChunkSize || i == len(words)-1 {
 			chunkText := strings.TrimSpace(currentChunk.String())
-			if len(chunkText) > 50 { // Only create chunks with meaningful content
+			if utf8.RuneCountInString(chunkText) >= p.MinChunkLength { // Only create chunks with meaningful content
 				chunk := PDFChunk{
 					Text:     chunkText,
 					Page:     pageNum,
 					ChunkID:  fmt.Sprintf("%s_p%d_c%d", filename, pageNum, chunkID),
 					Document: filename,
+					Type:     ChunkTypeText,
 					Metadata: map[string]interface{}{
 						"page":       pageNum,
 						"chunk_id":   chunkID,
@@ -143,15 +210,18 @@ func (p *PDFProcessor) splitIntoChunks(text string, pageNum int, filename string
 						overlapStart = 0
 					}
 					if overlapStart < len(overlapWords) {
+						overlap := strings.Join(overlapWords[overlapStart:], " ") + " "
 						currentChunk.Reset()
-						currentChunk.WriteString(strings.Join(overlapWords[overlapStart:], " "))
-						currentChunk.WriteString(" ")
+						currentChunk.WriteString(overlap)
+						currentRunes = utf8.RuneCountInString(overlap)
 					} else {
 						currentChunk.Reset()
+						currentRunes = 0
 					}
 				}
 			} else {
 				currentChunk.Reset()
+				currentRunes = 0
 			}
 		}
 	}
@@ -159,11 +229,11 @@ func (p *PDFProcessor) splitIntoChunks(text string, pageNum int, filename string
 	return chunks
 }
 
-func (p *PDFProcessor) ProcessPDFFromReader(reader io.Reader, filename string) ([]PDFChunk, error) {
+func (p *PDFProcessor) ProcessPDFFromReader(ctx context.Context, reader io.Reader, filename string) ([]PDFChunk, error) {
 	pdfData, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read PDF data: %w", err)
 	}
 
-	return p.ExtractTextFromPDF(pdfData, filename)
+	return p.ExtractTextFromPDF(ctx, pdfData, filename)
 }
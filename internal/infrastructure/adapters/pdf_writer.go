@@ -0,0 +1,147 @@
+package adapters
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PDFLine is a paragraph of text in a generated PDF
+type PDFLine struct {
+	Text string
+	Size float64
+	Bold bool
+}
+
+const (
+	pdfPageWidth  = 612.0
+	pdfPageHeight = 792.0
+	pdfMargin     = 56.0
+)
+
+// RenderTextPDF lays out paragraphs on US Letter pages using the built-in
+// Helvetica fonts. Only Latin-1 text can be shown with those fonts; other
+// characters are replaced with "?", so the Markdown output remains the
+// faithful copy for non-Latin reports.
+func RenderTextPDF(lines []PDFLine) []byte {
+	var pages [][]string
+	var page []string
+	y := pdfPageHeight - pdfMargin
+
+	for _, line := range lines {
+		size := line.Size
+		if size <= 0 {
+			size = 11
+		}
+		leading := size * 1.4
+		font := "F1"
+		if line.Bold {
+			font = "F2"
+		}
+
+		wrapped := wrapPDFText(line.Text, size)
+		if len(wrapped) == 0 {
+			y -= leading / 2
+			continue
+		}
+		for _, text := range wrapped {
+			if y-leading < pdfMargin {
+				pages = append(pages, page)
+				page = nil
+				y = pdfPageHeight - pdfMargin
+			}
+			y -= leading
+			page = append(page, fmt.Sprintf("BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET", font, size, pdfMargin, y, escapePDFString(text)))
+		}
+	}
+	pages = append(pages, page)
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are the catalog, page tree and fonts; pages follow in
+	// pairs of page object and content stream
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range pages {
+		stream := strings.Join(content, "\n")
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+// wrapPDFText breaks text into lines that fit the page width, estimating
+// Helvetica's average glyph width as half the font size
+func wrapPDFText(text string, size float64) []string {
+	maxChars := int((pdfPageWidth - 2*pdfMargin) / (size * 0.5))
+
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		var current []rune
+		for _, word := range strings.Fields(paragraph) {
+			w := []rune(word)
+			if len(current) > 0 && len(current)+1+len(w) > maxChars {
+				lines = append(lines, string(current))
+				current = nil
+			}
+			if len(current) > 0 {
+				current = append(current, ' ')
+			}
+			current = append(current, w...)
+		}
+		if len(current) > 0 {
+			lines = append(lines, string(current))
+		}
+	}
+	return lines
+}
+
+// escapePDFString encodes text as a WinAnsi PDF literal string
+func escapePDFString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case r == '‘' || r == '’':
+			b.WriteByte('\'')
+		case r == '“' || r == '”':
+			b.WriteByte('"')
+		case r == '–' || r == '—':
+			b.WriteByte('-')
+		case r == '…':
+			b.WriteString("...")
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,162 @@
+package adapters
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// NewProviderTransport builds the HTTP transport for an LLM provider's
+// client: keep-alive connections pooled per host, HTTP/2 when the provider
+// offers it and host lookups cached, through dnsServer when set. Connection
+// reuse, lookups and TLS handshakes are counted in DefaultMetrics under
+// provider.
+func NewProviderTransport(cfg *config.Config, provider, dnsServer string) http.RoundTripper {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	resolver := net.DefaultResolver
+	if dnsServer != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, net.JoinHostPort(dnsServer, "53"))
+			},
+		}
+	}
+	dns := &dnsCache{
+		provider: provider,
+		resolver: resolver,
+		ttl:      cfg.ProviderDNSCacheTTL,
+		entries:  make(map[string]dnsEntry),
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dns.dialContext(dialer),
+		ForceAttemptHTTP2:     cfg.ProviderHTTP2,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   cfg.ProviderMaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.ProviderIdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	if !cfg.ProviderHTTP2 {
+		// A non-nil, empty TLSNextProto turns HTTP/2 off
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &tracedTransport{base: transport, provider: provider}
+}
+
+// dnsCache resolves provider hosts, keeping the addresses for ttl so busy
+// clients don't look a host up for every new connection
+type dnsCache struct {
+	provider string
+	resolver *net.Resolver
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+func (d *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	if d.ttl > 0 {
+		d.mu.Lock()
+		entry, ok := d.entries[host]
+		d.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			DefaultMetrics.RecordDNSLookup(d.provider, true)
+			return entry.addrs, nil
+		}
+	}
+
+	DefaultMetrics.RecordDNSLookup(d.provider, false)
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if d.ttl > 0 {
+		d.mu.Lock()
+		d.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(d.ttl)}
+		d.mu.Unlock()
+	}
+	return addrs, nil
+}
+
+// forget drops a host whose cached addresses all failed, so the next dial
+// looks it up again
+func (d *dnsCache) forget(host string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.entries, host)
+}
+
+// dialContext dials the cached addresses of the host in turn
+func (d *dnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		addrs, err := d.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		lastErr := errors.New("no addresses for " + host)
+		for _, addr := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		d.forget(host)
+		return nil, lastErr
+	}
+}
+
+// tracedTransport counts how each request got its connection
+type tracedTransport struct {
+	base     http.RoundTripper
+	provider string
+}
+
+func (t *tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reused bool
+	var handshakeStart time.Time
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused = info.Reused
+		},
+		TLSHandshakeStart: func() {
+			handshakeStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil && !handshakeStart.IsZero() {
+				DefaultMetrics.RecordTLSHandshake(t.provider, time.Since(handshakeStart))
+			}
+		},
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		return nil, err
+	}
+	DefaultMetrics.RecordConnection(t.provider, reused, resp.ProtoMajor == 2)
+	return resp, nil
+}
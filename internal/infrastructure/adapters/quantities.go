@@ -0,0 +1,134 @@
+package adapters
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// quantityMultipliers scale a number by a written magnitude
+var quantityMultipliers = map[string]float64{
+	"thousand": 1e3, "هزار": 1e3,
+	"million": 1e6, "mn": 1e6, "میلیون": 1e6,
+	"billion": 1e9, "bn": 1e9, "میلیارد": 1e9,
+	"trillion": 1e12, "تریلیون": 1e12,
+}
+
+// symbolMultipliers are single-letter magnitudes, only trusted after a
+// currency symbol ("$1.2M") since "5m" is more likely five metres
+var symbolMultipliers = map[string]float64{"k": 1e3, "m": 1e6, "b": 1e9}
+
+// quantityUnits maps unit and currency spellings to a canonical code
+var quantityUnits = map[string]string{
+	"$": "usd", "usd": "usd", "dollar": "usd", "dollars": "usd", "دلار": "usd",
+	"€": "eur", "eur": "eur", "euro": "eur", "euros": "eur", "یورو": "eur",
+	"£": "gbp", "gbp": "gbp", "pound": "gbp", "pounds": "gbp",
+	"rial": "irr", "rials": "irr", "riyal": "irr", "irr": "irr", "ریال": "irr",
+	"toman": "irt", "tomans": "irt", "irt": "irt", "تومان": "irt",
+	"%": "percent", "percent": "percent", "درصد": "percent",
+	"km": "km", "kilometer": "km", "kilometers": "km", "kilometre": "km", "kilometres": "km", "کیلومتر": "km",
+	"meter": "m", "meters": "m", "metre": "m", "metres": "m", "متر": "m",
+	"kg": "kg", "kilogram": "kg", "kilograms": "kg", "کیلوگرم": "kg",
+	"liter": "l", "liters": "l", "litre": "l", "litres": "l", "لیتر": "l",
+	"mb": "mb", "gb": "gb", "tb": "tb",
+}
+
+// quantityPiece splits "$1.2M" or "12%" into symbol, number and suffix
+var quantityPiece = regexp.MustCompile(`^([$€£]?)(\d+(?:[,']\d{3})*(?:\.\d+)?)(.*)$`)
+
+// QuantityTerms finds amounts like "$1.2M", "1,000,000 ریال" or
+// "۱۰ میلیون تومان" and returns canonical tokens ("1200000 usd") so numeric
+// questions match regardless of how the amount was written. Plain numbers
+// without separators, magnitudes or units are already matched as-is.
+func QuantityTerms(text string) []string {
+	pieces := quantityPieces(strings.ToLower(NormalizeDigits(text)))
+
+	var terms []string
+	for i := 0; i < len(pieces); i++ {
+		m := quantityPiece.FindStringSubmatch(pieces[i])
+		if m == nil || m[3] != "" {
+			continue
+		}
+
+		raw := m[2]
+		value, err := strconv.ParseFloat(strings.NewReplacer(",", "", "'", "").Replace(raw), 64)
+		if err != nil {
+			continue
+		}
+
+		symbol := m[1]
+		if symbol == "" && i > 0 && quantityUnits[pieces[i-1]] != "" && strings.ContainsAny(pieces[i-1], "$€£") {
+			symbol = pieces[i-1]
+		}
+		notable := symbol != "" || strings.ContainsAny(raw, ",'.")
+
+		j := i + 1
+		if j < len(pieces) {
+			if multiplier, ok := quantityMultipliers[pieces[j]]; ok {
+				value *= multiplier
+				notable = true
+				j++
+			} else if multiplier, ok := symbolMultipliers[pieces[j]]; ok && symbol != "" {
+				value *= multiplier
+				j++
+			}
+		}
+
+		unit := quantityUnits[symbol]
+		if j < len(pieces) {
+			if u, ok := quantityUnits[pieces[j]]; ok && unit == "" {
+				unit = u
+				j++
+			}
+		}
+		if unit != "" {
+			notable = true
+		}
+
+		if !notable {
+			continue
+		}
+		terms = append(terms, canonicalQuantity(value))
+		if unit != "" {
+			terms = append(terms, unit)
+		}
+		i = j - 1
+	}
+	return terms
+}
+
+// quantityPieces splits text on whitespace and separates currency symbols,
+// numbers and attached suffixes ("$1.2m" -> "$", "1.2", "m")
+func quantityPieces(text string) []string {
+	var pieces []string
+	for _, field := range strings.Fields(text) {
+		field = strings.TrimLeft(field, "([\"'")
+		field = strings.TrimRight(field, ".,;:)]!?\"'")
+		if field == "" {
+			continue
+		}
+		m := quantityPiece.FindStringSubmatch(field)
+		if m == nil {
+			pieces = append(pieces, field)
+			continue
+		}
+		if m[1] != "" {
+			pieces = append(pieces, m[1])
+		}
+		pieces = append(pieces, m[2])
+		if m[3] != "" {
+			pieces = append(pieces, m[3])
+		}
+	}
+	return pieces
+}
+
+// canonicalQuantity writes whole amounts as digits and keeps decimals as a
+// single token ("3.75" -> "3p75") since scoring splits on punctuation
+func canonicalQuantity(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1e18 {
+		return strconv.FormatInt(int64(value), 10)
+	}
+	return strings.Replace(strconv.FormatFloat(value, 'f', -1, 64), ".", "p", 1)
+}
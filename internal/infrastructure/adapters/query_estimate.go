@@ -0,0 +1,131 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// estimatedAnswerTokens is the assumed length of a generated answer; the
+// real length depends on the model and the question
+const estimatedAnswerTokens = 300
+
+// QueryEstimate previews a query without running it: the chunks its context
+// would be built from and the LLM work answering it would take. Token counts
+// are estimates, see EstimateTokens.
+type QueryEstimate struct {
+	Chunks           []RetrievedChunk `json:"chunks"`
+	Provider         string           `json:"provider"`
+	LLMCalls         int              `json:"llm_calls"`
+	PromptTokens     int              `json:"estimated_prompt_tokens"`
+	CompletionTokens int              `json:"estimated_completion_tokens"`
+	Cost             float64          `json:"estimated_cost"`
+	// Refusal is set when the query would be refused before generation
+	Refusal string `json:"refusal,omitempty"`
+	// Notes explain work whose cost depends on what the LLM returns
+	Notes []string `json:"notes,omitempty"`
+}
+
+// EstimateTokens approximates how many tokens text is, at about four
+// characters a token. Providers tokenize differently, so this is only good
+// for comparing queries and rough budgeting.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// addCall counts one LLM call
+func (e *QueryEstimate) addCall(promptTokens, completionTokens int) {
+	e.LLMCalls++
+	e.PromptTokens += promptTokens
+	e.CompletionTokens += completionTokens
+}
+
+// EstimateQuery runs retrieval for question as Query would and estimates
+// the prompts it would send, without calling the LLM or storing the query.
+// Moderation and hooks are not run, as they don't use the LLM.
+func (r *SimpleRAGService) EstimateQuery(ctx context.Context, question string, opts QueryOptions) (*QueryEstimate, error) {
+	if opts.AnswerLanguage != "" {
+		ctx = WithAnswerLanguage(ctx, opts.AnswerLanguage)
+	}
+	questionLanguage, _ := DetectLanguage(question)
+	lang := r.responseLanguage(ctx, questionLanguage)
+	crossLingual := opts.CrossLingual || (r.Config != nil && r.Config.RetrievalCrossLingual)
+	flags := r.Flags.Resolve(opts.Flags)
+	bySource := opts.AnswerMode == AnswerModeBySource && flags[FlagBySourceAnswers]
+
+	estimate := &QueryEstimate{Chunks: []RetrievedChunk{}, Provider: "none"}
+	if r.Config != nil {
+		estimate.Provider = strings.ToLower(r.Config.LLMProvider)
+	}
+
+	if reason := r.settingsFor(ctx).refusals.CheckQuestion(question); reason != "" {
+		estimate.Refusal = reason
+		return estimate, nil
+	}
+
+	// The fallback translates the question with the LLM, so it is counted
+	// below instead of run
+	qc, err := r.retrieveContext(ctx, question, questionLanguage, crossLingual, false)
+	if err != nil {
+		return nil, err
+	}
+	if qc.refusal != "" {
+		estimate.Refusal = qc.refusal
+		return estimate, nil
+	}
+
+	filenames := make(map[string]string, len(qc.documents))
+	for _, doc := range qc.documents {
+		filenames[doc.ID] = doc.OriginalFilename
+	}
+	for _, scored := range qc.chunks {
+		estimate.Chunks = append(estimate.Chunks, RetrievedChunk{
+			ID:       scored.Chunk.ID,
+			Text:     scored.Chunk.ChunkText,
+			Score:    scored.Score,
+			Metadata: retrievedMetadata(scored.Chunk, filenames[scored.Chunk.DocumentID]),
+		})
+	}
+
+	if !r.canGenerate() {
+		estimate.Notes = append(estimate.Notes, "No LLM provider is configured, the answer is the retrieved context")
+		return estimate, nil
+	}
+
+	if flags[FlagCrossLingualFallback] && qc.weakMatch && r.Config != nil && r.Config.CrossLingualMaxLanguages > 0 {
+		for i := 0; i < r.Config.CrossLingualMaxLanguages; i++ {
+			estimate.addCall(EstimateTokens(questionTranslationPrompt(question, lang)), EstimateTokens(question))
+		}
+		estimate.Notes = append(estimate.Notes, fmt.Sprintf(
+			"The match is weak, so the question is translated into up to %d corpus languages and retrieval retried; the chunks shown are from before the retry",
+			r.Config.CrossLingualMaxLanguages))
+	}
+
+	switch {
+	case bySource:
+		estimate.addCall(EstimateTokens(bySourcePrompt(question, lang, groupBySource(qc.chunks, qc.documents))), estimatedAnswerTokens)
+	case flags[FlagTablePrompt] && hasTableChunk(qc.chunks):
+		estimate.addCall(EstimateTokens(tablePrompt(lang, qc.context, question)), estimatedAnswerTokens)
+	default:
+		estimate.addCall(EstimateTokens(r.answerPrompt(lang, qc.context, question)), estimatedAnswerTokens)
+	}
+
+	if opts.TranslateTo != "" && opts.TranslateTo != lang {
+		// The answer isn't known yet, so assume a typical one
+		estimate.addCall(EstimateTokens(translationPrompt("", opts.TranslateTo))+estimatedAnswerTokens, estimatedAnswerTokens)
+		for i, scored := range qc.chunks {
+			if i >= maxTranslatedSnippets {
+				break
+			}
+			snippet := TruncateRunes(scored.Chunk.ChunkText, 300)
+			estimate.addCall(EstimateTokens(translationPrompt(snippet, opts.TranslateTo)), EstimateTokens(snippet))
+		}
+	}
+
+	if r.Config != nil {
+		estimate.Cost = float64(estimate.PromptTokens)/1000*r.Config.LLMPromptCostPer1K +
+			float64(estimate.CompletionTokens)/1000*r.Config.LLMCompletionCostPer1K
+	}
+	return estimate, nil
+}
@@ -0,0 +1,115 @@
+package adapters
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query history export formats
+const (
+	QueryExportCSV   = "csv"
+	QueryExportJSONL = "jsonl"
+)
+
+// queryExportHeader is the CSV header row
+var queryExportHeader = []string{"id", "question", "answer", "confidence", "sources", "corpus_version", "created_at"}
+
+// QueryExportFilter limits the exported query history to a time range;
+// empty bounds are open
+type QueryExportFilter struct {
+	From string
+	To   string
+}
+
+// queryExportRecord is one JSONL line; sources stay raw JSON so datasets
+// can use them as stored
+type queryExportRecord struct {
+	ID            string          `json:"id"`
+	Question      string          `json:"question"`
+	Answer        string          `json:"answer"`
+	Confidence    float64         `json:"confidence"`
+	Sources       json.RawMessage `json:"sources"`
+	CorpusVersion string          `json:"corpus_version,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// ExportQueries writes the query history matching the filter to w, oldest
+// first, as CSV with a header row or as JSON lines. Rows are written as
+// they are read, so the export never holds the whole history.
+func (ds *DatabaseSchema) ExportQueries(w io.Writer, format string, filter QueryExportFilter) error {
+	if format != QueryExportCSV && format != QueryExportJSONL {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	var conditions []string
+	var args []interface{}
+	if filter.From != "" {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, filter.To)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := ds.DB.Query(`SELECT id, question, answer, confidence, COALESCE(sources, JSON_ARRAY()), COALESCE(corpus_version, ''), created_at
+		FROM document_queries`+where+` ORDER BY created_at ASC`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	csvWriter := csv.NewWriter(w)
+	encoder := json.NewEncoder(w)
+	if format == QueryExportCSV {
+		if err := csvWriter.Write(queryExportHeader); err != nil {
+			return err
+		}
+	}
+	for rows.Next() {
+		var q QueryRecord
+		if err := rows.Scan(&q.ID, &q.Question, &q.Answer, &q.Confidence, &q.Sources, &q.CorpusVersion, &q.CreatedAt); err != nil {
+			return err
+		}
+
+		if format == QueryExportCSV {
+			err = csvWriter.Write([]string{
+				q.ID,
+				q.Question,
+				q.Answer,
+				strconv.FormatFloat(q.Confidence, 'f', -1, 64),
+				q.Sources,
+				q.CorpusVersion,
+				formatTimestamp(q.CreatedAt),
+			})
+		} else {
+			err = encoder.Encode(queryExportRecord{
+				ID:            q.ID,
+				Question:      q.Question,
+				Answer:        q.Answer,
+				Confidence:    q.Confidence,
+				Sources:       json.RawMessage(q.Sources),
+				CorpusVersion: q.CorpusVersion,
+				CreatedAt:     q.CreatedAt,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
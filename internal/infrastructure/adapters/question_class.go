@@ -0,0 +1,154 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Question types ClassifyQuestion tells apart
+const (
+	// QuestionCorpus asks about the documents' content and goes through
+	// retrieval
+	QuestionCorpus = "corpus"
+	// QuestionSmallTalk is a greeting, thanks or goodbye, answered directly
+	QuestionSmallTalk = "small_talk"
+	// QuestionMeta asks about the service or its library rather than a
+	// document, answered from the library's figures
+	QuestionMeta = "meta"
+)
+
+// metaDocumentNames caps the recently added documents a meta answer names
+const metaDocumentNames = 5
+
+var (
+	// smallTalkPattern matches questions made only of greetings, thanks and
+	// goodbyes, in English or Persian
+	smallTalkPattern = regexp.MustCompile(`^(?:(?:hi|hello|hey|hiya|yo|greetings|good (?:morning|afternoon|evening|night)|thanks|thank you(?: (?:so|very) much)?|thx|cheers|bye|goodbye|see you|how are you(?: doing)?|what'?s up|ok|okay|cool|great|nice|there|again|all` +
+		`|سلام|درود|ممنون|مرسی|متشکرم|سپاس|سپاسگزارم|خداحافظ|خسته نباشید|صبح بخیر|عصر بخیر|شب بخیر|چطوری|حالت چطوره|خوبی|عالی|باشه)\s*)+$`)
+	// metaPatterns match questions about the service itself or what its
+	// library holds
+	metaPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^(?:how many|which|what) (?:documents|docs|files|pdfs|sources)(?: do you have| are there| have you got| are (?:indexed|uploaded|available|loaded)| can you (?:see|search|access))?$`),
+		regexp.MustCompile(`^(?:list|show)(?: me)?(?: all| the| your)* (?:documents|docs|files|pdfs|sources)$`),
+		regexp.MustCompile(`^(?:what can you do|who are you|what are you|how do you work|help)$`),
+		regexp.MustCompile(`^(?:چند|چه|کدام) ?(?:سند|اسناد|فایل|پرونده)\S*(?: (?:داری|دارید|هست|وجود دارد|بارگذاری شده))?$`),
+		regexp.MustCompile(`^(?:تو )?(?:کی|چی) هستی$`),
+		regexp.MustCompile(`^چه کاری? (?:می\x{200c}? ?توانی|میتونی|می\x{200c}?تونی) (?:بکنی|انجام بدهی|انجام بدی)$`),
+	}
+)
+
+// ClassifyQuestion tells small talk and questions about the service from
+// questions about the documents. Only whole questions matching known
+// phrasings are taken for small talk or meta, so anything else, however
+// short, still goes through retrieval.
+func ClassifyQuestion(question string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(question)), " ")
+	normalized = strings.Trim(normalized, " ?!.,;:؟،")
+	normalized = strings.NewReplacer(",", "", "!", "", "،", "").Replace(normalized)
+	if normalized == "" {
+		return QuestionCorpus
+	}
+	if smallTalkPattern.MatchString(normalized) {
+		return QuestionSmallTalk
+	}
+	for _, pattern := range metaPatterns {
+		if pattern.MatchString(normalized) {
+			return QuestionMeta
+		}
+	}
+	return QuestionCorpus
+}
+
+// smallTalkReply answers small talk without retrieval: through the LLM when
+// there is one, so the reply fits what was said, else with a fixed greeting
+func (r *SimpleRAGService) smallTalkReply(ctx context.Context, question, lang string) *SimpleRAGResponse {
+	answer := smallTalkFallback(lang)
+	if r.canGenerate() {
+		generationStart := time.Now()
+		text, err := r.LLM.GenerateText(ctx, smallTalkPrompt(lang, question))
+		DebugTraceFromContext(ctx).AddStage("generation", time.Since(generationStart))
+		TimingsFromContext(ctx).AddLLM(time.Since(generationStart))
+		if err != nil {
+			log.Printf("Warning: failed to reply to small talk, using the fixed reply: %v", err)
+		} else if text = strings.TrimSpace(text); text != "" {
+			answer = text
+		}
+	}
+
+	response := &SimpleRAGResponse{
+		Answer:       answer,
+		Sources:      []string{},
+		QuestionType: QuestionSmallTalk,
+	}
+	r.storeQuery(ctx, question, response)
+	return response
+}
+
+func smallTalkPrompt(lang, message string) string {
+	if lang == "fa" {
+		return fmt.Sprintf(`تو دستیار پاسخ به پرسش‌ها از روی اسناد کاربر هستی. به پیام زیر کوتاه، دوستانه و به زبان فارسی پاسخ بده و در صورت مناسب بودن یادآوری کن که می‌توانی به پرسش‌ها درباره اسناد پاسخ دهی.
+
+پیام: %s
+
+پاسخ:`, message)
+	}
+	return fmt.Sprintf(`You are an assistant that answers questions from the user's documents. Reply to the message below briefly and warmly, in the message's language, mentioning when it fits that you can answer questions about the documents.
+
+MESSAGE: %s
+
+REPLY:`, message)
+}
+
+func smallTalkFallback(lang string) string {
+	if lang == "fa" {
+		return "سلام! هر پرسشی درباره اسناد دارید بپرسید."
+	}
+	return "Hello! Ask me anything about your documents."
+}
+
+// metaAnswer answers a question about the service from the figures /stats
+// reports, counting only the documents the caller can read
+func (r *SimpleRAGService) metaAnswer(ctx context.Context, question, lang string) (*SimpleRAGResponse, error) {
+	stats, err := r.GetDocumentStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the most recent documents are named
+	recent, err := r.recentReadableDocuments(ctx, 100)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get documents: %w", err)
+	}
+	var names []string
+	for _, doc := range recent {
+		if doc.Status == "completed" && len(names) < metaDocumentNames {
+			names = append(names, doc.OriginalFilename)
+		}
+	}
+
+	var answer string
+	if lang == "fa" {
+		answer = fmt.Sprintf("من به پرسش‌ها از روی اسناد این کتابخانه پاسخ می‌دهم و صفحه‌هایی را که استفاده کرده‌ام ذکر می‌کنم. کتابخانه %d سند دارد که %d مورد آن در %d بخش آماده جستجو است.", stats.TotalDocuments, stats.CompletedDocuments, stats.TotalChunks)
+		if len(names) > 0 {
+			answer += " جدیدترین‌ها: " + strings.Join(names, "، ") + "."
+		}
+	} else {
+		answer = fmt.Sprintf("I answer questions from the documents in this library, citing the pages I used. It holds %d documents, %d of them ready to search in %d passages.", stats.TotalDocuments, stats.CompletedDocuments, stats.TotalChunks)
+		if len(names) > 0 {
+			answer += " Most recent: " + strings.Join(names, ", ") + "."
+		}
+	}
+
+	response := &SimpleRAGResponse{
+		Answer:       answer,
+		Sources:      []string{},
+		Confidence:   1.0,
+		QuestionType: QuestionMeta,
+	}
+	r.storeQuery(ctx, question, response)
+	return response, nil
+}
@@ -0,0 +1,110 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RecoveryResult lists what a stale-document pass did
+type RecoveryResult struct {
+	Requeued []string `json:"requeued"`
+	Failed   []string `json:"failed"`
+}
+
+// IsStale reports whether a document has been processing for longer than
+// StaleProcessingTimeout
+func (r *SimpleRAGService) IsStale(doc DocumentRecord) bool {
+	if doc.Status != "processing" || r.Config.StaleProcessingTimeout <= 0 {
+		return false
+	}
+	if _, ok := r.ingesting.Load(doc.ID); ok {
+		return false
+	}
+	return time.Since(doc.UpdatedAt) > r.Config.StaleProcessingTimeout
+}
+
+// RecoverStaleDocuments re-indexes documents left in processing by a crash,
+// or marks them failed once StaleProcessingRetries attempts are used up.
+// Documents this process is still indexing are skipped.
+func (r *SimpleRAGService) RecoverStaleDocuments(ctx context.Context) (*RecoveryResult, error) {
+	stale, err := r.DatabaseSchema.GetStaleDocuments(r.Config.StaleProcessingTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stale documents: %w", err)
+	}
+
+	result := &RecoveryResult{Requeued: []string{}, Failed: []string{}}
+	for _, doc := range stale {
+		if _, ok := r.ingesting.Load(doc.ID); ok {
+			continue
+		}
+
+		if err := r.recoverDocument(ctx, doc); err != nil {
+			log.Printf("Warning: marking stale document %s (%s) failed: %v", doc.ID, doc.OriginalFilename, err)
+			if err := r.DatabaseSchema.UpdateDocumentStatus(doc.ID, "failed"); err != nil {
+				log.Printf("Warning: failed to update document status: %v", err)
+			}
+			r.recordEvent(doc.ID, DocumentEventFailed, "Reprocessing failed: "+err.Error())
+			result.Failed = append(result.Failed, doc.ID)
+			continue
+		}
+
+		log.Printf("✅ Recovered stale document %s (%s)", doc.ID, doc.OriginalFilename)
+		result.Requeued = append(result.Requeued, doc.ID)
+	}
+
+	return result, nil
+}
+
+// recoverDocument indexes a stale document again from its stored PDF
+func (r *SimpleRAGService) recoverDocument(ctx context.Context, doc StaleDocument) error {
+	if doc.RecoveryAttempts >= r.Config.StaleProcessingRetries {
+		return fmt.Errorf("gave up after %d recovery attempts", doc.RecoveryAttempts)
+	}
+
+	pdfData, err := r.MinIOAdapter.GetObject(ctx, "documents", doc.Filename)
+	if err != nil {
+		return fmt.Errorf("failed to read stored PDF: %w", err)
+	}
+
+	if err := r.DatabaseSchema.StartDocumentRecovery(doc.ID); err != nil {
+		return err
+	}
+	r.recordEvent(doc.ID, DocumentEventReprocessed, fmt.Sprintf("Processing was interrupted, reprocessing (attempt %d of %d)", doc.RecoveryAttempts+1, r.Config.StaleProcessingRetries))
+
+	r.ingesting.Store(doc.ID, true)
+	defer r.ingesting.Delete(doc.ID)
+
+	_, err = r.indexDocument(ctx, doc.ID, doc.OriginalFilename, pdfData)
+	if r.storeForOCR(doc.ID, err) {
+		return nil
+	}
+	return err
+}
+
+// StartStaleRecovery runs RecoverStaleDocuments now and then every
+// StaleRecoveryInterval until ctx is cancelled
+func (r *SimpleRAGService) StartStaleRecovery(ctx context.Context) {
+	interval := r.Config.StaleRecoveryInterval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := r.RecoverStaleDocuments(ctx); err != nil {
+				log.Printf("Warning: stale document recovery failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
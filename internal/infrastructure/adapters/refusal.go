@@ -0,0 +1,211 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// Refusal reasons, reported in SimpleRAGResponse.Refusal
+const (
+	RefusalEmptyCorpus      = "empty_corpus"
+	RefusalNoContent        = "no_content"
+	RefusalNoEvidence       = "no_evidence"
+	RefusalNoAnswer         = "no_answer"
+	RefusalLowConfidence    = "low_confidence"
+	RefusalRestrictedTopic  = "restricted_topic"
+	RefusalMissingCitations = "missing_citations"
+	RefusalModerated        = "moderated"
+)
+
+// WarningLowConfidence is the warning attached to answers in a "warn"
+// confidence band; its message can be overridden like a refusal's
+const WarningLowConfidence = "low_confidence_warning"
+
+// defaultRefusalMessages are the built-in messages by reason and language;
+// English is the fallback for other languages
+var defaultRefusalMessages = map[string]map[string]string{
+	RefusalEmptyCorpus: {
+		"en": "I don't have any documents in my knowledge base yet. Please upload some PDF files first.",
+		"fa": "هنوز هیچ سندی در پایگاه دانش من وجود ندارد. لطفاً ابتدا چند فایل PDF بارگذاری کنید.",
+	},
+	RefusalNoContent: {
+		"en": "I don't have any processed content in my knowledge base yet. Please upload some PDF files first.",
+		"fa": "هنوز هیچ محتوای پردازش‌شده‌ای در پایگاه دانش من وجود ندارد. لطفاً ابتدا چند فایل PDF بارگذاری کنید.",
+	},
+	RefusalNoEvidence: {
+		"en": "I don't have enough relevant information to answer that question accurately.",
+		"fa": "اطلاعات مرتبط کافی برای پاسخ دقیق به این پرسش ندارم.",
+	},
+	RefusalNoAnswer: {
+		"en": "I don't have that information in the provided documents.",
+		"fa": "این اطلاعات در اسناد موجود نیست.",
+	},
+	RefusalLowConfidence: {
+		"en": "I can't answer that reliably from the provided documents.",
+		"fa": "نمی‌توانم با اطمینان کافی از روی اسناد موجود به این پرسش پاسخ دهم.",
+	},
+	RefusalRestrictedTopic: {
+		"en": "I can't help with that topic.",
+		"fa": "نمی‌توانم در این موضوع کمک کنم.",
+	},
+	RefusalMissingCitations: {
+		"en": "I couldn't find sources in the documents to support an answer.",
+		"fa": "منبعی در اسناد برای پشتیبانی از پاسخ پیدا نکردم.",
+	},
+	RefusalModerated: {
+		"en": "I can't respond to that request.",
+		"fa": "نمی‌توانم به این درخواست پاسخ دهم.",
+	},
+	WarningLowConfidence: {
+		"en": "This answer has low confidence; check it against the cited sources.",
+		"fa": "اطمینان به این پاسخ پایین است؛ آن را با منابع ذکرشده مقایسه کنید.",
+	},
+}
+
+// RefusalPolicy decides when the service refuses to answer and what it says.
+// Besides the built-in cases (no documents, no evidence, the model not
+// knowing) it can refuse low-confidence answers, answers without citations
+// and questions on restricted topics.
+type RefusalPolicy struct {
+	// MinConfidence refuses answers below this confidence; 0 disables it
+	MinConfidence float64
+	// RequireCitations refuses answers that cite no source
+	RequireCitations bool
+	// RestrictedTopics are lowercase words or phrases questions may not contain
+	RestrictedTopics []string
+	// Bands classify answers by confidence, highest first, to answer them,
+	// answer them with a warning or abstain
+	Bands []ConfidenceBand
+
+	messages map[string]map[string]string
+}
+
+func NewRefusalPolicy(cfg *config.Config) *RefusalPolicy {
+	policy := &RefusalPolicy{
+		MinConfidence:    cfg.RefusalMinConfidence,
+		RequireCitations: cfg.RefusalRequireCitations,
+		Bands:            ParseConfidenceBands(cfg.ConfidenceBands),
+		messages:         make(map[string]map[string]string, len(defaultRefusalMessages)),
+	}
+
+	for reason, byLanguage := range defaultRefusalMessages {
+		policy.messages[reason] = make(map[string]string, len(byLanguage))
+		for lang, message := range byLanguage {
+			policy.messages[reason][lang] = message
+		}
+	}
+
+	for _, topic := range strings.Split(cfg.RefusalRestrictedTopics, ",") {
+		if topic = normalizeTopicText(topic); topic != "" {
+			policy.RestrictedTopics = append(policy.RestrictedTopics, topic)
+		}
+	}
+
+	// REFUSAL_MESSAGES_FILE holds {"reason": {"lang": "message"}} overrides
+	if cfg.RefusalMessagesFile != "" {
+		if err := policy.loadMessages(cfg.RefusalMessagesFile); err != nil {
+			log.Printf("Warning: ignoring REFUSAL_MESSAGES_FILE: %v", err)
+		}
+	}
+
+	return policy
+}
+
+func (p *RefusalPolicy) loadMessages(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var overrides map[string]map[string]string
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return err
+	}
+
+	for reason, byLanguage := range overrides {
+		if _, known := p.messages[reason]; !known {
+			log.Printf("Warning: unknown refusal reason %q in REFUSAL_MESSAGES_FILE", reason)
+			continue
+		}
+		for lang, message := range byLanguage {
+			p.messages[reason][lang] = message
+		}
+	}
+	return nil
+}
+
+// Message is the refusal text for a reason in the given language
+func (p *RefusalPolicy) Message(reason, lang string) string {
+	if message, ok := p.messages[reason][lang]; ok {
+		return message
+	}
+	return p.messages[reason]["en"]
+}
+
+// CheckQuestion returns RefusalRestrictedTopic when the question mentions a
+// restricted topic as a whole word or phrase
+func (p *RefusalPolicy) CheckQuestion(question string) string {
+	if len(p.RestrictedTopics) == 0 {
+		return ""
+	}
+	text := " " + normalizeTopicText(question) + " "
+	for _, topic := range p.RestrictedTopics {
+		if strings.Contains(text, " "+topic+" ") {
+			return RefusalRestrictedTopic
+		}
+	}
+	return ""
+}
+
+// CheckAnswer records the answer's confidence band, with a warning in lang
+// for "warn" bands, and returns the reason to refuse it, if any
+func (p *RefusalPolicy) CheckAnswer(response *SimpleRAGResponse, lang string) string {
+	band := confidenceBand(p.Bands, response.Confidence)
+	if band != nil {
+		response.ConfidenceBand = band.Name
+	}
+
+	if p.RequireCitations && len(response.Sources) == 0 {
+		return RefusalMissingCitations
+	}
+	if p.MinConfidence > 0 && response.Confidence < p.MinConfidence {
+		return RefusalLowConfidence
+	}
+	if band != nil {
+		switch band.Behavior {
+		case BandAbstain:
+			return RefusalLowConfidence
+		case BandWarn:
+			response.Warning = p.Message(WarningLowConfidence, lang)
+		}
+	}
+	return ""
+}
+
+// normalizeTopicText lowercases text and turns punctuation into single
+// spaces so topics match on word boundaries in any script
+func normalizeTopicText(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	}), " ")
+}
+
+// refuse stores and returns a refusal for the question
+func (r *SimpleRAGService) refuse(ctx context.Context, question, lang, reason, context string) *SimpleRAGResponse {
+	response := &SimpleRAGResponse{
+		Answer:     r.settingsFor(ctx).refusals.Message(reason, lang),
+		Sources:    []string{},
+		Confidence: 0.0,
+		Context:    context,
+		Refusal:    reason,
+	}
+
+	// Store query in database
+	r.storeQuery(ctx, question, response)
+	return response
+}
@@ -0,0 +1,212 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ReportTemplates are predefined question sets for POST /reports
+var ReportTemplates = map[string][]string{
+	"overview": {
+		"What are the main topics covered by these documents?",
+		"What are the key findings or conclusions?",
+		"What important figures, dates or amounts are mentioned?",
+		"What open issues, risks or recommendations are identified?",
+	},
+	"compliance": {
+		"What requirements or obligations are described?",
+		"What deadlines or effective dates apply?",
+		"Who is responsible for meeting each obligation?",
+		"What penalties or consequences are mentioned for non-compliance?",
+	},
+}
+
+// ReportRequest describes a report to compile
+type ReportRequest struct {
+	Title     string
+	Questions []string
+	PDF       bool
+}
+
+// reportAnswer is one answered question in a report
+type reportAnswer struct {
+	question string
+	response *SimpleRAGResponse
+}
+
+// StartReport creates a report job and answers its questions in the
+// background. ctx should outlive the request, it cancels the job.
+func (r *SimpleRAGService) StartReport(ctx context.Context, req ReportRequest) (*ReportRecord, error) {
+	questionsJSON, err := json.Marshal(req.Questions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode questions: %w", err)
+	}
+
+	report := &ReportRecord{
+		ID:         fmt.Sprintf("report_%d", time.Now().UnixNano()),
+		Title:      req.Title,
+		Status:     "running",
+		Questions:  string(questionsJSON),
+		TotalSteps: len(req.Questions),
+	}
+	if err := r.DatabaseSchema.InsertReport(report); err != nil {
+		return nil, fmt.Errorf("failed to create report: %w", err)
+	}
+
+	go func() {
+		markdownObject, pdfObject, err := r.compileReport(ctx, report.ID, req)
+		if err != nil {
+			log.Printf("Warning: report %s failed: %v", report.ID, err)
+			if err := r.DatabaseSchema.FailReport(report.ID, err.Error()); err != nil {
+				log.Printf("Warning: failed to record report failure: %v", err)
+			}
+			return
+		}
+		if err := r.DatabaseSchema.CompleteReport(report.ID, markdownObject, pdfObject); err != nil {
+			log.Printf("Warning: failed to complete report %s: %v", report.ID, err)
+			return
+		}
+		log.Printf("✅ Report %s completed", report.ID)
+	}()
+
+	return report, nil
+}
+
+// compileReport answers every question, renders the report and stores it in
+// MinIO, returning the object names
+func (r *SimpleRAGService) compileReport(ctx context.Context, reportID string, req ReportRequest) (string, string, error) {
+	var answers []reportAnswer
+	for i, question := range req.Questions {
+		// Reports are laid out by source, whatever the deployment default
+		opts := QueryOptions{AnswerMode: AnswerModeBySource, Flags: map[string]bool{FlagBySourceAnswers: true}}
+		response, err := r.queryBackground(ctx, question, opts)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to answer %q: %w", question, err)
+		}
+		answers = append(answers, reportAnswer{question: question, response: response})
+
+		if err := r.DatabaseSchema.UpdateReportProgress(reportID, i+1); err != nil {
+			log.Printf("Warning: failed to update report progress: %v", err)
+		}
+	}
+
+	generatedAt := time.Now()
+	prefix := "reports/" + reportID + "/"
+
+	markdownObject := prefix + "report.md"
+	markdown := renderReportMarkdown(req.Title, generatedAt, answers)
+	if err := r.MinIOAdapter.PutObject(ctx, "documents", markdownObject, []byte(markdown), "text/markdown; charset=utf-8"); err != nil {
+		return "", "", fmt.Errorf("failed to store report: %w", err)
+	}
+
+	pdfObject := ""
+	if req.PDF {
+		pdfObject = prefix + "report.pdf"
+		pdfData := RenderTextPDF(reportPDFLines(req.Title, generatedAt, answers))
+		if err := r.MinIOAdapter.PutObject(ctx, "documents", pdfObject, pdfData, "application/pdf"); err != nil {
+			return "", "", fmt.Errorf("failed to store report PDF: %w", err)
+		}
+	}
+
+	return markdownObject, pdfObject, nil
+}
+
+// queryBackground runs a query for a background job, waiting out LLM
+// saturation instead of failing
+func (r *SimpleRAGService) queryBackground(ctx context.Context, question string, opts QueryOptions) (*SimpleRAGResponse, error) {
+	for {
+		response, err := r.Query(ctx, question, opts)
+		if !errors.Is(err, ErrLLMSaturated) {
+			return response, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// reportCitations lists the documents an answer draws on
+func reportCitations(response *SimpleRAGResponse) []string {
+	var citations []string
+	if len(response.Sections) > 0 {
+		for _, section := range response.Sections {
+			citations = append(citations, section.Citation)
+		}
+		return citations
+	}
+	for _, source := range response.Sources {
+		if source == "" {
+			continue
+		}
+		// Sources are formatted as "documentID|filename"
+		if i := strings.Index(source, "|"); i >= 0 {
+			source = source[i+1:]
+		}
+		citations = append(citations, source)
+	}
+	return citations
+}
+
+func renderReportMarkdown(title string, generatedAt time.Time, answers []reportAnswer) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n_Generated %s_\n\n", title, generatedAt.Format("2006-01-02 15:04"))
+
+	for i, answer := range answers {
+		fmt.Fprintf(&b, "## %d. %s\n\n", i+1, answer.question)
+
+		if len(answer.response.Sections) > 0 {
+			for _, section := range answer.response.Sections {
+				fmt.Fprintf(&b, "**%s**\n\n%s\n\n", section.Citation, section.Text)
+			}
+		} else {
+			fmt.Fprintf(&b, "%s\n\n", answer.response.Answer)
+		}
+
+		if citations := reportCitations(answer.response); len(citations) > 0 {
+			b.WriteString("Sources:\n")
+			for _, citation := range citations {
+				fmt.Fprintf(&b, "- %s\n", citation)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+func reportPDFLines(title string, generatedAt time.Time, answers []reportAnswer) []PDFLine {
+	lines := []PDFLine{
+		{Text: title, Size: 20, Bold: true},
+		{Text: "Generated " + generatedAt.Format("2006-01-02 15:04"), Size: 9},
+		{},
+	}
+
+	for i, answer := range answers {
+		lines = append(lines, PDFLine{Text: fmt.Sprintf("%d. %s", i+1, answer.question), Size: 14, Bold: true})
+
+		if len(answer.response.Sections) > 0 {
+			for _, section := range answer.response.Sections {
+				lines = append(lines,
+					PDFLine{Text: section.Citation, Bold: true},
+					PDFLine{Text: section.Text},
+					PDFLine{},
+				)
+			}
+		} else {
+			lines = append(lines, PDFLine{Text: answer.response.Answer}, PDFLine{})
+		}
+
+		if citations := reportCitations(answer.response); len(citations) > 0 {
+			lines = append(lines, PDFLine{Text: "Sources: " + strings.Join(citations, "; "), Size: 9}, PDFLine{})
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,166 @@
+package adapters
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// Limits for InspectRetrieval
+const (
+	defaultInspectBuckets   = 10
+	maxInspectBuckets       = 50
+	defaultInspectDocuments = 10
+	maxInspectDocuments     = 50
+)
+
+// RetrievalInspection is how a query scores across the corpus, for tuning
+// score thresholds to a set of documents. Only chunks scoring above zero
+// count as matching; the histogram and statistics cover those.
+type RetrievalInspection struct {
+	Query          string          `json:"query"`
+	ScoredChunks   int             `json:"scored_chunks"`
+	MatchingChunks int             `json:"matching_chunks"`
+	Stats          ScoreStats      `json:"stats"`
+	Histogram      []ScoreBucket   `json:"histogram"`
+	TopDocuments   []DocumentScore `json:"top_documents"`
+	// Thresholds are the scores the query pipeline compares against
+	Thresholds map[string]float64 `json:"thresholds"`
+}
+
+// ScoreStats summarizes the matching chunks' scores
+type ScoreStats struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+}
+
+// ScoreBucket counts matching chunks scoring from Min up to Max; the last
+// bucket includes Max
+type ScoreBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// DocumentScore is a document's best chunk for the query
+type DocumentScore struct {
+	DocumentID     string  `json:"document_id"`
+	Filename       string  `json:"filename"`
+	BestScore      float64 `json:"best_score"`
+	BestPage       int     `json:"best_page"`
+	MatchingChunks int     `json:"matching_chunks"`
+}
+
+// InspectRetrieval scores the whole corpus against query and describes the
+// score distribution, without calling the LLM or storing anything
+func (r *SimpleRAGService) InspectRetrieval(ctx context.Context, query string, buckets, topDocuments int, crossLingual bool) (*RetrievalInspection, error) {
+	if buckets <= 0 {
+		buckets = defaultInspectBuckets
+	}
+	if buckets > maxInspectBuckets {
+		buckets = maxInspectBuckets
+	}
+	if topDocuments <= 0 {
+		topDocuments = defaultInspectDocuments
+	}
+	if topDocuments > maxInspectDocuments {
+		topDocuments = maxInspectDocuments
+	}
+
+	scored, filenames, err := r.scoreCorpus(ctx, query, nil, crossLingual)
+	if err != nil {
+		return nil, err
+	}
+
+	inspection := &RetrievalInspection{
+		Query:        query,
+		ScoredChunks: len(scored),
+		Histogram:    []ScoreBucket{},
+		TopDocuments: []DocumentScore{},
+		Thresholds: map[string]float64{
+			"context": minContextScore,
+		},
+	}
+	if r.Config != nil {
+		inspection.Thresholds["cross_lingual_fallback"] = r.Config.CrossLingualMinScore
+	}
+
+	// scored is best first, so the matching chunks are a prefix
+	var scores []float64
+	documents := make(map[string]*DocumentScore)
+	var order []string
+	for _, s := range scored {
+		if s.Score <= 0 {
+			break
+		}
+		scores = append(scores, s.Score)
+
+		doc, ok := documents[s.Chunk.DocumentID]
+		if !ok {
+			doc = &DocumentScore{
+				DocumentID: s.Chunk.DocumentID,
+				Filename:   filenames[s.Chunk.DocumentID],
+				BestScore:  s.Score,
+				BestPage:   s.Chunk.PageNumber,
+			}
+			documents[s.Chunk.DocumentID] = doc
+			order = append(order, s.Chunk.DocumentID)
+		}
+		doc.MatchingChunks++
+	}
+	inspection.MatchingChunks = len(scores)
+	if len(scores) == 0 {
+		return inspection, nil
+	}
+
+	for i, id := range order {
+		if i >= topDocuments {
+			break
+		}
+		inspection.TopDocuments = append(inspection.TopDocuments, *documents[id])
+	}
+
+	ascending := make([]float64, len(scores))
+	copy(ascending, scores)
+	sort.Float64s(ascending)
+	sum := 0.0
+	for _, score := range ascending {
+		sum += score
+	}
+	inspection.Stats = ScoreStats{
+		Min:    ascending[0],
+		Max:    ascending[len(ascending)-1],
+		Mean:   sum / float64(len(ascending)),
+		Median: percentile(ascending, 0.5),
+		P90:    percentile(ascending, 0.9),
+	}
+
+	width := inspection.Stats.Max / float64(buckets)
+	for i := 0; i < buckets; i++ {
+		inspection.Histogram = append(inspection.Histogram, ScoreBucket{
+			Min: width * float64(i),
+			Max: width * float64(i+1),
+		})
+	}
+	for _, score := range ascending {
+		i := int(score / width)
+		if i >= buckets {
+			i = buckets - 1
+		}
+		inspection.Histogram[i].Count++
+	}
+
+	return inspection, nil
+}
+
+// percentile reads the p-th percentile from ascending scores, interpolating
+// between neighbours
+func percentile(ascending []float64, p float64) float64 {
+	position := p * float64(len(ascending)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	return ascending[lower] + (ascending[upper]-ascending[lower])*(position-float64(lower))
+}
@@ -0,0 +1,145 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Retrieval limits for Retrieve
+const (
+	defaultRetrieveTopK = 5
+	maxRetrieveTopK     = 50
+	// retrieveChunksPerDocument bounds how many chunks of each document are
+	// scored, like the per-document limits of query and search
+	retrieveChunksPerDocument = 1000
+)
+
+// RetrieveOptions narrows a retrieval
+type RetrieveOptions struct {
+	TopK     int     `json:"top_k"`
+	MinScore float64 `json:"min_score"`
+	// DocumentIDs restricts retrieval to these documents when set
+	DocumentIDs []string `json:"document_ids"`
+	// CrossLingual disables the preference for chunks in the query's language
+	CrossLingual bool `json:"cross_lingual"`
+}
+
+// RetrievedChunk is a scored chunk in the retriever schema: the text, a
+// score and flat metadata, close to LangChain and LlamaIndex documents.
+// Fields are only ever added to this schema.
+type RetrievedChunk struct {
+	ID       string                 `json:"id"`
+	Text     string                 `json:"text"`
+	Score    float64                `json:"score"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// Retrieve scores chunks of completed documents against query and returns
+// the best ones without generating an answer, so the service can be used
+// purely as a retriever
+func (r *SimpleRAGService) Retrieve(ctx context.Context, query string, opts RetrieveOptions) ([]RetrievedChunk, error) {
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = defaultRetrieveTopK
+	}
+	if topK > maxRetrieveTopK {
+		topK = maxRetrieveTopK
+	}
+
+	retrievalStart := time.Now()
+	scored, filenames, err := r.scoreCorpus(ctx, query, opts.DocumentIDs, opts.CrossLingual)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []RetrievedChunk{}
+	for _, s := range scored {
+		if len(results) == topK {
+			break
+		}
+		if s.Score <= 0 || s.Score < opts.MinScore {
+			break
+		}
+		r.Access.Retrieved(s.Chunk.DocumentID)
+		results = append(results, RetrievedChunk{
+			ID:       s.Chunk.ID,
+			Text:     s.Chunk.ChunkText,
+			Score:    s.Score,
+			Metadata: retrievedMetadata(s.Chunk, filenames[s.Chunk.DocumentID]),
+		})
+	}
+
+	retrievalTime := time.Since(retrievalStart)
+	DefaultMetrics.RecordRetrieval(retrievalTime)
+	DebugTraceFromContext(ctx).AddStage("retrieval", retrievalTime)
+
+	return results, nil
+}
+
+// scoreCorpus scores every chunk of the caller's completed documents, or of
+// documentIDs when given, against query, best first. It also returns the
+// documents' filenames by ID.
+func (r *SimpleRAGService) scoreCorpus(ctx context.Context, query string, documentIDs []string, crossLingual bool) ([]ScoredChunk, map[string]string, error) {
+	documents, err := r.DatabaseSchema.GetAllDocuments()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get documents: %w", err)
+	}
+	guard, err := r.collectionGuard(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	documents = guard.readable(documents)
+
+	wanted := make(map[string]bool, len(documentIDs))
+	for _, id := range documentIDs {
+		wanted[id] = true
+	}
+
+	filenames := make(map[string]string)
+	var chunks []ChunkRecord
+	for _, doc := range documents {
+		if doc.Status != "completed" || (len(wanted) > 0 && !wanted[doc.ID]) {
+			continue
+		}
+		docChunks, err := r.DatabaseSchema.GetChunksByDocument(doc.ID, retrieveChunksPerDocument, 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get chunks for document %s: %w", doc.ID, err)
+		}
+		filenames[doc.ID] = doc.OriginalFilename
+		chunks = append(chunks, docChunks...)
+	}
+
+	r.attachSimilarity(ctx, query, chunks)
+	questionLanguage, _ := DetectLanguage(query)
+	crossLingual = crossLingual || (r.Config != nil && r.Config.RetrievalCrossLingual)
+	scored := r.scoreChunks(ctx, strings.Fields(strings.ToLower(query)), chunks, questionLanguage, crossLingual, "")
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+	return scored, filenames, nil
+}
+
+// retrievedMetadata merges the chunk's stored metadata with its location;
+// the location keys always win
+func retrievedMetadata(chunk ChunkRecord, filename string) map[string]interface{} {
+	var metadata map[string]interface{}
+	if chunk.Metadata != "" {
+		_ = json.Unmarshal([]byte(chunk.Metadata), &metadata)
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+
+	metadata["document_id"] = chunk.DocumentID
+	metadata["filename"] = filename
+	metadata["page_number"] = chunk.PageNumber
+	metadata["chunk_index"] = chunk.ChunkIndex
+	metadata["chunk_type"] = chunk.ChunkType
+	metadata["language"] = chunk.Language
+	metadata["word_count"] = chunk.WordCount
+	return metadata
+}
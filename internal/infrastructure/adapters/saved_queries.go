@@ -0,0 +1,126 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Saved query intervals, in hours
+const (
+	defaultSavedQueryInterval = 24
+	maxSavedQueryInterval     = 24 * 30
+)
+
+// ErrInvalidSavedQuery wraps errors in a saved query request
+var ErrInvalidSavedQuery = errors.New("invalid saved query")
+
+// CreateSavedQuery saves a question to re-ask every intervalHours for the
+// caller in ctx, who is notified when the answer changes
+func (r *SimpleRAGService) CreateSavedQuery(ctx context.Context, question string, intervalHours int) (*SavedQueryRecord, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil, fmt.Errorf("%w: question is required", ErrInvalidSavedQuery)
+	}
+	if intervalHours == 0 {
+		intervalHours = defaultSavedQueryInterval
+	}
+	if intervalHours < 1 || intervalHours > maxSavedQueryInterval {
+		return nil, fmt.Errorf("%w: interval_hours must be between 1 and %d", ErrInvalidSavedQuery, maxSavedQueryInterval)
+	}
+
+	saved := &SavedQueryRecord{
+		ID:            fmt.Sprintf("saved_%d", time.Now().UnixNano()),
+		Owner:         notificationRecipient(ctx),
+		Question:      question,
+		IntervalHours: intervalHours,
+	}
+	if err := r.DatabaseSchema.InsertSavedQuery(saved); err != nil {
+		return nil, fmt.Errorf("failed to save query: %w", err)
+	}
+	return r.DatabaseSchema.GetSavedQuery(saved.ID)
+}
+
+// RunSavedQueries re-asks the saved queries that are due. A question is
+// only re-asked once the corpus has changed since its last run, so an
+// unchanged corpus never produces a notification.
+func (r *SimpleRAGService) RunSavedQueries(ctx context.Context) error {
+	due, err := r.DatabaseSchema.GetDueSavedQueries()
+	if err != nil {
+		return fmt.Errorf("failed to get due saved queries: %w", err)
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	fingerprints, err := r.DatabaseSchema.GetDocumentFingerprints()
+	if err != nil {
+		return fmt.Errorf("failed to list documents: %w", err)
+	}
+	version := CorpusVersion(fingerprints)
+
+	for _, saved := range due {
+		if saved.LastCorpusVersion == version {
+			if err := r.DatabaseSchema.RescheduleSavedQuery(saved.ID); err != nil {
+				log.Printf("Warning: failed to reschedule saved query %s: %v", saved.ID, err)
+			}
+			continue
+		}
+		if err := r.runSavedQuery(ctx, saved, version); err != nil {
+			log.Printf("Warning: saved query %s failed: %v", saved.ID, err)
+		}
+	}
+	return nil
+}
+
+func (r *SimpleRAGService) runSavedQuery(ctx context.Context, saved SavedQueryRecord, version string) error {
+	// Ask as the owner so their collection permissions apply
+	ctx = WithCollectionAccess(ctx, &CollectionAccess{MemberID: saved.Owner})
+	response, err := r.queryBackground(ctx, saved.Question, QueryOptions{})
+	if err != nil {
+		return err
+	}
+
+	if saved.LastRunAt != nil && normalizeAnswer(response.Answer) != normalizeAnswer(saved.LastAnswer) {
+		r.Notifications.Notify(saved.Owner, NotificationAnswerChanged,
+			"Answer changed: "+TruncateRunes(saved.Question, 80),
+			fmt.Sprintf("The answer to %q changed after the documents were updated.\n\nNew answer:\n%s", saved.Question, response.Answer),
+			saved.ID)
+	}
+
+	return r.DatabaseSchema.RecordSavedQueryRun(saved.ID, response.Answer, version)
+}
+
+// normalizeAnswer ignores whitespace and case differences between answers
+func normalizeAnswer(answer string) string {
+	return strings.ToLower(strings.Join(strings.Fields(answer), " "))
+}
+
+// StartSavedQueries runs RunSavedQueries every SavedQueryCheckInterval
+// until ctx is cancelled
+func (r *SimpleRAGService) StartSavedQueries(ctx context.Context) {
+	interval := r.Config.SavedQueryCheckInterval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := r.RunSavedQueries(ctx); err != nil {
+				log.Printf("Warning: saved queries failed: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,444 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ScoringVariables are the per-chunk values a scoring expression can use
+var ScoringVariables = map[string]string{
+	"lexical":   "built-in lexical score",
+	"questions": "built-in lexical score against the best matching synthetic question (0 without DOC2QUERY_QUESTIONS)",
+	"phrase":    "1 when the whole question appears in the chunk",
+	"exact":     "exact term matches, weighted by term frequency",
+	"partial":   "question terms matched as part of a chunk word",
+	"translit":  "terms matched across scripts or spellings",
+	"coverage":  "share of question terms matched (0-1)",
+	"terms":     "number of question terms",
+	"vector":    "vector similarity to the question (0-1, 0 without EMBEDDER_PROVIDER)",
+	"recency":   "1 for a new chunk, halving every SCORING_RECENCY_HALF_LIFE",
+	"boost":     "the chunk's metadata boost, 1 by default",
+	"zone":      "page zone weight, below 1 for headers, footers, margins and footnotes",
+	"table":     "1 for table chunks",
+	"words":     "chunk word count",
+}
+
+// scoreFeatures are the lexical match counts behind CalculateRelevanceScore
+type scoreFeatures struct {
+	phrase   float64
+	exact    float64
+	partial  float64
+	translit float64
+	covered  int
+	terms    int
+}
+
+// lexical combines the features with the built-in weights
+func (f scoreFeatures) lexical() float64 {
+	if f.terms == 0 {
+		return 0
+	}
+	score := 40.0*f.phrase + 12.0*f.exact + 4.0*f.partial + 10.0*f.translit + 20.0*f.coverage()
+	// Normalize by query length to reduce bias
+	return score / (1.0 + 0.05*float64(f.terms))
+}
+
+func (f scoreFeatures) coverage() float64 {
+	if f.terms == 0 {
+		return 0
+	}
+	return float64(f.covered) / float64(f.terms)
+}
+
+// ScoringExpression is a compiled ranking formula, e.g.
+// "lexical * boost + 10 * recency" or "max(lexical, 30 * vector)".
+// It supports + - * / ^, comparisons (yielding 1 or 0), parentheses and the
+// functions min, max, abs, log, exp, sqrt and if(cond, then, else).
+type ScoringExpression struct {
+	Source string
+	eval   func(vars map[string]float64) float64
+}
+
+// CompileScoringExpression parses an expression over ScoringVariables
+func CompileScoringExpression(source string) (*ScoringExpression, error) {
+	p := &exprParser{tokens: tokenizeExpr(source)}
+	eval, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+	return &ScoringExpression{Source: source, eval: eval}, nil
+}
+
+// Evaluate runs the expression; NaN and infinite results count as 0
+func (e *ScoringExpression) Evaluate(vars map[string]float64) float64 {
+	value := e.eval(vars)
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0
+	}
+	return value
+}
+
+// tokenizeExpr splits an expression into numbers, names, operators and
+// punctuation. Unknown characters become their own token so the parser can
+// report them.
+func tokenizeExpr(source string) []string {
+	var tokens []string
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, strings.ToLower(string(runes[i:j])))
+			i = j
+		case strings.ContainsRune("<>=!", r) && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, string(runes[i:i+2]))
+			i += 2
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+type exprFunc = func(vars map[string]float64) float64
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *exprParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		if got == "" {
+			return fmt.Errorf("expected %q at end of expression", tok)
+		}
+		return fmt.Errorf("expected %q, got %q", tok, got)
+	}
+	return nil
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *exprParser) parseComparison() (exprFunc, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	var compare func(a, b float64) bool
+	switch op {
+	case "<":
+		compare = func(a, b float64) bool { return a < b }
+	case ">":
+		compare = func(a, b float64) bool { return a > b }
+	case "<=":
+		compare = func(a, b float64) bool { return a <= b }
+	case ">=":
+		compare = func(a, b float64) bool { return a >= b }
+	case "==":
+		compare = func(a, b float64) bool { return a == b }
+	case "!=":
+		compare = func(a, b float64) bool { return a != b }
+	default:
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	return func(vars map[string]float64) float64 {
+		return boolValue(compare(left(vars), right(vars)))
+	}, nil
+}
+
+func (p *exprParser) parseSum() (exprFunc, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.next()
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "+" {
+			left = func(vars map[string]float64) float64 { return l(vars) + right(vars) }
+		} else {
+			left = func(vars map[string]float64) float64 { return l(vars) - right(vars) }
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseProduct() (exprFunc, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "*" || p.peek() == "/" {
+		op := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "*" {
+			left = func(vars map[string]float64) float64 { return l(vars) * right(vars) }
+		} else {
+			left = func(vars map[string]float64) float64 {
+				d := right(vars)
+				if d == 0 {
+					return 0
+				}
+				return l(vars) / d
+			}
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprFunc, error) {
+	if p.peek() == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(vars map[string]float64) float64 { return -operand(vars) }, nil
+	}
+	return p.parsePower()
+}
+
+func (p *exprParser) parsePower() (exprFunc, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != "^" {
+		return base, nil
+	}
+	p.next()
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return func(vars map[string]float64) float64 { return math.Pow(base(vars), exponent(vars)) }, nil
+}
+
+func (p *exprParser) parsePrimary() (exprFunc, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		inner, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case unicode.IsDigit([]rune(tok)[0]) || tok[0] == '.':
+		value, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok)
+		}
+		return func(map[string]float64) float64 { return value }, nil
+	case unicode.IsLetter([]rune(tok)[0]) || tok[0] == '_':
+		if p.peek() == "(" {
+			return p.parseCall(tok)
+		}
+		if _, ok := ScoringVariables[tok]; !ok {
+			return nil, fmt.Errorf("unknown variable %q; available: %s", tok, strings.Join(scoringVariableNames(), ", "))
+		}
+		name := tok
+		return func(vars map[string]float64) float64 { return vars[name] }, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+func (p *exprParser) parseCall(name string) (exprFunc, error) {
+	p.next() // "("
+	var args []exprFunc
+	if p.peek() != ")" {
+		for {
+			arg, err := p.parseComparison()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	unary := map[string]func(float64) float64{
+		"abs":  math.Abs,
+		"exp":  math.Exp,
+		"sqrt": func(x float64) float64 { return math.Sqrt(math.Max(x, 0)) },
+		"log": func(x float64) float64 {
+			if x <= 0 {
+				return 0
+			}
+			return math.Log(x)
+		},
+	}
+
+	switch {
+	case unary[name] != nil:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s takes 1 argument", name)
+		}
+		fn, arg := unary[name], args[0]
+		return func(vars map[string]float64) float64 { return fn(arg(vars)) }, nil
+	case name == "min" || name == "max":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s needs at least 1 argument", name)
+		}
+		pick := math.Min
+		if name == "max" {
+			pick = math.Max
+		}
+		return func(vars map[string]float64) float64 {
+			result := args[0](vars)
+			for _, arg := range args[1:] {
+				result = pick(result, arg(vars))
+			}
+			return result
+		}, nil
+	case name == "if":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("if takes 3 arguments")
+		}
+		return func(vars map[string]float64) float64 {
+			if args[0](vars) != 0 {
+				return args[1](vars)
+			}
+			return args[2](vars)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown function %q", name)
+}
+
+func scoringVariableNames() []string {
+	names := make([]string, 0, len(ScoringVariables))
+	for name := range ScoringVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ScoreChunk scores a chunk for the question, using the configured scoring
+// expression when there is one and the built-in lexical score weighted by
+// page zone, plus VECTOR_WEIGHT times the vector similarity, otherwise
+func (r *SimpleRAGService) ScoreChunk(ctx context.Context, questionWords []string, chunk ChunkRecord) float64 {
+	settings := r.settingsFor(ctx)
+	return r.scoreChunkWith(settings, settings.scoring, questionWords, chunk)
+}
+
+// scoreChunkWith scores a chunk with expr, or the built-in score when nil,
+// weighting page zones by settings
+func (r *SimpleRAGService) scoreChunkWith(settings *serviceSettings, expr *ScoringExpression, questionWords []string, chunk ChunkRecord) float64 {
+	features := r.relevanceFeatures(questionWords, scoringText(chunk))
+	questions := r.syntheticQuestionScore(questionWords, chunk)
+	zone := settings.zoneWeight(chunk)
+	if expr == nil {
+		// A chunk scores as well as the questions it answers match
+		return math.Max(features.lexical(), questions)*zone + r.vectorWeight()*chunk.Similarity
+	}
+
+	return expr.Evaluate(map[string]float64{
+		"lexical":   features.lexical(),
+		"questions": questions,
+		"phrase":    features.phrase,
+		"exact":     features.exact,
+		"partial":   features.partial,
+		"translit":  features.translit,
+		"coverage":  features.coverage(),
+		"terms":     float64(features.terms),
+		"vector":    chunk.Similarity,
+		"recency":   r.chunkRecency(chunk),
+		"boost":     chunkBoost(chunk),
+		"zone":      zone,
+		"table":     boolValue(chunk.ChunkType == ChunkTypeTable),
+		"words":     float64(chunk.WordCount),
+	})
+}
+
+// chunkRecency decays from 1 for a just-ingested chunk, halving every
+// ScoringRecencyHalfLife
+func (r *SimpleRAGService) chunkRecency(chunk ChunkRecord) float64 {
+	if r.Config == nil || r.Config.ScoringRecencyHalfLife <= 0 {
+		return 0
+	}
+	if chunk.CreatedAt.IsZero() {
+		return 0
+	}
+	age := time.Since(chunk.CreatedAt)
+	if age < 0 {
+		age = 0
+	}
+	return math.Pow(0.5, float64(age)/float64(r.Config.ScoringRecencyHalfLife))
+}
+
+// chunkBoost reads a numeric "boost" from the chunk metadata, default 1
+func chunkBoost(chunk ChunkRecord) float64 {
+	var metadata struct {
+		Boost *float64 `json:"boost"`
+	}
+	if !strings.Contains(chunk.Metadata, "boost") || json.Unmarshal([]byte(chunk.Metadata), &metadata) != nil || metadata.Boost == nil {
+		return 1
+	}
+	return *metadata.Boost
+}
@@ -0,0 +1,164 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Types of search results
+const (
+	SearchResultChunk   = "chunk"
+	SearchResultAnswer  = "answer"
+	SearchResultMessage = "message"
+)
+
+const (
+	// searchMinScore is the relevance a result needs to be returned
+	searchMinScore = 0.1
+	// searchCandidates caps the stored answers and messages scored per search
+	searchCandidates = 500
+	// maxSearchResults caps the limit a search can ask for
+	maxSearchResults = 100
+)
+
+// SearchResult is a chunk, stored answer or chat message matching a search,
+// with the link to open it
+type SearchResult struct {
+	Type  string  `json:"type"`
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+	// Title is the document's filename, an answer's question or a
+	// message's session title
+	Title     string `json:"title"`
+	Snippet   string `json:"snippet"`
+	Direction string `json:"direction"`
+	Link      string `json:"link"`
+	// DocumentID is set for chunks, SessionID for messages
+	DocumentID string    `json:"document_id,omitempty"`
+	SessionID  string    `json:"session_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Search finds where a topic was read or asked about: chunks of the
+// documents the caller can read, stored answers and chat messages, scored
+// alike and best first. types restricts the result types when not empty.
+func (r *SimpleRAGService) Search(ctx context.Context, query string, types []string, limit int) ([]SearchResult, error) {
+	if limit <= 0 || limit > maxSearchResults {
+		limit = maxSearchResults
+	}
+	words := strings.Fields(strings.ToLower(query))
+	wanted := func(kind string) bool {
+		if len(types) == 0 {
+			return true
+		}
+		for _, t := range types {
+			if t == kind {
+				return true
+			}
+		}
+		return false
+	}
+
+	var results []SearchResult
+	add := func(result SearchResult, text string) {
+		if result.Score <= searchMinScore {
+			return
+		}
+		result.Snippet = TruncateRunes(text, 200)
+		result.Direction = TextDirection(result.Snippet)
+		results = append(results, result)
+	}
+
+	if wanted(SearchResultChunk) {
+		documents, err := r.DatabaseSchema.GetAllDocuments()
+		if err == nil {
+			documents, err = r.ReadableDocuments(ctx, documents)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get documents: %w", err)
+		}
+		filenames := make(map[string]string)
+		var chunks []ChunkRecord
+		for _, doc := range documents {
+			if doc.Status != "completed" {
+				continue
+			}
+			docChunks, err := r.DatabaseSchema.GetChunksByDocument(doc.ID, retrieveChunksPerDocument, 0)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get chunks for document %s: %w", doc.ID, err)
+			}
+			filenames[doc.ID] = doc.OriginalFilename
+			chunks = append(chunks, docChunks...)
+		}
+		r.attachSimilarity(ctx, query, chunks)
+		for _, chunk := range chunks {
+			add(SearchResult{
+				Type:       SearchResultChunk,
+				ID:         chunk.ID,
+				Score:      r.ScoreChunk(ctx, words, chunk),
+				Title:      filenames[chunk.DocumentID],
+				Link:       "/chunks/" + url.PathEscape(chunk.ID) + "/context",
+				DocumentID: chunk.DocumentID,
+				CreatedAt:  chunk.CreatedAt,
+			}, chunk.ChunkText)
+		}
+	}
+
+	if wanted(SearchResultAnswer) {
+		queries, err := r.DatabaseSchema.SearchQueries(words, searchCandidates)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search answers: %w", err)
+		}
+		for _, q := range queries {
+			add(SearchResult{
+				Type:      SearchResultAnswer,
+				ID:        q.ID,
+				Score:     r.CalculateRelevanceScore(words, q.Question+"\n"+q.Answer),
+				Title:     q.Question,
+				Link:      "/queries/" + url.PathEscape(q.ID),
+				CreatedAt: q.CreatedAt,
+			}, q.Answer)
+		}
+	}
+
+	if wanted(SearchResultMessage) {
+		messages, err := r.DatabaseSchema.SearchChatMessages(words, searchCandidates)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search chat messages: %w", err)
+		}
+		titles := make(map[string]string)
+		for _, msg := range messages {
+			title, ok := titles[msg.SessionID]
+			if !ok {
+				if session, err := r.DatabaseSchema.GetChatSession(msg.SessionID); err == nil {
+					title = session.Title
+				}
+				titles[msg.SessionID] = title
+			}
+			add(SearchResult{
+				Type:      SearchResultMessage,
+				ID:        msg.ID,
+				Score:     r.CalculateRelevanceScore(words, msg.Content),
+				Title:     title,
+				Link:      "/sessions/" + url.PathEscape(msg.SessionID),
+				SessionID: msg.SessionID,
+				CreatedAt: msg.CreatedAt,
+			}, msg.Content)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].CreatedAt.After(results[j].CreatedAt)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
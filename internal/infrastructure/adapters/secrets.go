@@ -0,0 +1,158 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Secrets a SecretsProvider is asked for
+const (
+	SecretGoogleAPIKey   = "google_api_key"
+	SecretOpenAIAPIKey   = "openai_api_key"
+	SecretMinIOAccessKey = "minio_access_key"
+	SecretMinIOSecretKey = "minio_secret_key"
+)
+
+// ErrSecretNotFound is returned by providers that don't hold a secret
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretsProvider fetches credentials from an external secret store
+type SecretsProvider interface {
+	Name() string
+	// Fetch returns a secret's value and how long it may be cached; zero
+	// leaves it to the caller
+	Fetch(ctx context.Context, name string) (string, time.Duration, error)
+}
+
+// Secrets caches values from a SecretsProvider until their lease runs out,
+// so rotated credentials are picked up at runtime. Secrets the provider
+// doesn't hold, or can't be fetched before anything was cached, fall back
+// to the configured values.
+type Secrets struct {
+	Provider SecretsProvider
+	// TTL applies to secrets fetched without a lease
+	TTL time.Duration
+
+	mu       sync.Mutex
+	cache    map[string]cachedSecret
+	fallback map[string]string
+}
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// NewSecrets returns nil unless VAULT_ADDR is set, leaving credentials to
+// the configuration
+func NewSecrets(cfg *config.Config) *Secrets {
+	if cfg.VaultAddr == "" {
+		return nil
+	}
+
+	log.Printf("✅ Provider credentials are fetched from Vault at %s", cfg.VaultAddr)
+	return &Secrets{
+		Provider: NewVaultProvider(cfg),
+		TTL:      cfg.VaultCacheTTL,
+		cache:    make(map[string]cachedSecret),
+		fallback: map[string]string{
+			SecretGoogleAPIKey:   cfg.GoogleAPIKey,
+			SecretOpenAIAPIKey:   cfg.ModerationAPIKey,
+			SecretMinIOAccessKey: cfg.MinIOAccessKey,
+			SecretMinIOSecretKey: cfg.MinIOSecretKey,
+		},
+	}
+}
+
+// Get returns a secret, fetching it again once its lease has expired. A
+// failed fetch keeps the previous value rather than failing the caller.
+func (s *Secrets) Get(ctx context.Context, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cached, ok := s.cache[name]
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value
+	}
+
+	value, lease, err := s.Provider.Fetch(ctx, name)
+	if err != nil {
+		if !errors.Is(err, ErrSecretNotFound) {
+			log.Printf("Warning: failed to fetch %s from %s: %v", name, s.Provider.Name(), err)
+			if ok {
+				return cached.value
+			}
+		}
+		// Try the store again later, not on every request
+		value, lease = s.fallback[name], 0
+	}
+	if lease <= 0 {
+		lease = s.TTL
+	}
+	s.cache[name] = cachedSecret{value: value, expires: time.Now().Add(lease)}
+	return value
+}
+
+// Invalidate drops cached secrets, typically after they were rejected, so
+// the next Get fetches them again
+func (s *Secrets) Invalidate(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range names {
+		delete(s.cache, name)
+	}
+}
+
+// expired reports whether a secret has to be fetched on its next Get
+func (s *Secrets) expired(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached, ok := s.cache[name]
+	return !ok || !time.Now().Before(cached.expires)
+}
+
+// minioCredentials serves MinIO credentials from Secrets; minio-go asks
+// for new ones once IsExpired reports either key's lease has run out
+type minioCredentials struct {
+	secrets *Secrets
+}
+
+func (m *minioCredentials) Retrieve() (credentials.Value, error) {
+	return m.RetrieveWithCredContext(nil)
+}
+
+func (m *minioCredentials) RetrieveWithCredContext(*credentials.CredContext) (credentials.Value, error) {
+	ctx := context.Background()
+	return credentials.Value{
+		AccessKeyID:     m.secrets.Get(ctx, SecretMinIOAccessKey),
+		SecretAccessKey: m.secrets.Get(ctx, SecretMinIOSecretKey),
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+func (m *minioCredentials) IsExpired() bool {
+	return m.secrets.expired(SecretMinIOAccessKey) || m.secrets.expired(SecretMinIOSecretKey)
+}
+
+// minioAuthTransport drops the cached MinIO credentials when a request is
+// rejected, so the next one is signed with freshly fetched keys
+type minioAuthTransport struct {
+	base    http.RoundTripper
+	secrets *Secrets
+}
+
+func (t *minioAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusForbidden {
+		t.secrets.Invalidate(SecretMinIOAccessKey, SecretMinIOSecretKey)
+	}
+	return resp, err
+}
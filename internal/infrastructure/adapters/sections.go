@@ -0,0 +1,190 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Answer modes accepted in QueryOptions.AnswerMode
+const (
+	AnswerModeDefault  = ""
+	AnswerModeBySource = "by_source"
+)
+
+// AnswerSection is the part of a multi-part answer drawn from one document
+type AnswerSection struct {
+	DocumentID string `json:"document_id"`
+	Filename   string `json:"filename"`
+	Pages      []int  `json:"pages"`
+	Citation   string `json:"citation"`
+	Text       string `json:"text"`
+	Direction  string `json:"direction"`
+}
+
+// sourceGroup collects the context chunks that came from one document
+type sourceGroup struct {
+	label    string
+	document DocumentRecord
+	chunks   []ScoredChunk
+}
+
+func (g *sourceGroup) pages() []int {
+	seen := make(map[int]bool)
+	var pages []int
+	for _, chunk := range g.chunks {
+		if !seen[chunk.Chunk.PageNumber] {
+			seen[chunk.Chunk.PageNumber] = true
+			pages = append(pages, chunk.Chunk.PageNumber)
+		}
+	}
+	sort.Ints(pages)
+	return pages
+}
+
+func (g *sourceGroup) citation() string {
+	pages := g.pages()
+	if len(pages) == 0 {
+		return g.document.OriginalFilename
+	}
+	labels := make([]string, len(pages))
+	for i, page := range pages {
+		labels[i] = strconv.Itoa(page)
+	}
+	return fmt.Sprintf("%s (p.%s)", g.document.OriginalFilename, strings.Join(labels, ", "))
+}
+
+func (g *sourceGroup) section(text string) AnswerSection {
+	return AnswerSection{
+		DocumentID: g.document.ID,
+		Filename:   g.document.OriginalFilename,
+		Pages:      g.pages(),
+		Citation:   g.citation(),
+		Text:       text,
+		Direction:  TextDirection(text),
+	}
+}
+
+// groupBySource splits context chunks by document, keeping the order in
+// which each document first appears (best score first)
+func groupBySource(chunks []ScoredChunk, documents []DocumentRecord) []*sourceGroup {
+	byID := make(map[string]DocumentRecord, len(documents))
+	for _, doc := range documents {
+		byID[doc.ID] = doc
+	}
+
+	var groups []*sourceGroup
+	index := make(map[string]*sourceGroup)
+	for _, chunk := range chunks {
+		group, ok := index[chunk.Chunk.DocumentID]
+		if !ok {
+			doc, found := byID[chunk.Chunk.DocumentID]
+			if !found {
+				doc = DocumentRecord{ID: chunk.Chunk.DocumentID, OriginalFilename: chunk.Chunk.DocumentID}
+			}
+			group = &sourceGroup{label: fmt.Sprintf("S%d", len(groups)+1), document: doc}
+			index[chunk.Chunk.DocumentID] = group
+			groups = append(groups, group)
+		}
+		group.chunks = append(group.chunks, chunk)
+	}
+	return groups
+}
+
+// answerBySource asks the LLM for one section per relevant source and
+// composes the sections into a single readable answer
+func (r *SimpleRAGService) answerBySource(ctx context.Context, question, lang string, groups []*sourceGroup) (string, []AnswerSection, error) {
+	raw, err := r.LLM.GenerateText(ctx, bySourcePrompt(question, lang, groups))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var parsed []struct {
+		Source string `json:"source"`
+		Answer string `json:"answer"`
+	}
+	if err := json.Unmarshal([]byte(extractJSONArray(raw)), &parsed); err != nil {
+		// Keep the model's prose rather than failing the whole query
+		log.Printf("Warning: failed to parse sectioned answer, returning it as a single section: %v", err)
+		answer := strings.TrimSpace(raw)
+		return answer, []AnswerSection{groups[0].section(answer)}, nil
+	}
+
+	byLabel := make(map[string]*sourceGroup, len(groups))
+	for _, group := range groups {
+		byLabel[group.label] = group
+	}
+
+	var sections []AnswerSection
+	var parts []string
+	for _, item := range parsed {
+		group, ok := byLabel[strings.Trim(strings.TrimSpace(item.Source), "[]")]
+		text := strings.TrimSpace(item.Answer)
+		if !ok || text == "" || lacksInformation(text) {
+			continue
+		}
+		sections = append(sections, group.section(text))
+		parts = append(parts, sectionHeading(lang, group.citation())+" "+text)
+	}
+
+	return strings.Join(parts, "\n\n"), sections, nil
+}
+
+// bySourcePrompt asks for one answer per source group, as JSON
+func bySourcePrompt(question, lang string, groups []*sourceGroup) string {
+	var sources strings.Builder
+	for _, group := range groups {
+		texts := make([]string, len(group.chunks))
+		for i, chunk := range group.chunks {
+			texts[i] = chunk.Chunk.ChunkText
+		}
+		fmt.Fprintf(&sources, "[%s] %s\n%s\n\n", group.label, group.citation(), capRunes(strings.Join(texts, "\n"), maxContextRunes/len(groups)))
+	}
+
+	languageInstruction := ""
+	if lang != "" && lang != "en" {
+		languageInstruction = " Write every answer in " + languageName(lang) + "."
+	}
+
+	return fmt.Sprintf(`Answer the question using ONLY the sources below. Organize the answer by source: for each source that contains relevant information, state what that source says about the question. Skip sources that are not relevant.%s
+
+Respond with JSON only, as an array in this format:
+[{"source": "S1", "answer": "..."}]
+
+SOURCES:
+%s
+QUESTION: %s
+
+JSON:`, languageInstruction, sources.String(), question)
+}
+
+// snippetSections builds per-source sections from raw context when no LLM
+// is available
+func snippetSections(groups []*sourceGroup) []AnswerSection {
+	sections := make([]AnswerSection, 0, len(groups))
+	for _, group := range groups {
+		sections = append(sections, group.section(TruncateRunes(group.chunks[0].Chunk.ChunkText, 300)))
+	}
+	return sections
+}
+
+func sectionHeading(lang, citation string) string {
+	if lang == "fa" {
+		return "طبق " + citation + ":"
+	}
+	return "According to " + citation + ":"
+}
+
+// extractJSONArray strips code fences and surrounding prose from an LLM reply
+func extractJSONArray(s string) string {
+	start := strings.Index(s, "[")
+	end := strings.LastIndex(s, "]")
+	if start < 0 || end <= start {
+		return s
+	}
+	return s[start : end+1]
+}
@@ -0,0 +1,326 @@
+package adapters
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// maxCachedSessions caps how many sessions keep cached answers; the least
+// recently used session's answers go first
+const maxCachedSessions = 1000
+
+// condenseFillers are words dropped when condensing a question, so "what is
+// the capital" and "please tell me the capital" compare alike. Question
+// words other than "what", and negations, are kept, as they change what is
+// asked.
+var condenseFillers = map[string]bool{
+	"the": true, "a": true, "an": true, "of": true, "to": true, "in": true,
+	"on": true, "for": true, "with": true, "and": true, "is": true, "are": true,
+	"was": true, "were": true, "be": true, "do": true, "does": true, "did": true,
+	"can": true, "could": true, "would": true, "you": true, "please": true,
+	"tell": true, "me": true, "about": true, "i": true, "we": true, "what": true,
+	"را": true, "به": true, "از": true, "در": true, "که": true, "لطفا": true,
+}
+
+// SessionAnswers caches each chat session's answers by condensed question,
+// so a repeated or slightly rephrased question is answered without running
+// the pipeline again. Answers are only reused against the corpus version
+// they were given for; any document change invalidates them.
+type SessionAnswers struct {
+	Config *config.Config
+
+	mu       sync.Mutex
+	sessions map[string]*cachedSession
+}
+
+type cachedSession struct {
+	answers []cachedAnswer
+	used    time.Time
+}
+
+type cachedAnswer struct {
+	terms         []string
+	options       string
+	corpusVersion string
+	response      SimpleRAGResponse
+	stored        time.Time
+}
+
+func NewSessionAnswers(cfg *config.Config) *SessionAnswers {
+	return &SessionAnswers{Config: cfg, sessions: make(map[string]*cachedSession)}
+}
+
+// enabled reports whether answers are cached; nil-safe
+func (s *SessionAnswers) enabled() bool {
+	return s != nil && s.Config != nil && s.Config.SessionCacheSize > 0
+}
+
+// condenseQuestion reduces a question to its sorted distinct terms, without
+// punctuation, case or filler words
+func condenseQuestion(question string) []string {
+	words := strings.FieldsFunc(strings.ToLower(question), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+	seen := make(map[string]bool, len(words))
+	var terms []string
+	for _, word := range words {
+		if condenseFillers[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// termSimilarity is the Jaccard similarity of two sorted term lists
+func termSimilarity(a, b []string) float64 {
+	shared, i, j := 0, 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			shared++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+// answerOptions is the part of the query options an answer depends on
+func answerOptions(opts QueryOptions) string {
+	return fmt.Sprintf("%t|%s|%s", opts.CrossLingual, opts.TranslateTo, opts.AnswerLanguage)
+}
+
+// Lookup returns a copy of the session's closest cached answer to question
+// for corpusVersion, flagged Cached, or nil. Answers for other corpus
+// versions or past SessionCacheTTL are dropped on the way.
+func (s *SessionAnswers) Lookup(sessionID, question string, opts QueryOptions, corpusVersion string) *SimpleRAGResponse {
+	if !s.enabled() {
+		return nil
+	}
+	terms := condenseQuestion(question)
+	if len(terms) == 0 {
+		return nil
+	}
+	options := answerOptions(opts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return nil
+	}
+
+	var best *cachedAnswer
+	bestSimilarity := 0.0
+	kept := session.answers[:0]
+	for _, answer := range session.answers {
+		if answer.corpusVersion != corpusVersion || (s.Config.SessionCacheTTL > 0 && time.Since(answer.stored) > s.Config.SessionCacheTTL) {
+			continue
+		}
+		kept = append(kept, answer)
+	}
+	session.answers = kept
+	// Newest first, so ties go to the latest answer
+	for i := len(session.answers) - 1; i >= 0; i-- {
+		answer := &session.answers[i]
+		if answer.options != options {
+			continue
+		}
+		if similarity := termSimilarity(terms, answer.terms); similarity > bestSimilarity {
+			best, bestSimilarity = answer, similarity
+		}
+	}
+	if best == nil || bestSimilarity < s.Config.SessionCacheSimilarity {
+		return nil
+	}
+
+	session.used = time.Now()
+	response := best.response
+	response.Cached = true
+	return &response
+}
+
+// Store caches an answer the session got for question. Refusals, and
+// answers without a corpus version to check them against, aren't cached.
+// Answers stored as session messages are referenced by their MessageID
+// when reused.
+func (s *SessionAnswers) Store(sessionID, question string, opts QueryOptions, response *SimpleRAGResponse) {
+	if !s.enabled() || response.Refusal != "" || response.CorpusVersion == "" {
+		return
+	}
+	terms := condenseQuestion(question)
+	if len(terms) == 0 {
+		return
+	}
+
+	answer := cachedAnswer{
+		terms:         terms,
+		options:       answerOptions(opts),
+		corpusVersion: response.CorpusVersion,
+		response:      *response,
+		stored:        time.Now(),
+	}
+	// Per-request details don't carry over to a cached answer
+	answer.response.Debug = nil
+	answer.response.LatencyBudget = nil
+	answer.response.MessageID = ""
+	if response.MessageID != "" && response.RepeatOf == nil {
+		answer.response.RepeatOf = &EarlierAnswer{
+			MessageID:  response.MessageID,
+			Question:   question,
+			AnsweredAt: dbNow(),
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		if len(s.sessions) >= maxCachedSessions {
+			s.evictLeastRecent()
+		}
+		session = &cachedSession{}
+		s.sessions[sessionID] = session
+	}
+	session.used = time.Now()
+	session.answers = append(session.answers, answer)
+	if excess := len(session.answers) - s.Config.SessionCacheSize; excess > 0 {
+		session.answers = append([]cachedAnswer(nil), session.answers[excess:]...)
+	}
+}
+
+// evictLeastRecent drops the least recently used session; s.mu is held
+func (s *SessionAnswers) evictLeastRecent() {
+	var oldest string
+	var oldestUsed time.Time
+	for id, session := range s.sessions {
+		if oldest == "" || session.used.Before(oldestUsed) {
+			oldest, oldestUsed = id, session.used
+		}
+	}
+	delete(s.sessions, oldest)
+}
+
+// Forget drops a session's cached answers
+func (s *SessionAnswers) Forget(sessionID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionID)
+}
+
+// Clear drops every cached answer
+func (s *SessionAnswers) Clear() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]*cachedSession)
+}
+
+// CachedAnswer looks up the session's cached answer to question against the
+// current corpus version
+func (r *SimpleRAGService) CachedAnswer(sessionID, question string, opts QueryOptions) *SimpleRAGResponse {
+	if !r.SessionAnswers.enabled() {
+		return nil
+	}
+	version, err := r.PinCorpus()
+	if err != nil {
+		log.Printf("Warning: failed to check corpus version for cached answers: %v", err)
+		return nil
+	}
+	return r.SessionAnswers.Lookup(sessionID, question, opts, version)
+}
+
+// EarlierAnswer is the session message a repeated question's answer was
+// first given in
+type EarlierAnswer struct {
+	MessageID  string    `json:"message_id"`
+	Question   string    `json:"question"`
+	AnsweredAt time.Time `json:"answered_at"`
+}
+
+// EarlierAnswer searches the session's latest SessionHistoryLookback
+// messages for an answer to an alike question, given against the
+// current corpus version, and returns it flagged Cached with RepeatOf
+// set, or nil. Answers translated, retrieved cross-lingually or forced into
+// a language aren't recorded as such, so those requests are never matched.
+func (r *SimpleRAGService) EarlierAnswer(sessionID, question string, opts QueryOptions) *SimpleRAGResponse {
+	lookback := r.Config.SessionHistoryLookback
+	if lookback <= 0 || opts.CrossLingual || opts.TranslateTo != "" || opts.AnswerLanguage != "" {
+		return nil
+	}
+	terms := condenseQuestion(question)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	messages, err := r.DatabaseSchema.RecentChatMessages(sessionID, lookback)
+	if err != nil {
+		log.Printf("Warning: failed to read session history for repeated questions: %v", err)
+		return nil
+	}
+	version, err := r.PinCorpus()
+	if err != nil {
+		log.Printf("Warning: failed to check corpus version for earlier answers: %v", err)
+		return nil
+	}
+
+	// Newest first: each user message is answered by the assistant
+	// message seen just before it
+	var answer *ChatMessage
+	for i := range messages {
+		message := &messages[i]
+		if message.Role == "assistant" {
+			answer = message
+			continue
+		}
+		if answer == nil || answer.CorpusVersion != version {
+			answer = nil
+			continue
+		}
+		if termSimilarity(terms, condenseQuestion(message.Content)) >= r.Config.SessionCacheSimilarity {
+			var sources []string
+			if err := json.Unmarshal([]byte(answer.Sources), &sources); err != nil {
+				sources = nil
+			}
+			return &SimpleRAGResponse{
+				Answer:        answer.Content,
+				Sources:       sources,
+				Confidence:    answer.Confidence,
+				Direction:     TextDirection(answer.Content),
+				CorpusVersion: answer.CorpusVersion,
+				Cached:        true,
+				RepeatOf: &EarlierAnswer{
+					MessageID:  answer.ID,
+					Question:   message.Content,
+					AnsweredAt: answer.CreatedAt,
+				},
+			}
+		}
+		answer = nil
+	}
+	return nil
+}
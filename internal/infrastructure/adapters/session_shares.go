@@ -0,0 +1,143 @@
+package adapters
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxShareTTL caps how long a share link can stay valid
+const maxShareTTL = 30 * 24 * time.Hour
+
+var (
+	ErrShareTTL     = fmt.Errorf("share links can last at most %d days", int(maxShareTTL.Hours()/24))
+	ErrShareExpired = errors.New("share link has expired")
+	ErrShareRevoked = errors.New("share link has been revoked")
+)
+
+// SharedSession is the read-only view of a session behind a share link
+type SharedSession struct {
+	Title     string          `json:"title"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	Messages  []SharedMessage `json:"messages"`
+}
+
+// SharedMessage is a message with its sources resolved to citations
+type SharedMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Confidence float64    `json:"confidence,omitempty"`
+	Citations  []Citation `json:"citations,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Citation is a cited document with a link that downloads it
+type Citation struct {
+	DocumentID  string `json:"document_id,omitempty"`
+	Filename    string `json:"filename"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// ShareSession creates a read-only link to a session that expires after
+// ttl. The token is only stored hashed, so this is the one chance to see it.
+func (r *SimpleRAGService) ShareSession(sessionID string, ttl time.Duration) (*SessionShareRecord, string, error) {
+	if _, err := r.DatabaseSchema.GetChatSession(sessionID); err != nil {
+		return nil, "", err
+	}
+	if ttl <= 0 {
+		ttl = r.Config.ShareLinkTTL
+	}
+	if ttl > maxShareTTL {
+		return nil, "", ErrShareTTL
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	token := "shr_" + hex.EncodeToString(secret)
+
+	share := &SessionShareRecord{
+		ID:        fmt.Sprintf("share_%d", time.Now().UnixNano()),
+		SessionID: sessionID,
+		ExpiresAt: dbNow().Add(ttl),
+	}
+	if err := r.DatabaseSchema.InsertSessionShare(share, hashShareToken(token), ttl); err != nil {
+		return nil, "", fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	return share, token, nil
+}
+
+// OpenSharedSession returns the session a share token grants access to
+func (r *SimpleRAGService) OpenSharedSession(token string) (*SharedSession, error) {
+	share, err := r.DatabaseSchema.GetSessionShareByTokenHash(hashShareToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if share.RevokedAt != nil {
+		return nil, ErrShareRevoked
+	}
+	if share.Expired {
+		return nil, ErrShareExpired
+	}
+
+	session, err := r.DatabaseSchema.GetChatSession(share.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := r.DatabaseSchema.GetChatMessages(share.SessionID, 1000, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat messages: %w", err)
+	}
+
+	shared := &SharedSession{
+		Title:     session.Title,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: share.ExpiresAt,
+		Messages:  make([]SharedMessage, 0, len(messages)),
+	}
+	for _, msg := range messages {
+		shared.Messages = append(shared.Messages, SharedMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Confidence: msg.Confidence,
+			Citations:  citations(msg.Sources, r.Links),
+			CreatedAt:  msg.CreatedAt,
+		})
+	}
+	return shared, nil
+}
+
+// citations parses a message's stored sources ("documentId|filename" or a
+// bare filename) into citations with download links signed by links
+func citations(sourcesJSON string, links *LinkSigner) []Citation {
+	var sources []string
+	if err := json.Unmarshal([]byte(sourcesJSON), &sources); err != nil {
+		return nil
+	}
+
+	var result []Citation
+	for _, source := range sources {
+		if source == "" {
+			continue
+		}
+		parsed := ParseSource(source)
+		result = append(result, Citation{
+			DocumentID:  parsed.DocumentID,
+			Filename:    parsed.Filename,
+			DownloadURL: links.DownloadURL(parsed.DocumentID, parsed.Filename),
+		})
+	}
+	return result
+}
+
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
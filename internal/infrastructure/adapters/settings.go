@@ -0,0 +1,244 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// ErrInvalidSetting wraps errors in a settings update
+var ErrInvalidSetting = errors.New("invalid setting")
+
+// Settings is what a settings page shows: the LLM in use, the answer
+// language, retrieval parameters, feature flags and storage
+type Settings struct {
+	LLM       LLMSettings       `json:"llm"`
+	Language  string            `json:"language"`
+	Retrieval RetrievalSettings `json:"retrieval"`
+	Flags     []FlagState       `json:"flags"`
+	Storage   *StorageUsage     `json:"storage"`
+	// Overrides are the settings changed through the settings API, by
+	// environment variable; they take precedence over CONFIG_FILE and the
+	// environment
+	Overrides map[string]string `json:"overrides"`
+}
+
+// LLMSettings describe the configured provider; changing it needs a
+// restart, so it is read-only
+type LLMSettings struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// RetrievalSettings are the writable retrieval and answer parameters
+type RetrievalSettings struct {
+	CrossLingual            bool    `json:"cross_lingual"`
+	LanguageBoost           float64 `json:"language_boost"`
+	TransliterationMatching bool    `json:"transliteration_matching"`
+	ScoringExpression       string  `json:"scoring_expression"`
+	VectorWeight            float64 `json:"vector_weight"`
+	MinChunkLength          int     `json:"min_chunk_length"`
+	CrossLingualMinScore    float64 `json:"cross_lingual_min_score"`
+	MinConfidence           float64 `json:"min_confidence"`
+	ConfidenceBands         string  `json:"confidence_bands"`
+	ConfidenceWeights       string  `json:"confidence_weights"`
+	CitationMode            string  `json:"citation_mode"`
+}
+
+// SettingsUpdate changes settings; a null retrieval value or an empty
+// language drops its override. Flags are overridden as through
+// PUT /admin/flags/:name.
+type SettingsUpdate struct {
+	Language  *string                `json:"language"`
+	Retrieval map[string]interface{} `json:"retrieval"`
+	Flags     map[string]bool        `json:"flags"`
+}
+
+// Kinds of setting values
+const (
+	settingBool   = "bool"
+	settingInt    = "int"
+	settingFloat  = "float"
+	settingString = "string"
+)
+
+type retrievalSetting struct {
+	key  string
+	kind string
+}
+
+// retrievalSettings maps RetrievalSettings' fields to the environment
+// variables they override
+var retrievalSettings = map[string]retrievalSetting{
+	"cross_lingual":            {"RETRIEVAL_CROSS_LINGUAL", settingBool},
+	"language_boost":           {"RETRIEVAL_LANGUAGE_BOOST", settingFloat},
+	"transliteration_matching": {"TRANSLITERATION_MATCHING", settingBool},
+	"scoring_expression":       {"SCORING_EXPRESSION", settingString},
+	"vector_weight":            {"VECTOR_WEIGHT", settingFloat},
+	"min_chunk_length":         {"MIN_CHUNK_LENGTH", settingInt},
+	"cross_lingual_min_score":  {"CROSS_LINGUAL_MIN_SCORE", settingFloat},
+	"min_confidence":           {"REFUSAL_MIN_CONFIDENCE", settingFloat},
+	"confidence_bands":         {"CONFIDENCE_BANDS", settingString},
+	"confidence_weights":       {"CONFIDENCE_WEIGHTS", settingString},
+	"citation_mode":            {"CITATION_MODE", settingString},
+}
+
+// Settings collects the current settings
+func (r *SimpleRAGService) Settings(ctx context.Context) (*Settings, error) {
+	storage, err := r.GetStorageUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := r.DatabaseSchema.GetSettingOverrides()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load setting overrides: %w", err)
+	}
+
+	cfg := r.Config
+	llm := LLMSettings{Provider: strings.ToLower(cfg.LLMProvider), Enabled: r.canGenerate()}
+	switch llm.Provider {
+	case "google":
+		llm.Model = cfg.GoogleModel
+	case "ollama", "":
+		llm.Provider, llm.Model = "ollama", cfg.OllamaModel
+	}
+
+	return &Settings{
+		LLM:      llm,
+		Language: cfg.AppLanguage,
+		Retrieval: RetrievalSettings{
+			CrossLingual:            cfg.RetrievalCrossLingual,
+			LanguageBoost:           cfg.RetrievalLanguageBoost,
+			TransliterationMatching: cfg.TransliterationMatching,
+			ScoringExpression:       cfg.ScoringExpression,
+			VectorWeight:            cfg.VectorWeight,
+			MinChunkLength:          cfg.MinChunkLength,
+			CrossLingualMinScore:    cfg.CrossLingualMinScore,
+			MinConfidence:           cfg.RefusalMinConfidence,
+			ConfidenceBands:         cfg.ConfidenceBands,
+			ConfidenceWeights:       cfg.ConfidenceWeights,
+			CitationMode:            cfg.CitationMode,
+		},
+		Flags:     r.Flags.List(),
+		Storage:   storage,
+		Overrides: overrides,
+	}, nil
+}
+
+// UpdateSettings checks and stores an update's overrides and flags. The
+// overrides take effect once the configuration is read again, see
+// LoadSettingOverrides.
+func (r *SimpleRAGService) UpdateSettings(update SettingsUpdate) error {
+	set := make(map[string]string)
+	var reset []string
+
+	if update.Language != nil {
+		switch language := strings.TrimSpace(*update.Language); language {
+		case "":
+			reset = append(reset, "APP_LANGUAGE")
+		case "en", "fa":
+			set["APP_LANGUAGE"] = language
+		default:
+			return fmt.Errorf("%w: language must be \"en\" or \"fa\"", ErrInvalidSetting)
+		}
+	}
+
+	names := make([]string, 0, len(update.Retrieval))
+	for name := range update.Retrieval {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		setting, ok := retrievalSettings[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown retrieval setting %q", ErrInvalidSetting, name)
+		}
+		value := update.Retrieval[name]
+		if value == nil {
+			reset = append(reset, setting.key)
+			continue
+		}
+		text, err := formatSetting(setting.kind, value)
+		if err != nil {
+			return fmt.Errorf("%w: retrieval.%s %v", ErrInvalidSetting, name, err)
+		}
+		set[setting.key] = text
+	}
+	if mode, ok := set["CITATION_MODE"]; ok && !ValidCitationMode(mode) {
+		return fmt.Errorf("%w: retrieval.citation_mode must be off, reject or regenerate", ErrInvalidSetting)
+	}
+	if expression := set["SCORING_EXPRESSION"]; strings.TrimSpace(expression) != "" {
+		if _, err := CompileScoringExpression(expression); err != nil {
+			return fmt.Errorf("%w: retrieval.scoring_expression: %v", ErrInvalidSetting, err)
+		}
+	}
+
+	for name := range update.Flags {
+		if !r.Flags.Known(name) {
+			return fmt.Errorf("%w: unknown feature flag %q", ErrInvalidSetting, name)
+		}
+	}
+
+	for key, value := range set {
+		if err := r.DatabaseSchema.SetSettingOverride(key, value); err != nil {
+			return fmt.Errorf("failed to store %s: %w", key, err)
+		}
+	}
+	for _, key := range reset {
+		if err := r.DatabaseSchema.DeleteSettingOverride(key); err != nil {
+			return fmt.Errorf("failed to reset %s: %w", key, err)
+		}
+	}
+	for name, enabled := range update.Flags {
+		if err := r.Flags.Set(name, enabled); err != nil {
+			return err
+		}
+	}
+	_, err := r.LoadSettingOverrides()
+	return err
+}
+
+// LoadSettingOverrides hands the stored overrides to the configuration, to
+// apply on its next read, and returns how many there are
+func (r *SimpleRAGService) LoadSettingOverrides() (int, error) {
+	overrides, err := r.DatabaseSchema.GetSettingOverrides()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load setting overrides: %w", err)
+	}
+	config.SetOverrides(overrides)
+	return len(overrides), nil
+}
+
+// formatSetting writes a JSON value as its environment variable would hold
+// it
+func formatSetting(kind string, value interface{}) (string, error) {
+	switch kind {
+	case settingBool:
+		if b, ok := value.(bool); ok {
+			return strconv.FormatBool(b), nil
+		}
+		return "", errors.New("must be true or false")
+	case settingInt:
+		if n, ok := value.(float64); ok && n == math.Trunc(n) && n >= 0 {
+			return strconv.Itoa(int(n)), nil
+		}
+		return "", errors.New("must be a whole number")
+	case settingFloat:
+		if n, ok := value.(float64); ok && n >= 0 {
+			return strconv.FormatFloat(n, 'f', -1, 64), nil
+		}
+		return "", errors.New("must be a number")
+	default:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return "", errors.New("must be a string")
+	}
+}
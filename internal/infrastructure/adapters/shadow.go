@@ -0,0 +1,267 @@
+package adapters
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+const (
+	// shadowCapacity is how many recent comparisons are kept
+	shadowCapacity = 100
+	// maxShadowRuns caps concurrent shadow runs; sampled queries arriving
+	// while that many are running are skipped instead of queueing
+	maxShadowRuns = 4
+	// shadowTimeout bounds a shadow run, which outlives its request
+	shadowTimeout = 30 * time.Second
+)
+
+// ShadowRetriever is an experimental retrieval pipeline run in shadow next
+// to the live one. It ranks the chunks the live pipeline scored, best first.
+type ShadowRetriever interface {
+	Name() string
+	Retrieve(ctx context.Context, question, questionLanguage string, crossLingual bool, chunks []ChunkRecord) ([]ScoredChunk, error)
+}
+
+// ShadowComparison is one sampled query's live and shadow retrievals
+type ShadowComparison struct {
+	Question     string   `json:"question"`
+	Pipeline     string   `json:"pipeline"`
+	LiveChunks   []string `json:"live_chunks"`
+	ShadowChunks []string `json:"shadow_chunks"`
+	// Overlap is the share of the live chunks the shadow also returned
+	Overlap  float64 `json:"overlap"`
+	TopMatch bool    `json:"top_match"`
+	LiveMs   int64   `json:"live_ms"`
+	ShadowMs int64   `json:"shadow_ms"`
+	Error    string  `json:"error,omitempty"`
+	At       string  `json:"at"`
+}
+
+// ShadowStatus summarizes shadow testing for the admin API
+type ShadowStatus struct {
+	Pipeline   string  `json:"pipeline,omitempty"`
+	SampleRate float64 `json:"sample_rate"`
+	Runs       int     `json:"runs"`
+	// Skipped counts sampled queries dropped while maxShadowRuns were busy
+	Skipped      int                `json:"skipped"`
+	Errors       int                `json:"errors"`
+	MeanOverlap  float64            `json:"mean_overlap"`
+	TopMatchRate float64            `json:"top_match_rate"`
+	Recent       []ShadowComparison `json:"recent"`
+}
+
+// Shadow mirrors a sample of live queries to an experimental retrieval
+// pipeline and logs how its results compare, without touching responses
+type Shadow struct {
+	mu         sync.Mutex
+	retriever  ShadowRetriever
+	sampleRate float64
+	running    chan struct{}
+
+	entries []ShadowComparison
+	next    int
+	full    bool
+
+	runs, skipped, errors, topMatches int
+	overlap                           float64
+}
+
+func NewShadow(cfg *config.Config, r *SimpleRAGService) *Shadow {
+	s := &Shadow{
+		running: make(chan struct{}, maxShadowRuns),
+		entries: make([]ShadowComparison, shadowCapacity),
+	}
+	s.Configure(cfg, r)
+	return s
+}
+
+// Configure picks the shadow pipeline from cfg: SHADOW_SCORING_EXPRESSION
+// ranks with an alternative scoring expression. Without one, or with a
+// zero SHADOW_SAMPLE_RATE, nothing is mirrored.
+func (s *Shadow) Configure(cfg *config.Config, r *SimpleRAGService) {
+	var retriever ShadowRetriever
+	if cfg.ShadowSampleRate > 0 && strings.TrimSpace(cfg.ShadowScoringExpression) != "" {
+		expr, err := CompileScoringExpression(cfg.ShadowScoringExpression)
+		if err != nil {
+			log.Printf("Warning: invalid SHADOW_SCORING_EXPRESSION, shadow testing disabled: %v", err)
+		} else {
+			retriever = &scoringShadow{service: r, expr: expr}
+			log.Printf("✅ Shadow testing %s on %.0f%% of queries", retriever.Name(), cfg.ShadowSampleRate*100)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retriever = retriever
+	s.sampleRate = cfg.ShadowSampleRate
+}
+
+// Mirror runs the shadow pipeline on a sampled query in the background and
+// records how its top chunks compare with live, the live pipeline's
+func (s *Shadow) Mirror(question, questionLanguage string, crossLingual bool, chunks []ChunkRecord, live []ScoredChunk, liveTime time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	retriever, sampleRate := s.retriever, s.sampleRate
+	s.mu.Unlock()
+	if retriever == nil || rand.Float64() >= sampleRate {
+		return
+	}
+
+	select {
+	case s.running <- struct{}{}:
+	default:
+		s.mu.Lock()
+		s.skipped++
+		s.mu.Unlock()
+		return
+	}
+
+	comparison := ShadowComparison{
+		Question:   question,
+		Pipeline:   retriever.Name(),
+		LiveChunks: chunkIDs(live),
+		LiveMs:     liveTime.Milliseconds(),
+		At:         time.Now().UTC().Format(time.RFC3339),
+	}
+	go func() {
+		defer func() { <-s.running }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+		defer cancel()
+		start := time.Now()
+		shadow, err := retriever.Retrieve(ctx, question, questionLanguage, crossLingual, chunks)
+		comparison.ShadowMs = time.Since(start).Milliseconds()
+		if err != nil {
+			comparison.Error = err.Error()
+			log.Printf("Warning: shadow retrieval %s failed: %v", comparison.Pipeline, err)
+		} else {
+			if len(shadow) > len(live) {
+				shadow = shadow[:len(live)]
+			}
+			comparison.ShadowChunks = chunkIDs(shadow)
+			comparison.Overlap, comparison.TopMatch = compareRankings(comparison.LiveChunks, comparison.ShadowChunks)
+			log.Printf("Shadow %s: overlap %.2f, top match %t, live %dms, shadow %dms for %q",
+				comparison.Pipeline, comparison.Overlap, comparison.TopMatch, comparison.LiveMs, comparison.ShadowMs, question)
+		}
+		s.record(comparison)
+	}()
+}
+
+func chunkIDs(chunks []ScoredChunk) []string {
+	ids := make([]string, 0, len(chunks))
+	for _, scored := range chunks {
+		ids = append(ids, scored.Chunk.ID)
+	}
+	return ids
+}
+
+// compareRankings reports the share of live found in shadow, and whether
+// both put the same chunk first
+func compareRankings(live, shadow []string) (overlap float64, topMatch bool) {
+	if len(live) == 0 {
+		return 1, len(shadow) == 0
+	}
+	found := make(map[string]bool, len(shadow))
+	for _, id := range shadow {
+		found[id] = true
+	}
+	shared := 0
+	for _, id := range live {
+		if found[id] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(live)), len(shadow) > 0 && shadow[0] == live[0]
+}
+
+// record adds a comparison, dropping the oldest once full
+func (s *Shadow) record(comparison ShadowComparison) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[s.next] = comparison
+	s.next = (s.next + 1) % len(s.entries)
+	if s.next == 0 {
+		s.full = true
+	}
+	if comparison.Error != "" {
+		s.errors++
+		return
+	}
+	s.runs++
+	s.overlap += comparison.Overlap
+	if comparison.TopMatch {
+		s.topMatches++
+	}
+}
+
+// Status returns the totals since startup and the recent comparisons,
+// newest first
+func (s *Shadow) Status() ShadowStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := ShadowStatus{
+		SampleRate: s.sampleRate,
+		Runs:       s.runs,
+		Skipped:    s.skipped,
+		Errors:     s.errors,
+	}
+	if s.retriever != nil {
+		status.Pipeline = s.retriever.Name()
+	}
+	if s.runs > 0 {
+		status.MeanOverlap = s.overlap / float64(s.runs)
+		status.TopMatchRate = float64(s.topMatches) / float64(s.runs)
+	}
+
+	count := s.next
+	if s.full {
+		count = len(s.entries)
+	}
+	status.Recent = make([]ShadowComparison, 0, count)
+	for i := 1; i <= count; i++ {
+		status.Recent = append(status.Recent, s.entries[(s.next-i+len(s.entries))%len(s.entries)])
+	}
+	return status
+}
+
+// scoringShadow ranks chunks with an alternative scoring expression, such
+// as one weighting the vector similarity
+type scoringShadow struct {
+	service *SimpleRAGService
+	expr    *ScoringExpression
+}
+
+func (p *scoringShadow) Name() string {
+	return "scoring: " + p.expr.Source
+}
+
+func (p *scoringShadow) Retrieve(ctx context.Context, question, questionLanguage string, crossLingual bool, chunks []ChunkRecord) ([]ScoredChunk, error) {
+	questionWords := strings.Fields(strings.ToLower(question))
+	settings := p.service.settingsFor(ctx)
+	scored := make([]ScoredChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		score := p.service.scoreChunkWith(settings, p.expr, questionWords, chunk)
+		if !crossLingual {
+			score *= p.service.languagePreference(questionLanguage, chunk)
+		}
+		scored = append(scored, ScoredChunk{Chunk: chunk, Score: score})
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+	return scored, nil
+}
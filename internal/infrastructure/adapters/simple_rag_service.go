@@ -2,11 +2,15 @@ package adapters
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"rag-service/internal/infrastructure/config"
 )
@@ -17,19 +21,148 @@ type SimpleRAGService struct {
 	MySQLAdapter   *MySQLAdapter
 	PDFProcessor   *PDFProcessor
 	DatabaseSchema *DatabaseSchema
-	Config         *config.Config
+	Thumbnails     *ThumbnailRenderer
+	Flags          *FeatureFlags
+	Hooks          *Hooks
+	Widgets        *Widgets
+	APITokens      *APITokens
+	Moderation     *Moderation
+	Quotas         *Quotas
+	Notifications  *Notifications
+	SessionAnswers *SessionAnswers
+	Shadow         *Shadow
+	// Embedder makes the chunk and question vectors behind the "vector"
+	// score; nil ranks lexically only
+	Embedder Embedder
+	// Vectors caches Embedder's chunk vectors, see StartVectorIndex
+	Vectors *VectorIndex
+	// VectorHealth tracks Embedder outages, during which queries are
+	// ranked lexically
+	VectorHealth *VectorHealth
+	// Links signs the download links of cited documents
+	Links *LinkSigner
+	// Access batches the times documents are retrieved and downloaded
+	Access *AccessTracker
+	// Ingestions limits how many uploads each tenant indexes at once
+	Ingestions *TenantLimiter
+	Config     *config.Config
+	// settings is what the service derives from its reloadable settings,
+	// replaced whole by Reconfigure; see WithSettings
+	settings atomic.Pointer[serviceSettings]
+
+	// ingesting holds IDs of documents this process is still indexing, so
+	// stale-document recovery leaves them alone
+	ingesting sync.Map
+	// streams holds the open ingest streams by document ID
+	streams sync.Map
+	// pinnedVersions holds corpus versions already stored as snapshots
+	pinnedVersions sync.Map
+	// questionsWanted wakes the synthetic question generator
+	questionsWanted chan struct{}
+	// blobLocks serialize decisions about shared originals, see lockBlob
+	blobLocks [blobLockStripes]sync.Mutex
 }
 
 type SimpleRAGResponse struct {
-	Answer     string   `json:"answer"`
-	Sources    []string `json:"sources"`
-	Confidence float64  `json:"confidence"`
-	Context    string   `json:"context"`
+	Answer       string             `json:"answer"`
+	Sources      []string           `json:"sources"`
+	Confidence   float64            `json:"confidence"`
+	Context      string             `json:"context"`
+	Translations []QueryTranslation `json:"translations,omitempty"`
+	Translation  *AnswerTranslation `json:"translation,omitempty"`
+	Direction    string             `json:"direction"`
+	Sections     []AnswerSection    `json:"sections,omitempty"`
+	TableSlice   string             `json:"table_slice,omitempty"`
+	NumericCheck *NumericCheck      `json:"numeric_check,omitempty"`
+	// CitationCheck reports the answer's inline citations when a citation
+	// mode applies
+	CitationCheck *CitationCheck `json:"citation_check,omitempty"`
+	Debug         *DebugTrace    `json:"debug,omitempty"`
+	// CorpusVersion identifies the document set the answer was given
+	// against; its snapshot is CorpusSnapshotID(CorpusVersion)
+	CorpusVersion string `json:"corpus_version,omitempty"`
+	// ConfidenceBand names the configured band Confidence falls in
+	ConfidenceBand string `json:"confidence_band,omitempty"`
+	// Warning cautions about an answer in a "warn" confidence band
+	Warning string `json:"warning,omitempty"`
+	// Refusal is the reason the service declined to answer, if it did
+	Refusal string `json:"refusal,omitempty"`
+	// LatencyBudget reports what was skipped to meet the request's
+	// max_latency_ms
+	LatencyBudget *LatencyBudget `json:"latency_budget,omitempty"`
+	// Moderation lists what the moderation filter flagged when its action
+	// is "flag"
+	Moderation []ModerationResult `json:"moderation,omitempty"`
+	// Cached means the answer was reused from an earlier, alike question in
+	// the same chat session
+	Cached bool `json:"cached,omitempty"`
+	// QueryID identifies the stored query, for rating it through
+	// PUT /queries/:id/rating
+	QueryID string `json:"query_id,omitempty"`
+	// MessageID is the answer's message in its chat session
+	MessageID string `json:"message_id,omitempty"`
+	// RepeatOf is the session's earlier answer a repeated question got
+	// again
+	RepeatOf *EarlierAnswer `json:"repeat_of,omitempty"`
+	// StandaloneQuestion is what a stateless chat follow-up was rewritten
+	// into for retrieval, see ChatRAG
+	StandaloneQuestion string `json:"standalone_question,omitempty"`
+	// Timings splits the time the answer took by stage
+	Timings *Timings `json:"timings,omitempty"`
+	// Queue reports the answer's wait for generation slots, when it had to
+	// wait
+	Queue *QueueWait `json:"queue,omitempty"`
+	// Degraded lists what the answer had to do without, such as vector
+	// search during an outage, see DegradedVectorSearch
+	Degraded []string `json:"degraded,omitempty"`
+	// QuestionType is how the question was routed when it wasn't answered
+	// from the documents, see ClassifyQuestion
+	QuestionType string `json:"question_type,omitempty"`
+
+	// chunks are the retrieved chunks the context was built from
+	chunks []ScoredChunk
+	// sourceDetails are Sources with pages and scores, see Structured
+	sourceDetails []Source
 }
 
+// QueryTranslation records a translated question used for cross-lingual
+// retrieval and how many context chunks it contributed
+type QueryTranslation struct {
+	Language       string `json:"language"`
+	Question       string `json:"question"`
+	EvidenceChunks int    `json:"evidence_chunks"`
+}
+
+// maxContextRunes caps the context sent to the LLM
+const maxContextRunes = 12000
+
+// minContextScore is the score a chunk needs to be included in the context
+const minContextScore = 0.2
+
 type ScoredChunk struct {
 	Chunk ChunkRecord
 	Score float64
+	// MatchedLanguage is set when a translated question produced the score
+	MatchedLanguage string
+}
+
+// QueryOptions carries per-request settings for Query
+type QueryOptions struct {
+	// CrossLingual disables the preference for chunks in the question's language
+	CrossLingual bool
+	// TranslateTo translates the answer and cited snippets into this language
+	TranslateTo string
+	// AnswerMode selects the answer layout; AnswerModeBySource returns one
+	// section per cited document
+	AnswerMode string
+	// Flags overrides feature flags for this request only
+	Flags map[string]bool
+	// MaxLatency, when set, skips optional stages and cuts the context to
+	// answer within it, see LatencyBudget
+	MaxLatency time.Duration
+	// AnswerLanguage, "en" or "fa", forces the answer, refusals and warnings
+	// into that language instead of the question's or APP_LANGUAGE
+	AnswerLanguage string
 }
 
 func NewSimpleRAGService(
@@ -38,28 +171,166 @@ func NewSimpleRAGService(
 	mysqlAdapter *MySQLAdapter,
 	cfg *config.Config,
 ) *SimpleRAGService {
-	return &SimpleRAGService{
+	databaseSchema := NewDatabaseSchema(mysqlAdapter.DB)
+	hooks := NewHooks(cfg)
+	pdfProcessor := NewPDFProcessor()
+	pdfProcessor.Hooks = hooks
+	pdfProcessor.MinChunkLength = cfg.MinChunkLength
+
+	r := &SimpleRAGService{
 		LLM:            llm,
 		MinIOAdapter:   minioAdapter,
 		MySQLAdapter:   mysqlAdapter,
-		PDFProcessor:   NewPDFProcessor(),
-		DatabaseSchema: NewDatabaseSchema(mysqlAdapter.DB),
+		PDFProcessor:   pdfProcessor,
+		DatabaseSchema: databaseSchema,
+		Thumbnails:     NewThumbnailRenderer(cfg.ThumbnailWidth),
+		Flags:          NewFeatureFlags(cfg, databaseSchema),
+		Hooks:          hooks,
+		Widgets:        NewWidgets(cfg, databaseSchema),
+		APITokens:      NewAPITokens(databaseSchema),
+		Moderation:     NewModeration(cfg, databaseSchema),
+		Quotas:         NewQuotas(cfg, databaseSchema),
+		Notifications:  NewNotifications(cfg, databaseSchema),
+		SessionAnswers: NewSessionAnswers(cfg),
+		Access:         NewAccessTracker(databaseSchema),
+		VectorHealth:   NewVectorHealth(cfg.VectorRetryAfter),
+		Links:          NewLinkSigner(cfg),
+		Ingestions:     NewTenantLimiter("ingestion", cfg.TenantMaxIngestions, cfg.TenantIngestionQueue),
 		Config:         cfg,
+
+		questionsWanted: make(chan struct{}, 1),
+	}
+	r.settings.Store(newServiceSettings(cfg, hooks))
+	r.Shadow = NewShadow(cfg, r)
+	if limited, ok := llm.(*LimitedLLMClient); ok {
+		limited.Tenants = NewTenantLimiter("generation", cfg.TenantMaxGenerations, cfg.TenantGenerationQueue)
+	}
+	return r
+}
+
+// compileScoring compiles SCORING_EXPRESSION, or returns nil for the
+// built-in formula
+func compileScoring(cfg *config.Config) *ScoringExpression {
+	if strings.TrimSpace(cfg.ScoringExpression) == "" {
+		return nil
+	}
+	expr, err := CompileScoringExpression(cfg.ScoringExpression)
+	if err != nil {
+		log.Printf("Warning: invalid SCORING_EXPRESSION, using the built-in formula: %v", err)
+		return nil
+	}
+	log.Printf("✅ Using scoring expression: %s", expr.Source)
+	return expr
+}
+
+// serviceSettings is what the service derives from its reloadable
+// settings. A published one is never changed; Reconfigure builds a new one.
+type serviceSettings struct {
+	// scoring replaces the built-in ranking formula when configured
+	scoring *ScoringExpression
+	// zoneWeights scale scores by the page zones a chunk's text comes from
+	zoneWeights map[string]float64
+	// confidenceWeights weigh the signals an answer's confidence combines
+	confidenceWeights map[string]float64
+	refusals          *RefusalPolicy
+	// pdf splits uploads into chunks, dropping those under MIN_CHUNK_LENGTH
+	pdf *PDFProcessor
+}
+
+func newServiceSettings(cfg *config.Config, hooks *Hooks) *serviceSettings {
+	return &serviceSettings{
+		scoring:           compileScoring(cfg),
+		zoneWeights:       ParseZoneWeights(cfg.PageZoneWeights),
+		confidenceWeights: ParseConfidenceWeights(cfg.ConfidenceWeights),
+		refusals:          NewRefusalPolicy(cfg),
+		pdf:               &PDFProcessor{Hooks: hooks, MinChunkLength: cfg.MinChunkLength},
+	}
+}
+
+type settingsKey struct{}
+
+// WithSettings pins the service's current settings to ctx, so a request
+// that spans a reload uses the same ones throughout. A ctx that already
+// has them is returned as is.
+func (r *SimpleRAGService) WithSettings(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(settingsKey{}).(*serviceSettings); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, settingsKey{}, r.settings.Load())
+}
+
+// settingsFor returns the settings pinned to ctx, else the current ones
+func (r *SimpleRAGService) settingsFor(ctx context.Context) *serviceSettings {
+	if settings, ok := ctx.Value(settingsKey{}).(*serviceSettings); ok {
+		return settings
 	}
+	return r.settings.Load()
 }
 
-func (r *SimpleRAGService) ProcessPDF(ctx context.Context, filename string, pdfData []byte) error {
+// ScoringSource is the configured scoring expression, "" for the built-in
+// formula
+func (r *SimpleRAGService) ScoringSource(ctx context.Context) string {
+	if expr := r.settingsFor(ctx).scoring; expr != nil {
+		return expr.Source
+	}
+	return ""
+}
+
+// Reconfigure rebuilds what the service derives from its reloadable
+// settings after Config.Apply changed them: the scoring expression, page
+// zone and confidence weights, refusal policy and messages, the minimum
+// chunk length, feature flag defaults, shadow testing, rate limits, quotas
+// and per-tenant limits. The derived settings are published as a new
+// snapshot, so requests already running keep the ones they pinned with
+// WithSettings.
+func (r *SimpleRAGService) Reconfigure() {
+	r.settings.Store(newServiceSettings(r.Config, r.Hooks))
+	r.Flags.Configure(r.Config)
+	r.Shadow.Configure(r.Config, r)
+	r.Widgets.SetDefaultRateLimit(r.Config.WidgetRateLimit)
+	r.Quotas.SetDefault(Quota{
+		Queries:     r.Config.QuotaMonthlyQueries,
+		Tokens:      r.Config.QuotaMonthlyTokens,
+		UploadBytes: r.Config.QuotaMonthlyUploadBytes,
+	})
+	r.Ingestions.Configure(r.Config.TenantMaxIngestions, r.Config.TenantIngestionQueue)
+	if limited, ok := r.LLM.(*LimitedLLMClient); ok {
+		limited.SetMaxWait(r.Config.LLMQueueTimeout)
+		limited.Tenants.Configure(r.Config.TenantMaxGenerations, r.Config.TenantGenerationQueue)
+	}
+}
+
+// ProcessPDF stores and indexes a PDF, optionally in a collection the
+// caller can write to
+func (r *SimpleRAGService) ProcessPDF(ctx context.Context, filename, collection string, pdfData []byte) error {
 	log.Printf("Processing PDF: %s", filename)
 
+	collection = strings.TrimSpace(collection)
+	if err := r.CheckCollectionAccess(ctx, collection, PermissionWrite); err != nil {
+		return err
+	}
+
+	// Indexing a large upload can take minutes, so the caller's other
+	// uploads wait for as long as they stay connected
+	release, err := r.Ingestions.Acquire(ctx, 0)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	metadata := DocumentMetadata{UploadedAt: time.Now().UTC().Format(time.RFC3339), Collection: collection}
+
 	// Generate unique document ID
 	documentID := fmt.Sprintf("doc_%d", time.Now().UnixNano())
 
-	// Store PDF in MinIO
-	bucketName := "documents"
-	objectName := fmt.Sprintf("%s/%s", documentID, filename)
-
-	err := r.MinIOAdapter.PutObject(ctx, bucketName, objectName, pdfData, "application/pdf")
-	if err != nil {
+	// Store PDF in MinIO, named by content so identical files share storage.
+	// The object stays locked until this document's row references it, so
+	// deleting another document sharing it can't remove it in between.
+	contentHash := ContentHash(pdfData)
+	objectName := blobObjectName(contentHash)
+	unlockBlob := r.lockBlob(objectName)
+	if err := r.storeBlob(ctx, objectName, pdfData); err != nil {
+		unlockBlob()
 		return fmt.Errorf("failed to store PDF in MinIO: %w", err)
 	}
 
@@ -69,83 +340,524 @@ func (r *SimpleRAGService) ProcessPDF(ctx context.Context, filename string, pdfD
 		Filename:         objectName,
 		OriginalFilename: filename,
 		FileSize:         int64(len(pdfData)),
+		ContentHash:      contentHash,
 		Status:           "processing",
 		ChunkCount:       0,
-		Metadata:         `{"uploaded_at": "` + time.Now().Format(time.RFC3339) + `"}`,
+		Metadata:         encodeJSON(metadata),
 	}
 
 	err = r.DatabaseSchema.InsertDocument(docRecord)
+	unlockBlob()
 	if err != nil {
 		return fmt.Errorf("failed to insert document record: %w", err)
 	}
+	r.recordEvent(documentID, DocumentEventUploaded, fmt.Sprintf("Uploaded %s (%d KB)", filename, len(pdfData)/1024))
+
+	// Thumbnail for the library view; a failure here shouldn't fail ingestion
+	if _, err := r.storeThumbnail(ctx, documentID, pdfData); err != nil {
+		log.Printf("Warning: failed to create thumbnail for %s: %v", filename, err)
+	}
+
+	r.ingesting.Store(documentID, true)
+	defer r.ingesting.Delete(documentID)
 
-	// Extract text chunks from PDF
-	chunks, err := r.PDFProcessor.ExtractTextFromPDF(pdfData, filename)
+	count, err := r.indexDocument(ctx, documentID, filename, pdfData)
+	if r.storeForOCR(documentID, err) {
+		log.Printf("No text extracted from PDF %s (Document ID: %s), stored for OCR", filename, documentID)
+		r.Notifications.Notify(notificationRecipient(ctx), NotificationDocumentNeedsOCR,
+			"Needs OCR: "+filename, fmt.Sprintf("No text could be extracted from %s, so it was stored for OCR instead of indexed.", filename), documentID)
+		return nil
+	}
 	if err != nil {
 		r.DatabaseSchema.UpdateDocumentStatus(documentID, "failed")
-		return fmt.Errorf("failed to extract text from PDF: %w", err)
+		r.recordEvent(documentID, DocumentEventFailed, "Processing failed: "+err.Error())
+		r.Notifications.Notify(notificationRecipient(ctx), NotificationDocumentFailed,
+			"Processing failed: "+filename, err.Error(), documentID)
+		return err
 	}
 
-	if len(chunks) == 0 {
-		r.DatabaseSchema.UpdateDocumentStatus(documentID, "failed")
-		return fmt.Errorf("no text chunks extracted from PDF")
+	log.Printf("Successfully processed %d chunks from PDF %s (Document ID: %s)", count, filename, documentID)
+	r.Notifications.Notify(notificationRecipient(ctx), NotificationDocumentProcessed,
+		"Document processed: "+filename, fmt.Sprintf("%s was indexed into %d chunks and can now be queried.", filename, count), documentID)
+	return nil
+}
+
+// DocumentStatusNeedsOCR marks a stored document without extractable text
+// under EMPTY_EXTRACTION_POLICY=needs_ocr
+const DocumentStatusNeedsOCR = "needs_ocr"
+
+// ErrNoText means a PDF produced no text chunks, typically because its
+// pages are scanned images
+var ErrNoText = errors.New("no text chunks extracted from PDF; it may be scanned or image-only and need OCR")
+
+// storeForOCR marks the document needs_ocr when indexing failed with
+// ErrNoText and EMPTY_EXTRACTION_POLICY keeps such documents, reporting
+// whether it did
+func (r *SimpleRAGService) storeForOCR(documentID string, err error) bool {
+	if !errors.Is(err, ErrNoText) || r.Config == nil || !strings.EqualFold(r.Config.EmptyExtractionPolicy, DocumentStatusNeedsOCR) {
+		return false
 	}
+	if err := r.DatabaseSchema.UpdateDocumentStatus(documentID, DocumentStatusNeedsOCR); err != nil {
+		log.Printf("Warning: failed to update document status: %v", err)
+		return false
+	}
+	r.recordEvent(documentID, DocumentEventNeedsOCR, "No text could be extracted, so the PDF was stored for OCR instead of indexed")
+	return true
+}
 
-	// Store chunks in MySQL
-	for i, chunk := range chunks {
-		chunkRecord := &ChunkRecord{
-			ID:         chunk.ChunkID,
-			DocumentID: documentID,
-			ChunkText:  chunk.Text,
-			PageNumber: chunk.Page,
-			ChunkIndex: i,
-			WordCount:  len(strings.Fields(chunk.Text)),
-			Metadata:   `{"page": ` + fmt.Sprintf("%d", chunk.Page) + `, "chunk_index": ` + fmt.Sprintf("%d", i) + `}`,
+// indexDocument extracts, chunks and stores a document's text, then marks it
+// completed. It returns the number of chunks stored.
+//
+// Each run stores its chunks under a new version, keyed by version and
+// index, and only commits that version once every chunk is stored, so
+// retries after a crash neither duplicate chunks nor let reads see a mix
+// of two runs.
+func (r *SimpleRAGService) indexDocument(ctx context.Context, documentID, filename string, pdfData []byte) (int, error) {
+	version, err := r.DatabaseSchema.NextChunkVersion(documentID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate chunk version: %w", err)
+	}
+
+	// Post-chunk hooks see the whole document's chunks, so those are held
+	// until extraction ends; otherwise each page is stored as it is extracted
+	buffered := r.Hooks.Has(HookPostChunk)
+	var pending []PDFChunk
+	pendingBytes := 0
+	pages, stored, embedded := 0, 0, 0
+	// The page text is kept too, so it can be served or chunked again
+	// without parsing the PDF
+	text := newPageTextWriter()
+	// A chunk that can't be stored fails the run, since committing the
+	// version without it would silently drop part of the document
+	var storeErr error
+	store := func(chunks []PDFChunk) error {
+		for _, chunk := range chunks {
+			ok, err := r.storeChunk(ctx, documentID, version, stored, chunk)
+			if err != nil {
+				storeErr = err
+				return err
+			}
+			if ok {
+				embedded++
+			}
+			stored++
 		}
+		return nil
+	}
 
-		err = r.DatabaseSchema.InsertChunk(chunkRecord)
+	_, err = r.settingsFor(ctx).pdf.ExtractPages(ctx, pdfData, filename, func(page ExtractedPage) error {
+		if err := text.Add(page.Number, page.Text); err != nil {
+			return err
+		}
+		pages++
+		pageChunks := page.Chunks
+		held := len(pdfData) + text.Len() + pendingBytes
+		for _, chunk := range pageChunks {
+			held += len(chunk.Text)
+		}
+		if r.Config != nil && r.Config.PDFMaxMemoryMB > 0 && held > r.Config.PDFMaxMemoryMB<<20 {
+			return fmt.Errorf("document needs more than PDF_MAX_MEMORY_MB (%d MB) to index", r.Config.PDFMaxMemoryMB)
+		}
+		if !buffered {
+			return store(pageChunks)
+		}
+		pending = append(pending, pageChunks...)
+		pendingBytes = held - len(pdfData) - text.Len()
+		return nil
+	})
+	if err != nil {
+		r.discardChunks(documentID, version, stored)
+		if storeErr != nil {
+			return 0, storeErr
+		}
+		return 0, fmt.Errorf("failed to extract text from PDF: %w", err)
+	}
+
+	if buffered {
+		chunks, err := r.runPostChunkHooks(ctx, filename, pending)
 		if err != nil {
-			log.Printf("Warning: failed to insert chunk record: %v", err)
+			r.discardChunks(documentID, version, stored)
+			return 0, err
+		}
+		if err := store(chunks); err != nil {
+			r.discardChunks(documentID, version, stored)
+			return 0, err
 		}
 	}
 
-	// Update document status and chunk count
-	err = r.DatabaseSchema.UpdateDocumentChunkCount(documentID, len(chunks))
+	if stored == 0 {
+		r.recordEvent(documentID, DocumentEventExtracted, fmt.Sprintf("Read %d pages but found no text to index", pages))
+		return 0, ErrNoText
+	}
+	r.storePageText(ctx, documentID, text)
+
+	// Switch reads to this version, with the chunk count and status
+	committed, err := r.DatabaseSchema.CommitChunkVersion(documentID, version, stored, "completed")
 	if err != nil {
-		log.Printf("Warning: failed to update chunk count: %v", err)
+		r.discardChunks(documentID, version, stored)
+		return 0, fmt.Errorf("failed to commit chunks: %w", err)
+	}
+	if !committed {
+		log.Printf("Warning: chunks of %s version %d were superseded by a later run", documentID, version)
+		r.recordEvent(documentID, DocumentEventSuperseded, "This run's chunks were replaced by a later run's")
+		return stored, nil
 	}
+	r.recordEvent(documentID, DocumentEventExtracted, fmt.Sprintf("Extracted text from %d pages into %d chunks", pages, stored))
+	r.wantSyntheticQuestions()
+	if r.Embedder != nil {
+		r.recordEvent(documentID, DocumentEventEmbedded, fmt.Sprintf("Embedded %d of %d chunks with %s", embedded, stored, r.Embedder.Name()))
+	}
+
+	return stored, nil
+}
+
+// storeChunk stores an extracted chunk as the index-th of the document's
+// given version, reporting whether it was embedded. The id is derived from
+// both, so storing it again replaces it. Only a failure to store the chunk
+// is an error; one to embed it leaves it to lexical search.
+func (r *SimpleRAGService) storeChunk(ctx context.Context, documentID string, version, index int, chunk PDFChunk) (bool, error) {
+	text, capped := sanitizeChunkText(chunk.Text)
+	if capped {
+		log.Printf("Warning: chunk %d of %s was cut to %d characters", index, documentID, maxChunkRunes)
+	}
+	chunk.Text = text
+	language, script := DetectLanguage(chunk.Text)
+	chunkRecord := &ChunkRecord{
+		ID:         fmt.Sprintf("%s_v%d_c%d", documentID, version, index),
+		DocumentID: documentID,
+		ChunkText:  chunk.Text,
+		PageNumber: chunk.Page,
+		ChunkIndex: index,
+		Version:    version,
+		WordCount:  len(strings.Fields(chunk.Text)),
+		Language:   language,
+		Script:     script,
+		ChunkType:  chunk.Type,
+		// Canonical amounts so "$1.2M" matches "1,200,000 dollars"
+		QuantityTerms: strings.Join(QuantityTerms(chunk.Text), " "),
+		Metadata:      encodeJSON(ChunkMetadata{Page: chunk.Page, ChunkIndex: index, Zones: chunk.Zones, Offset: chunk.Offset}),
+	}
+
+	if err := r.DatabaseSchema.InsertChunk(chunkRecord); err != nil {
+		return false, fmt.Errorf("failed to store chunk %d: %w", index, err)
+	}
+	return r.embedChunk(ctx, chunkRecord.ID, chunk.Text), nil
+}
+
+// discardChunks removes the chunks a failed indexing stored before failing
+func (r *SimpleRAGService) discardChunks(documentID string, version, stored int) {
+	if stored == 0 {
+		return
+	}
+	if err := r.DatabaseSchema.DeleteChunkVersion(documentID, version); err != nil {
+		log.Printf("Warning: failed to delete partial chunks of %s: %v", documentID, err)
+	}
+}
 
-	err = r.DatabaseSchema.UpdateDocumentStatus(documentID, "completed")
+func (r *SimpleRAGService) Query(ctx context.Context, question string, opts QueryOptions) (*SimpleRAGResponse, error) {
+	start := time.Now()
+	ctx = r.WithSettings(ctx)
+	timings := &Timings{}
+	ctx = WithTimings(ctx, timings)
+	queue := &QueueWait{}
+	ctx = WithQueueWait(ctx, queue)
+	degradation := &Degradation{}
+	ctx = WithDegradation(ctx, degradation)
+
+	if opts.AnswerLanguage != "" {
+		ctx = WithAnswerLanguage(ctx, opts.AnswerLanguage)
+	}
+
+	var budget *LatencyBudget
+	if opts.MaxLatency > 0 {
+		budget = NewLatencyBudget(opts.MaxLatency)
+		ctx = WithLatencyBudget(ctx, budget)
+	}
+
+	if r.Hooks.Has(HookPreRetrieval) {
+		payload := &HookPayload{Point: HookPreRetrieval, Question: question}
+		if err := r.Hooks.Run(ctx, payload); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(payload.Question) != "" {
+			question = payload.Question
+		}
+	}
+
+	questionCheck, err := r.Moderation.Review(ctx, ModerationQuestion, question, "")
 	if err != nil {
-		log.Printf("Warning: failed to update document status: %v", err)
+		return nil, err
 	}
 
-	log.Printf("Successfully processed %d chunks from PDF %s (Document ID: %s)", len(chunks), filename, documentID)
-	return nil
+	var response *SimpleRAGResponse
+	if questionCheck != nil && r.Moderation.Action == ModerationBlock {
+		questionLanguage, _ := DetectLanguage(question)
+		response = r.refuse(ctx, question, r.responseLanguage(ctx, questionLanguage), RefusalModerated, "")
+	} else if response, err = r.query(ctx, question, opts); err != nil {
+		return nil, err
+	}
+
+	if r.Hooks.Has(HookPostAnswer) {
+		payload := &HookPayload{
+			Point:      HookPostAnswer,
+			Question:   question,
+			Answer:     response.Answer,
+			Sources:    response.Sources,
+			Confidence: response.Confidence,
+		}
+		if err := r.Hooks.Run(ctx, payload); err != nil {
+			return nil, err
+		}
+		response.Answer = payload.Answer
+		response.Sources = payload.Sources
+		response.Confidence = payload.Confidence
+	}
+
+	// The service's own refusals don't need moderating
+	var answerCheck *ModerationResult
+	if response.Refusal == "" {
+		if answerCheck, err = r.Moderation.Review(ctx, ModerationAnswer, response.Answer, question); err != nil {
+			return nil, err
+		}
+	}
+	if answerCheck != nil && r.Moderation.Action == ModerationBlock {
+		questionLanguage, _ := DetectLanguage(question)
+		response = &SimpleRAGResponse{
+			Answer:        r.settingsFor(ctx).refusals.Message(RefusalModerated, r.responseLanguage(ctx, questionLanguage)),
+			Sources:       []string{},
+			Refusal:       RefusalModerated,
+			CorpusVersion: response.CorpusVersion,
+		}
+	}
+	if r.Moderation.Action == ModerationFlag {
+		for _, check := range []*ModerationResult{questionCheck, answerCheck} {
+			if check != nil {
+				response.Moderation = append(response.Moderation, *check)
+			}
+		}
+	}
+
+	response.Direction = TextDirection(response.Answer)
+
+	if opts.TranslateTo != "" && budget.Allow(StageTranslation, translationEstimate(response, opts.TranslateTo)) {
+		translationStart := time.Now()
+		r.translateResponse(ctx, response, opts.TranslateTo)
+		DebugTraceFromContext(ctx).AddStage("translation", time.Since(translationStart))
+		timings.AddLLM(time.Since(translationStart))
+	}
+
+	if budget != nil {
+		budget.Finish()
+		response.LatencyBudget = budget
+	}
+	timings.Finish(start)
+	response.Timings = timings
+	if queue.Queued() {
+		response.Queue = queue
+	}
+	response.Degraded = degradation.Reasons()
+	return response, nil
 }
 
-func (r *SimpleRAGService) Query(ctx context.Context, question string) (*SimpleRAGResponse, error) {
+func (r *SimpleRAGService) query(ctx context.Context, question string, opts QueryOptions) (*SimpleRAGResponse, error) {
 	log.Printf("Processing RAG query: %s", question)
 
-	// Check if we have any documents
-	documents, err := r.DatabaseSchema.GetDocuments(50, 0)
+	questionLanguage, _ := DetectLanguage(question)
+	lang := r.responseLanguage(ctx, questionLanguage)
+	crossLingual := opts.CrossLingual || (r.Config != nil && r.Config.RetrievalCrossLingual)
+	flags := r.Flags.Resolve(opts.Flags)
+	DebugTraceFromContext(ctx).SetFlags(flags)
+	bySource := opts.AnswerMode == AnswerModeBySource && flags[FlagBySourceAnswers]
+
+	if reason := r.settingsFor(ctx).refusals.CheckQuestion(question); reason != "" {
+		return r.refuse(ctx, question, lang, reason, ""), nil
+	}
+
+	// Small talk and questions about the service need no retrieval
+	if flags[FlagQuestionRouting] {
+		switch ClassifyQuestion(question) {
+		case QuestionSmallTalk:
+			return r.smallTalkReply(ctx, question, lang), nil
+		case QuestionMeta:
+			return r.metaAnswer(ctx, question, lang)
+		}
+	}
+
+	qc, err := r.retrieveContext(ctx, question, questionLanguage, crossLingual, flags[FlagCrossLingualFallback])
 	if err != nil {
-		return nil, fmt.Errorf("failed to get documents: %w", err)
+		return nil, err
 	}
+	if qc.refusal != "" {
+		return r.refuse(ctx, question, lang, qc.refusal, ""), nil
+	}
+	documents, questionWords, contextChunks, context := qc.documents, qc.questionWords, qc.chunks, qc.context
+	bestScore, translations := qc.bestScore, qc.translations
 
-	if len(documents) == 0 {
-		response := &SimpleRAGResponse{
-			Answer:     "I don't have any documents in my knowledge base yet. Please upload some PDF files first.",
-			Sources:    []string{},
-			Confidence: 0.0,
-			Context:    "",
+	budget := LatencyBudgetFromContext(ctx)
+	if budget != nil && r.canGenerate() {
+		contextChunks, context = r.fitContext(budget, lang, question, contextChunks, context)
+	}
+	r.retrievedDocuments(contextChunks)
+
+	// If LLM is disabled, return retrieval-only response using context
+	if r.Config != nil && strings.ToLower(r.Config.LLMProvider) == "none" {
+		trimmed := TruncateRunes(context, 1200)
+		answerText := trimmed
+		if lang == "fa" {
+			answerText = "حالت فقط بازیابی فعال است. بخش‌های مرتبط:\n" + trimmed
+		} else {
+			answerText = "Retrieval-only mode. Relevant context:\n" + trimmed
 		}
 
+		// Include multiple relevant sources with document ID for download
+		sources, sourceDetails := citeSources(r.getTopRelevantSources(ctx, questionWords, documents, 5), contextChunks)
+
+		// There is no generated answer to check against the context
+		breakdown := r.scoreConfidence(ctx, questionWords, bestScore, context, "")
+		DebugTraceFromContext(ctx).SetConfidence(breakdown)
+
+		response := &SimpleRAGResponse{
+			Answer:        answerText,
+			Sources:       sources,
+			Confidence:    breakdown.Confidence,
+			Context:       context,
+			Translations:  translations,
+			chunks:        contextChunks,
+			sourceDetails: sourceDetails,
+		}
+		if bySource {
+			response.Sections = snippetSections(groupBySource(contextChunks, documents))
+		}
+		if reason := r.settingsFor(ctx).refusals.CheckAnswer(response, lang); reason != "" {
+			refusal := r.refuse(ctx, question, lang, reason, context)
+			refusal.ConfidenceBand = response.ConfidenceBand
+			return refusal, nil
+		}
 		// Store query in database
 		r.storeQuery(ctx, question, response)
 		return response, nil
 	}
 
+	// Generate answer using LLM with context
+	var answer, tableSlice string
+	var sections []AnswerSection
+	var citationCheck *CitationCheck
+	generationStart := time.Now()
+	if bySource {
+		answer, sections, err = r.answerBySource(ctx, question, lang, groupBySource(contextChunks, documents))
+	} else if flags[FlagTablePrompt] && hasTableChunk(contextChunks) {
+		// Tables need exact cell values, so ask the model to quote the rows it used
+		answer, err = r.LLM.GenerateText(ctx, tablePrompt(lang, context, question))
+		answer, tableSlice = splitTableSlice(answer)
+	} else if mode := r.citationMode(contextChunks, documents); mode != CitationModeOff {
+		// Number the context so every claim can cite the chunk behind it
+		var cited int
+		context, cited = buildCitedContext(contextChunks)
+		answer, citationCheck, err = r.answerWithCitations(ctx, mode, lang, context, question, contextChunks[:cited])
+	} else {
+		answer, err = r.LLM.GenerateText(ctx, r.answerPrompt(lang, context, question))
+	}
+	DebugTraceFromContext(ctx).AddStage("generation", time.Since(generationStart))
+	TimingsFromContext(ctx).AddLLM(time.Since(generationStart))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate answer: %w", err)
+	}
+
+	// Check if the answer indicates lack of knowledge (EN + FA)
+	if strings.TrimSpace(answer) == "" || lacksInformation(answer) {
+		return r.refuse(ctx, question, lang, RefusalNoAnswer, context), nil
+	}
+	if citationCheck != nil && !citationCheck.Verified {
+		log.Printf("Warning: answer has %d uncited claims under citation mode %s", len(citationCheck.Uncited), citationCheck.Mode)
+		refusal := r.refuse(ctx, question, lang, RefusalMissingCitations, context)
+		refusal.CitationCheck = citationCheck
+		return refusal, nil
+	}
+
+	// Include multiple relevant sources with document ID for download
+	sources, sourceDetails := citeSources(r.getTopRelevantSources(ctx, questionWords, documents, 5), contextChunks)
+
+	answerBody := answer
+	if len(sections) > 0 {
+		// Section headings carry page numbers that aren't in the context
+		var texts []string
+		for _, section := range sections {
+			texts = append(texts, section.Text)
+		}
+		answerBody = strings.Join(texts, "\n")
+	}
+
+	// Weigh retrieval strength and how well the answer sticks to the context
+	breakdown := r.scoreConfidence(ctx, questionWords, bestScore, context, answerBody)
+	confidence := breakdown.Confidence
+
+	// Numbers the model returns should be quoted from the context, not invented
+	var numericCheck *NumericCheck
+	if flags[FlagNumericVerification] && r.Config != nil && isNumericQuestion(question) && budget.Allow(StageNumericVerification, 0) {
+		numericCheck = verifyNumbers(question, answerBody, context)
+		if numericCheck != nil && !numericCheck.Verified {
+			log.Printf("Warning: answer numbers %v not found in context", numericCheck.Missing)
+			confidence *= r.Config.NumericMismatchPenalty
+			breakdown.NumericPenalty = r.Config.NumericMismatchPenalty
+			breakdown.Confidence = confidence
+		}
+	}
+	DebugTraceFromContext(ctx).SetConfidence(breakdown)
+
+	response := &SimpleRAGResponse{
+		Answer:        answer,
+		Sources:       sources,
+		Confidence:    confidence,
+		Context:       context,
+		Translations:  translations,
+		Sections:      sections,
+		TableSlice:    tableSlice,
+		NumericCheck:  numericCheck,
+		CitationCheck: citationCheck,
+		chunks:        contextChunks,
+		sourceDetails: sourceDetails,
+	}
+	if reason := r.settingsFor(ctx).refusals.CheckAnswer(response, lang); reason != "" {
+		refusal := r.refuse(ctx, question, lang, reason, context)
+		refusal.ConfidenceBand = response.ConfidenceBand
+		return refusal, nil
+	}
+
+	// Store query in database
+	r.storeQuery(ctx, question, response)
+	return response, nil
+}
+
+// queryContext is what retrieval gathers for a question before generation
+type queryContext struct {
+	documents     []DocumentRecord
+	questionWords []string
+	// chunks are the chunks in context, best first
+	chunks       []ScoredChunk
+	context      string
+	bestScore    float64
+	translations []QueryTranslation
+	// weakMatch means the best chunk scored below CrossLingualMinScore, so
+	// the cross-lingual fallback applies
+	weakMatch bool
+	// refusal is set when there is nothing to answer from
+	refusal string
+}
+
+// retrieveContext scores the caller's readable documents against question
+// and builds the LLM context from the best chunks. fallback allows the
+// cross-lingual retry, which calls the LLM.
+func (r *SimpleRAGService) retrieveContext(ctx context.Context, question, questionLanguage string, crossLingual, fallback bool) (*queryContext, error) {
+	// Check if we have any documents
+	documents, err := r.recentReadableDocuments(ctx, 50)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get documents: %w", err)
+	}
+
+	if len(documents) == 0 {
+		return &queryContext{refusal: RefusalEmptyCorpus}, nil
+	}
+
 	// Simple approach: Search all documents without bias
 	questionWords := strings.Fields(strings.ToLower(question))
 
@@ -163,26 +875,26 @@ func (r *SimpleRAGService) Query(ctx context.Context, question string) (*SimpleR
 	}
 
 	if len(allChunks) == 0 {
-		response := &SimpleRAGResponse{
-			Answer:     "I don't have any processed content in my knowledge base yet. Please upload some PDF files first.",
-			Sources:    []string{},
-			Confidence: 0.0,
-			Context:    "",
-		}
-
-		// Store query in database
-		r.storeQuery(ctx, question, response)
-		return response, nil
+		return &queryContext{refusal: RefusalNoContent}, nil
 	}
 
-	// Score all chunks based purely on text similarity
-	scoredChunks := make([]ScoredChunk, len(allChunks))
-	for i, chunk := range allChunks {
-		score := r.CalculateRelevanceScore(questionWords, strings.ToLower(chunk.ChunkText))
-		scoredChunks[i] = ScoredChunk{
-			Chunk: chunk,
-			Score: score,
-		}
+	// Score all chunks by text and, with an embedder, vector similarity
+	retrievalStart := time.Now()
+	r.attachSimilarity(ctx, question, allChunks)
+	scoredChunks := r.scoreChunks(ctx, questionWords, allChunks, questionLanguage, crossLingual, "")
+
+	// A weak match may just mean the evidence is written in another language,
+	// so retry with the question translated into the main corpus languages
+	weakMatch := r.Config != nil && topScore(scoredChunks) < r.Config.CrossLingualMinScore
+	var translations []QueryTranslation
+	var rerankTime time.Duration
+	budget := LatencyBudgetFromContext(ctx)
+	if fallback && weakMatch && r.canGenerate() &&
+		budget.Allow(StageCrossLingualFallback, r.crossLingualEstimate(question, questionLanguage)+fullContextGeneration()) {
+		crossLingualStart := time.Now()
+		scoredChunks, translations = r.crossLingualRetrieval(ctx, question, questionLanguage, allChunks, scoredChunks)
+		rerankTime = time.Since(crossLingualStart)
+		DebugTraceFromContext(ctx).AddStage("cross_lingual_retrieval", rerankTime)
 	}
 
 	// Debug: Log top 5 chunks with their scores
@@ -204,77 +916,75 @@ func (r *SimpleRAGService) Query(ctx context.Context, question string) (*SimpleR
 		topChunks = scoredChunks[:5]
 	}
 
+	retrievalTime := time.Since(retrievalStart)
+	DefaultMetrics.RecordRetrieval(retrievalTime)
+	DebugTraceFromContext(ctx).AddStage("retrieval", retrievalTime)
+	TimingsFromContext(ctx).AddRetrieval(retrievalTime - rerankTime)
+	TimingsFromContext(ctx).AddRerank(rerankTime)
+	r.Shadow.Mirror(question, questionLanguage, crossLingual, allChunks, topChunks, retrievalTime)
+
 	// Build context from most relevant chunks
-	var contextParts []string
+	var contextChunks []ScoredChunk
 	bestScore := 0.0
 
 	for _, scoredChunk := range topChunks {
-		if scoredChunk.Score > 0.2 { // Only include chunks with some relevance
-			contextParts = append(contextParts, scoredChunk.Chunk.ChunkText)
+		if scoredChunk.Score > minContextScore {
+			contextChunks = append(contextChunks, scoredChunk)
 
 			// Track the best score
 			if scoredChunk.Score > bestScore {
 				bestScore = scoredChunk.Score
 			}
-		}
-	}
 
-	if len(contextParts) == 0 {
-		response := &SimpleRAGResponse{
-			Answer:     "I don't have enough relevant information to answer that question accurately.",
-			Sources:    []string{},
-			Confidence: 0.0,
-			Context:    "",
+			// Credit the translation that surfaced this chunk
+			for i := range translations {
+				if translations[i].Language == scoredChunk.MatchedLanguage {
+					translations[i].EvidenceChunks++
+				}
+			}
 		}
-
-		// Store query in database
-		r.storeQuery(ctx, question, response)
-		return response, nil
 	}
 
-	context := strings.Join(contextParts, "\n\n")
-
-	// If LLM is disabled, return retrieval-only response using context
-	if r.Config != nil && strings.ToLower(r.Config.LLMProvider) == "none" {
-		trimmed := context
-		if len(trimmed) > 1200 {
-			trimmed = trimmed[:1200] + "..."
-		}
-		answerText := trimmed
-		if r.Config.AppLanguage == "fa" {
-			answerText = "حالت فقط بازیابی فعال است. بخش‌های مرتبط:\n" + trimmed
-		} else {
-			answerText = "Retrieval-only mode. Relevant context:\n" + trimmed
-		}
-
-		// Include multiple relevant sources with document ID for download
-		var sources []string
-		topSources := r.getTopRelevantSources(questionWords, documents, 5)
-		for _, source := range topSources {
-			formattedSource := r.formatSourceWithDocumentID(source.Filename, documents)
-			sources = append(sources, formattedSource)
-		}
+	if len(contextChunks) == 0 {
+		return &queryContext{refusal: RefusalNoEvidence}, nil
+	}
 
-		confidence := bestScore
-		if confidence > 1.0 {
-			confidence = 1.0
-		}
+	return &queryContext{
+		documents:     documents,
+		questionWords: questionWords,
+		chunks:        contextChunks,
+		context:       buildContext(contextChunks),
+		bestScore:     bestScore,
+		translations:  translations,
+		weakMatch:     weakMatch,
+	}, nil
+}
 
-		response := &SimpleRAGResponse{
-			Answer:     answerText,
-			Sources:    sources,
-			Confidence: confidence,
-			Context:    context,
-		}
-		// Store query in database
-		r.storeQuery(ctx, question, response)
-		return response, nil
+// buildContext joins the chunks' text into the LLM context, capped on a
+// character boundary so RTL/multi-byte text isn't split
+func buildContext(chunks []ScoredChunk) string {
+	parts := make([]string, 0, len(chunks))
+	for _, scored := range chunks {
+		parts = append(parts, scored.Chunk.ChunkText)
 	}
+	return capRunes(strings.Join(parts, "\n\n"), maxContextRunes)
+}
 
-	// Generate answer using LLM with context
-	var prompt string
-	if r.Config != nil && r.Config.AppLanguage == "fa" {
-		prompt = fmt.Sprintf(`فقط با استفاده از اطلاعات «متن زمینه» زیر پاسخ بده. پاسخ باید دقیق، واضح و به زبان فارسی باشد. اگر پاسخ در متن نبود، فقط بگو: «اطلاعات کافی در متن موجود نیست».
+// lacksInformation reports whether the LLM said the context doesn't answer
+// the question (EN + FA)
+func lacksInformation(answer string) bool {
+	answerLower := strings.ToLower(answer)
+	return strings.Contains(answerLower, "i don't have that information") ||
+		strings.Contains(answerLower, "i don't have enough information") ||
+		strings.Contains(answerLower, "not found in the provided documents") ||
+		strings.Contains(answerLower, "not available in the context") ||
+		strings.Contains(answer, "اطلاعات کافی در متن موجود نیست")
+}
+
+// answerPrompt builds the single-answer prompt in the response language
+func (r *SimpleRAGService) answerPrompt(lang, context, question string) string {
+	if lang == "fa" {
+		return fmt.Sprintf(`فقط با استفاده از اطلاعات «متن زمینه» زیر پاسخ بده. پاسخ باید دقیق، واضح و به زبان فارسی باشد. اگر پاسخ در متن نبود، فقط بگو: «اطلاعات کافی در متن موجود نیست».
 
 متن زمینه:
 %s
@@ -282,8 +992,8 @@ func (r *SimpleRAGService) Query(ctx context.Context, question string) (*SimpleR
 پرسش: %s
 
 پاسخ:`, context, question)
-	} else {
-		prompt = fmt.Sprintf(`Answer this question using ONLY the information provided in the context below. Give a direct, specific answer.
+	}
+	return fmt.Sprintf(`Answer this question using ONLY the information provided in the context below. Give a direct, specific answer.
 
 CONTEXT:
 %s
@@ -291,111 +1001,193 @@ CONTEXT:
 QUESTION: %s
 
 ANSWER:`, context, question)
+}
+
+func (r *SimpleRAGService) storeQuery(ctx context.Context, question string, response *SimpleRAGResponse) {
+	queryID := fmt.Sprintf("query_%d", time.Now().UnixNano())
+
+	version, err := r.PinCorpus()
+	if err != nil {
+		log.Printf("Warning: failed to pin corpus version: %v", err)
+	}
+	response.CorpusVersion = version
+
+	queryRecord := &QueryRecord{
+		ID:            queryID,
+		Question:      question,
+		Answer:        response.Answer,
+		Confidence:    response.Confidence,
+		Sources:       EncodeSources(response.Sources),
+		CorpusVersion: version,
 	}
+	stored := r.StoreContext(response)
+	queryRecord.Context, queryRecord.ContextFormat = stored.Data, stored.Format
 
-	answer, err := r.LLM.GenerateText(ctx, prompt)
+	err = r.DatabaseSchema.InsertQuery(queryRecord)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate answer: %w", err)
+		log.Printf("Warning: failed to store query: %v", err)
+		return
 	}
+	response.QueryID = queryID
+}
 
-	// Check if the answer indicates lack of knowledge (EN + FA)
-	answerLower := strings.ToLower(answer)
-	missingFa := strings.Contains(answer, "اطلاعات کافی در متن موجود نیست")
-	if strings.Contains(answerLower, "i don't have that information") ||
-		strings.Contains(answerLower, "i don't have enough information") ||
-		strings.Contains(answerLower, "not found in the provided documents") ||
-		strings.Contains(answerLower, "not available in the context") ||
-		missingFa {
-		msg := "I don't have that information in the provided documents."
-		if r.Config != nil && r.Config.AppLanguage == "fa" {
-			msg = "این اطلاعات در اسناد موجود نیست."
-		}
-		response := &SimpleRAGResponse{
-			Answer:     msg,
-			Sources:    []string{},
-			Confidence: 0.0,
-			Context:    context,
-		}
+func thumbnailObjectName(documentID string) string {
+	return documentID + "/thumbnail.png"
+}
 
-		// Store query in database
-		r.storeQuery(ctx, question, response)
-		return response, nil
+func (r *SimpleRAGService) storeThumbnail(ctx context.Context, documentID string, pdfData []byte) ([]byte, error) {
+	thumbnail, err := r.Thumbnails.Render(pdfData)
+	if err != nil {
+		return nil, err
 	}
+	if err := r.MinIOAdapter.PutObject(ctx, "documents", thumbnailObjectName(documentID), thumbnail, "image/png"); err != nil {
+		return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	return thumbnail, nil
+}
 
-	// Include multiple relevant sources with document ID for download
-	var sources []string
-	topSources := r.getTopRelevantSources(questionWords, documents, 5)
-	for _, source := range topSources {
-		formattedSource := r.formatSourceWithDocumentID(source.Filename, documents)
-		sources = append(sources, formattedSource)
+// GetThumbnail returns the stored first-page thumbnail, rendering it on
+// demand for documents uploaded before thumbnails existed
+func (r *SimpleRAGService) GetThumbnail(ctx context.Context, documentID string) ([]byte, error) {
+	thumbnail, err := r.MinIOAdapter.GetObject(ctx, "documents", thumbnailObjectName(documentID))
+	if err == nil {
+		return thumbnail, nil
 	}
 
-	// Calculate confidence based on best score
-	confidence := bestScore
-	if confidence > 1.0 {
-		confidence = 1.0
+	doc, err := r.DatabaseSchema.GetDocument(documentID)
+	if err != nil {
+		return nil, err
 	}
 
-	response := &SimpleRAGResponse{
-		Answer:     answer,
-		Sources:    sources,
-		Confidence: confidence,
-		Context:    context,
+	pdfData, err := r.MinIOAdapter.GetObject(ctx, "documents", doc.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load PDF: %w", err)
 	}
 
-	// Store query in database
-	r.storeQuery(ctx, question, response)
-	return response, nil
+	return r.storeThumbnail(ctx, documentID, pdfData)
 }
 
-func (r *SimpleRAGService) storeQuery(ctx context.Context, question string, response *SimpleRAGResponse) {
-	queryID := fmt.Sprintf("query_%d", time.Now().UnixNano())
+// DeleteDocument removes a document's stored files, chunks and record
+func (r *SimpleRAGService) DeleteDocument(ctx context.Context, documentID string) error {
+	doc, err := r.DatabaseSchema.GetDocument(documentID)
+	if err != nil {
+		return err
+	}
+	if err := r.CheckCollectionAccess(ctx, DocumentCollection(doc.Metadata), PermissionWrite); err != nil {
+		return err
+	}
 
-	// Convert sources to JSON string
-	sourcesJSON := `["` + strings.Join(response.Sources, `","`) + `"]`
+	if err := r.MinIOAdapter.RemovePrefix(ctx, "documents", documentID+"/"); err != nil {
+		return fmt.Errorf("failed to remove document files: %w", err)
+	}
+	if doc.StorageTier == StorageTierArchive && !strings.HasPrefix(doc.Filename, blobPrefix) {
+		if err := r.MinIOAdapter.RemoveObject(ctx, r.Config.TieringBucket, doc.Filename); err != nil {
+			return fmt.Errorf("failed to remove archived original: %w", err)
+		}
+	}
 
-	queryRecord := &QueryRecord{
-		ID:         queryID,
-		Question:   question,
-		Answer:     response.Answer,
-		Confidence: response.Confidence,
-		Sources:    sourcesJSON,
-		Context:    response.Context,
+	// Shared originals are only removed with the last document using them;
+	// the lock keeps an upload from reusing one while it is removed
+	unlockBlob := r.lockBlob(doc.Filename)
+	if err := r.DatabaseSchema.DeleteDocument(documentID); err != nil {
+		unlockBlob()
+		return fmt.Errorf("failed to delete document record: %w", err)
+	}
+	if err := r.releaseBlob(ctx, doc.Filename, doc.StorageTier); err != nil {
+		log.Printf("Warning: failed to remove original of %s: %v", documentID, err)
 	}
+	unlockBlob()
+
+	log.Printf("Deleted document %s", documentID)
+	return nil
+}
 
-	err := r.DatabaseSchema.InsertQuery(queryRecord)
+// GetStorageUsage combines database totals with the object storage footprint
+func (r *SimpleRAGService) GetStorageUsage(ctx context.Context) (*StorageUsage, error) {
+	usage, err := r.DatabaseSchema.GetStorageUsage()
 	if err != nil {
-		log.Printf("Warning: failed to store query: %v", err)
+		return nil, fmt.Errorf("failed to get storage usage: %w", err)
 	}
+
+	usage.ObjectCount, usage.ObjectBytes, err = r.MinIOAdapter.BucketUsage(ctx, "documents")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object storage usage: %w", err)
+	}
+
+	return usage, nil
 }
 
-func (r *SimpleRAGService) GetDocumentStats(ctx context.Context) (map[string]interface{}, error) {
-	documents, err := r.DatabaseSchema.GetDocuments(100, 0)
+// DocumentStats counts the library's documents, as /stats reports them
+type DocumentStats struct {
+	TotalDocuments     int `json:"total_documents"`
+	CompletedDocuments int `json:"completed_documents"`
+	// TotalChunks counts the chunks of completed documents
+	TotalChunks int `json:"total_chunks"`
+}
+
+// GetDocumentStats counts every document the caller in ctx can read
+func (r *SimpleRAGService) GetDocumentStats(ctx context.Context) (*DocumentStats, error) {
+	documents, err := r.DatabaseSchema.GetAllDocuments()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get documents: %w", err)
 	}
+	documents, err = r.ReadableDocuments(ctx, documents)
+	if err != nil {
+		return nil, err
+	}
 
-	completedCount := 0
-	totalChunks := 0
+	stats := &DocumentStats{TotalDocuments: len(documents)}
 	for _, doc := range documents {
 		if doc.Status == "completed" {
-			completedCount++
-			totalChunks += doc.ChunkCount
+			stats.CompletedDocuments++
+			stats.TotalChunks += doc.ChunkCount
 		}
 	}
+	return stats, nil
+}
 
-	return map[string]interface{}{
-		"total_documents":     len(documents),
-		"completed_documents": completedCount,
-		"total_chunks":        totalChunks,
-	}, nil
+// responseLanguage answers in the language the request forces, else in the
+// question's language when we have prompts for it, falling back to the
+// configured app language
+func (r *SimpleRAGService) responseLanguage(ctx context.Context, questionLanguage string) string {
+	if lang := AnswerLanguageFromContext(ctx); lang != "" {
+		return lang
+	}
+	if questionLanguage == "fa" || questionLanguage == "en" {
+		return questionLanguage
+	}
+	if r.Config != nil {
+		return r.Config.AppLanguage
+	}
+	return "en"
+}
+
+// languagePreference boosts chunks written in the question's language.
+// Chunks stored before language detection existed are detected on the fly.
+func (r *SimpleRAGService) languagePreference(questionLanguage string, chunk ChunkRecord) float64 {
+	if questionLanguage == "" || r.Config == nil {
+		return 1.0
+	}
+	chunkLanguage := chunk.Language
+	if chunkLanguage == "" {
+		chunkLanguage, _ = DetectLanguage(chunk.ChunkText)
+	}
+	if chunkLanguage == questionLanguage {
+		return r.Config.RetrievalLanguageBoost
+	}
+	return 1.0
 }
 
 // CalculateRelevanceScore calculates a relevance score using token matches,
 // simple term-frequency weighting, and query coverage. This is a lightweight
 // alternative to embeddings to improve ranking quality.
 func (r *SimpleRAGService) CalculateRelevanceScore(questionWords []string, chunkText string) float64 {
-	score := 0.0
+	return r.relevanceFeatures(questionWords, chunkText).lexical()
+}
+
+// relevanceFeatures counts how the question's terms match the chunk text
+func (r *SimpleRAGService) relevanceFeatures(questionWords []string, chunkText string) scoreFeatures {
+	var features scoreFeatures
 
 	// Normalize and tokenize
 	normalize := func(s string) string {
@@ -404,14 +1196,16 @@ func (r *SimpleRAGService) CalculateRelevanceScore(questionWords []string, chunk
 		replacements := map[string]string{
 			"ó": "o", "á": "a", "é": "e", "í": "i", "ú": "u",
 			"ñ": "n", "ç": "c", "ü": "u", "ö": "o", "ä": "a",
+			// Arabic forms of Persian letters
+			"ي": "ی", "ك": "ک",
 		}
 		for old, new := range replacements {
 			s = strings.ReplaceAll(s, old, new)
 		}
-		// Replace non-alphanumerics with space
+		// Replace non-alphanumerics with space, keeping letters of any script
 		var b strings.Builder
 		for _, r := range s {
-			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == ' ' {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' ' {
 				b.WriteRune(r)
 			} else {
 				b.WriteRune(' ')
@@ -426,14 +1220,17 @@ func (r *SimpleRAGService) CalculateRelevanceScore(questionWords []string, chunk
 	chunkTokens := strings.Fields(normalizedChunk)
 	questionTokens := strings.Fields(normalizedQuestion)
 	if len(chunkTokens) == 0 || len(questionTokens) == 0 {
-		return 0.0
+		return features
 	}
 
 	// Exact phrase bonus
 	if strings.Contains(normalizedChunk, normalizedQuestion) && len(normalizedQuestion) >= 8 {
-		score += 40.0
+		features.phrase = 1
 	}
 
+	// Canonical amounts match the quantity terms indexed with each chunk
+	questionTokens = append(questionTokens, QuantityTerms(strings.Join(questionWords, " "))...)
+
 	// Build term frequency for chunk
 	chunkTF := make(map[string]int)
 	for _, t := range chunkTokens {
@@ -441,13 +1238,13 @@ func (r *SimpleRAGService) CalculateRelevanceScore(questionWords []string, chunk
 	}
 
 	// Match scoring with TF weighting and partials
-	covered := 0
+	var chunkKeys transliterationIndex
 	for _, q := range questionTokens {
 		tf := chunkTF[q]
 		if tf > 0 {
-			covered++
+			features.covered++
 			// Heavier weight for exact matches
-			score += 12.0 * (1.0 + 0.1*float64(tf-1))
+			features.exact += 1.0 + 0.1*float64(tf-1)
 			continue
 		}
 		// Partial match if no exact; only for tokens length >= 4
@@ -460,48 +1257,39 @@ func (r *SimpleRAGService) CalculateRelevanceScore(questionWords []string, chunk
 				}
 			}
 			if partialHit {
-				score += 4.0
+				features.partial++
+				continue
+			}
+		}
+		// Same name written in another script or spelling ("Tehran"/"تهران")
+		if r.Config != nil && r.Config.TransliterationMatching {
+			if chunkKeys == nil {
+				chunkKeys = newTransliterationIndex(chunkTokens)
+			}
+			if chunkKeys.matches(q) {
+				features.covered++
+				features.translit++
 			}
 		}
 	}
 
-	// Coverage reward: proportion of query terms matched
-	coverage := float64(covered) / float64(len(questionTokens))
-	score += 20.0 * coverage
-
-	// Normalize by query length to reduce bias
-	score = score / (1.0 + 0.05*float64(len(questionTokens)))
-
-	return score
+	features.terms = len(questionTokens)
+	return features
 }
 
 // Removed document relevance function - no longer using document-level filtering
 
-// formatSourceWithDocumentID formats a source with document ID for download
-func (r *SimpleRAGService) formatSourceWithDocumentID(source string, documents []DocumentRecord) string {
-	if source == "" {
-		return ""
-	}
-
-	// Find the document ID for the source
-	for _, doc := range documents {
-		if doc.OriginalFilename == source {
-			return doc.ID + "|" + source
-		}
-	}
-
-	// Fallback: return source as-is
-	return source
-}
-
 // SourceScore represents a document with its relevance score
 type SourceScore struct {
-	Filename string
-	Score    float64
+	DocumentID string
+	Filename   string
+	Score      float64
+	// Page is where the document's best-scoring chunk is
+	Page int
 }
 
 // getTopRelevantSources finds the top N most relevant sources for a query
-func (r *SimpleRAGService) getTopRelevantSources(questionWords []string, documents []DocumentRecord, limit int) []SourceScore {
+func (r *SimpleRAGService) getTopRelevantSources(ctx context.Context, questionWords []string, documents []DocumentRecord, limit int) []SourceScore {
 	var sourceScores []SourceScore
 
 	for _, doc := range documents {
@@ -517,18 +1305,22 @@ func (r *SimpleRAGService) getTopRelevantSources(questionWords []string, documen
 
 		// Calculate relevance score for this document
 		maxScore := 0.0
+		bestPage := 0
 		for _, chunk := range chunks {
-			score := r.CalculateRelevanceScore(questionWords, strings.ToLower(chunk.ChunkText))
+			score := r.ScoreChunk(ctx, questionWords, chunk)
 			if score > maxScore {
 				maxScore = score
+				bestPage = chunk.PageNumber
 			}
 		}
 
 		// Only include documents with some relevance
 		if maxScore > 0.1 {
 			sourceScores = append(sourceScores, SourceScore{
-				Filename: doc.OriginalFilename,
-				Score:    maxScore,
+				DocumentID: doc.ID,
+				Filename:   doc.OriginalFilename,
+				Score:      maxScore,
+				Page:       bestPage,
 			})
 		}
 	}
@@ -545,181 +1337,120 @@ func (r *SimpleRAGService) getTopRelevantSources(questionWords []string, documen
 	return sourceScores
 }
 
-// searchAllDocuments is the fallback method when document-level filtering fails
-func (r *SimpleRAGService) searchAllDocuments(ctx context.Context, question string, documents []DocumentRecord) (*SimpleRAGResponse, error) {
-	// Get chunks from all completed documents
-	var allChunks []ChunkRecord
-	for _, doc := range documents {
-		if doc.Status == "completed" {
-			chunks, err := r.DatabaseSchema.GetChunksByDocument(doc.ID, 50, 0)
-			if err != nil {
-				log.Printf("Warning: failed to get chunks for document %s: %v", doc.ID, err)
-				continue
-			}
-			allChunks = append(allChunks, chunks...)
-		}
-	}
-
-	if len(allChunks) == 0 {
-		response := &SimpleRAGResponse{
-			Answer:     "I don't have any processed content in my knowledge base yet. Please upload some PDF files first.",
-			Sources:    []string{},
-			Confidence: 0.0,
-			Context:    "",
+// scoreChunks scores every chunk against the question words, keeping the
+// input order so results from several passes can be merged by index
+func (r *SimpleRAGService) scoreChunks(ctx context.Context, questionWords []string, chunks []ChunkRecord, language string, crossLingual bool, matchedLanguage string) []ScoredChunk {
+	settings := r.settingsFor(ctx)
+	scored := make([]ScoredChunk, len(chunks))
+	for i, chunk := range chunks {
+		score := r.scoreChunkWith(settings, settings.scoring, questionWords, chunk)
+		if !crossLingual {
+			score *= r.languagePreference(language, chunk)
 		}
-
-		// Store query in database
-		r.storeQuery(ctx, question, response)
-		return response, nil
-	}
-
-	// Score all chunks
-	questionWords := strings.Fields(strings.ToLower(question))
-	scoredChunks := make([]ScoredChunk, len(allChunks))
-
-	for i, chunk := range allChunks {
-		score := r.CalculateRelevanceScore(questionWords, strings.ToLower(chunk.ChunkText))
-		scoredChunks[i] = ScoredChunk{
-			Chunk: chunk,
-			Score: score,
+		scored[i] = ScoredChunk{
+			Chunk:           chunk,
+			Score:           score,
+			MatchedLanguage: matchedLanguage,
 		}
 	}
+	return scored
+}
 
-	// Sort by relevance score (highest first)
-	sort.Slice(scoredChunks, func(i, j int) bool {
-		return scoredChunks[i].Score > scoredChunks[j].Score
-	})
-
-	// Take top N most relevant chunks
-	topChunks := scoredChunks
-	if len(scoredChunks) > 8 {
-		topChunks = scoredChunks[:8]
+// scoringText is the chunk text plus its canonical amounts
+func scoringText(chunk ChunkRecord) string {
+	text := strings.ToLower(chunk.ChunkText)
+	if chunk.QuantityTerms != "" {
+		text += " " + chunk.QuantityTerms
 	}
+	return text
+}
 
-	// Build context from most relevant chunks
-	var contextParts []string
-	bestScore := 0.0
-
-	for _, scoredChunk := range topChunks {
-		if scoredChunk.Score > 0.1 { // Only include chunks with some relevance
-			contextParts = append(contextParts, scoredChunk.Chunk.ChunkText)
-
-			// Track the best score
-			if scoredChunk.Score > bestScore {
-				bestScore = scoredChunk.Score
-			}
+func topScore(scored []ScoredChunk) float64 {
+	best := 0.0
+	for _, s := range scored {
+		if s.Score > best {
+			best = s.Score
 		}
 	}
+	return best
+}
 
-	// If no context and app language is Persian, attempt cross-lingual fallback: translate question to English and retry retrieval
-	if len(contextParts) == 0 && r.Config != nil && r.Config.AppLanguage == "fa" {
-		translated, tErr := r.translateToEnglish(ctx, question)
-		if tErr == nil && strings.TrimSpace(translated) != "" {
-			enWords := strings.Fields(strings.ToLower(translated))
-			// Rescore
-			rescored := make([]ScoredChunk, len(allChunks))
-			for i, chunk := range allChunks {
-				score := r.CalculateRelevanceScore(enWords, strings.ToLower(chunk.ChunkText))
-				rescored[i] = ScoredChunk{Chunk: chunk, Score: score}
-			}
-			sort.Slice(rescored, func(i, j int) bool { return rescored[i].Score > rescored[j].Score })
-			topChunks = rescored
-			if len(rescored) > 3 {
-				topChunks = rescored[:3]
-			}
-			contextParts = contextParts[:0]
-			bestScore = 0.0
-			for _, scoredChunk := range topChunks {
-				if scoredChunk.Score > 0.1 {
-					contextParts = append(contextParts, scoredChunk.Chunk.ChunkText)
-					if scoredChunk.Score > bestScore {
-						bestScore = scoredChunk.Score
-					}
-				}
-			}
-		}
+// canGenerate reports whether an LLM is available for auxiliary prompts
+func (r *SimpleRAGService) canGenerate() bool {
+	if r.LLM == nil {
+		return false
 	}
+	return r.Config == nil || strings.ToLower(r.Config.LLMProvider) != "none"
+}
 
-	if len(contextParts) == 0 {
-		response := &SimpleRAGResponse{
-			Answer:     "I don't have enough relevant information to answer that question accurately.",
-			Sources:    []string{},
-			Confidence: 0.0,
-			Context:    "",
-		}
-
-		// Store query in database
-		r.storeQuery(ctx, question, response)
-		return response, nil
+// crossLingualRetrieval translates the question into each major language of
+// the corpus and keeps, per chunk, the best score from any translation.
+// scored must be in the same order as chunks.
+func (r *SimpleRAGService) crossLingualRetrieval(ctx context.Context, question, questionLanguage string, chunks []ChunkRecord, scored []ScoredChunk) ([]ScoredChunk, []QueryTranslation) {
+	languages, err := r.DatabaseSchema.GetCorpusLanguages()
+	if err != nil {
+		log.Printf("Warning: failed to get corpus languages: %v", err)
+		return scored, nil
 	}
 
-	// Build final context and cap its length to avoid exceeding model limits
-	context := strings.Join(contextParts, "\n\n---\n\n")
-	if len(context) > 12000 {
-		context = context[:12000]
+	total := 0
+	for _, l := range languages {
+		total += l.Chunks
+	}
+	if total == 0 {
+		return scored, nil
 	}
 
-	// Generate answer using LLM with context
-	prompt := fmt.Sprintf(`Answer this question using ONLY the information provided in the context below. Give a direct, specific answer.
-
-CONTEXT:
-%s
-
-QUESTION: %s
-
-ANSWER:`, context, question)
+	var translations []QueryTranslation
+	for _, l := range languages {
+		if len(translations) >= r.Config.CrossLingualMaxLanguages {
+			break
+		}
+		if l.Language == questionLanguage || float64(l.Chunks)/float64(total) < r.Config.CrossLingualMinShare {
+			continue
+		}
 
-	answer, err := r.LLM.GenerateText(ctx, prompt)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate answer: %w", err)
-	}
+		translated, err := r.translateQuestion(ctx, question, l.Language)
+		if err != nil || strings.TrimSpace(translated) == "" {
+			log.Printf("Warning: failed to translate question to %s: %v", l.Language, err)
+			continue
+		}
 
-	// Check if the answer indicates lack of knowledge
-	answerLower := strings.ToLower(answer)
-	if strings.Contains(answerLower, "i don't have that information") ||
-		strings.Contains(answerLower, "i don't have enough information") ||
-		strings.Contains(answerLower, "not found in the provided documents") ||
-		strings.Contains(answerLower, "not available in the context") {
-		response := &SimpleRAGResponse{
-			Answer:     "I don't have that information in the provided documents.",
-			Sources:    []string{},
-			Confidence: 0.0,
-			Context:    context,
+		words := strings.Fields(strings.ToLower(translated))
+		for i, candidate := range r.scoreChunks(ctx, words, chunks, l.Language, false, l.Language) {
+			if candidate.Score > scored[i].Score {
+				scored[i] = candidate
+			}
 		}
 
-		// Store query in database
-		r.storeQuery(ctx, question, response)
-		return response, nil
+		translations = append(translations, QueryTranslation{
+			Language: l.Language,
+			Question: strings.TrimSpace(translated),
+		})
 	}
 
-	// Include multiple relevant sources with document ID for download
-	var sources []string
-	topSources := r.getTopRelevantSources(questionWords, documents, 5)
-	for _, source := range topSources {
-		formattedSource := r.formatSourceWithDocumentID(source.Filename, documents)
-		sources = append(sources, formattedSource)
-	}
+	return scored, translations
+}
 
-	// Calculate confidence based on best score
-	confidence := bestScore
-	if confidence > 1.0 {
-		confidence = 1.0
-	}
+// languageNames maps language codes to names the LLM understands in prompts
+var languageNames = map[string]string{
+	"en": "English", "fa": "Persian", "ar": "Arabic", "fr": "French",
+	"de": "German", "es": "Spanish", "ru": "Russian", "zh": "Chinese",
+	"ja": "Japanese", "ko": "Korean", "he": "Hebrew", "hi": "Hindi",
+}
 
-	response := &SimpleRAGResponse{
-		Answer:     answer,
-		Sources:    sources,
-		Confidence: confidence,
-		Context:    context,
+func languageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
 	}
+	return code
+}
 
-	// Store query in database
-	r.storeQuery(ctx, question, response)
-	return response, nil
+// translateQuestion uses the LLM to translate text into the target language, returning plain text only
+func (r *SimpleRAGService) translateQuestion(ctx context.Context, text, language string) (string, error) {
+	return r.LLM.GenerateText(ctx, questionTranslationPrompt(text, language))
 }
 
-// translateToEnglish uses the LLM to translate input text to English, returning plain text only
-func (r *SimpleRAGService) translateToEnglish(ctx context.Context, text string) (string, error) {
-	prompt := "Translate the following text to English. Return only the translation without quotes or extra commentary.\n\nText:\n" + text
-	return r.LLM.GenerateText(ctx, prompt)
+func questionTranslationPrompt(text, language string) string {
+	return "Translate the following text to " + languageName(language) + ". Return only the translation without quotes or extra commentary.\n\nText:\n" + text
 }
@@ -0,0 +1,26 @@
+package adapters
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithSettingsPinsSnapshot(t *testing.T) {
+	r := &SimpleRAGService{}
+	before := &serviceSettings{zoneWeights: map[string]float64{"header": 0.5}}
+	r.settings.Store(before)
+
+	pinned := r.WithSettings(context.Background())
+	after := &serviceSettings{zoneWeights: map[string]float64{"header": 2}}
+	r.settings.Store(after)
+
+	if got := r.settingsFor(pinned); got != before {
+		t.Errorf("pinned request got %+v, want the settings it started with", got)
+	}
+	if got := r.settingsFor(r.WithSettings(pinned)); got != before {
+		t.Errorf("pinning again replaced the settings with %+v", got)
+	}
+	if got := r.settingsFor(context.Background()); got != after {
+		t.Errorf("unpinned context got %+v, want the current settings", got)
+	}
+}
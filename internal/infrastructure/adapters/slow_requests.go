@@ -0,0 +1,64 @@
+package adapters
+
+import (
+	"sync"
+)
+
+// slowRequestCapacity is how many recent slow requests are kept
+const slowRequestCapacity = 200
+
+// SlowRequest is a request that took longer than its route's threshold, or
+// ran out of time
+type SlowRequest struct {
+	RequestID   string `json:"request_id"`
+	Method      string `json:"method"`
+	Route       string `json:"route"`
+	Path        string `json:"path"`
+	Class       string `json:"class"`
+	Status      int    `json:"status"`
+	DurationMs  int64  `json:"duration_ms"`
+	ThresholdMs int64  `json:"threshold_ms"`
+	TimedOut    bool   `json:"timed_out"`
+	Details     string `json:"details,omitempty"`
+	At          string `json:"at"`
+}
+
+// SlowRequestLog keeps the most recent slow requests in memory
+type SlowRequestLog struct {
+	mu      sync.Mutex
+	entries []SlowRequest
+	next    int
+	full    bool
+}
+
+func NewSlowRequestLog() *SlowRequestLog {
+	return &SlowRequestLog{entries: make([]SlowRequest, slowRequestCapacity)}
+}
+
+// Record adds a slow request, dropping the oldest once full
+func (l *SlowRequestLog) Record(request SlowRequest) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = request
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// List returns the recorded slow requests, newest first
+func (l *SlowRequestLog) List() []SlowRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+	requests := make([]SlowRequest, 0, count)
+	for i := 1; i <= count; i++ {
+		requests = append(requests, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return requests
+}
@@ -0,0 +1,220 @@
+package adapters
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// corpusSnapshotPrefix names the snapshots PinCorpus stores for a version
+const corpusSnapshotPrefix = "corpus_"
+
+// CorpusSnapshot is a snapshot with its decoded document list
+type CorpusSnapshot struct {
+	SnapshotRecord
+	Documents []SnapshotDocument `json:"documents"`
+}
+
+// DocumentChange is a document present in both states whose content or
+// indexing differs
+type DocumentChange struct {
+	ID     string           `json:"id"`
+	Fields []string         `json:"fields"`
+	Before SnapshotDocument `json:"before"`
+	After  SnapshotDocument `json:"after"`
+}
+
+// SnapshotDiff lists what changed between a snapshot and a later state
+type SnapshotDiff struct {
+	From      string             `json:"from"`
+	To        string             `json:"to"` // a snapshot id or "current"
+	Added     []SnapshotDocument `json:"added"`
+	Removed   []SnapshotDocument `json:"removed"`
+	Changed   []DocumentChange   `json:"changed"`
+	Unchanged int                `json:"unchanged"`
+}
+
+// CreateSnapshot records the current document list with content hashes so
+// it can be compared later, e.g. to show what the assistant knew when an
+// answer was given
+func (r *SimpleRAGService) CreateSnapshot(label string) (*CorpusSnapshot, error) {
+	documents, err := r.DatabaseSchema.GetDocumentFingerprints()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	data, err := json.Marshal(documents)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &CorpusSnapshot{
+		SnapshotRecord: SnapshotRecord{
+			ID:            fmt.Sprintf("snapshot_%d", time.Now().UnixNano()),
+			Label:         label,
+			DocumentCount: len(documents),
+			Documents:     string(data),
+			CreatedAt:     dbNow(),
+		},
+		Documents: documents,
+	}
+	if err := r.DatabaseSchema.InsertSnapshot(&snapshot.SnapshotRecord); err != nil {
+		return nil, fmt.Errorf("failed to store snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// GetSnapshot loads a snapshot with its documents
+func (r *SimpleRAGService) GetSnapshot(id string) (*CorpusSnapshot, error) {
+	record, err := r.DatabaseSchema.GetSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &CorpusSnapshot{SnapshotRecord: *record}
+	if err := json.Unmarshal([]byte(record.Documents), &snapshot.Documents); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %s: %w", id, err)
+	}
+	return snapshot, nil
+}
+
+// DiffSnapshot compares a snapshot with another snapshot, or with the
+// current corpus when against is empty
+func (r *SimpleRAGService) DiffSnapshot(id, against string) (*SnapshotDiff, error) {
+	from, err := r.GetSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+
+	to := "current"
+	var current []SnapshotDocument
+	if against != "" {
+		other, err := r.GetSnapshot(against)
+		if err != nil {
+			return nil, err
+		}
+		to = other.ID
+		current = other.Documents
+	} else {
+		current, err = r.DatabaseSchema.GetDocumentFingerprints()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list documents: %w", err)
+		}
+	}
+
+	diff := DiffDocuments(from.Documents, current)
+	diff.From = from.ID
+	diff.To = to
+	return diff, nil
+}
+
+// DiffDocuments compares two document lists by id
+func DiffDocuments(before, after []SnapshotDocument) *SnapshotDiff {
+	diff := &SnapshotDiff{
+		Added:   []SnapshotDocument{},
+		Removed: []SnapshotDocument{},
+		Changed: []DocumentChange{},
+	}
+
+	previous := make(map[string]SnapshotDocument, len(before))
+	for _, doc := range before {
+		previous[doc.ID] = doc
+	}
+
+	for _, doc := range after {
+		old, ok := previous[doc.ID]
+		if !ok {
+			diff.Added = append(diff.Added, doc)
+			continue
+		}
+		delete(previous, doc.ID)
+
+		if fields := changedFields(old, doc); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, DocumentChange{ID: doc.ID, Fields: fields, Before: old, After: doc})
+		} else {
+			diff.Unchanged++
+		}
+	}
+
+	// Keep removals in the snapshot's order
+	for _, doc := range before {
+		if _, ok := previous[doc.ID]; ok {
+			diff.Removed = append(diff.Removed, doc)
+		}
+	}
+
+	return diff
+}
+
+// changedFields names the fields that differ; updated_at is ignored since
+// metadata edits and storage tiering bump it without changing the content
+func changedFields(before, after SnapshotDocument) []string {
+	var fields []string
+	if before.ContentHash != after.ContentHash {
+		fields = append(fields, "content_hash")
+	}
+	if before.FileSize != after.FileSize {
+		fields = append(fields, "file_size")
+	}
+	if before.Filename != after.Filename {
+		fields = append(fields, "filename")
+	}
+	if before.Status != after.Status {
+		fields = append(fields, "status")
+	}
+	if before.ChunkCount != after.ChunkCount {
+		fields = append(fields, "chunk_count")
+	}
+	return fields
+}
+
+// CorpusVersion fingerprints a document list; any added, removed or changed
+// document gives a new version
+func CorpusVersion(documents []SnapshotDocument) string {
+	h := sha256.New()
+	for _, doc := range documents {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d\x00%s\x00%d\n",
+			doc.ID, doc.Filename, doc.ContentHash, doc.FileSize, doc.Status, doc.ChunkCount)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// CorpusSnapshotID is the snapshot holding the document set of a version
+func CorpusSnapshotID(version string) string {
+	return corpusSnapshotPrefix + version
+}
+
+// PinCorpus returns the current corpus version, storing a snapshot for it
+// the first time it is seen so answers recorded with the version can be
+// checked against the exact document set later
+func (r *SimpleRAGService) PinCorpus() (string, error) {
+	documents, err := r.DatabaseSchema.GetDocumentFingerprints()
+	if err != nil {
+		return "", fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	version := CorpusVersion(documents)
+	if _, ok := r.pinnedVersions.Load(version); ok {
+		return version, nil
+	}
+
+	data, err := json.Marshal(documents)
+	if err != nil {
+		return "", err
+	}
+	snapshot := &SnapshotRecord{
+		ID:            CorpusSnapshotID(version),
+		Label:         "corpus version " + version,
+		DocumentCount: len(documents),
+		Documents:     string(data),
+	}
+	if err := r.DatabaseSchema.InsertSnapshot(snapshot); err != nil {
+		return "", fmt.Errorf("failed to store corpus snapshot: %w", err)
+	}
+
+	r.pinnedVersions.Store(version, true)
+	return version, nil
+}
@@ -0,0 +1,100 @@
+package adapters
+
+import (
+	"strings"
+)
+
+// Source is a document an answer cites: the pages its context came from,
+// its relevance score and where to download it. Anchors link to each page.
+// The links are signed when the response is served, see Structured.
+type Source struct {
+	DocumentID  string       `json:"document_id,omitempty"`
+	Filename    string       `json:"filename"`
+	Pages       []int        `json:"pages"`
+	Anchors     []PageAnchor `json:"anchors"`
+	Score       float64      `json:"score"`
+	DownloadURL string       `json:"download_url,omitempty"`
+}
+
+// String is the source's legacy "documentId|filename" form, kept in
+// SimpleRAGResponse.Sources and stored query history
+func (s Source) String() string {
+	if s.DocumentID == "" {
+		return s.Filename
+	}
+	return s.DocumentID + "|" + s.Filename
+}
+
+// ParseSource reads a legacy "documentId|filename" source, or a bare
+// filename. Pages and score aren't part of that form.
+func ParseSource(source string) Source {
+	documentID, filename, ok := strings.Cut(source, "|")
+	if !ok {
+		return Source{Filename: source, Pages: []int{}, Anchors: []PageAnchor{}}
+	}
+	return Source{
+		DocumentID: documentID,
+		Filename:   filename,
+		Pages:      []int{},
+		Anchors:    []PageAnchor{},
+	}
+}
+
+// citeSources builds the response's sources from the most relevant
+// documents, with the pages of each that made it into the context
+func citeSources(top []SourceScore, contextChunks []ScoredChunk) ([]string, []Source) {
+	var sources []string
+	var details []Source
+	for _, score := range top {
+		source := Source{
+			DocumentID: score.DocumentID,
+			Filename:   score.Filename,
+			Pages:      []int{},
+			Score:      score.Score,
+		}
+		source.Anchors = pageAnchors(score.DocumentID, contextChunks)
+		if len(source.Anchors) == 0 {
+			// Not in the context, so cite the document's best page
+			source.Anchors = append(source.Anchors, PageAnchor{Page: score.Page})
+		}
+		for _, anchor := range source.Anchors {
+			source.Pages = append(source.Pages, anchor.Page)
+		}
+
+		sources = append(sources, source.String())
+		details = append(details, source)
+	}
+	return sources, details
+}
+
+// StructuredResponse serializes a SimpleRAGResponse with Source objects in
+// place of the legacy "documentId|filename" strings
+type StructuredResponse struct {
+	*SimpleRAGResponse
+	Sources []Source `json:"sources"`
+}
+
+// Structured returns the response with structured sources, their download
+// links freshly signed by links. Sources changed after retrieval (by a
+// post-answer hook, say) are parsed from their legacy form, so the two
+// always list the same documents.
+func (r *SimpleRAGResponse) Structured(links *LinkSigner) *StructuredResponse {
+	byLegacy := make(map[string]Source, len(r.sourceDetails))
+	for _, source := range r.sourceDetails {
+		byLegacy[source.String()] = source
+	}
+
+	sources := make([]Source, 0, len(r.Sources))
+	for _, legacy := range r.Sources {
+		if legacy == "" {
+			continue
+		}
+		source, ok := byLegacy[legacy]
+		if !ok {
+			source = ParseSource(legacy)
+		}
+		links.signSource(&source)
+		sources = append(sources, source)
+	}
+	return &StructuredResponse{SimpleRAGResponse: r, Sources: sources}
+}
@@ -0,0 +1,245 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// summaryBatchRunes is the amount of chunk text summarized per map step
+	summaryBatchRunes = 6000
+	// summaryFanIn is how many partial summaries are merged per reduce step
+	summaryFanIn = 5
+	// maxSummaryChunks bounds how many chunks are read per document
+	maxSummaryChunks = 10000
+)
+
+// summaryBatch is a slice of one document's text summarized in a single map step
+type summaryBatch struct {
+	label string
+	text  string
+}
+
+// StartCorpusSummary creates a summary job for the given documents (all
+// completed documents when documentIDs is empty) and runs it in the
+// background. ctx should outlive the request, it cancels the job.
+func (r *SimpleRAGService) StartCorpusSummary(ctx context.Context, documentIDs []string) (*SummaryRecord, error) {
+	documents, err := r.summaryDocuments(ctx, documentIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("no completed documents to summarize")
+	}
+
+	idsJSON := "null"
+	if len(documentIDs) > 0 {
+		data, err := json.Marshal(documentIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode document IDs: %w", err)
+		}
+		idsJSON = string(data)
+	}
+
+	summary := &SummaryRecord{
+		ID:          fmt.Sprintf("summary_%d", time.Now().UnixNano()),
+		Status:      "running",
+		DocumentIDs: idsJSON,
+	}
+	if err := r.DatabaseSchema.InsertSummary(summary); err != nil {
+		return nil, fmt.Errorf("failed to create summary: %w", err)
+	}
+
+	go func() {
+		text, err := r.summarizeCorpus(ctx, summary.ID, documents)
+		if err != nil {
+			log.Printf("Warning: corpus summary %s failed: %v", summary.ID, err)
+			if err := r.DatabaseSchema.FailSummary(summary.ID, err.Error()); err != nil {
+				log.Printf("Warning: failed to record summary failure: %v", err)
+			}
+			return
+		}
+		if err := r.DatabaseSchema.CompleteSummary(summary.ID, text); err != nil {
+			log.Printf("Warning: failed to store summary %s: %v", summary.ID, err)
+			return
+		}
+		log.Printf("✅ Corpus summary %s completed", summary.ID)
+	}()
+
+	return summary, nil
+}
+
+// summaryDocuments resolves the documents a summary covers: the caller's
+// readable documents, or the given ones if the caller can read them all
+func (r *SimpleRAGService) summaryDocuments(ctx context.Context, documentIDs []string) ([]DocumentRecord, error) {
+	guard, err := r.collectionGuard(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []DocumentRecord
+	if len(documentIDs) == 0 {
+		all, err := r.DatabaseSchema.GetAllDocuments()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get documents: %w", err)
+		}
+		for _, doc := range guard.readable(all) {
+			if doc.Status == "completed" {
+				documents = append(documents, doc)
+			}
+		}
+		return documents, nil
+	}
+
+	for _, id := range documentIDs {
+		doc, err := r.DatabaseSchema.GetDocument(id)
+		if err != nil {
+			return nil, fmt.Errorf("document %s not found: %w", id, err)
+		}
+		if collection := DocumentCollection(doc.Metadata); !guard.Allows(collection, PermissionRead) {
+			return nil, fmt.Errorf("%w %q", ErrCollectionForbidden, collection)
+		}
+		if doc.Status != "completed" {
+			return nil, fmt.Errorf("document %s is %s", id, doc.Status)
+		}
+		documents = append(documents, *doc)
+	}
+	return documents, nil
+}
+
+// summarizeCorpus summarizes each document's chunks in batches (map) and then
+// merges the partial summaries a few at a time until one remains (reduce)
+func (r *SimpleRAGService) summarizeCorpus(ctx context.Context, summaryID string, documents []DocumentRecord) (string, error) {
+	var batches []summaryBatch
+	for _, doc := range documents {
+		chunks, err := r.DatabaseSchema.GetChunksByDocument(doc.ID, maxSummaryChunks, 0)
+		if err != nil {
+			return "", fmt.Errorf("failed to get chunks for %s: %w", doc.OriginalFilename, err)
+		}
+		batches = append(batches, batchChunks(doc.OriginalFilename, chunks)...)
+	}
+	if len(batches) == 0 {
+		return "", fmt.Errorf("selected documents have no content")
+	}
+
+	total := len(batches) + reduceSteps(len(batches))
+	completed := 0
+	progress := func() {
+		if err := r.DatabaseSchema.UpdateSummaryProgress(summaryID, completed, total); err != nil {
+			log.Printf("Warning: failed to update summary progress: %v", err)
+		}
+	}
+	progress()
+
+	partials := make([]string, 0, len(batches))
+	for _, batch := range batches {
+		prompt := fmt.Sprintf(`Summarize the following excerpt from the document "%s". Keep key facts, figures, names and conclusions. Write a concise summary of a few sentences.
+
+EXCERPT:
+%s
+
+SUMMARY:`, batch.label, batch.text)
+
+		partial, err := r.generateBackground(ctx, prompt)
+		if err != nil {
+			return "", fmt.Errorf("failed to summarize %s: %w", batch.label, err)
+		}
+		if len(batches) == 1 {
+			return strings.TrimSpace(partial), nil
+		}
+		partials = append(partials, fmt.Sprintf("[%s]\n%s", batch.label, strings.TrimSpace(partial)))
+		completed++
+		progress()
+	}
+
+	for len(partials) > 1 {
+		var merged []string
+		for start := 0; start < len(partials); start += summaryFanIn {
+			end := start + summaryFanIn
+			if end > len(partials) {
+				end = len(partials)
+			}
+
+			final := len(partials) <= summaryFanIn
+			instruction := "Combine the following partial summaries into one summary that keeps the most important points and notes which document each comes from."
+			if final {
+				instruction = "Write an executive summary of the document collection from the partial summaries below. Start with the overall themes, then list the key findings with the document they come from."
+			}
+			prompt := fmt.Sprintf("%s\n\nPARTIAL SUMMARIES:\n%s\n\nSUMMARY:", instruction, strings.Join(partials[start:end], "\n\n"))
+
+			combined, err := r.generateBackground(ctx, prompt)
+			if err != nil {
+				return "", fmt.Errorf("failed to merge summaries: %w", err)
+			}
+			merged = append(merged, strings.TrimSpace(combined))
+			completed++
+			progress()
+		}
+		partials = merged
+	}
+
+	return partials[0], nil
+}
+
+// batchChunks groups a document's chunks into map-step sized batches
+func batchChunks(filename string, chunks []ChunkRecord) []summaryBatch {
+	var batches []summaryBatch
+	var current []string
+	size := 0
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		batches = append(batches, summaryBatch{text: strings.Join(current, "\n\n")})
+		current, size = nil, 0
+	}
+
+	for _, chunk := range chunks {
+		runes := len([]rune(chunk.ChunkText))
+		if size+runes > summaryBatchRunes {
+			flush()
+		}
+		current = append(current, capRunes(chunk.ChunkText, summaryBatchRunes))
+		size += runes
+	}
+	flush()
+
+	for i := range batches {
+		batches[i].label = filename
+		if len(batches) > 1 {
+			batches[i].label = fmt.Sprintf("%s, part %d/%d", filename, i+1, len(batches))
+		}
+	}
+	return batches
+}
+
+// reduceSteps counts the merge calls needed to reduce n partial summaries to one
+func reduceSteps(n int) int {
+	steps := 0
+	for n > 1 {
+		n = (n + summaryFanIn - 1) / summaryFanIn
+		steps += n
+	}
+	return steps
+}
+
+// generateBackground calls the LLM for background jobs, waiting out
+// saturation instead of failing since nobody is waiting on the response
+func (r *SimpleRAGService) generateBackground(ctx context.Context, prompt string) (string, error) {
+	for {
+		text, err := r.LLM.GenerateText(ctx, prompt)
+		if !errors.Is(err, ErrLLMSaturated) {
+			return text, err
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
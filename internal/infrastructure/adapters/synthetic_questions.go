@@ -0,0 +1,139 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// syntheticQuestionBatch is how many chunks each pass generates
+	// questions for before looking for more
+	syntheticQuestionBatch = 20
+	// syntheticQuestionInterval is how often chunks still without questions
+	// are looked for when no ingest asks sooner
+	syntheticQuestionInterval = time.Minute
+	// syntheticQuestionRunes caps each generated question
+	syntheticQuestionRunes = 200
+	// syntheticQuestionPassageRunes caps the passage quoted to the LLM
+	syntheticQuestionPassageRunes = 3000
+)
+
+// StartSyntheticQuestions generates DOC2QUERY_QUESTIONS questions for each
+// text chunk of completed documents, doc2query style, until ctx is done.
+// They are matched against user questions alongside the chunk text, so a
+// chunk answering "what's the notice period?" without those words is still
+// found. Ingests wake the generator; chunks indexed while it was off are
+// caught up too.
+func (r *SimpleRAGService) StartSyntheticQuestions(ctx context.Context) {
+	if r.Config.Doc2QueryQuestions <= 0 || !r.canGenerate() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(syntheticQuestionInterval)
+		defer ticker.Stop()
+
+		for {
+			// Keep going while full batches suggest more chunks are waiting
+			if r.generateSyntheticQuestions(ctx) {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-r.questionsWanted:
+			}
+		}
+	}()
+}
+
+// wantSyntheticQuestions wakes the question generator after an ingest
+func (r *SimpleRAGService) wantSyntheticQuestions() {
+	select {
+	case r.questionsWanted <- struct{}{}:
+	default:
+	}
+}
+
+// generateSyntheticQuestions generates questions for a batch of chunks
+// without them, reporting whether a full batch was done and more may wait.
+// A chunk whose generation fails is left for the next pass.
+func (r *SimpleRAGService) generateSyntheticQuestions(ctx context.Context) bool {
+	chunks, err := r.DatabaseSchema.GetChunksWithoutQuestions(syntheticQuestionBatch)
+	if err != nil {
+		log.Printf("Warning: failed to find chunks without synthetic questions: %v", err)
+		return false
+	}
+
+	for _, chunk := range chunks {
+		if ctx.Err() != nil {
+			return false
+		}
+		text, err := r.generateBackground(ctx, syntheticQuestionsPrompt(chunk, r.Config.Doc2QueryQuestions))
+		if err != nil {
+			log.Printf("Warning: failed to generate questions for chunk %s: %v", chunk.ID, err)
+			return false
+		}
+		questions := parseSyntheticQuestions(text, r.Config.Doc2QueryQuestions)
+		if err := r.DatabaseSchema.SetChunkQuestions(chunk.ID, questions); err != nil {
+			log.Printf("Warning: failed to store questions for chunk %s: %v", chunk.ID, err)
+			return false
+		}
+	}
+	return len(chunks) == syntheticQuestionBatch
+}
+
+// syntheticQuestionsPrompt asks for n questions the chunk answers, in the
+// chunk's language
+func syntheticQuestionsPrompt(chunk ChunkRecord, n int) string {
+	passage := TruncateRunes(chunk.ChunkText, syntheticQuestionPassageRunes)
+	if chunk.Language == "fa" {
+		return fmt.Sprintf(`%d پرسش کوتاه بنویس که متن زیر به آن‌ها پاسخ می‌دهد، همان‌طور که یک کاربر می‌پرسد. هر پرسش در یک خط، بدون شماره‌گذاری و بدون توضیح اضافه.
+
+متن:
+%s
+
+پرسش‌ها:`, n, passage)
+	}
+	return fmt.Sprintf(`Write %d short questions a user might ask that the passage below answers. Use the passage's language. Put each question on its own line, without numbering or any other text.
+
+PASSAGE:
+%s
+
+QUESTIONS:`, n, passage)
+}
+
+// parseSyntheticQuestions reads up to n questions, one per line, dropping
+// bullets and numbering the LLM added anyway
+func parseSyntheticQuestions(text string, n int) []string {
+	questions := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(bulletPattern.ReplaceAllString(line, ""))
+		if line == "" {
+			continue
+		}
+		questions = append(questions, TruncateRunes(line, syntheticQuestionRunes))
+		if len(questions) == n {
+			break
+		}
+	}
+	return questions
+}
+
+// syntheticQuestionScore is the best lexical score of the question against
+// any of the chunk's synthetic questions
+func (r *SimpleRAGService) syntheticQuestionScore(questionWords []string, chunk ChunkRecord) float64 {
+	if chunk.SyntheticQuestions == "" {
+		return 0
+	}
+	best := 0.0
+	for _, question := range strings.Split(chunk.SyntheticQuestions, "\n") {
+		if score := r.relevanceFeatures(questionWords, strings.ToLower(question)).lexical(); score > best {
+			best = score
+		}
+	}
+	return best
+}
@@ -0,0 +1,229 @@
+package adapters
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Chunk types stored in document_chunks.chunk_type
+const (
+	ChunkTypeText  = "text"
+	ChunkTypeTable = "table"
+)
+
+const (
+	// minTableRows and minTableColumns decide when aligned rows form a table
+	minTableRows    = 3
+	minTableColumns = 3
+	// maxTableChunkRunes matches the text chunk size
+	maxTableChunkRunes = 1000
+)
+
+// extractTables finds table-like regions on a page and returns them as
+// pipe-delimited rows. GetPlainText flattens whitespace, which loses the
+// cell boundaries, so this works from glyph positions instead.
+func extractTables(page pdf.Page) (tables [][][]string) {
+	// The PDF library panics on some malformed content streams
+	defer func() {
+		if r := recover(); r != nil {
+			tables = nil
+		}
+	}()
+
+	var current [][]string
+	flush := func() {
+		if len(current) >= minTableRows && looksTabular(current) {
+			tables = append(tables, current)
+		}
+		current = nil
+	}
+
+	for _, row := range groupGlyphRows(page.Content().Text) {
+		cells := splitCells(row)
+		if len(cells) >= minTableColumns {
+			current = append(current, cells)
+		} else {
+			flush()
+		}
+	}
+	flush()
+
+	return tables
+}
+
+// groupGlyphRows groups glyphs sharing a baseline, top of the page first
+func groupGlyphRows(glyphs []pdf.Text) [][]pdf.Text {
+	sorted := make([]pdf.Text, len(glyphs))
+	copy(sorted, glyphs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if math.Abs(sorted[i].Y-sorted[j].Y) > 2 {
+			return sorted[i].Y > sorted[j].Y
+		}
+		return sorted[i].X < sorted[j].X
+	})
+
+	var rows [][]pdf.Text
+	for _, glyph := range sorted {
+		n := len(rows)
+		if n > 0 && math.Abs(rows[n-1][0].Y-glyph.Y) <= 2 {
+			rows[n-1] = append(rows[n-1], glyph)
+		} else {
+			rows = append(rows, []pdf.Text{glyph})
+		}
+	}
+	return rows
+}
+
+// splitCells breaks a row into cells wherever the horizontal gap between
+// glyphs is clearly wider than a space
+func splitCells(row []pdf.Text) []string {
+	var cells []string
+	var cell strings.Builder
+	end := 0.0
+	for i, glyph := range row {
+		gapLimit := glyph.FontSize * 0.9
+		if gapLimit <= 0 {
+			gapLimit = 4
+		}
+		if i > 0 && glyph.X-end > gapLimit {
+			if text := strings.TrimSpace(cell.String()); text != "" {
+				cells = append(cells, text)
+			}
+			cell.Reset()
+		}
+		cell.WriteString(glyph.S)
+		end = glyph.X + glyph.W
+	}
+	if text := strings.TrimSpace(cell.String()); text != "" {
+		cells = append(cells, text)
+	}
+	return cells
+}
+
+// looksTabular requires a consistent column count and some numeric cells, so
+// multi-column prose isn't mistaken for a table
+func looksTabular(rows [][]string) bool {
+	counts := make(map[int]int)
+	for _, row := range rows {
+		counts[len(row)]++
+	}
+	mode, modeRows := 0, 0
+	for columns, n := range counts {
+		if n > modeRows {
+			mode, modeRows = columns, n
+		}
+	}
+
+	aligned, cells, numeric := 0, 0, 0
+	for _, row := range rows {
+		if len(row) >= mode-1 && len(row) <= mode+1 {
+			aligned++
+		}
+		for _, cell := range row {
+			cells++
+			if strings.IndexFunc(cell, unicode.IsDigit) >= 0 {
+				numeric++
+			}
+		}
+	}
+	return aligned*10 >= len(rows)*8 && numeric*5 >= cells
+}
+
+// formatTableChunks renders a table as pipe-delimited rows, splitting long
+// tables into chunks that each repeat the header row
+func formatTableChunks(rows [][]string) []string {
+	format := func(cells []string) string {
+		return "| " + strings.Join(cells, " | ") + " |"
+	}
+
+	header := format(rows[0])
+	var chunks []string
+	var current []string
+	size := 0
+	for _, row := range rows[1:] {
+		line := format(row)
+		runes := utf8.RuneCountInString(line) + 1
+		if len(current) > 0 && size+runes > maxTableChunkRunes {
+			chunks = append(chunks, strings.Join(append([]string{header}, current...), "\n"))
+			current, size = nil, utf8.RuneCountInString(header)
+		}
+		current = append(current, line)
+		size += runes
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(append([]string{header}, current...), "\n"))
+	}
+	return chunks
+}
+
+// tableChunks extracts a page's tables as PDF chunks
+func (p *PDFProcessor) tableChunks(page pdf.Page, pageNum int, filename string) []PDFChunk {
+	var chunks []PDFChunk
+	for tableIndex, table := range extractTables(page) {
+		for _, text := range formatTableChunks(table) {
+			chunks = append(chunks, PDFChunk{
+				Text:     text,
+				Page:     pageNum,
+				Document: filename,
+				Type:     ChunkTypeTable,
+				Metadata: map[string]interface{}{
+					"page":     pageNum,
+					"filename": filename,
+					"table":    fmt.Sprintf("p%d_t%d", pageNum, tableIndex+1),
+				},
+			})
+		}
+	}
+	return chunks
+}
+
+// tableSliceMarker separates the answer from the quoted table rows
+const tableSliceMarker = "TABLE USED:"
+
+// hasTableChunk reports whether any retrieved chunk is a table
+func hasTableChunk(chunks []ScoredChunk) bool {
+	for _, chunk := range chunks {
+		if chunk.Chunk.ChunkType == ChunkTypeTable {
+			return true
+		}
+	}
+	return false
+}
+
+// tablePrompt asks for exact cell values plus the table rows the answer is
+// based on, which keeps numbers from being rounded or recomputed
+func tablePrompt(lang, context, question string) string {
+	languageInstruction := ""
+	if lang != "" && lang != "en" {
+		languageInstruction = "\n- Write the answer in " + languageName(lang) + "."
+	}
+
+	return fmt.Sprintf(`Answer this question using ONLY the information provided in the context below. Some of the context is tables, written as rows with cells separated by "|" and the header row first.
+
+Rules:
+- Quote numbers and cell values exactly as they appear in the table. Do not round, convert units or recalculate them.
+- If the value is not in the context, say you don't have that information.%s
+- After the answer, write a line "%s" followed by the header row and only the table rows you used, in the same "|" format. Leave it out if you did not use a table.
+
+CONTEXT:
+%s
+
+QUESTION: %s
+
+ANSWER:`, languageInstruction, tableSliceMarker, context, question)
+}
+
+// splitTableSlice separates the quoted table rows from the answer text
+func splitTableSlice(answer string) (string, string) {
+	i := strings.Index(answer, tableSliceMarker)
+	if i < 0 {
+		return strings.TrimSpace(answer), ""
+	}
+	return strings.TrimSpace(answer[:i]), strings.TrimSpace(answer[i+len(tableSliceMarker):])
+}
@@ -0,0 +1,181 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// TelemetryReport is everything telemetry sends. It holds no document
+// names, questions, hostnames or identifiers; corpus sizes are bucketed.
+type TelemetryReport struct {
+	Version         string  `json:"version"`
+	GoVersion       string  `json:"go_version"`
+	OS              string  `json:"os"`
+	Arch            string  `json:"arch"`
+	LLMProvider     string  `json:"llm_provider"`
+	Documents       string  `json:"documents"`
+	Chunks          string  `json:"chunks"`
+	PeriodHours     float64 `json:"period_hours"`
+	Requests        int64   `json:"requests"`
+	ClientErrorRate float64 `json:"client_error_rate"`
+	ServerErrorRate float64 `json:"server_error_rate"`
+	LLMErrors       int64   `json:"llm_errors"`
+	LLMSaturated    int64   `json:"llm_saturated"`
+}
+
+// TelemetryReporter periodically posts a TelemetryReport covering the
+// period since the last successful send
+type TelemetryReporter struct {
+	Endpoint       string
+	Interval       time.Duration
+	Client         *http.Client
+	DatabaseSchema *DatabaseSchema
+	provider       string
+
+	mu           sync.Mutex
+	since        time.Time
+	requests     map[string]int64
+	llmErrors    int64
+	llmSaturated int64
+}
+
+func NewTelemetryReporter(cfg *config.Config, ds *DatabaseSchema) *TelemetryReporter {
+	interval := cfg.TelemetryInterval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	return &TelemetryReporter{
+		Endpoint:       cfg.TelemetryEndpoint,
+		Interval:       interval,
+		Client:         &http.Client{Timeout: 10 * time.Second},
+		DatabaseSchema: ds,
+		provider:       strings.ToLower(cfg.LLMProvider),
+		since:          time.Now(),
+		requests:       make(map[string]int64),
+	}
+}
+
+// Report builds the report that would be sent now
+func (t *TelemetryReporter) Report() TelemetryReport {
+	requests, llmErrors, llmSaturated := DefaultMetrics.Counters()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := TelemetryReport{
+		Version:      Version,
+		GoVersion:    runtime.Version(),
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		LLMProvider:  t.provider,
+		PeriodHours:  time.Since(t.since).Hours(),
+		LLMErrors:    llmErrors - t.llmErrors,
+		LLMSaturated: llmSaturated - t.llmSaturated,
+	}
+
+	if usage, err := t.DatabaseSchema.GetStorageUsage(); err == nil {
+		report.Documents = sizeBucket(usage.Documents)
+		report.Chunks = sizeBucket(usage.Chunks)
+	}
+
+	var clientErrors, serverErrors int64
+	for class, count := range requests {
+		delta := count - t.requests[class]
+		report.Requests += delta
+		switch class {
+		case "4xx":
+			clientErrors = delta
+		case "5xx":
+			serverErrors = delta
+		}
+	}
+	if report.Requests > 0 {
+		report.ClientErrorRate = float64(clientErrors) / float64(report.Requests)
+		report.ServerErrorRate = float64(serverErrors) / float64(report.Requests)
+	}
+
+	return report
+}
+
+// Start sends a report every Interval until ctx is cancelled
+func (t *TelemetryReporter) Start(ctx context.Context) {
+	log.Printf("✅ Anonymous telemetry enabled, reporting to %s every %s", t.Endpoint, t.Interval)
+
+	go func() {
+		ticker := time.NewTicker(t.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := t.send(ctx); err != nil {
+					log.Printf("Warning: failed to send telemetry: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (t *TelemetryReporter) send(ctx context.Context) error {
+	requests, llmErrors, llmSaturated := DefaultMetrics.Counters()
+	report := t.Report()
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint returned status %d", resp.StatusCode)
+	}
+
+	// The next report covers only what happened after this one
+	t.mu.Lock()
+	t.since = time.Now()
+	t.requests = requests
+	t.llmErrors = llmErrors
+	t.llmSaturated = llmSaturated
+	t.mu.Unlock()
+	return nil
+}
+
+// sizeBucket reports a count as a coarse range so corpus sizes can't
+// identify a deployment
+func sizeBucket(n int) string {
+	switch {
+	case n == 0:
+		return "0"
+	case n <= 10:
+		return "1-10"
+	case n <= 100:
+		return "11-100"
+	case n <= 1000:
+		return "101-1000"
+	case n <= 10000:
+		return "1001-10000"
+	}
+	return "10000+"
+}
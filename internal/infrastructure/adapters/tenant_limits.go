@@ -0,0 +1,184 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTenantQueueFull is returned when a tenant already has as many jobs
+	// of a kind waiting as its queue allows
+	ErrTenantQueueFull = errors.New("too many requests already queued for this user")
+	// ErrTenantQueueTimeout is returned when a tenant's job waited longer
+	// than allowed for one of the tenant's slots
+	ErrTenantQueueTimeout = errors.New("timed out waiting behind this user's other requests")
+)
+
+// QueueWait reports how a request queued for a slot: the longest line it
+// joined, 1 meaning it was next, and how long it waited in total
+type QueueWait struct {
+	Position int     `json:"position"`
+	WaitedMs float64 `json:"waited_ms"`
+}
+
+type queueWaitKey struct{}
+
+// WithQueueWait attaches a queue report to the context for limiters to fill
+// in
+func WithQueueWait(ctx context.Context, wait *QueueWait) context.Context {
+	return context.WithValue(ctx, queueWaitKey{}, wait)
+}
+
+// QueueWaitFromContext returns the queue report attached to ctx, or nil
+func QueueWaitFromContext(ctx context.Context) *QueueWait {
+	wait, _ := ctx.Value(queueWaitKey{}).(*QueueWait)
+	return wait
+}
+
+// Queued reports whether the request waited at all
+func (w *QueueWait) Queued() bool {
+	return w != nil && w.Position > 0
+}
+
+// record adds a wait at position. Safe on a nil report.
+func (w *QueueWait) record(position int, waited time.Duration) {
+	if w == nil {
+		return
+	}
+	if position > w.Position {
+		w.Position = position
+	}
+	w.WaitedMs += durationMs(waited)
+}
+
+// TenantLimiter caps how many jobs of one kind each tenant, the verified
+// caller behind a request (see CollectionAccess.Tenant), runs at once, and how many more may wait
+// in line behind them, so one heavy user can't take every slot of a shared
+// instance. Jobs without a caller in their context, such as background
+// work, aren't limited.
+type TenantLimiter struct {
+	Kind string
+
+	mu            sync.Mutex
+	maxConcurrent int
+	maxQueued     int
+	tenants       map[string]*tenantSlots
+}
+
+type tenantSlots struct {
+	running int
+	// waiting are the queued jobs in arrival order; a job is handed its
+	// slot by closing its channel
+	waiting []chan struct{}
+}
+
+// NewTenantLimiter limits each tenant to maxConcurrent jobs of kind, with
+// up to maxQueued waiting (zero for no cap). Zero maxConcurrent disables
+// the limit.
+func NewTenantLimiter(kind string, maxConcurrent, maxQueued int) *TenantLimiter {
+	l := &TenantLimiter{Kind: kind, tenants: make(map[string]*tenantSlots)}
+	l.Configure(maxConcurrent, maxQueued)
+	return l
+}
+
+// Configure changes the limits; jobs already running or queued keep their
+// places
+func (l *TenantLimiter) Configure(maxConcurrent, maxQueued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxConcurrent = maxConcurrent
+	l.maxQueued = maxQueued
+}
+
+// Acquire waits for one of the calling tenant's slots, up to maxWait when
+// it is positive, recording the wait in the context's QueueWait. The
+// returned function gives the slot back.
+func (l *TenantLimiter) Acquire(ctx context.Context, maxWait time.Duration) (func(), error) {
+	access := CollectionAccessFromContext(ctx)
+	if l == nil || access == nil || access.Tenant == "" {
+		return func() {}, nil
+	}
+	tenant := access.Tenant
+
+	l.mu.Lock()
+	if l.maxConcurrent <= 0 {
+		l.mu.Unlock()
+		return func() {}, nil
+	}
+	slots := l.tenants[tenant]
+	if slots == nil {
+		slots = &tenantSlots{}
+		l.tenants[tenant] = slots
+	}
+	if slots.running < l.maxConcurrent && len(slots.waiting) == 0 {
+		slots.running++
+		l.mu.Unlock()
+		return func() { l.release(tenant) }, nil
+	}
+	if l.maxQueued > 0 && len(slots.waiting) >= l.maxQueued {
+		l.mu.Unlock()
+		return nil, ErrTenantQueueFull
+	}
+	ready := make(chan struct{})
+	slots.waiting = append(slots.waiting, ready)
+	position := len(slots.waiting)
+	l.mu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		QueueWaitFromContext(ctx).record(position, time.Since(start))
+	}()
+
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-ready:
+		return func() { l.release(tenant) }, nil
+	case <-timeout:
+		err = ErrTenantQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// Leave the line, unless the slot was handed over meanwhile, in which
+	// case it is passed on
+	l.mu.Lock()
+	for i, waiting := range slots.waiting {
+		if waiting == ready {
+			slots.waiting = append(slots.waiting[:i], slots.waiting[i+1:]...)
+			l.mu.Unlock()
+			return nil, err
+		}
+	}
+	l.mu.Unlock()
+	l.release(tenant)
+	return nil, err
+}
+
+// release hands the tenant's slot to its next waiting job, or frees it
+func (l *TenantLimiter) release(tenant string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slots := l.tenants[tenant]
+	if slots == nil {
+		return
+	}
+	if len(slots.waiting) > 0 {
+		next := slots.waiting[0]
+		slots.waiting = slots.waiting[1:]
+		close(next)
+		return
+	}
+	slots.running--
+	if slots.running <= 0 {
+		delete(l.tenants, tenant)
+	}
+}
@@ -0,0 +1,44 @@
+package adapters
+
+import "unicode/utf8"
+
+// Text directions reported alongside answers and snippets so clients can set
+// dir="rtl" instead of guessing from mixed-script text
+const (
+	DirectionLTR = "ltr"
+	DirectionRTL = "rtl"
+)
+
+// TruncateRunes shortens s to at most n characters without splitting a
+// multi-byte character, adding an ellipsis when text was cut
+func TruncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return capRunes(s, n) + "..."
+}
+
+// capRunes cuts s to at most n characters on a character boundary
+func capRunes(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	count := 0
+	for i := range s {
+		if count == n {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
+
+// TextDirection returns the base direction for rendering text, based on its
+// dominant script
+func TextDirection(s string) string {
+	switch DetectScript(s) {
+	case ScriptArabic, ScriptHebrew:
+		return DirectionRTL
+	}
+	return DirectionLTR
+}
@@ -0,0 +1,153 @@
+package adapters
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ThumbnailRenderer renders the first page of a PDF to a small PNG. It uses
+// poppler's pdftoppm when installed and otherwise draws a layout sketch
+// (text lines and rectangles) from the page content in pure Go.
+type ThumbnailRenderer struct {
+	Width    int
+	pdftoppm string
+}
+
+func NewThumbnailRenderer(width int) *ThumbnailRenderer {
+	if width <= 0 {
+		width = 200
+	}
+	pdftoppm, _ := exec.LookPath("pdftoppm")
+	return &ThumbnailRenderer{Width: width, pdftoppm: pdftoppm}
+}
+
+// UsesPoppler reports whether thumbnails are rendered with pdftoppm
+func (t *ThumbnailRenderer) UsesPoppler() bool {
+	return t.pdftoppm != ""
+}
+
+// Render returns a PNG thumbnail of the first page
+func (t *ThumbnailRenderer) Render(pdfData []byte) ([]byte, error) {
+	if t.pdftoppm != "" {
+		data, err := t.renderWithPoppler(pdfData)
+		if err == nil {
+			return data, nil
+		}
+		log.Printf("Warning: pdftoppm failed, falling back to layout thumbnail: %v", err)
+	}
+	return t.renderLayout(pdfData)
+}
+
+func (t *ThumbnailRenderer) renderWithPoppler(pdfData []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "thumbnail")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.pdf")
+	if err := os.WriteFile(input, pdfData, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write temp PDF: %w", err)
+	}
+
+	output := filepath.Join(dir, "thumb")
+	cmd := exec.Command(t.pdftoppm, "-png", "-f", "1", "-l", "1", "-singlefile",
+		"-scale-to-x", strconv.Itoa(t.Width), "-scale-to-y", "-1", input, output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+
+	return os.ReadFile(output + ".png")
+}
+
+// renderLayout draws grey bars where text sits on the first page. It is a
+// rough preview, but needs no external tools.
+func (t *ThumbnailRenderer) renderLayout(pdfData []byte) (data []byte, err error) {
+	// The PDF library panics on some malformed content streams
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to read PDF page: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(pdfData), int64(len(pdfData)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	if reader.NumPage() < 1 {
+		return nil, fmt.Errorf("PDF has no pages")
+	}
+
+	page := reader.Page(1)
+	pageWidth, pageHeight := pageSize(page)
+	scale := float64(t.Width) / pageWidth
+	height := int(pageHeight * scale)
+
+	img := image.NewRGBA(image.Rect(0, 0, t.Width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	content := page.Content()
+	ink := image.NewUniform(color.RGBA{R: 120, G: 120, B: 120, A: 255})
+	for _, text := range content.Text {
+		w := text.W
+		if w <= 0 {
+			w = text.FontSize * 0.5
+		}
+		x0 := int(text.X * scale)
+		x1 := int((text.X+w)*scale) + 1
+		y1 := height - int(text.Y*scale)
+		y0 := y1 - int(text.FontSize*0.7*scale) - 1
+		draw.Draw(img, image.Rect(x0, y0, x1, y1), ink, image.Point{}, draw.Over)
+	}
+
+	outline := image.NewUniform(color.RGBA{R: 190, G: 190, B: 190, A: 255})
+	for _, rect := range content.Rect {
+		r := image.Rect(int(rect.Min.X*scale), height-int(rect.Max.Y*scale), int(rect.Max.X*scale), height-int(rect.Min.Y*scale))
+		drawOutline(img, r, outline)
+	}
+
+	drawOutline(img, img.Bounds(), image.NewUniform(color.RGBA{R: 210, G: 210, B: 210, A: 255}))
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// pageSize reads the (possibly inherited) MediaBox, defaulting to US Letter
+func pageSize(page pdf.Page) (float64, float64) {
+	for v := page.V; !v.IsNull(); v = v.Key("Parent") {
+		box := v.Key("MediaBox")
+		if box.Len() == 4 {
+			width := box.Index(2).Float64() - box.Index(0).Float64()
+			height := box.Index(3).Float64() - box.Index(1).Float64()
+			if width > 0 && height > 0 {
+				return width, height
+			}
+		}
+	}
+	return 612, 792
+}
+
+func drawOutline(img *image.RGBA, r image.Rectangle, c image.Image) {
+	r = r.Canon().Intersect(img.Bounds())
+	if r.Empty() {
+		return
+	}
+	draw.Draw(img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1), c, image.Point{}, draw.Over)
+	draw.Draw(img, image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y), c, image.Point{}, draw.Over)
+	draw.Draw(img, image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y), c, image.Point{}, draw.Over)
+	draw.Draw(img, image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y), c, image.Point{}, draw.Over)
+}
@@ -0,0 +1,175 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Storage tiers recorded in documents.storage_tier
+const (
+	StorageTierHot     = "hot"
+	StorageTierArchive = "archive"
+	StorageTierDeleted = "deleted"
+	// StorageTierNone marks documents without an original, such as text
+	// pushed through an ingest stream
+	StorageTierNone = "none"
+)
+
+// Tiering modes: move originals to the archive bucket or delete them,
+// keeping chunks either way
+const (
+	TieringModeArchive = "archive"
+	TieringModeDelete  = "delete"
+)
+
+// ErrOriginalDeleted means tiering removed the original PDF; its chunks are
+// still searchable
+var ErrOriginalDeleted = errors.New("original PDF was removed by storage tiering")
+
+// ErrNoOriginal means the document was ingested as text, without a PDF
+var ErrNoOriginal = errors.New("document has no original file")
+
+// TieringResult lists the documents a tiering pass moved or deleted
+type TieringResult struct {
+	Archived []string `json:"archived"`
+	Deleted  []string `json:"deleted"`
+}
+
+// RunTiering moves originals of documents not created or downloaded within
+// TieringAfter out of the hot bucket
+func (r *SimpleRAGService) RunTiering(ctx context.Context) (*TieringResult, error) {
+	result := &TieringResult{Archived: []string{}, Deleted: []string{}}
+	if r.Config.TieringAfter <= 0 {
+		return result, nil
+	}
+
+	// Write pending downloads first so just-used originals stay hot
+	r.Access.Flush()
+	candidates, err := r.DatabaseSchema.GetTieringCandidates(r.Config.TieringAfter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tiering candidates: %w", err)
+	}
+	if len(candidates) == 0 {
+		return result, nil
+	}
+
+	deleteOriginals := r.Config.TieringMode == TieringModeDelete
+	if !deleteOriginals {
+		if err := r.MinIOAdapter.EnsureBucket(ctx, r.Config.TieringBucket); err != nil {
+			return nil, err
+		}
+	}
+
+	// Documents with identical content share one object, so move it once
+	seen := make(map[string]bool)
+	for _, doc := range candidates {
+		if seen[doc.Filename] {
+			continue
+		}
+		seen[doc.Filename] = true
+
+		if deleteOriginals {
+			if err := r.moveOutOriginal(ctx, doc.Filename, StorageTierDeleted); err != nil {
+				log.Printf("Warning: failed to delete original of %s: %v", doc.ID, err)
+				continue
+			}
+			result.Deleted = append(result.Deleted, doc.ID)
+			continue
+		}
+
+		if err := r.moveOutOriginal(ctx, doc.Filename, StorageTierArchive); err != nil {
+			log.Printf("Warning: failed to archive original of %s: %v", doc.ID, err)
+			continue
+		}
+		result.Archived = append(result.Archived, doc.ID)
+	}
+
+	log.Printf("✅ Storage tiering archived %d and deleted %d originals", len(result.Archived), len(result.Deleted))
+	return result, nil
+}
+
+// moveOutOriginal deletes an original, or moves it to the tiering bucket
+// for StorageTierArchive, and records its new tier. It holds lockBlob
+// throughout so an upload can't reuse the object in between.
+func (r *SimpleRAGService) moveOutOriginal(ctx context.Context, objectName, tier string) error {
+	defer r.lockBlob(objectName)()
+
+	var err error
+	if tier == StorageTierArchive {
+		err = r.MinIOAdapter.MoveObject(ctx, "documents", r.Config.TieringBucket, objectName)
+	} else {
+		err = r.MinIOAdapter.RemoveObject(ctx, "documents", objectName)
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.DatabaseSchema.SetStorageTier(objectName, tier); err != nil {
+		return fmt.Errorf("failed to record storage tier: %w", err)
+	}
+	return nil
+}
+
+// StartTiering runs RunTiering every TieringInterval until ctx is cancelled
+func (r *SimpleRAGService) StartTiering(ctx context.Context) {
+	interval := r.Config.TieringInterval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	log.Printf("✅ Storage tiering enabled: %s originals unused for %s, checking every %s", r.Config.TieringMode, r.Config.TieringAfter, interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := r.RunTiering(ctx); err != nil {
+					log.Printf("Warning: storage tiering failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// GetOriginal returns a stored PDF, restoring it from the archive bucket
+// first if tiering moved it there, and records the download. Content-addressed
+// originals are checked against their hash.
+func (r *SimpleRAGService) GetOriginal(ctx context.Context, documentID, filename string) ([]byte, error) {
+	doc, err := r.DatabaseSchema.GetDocument(documentID)
+	if err != nil || doc.OriginalFilename != filename {
+		// Not a document original; serve the object under the document's prefix
+		return r.MinIOAdapter.GetObject(ctx, "documents", fmt.Sprintf("%s/%s", documentID, filename))
+	}
+
+	switch doc.StorageTier {
+	case StorageTierDeleted:
+		return nil, ErrOriginalDeleted
+	case StorageTierNone:
+		return nil, ErrNoOriginal
+	case StorageTierArchive:
+		if err := r.MinIOAdapter.MoveObject(ctx, r.Config.TieringBucket, "documents", doc.Filename); err != nil {
+			return nil, fmt.Errorf("failed to restore archived original: %w", err)
+		}
+		if err := r.DatabaseSchema.SetStorageTier(doc.Filename, StorageTierHot); err != nil {
+			log.Printf("Warning: failed to record storage tier for %s: %v", documentID, err)
+		}
+		log.Printf("Restored archived original of %s", documentID)
+	}
+
+	r.Access.Downloaded(documentID)
+
+	data, err := r.MinIOAdapter.GetObject(ctx, "documents", doc.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if doc.ContentHash != "" && ContentHash(data) != doc.ContentHash {
+		return nil, fmt.Errorf("%w: %s", ErrIntegrity, doc.Filename)
+	}
+	return data, nil
+}
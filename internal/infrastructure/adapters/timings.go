@@ -0,0 +1,61 @@
+package adapters
+
+import (
+	"context"
+	"time"
+)
+
+// Timings reports where the time answering a question went, so clients can
+// set expectations and spot slowness without server logs. RerankMs is the
+// cross-lingual fallback re-scoring chunks with the translated question;
+// LLMMs covers answer generation and translation.
+type Timings struct {
+	RetrievalMs float64 `json:"retrieval_ms"`
+	RerankMs    float64 `json:"rerank_ms"`
+	LLMMs       float64 `json:"llm_ms"`
+	TotalMs     float64 `json:"total_ms"`
+}
+
+type timingsKey struct{}
+
+// WithTimings attaches timings to the context for the pipeline to fill in
+func WithTimings(ctx context.Context, timings *Timings) context.Context {
+	return context.WithValue(ctx, timingsKey{}, timings)
+}
+
+// TimingsFromContext returns the timings attached to ctx, or nil
+func TimingsFromContext(ctx context.Context) *Timings {
+	timings, _ := ctx.Value(timingsKey{}).(*Timings)
+	return timings
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// AddRetrieval, AddRerank and AddLLM add a stage's duration. Safe on nil
+// timings.
+func (t *Timings) AddRetrieval(d time.Duration) {
+	if t != nil {
+		t.RetrievalMs += durationMs(d)
+	}
+}
+
+func (t *Timings) AddRerank(d time.Duration) {
+	if t != nil {
+		t.RerankMs += durationMs(d)
+	}
+}
+
+func (t *Timings) AddLLM(d time.Duration) {
+	if t != nil {
+		t.LLMMs += durationMs(d)
+	}
+}
+
+// Finish sets the total time since start
+func (t *Timings) Finish(start time.Time) {
+	if t != nil {
+		t.TotalMs = durationMs(time.Since(start))
+	}
+}
@@ -0,0 +1,89 @@
+package adapters
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// maxTranslatedSnippets caps how many cited snippets are translated per answer
+const maxTranslatedSnippets = 3
+
+// AnswerTranslation keeps the original answer and snippets next to their
+// translations so clients can show both
+type AnswerTranslation struct {
+	Language       string              `json:"language"`
+	OriginalAnswer string              `json:"original_answer"`
+	Snippets       []TranslatedSnippet `json:"snippets"`
+}
+
+type TranslatedSnippet struct {
+	DocumentID string `json:"document_id"`
+	Page       int    `json:"page"`
+	Original   string `json:"original"`
+	Translated string `json:"translated"`
+	Direction  string `json:"direction"`
+}
+
+// TranslateText translates arbitrary text into the target language using the LLM
+func (r *SimpleRAGService) TranslateText(ctx context.Context, text, language string) (string, error) {
+	translated, err := r.LLM.GenerateText(ctx, translationPrompt(text, language))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(translated), nil
+}
+
+func translationPrompt(text, language string) string {
+	return "Translate the following text to " + languageName(language) +
+		". Preserve numbers, names and formatting. Return only the translation without quotes or extra commentary.\n\nText:\n" + text
+}
+
+// translateResponse replaces the answer with its translation and adds
+// translated snippets of the cited chunks. Failures leave the response as is.
+func (r *SimpleRAGService) translateResponse(ctx context.Context, response *SimpleRAGResponse, language string) {
+	if !r.canGenerate() || strings.TrimSpace(response.Answer) == "" {
+		return
+	}
+	if answerLanguage, _ := DetectLanguage(response.Answer); answerLanguage == language {
+		return
+	}
+
+	translated, err := r.TranslateText(ctx, response.Answer, language)
+	if err != nil || translated == "" {
+		log.Printf("Warning: failed to translate answer to %s: %v", language, err)
+		return
+	}
+
+	translation := &AnswerTranslation{
+		Language:       language,
+		OriginalAnswer: response.Answer,
+		Snippets:       []TranslatedSnippet{},
+	}
+
+	for i, scored := range response.chunks {
+		if i >= maxTranslatedSnippets {
+			break
+		}
+		snippet := TruncateRunes(scored.Chunk.ChunkText, 300)
+		translatedSnippet := snippet
+		if snippetLanguage, _ := DetectLanguage(snippet); snippetLanguage != language {
+			translatedSnippet, err = r.TranslateText(ctx, snippet, language)
+			if err != nil {
+				log.Printf("Warning: failed to translate snippet: %v", err)
+				continue
+			}
+		}
+		translation.Snippets = append(translation.Snippets, TranslatedSnippet{
+			DocumentID: scored.Chunk.DocumentID,
+			Page:       scored.Chunk.PageNumber,
+			Original:   snippet,
+			Translated: translatedSnippet,
+			Direction:  TextDirection(translatedSnippet),
+		})
+	}
+
+	response.Answer = translated
+	response.Direction = TextDirection(translated)
+	response.Translation = translation
+}
@@ -0,0 +1,128 @@
+package adapters
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// persianRomanization maps Persian letters to their common Latin spelling,
+// with digraphs already folded the same way as latinDigraphs. Letters that
+// are usually silent in transliteration map to "".
+var persianRomanization = map[rune]string{
+	'ا': "a", 'آ': "a", 'أ': "a", 'إ': "e", 'ب': "b", 'پ': "p", 'ت': "t", 'ث': "s",
+	'ج': "j", 'چ': "c", 'ح': "h", 'خ': "x", 'د': "d", 'ذ': "z", 'ر': "r", 'ز': "z",
+	'ژ': "j", 'س': "s", 'ش': "$", 'ص': "s", 'ض': "z", 'ط': "t", 'ظ': "z", 'ع': "",
+	'غ': "q", 'ف': "f", 'ق': "q", 'ک': "k", 'ك': "k", 'گ': "g", 'ل': "l", 'م': "m",
+	'ن': "n", 'و': "v", 'ه': "h", 'ة': "h", 'ی': "y", 'ي': "y", 'ى': "y", 'ئ': "y",
+	'ؤ': "v", 'ء': "",
+}
+
+// latinDigraphs fold multi-letter spellings to a single symbol so that
+// "khorasan" and "xorasan" or "ghazvin" and "qazvin" share a key. "th" is
+// left alone since in Persian names it is ت followed by ه ("Tehran").
+var latinDigraphs = strings.NewReplacer(
+	"kh", "x", "gh", "q", "ch", "c", "sh", "$", "zh", "j",
+	"dh", "z", "ph", "f", "ck", "k",
+)
+
+// romanizePersian converts Persian/Arabic-script text to a folded Latin spelling
+func romanizePersian(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if latin, ok := persianRomanization[r]; ok {
+			b.WriteString(latin)
+		} else if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// TransliterationKey reduces a name to a script-independent consonant
+// skeleton, e.g. "Tehran", "Teheran" and "تهران" all become "thrn".
+// Vowels are dropped because Persian script usually omits them.
+func TransliterationKey(token string) string {
+	token = strings.ToLower(token)
+	if DetectScript(token) == ScriptArabic {
+		token = romanizePersian(token)
+	} else {
+		token = latinDigraphs.Replace(token)
+	}
+
+	var b strings.Builder
+	var last rune
+	for _, r := range token {
+		switch r {
+		case 'a', 'e', 'i', 'o', 'u', 'y':
+			continue
+		case 'w':
+			r = 'v'
+		}
+		if r == last {
+			continue
+		}
+		if unicode.IsLetter(r) || r == '$' {
+			b.WriteRune(r)
+			last = r
+		}
+	}
+	return b.String()
+}
+
+// romanizedPersianPattern matches spellings English words rarely have but
+// Persian written in Latin letters ("Finglish") often does: kh, zh, gh
+// starting a syllable, q without u, and a leading x for خ
+var romanizedPersianPattern = regexp.MustCompile(`kh|zh|gh[aeiouy]|^gh|q[^u]|q$|^x[aeiou]`)
+
+// romanizedPersian reports whether a Latin-script token looks like Persian
+// typed in Latin letters, e.g. "khorasan" or "qazvin"
+func romanizedPersian(token string) bool {
+	token = strings.ToLower(token)
+	return DetectScript(token) == ScriptLatin && romanizedPersianPattern.MatchString(token)
+}
+
+// transliterationIndex maps the TransliterationKey of a text's tokens to
+// how those tokens were written
+type transliterationIndex map[string][]transliteratedToken
+
+type transliteratedToken struct {
+	script    string
+	romanized bool
+}
+
+func newTransliterationIndex(tokens []string) transliterationIndex {
+	index := make(transliterationIndex, len(tokens))
+	seen := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+		if key := TransliterationKey(token); len(key) >= 3 {
+			index[key] = append(index[key], transliteratedToken{
+				script:    DetectScript(token),
+				romanized: romanizedPersian(token),
+			})
+		}
+	}
+	return index
+}
+
+// matches reports whether token is an indexed name written in another
+// script ("Tehran"/"تهران") or a Latin spelling of Persian ("Khorasan"/
+// "Xorasan"). Two plain Latin words are never matched by key alone, as
+// their consonant skeletons collide too often ("policy"/"police").
+func (index transliterationIndex) matches(token string) bool {
+	key := TransliterationKey(token)
+	if len(key) < 3 {
+		return false
+	}
+	script, romanized := DetectScript(token), romanizedPersian(token)
+	for _, indexed := range index[key] {
+		if indexed.script != script || romanized || indexed.romanized {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package adapters
+
+import (
+	"testing"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+func TestTransliterationKey(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"Tehran", "thrn"},
+		{"Teheran", "thrn"},
+		{"تهران", "thrn"},
+		{"khorasan", "xrsn"},
+		{"xorasan", "xrsn"},
+		{"ghazvin", "qzvn"},
+		{"قزوین", "qzvn"},
+	}
+	for _, tt := range tests {
+		if got := TransliterationKey(tt.token); got != tt.want {
+			t.Errorf("TransliterationKey(%q) = %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestTransliterationMatching(t *testing.T) {
+	r := &SimpleRAGService{Config: &config.Config{TransliterationMatching: true}}
+
+	tests := []struct {
+		name     string
+		question string
+		chunk    string
+		want     bool
+	}{
+		{"Persian question, Latin chunk", "تهران", "The office moved to Tehran in 2019", true},
+		{"Latin question, Persian chunk", "Tehran", "دفتر به تهران منتقل شد", true},
+		{"Persian typed in Latin letters", "khorasan", "Sales grew in Xorasan province", true},
+		{"q for gh", "ghazvin", "The Qazvin branch opened last year", true},
+		{"policy and police", "policy", "Call the police station", false},
+		{"policy and palace", "policy", "The palace was restored", false},
+		{"better and butter", "better", "Melt the butter slowly", false},
+		{"better and bitter", "better", "A bitter taste remains", false},
+		{"council and cancel", "council", "You can cancel at any time", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			features := r.relevanceFeatures([]string{tt.question}, tt.chunk)
+			if got := features.translit > 0; got != tt.want {
+				t.Errorf("transliteration match of %q in %q = %v, want %v", tt.question, tt.chunk, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// Usage kinds a route can be metered as
+const (
+	UsageQueries     = "queries"
+	UsageTokens      = "tokens"
+	UsageUploadBytes = "upload_bytes"
+)
+
+// Quota caps a key's monthly usage; zero means unlimited
+type Quota struct {
+	Queries     int64 `json:"queries"`
+	Tokens      int64 `json:"tokens"`
+	UploadBytes int64 `json:"upload_bytes"`
+}
+
+// QuotaExceededError reports which monthly limit a request would exceed
+type QuotaExceededError struct {
+	Kind   string
+	Used   int64
+	Limit  int64
+	Period string
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("monthly %s quota exceeded: %d of %d used in %s", e.Kind, e.Used, e.Limit, e.Period)
+}
+
+// UsagePeriod is the billing month a time falls in, e.g. "2026-10"
+func UsagePeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// UsageMeter counts LLM tokens spent while handling one request. It travels
+// through the context like DebugTrace.
+type UsageMeter struct {
+	tokens int64
+}
+
+type usageMeterKey struct{}
+
+// WithUsageMeter attaches a meter to the context
+func WithUsageMeter(ctx context.Context, meter *UsageMeter) context.Context {
+	return context.WithValue(ctx, usageMeterKey{}, meter)
+}
+
+// UsageMeterFromContext returns the meter attached to ctx, or nil
+func UsageMeterFromContext(ctx context.Context) *UsageMeter {
+	meter, _ := ctx.Value(usageMeterKey{}).(*UsageMeter)
+	return meter
+}
+
+// AddTokens records tokens a generation used. Safe on a nil meter.
+func (m *UsageMeter) AddTokens(n int) {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(&m.tokens, int64(n))
+}
+
+// Tokens is the total recorded so far
+func (m *UsageMeter) Tokens() int64 {
+	if m == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&m.tokens)
+}
+
+// Quotas tracks usage per API key and enforces monthly limits. Keys are
+// identified by ActorID, so the usage table never holds credentials.
+type Quotas struct {
+	ds *DatabaseSchema
+
+	mu           sync.RWMutex
+	defaultQuota Quota
+}
+
+func NewQuotas(cfg *config.Config, ds *DatabaseSchema) *Quotas {
+	return &Quotas{
+		ds: ds,
+		defaultQuota: Quota{
+			Queries:     cfg.QuotaMonthlyQueries,
+			Tokens:      cfg.QuotaMonthlyTokens,
+			UploadBytes: cfg.QuotaMonthlyUploadBytes,
+		},
+	}
+}
+
+// Default is the quota of keys without an override
+func (q *Quotas) Default() Quota {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.defaultQuota
+}
+
+// SetDefault changes the quota of keys without an override
+func (q *Quotas) SetDefault(quota Quota) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.defaultQuota = quota
+}
+
+// Limits returns the quota for a key: its override if an admin set one,
+// else the configured default
+func (q *Quotas) Limits(keyID string) (Quota, error) {
+	record, err := q.ds.GetQuota(keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return q.Default(), nil
+	}
+	if err != nil {
+		return Quota{}, err
+	}
+	return record.Quota, nil
+}
+
+// Usage returns a key's usage for a period; keys without usage get zeros
+func (q *Quotas) Usage(keyID, period string) (*UsageRecord, error) {
+	usage, err := q.ds.GetUsage(keyID, period)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &UsageRecord{KeyID: keyID, Period: period}, nil
+	}
+	return usage, err
+}
+
+// Check returns a QuotaExceededError if the key has used up its quota of
+// kind this month, or would by adding extra
+func (q *Quotas) Check(keyID, kind string, extra int64) error {
+	limits, err := q.Limits(keyID)
+	if err != nil {
+		return fmt.Errorf("failed to load quota: %w", err)
+	}
+	period := UsagePeriod(time.Now())
+	usage, err := q.Usage(keyID, period)
+	if err != nil {
+		return fmt.Errorf("failed to load usage: %w", err)
+	}
+
+	used := map[string]int64{
+		UsageQueries:     usage.Queries,
+		UsageTokens:      usage.Tokens,
+		UsageUploadBytes: usage.UploadBytes,
+	}
+	limit := map[string]int64{
+		UsageQueries:     limits.Queries,
+		UsageTokens:      limits.Tokens,
+		UsageUploadBytes: limits.UploadBytes,
+	}
+
+	// Queries also spend tokens, so both limits apply to them
+	kinds := []string{kind}
+	if kind == UsageQueries {
+		kinds = append(kinds, UsageTokens)
+	}
+	for _, k := range kinds {
+		if limit[k] <= 0 {
+			continue
+		}
+		// A request of known size may land exactly on the limit; metered
+		// ones are allowed while usage is still below it
+		exceeded := used[k] >= limit[k]
+		if k == kind && extra > 0 {
+			exceeded = used[k]+extra > limit[k]
+		}
+		if exceeded {
+			return &QuotaExceededError{Kind: k, Used: used[k], Limit: limit[k], Period: period}
+		}
+	}
+	return nil
+}
+
+// Record adds usage to the key's current month
+func (q *Quotas) Record(keyID string, usage Quota) error {
+	if usage == (Quota{}) {
+		return nil
+	}
+	return q.ds.AddUsage(keyID, UsagePeriod(time.Now()), usage)
+}
+
+// WriteUsageCSV writes usage records as CSV with a header row
+func WriteUsageCSV(w io.Writer, records []UsageRecord) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"key_id", "period", "queries", "tokens", "upload_bytes", "updated_at"}); err != nil {
+		return err
+	}
+	for _, record := range records {
+		updatedAt := ""
+		if record.UpdatedAt != nil {
+			updatedAt = formatTimestamp(*record.UpdatedAt)
+		}
+		row := []string{
+			record.KeyID,
+			record.Period,
+			strconv.FormatInt(record.Queries, 10),
+			strconv.FormatInt(record.Tokens, 10),
+			strconv.FormatInt(record.UploadBytes, 10),
+			updatedAt,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,97 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// VaultProvider reads secrets from one HashiCorp Vault KV entry, whose
+// fields are named after the secrets (google_api_key, minio_secret_key...)
+type VaultProvider struct {
+	Addr  string
+	Token string
+	// Mount and Path locate the entry; KVVersion is the engine's version
+	Mount     string
+	Path      string
+	KVVersion int
+	Client    *http.Client
+}
+
+func NewVaultProvider(cfg *config.Config) *VaultProvider {
+	return &VaultProvider{
+		Addr:      strings.TrimRight(cfg.VaultAddr, "/"),
+		Token:     cfg.VaultToken,
+		Mount:     strings.Trim(cfg.VaultMount, "/"),
+		Path:      strings.Trim(cfg.VaultPath, "/"),
+		KVVersion: cfg.VaultKVVersion,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (v *VaultProvider) Name() string {
+	return "vault"
+}
+
+// Fetch reads the entry and returns one of its fields. KV version 1 entries
+// carry a lease (the mount's refresh interval); version 2 entries don't.
+func (v *VaultProvider) Fetch(ctx context.Context, name string) (string, time.Duration, error) {
+	endpoint := fmt.Sprintf("%s/v1/%s/%s", v.Addr, v.Mount, v.Path)
+	if v.KVVersion != 1 {
+		endpoint = fmt.Sprintf("%s/v1/%s/data/%s", v.Addr, v.Mount, v.Path)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", 0, ErrSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", 0, fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(reply)))
+	}
+
+	var reply struct {
+		LeaseDuration int             `json:"lease_duration"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return "", 0, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	fields := make(map[string]interface{})
+	if v.KVVersion != 1 {
+		var versioned struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		err = json.Unmarshal(reply.Data, &versioned)
+		fields = versioned.Data
+	} else {
+		err = json.Unmarshal(reply.Data, &fields)
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to decode vault secret: %w", err)
+	}
+
+	value, ok := fields[name].(string)
+	if !ok || value == "" {
+		return "", 0, ErrSecretNotFound
+	}
+	return value, time.Duration(reply.LeaseDuration) * time.Second, nil
+}
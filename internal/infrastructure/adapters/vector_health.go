@@ -0,0 +1,185 @@
+package adapters
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DegradedVectorSearch marks an answer or retrieval ranked lexically only
+// because vector search was unavailable
+const DegradedVectorSearch = "vector_search"
+
+// DegradedMissingVectors marks an answer or retrieval some of whose chunks
+// were ranked lexically only, having no vector from the current embedder
+// yet; BackfillEmbeddings embeds them
+const DegradedMissingVectors = "missing_vectors"
+
+// DegradedIncompatibleVectors marks an answer or retrieval some of whose
+// chunks were ranked lexically only, their stored vectors having other
+// dimensions than the current embedder makes; BackfillEmbeddings re-embeds
+// them
+const DegradedIncompatibleVectors = "incompatible_vectors"
+
+// defaultVectorRetryAfter is how long vector search is skipped after a
+// failure when VECTOR_RETRY_AFTER isn't positive
+const defaultVectorRetryAfter = 30 * time.Second
+
+// Vector search states reported by VectorHealth.Status
+const (
+	VectorSearchHealthy  = "healthy"
+	VectorSearchDegraded = "degraded"
+	VectorSearchDisabled = "disabled"
+)
+
+// VectorHealth tracks whether the embedder and its chunk vectors answer.
+// After a failure, vector search is skipped for RetryAfter so an outage
+// doesn't add the embedder's timeout to every query; the next query after
+// that tries it again.
+type VectorHealth struct {
+	RetryAfter time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	lastError string
+	failedAt  time.Time
+	// setupError is why the configured embedder couldn't be set up
+	setupError string
+}
+
+func NewVectorHealth(retryAfter time.Duration) *VectorHealth {
+	if retryAfter <= 0 {
+		retryAfter = defaultVectorRetryAfter
+	}
+	return &VectorHealth{RetryAfter: retryAfter}
+}
+
+// Available reports whether vector search should be tried
+func (h *VectorHealth) Available() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failures == 0 || time.Since(h.failedAt) >= h.RetryAfter
+}
+
+// Failed records a vector search failure
+func (h *VectorHealth) Failed(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures++
+	h.lastError = err.Error()
+	h.failedAt = time.Now()
+}
+
+// SetupFailed records that the configured embedder couldn't be set up.
+// Vector search stays off, reported degraded, until a restart.
+func (h *VectorHealth) SetupFailed(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.setupError = err.Error()
+}
+
+// SetupError is why the configured embedder couldn't be set up, "" when it
+// was or none is configured
+func (h *VectorHealth) SetupError() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.setupError
+}
+
+// Succeeded records that vector search answered, ending an outage
+func (h *VectorHealth) Succeeded() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures = 0
+	h.lastError = ""
+}
+
+// VectorHealthStatus is vector search's state as reported by /health
+type VectorHealthStatus struct {
+	Status string `json:"status"`
+	// Failures counts the failures in a row since vector search last
+	// answered
+	Failures  int        `json:"failures,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	FailedAt  *time.Time `json:"failed_at,omitempty"`
+}
+
+// Status reports vector search's state; it is degraded from a failure
+// until it answers again
+func (h *VectorHealth) Status() VectorHealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failures == 0 {
+		return VectorHealthStatus{Status: VectorSearchHealthy}
+	}
+	failedAt := h.failedAt.UTC()
+	return VectorHealthStatus{
+		Status:    VectorSearchDegraded,
+		Failures:  h.failures,
+		LastError: h.lastError,
+		FailedAt:  &failedAt,
+	}
+}
+
+// VectorStatus reports the service's vector search state: disabled without
+// an embedder, degraded when the configured one couldn't be set up
+func (r *SimpleRAGService) VectorStatus() VectorHealthStatus {
+	if r.Embedder == nil {
+		if setupError := r.VectorHealth.SetupError(); setupError != "" {
+			return VectorHealthStatus{Status: VectorSearchDegraded, LastError: setupError}
+		}
+		return VectorHealthStatus{Status: VectorSearchDisabled}
+	}
+	return r.VectorHealth.Status()
+}
+
+// Degradation collects the parts of a request's pipeline that fell back to
+// a lesser one, such as DegradedVectorSearch, instead of failing it
+type Degradation struct {
+	mu      sync.Mutex
+	reasons []string
+}
+
+type degradationKey struct{}
+
+// WithDegradation attaches a degradation report to the context for the
+// pipeline to fill in
+func WithDegradation(ctx context.Context, degradation *Degradation) context.Context {
+	return context.WithValue(ctx, degradationKey{}, degradation)
+}
+
+// DegradationFromContext returns the degradation report attached to ctx, or
+// nil
+func DegradationFromContext(ctx context.Context) *Degradation {
+	degradation, _ := ctx.Value(degradationKey{}).(*Degradation)
+	return degradation
+}
+
+// Add records a fallback once. Safe on a nil report.
+func (d *Degradation) Add(reason string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, r := range d.reasons {
+		if r == reason {
+			return
+		}
+	}
+	d.reasons = append(d.reasons, reason)
+}
+
+// Reasons lists the recorded fallbacks, nil when there were none. Safe on a
+// nil report.
+func (d *Degradation) Reasons() []string {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.reasons) == 0 {
+		return nil
+	}
+	return append([]string(nil), d.reasons...)
+}
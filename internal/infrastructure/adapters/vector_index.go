@@ -0,0 +1,374 @@
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// vectorIndexMagic starts a vector index file and versions its layout
+var vectorIndexMagic = []byte("RAGVEC01")
+
+// defaultVectorIndexSaveInterval applies when VECTOR_INDEX_SAVE_INTERVAL is
+// unset
+const defaultVectorIndexSaveInterval = 5 * time.Minute
+
+// VectorIndex keeps the current embedder's chunk vectors in memory in front
+// of chunk_embeddings. Vectors it lacks are read from the database once and
+// kept. With VECTOR_INDEX_PATH set it is saved to that file and loaded at
+// startup, so a restart reads one file instead of every vector from MySQL.
+// The file is streamed both ways: loading it takes about the memory of the
+// vectors it holds, not that plus the file.
+//
+// The file holds a header, the chunk IDs, then every vector as one
+// contiguous block of little-endian float32s starting at a 4-byte aligned
+// offset:
+//
+//	magic "RAGVEC01" | dims uint32 | count uint32 | model length uint32 | model
+//	count × (id length uint16 | id) | zero padding to a multiple of 4
+//	count × dims float32
+type VectorIndex struct {
+	Model string
+	// Dims is the length of Model's vectors; the index holds no others
+	Dims int
+	Path string
+
+	mu      sync.RWMutex
+	vectors map[string][]float32
+	dirty   bool
+}
+
+func NewVectorIndex(model string, dims int, path string) *VectorIndex {
+	return &VectorIndex{Model: model, Dims: dims, Path: path, vectors: make(map[string][]float32)}
+}
+
+// Len is how many vectors the index holds
+func (x *VectorIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.vectors)
+}
+
+// Put adds or replaces a chunk's vector; one of another length than Dims
+// is left out
+func (x *VectorIndex) Put(chunkID string, vector []float32) {
+	if len(vector) != x.Dims {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.vectors[chunkID] = vector
+	x.dirty = true
+}
+
+// Lookup returns the vectors the index holds for chunkIDs and the IDs it
+// doesn't hold
+func (x *VectorIndex) Lookup(chunkIDs []string) (map[string][]float32, []string) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	found := make(map[string][]float32, len(chunkIDs))
+	var missing []string
+	for _, id := range chunkIDs {
+		if vector, ok := x.vectors[id]; ok {
+			found[id] = vector
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return found, missing
+}
+
+// Retain drops the vectors of chunks not in live, e.g. of deleted documents
+// or superseded chunk versions
+func (x *VectorIndex) Retain(live map[string]bool) int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	dropped := 0
+	for id := range x.vectors {
+		if !live[id] {
+			delete(x.vectors, id)
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		x.dirty = true
+	}
+	return dropped
+}
+
+// Load replaces the index's vectors with those saved at Path. A missing
+// file loads nothing; a file written for another embedder is ignored.
+func (x *VectorIndex) Load() (int, error) {
+	if x.Path == "" {
+		return 0, nil
+	}
+	file, err := os.Open(x.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	model, vectors, err := readVectorIndex(bufio.NewReader(file), info.Size())
+	if err != nil {
+		return 0, fmt.Errorf("vector index %s: %w", x.Path, err)
+	}
+	if model != x.Model {
+		return 0, fmt.Errorf("vector index %s was built by %s, not %s; ignoring it", x.Path, model, x.Model)
+	}
+	for _, vector := range vectors {
+		if len(vector) != x.Dims {
+			return 0, fmt.Errorf("vector index %s holds %d-dimension vectors, %s makes %d; ignoring it", x.Path, len(vector), x.Model, x.Dims)
+		}
+		break
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.vectors = vectors
+	x.dirty = false
+	return len(vectors), nil
+}
+
+// Save writes the index to Path if it changed since it was loaded or last
+// saved. The file is replaced atomically, so a crash mid-save leaves the
+// previous one.
+func (x *VectorIndex) Save() error {
+	if x.Path == "" {
+		return nil
+	}
+	x.mu.Lock()
+	if !x.dirty {
+		x.mu.Unlock()
+		return nil
+	}
+	// Put replaces vectors rather than changing them, so copying the map
+	// is enough to write it without holding the lock
+	vectors := make(map[string][]float32, len(x.vectors))
+	for id, vector := range x.vectors {
+		vectors[id] = vector
+	}
+	x.dirty = false
+	x.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(x.Path), filepath.Base(x.Path)+".*.tmp")
+	if err == nil {
+		w := bufio.NewWriter(tmp)
+		err = writeVectorIndex(w, x.Model, vectors)
+		if err == nil {
+			err = w.Flush()
+		}
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), x.Path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		x.mu.Lock()
+		x.dirty = true
+		x.mu.Unlock()
+		return fmt.Errorf("failed to save vector index: %w", err)
+	}
+	return nil
+}
+
+// writeVectorIndex writes vectors in the index file format; vectors of
+// another length than the first are left out
+func writeVectorIndex(w io.Writer, model string, vectors map[string][]float32) error {
+	dims := 0
+	ids := make([]string, 0, len(vectors))
+	for id, vector := range vectors {
+		if dims == 0 {
+			dims = len(vector)
+		}
+		if len(vector) == dims && len(id) <= math.MaxUint16 {
+			ids = append(ids, id)
+		}
+	}
+
+	var header bytes.Buffer
+	header.Write(vectorIndexMagic)
+	binary.Write(&header, binary.LittleEndian, uint32(dims))
+	binary.Write(&header, binary.LittleEndian, uint32(len(ids)))
+	binary.Write(&header, binary.LittleEndian, uint32(len(model)))
+	header.WriteString(model)
+	for _, id := range ids {
+		binary.Write(&header, binary.LittleEndian, uint16(len(id)))
+		header.WriteString(id)
+	}
+	for header.Len()%4 != 0 {
+		header.WriteByte(0)
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := w.Write(encodeVector(vectors[id])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readVectorIndex decodes an index file of size bytes from r, one vector
+// at a time, so loading holds the decoded vectors and not the file as well
+func readVectorIndex(r io.Reader, size int64) (string, map[string][]float32, error) {
+	magic := make([]byte, len(vectorIndexMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, vectorIndexMagic) {
+		return "", nil, errors.New("not a vector index file")
+	}
+	var dims, count, modelLen uint32
+	for _, field := range []*uint32{&dims, &count, &modelLen} {
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return "", nil, errors.New("truncated header")
+		}
+	}
+	// Check the header's sizes against the file before allocating for
+	// them, so a corrupt file can't ask for gigabytes
+	offset := int64(len(vectorIndexMagic)) + 12
+	if size < offset || int64(modelLen) > size-offset {
+		return "", nil, errors.New("truncated header")
+	}
+	remaining := uint64(size-offset) - uint64(modelLen)
+	// Each chunk takes at least its ID's 2-byte length and its vector
+	if perChunk := 2 + uint64(dims)*4; uint64(count) > remaining/perChunk {
+		return "", nil, fmt.Errorf("expected %d vectors of %d dimensions", count, dims)
+	}
+
+	model := make([]byte, modelLen)
+	if _, err := io.ReadFull(r, model); err != nil {
+		return "", nil, errors.New("truncated header")
+	}
+	offset += int64(modelLen)
+
+	ids := make([]string, count)
+	for i := range ids {
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return "", nil, errors.New("truncated chunk IDs")
+		}
+		id := make([]byte, n)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return "", nil, errors.New("truncated chunk IDs")
+		}
+		ids[i] = string(id)
+		offset += 2 + int64(n)
+	}
+	padding := (4 - offset%4) % 4
+	if _, err := io.CopyN(io.Discard, r, padding); err != nil {
+		return "", nil, errors.New("truncated chunk IDs")
+	}
+	offset += padding
+
+	vectorSize := int64(dims) * 4
+	if size-offset != int64(count)*vectorSize {
+		return "", nil, fmt.Errorf("expected %d vectors of %d dimensions", count, dims)
+	}
+	vectors := make(map[string][]float32, count)
+	buf := make([]byte, vectorSize)
+	for _, id := range ids {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", nil, fmt.Errorf("expected %d vectors of %d dimensions", count, dims)
+		}
+		vectors[id] = decodeVector(buf)
+	}
+	return string(model), vectors, nil
+}
+
+// StartVectorIndex loads the vector index saved at VECTOR_INDEX_PATH and
+// saves it every VECTOR_INDEX_SAVE_INTERVAL until ctx is cancelled. Without
+// an embedder there is no index.
+func (r *SimpleRAGService) StartVectorIndex(ctx context.Context) {
+	if r.Embedder == nil {
+		return
+	}
+	r.Vectors = NewVectorIndex(r.Embedder.Name(), r.Embedder.Dimensions(), r.Config.VectorIndexPath)
+	if r.Vectors.Path == "" {
+		return
+	}
+
+	start := time.Now()
+	loaded, err := r.Vectors.Load()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	} else {
+		log.Printf("✅ Loaded %d vectors from %s in %s", loaded, r.Vectors.Path, time.Since(start).Round(time.Millisecond))
+	}
+
+	interval := r.Config.VectorIndexSaveInterval
+	if interval <= 0 {
+		interval = defaultVectorIndexSaveInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.SaveVectorIndex()
+			}
+		}
+	}()
+}
+
+// SaveVectorIndex drops vectors of chunks that no longer exist from the
+// vector index and saves it, if it is persisted and changed
+func (r *SimpleRAGService) SaveVectorIndex() {
+	if r.Vectors == nil || r.Vectors.Path == "" {
+		return
+	}
+	live, err := r.DatabaseSchema.GetChunkEmbeddingIDs(r.Vectors.Model)
+	if err != nil {
+		log.Printf("Warning: failed to list chunk embeddings: %v", err)
+	} else {
+		r.Vectors.Retain(live)
+	}
+	if err := r.Vectors.Save(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// chunkVectors returns the current embedder's vectors for chunkIDs, from
+// the vector index when there is one
+func (r *SimpleRAGService) chunkVectors(chunkIDs []string) (map[string][]float32, error) {
+	if r.Vectors == nil {
+		return r.DatabaseSchema.GetChunkEmbeddings(chunkIDs, r.Embedder.Name())
+	}
+	found, missing := r.Vectors.Lookup(chunkIDs)
+	if len(missing) == 0 {
+		return found, nil
+	}
+	loaded, err := r.DatabaseSchema.GetChunkEmbeddings(missing, r.Vectors.Model)
+	if err != nil {
+		return nil, err
+	}
+	for id, vector := range loaded {
+		r.Vectors.Put(id, vector)
+		found[id] = vector
+	}
+	return found, nil
+}
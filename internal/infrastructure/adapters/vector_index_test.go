@@ -0,0 +1,83 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestVectorIndexRoundTrip(t *testing.T) {
+	vectors := map[string][]float32{
+		"doc_1_v1_c0": {0.5, -0.25, 1},
+		"doc_1_v1_c1": {0, 0.75, -1},
+	}
+	var file bytes.Buffer
+	if err := writeVectorIndex(&file, "hash:trigram-3", vectors); err != nil {
+		t.Fatalf("writeVectorIndex: %v", err)
+	}
+	model, decoded, err := readVectorIndex(&file, int64(file.Len()))
+	if err != nil {
+		t.Fatalf("readVectorIndex: %v", err)
+	}
+	if model != "hash:trigram-3" {
+		t.Errorf("model = %q, want %q", model, "hash:trigram-3")
+	}
+	if len(decoded) != len(vectors) {
+		t.Fatalf("decoded %d vectors, want %d", len(decoded), len(vectors))
+	}
+	for id, want := range vectors {
+		got := decoded[id]
+		if len(got) != len(want) {
+			t.Fatalf("vector %s has %d dimensions, want %d", id, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("vector %s[%d] = %v, want %v", id, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+// A header claiming more than the file holds is refused before anything
+// is allocated for it
+func TestDecodeVectorIndexRejectsOversizedHeader(t *testing.T) {
+	header := func(dims, count, modelLen uint32) []byte {
+		data := append([]byte(nil), vectorIndexMagic...)
+		for _, field := range []uint32{dims, count, modelLen} {
+			data = binary.LittleEndian.AppendUint32(data, field)
+		}
+		return append(data, "model"...)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"model length", header(4, 0, 1<<31)},
+		{"chunk count", header(4, 1<<31, 5)},
+		{"dimensions", header(1<<30, 1, 5)},
+		{"truncated", vectorIndexMagic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := readVectorIndex(bytes.NewReader(tt.data), int64(len(tt.data))); err == nil {
+				t.Error("readVectorIndex accepted a corrupt header")
+			}
+		})
+	}
+}
+
+// Vectors of another length than the index's never enter it
+func TestVectorIndexPutRejectsOtherDimensions(t *testing.T) {
+	x := NewVectorIndex("hash:trigram-3", 3, "")
+	x.Put("doc_1_v1_c0", []float32{1, 0, 0})
+	x.Put("doc_1_v1_c1", []float32{1, 0})
+
+	found, missing := x.Lookup([]string{"doc_1_v1_c0", "doc_1_v1_c1"})
+	if len(found) != 1 || found["doc_1_v1_c0"] == nil {
+		t.Errorf("found %v, want only doc_1_v1_c0", found)
+	}
+	if len(missing) != 1 || missing[0] != "doc_1_v1_c1" {
+		t.Errorf("missing %v, want [doc_1_v1_c1]", missing)
+	}
+}
@@ -0,0 +1,162 @@
+package adapters
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"rag-service/internal/infrastructure/config"
+)
+
+// ErrWidgetOrigin means a widget request came from a page the widget is not
+// allowed on
+var ErrWidgetOrigin = errors.New("origin is not allowed for this widget")
+
+// Widgets manages embedded chat widgets: their tokens, origin allow-lists
+// and per-widget rate limits
+type Widgets struct {
+	DatabaseSchema *DatabaseSchema
+
+	mu sync.Mutex
+	// defaultRateLimit applies to widgets created without a limit
+	defaultRateLimit int
+	windows          map[string]*rateWindow
+}
+
+// rateWindow counts a widget's requests in the current minute
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func NewWidgets(cfg *config.Config, ds *DatabaseSchema) *Widgets {
+	return &Widgets{
+		DatabaseSchema:   ds,
+		defaultRateLimit: cfg.WidgetRateLimit,
+		windows:          make(map[string]*rateWindow),
+	}
+}
+
+// SetDefaultRateLimit changes the limit widgets created without one get
+func (w *Widgets) SetDefaultRateLimit(limit int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.defaultRateLimit = limit
+}
+
+// Create registers a widget and returns it with its token. The token is
+// only stored hashed, so this is the one chance to see it.
+func (w *Widgets) Create(name string, origins []string, rateLimit int) (*WidgetRecord, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+
+	allowed := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		normalized, err := normalizeOrigin(origin)
+		if err != nil {
+			return nil, "", err
+		}
+		allowed = append(allowed, normalized)
+	}
+	if len(allowed) == 0 {
+		return nil, "", fmt.Errorf("at least one allowed origin is required (use \"*\" for any)")
+	}
+
+	if rateLimit <= 0 {
+		w.mu.Lock()
+		rateLimit = w.defaultRateLimit
+		w.mu.Unlock()
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate widget token: %w", err)
+	}
+	token := "wgt_" + hex.EncodeToString(secret)
+
+	widget := &WidgetRecord{
+		ID:             fmt.Sprintf("widget_%d", time.Now().UnixNano()),
+		Name:           strings.TrimSpace(name),
+		AllowedOrigins: allowed,
+		RateLimit:      rateLimit,
+	}
+	if err := w.DatabaseSchema.InsertWidget(widget, hashWidgetToken(token)); err != nil {
+		return nil, "", fmt.Errorf("failed to create widget: %w", err)
+	}
+
+	return widget, token, nil
+}
+
+// Authenticate returns the widget a token belongs to, checking that the
+// request's Origin header is on its allow-list
+func (w *Widgets) Authenticate(token, origin string) (*WidgetRecord, error) {
+	widget, err := w.DatabaseSchema.GetWidgetByTokenHash(hashWidgetToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	normalized, err := normalizeOrigin(origin)
+	if err != nil {
+		return nil, ErrWidgetOrigin
+	}
+	for _, allowed := range widget.AllowedOrigins {
+		if allowed == "*" || allowed == normalized {
+			return widget, nil
+		}
+	}
+	return nil, ErrWidgetOrigin
+}
+
+// Allow counts a request against the widget's per-minute limit. When the
+// limit is used up it returns false and how long until the window resets.
+func (w *Widgets) Allow(widget *WidgetRecord) (bool, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	window, ok := w.windows[widget.ID]
+	if !ok || now.Sub(window.start) >= time.Minute {
+		window = &rateWindow{start: now}
+		w.windows[widget.ID] = window
+	}
+
+	if window.count >= widget.RateLimit {
+		return false, window.start.Add(time.Minute).Sub(now)
+	}
+	window.count++
+	return true, 0
+}
+
+// Forget drops the rate limit state of a deleted widget
+func (w *Widgets) Forget(id string) {
+	w.mu.Lock()
+	delete(w.windows, id)
+	w.mu.Unlock()
+}
+
+func hashWidgetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeOrigin reduces an origin to lowercase scheme://host[:port] so
+// allow-list entries match the browser's Origin header
+func normalizeOrigin(origin string) (string, error) {
+	origin = strings.TrimSpace(origin)
+	if origin == "*" {
+		return origin, nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid origin %q, expected e.g. https://example.com", origin)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
@@ -1,17 +1,173 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type Config struct {
 	// Server
 	Port string
 
+	// Handlers get APITimeout, or GenerationTimeout for routes that call the
+	// LLM and BulkTimeout for uploads, file transfers and admin maintenance.
+	// Requests slower than their class's threshold are logged as slow.
+	APITimeout              time.Duration
+	APISlowThreshold        time.Duration
+	GenerationTimeout       time.Duration
+	GenerationSlowThreshold time.Duration
+	BulkTimeout             time.Duration
+	BulkSlowThreshold       time.Duration
+
 	// App
 	AppLanguage string
 
+	// Library
+	ThumbnailWidth int
+
+	// PDFMaxMemoryMB caps what indexing one document holds in memory: the
+	// file plus the extracted text not yet stored. Pages are stored as they
+	// are extracted unless post_chunk hooks need the whole document. 0 means
+	// no cap.
+	PDFMaxMemoryMB int
+	// MinChunkLength drops text chunks shorter than this many characters as
+	// noise. EmptyExtractionPolicy decides what happens to a PDF without any
+	// chunks (scanned or image-only): "fail" it, or store it with status
+	// needs_ocr for OCR to pick up.
+	MinChunkLength        int
+	EmptyExtractionPolicy string
+
+	// Documents still processing after StaleProcessingTimeout (e.g. after a
+	// crash mid-ingest) are re-indexed up to StaleProcessingRetries times,
+	// then marked failed
+	StaleProcessingTimeout time.Duration
+	StaleProcessingRetries int
+	StaleRecoveryInterval  time.Duration
+	// Ingest streams nobody pushes text to for IngestStreamIdleTimeout are
+	// discarded and their document marked failed
+	IngestStreamIdleTimeout time.Duration
+
+	// Originals not created or downloaded within TieringAfter are moved to
+	// TieringBucket ("archive" mode) or deleted ("delete" mode); chunks stay.
+	// Zero disables tiering.
+	TieringAfter    time.Duration
+	TieringMode     string
+	TieringBucket   string
+	TieringInterval time.Duration
+	// Document retrievals and downloads are written in batches every
+	// AccessFlushInterval
+	AccessFlushInterval time.Duration
+	// ContextStorage is how the retrieval context is stored with answers:
+	// "full" text, "compressed" text or "chunk_ids", rebuilding the text
+	// from the chunks when asked for
+	ContextStorage string
+
+	// Admin endpoints require this token when set
+	AdminToken string
+
+	// File downloads need a link signed with DownloadSigningKey that
+	// expires after DownloadLinkTTL
+	DownloadSigningKey string
+	DownloadLinkTTL    time.Duration
+
+	// Embedded widgets get WidgetRateLimit requests per minute unless
+	// created with their own limit
+	WidgetRateLimit int
+
+	// OpenAI-compatible /v1 endpoints serve the RAG pipeline as
+	// OpenAICompatModel, requiring OpenAICompatAPIKey as a bearer token
+	// when set
+	OpenAICompatModel  string
+	OpenAICompatAPIKey string
+
+	// ShareLinkTTL is how long a session share link lasts unless the
+	// request asks for another lifetime
+	ShareLinkTTL time.Duration
+
+	// SessionCacheSize is how many answers each chat session keeps for
+	// repeated questions, 0 to disable; SessionCacheSimilarity is how alike
+	// (0-1) a rephrased question's terms must be to reuse one
+	SessionCacheSize       int
+	SessionCacheSimilarity float64
+	SessionCacheTTL        time.Duration
+	// SessionHistoryLookback is how many of a session's latest stored
+	// messages are searched for an earlier answer to a repeated question
+	// the cache no longer holds, 0 to disable
+	SessionHistoryLookback int
+
+	// GraphQLEnabled serves the read-only GraphQL API at /graphql
+	GraphQLEnabled bool
+
+	// Notifications are posted to NotificationWebhookURL when set, and
+	// emailed through the SMTP server to users who gave an address. Saved
+	// queries are checked every SavedQueryCheckInterval.
+	NotificationWebhookURL  string
+	SMTPHost                string
+	SMTPPort                int
+	SMTPUsername            string
+	SMTPPassword            string
+	SMTPFrom                string
+	SavedQueryCheckInterval time.Duration
+
+	// Users who opt in get their saved-query results and processed
+	// documents emailed every DigestInterval (0 disables digests), rendered
+	// with DigestSubject and the text/template in DigestTemplateFile
+	DigestInterval     time.Duration
+	DigestSubject      string
+	DigestTemplateFile string
+
+	// Single sign-on through an OpenID Connect provider, enabled by
+	// OIDCIssuer. OIDCRoleMapping maps groups found in OIDCGroupsClaim to
+	// roles ("admins=admin,staff=user"). Signed-in users get a service JWT
+	// signed with AuthJWTSecret that lasts AuthJWTTTL.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       string
+	OIDCGroupsClaim  string
+	OIDCRoleMapping  string
+	OIDCDefaultRole  string
+	AuthJWTSecret    string
+	AuthJWTTTL       time.Duration
+
+	// Telemetry is opt-in: anonymous aggregate stats are only sent when
+	// TelemetryEnabled is true and TelemetryEndpoint is set
+	TelemetryEnabled  bool
+	TelemetryEndpoint string
+	TelemetryInterval time.Duration
+
+	// FaultInjection lets requests inject latency and failures into their
+	// MySQL, MinIO and LLM calls with the X-Fault-Inject header, to exercise
+	// timeouts and error handling. Test environments only.
+	FaultInjection bool
+
+	// FeatureFlags sets deployment defaults, e.g. "table_prompt=false"
+	FeatureFlags string
+
+	// Hooks lists extension hooks as "point=target" pairs, where target is an
+	// HTTP URL or a Go plugin (.so) path. Failing hooks abort the operation
+	// unless HooksFailOpen is set.
+	Hooks         string
+	HookTimeout   time.Duration
+	HooksFailOpen bool
+
+	// Provider keys and MinIO credentials are fetched from the Vault KV
+	// entry VaultMount/VaultPath when VaultAddr is set, cached for
+	// VaultCacheTTL unless Vault gives them a lease. Keys missing from Vault
+	// fall back to the settings below.
+	VaultAddr      string
+	VaultToken     string
+	VaultMount     string
+	VaultPath      string
+	VaultKVVersion int
+	VaultCacheTTL  time.Duration
+
 	// MySQL
 	MySQLHost     string
 	MySQLPort     string
@@ -33,26 +189,303 @@ type Config struct {
 	OllamaHost  string
 	OllamaPort  string
 	OllamaModel string
+	// OllamaKeepAlive is passed as keep_alive so the model stays loaded;
+	// OllamaKeepAliveInterval controls the background ping (0 disables it)
+	OllamaKeepAlive         string
+	OllamaKeepAliveInterval time.Duration
+	// OllamaAutoPull pulls the model at startup when Ollama doesn't have it,
+	// instead of reporting it missing on /readyz
+	OllamaAutoPull bool
 
 	// LLM Provider
 	LLMProvider string
 
+	// Embeddings: EmbedderProvider is "none", "hash", "ollama" or
+	// "google"; EmbedderModel overrides the provider's default model and
+	// EmbedderDimensions sizes the hashing embedder's vectors. VectorWeight
+	// is how much vector similarity adds to the built-in score.
+	EmbedderProvider   string
+	EmbedderModel      string
+	EmbedderDimensions int
+	VectorWeight       float64
+	// VectorRetryAfter is how long queries skip vector search, ranking
+	// lexically, after the embedder or its vectors fail
+	VectorRetryAfter time.Duration
+	// VectorIndexPath saves the in-memory vector index to a file every
+	// VectorIndexSaveInterval and on shutdown, loading it at startup; empty
+	// keeps it in memory only
+	VectorIndexPath         string
+	VectorIndexSaveInterval time.Duration
+	// Doc2QueryQuestions is how many questions the LLM writes for each text
+	// chunk, in the background after ingest, to be matched alongside the
+	// chunk's text; zero disables it
+	Doc2QueryQuestions int
+
+	// LLM concurrency limits
+	OllamaMaxConcurrency int
+	GoogleMaxConcurrency int
+	LLMQueueTimeout      time.Duration
+	// Per-tenant limits, a tenant being the API key or signed-in user behind
+	// a request: how many generations and uploads each runs at once, and
+	// how many more may queue behind them (zero for no cap). Zero
+	// concurrency leaves tenants to share the global limits.
+	TenantMaxGenerations  int
+	TenantGenerationQueue int
+	TenantMaxIngestions   int
+	TenantIngestionQueue  int
+
+	// Query dry runs price their estimated tokens at these rates per 1000
+	// tokens, in whatever currency the provider bills; zero (a local model)
+	// estimates no cost
+	LLMPromptCostPer1K     float64
+	LLMCompletionCostPer1K float64
+
+	// Retrieval
+	RetrievalCrossLingual  bool
+	RetrievalLanguageBoost float64
+	// TransliterationMatching matches names across scripts ("Tehran"/"تهران")
+	TransliterationMatching bool
+	// ScoringExpression replaces the built-in ranking formula, e.g.
+	// "lexical * boost + 10 * recency"; empty keeps the built-in score
+	ScoringExpression      string
+	ScoringRecencyHalfLife time.Duration
+	// PageZoneWeights scale chunk scores by where on the page their text
+	// sits, "zone=weight" pairs for body, heading, header, footer, margin
+	// and footnote; unlisted zones weigh 1
+	PageZoneWeights string
+	// ShadowSampleRate is the share (0-1) of queries also run through the
+	// experimental ranking in ShadowScoringExpression, logged for comparison
+	// without affecting responses
+	ShadowSampleRate        float64
+	ShadowScoringExpression string
+
+	// Cross-lingual fallback: below CrossLingualMinScore the question is
+	// translated into corpus languages holding at least CrossLingualMinShare
+	// of all chunks
+	CrossLingualMinScore     float64
+	CrossLingualMinShare     float64
+	CrossLingualMaxLanguages int
+
+	// Numeric verification: numbers in answers to "how many/how much"
+	// questions must appear in the context, otherwise confidence is
+	// multiplied by NumericMismatchPenalty
+	NumericVerification    bool
+	NumericMismatchPenalty float64
+
+	// Refusal policy: answers below RefusalMinConfidence (0 disables) or
+	// without sources when RefusalRequireCitations is set are refused, as
+	// are questions mentioning one of the comma-separated
+	// RefusalRestrictedTopics. RefusalMessagesFile is a JSON file of
+	// {"reason": {"lang": "message"}} overriding the built-in messages.
+	RefusalMinConfidence    float64
+	RefusalRequireCitations bool
+	RefusalRestrictedTopics string
+	RefusalMessagesFile     string
+	// ConfidenceBands names confidence ranges and what to do with answers
+	// in each: "name=min:behavior" entries, behavior being answer, warn
+	// (answer with a warning) or abstain
+	ConfidenceBands string
+	// ConfidenceWeights weigh the signals an answer's confidence averages:
+	// "signal=weight" entries for retrieval (best chunk score), coverage
+	// (question terms in the context), overlap (answer words in the
+	// context) and grounded (answer claims backed by the context)
+	ConfidenceWeights string
+	// CitationMode makes answers cite their context inline as [n] for every
+	// claim: "reject" refuses answers with uncited claims, "regenerate"
+	// asks once more before refusing, "off" disables it. Collections can
+	// override it for their documents.
+	CitationMode string
+
+	// Moderation of questions and answers: ModerationProvider is "rules"
+	// (comma-separated "category:term" entries in ModerationRules) or
+	// "openai" (an OpenAI-compatible moderations endpoint); empty disables
+	// it. ModerationAction is block, flag or log.
+	ModerationProvider string
+	ModerationAction   string
+	ModerationStages   string
+	ModerationRules    string
+	ModerationAPIURL   string
+	ModerationAPIKey   string
+	ModerationModel    string
+	ModerationFailOpen bool
+
+	// Monthly usage quotas per API key, overridable per key by admins;
+	// 0 means unlimited
+	QuotaMonthlyQueries     int64
+	QuotaMonthlyTokens      int64
+	QuotaMonthlyUploadBytes int64
+
 	// Google Gemini
 	GoogleAPIKey string
 	GoogleModel  string
 	GoogleDNS    string
+	// Gemini generations are cached for GoogleCacheTTL, up to
+	// GoogleCacheSize of them; zero for either disables the cache
+	GoogleCacheTTL  time.Duration
+	GoogleCacheSize int
+
+	// Provider HTTP clients: idle keep-alive connections kept per host and
+	// for how long, HTTP/2 when the provider offers it, and how long host
+	// lookups are cached (0 disables the cache)
+	ProviderMaxIdleConnsPerHost int
+	ProviderIdleConnTimeout     time.Duration
+	ProviderHTTP2               bool
+	ProviderDNSCacheTTL         time.Duration
 }
 
+// Load reads the configuration from the environment, with settings in
+// CONFIG_FILE taking precedence and settings missing from both read from
+// secret files (see secretFromFile). Files that can't be read are skipped
+// with a warning.
 func Load() *Config {
+	cfg, err := Read()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return cfg
+}
+
+// Read is Load returning the errors for files it couldn't read, along with
+// the configuration read without them
+func Read() (*Config, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	values, err := readConfigFile(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		err = fmt.Errorf("ignoring CONFIG_FILE: %w", err)
+	}
+	fileValues = values
+	loadErrors = []error{err}
+	secretsDir = lookup("SECRETS_DIR")
+	if secretsDir == "" {
+		secretsDir = "/run/secrets"
+	}
+	defer func() { fileValues, loadErrors, secretsDir = nil, nil, "" }()
+
+	cfg := load()
+	return cfg, errors.Join(loadErrors...)
+}
+
+// loadMu guards the state of a configuration being read: CONFIG_FILE's
+// settings, the directory secrets are mounted in and files that failed,
+// and the overrides set through SetOverrides
+var (
+	loadMu         sync.Mutex
+	fileValues     map[string]string
+	secretsDir     string
+	loadErrors     []error
+	overrideValues map[string]string
+)
+
+// SetOverrides sets values, by environment variable name, that take
+// precedence over CONFIG_FILE and the environment from the next Read on;
+// the admin settings API keeps them in the database
+func SetOverrides(values map[string]string) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	overrideValues = values
+}
+
+func load() *Config {
 	useSSL, _ := strconv.ParseBool(getEnv("MINIO_USE_SSL", "false"))
 
 	return &Config{
 		// Server
 		Port: getEnv("PORT", "8090"),
 
+		APITimeout:              getEnvDuration("API_TIMEOUT", 15*time.Second),
+		APISlowThreshold:        getEnvDuration("API_SLOW_THRESHOLD", 2*time.Second),
+		GenerationTimeout:       getEnvDuration("GENERATION_TIMEOUT", 180*time.Second),
+		GenerationSlowThreshold: getEnvDuration("GENERATION_SLOW_THRESHOLD", 30*time.Second),
+		BulkTimeout:             getEnvDuration("BULK_TIMEOUT", 300*time.Second),
+		BulkSlowThreshold:       getEnvDuration("BULK_SLOW_THRESHOLD", 60*time.Second),
+
 		// App
 		AppLanguage: getEnv("APP_LANGUAGE", "en"),
 
+		// Library
+		ThumbnailWidth: getEnvInt("THUMBNAIL_WIDTH", 200),
+
+		PDFMaxMemoryMB:        getEnvInt("PDF_MAX_MEMORY_MB", 512),
+		MinChunkLength:        getEnvInt("MIN_CHUNK_LENGTH", 50),
+		EmptyExtractionPolicy: getEnv("EMPTY_EXTRACTION_POLICY", "fail"),
+
+		StaleProcessingTimeout: getEnvDuration("STALE_PROCESSING_TIMEOUT", 30*time.Minute),
+		StaleProcessingRetries: getEnvInt("STALE_PROCESSING_RETRIES", 1),
+		StaleRecoveryInterval:  getEnvDuration("STALE_RECOVERY_INTERVAL", 5*time.Minute),
+
+		IngestStreamIdleTimeout: getEnvDuration("INGEST_STREAM_IDLE_TIMEOUT", 10*time.Minute),
+
+		TieringAfter:    getEnvDuration("TIERING_AFTER", 0),
+		TieringMode:     getEnv("TIERING_MODE", "archive"),
+		TieringBucket:   getEnv("TIERING_BUCKET", "documents-archive"),
+		TieringInterval: getEnvDuration("TIERING_INTERVAL", 24*time.Hour),
+
+		AccessFlushInterval: getEnvDuration("ACCESS_FLUSH_INTERVAL", time.Minute),
+		ContextStorage:      getEnv("CONTEXT_STORAGE", "compressed"),
+
+		AdminToken: getEnv("ADMIN_TOKEN", ""),
+
+		DownloadSigningKey: getEnv("DOWNLOAD_SIGNING_KEY", ""),
+		DownloadLinkTTL:    getEnvDuration("DOWNLOAD_LINK_TTL", 15*time.Minute),
+
+		WidgetRateLimit: getEnvInt("WIDGET_RATE_LIMIT", 30),
+
+		OpenAICompatModel:  getEnv("OPENAI_COMPAT_MODEL", "pdf-rag"),
+		OpenAICompatAPIKey: getEnv("OPENAI_COMPAT_API_KEY", ""),
+
+		ShareLinkTTL: getEnvDuration("SHARE_LINK_TTL", 7*24*time.Hour),
+
+		SessionCacheSize:       getEnvInt("SESSION_CACHE_SIZE", 20),
+		SessionCacheSimilarity: getEnvFloat("SESSION_CACHE_SIMILARITY", 0.8),
+		SessionCacheTTL:        getEnvDuration("SESSION_CACHE_TTL", time.Hour),
+		SessionHistoryLookback: getEnvInt("SESSION_HISTORY_LOOKBACK", 200),
+
+		GraphQLEnabled: getEnvBool("GRAPHQL_ENABLED", false),
+
+		NotificationWebhookURL:  getEnv("NOTIFICATION_WEBHOOK_URL", ""),
+		SMTPHost:                getEnv("SMTP_HOST", ""),
+		SMTPPort:                getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:            getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:            getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:                getEnv("SMTP_FROM", ""),
+		SavedQueryCheckInterval: getEnvDuration("SAVED_QUERY_CHECK_INTERVAL", 5*time.Minute),
+
+		DigestInterval:     getEnvDuration("DIGEST_INTERVAL", 0),
+		DigestSubject:      getEnv("DIGEST_SUBJECT", ""),
+		DigestTemplateFile: getEnv("DIGEST_TEMPLATE_FILE", ""),
+
+		OIDCIssuer:       getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:       getEnv("OIDC_SCOPES", "openid profile email"),
+		OIDCGroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCRoleMapping:  getEnv("OIDC_ROLE_MAPPING", ""),
+		OIDCDefaultRole:  getEnv("OIDC_DEFAULT_ROLE", "user"),
+		AuthJWTSecret:    getEnv("AUTH_JWT_SECRET", ""),
+		AuthJWTTTL:       getEnvDuration("AUTH_JWT_TTL", 8*time.Hour),
+
+		TelemetryEnabled:  getEnvBool("TELEMETRY_ENABLED", false),
+		TelemetryEndpoint: getEnv("TELEMETRY_ENDPOINT", ""),
+		TelemetryInterval: getEnvDuration("TELEMETRY_INTERVAL", 24*time.Hour),
+
+		FaultInjection: getEnvBool("FAULT_INJECTION", false),
+
+		FeatureFlags: getEnv("FEATURE_FLAGS", ""),
+
+		Hooks:         getEnv("HOOKS", ""),
+		HookTimeout:   getEnvDuration("HOOK_TIMEOUT", 10*time.Second),
+		HooksFailOpen: getEnvBool("HOOKS_FAIL_OPEN", false),
+
+		VaultAddr:      getEnv("VAULT_ADDR", ""),
+		VaultToken:     getEnv("VAULT_TOKEN", ""),
+		VaultMount:     getEnv("VAULT_MOUNT", "secret"),
+		VaultPath:      getEnv("VAULT_PATH", "rag-service"),
+		VaultKVVersion: getEnvInt("VAULT_KV_VERSION", 2),
+		VaultCacheTTL:  getEnvDuration("VAULT_CACHE_TTL", 5*time.Minute),
+
 		// MySQL
 		MySQLHost:     getEnv("MYSQL_HOST", "localhost"),
 		MySQLPort:     getEnv("MYSQL_PORT", "3306"),
@@ -71,23 +504,140 @@ func Load() *Config {
 		QdrantPort: getEnv("QDRANT_PORT", "6333"),
 
 		// Ollama
-		OllamaHost:  getEnv("OLLAMA_HOST", "localhost"),
-		OllamaPort:  getEnv("OLLAMA_PORT", "11434"),
-		OllamaModel: getEnv("OLLAMA_MODEL", "llama3.2:3b"),
+		OllamaHost:              getEnv("OLLAMA_HOST", "localhost"),
+		OllamaPort:              getEnv("OLLAMA_PORT", "11434"),
+		OllamaModel:             getEnv("OLLAMA_MODEL", "llama3.2:3b"),
+		OllamaKeepAlive:         getEnv("OLLAMA_KEEP_ALIVE", "30m"),
+		OllamaKeepAliveInterval: getEnvDuration("OLLAMA_KEEP_ALIVE_INTERVAL", 5*time.Minute),
+		OllamaAutoPull:          getEnvBool("OLLAMA_AUTO_PULL", false),
 
 		// LLM Provider
 		LLMProvider: getEnv("LLM_PROVIDER", "ollama"),
 
+		// Embeddings
+		EmbedderProvider:   getEnv("EMBEDDER_PROVIDER", "none"),
+		EmbedderModel:      getEnv("EMBEDDER_MODEL", ""),
+		EmbedderDimensions: getEnvInt("EMBEDDER_DIMENSIONS", 384),
+		VectorWeight:       getEnvFloat("VECTOR_WEIGHT", 30),
+		VectorRetryAfter:   getEnvDuration("VECTOR_RETRY_AFTER", 30*time.Second),
+
+		VectorIndexPath:         getEnv("VECTOR_INDEX_PATH", ""),
+		VectorIndexSaveInterval: getEnvDuration("VECTOR_INDEX_SAVE_INTERVAL", 5*time.Minute),
+		Doc2QueryQuestions:      getEnvInt("DOC2QUERY_QUESTIONS", 0),
+
+		// LLM concurrency limits
+		OllamaMaxConcurrency: getEnvInt("OLLAMA_MAX_CONCURRENCY", 1),
+		GoogleMaxConcurrency: getEnvInt("GOOGLE_MAX_CONCURRENCY", 4),
+		LLMQueueTimeout:      getEnvDuration("LLM_QUEUE_TIMEOUT", 60*time.Second),
+
+		TenantMaxGenerations:  getEnvInt("TENANT_MAX_GENERATIONS", 0),
+		TenantGenerationQueue: getEnvInt("TENANT_GENERATION_QUEUE", 4),
+		TenantMaxIngestions:   getEnvInt("TENANT_MAX_INGESTIONS", 0),
+		TenantIngestionQueue:  getEnvInt("TENANT_INGESTION_QUEUE", 4),
+
+		LLMPromptCostPer1K:     getEnvFloat("LLM_PROMPT_COST_PER_1K", 0),
+		LLMCompletionCostPer1K: getEnvFloat("LLM_COMPLETION_COST_PER_1K", 0),
+
+		// Retrieval
+		RetrievalCrossLingual:   getEnvBool("RETRIEVAL_CROSS_LINGUAL", false),
+		RetrievalLanguageBoost:  getEnvFloat("RETRIEVAL_LANGUAGE_BOOST", 1.25),
+		TransliterationMatching: getEnvBool("TRANSLITERATION_MATCHING", true),
+		ScoringExpression:       getEnv("SCORING_EXPRESSION", ""),
+		ScoringRecencyHalfLife:  getEnvDuration("SCORING_RECENCY_HALF_LIFE", 30*24*time.Hour),
+		PageZoneWeights:         getEnv("PAGE_ZONE_WEIGHTS", "heading=1.2,header=0.3,footer=0.3,margin=0.3,footnote=0.6"),
+		ShadowSampleRate:        getEnvFloat("SHADOW_SAMPLE_RATE", 0),
+		ShadowScoringExpression: getEnv("SHADOW_SCORING_EXPRESSION", ""),
+
+		CrossLingualMinScore:     getEnvFloat("CROSS_LINGUAL_MIN_SCORE", 15),
+		CrossLingualMinShare:     getEnvFloat("CROSS_LINGUAL_MIN_SHARE", 0.1),
+		CrossLingualMaxLanguages: getEnvInt("CROSS_LINGUAL_MAX_LANGUAGES", 3),
+
+		NumericVerification:    getEnvBool("NUMERIC_VERIFICATION", true),
+		NumericMismatchPenalty: getEnvFloat("NUMERIC_MISMATCH_PENALTY", 0.5),
+
+		RefusalMinConfidence:    getEnvFloat("REFUSAL_MIN_CONFIDENCE", 0),
+		RefusalRequireCitations: getEnvBool("REFUSAL_REQUIRE_CITATIONS", false),
+		RefusalRestrictedTopics: getEnv("REFUSAL_RESTRICTED_TOPICS", ""),
+		RefusalMessagesFile:     getEnv("REFUSAL_MESSAGES_FILE", ""),
+		ConfidenceBands:         getEnv("CONFIDENCE_BANDS", "high=0.7:answer,medium=0.4:answer,low=0:warn"),
+		ConfidenceWeights:       getEnv("CONFIDENCE_WEIGHTS", "retrieval=0.5,coverage=0.2,overlap=0.15,grounded=0.15"),
+		CitationMode:            getEnv("CITATION_MODE", "off"),
+
+		ModerationProvider: getEnv("MODERATION_PROVIDER", ""),
+		ModerationAction:   getEnv("MODERATION_ACTION", "block"),
+		ModerationStages:   getEnv("MODERATION_STAGES", "question,answer"),
+		ModerationRules:    getEnv("MODERATION_RULES", ""),
+		ModerationAPIURL:   getEnv("MODERATION_API_URL", "https://api.openai.com/v1/moderations"),
+		ModerationAPIKey:   getEnv("MODERATION_API_KEY", ""),
+		ModerationModel:    getEnv("MODERATION_MODEL", ""),
+		ModerationFailOpen: getEnvBool("MODERATION_FAIL_OPEN", true),
+
+		QuotaMonthlyQueries:     int64(getEnvInt("QUOTA_MONTHLY_QUERIES", 0)),
+		QuotaMonthlyTokens:      int64(getEnvInt("QUOTA_MONTHLY_TOKENS", 0)),
+		QuotaMonthlyUploadBytes: int64(getEnvInt("QUOTA_MONTHLY_UPLOAD_BYTES", 0)),
+
 		// Google Gemini
 		GoogleAPIKey: getEnv("GOOGLE_API_KEY", ""),
 		GoogleModel:  getEnv("GOOGLE_MODEL", "gemini-1.5-flash"),
 		GoogleDNS:    getEnv("GOOGLE_DNS", ""),
+
+		GoogleCacheTTL:  getEnvDuration("GOOGLE_CACHE_TTL", time.Hour),
+		GoogleCacheSize: getEnvInt("GOOGLE_CACHE_SIZE", 500),
+
+		// Provider HTTP clients
+		ProviderMaxIdleConnsPerHost: getEnvInt("PROVIDER_MAX_IDLE_CONNS_PER_HOST", 16),
+		ProviderIdleConnTimeout:     getEnvDuration("PROVIDER_IDLE_CONN_TIMEOUT", 90*time.Second),
+		ProviderHTTP2:               getEnvBool("PROVIDER_HTTP2", true),
+		ProviderDNSCacheTTL:         getEnvDuration("PROVIDER_DNS_CACHE_TTL", 5*time.Minute),
 	}
 }
 
-func getEnv(key, defaultValue string) string {
+// lookup returns an overridden setting, else one from CONFIG_FILE, else
+// from the environment, else from a secret file
+func lookup(key string) string {
+	if value, ok := overrideValues[key]; ok {
+		return value
+	}
+	if value, ok := fileValues[key]; ok {
+		return value
+	}
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
+	return secretFromFile(key)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := lookup(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(lookup(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(lookup(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(lookup(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(lookup(key), 64); err == nil {
+		return value
+	}
 	return defaultValue
 }
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// reloadable lists the settings a running server picks up on reload: the
+// answer language, retrieval and scoring parameters, the refusal policy and
+// its messages, rate limits, quotas, per-tenant limits and feature flags.
+// Everything else (ports, connections, credentials, timeouts and background
+// workers) is only read at startup.
+var reloadable = map[string]bool{
+	"AppLanguage":              true,
+	"RetrievalCrossLingual":    true,
+	"RetrievalLanguageBoost":   true,
+	"TransliterationMatching":  true,
+	"ScoringExpression":        true,
+	"VectorWeight":             true,
+	"ScoringRecencyHalfLife":   true,
+	"PageZoneWeights":          true,
+	"MinChunkLength":           true,
+	"EmptyExtractionPolicy":    true,
+	"ShadowSampleRate":         true,
+	"ShadowScoringExpression":  true,
+	"CrossLingualMinScore":     true,
+	"CrossLingualMinShare":     true,
+	"CrossLingualMaxLanguages": true,
+	"NumericVerification":      true,
+	"NumericMismatchPenalty":   true,
+	"RefusalMinConfidence":     true,
+	"RefusalRequireCitations":  true,
+	"RefusalRestrictedTopics":  true,
+	"RefusalMessagesFile":      true,
+	"ConfidenceBands":          true,
+	"ConfidenceWeights":        true,
+	"CitationMode":             true,
+	"ContextStorage":           true,
+	"WidgetRateLimit":          true,
+	"QuotaMonthlyQueries":      true,
+	"QuotaMonthlyTokens":       true,
+	"QuotaMonthlyUploadBytes":  true,
+	"LLMQueueTimeout":          true,
+	"TenantMaxGenerations":     true,
+	"TenantGenerationQueue":    true,
+	"TenantMaxIngestions":      true,
+	"TenantIngestionQueue":     true,
+	"IngestStreamIdleTimeout":  true,
+	"LLMPromptCostPer1K":       true,
+	"LLMCompletionCostPer1K":   true,
+	"ShareLinkTTL":             true,
+	"SessionCacheSize":         true,
+	"SessionCacheSimilarity":   true,
+	"SessionCacheTTL":          true,
+	"SessionHistoryLookback":   true,
+	"FeatureFlags":             true,
+}
+
+// Apply copies next's reloadable settings into c and returns the names of
+// the settings that differ, split into those applied and those that only
+// take effect after a restart
+func (c *Config) Apply(next *Config) (applied, restartRequired []string) {
+	current := reflect.ValueOf(c).Elem()
+	updated := reflect.ValueOf(next).Elem()
+
+	for i := 0; i < current.NumField(); i++ {
+		name := current.Type().Field(i).Name
+		if current.Field(i).Interface() == updated.Field(i).Interface() {
+			continue
+		}
+		if !reloadable[name] {
+			restartRequired = append(restartRequired, name)
+			continue
+		}
+		current.Field(i).Set(updated.Field(i))
+		applied = append(applied, name)
+	}
+	return applied, restartRequired
+}
+
+// readConfigFile parses KEY=VALUE lines, skipping blank lines and # comments.
+// Values may be quoted. An empty path reads nothing.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// redacted replaces secret values in logs and config output
+const redacted = "[redacted]"
+
+// minRedactedLength keeps very short secrets from redacting every
+// occurrence of a common substring in the logs
+const minRedactedLength = 4
+
+// secretSettings are credentials and keys, never logged or shown
+var secretSettings = map[string]bool{
+	"AdminToken":             true,
+	"DownloadSigningKey":     true,
+	"OpenAICompatAPIKey":     true,
+	"NotificationWebhookURL": true,
+	"SMTPPassword":           true,
+	"OIDCClientSecret":       true,
+	"AuthJWTSecret":          true,
+	"MySQLPassword":          true,
+	"MinIOSecretKey":         true,
+	"ModerationAPIKey":       true,
+	"VaultToken":             true,
+	"GoogleAPIKey":           true,
+}
+
+// secretFromFile reads a setting from the file named by KEY_FILE, or else
+// from a file named after the key (as is, or lowercase) in SECRETS_DIR,
+// where Docker and Kubernetes mount secrets. Trailing newlines are dropped.
+func secretFromFile(key string) string {
+	path, ok := fileValues[key+"_FILE"]
+	if !ok {
+		path = os.Getenv(key + "_FILE")
+	}
+	if path == "" {
+		path = mountedSecret(key)
+	}
+	if path == "" {
+		return ""
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		loadErrors = append(loadErrors, fmt.Errorf("failed to read %s from %s: %w", key, path, err))
+		return ""
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
+
+// mountedSecret returns the path of key's file in SECRETS_DIR, if there is one
+func mountedSecret(key string) string {
+	if secretsDir == "" {
+		return ""
+	}
+	for _, name := range []string{key, strings.ToLower(key)} {
+		path := filepath.Join(secretsDir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+// Redacted returns every setting by name with secrets that are set replaced
+// by a placeholder
+func (c *Config) Redacted() map[string]interface{} {
+	value := reflect.ValueOf(c).Elem()
+	settings := make(map[string]interface{}, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Name
+		field := value.Field(i).Interface()
+		switch v := field.(type) {
+		case string:
+			if secretSettings[name] && v != "" {
+				field = redacted
+			}
+		case time.Duration:
+			field = v.String()
+		}
+		settings[name] = field
+	}
+	return settings
+}
+
+// RedactingWriter wraps w, replacing the values of secret settings in
+// everything written to it
+func (c *Config) RedactingWriter(w io.Writer) io.Writer {
+	var pairs []string
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if !secretSettings[value.Type().Field(i).Name] {
+			continue
+		}
+		if secret := value.Field(i).String(); len(secret) >= minRedactedLength {
+			pairs = append(pairs, secret, redacted)
+		}
+	}
+	if len(pairs) == 0 {
+		return w
+	}
+	return &redactingWriter{w: w, replacer: strings.NewReplacer(pairs...)}
+}
+
+type redactingWriter struct {
+	w        io.Writer
+	replacer *strings.Replacer
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, r.replacer.Replace(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -7,6 +7,9 @@ import mysql from "mysql2/promise";
 import { Client as MinioClient } from "minio";
 
 const RAG_BASE_URL = process.env.RAG_BASE_URL || "http://localhost:8090";
+// API token (or admin token) sent to the RAG server; issuing download links
+// requires one
+const RAG_API_KEY = process.env.RAG_API_KEY || "";
 
 // MySQL env
 const MYSQL_HOST = process.env.MYSQL_HOST || "localhost";
@@ -470,10 +473,19 @@ async function main() {
 			documentId: string;
 			filename: string;
 		}) => {
-			const url = `${RAG_BASE_URL}/files/${encodeURIComponent(
-				documentId
-			)}/${encodeURIComponent(filename)}`;
-			const res = await fetch(url);
+			// Files are served only through signed links, so ask for one first
+			const linkRes = await fetch(
+				`${RAG_BASE_URL}/files/${encodeURIComponent(
+					documentId
+				)}/${encodeURIComponent(filename)}/link`,
+				{ headers: RAG_API_KEY ? { "X-API-Key": RAG_API_KEY } : {} }
+			);
+			if (!linkRes.ok) {
+				const text = await linkRes.text();
+				throw new Error(`RAG download link failed: ${linkRes.status} ${text}`);
+			}
+			const link = (await linkRes.json()) as { url: string };
+			const res = await fetch(`${RAG_BASE_URL}${link.url}`);
 			if (!res.ok) {
 				const text = await res.text();
 				throw new Error(`RAG file download failed: ${res.status} ${text}`);
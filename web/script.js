@@ -3,6 +3,7 @@ class RAGChatApp {
 		this.apiUrl = this.getApiUrl();
 		this.currentSessionId = null;
 		this.sessions = [];
+		this.sessionDownloadUrls = {};
 
 		// DOM elements
 		this.sidebar = document.getElementById("sidebar");
@@ -250,6 +251,7 @@ class RAGChatApp {
 
 			this.currentSessionId = sessionId;
 			this.currentSessionTitle = data.session.title;
+			this.sessionDownloadUrls = data.download_urls || {};
 			this.chatTitle.textContent = data.session.title;
 			this.chatSubtitle.textContent = "Ask questions about your documents";
 
@@ -363,6 +365,8 @@ class RAGChatApp {
 					method: "POST",
 					headers: {
 						"Content-Type": "application/json",
+						// v1 sources carry signed download links
+						"X-API-Version": "1",
 					},
 					body: JSON.stringify({ message: message }),
 				}
@@ -411,6 +415,7 @@ class RAGChatApp {
 
 		const messageText = document.createElement("div");
 		messageText.className = "message-text";
+		messageText.dir = "auto";
 		messageText.innerHTML = this.formatMessage(text);
 
 		const messageTime = document.createElement("div");
@@ -434,9 +439,7 @@ class RAGChatApp {
 							<span class="source-name">${this.getFilenameFromSource(source)}</span>
 							<span class="source-rank">#${index + 1}</span>
 						</div>
-						<a href="${this.apiUrl}/files/${this.getDocumentIdFromSource(
-							source
-						)}/${this.getFilenameFromSource(
+						<a href="${this.getDownloadUrlFromSource(
 							source
 						)}" target="_blank" class="download-btn" onclick="console.log('Downloading:', '${this.getDocumentIdFromSource(
 							source
@@ -475,6 +478,10 @@ class RAGChatApp {
 	}
 
 	getDocumentIdFromSource(source) {
+		// Structured (v1) sources carry the document ID
+		if (source && typeof source === "object") {
+			return source.document_id || "";
+		}
 		// Check if source contains document ID (format: "doc_id|filename")
 		if (source && source.includes("|")) {
 			return source.split("|")[0];
@@ -484,6 +491,9 @@ class RAGChatApp {
 	}
 
 	getFilenameFromSource(source) {
+		if (source && typeof source === "object") {
+			return source.filename || "unknown.pdf";
+		}
 		// Check if source contains document ID (format: "doc_id|filename")
 		if (source && source.includes("|")) {
 			return source.split("|")[1];
@@ -492,6 +502,21 @@ class RAGChatApp {
 		return source || "unknown.pdf";
 	}
 
+	getDownloadUrlFromSource(source) {
+		// Files are served only through signed links, which come with
+		// structured sources and with a loaded session's download_urls
+		if (source && typeof source === "object" && source.download_url) {
+			return `${this.apiUrl}${source.download_url}`;
+		}
+		const signed = this.sessionDownloadUrls[source];
+		if (signed) {
+			return `${this.apiUrl}${signed}`;
+		}
+		return `${this.apiUrl}/files/${encodeURIComponent(
+			this.getDocumentIdFromSource(source)
+		)}/${encodeURIComponent(this.getFilenameFromSource(source))}/link?redirect=true`;
+	}
+
 	initializeSourceSearch() {
 		const searchInput = document.getElementById("sourceSearchInput");
 		const searchBtn = document.getElementById("searchSourcesBtn");
@@ -564,12 +589,10 @@ class RAGChatApp {
 								2
 							)}</span>
 						</div>
-						<div class="source-snippet">${source.snippet}</div>
+						<div class="source-snippet" dir="${source.direction || "auto"}">${source.snippet}</div>
 						<div class="source-meta">
 							<span>Chunks: ${source.chunk_count}</span>
-							<a href="${this.apiUrl}/files/${source.document_id}/${
-							source.filename
-						}" target="_blank" class="download-btn" onclick="console.log('Downloading from search:', '${
+							<a href="${this.apiUrl}${source.download_url}" target="_blank" class="download-btn" onclick="console.log('Downloading from search:', '${
 							source.document_id
 						}', '${source.filename}')">
 								<i class="fas fa-download"></i> Download
@@ -874,7 +897,7 @@ window.downloadAllSearchResults = function () {
 	// Download each file
 	window.currentSearchResults.forEach((source, index) => {
 		const link = document.createElement("a");
-		link.href = `${apiUrl}/files/${source.document_id}/${source.filename}`;
+		link.href = `${apiUrl}${source.download_url}`;
 		link.download = source.filename;
 		link.target = "_blank";
 